@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// errUsage - arguments do not match the command usage
+var errUsage = errors.New("errUsage")
+
+// client sends requests to the admin and ingestion APIs
+type client struct {
+	addr   string
+	apiKey string
+	// adminAddr and adminKey are those of admin API requests
+	adminAddr string
+	adminKey  string
+	http      *http.Client
+}
+
+// do sends a request and returns the response body, an error if its status is not one of accepted, 2xx by default
+func (c *client) do(method, path string, body io.Reader, header http.Header, accepted ...int) ([]byte, error) {
+	addr, key := c.addr, c.apiKey
+	if strings.HasPrefix(path, "/admin/") {
+		addr, key = c.adminAddr, c.adminKey
+	}
+	req, err := http.NewRequest(method, strings.TrimRight(addr, "/")+path, body)
+	if err != nil {
+		return nil, fmt.Errorf("http.NewRequest.%s", err)
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	if key != "" {
+		req.Header.Set("X-API-Key", key)
+	}
+	res, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("(%s %s).%s", method, path, err)
+	}
+	defer res.Body.Close()
+	resBody, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, fmt.Errorf("(%s %s).ReadAll.%s", method, path, err)
+	}
+	ok := res.StatusCode >= 200 && res.StatusCode < 300
+	if len(accepted) > 0 {
+		ok = false
+		for _, statusCode := range accepted {
+			ok = ok || res.StatusCode == statusCode
+		}
+	}
+	if !ok {
+		return nil, fmt.Errorf("%s %s: %s: %s", method, path, res.Status, strings.TrimSpace(string(resBody)))
+	}
+	return resBody, nil
+}
+
+// get decodes the JSON response of a GET request into v
+func (c *client) get(path string, v interface{}, accepted ...int) error {
+	resBody, err := c.do(http.MethodGet, path, nil, nil, accepted...)
+	if err != nil {
+		return err
+	}
+	err = json.Unmarshal(resBody, v)
+	if err != nil {
+		return fmt.Errorf("(GET %s).json.Unmarshal.%s", path, err)
+	}
+	return nil
+}
+
+// printJSON writes v indented to stdout
+func printJSON(v interface{}) error {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetIndent("", "  ")
+	err := encoder.Encode(v)
+	if err != nil {
+		return fmt.Errorf("json.Encode.%s", err)
+	}
+	_, err = buf.WriteTo(os.Stdout)
+	return err
+}
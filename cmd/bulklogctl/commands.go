@@ -0,0 +1,426 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/khezen/bulklog/pkg/config"
+)
+
+// tailLimit - buffered documents read per poll when following a buffer
+const tailLimit = 1000
+
+// pipe - pending pipe as listed by the admin API
+type pipe struct {
+	ID        string    `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+	Documents int       `json:"documents"`
+	Bytes     int64     `json:"bytes,omitempty"`
+	Outputs   []struct {
+		Name        string     `json:"name"`
+		Iteration   int        `json:"iteration"`
+		NextRetryAt *time.Time `json:"next_retry_at,omitempty"`
+	} `json:"outputs"`
+}
+
+// runTail prints the last documents buffered by a collection, one JSON object per line.
+// Following polls the buffer for documents buffered since, those flushed between two polls are missed.
+func runTail(c *client, args []string) error {
+	fs := flag.NewFlagSet("tail", flag.ExitOnError)
+	n := fs.Int("n", 10, "documents to print")
+	follow := fs.Bool("f", false, "keep printing documents as they are buffered")
+	interval := fs.Duration("interval", time.Second, "poll interval when following")
+	fs.Parse(args)
+	if fs.NArg() != 1 || *n <= 0 {
+		return errUsage
+	}
+	var (
+		path  = fmt.Sprintf("/admin/buffers/%s", url.PathEscape(fs.Arg(0)))
+		limit = *n
+		seen  map[string]struct{}
+	)
+	if *follow {
+		limit = tailLimit
+	}
+	for {
+		var res struct {
+			Documents []json.RawMessage `json:"documents"`
+		}
+		err := c.get(fmt.Sprintf("%s?limit=%d", path, limit), &res)
+		if err != nil {
+			return err
+		}
+		current := make(map[string]struct{}, len(res.Documents))
+		for i, doc := range res.Documents {
+			var id struct {
+				ID string `json:"id"`
+			}
+			json.Unmarshal(doc, &id)
+			current[id.ID] = struct{}{}
+			if _, ok := seen[id.ID]; ok || (seen == nil && i < len(res.Documents)-*n) {
+				continue
+			}
+			fmt.Println(string(doc))
+		}
+		if !*follow {
+			return nil
+		}
+		seen = current
+		time.Sleep(*interval)
+	}
+}
+
+// runPipes lists, inspects, prints the documents of, retries or purges the pending pipes of a collection
+func runPipes(c *client, args []string) error {
+	if len(args) < 2 {
+		return errUsage
+	}
+	var (
+		action         = args[0]
+		collectionName = url.PathEscape(args[1])
+		ids            = args[2:]
+	)
+	switch action {
+	case "list":
+		if len(ids) > 0 {
+			return errUsage
+		}
+		pipes, err := listPipes(c, collectionName)
+		if err != nil {
+			return err
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tCREATED\tEXPIRES\tDOCUMENTS\tBYTES\tOUTPUTS")
+		for _, p := range pipes {
+			outputs := make([]string, 0, len(p.Outputs))
+			for _, out := range p.Outputs {
+				outputs = append(outputs, fmt.Sprintf("%s(%d)", out.Name, out.Iteration))
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%d\t%s\n", p.ID, p.CreatedAt.Format(time.RFC3339), p.ExpiresAt.Format(time.RFC3339), p.Documents, p.Bytes, strings.Join(outputs, ","))
+		}
+		return tw.Flush()
+	case "inspect":
+		if len(ids) != 1 {
+			return errUsage
+		}
+		var p json.RawMessage
+		err := c.get(fmt.Sprintf("/admin/pipes/%s/%s", collectionName, url.PathEscape(ids[0])), &p)
+		if err != nil {
+			return err
+		}
+		return printJSON(p)
+	case "documents":
+		if len(ids) != 1 {
+			return errUsage
+		}
+		return printPipeDocuments(c, collectionName, ids[0])
+	case "retry":
+		if len(ids) == 0 {
+			return errUsage
+		}
+		for _, id := range ids {
+			_, err := c.do(http.MethodPost, fmt.Sprintf("/admin/pipes/%s/%s/retry", collectionName, url.PathEscape(id)), nil, nil)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("retrying %s\n", id)
+		}
+		return nil
+	case "purge":
+		return purgePipes(c, collectionName, ids)
+	default:
+		return errUsage
+	}
+}
+
+func listPipes(c *client, collectionName string) ([]pipe, error) {
+	var res struct {
+		Pipes []pipe `json:"pipes"`
+	}
+	err := c.get(fmt.Sprintf("/admin/pipes/%s", collectionName), &res)
+	if err != nil {
+		return nil, err
+	}
+	return res.Pipes, nil
+}
+
+// printPipeDocuments prints every document of a pipe, one JSON object per line, a page of tailLimit documents at a time
+func printPipeDocuments(c *client, collectionName, id string) error {
+	path := fmt.Sprintf("/admin/pipes/%s/%s/documents", collectionName, url.PathEscape(id))
+	for offset := 0; ; {
+		var res struct {
+			Documents []json.RawMessage `json:"documents"`
+			Total     int               `json:"total"`
+		}
+		err := c.get(fmt.Sprintf("%s?offset=%d&limit=%d", path, offset, tailLimit), &res)
+		if err != nil {
+			return err
+		}
+		for _, doc := range res.Documents {
+			fmt.Println(string(doc))
+		}
+		offset += len(res.Documents)
+		if len(res.Documents) == 0 || offset >= res.Total {
+			return nil
+		}
+	}
+}
+
+// purgePipes discards the given pipes without dead lettering them, or every pending pipe if ids is -all
+func purgePipes(c *client, collectionName string, ids []string) error {
+	if len(ids) == 0 {
+		return errUsage
+	}
+	if len(ids) == 1 && ids[0] == "-all" {
+		pipes, err := listPipes(c, collectionName)
+		if err != nil {
+			return err
+		}
+		ids = make([]string, 0, len(pipes))
+		for _, p := range pipes {
+			ids = append(ids, p.ID)
+		}
+	}
+	for _, id := range ids {
+		// pipes delivered meanwhile are not pending anymore
+		_, err := c.do(http.MethodDelete, fmt.Sprintf("/admin/pipes/%s/%s", collectionName, url.PathEscape(id)), nil, nil, http.StatusNoContent, http.StatusNotFound)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("discarded %s\n", id)
+	}
+	return nil
+}
+
+// runSnapshot writes the buffered documents and pending pipes of a collection to a file, or to stdout
+func runSnapshot(c *client, args []string) error {
+	if len(args) != 1 && len(args) != 2 {
+		return errUsage
+	}
+	snapshot, err := c.do(http.MethodGet, fmt.Sprintf("/admin/snapshots/%s", url.PathEscape(args[0])), nil, nil)
+	if err != nil {
+		return err
+	}
+	if len(args) == 1 {
+		_, err = os.Stdout.Write(snapshot)
+		return err
+	}
+	err = ioutil.WriteFile(args[1], snapshot, 0644)
+	if err != nil {
+		return fmt.Errorf("ioutil.WriteFile.%s", err)
+	}
+	return nil
+}
+
+// runRestore restores a snapshot read from a file, or from stdin, into a collection
+func runRestore(c *client, args []string) error {
+	if len(args) != 1 && len(args) != 2 {
+		return errUsage
+	}
+	var body io.Reader = os.Stdin
+	if len(args) == 2 {
+		file, err := os.Open(args[1])
+		if err != nil {
+			return fmt.Errorf("os.Open.%s", err)
+		}
+		defer file.Close()
+		body = file
+	}
+	header := http.Header{}
+	header.Set("Content-Type", "application/json")
+	resBody, err := c.do(http.MethodPost, fmt.Sprintf("/admin/snapshots/%s", url.PathEscape(args[0])), body, header)
+	if err != nil {
+		return err
+	}
+	return printJSON(json.RawMessage(resBody))
+}
+
+// runPost posts documents of a file, or of stdin, to the bulk endpoint: a JSON array or one document per line
+func runPost(c *client, args []string) error {
+	fs := flag.NewFlagSet("post", flag.ExitOnError)
+	tenantID := fs.String("tenant", "", "tenant the documents belong to, if credentials carry none")
+	tenantHeader := fs.String("tenant-header", "X-Tenant-ID", "header naming the tenant")
+	fs.Parse(args)
+	if fs.NArg() != 2 && fs.NArg() != 3 {
+		return errUsage
+	}
+	var body io.Reader = os.Stdin
+	if fs.NArg() == 3 {
+		file, err := os.Open(fs.Arg(2))
+		if err != nil {
+			return fmt.Errorf("os.Open.%s", err)
+		}
+		defer file.Close()
+		body = file
+	}
+	header := http.Header{}
+	header.Set("Content-Type", "application/x-ndjson")
+	if *tenantID != "" {
+		header.Set(*tenantHeader, *tenantID)
+	}
+	resBody, err := c.do(http.MethodPost, fmt.Sprintf("/v1/%s/%s/_bulk", url.PathEscape(fs.Arg(0)), url.PathEscape(fs.Arg(1))), body, header)
+	if err != nil {
+		return err
+	}
+	var res struct {
+		Errors bool              `json:"errors"`
+		Items  []json.RawMessage `json:"items"`
+	}
+	err = json.Unmarshal(resBody, &res)
+	if err != nil {
+		return fmt.Errorf("json.Unmarshal.%s", err)
+	}
+	err = printJSON(res)
+	if err != nil {
+		return err
+	}
+	if res.Errors {
+		return fmt.Errorf("some documents were rejected")
+	}
+	return nil
+}
+
+// runValidate checks config files as bulklog does at startup, environment and flag overrides aside
+func runValidate(c *client, args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+	invalid := 0
+	for _, path := range args {
+		_, err := config.LoadFile(path)
+		if err != nil {
+			invalid++
+			fmt.Printf("%s: invalid\n%s\n", path, err)
+			continue
+		}
+		fmt.Printf("%s: ok\n", path)
+	}
+	if invalid > 0 {
+		return fmt.Errorf("%d of %d config files are invalid", invalid, len(args))
+	}
+	return nil
+}
+
+// runMetrics dumps output states, tenant usage, pipe integrity, startup recovery and readiness checks at once
+func runMetrics(c *client, args []string) error {
+	if len(args) > 0 {
+		return errUsage
+	}
+	var metrics struct {
+		Outputs     json.RawMessage `json:"outputs"`
+		Tenants     json.RawMessage `json:"tenants"`
+		Collections json.RawMessage `json:"collections"`
+		Recoveries  json.RawMessage `json:"recoveries"`
+		Checks      json.RawMessage `json:"checks"`
+	}
+	err := c.get("/admin/outputs", &metrics)
+	if err != nil {
+		return err
+	}
+	err = c.get("/admin/tenants", &metrics)
+	if err != nil {
+		return err
+	}
+	err = c.get("/admin/integrity", &metrics)
+	if err != nil {
+		return err
+	}
+	err = c.get("/admin/recovery", &metrics)
+	if err != nil {
+		return err
+	}
+	// not ready instances answer 503 with their checks
+	err = c.get("/readyz", &metrics, http.StatusOK, http.StatusServiceUnavailable)
+	if err != nil {
+		return err
+	}
+	return printJSON(metrics)
+}
+
+// pausePath - admin path pausing or resuming a collection or an output
+func pausePath(kind, name, action string) (string, error) {
+	switch kind {
+	case "collection", "output":
+		return fmt.Sprintf("/admin/%ss/%s/%s", kind, url.PathEscape(name), action), nil
+	default:
+		return "", errUsage
+	}
+}
+
+// runPause pauses a collection, rejecting or buffering its new documents, or holds the deliveries to an output
+func runPause(c *client, args []string) error {
+	fs := flag.NewFlagSet("pause", flag.ExitOnError)
+	mode := fs.String("mode", "", "reject|buffer, what a paused collection does with new documents, reject by default")
+	fs.Parse(args)
+	if fs.NArg() != 2 || (*mode != "" && fs.Arg(0) != "collection") {
+		return errUsage
+	}
+	path, err := pausePath(fs.Arg(0), fs.Arg(1), "pause")
+	if err != nil {
+		return err
+	}
+	if *mode != "" {
+		path = fmt.Sprintf("%s?mode=%s", path, url.QueryEscape(*mode))
+	}
+	resBody, err := c.do(http.MethodPost, path, nil, nil)
+	if err != nil {
+		return err
+	}
+	return printJSON(json.RawMessage(resBody))
+}
+
+// runResume resumes a paused collection or output
+func runResume(c *client, args []string) error {
+	if len(args) != 2 {
+		return errUsage
+	}
+	path, err := pausePath(args[0], args[1], "resume")
+	if err != nil {
+		return err
+	}
+	_, err = c.do(http.MethodPost, path, nil, nil)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("resumed %s %s\n", args[0], args[1])
+	return nil
+}
+
+// runPauses lists the collections and outputs paused on the instance
+func runPauses(c *client, args []string) error {
+	if len(args) > 0 {
+		return errUsage
+	}
+	var res struct {
+		Pauses []struct {
+			Collection string    `json:"collection"`
+			Output     string    `json:"output"`
+			Mode       string    `json:"mode"`
+			Since      time.Time `json:"since"`
+		} `json:"pauses"`
+	}
+	err := c.get("/admin/pauses", &res)
+	if err != nil {
+		return err
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "KIND\tNAME\tMODE\tSINCE")
+	for _, p := range res.Pauses {
+		if p.Collection != "" {
+			fmt.Fprintf(tw, "collection\t%s\t%s\t%s\n", p.Collection, p.Mode, p.Since.Format(time.RFC3339))
+		} else {
+			fmt.Fprintf(tw, "output\t%s\t-\t%s\n", p.Output, p.Since.Format(time.RFC3339))
+		}
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,90 @@
+// bulklogctl operates a bulklog instance through its admin API
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+)
+
+const (
+	defaultAddr    = "http://localhost:5017"
+	defaultTimeout = 30 * time.Second
+)
+
+// command runs a subcommand with its arguments, flags included
+type command struct {
+	usage string
+	run   func(c *client, args []string) error
+}
+
+var commands = map[string]command{
+	"tail":     {"tail [-n 10] [-f] [-interval 1s] <collection>", runTail},
+	"pipes":    {"pipes list|inspect|documents|retry|purge <collection> [pipe...|-all]", runPipes},
+	"snapshot": {"snapshot <collection> [file]", runSnapshot},
+	"restore":  {"restore <collection> [file]", runRestore},
+	"post":     {"post [-tenant id] [-tenant-header X-Tenant-ID] <collection> <schema> [file]", runPost},
+	"validate": {"validate <file>...", runValidate},
+	"metrics":  {"metrics", runMetrics},
+	"pause":    {"pause [-mode reject|buffer] collection|output <name>", runPause},
+	"resume":   {"resume collection|output <name>", runResume},
+	"pauses":   {"pauses", runPauses},
+}
+
+var order = []string{"tail", "pipes", "snapshot", "restore", "post", "validate", "metrics", "pause", "resume", "pauses"}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: bulklogctl [-addr %s] [-api-key key] [-admin-addr url] [-admin-key key] [-timeout 30s] <command>\n\ncommands:\n", defaultAddr)
+	for _, name := range order {
+		fmt.Fprintf(os.Stderr, "  %s\n", commands[name].usage)
+	}
+	fmt.Fprintf(os.Stderr, "\nBULKLOGCTL_ADDR, BULKLOGCTL_API_KEY, BULKLOGCTL_ADMIN_ADDR and BULKLOGCTL_ADMIN_KEY set the defaults of -addr, -api-key, -admin-addr and -admin-key.\n")
+}
+
+func main() {
+	addr := os.Getenv("BULKLOGCTL_ADDR")
+	if addr == "" {
+		addr = defaultAddr
+	}
+	flag.StringVar(&addr, "addr", addr, "base URL of the bulklog instance")
+	apiKey := flag.String("api-key", os.Getenv("BULKLOGCTL_API_KEY"), "API key sent as X-API-Key")
+	adminAddr := flag.String("admin-addr", os.Getenv("BULKLOGCTL_ADMIN_ADDR"), "base URL of the admin API, -addr by default")
+	adminKey := flag.String("admin-key", os.Getenv("BULKLOGCTL_ADMIN_KEY"), "API key of admin API requests, -api-key by default")
+	timeout := flag.Duration("timeout", defaultTimeout, "timeout of each request")
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() == 0 {
+		usage()
+		os.Exit(2)
+	}
+	cmd, ok := commands[flag.Arg(0)]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n", flag.Arg(0))
+		usage()
+		os.Exit(2)
+	}
+	if *adminAddr == "" {
+		*adminAddr = addr
+	}
+	if *adminKey == "" {
+		*adminKey = *apiKey
+	}
+	c := &client{
+		addr:      addr,
+		apiKey:    *apiKey,
+		adminAddr: *adminAddr,
+		adminKey:  *adminKey,
+		http:      &http.Client{Timeout: *timeout},
+	}
+	err := cmd.run(c, flag.Args()[1:])
+	if err == errUsage {
+		fmt.Fprintf(os.Stderr, "usage: bulklogctl %s\n", cmd.usage)
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
@@ -1,16 +1,25 @@
 package main
 
 import (
+	"context"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
+	// embedded, so timezones of timestamp processors load in images without zoneinfo
+	_ "time/tzdata"
 
 	"github.com/khezen/bulklog/pkg/config"
 	"github.com/khezen/bulklog/pkg/log"
 	"github.com/khezen/bulklog/pkg/server"
+	"github.com/khezen/bulklog/pkg/trace"
 )
 
 const (
-	maxTries    = 30
-	retryPeriod = 5 * time.Second
+	maxTries        = 30
+	retryPeriod     = 5 * time.Second
+	shutdownTimeout = 30 * time.Second
 )
 
 var (
@@ -29,11 +38,19 @@ func main() {
 	if err != nil {
 		panic(err)
 	}
+	logger, err := log.New(cfg.Log)
+	if err != nil {
+		panic(err)
+	}
+	err = trace.Init(cfg.Tracing, logger)
+	if err != nil {
+		panic(err)
+	}
 	for {
-		serv, err = server.New(cfg, quit)
+		serv, err = server.New(cfg, logger, quit)
 		if err != nil {
 			if i < maxTries {
-				log.Err().Println(err)
+				logger.Error("server start failed", "try", i, "error", err)
 				timer = time.NewTimer(retryPeriod)
 				<-timer.C
 				i++
@@ -47,7 +64,56 @@ func main() {
 	if err != nil {
 		panic(err)
 	}
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+	reloads := make(chan os.Signal, 1)
+	signal.Notify(reloads, syscall.SIGHUP)
+	var changes <-chan struct{}
+	if cfg.Reload.Watch {
+		interval, err := cfg.Reload.Interval()
+		if err != nil {
+			panic(err)
+		}
+		changes = config.Watch(interval, make(chan struct{}))
+	}
 	go serv.ListenAndServe()
-	err = <-quit
-	panic(err)
+	for {
+		select {
+		case err = <-quit:
+			panic(err)
+		case sig := <-reloads:
+			reload(logger.With("signal", sig.String()))
+		case <-changes:
+			reload(logger.With("path", config.Path()))
+		case sig := <-signals:
+			logger.Info("draining buffers", "signal", sig.String())
+			ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+			err = serv.Shutdown(ctx)
+			traceErr := trace.Shutdown(ctx)
+			cancel()
+			if traceErr != nil {
+				logger.Warn("spans export interrupted", "error", traceErr)
+			}
+			if err != nil {
+				logger.Error("shutdown failed", "error", err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+}
+
+// reload applies collections and outputs of the config file, the running config is kept on failure
+func reload(logger *slog.Logger) {
+	newCfg, err := config.Load()
+	if err != nil {
+		logger.Error("config reload failed", "error", err)
+		return
+	}
+	err = serv.Reload(newCfg)
+	if err != nil {
+		logger.Error("config reload failed", "error", err)
+		return
+	}
+	logger.Info("config reloaded")
 }
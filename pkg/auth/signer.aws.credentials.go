@@ -0,0 +1,253 @@
+package auth
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/credentials"
+)
+
+const (
+	// awsCredentialsWindow - credentials are renewed this long before they expire
+	awsCredentialsWindow = 5 * time.Minute
+	// awsMetadataTimeout bounds requests to the instance and container metadata endpoints, which are unreachable outside of AWS
+	awsMetadataTimeout = 2 * time.Second
+	// awsSTSTimeout bounds requests to STS
+	awsSTSTimeout         = 10 * time.Second
+	ec2MetadataEndpoint   = "http://169.254.169.254"
+	ecsCredentialsHost    = "http://169.254.170.2"
+	awsWebIdentityVersion = "2011-06-15"
+)
+
+// ErrNoAWSCredentials - the provider is not configured in this environment
+var ErrNoAWSCredentials = errors.New("ErrNoAWSCredentials - no credentials in this environment")
+
+// newAWSCredentialsChain looks up credentials as AWS SDKs do: environment variables, shared credentials file,
+// web identity token of an IAM role for service accounts (IRSA), container credentials (ECS, EKS Pod Identity), then EC2 instance role
+func newAWSCredentialsChain(profile, region string) *credentials.Credentials {
+	return credentials.NewCredentials(&credentials.ChainProvider{
+		VerboseErrors: true,
+		Providers: []credentials.Provider{
+			&credentials.EnvProvider{},
+			&credentials.SharedCredentialsProvider{Profile: profile},
+			&webIdentityProvider{region: region, httpcli: http.Client{Timeout: awsSTSTimeout}},
+			&containerProvider{httpcli: http.Client{Timeout: awsMetadataTimeout}},
+			&ec2RoleProvider{httpcli: http.Client{Timeout: awsMetadataTimeout}},
+		},
+	})
+}
+
+// awsRegion - region of the config, of the environment otherwise
+func awsRegion(region string) string {
+	if region != "" {
+		return region
+	}
+	if region = os.Getenv("AWS_REGION"); region != "" {
+		return region
+	}
+	return os.Getenv("AWS_DEFAULT_REGION")
+}
+
+// webIdentityProvider assumes the role of AWS_ROLE_ARN with the token of AWS_WEB_IDENTITY_TOKEN_FILE, as set by EKS for IRSA
+type webIdentityProvider struct {
+	credentials.Expiry
+	region  string
+	httpcli http.Client
+}
+
+type assumeRoleWithWebIdentityResponse struct {
+	Credentials struct {
+		AccessKeyID     string    `xml:"AccessKeyId"`
+		SecretAccessKey string    `xml:"SecretAccessKey"`
+		SessionToken    string    `xml:"SessionToken"`
+		Expiration      time.Time `xml:"Expiration"`
+	} `xml:"AssumeRoleWithWebIdentityResult>Credentials"`
+}
+
+func (p *webIdentityProvider) Retrieve() (credentials.Value, error) {
+	roleARN, tokenFile := os.Getenv("AWS_ROLE_ARN"), os.Getenv("AWS_WEB_IDENTITY_TOKEN_FILE")
+	if roleARN == "" || tokenFile == "" {
+		return credentials.Value{}, ErrNoAWSCredentials
+	}
+	// the token is rotated by the kubelet, it is read again each time
+	token, err := ioutil.ReadFile(tokenFile)
+	if err != nil {
+		return credentials.Value{}, fmt.Errorf("ioutil.ReadFile.%s", err)
+	}
+	sessionName := os.Getenv("AWS_ROLE_SESSION_NAME")
+	if sessionName == "" {
+		sessionName = fmt.Sprintf("bulklog-%d", time.Now().UnixNano())
+	}
+	endpoint := "https://sts.amazonaws.com/"
+	if region := awsRegion(p.region); region != "" {
+		endpoint = fmt.Sprintf("https://sts.%s.amazonaws.com/", region)
+	}
+	form := url.Values{
+		"Action":           {"AssumeRoleWithWebIdentity"},
+		"Version":          {awsWebIdentityVersion},
+		"RoleArn":          {roleARN},
+		"RoleSessionName":  {sessionName},
+		"WebIdentityToken": {strings.TrimSpace(string(token))},
+	}
+	res, err := p.httpcli.PostForm(endpoint, form)
+	if err != nil {
+		return credentials.Value{}, fmt.Errorf("httpClient.PostForm.%s", err)
+	}
+	defer res.Body.Close()
+	resBody, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return credentials.Value{}, fmt.Errorf("ioutil.ReadAll.%s", err)
+	}
+	if res.StatusCode != http.StatusOK {
+		return credentials.Value{}, fmt.Errorf("sts: %s : %s", res.Status, resBody)
+	}
+	var assumed assumeRoleWithWebIdentityResponse
+	err = xml.Unmarshal(resBody, &assumed)
+	if err != nil {
+		return credentials.Value{}, fmt.Errorf("xml.Unmarshal.%s", err)
+	}
+	p.SetExpiration(assumed.Credentials.Expiration, awsCredentialsWindow)
+	return credentials.Value{
+		AccessKeyID:     assumed.Credentials.AccessKeyID,
+		SecretAccessKey: assumed.Credentials.SecretAccessKey,
+		SessionToken:    assumed.Credentials.SessionToken,
+		ProviderName:    "WebIdentityProvider",
+	}, nil
+}
+
+// metadataCredentials - credentials served by the container and instance metadata endpoints
+type metadataCredentials struct {
+	AccessKeyID     string    `json:"AccessKeyId"`
+	SecretAccessKey string    `json:"SecretAccessKey"`
+	Token           string    `json:"Token"`
+	Expiration      time.Time `json:"Expiration"`
+}
+
+// containerProvider reads the credentials of the task role (ECS) or of the pod identity (EKS)
+type containerProvider struct {
+	credentials.Expiry
+	httpcli http.Client
+}
+
+func (p *containerProvider) Retrieve() (credentials.Value, error) {
+	var endpoint string
+	switch {
+	case os.Getenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI") != "":
+		endpoint = ecsCredentialsHost + os.Getenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI")
+	case os.Getenv("AWS_CONTAINER_CREDENTIALS_FULL_URI") != "":
+		endpoint = os.Getenv("AWS_CONTAINER_CREDENTIALS_FULL_URI")
+	default:
+		return credentials.Value{}, ErrNoAWSCredentials
+	}
+	req, err := http.NewRequest(http.MethodGet, endpoint, nil)
+	if err != nil {
+		return credentials.Value{}, fmt.Errorf("http.NewRequest.%s", err)
+	}
+	authorization := os.Getenv("AWS_CONTAINER_AUTHORIZATION_TOKEN")
+	if tokenFile := os.Getenv("AWS_CONTAINER_AUTHORIZATION_TOKEN_FILE"); tokenFile != "" {
+		token, err := ioutil.ReadFile(tokenFile)
+		if err != nil {
+			return credentials.Value{}, fmt.Errorf("ioutil.ReadFile.%s", err)
+		}
+		authorization = strings.TrimSpace(string(token))
+	}
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	var creds metadataCredentials
+	err = getJSON(&p.httpcli, req, &creds)
+	if err != nil {
+		return credentials.Value{}, fmt.Errorf("getJSON.%s", err)
+	}
+	p.SetExpiration(creds.Expiration, awsCredentialsWindow)
+	return creds.value("ContainerProvider"), nil
+}
+
+// ec2RoleProvider reads the credentials of the instance role from the instance metadata service, IMDSv2
+type ec2RoleProvider struct {
+	credentials.Expiry
+	httpcli http.Client
+}
+
+func (p *ec2RoleProvider) Retrieve() (credentials.Value, error) {
+	req, err := http.NewRequest(http.MethodPut, ec2MetadataEndpoint+"/latest/api/token", nil)
+	if err != nil {
+		return credentials.Value{}, fmt.Errorf("http.NewRequest.%s", err)
+	}
+	req.Header.Set("X-aws-ec2-metadata-token-ttl-seconds", "21600")
+	token, err := getText(&p.httpcli, req)
+	if err != nil {
+		return credentials.Value{}, fmt.Errorf("getText(token).%s", err)
+	}
+	endpoint := ec2MetadataEndpoint + "/latest/meta-data/iam/security-credentials/"
+	req, err = http.NewRequest(http.MethodGet, endpoint, nil)
+	if err != nil {
+		return credentials.Value{}, fmt.Errorf("http.NewRequest.%s", err)
+	}
+	req.Header.Set("X-aws-ec2-metadata-token", token)
+	roles, err := getText(&p.httpcli, req)
+	if err != nil {
+		return credentials.Value{}, fmt.Errorf("getText(role).%s", err)
+	}
+	role := strings.TrimSpace(strings.SplitN(roles, "\n", 2)[0])
+	if role == "" {
+		return credentials.Value{}, ErrNoAWSCredentials
+	}
+	req, err = http.NewRequest(http.MethodGet, endpoint+role, nil)
+	if err != nil {
+		return credentials.Value{}, fmt.Errorf("http.NewRequest.%s", err)
+	}
+	req.Header.Set("X-aws-ec2-metadata-token", token)
+	var creds metadataCredentials
+	err = getJSON(&p.httpcli, req, &creds)
+	if err != nil {
+		return credentials.Value{}, fmt.Errorf("getJSON.%s", err)
+	}
+	p.SetExpiration(creds.Expiration, awsCredentialsWindow)
+	return creds.value("EC2RoleProvider"), nil
+}
+
+func (c metadataCredentials) value(providerName string) credentials.Value {
+	return credentials.Value{
+		AccessKeyID:     c.AccessKeyID,
+		SecretAccessKey: c.SecretAccessKey,
+		SessionToken:    c.Token,
+		ProviderName:    providerName,
+	}
+}
+
+func getText(httpcli *http.Client, req *http.Request) (string, error) {
+	res, err := httpcli.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("httpClient.Do.%s", err)
+	}
+	defer res.Body.Close()
+	resBody, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return "", fmt.Errorf("ioutil.ReadAll.%s", err)
+	}
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("metadata: %s", res.Status)
+	}
+	return string(resBody), nil
+}
+
+func getJSON(httpcli *http.Client, req *http.Request, value interface{}) error {
+	text, err := getText(httpcli, req)
+	if err != nil {
+		return err
+	}
+	err = json.Unmarshal([]byte(text), value)
+	if err != nil {
+		return fmt.Errorf("json.Unmarshal.%s", err)
+	}
+	return nil
+}
@@ -2,6 +2,8 @@ package auth
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"net/http"
 	"time"
 
@@ -9,19 +11,25 @@ import (
 	signer "github.com/aws/aws-sdk-go/aws/signer/v4"
 )
 
-// AWSConfig provide credential for AWS services signing
+// AWSConfig provide credential for AWS services signing.
+// Without access key, credentials are looked up in the environment, see newAWSCredentialsChain.
 type AWSConfig struct {
 	AccessKeyID     string `yaml:"access_key_id"`
 	SecretAccessKey string `yaml:"secret_access_key"`
 	Region          string `yaml:"region"`
+	// Profile - profile of the shared credentials file, AWS_PROFILE or default unless set
+	Profile string `yaml:"profile"`
 }
 
 // NewAWSSigner provides  AWS v4 signing to given request
 func NewAWSSigner(cfg AWSConfig, service string) Signer {
 	cred := credentials.NewStaticCredentials(cfg.AccessKeyID, cfg.SecretAccessKey, "")
+	if cfg.AccessKeyID == "" {
+		cred = newAWSCredentialsChain(cfg.Profile, cfg.Region)
+	}
 	return &awsSigner{
 		service,
-		cfg.Region,
+		awsRegion(cfg.Region),
 		signer.NewSigner(cred),
 	}
 }
@@ -33,7 +41,17 @@ type awsSigner struct {
 }
 
 func (s *awsSigner) Sign(req *http.Request, body []byte) error {
+	// OpenSearch Serverless requires the payload hash, which the signer only sets for s3 and glacier
+	if s.service == "aoss" {
+		hash := sha256.Sum256(body)
+		req.Header.Set("X-Amz-Content-Sha256", hex.EncodeToString(hash[:]))
+	}
 	byteReader := bytes.NewReader(body)
-	_, err := s.client.Sign(req, byteReader, "es", s.region, time.Now())
+	_, err := s.client.Sign(req, byteReader, s.service, s.region, time.Now())
 	return err
 }
+
+// ResolvedRegion - region of the config, AWS_REGION or AWS_DEFAULT_REGION unless set
+func (cfg AWSConfig) ResolvedRegion() string {
+	return awsRegion(cfg.Region)
+}
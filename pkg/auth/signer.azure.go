@@ -0,0 +1,245 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	azureIMDSEndpoint    = "http://169.254.169.254/metadata/identity/oauth2/token"
+	azureAuthorityHost   = "https://login.microsoftonline.com/"
+	azureIMDSVersion     = "2018-02-01"
+	azureAppServiceVer   = "2019-08-01"
+	azureTokenWindow     = 5 * time.Minute
+	azureIdentityTimeout = 10 * time.Second
+)
+
+var (
+	// ErrAmbiguousAzureAuth - account key and SAS token are exclusive
+	ErrAmbiguousAzureAuth = errors.New("ErrAmbiguousAzureAuth - azure_auth accepts one of account_key and sas_token")
+	// ErrInvalidAccountKey - account key is not base64 encoded
+	ErrInvalidAccountKey = errors.New("ErrInvalidAccountKey - azure account key must be base64 encoded")
+)
+
+// AzureConfig provide credentials for Azure Storage.
+// If neither AccountKey nor SASToken is set, tokens of the managed identity are requested:
+// workload identity on AKS, App Service identity, then the instance metadata service.
+type AzureConfig struct {
+	AccountKey string `yaml:"account_key"`
+	SASToken   string `yaml:"sas_token"`
+	// ClientID - client ID of a user assigned managed identity, the system assigned one otherwise
+	ClientID string `yaml:"client_id"`
+}
+
+// NewAzureSigner authorizes requests to resource, such as https://storage.azure.com/, of the storage account
+func NewAzureSigner(cfg AzureConfig, account, resource string) (Signer, error) {
+	switch {
+	case cfg.AccountKey != "" && cfg.SASToken != "":
+		return nil, ErrAmbiguousAzureAuth
+	case cfg.AccountKey != "":
+		key, err := base64.StdEncoding.DecodeString(cfg.AccountKey)
+		if err != nil {
+			return nil, ErrInvalidAccountKey
+		}
+		return &azureSharedKeySigner{account, key}, nil
+	case cfg.SASToken != "":
+		query, err := url.ParseQuery(strings.TrimPrefix(cfg.SASToken, "?"))
+		if err != nil {
+			return nil, fmt.Errorf("url.ParseQuery.%s", err)
+		}
+		return &azureSASSigner{query}, nil
+	default:
+		return &azureIdentitySigner{
+			resource: resource,
+			clientID: cfg.ClientID,
+			httpcli:  http.Client{Timeout: azureIdentityTimeout},
+		}, nil
+	}
+}
+
+// azureSharedKeySigner - ref: https://learn.microsoft.com/en-us/rest/api/storageservices/authorize-with-shared-key
+type azureSharedKeySigner struct {
+	account string
+	key     []byte
+}
+
+func (s *azureSharedKeySigner) Sign(r *http.Request, body []byte) error {
+	r.Header.Set("x-ms-date", time.Now().UTC().Format(http.TimeFormat))
+	contentLength := ""
+	if len(body) > 0 {
+		contentLength = strconv.Itoa(len(body))
+	}
+	var stringToSign strings.Builder
+	stringToSign.WriteString(r.Method + "\n")
+	for _, header := range []string{"Content-Encoding", "Content-Language"} {
+		stringToSign.WriteString(r.Header.Get(header) + "\n")
+	}
+	stringToSign.WriteString(contentLength + "\n")
+	for _, header := range []string{"Content-MD5", "Content-Type", "Date", "If-Modified-Since", "If-Match", "If-None-Match", "If-Unmodified-Since", "Range"} {
+		stringToSign.WriteString(r.Header.Get(header) + "\n")
+	}
+	msHeaders := make([]string, 0)
+	for name := range r.Header {
+		if name = strings.ToLower(name); strings.HasPrefix(name, "x-ms-") {
+			msHeaders = append(msHeaders, name)
+		}
+	}
+	sort.Strings(msHeaders)
+	for _, name := range msHeaders {
+		stringToSign.WriteString(fmt.Sprintf("%s:%s\n", name, strings.TrimSpace(r.Header.Get(name))))
+	}
+	stringToSign.WriteString(fmt.Sprintf("/%s%s", s.account, r.URL.EscapedPath()))
+	query := r.URL.Query()
+	params := make([]string, 0, len(query))
+	for name := range query {
+		params = append(params, name)
+	}
+	sort.Strings(params)
+	for _, name := range params {
+		values := query[name]
+		sort.Strings(values)
+		stringToSign.WriteString(fmt.Sprintf("\n%s:%s", strings.ToLower(name), strings.Join(values, ",")))
+	}
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte(stringToSign.String()))
+	r.Header.Set("Authorization", fmt.Sprintf("SharedKey %s:%s", s.account, base64.StdEncoding.EncodeToString(mac.Sum(nil))))
+	return nil
+}
+
+// azureSASSigner adds the shared access signature to the query
+type azureSASSigner struct {
+	query url.Values
+}
+
+func (s *azureSASSigner) Sign(r *http.Request, body []byte) error {
+	query := r.URL.Query()
+	for name, values := range s.query {
+		query[name] = values
+	}
+	r.URL.RawQuery = query.Encode()
+	return nil
+}
+
+// azureIdentitySigner sets bearer tokens of the managed identity, renewed 5 minutes before they expire
+type azureIdentitySigner struct {
+	sync.Mutex
+	resource  string
+	clientID  string
+	token     string
+	expiresAt time.Time
+	httpcli   http.Client
+}
+
+// azureToken - token response of Microsoft Entra ID and managed identity endpoints, which render numbers as strings
+type azureToken struct {
+	AccessToken string      `json:"access_token"`
+	ExpiresIn   json.Number `json:"expires_in"`
+	ExpiresOn   json.Number `json:"expires_on"`
+}
+
+func (s *azureIdentitySigner) Sign(r *http.Request, body []byte) error {
+	s.Lock()
+	defer s.Unlock()
+	if s.token == "" || time.Now().After(s.expiresAt.Add(-azureTokenWindow)) {
+		token, err := s.requestToken()
+		if err != nil {
+			return err
+		}
+		s.token = token.AccessToken
+		if expiresOn, err := token.ExpiresOn.Int64(); err == nil {
+			s.expiresAt = time.Unix(expiresOn, 0)
+		} else {
+			expiresIn, _ := token.ExpiresIn.Int64()
+			s.expiresAt = time.Now().Add(time.Duration(expiresIn) * time.Second)
+		}
+	}
+	r.Header.Set("Authorization", fmt.Sprintf("Bearer %s", s.token))
+	return nil
+}
+
+func (s *azureIdentitySigner) requestToken() (*azureToken, error) {
+	clientID := s.clientID
+	if clientID == "" {
+		clientID = os.Getenv("AZURE_CLIENT_ID")
+	}
+	var (
+		req *http.Request
+		err error
+	)
+	switch {
+	case os.Getenv("AZURE_FEDERATED_TOKEN_FILE") != "" && os.Getenv("AZURE_TENANT_ID") != "":
+		// workload identity: the service account token of the pod is exchanged for a token of the identity
+		assertion, err := ioutil.ReadFile(os.Getenv("AZURE_FEDERATED_TOKEN_FILE"))
+		if err != nil {
+			return nil, fmt.Errorf("ioutil.ReadFile.%s", err)
+		}
+		authority := os.Getenv("AZURE_AUTHORITY_HOST")
+		if authority == "" {
+			authority = azureAuthorityHost
+		}
+		form := url.Values{
+			"grant_type":            {"client_credentials"},
+			"client_id":             {clientID},
+			"scope":                 {strings.TrimSuffix(s.resource, "/") + "/.default"},
+			"client_assertion_type": {"urn:ietf:params:oauth:client-assertion-type:jwt-bearer"},
+			"client_assertion":      {strings.TrimSpace(string(assertion))},
+		}
+		endpoint := fmt.Sprintf("%s/%s/oauth2/v2.0/token", strings.TrimSuffix(authority, "/"), os.Getenv("AZURE_TENANT_ID"))
+		req, err = http.NewRequest(http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+		if err != nil {
+			return nil, fmt.Errorf("http.NewRequest.%s", err)
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	case os.Getenv("IDENTITY_ENDPOINT") != "" && os.Getenv("IDENTITY_HEADER") != "":
+		query := url.Values{"api-version": {azureAppServiceVer}, "resource": {s.resource}}
+		if clientID != "" {
+			query.Set("client_id", clientID)
+		}
+		req, err = http.NewRequest(http.MethodGet, fmt.Sprintf("%s?%s", os.Getenv("IDENTITY_ENDPOINT"), query.Encode()), nil)
+		if err != nil {
+			return nil, fmt.Errorf("http.NewRequest.%s", err)
+		}
+		req.Header.Set("X-IDENTITY-HEADER", os.Getenv("IDENTITY_HEADER"))
+	default:
+		query := url.Values{"api-version": {azureIMDSVersion}, "resource": {s.resource}}
+		if clientID != "" {
+			query.Set("client_id", clientID)
+		}
+		req, err = http.NewRequest(http.MethodGet, fmt.Sprintf("%s?%s", azureIMDSEndpoint, query.Encode()), nil)
+		if err != nil {
+			return nil, fmt.Errorf("http.NewRequest.%s", err)
+		}
+		req.Header.Set("Metadata", "true")
+	}
+	res, err := s.httpcli.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("httpClient.Do.%s", err)
+	}
+	defer res.Body.Close()
+	resBody, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, fmt.Errorf("ioutil.ReadAll.%s", err)
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("azure identity: %s : %s", res.Status, resBody)
+	}
+	var token azureToken
+	err = json.Unmarshal(resBody, &token)
+	if err != nil {
+		return nil, fmt.Errorf("json.Unmarshal.%s", err)
+	}
+	return &token, nil
+}
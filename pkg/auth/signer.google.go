@@ -0,0 +1,185 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	googleTokenURL    = "https://oauth2.googleapis.com/token"
+	googleMetadataURL = "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/token"
+)
+
+var (
+	// ErrInvalidPrivateKey - service account private key is not a PEM encoded RSA key
+	ErrInvalidPrivateKey = errors.New("ErrInvalidPrivateKey - service account private key must be a PEM encoded RSA key")
+)
+
+// GoogleConfig provide credentials for Google Cloud APIs.
+// If CredentialsFile is empty, tokens are requested to the GCE metadata server.
+type GoogleConfig struct {
+	CredentialsFile string `yaml:"credentials_file"`
+}
+
+type googleServiceAccount struct {
+	ClientEmail string `json:"client_email"`
+	PrivateKey  string `json:"private_key"`
+	TokenURI    string `json:"token_uri"`
+}
+
+type googleToken struct {
+	AccessToken string `json:"access_token"`
+	ExpiresIn   int    `json:"expires_in"`
+}
+
+type googleSigner struct {
+	sync.Mutex
+	scopes    []string
+	account   *googleServiceAccount
+	key       *rsa.PrivateKey
+	token     string
+	expiresAt time.Time
+	httpcli   http.Client
+}
+
+// NewGoogleSigner provides OAuth2 bearer tokens for the given scopes
+func NewGoogleSigner(cfg GoogleConfig, scopes ...string) (Signer, error) {
+	signer := &googleSigner{
+		scopes: scopes,
+		httpcli: http.Client{
+			Timeout: 30 * time.Second,
+		},
+	}
+	if cfg.CredentialsFile == "" {
+		return signer, nil
+	}
+	accountBytes, err := ioutil.ReadFile(cfg.CredentialsFile)
+	if err != nil {
+		return nil, fmt.Errorf("ioutil.ReadFile.%s", err)
+	}
+	var account googleServiceAccount
+	err = json.Unmarshal(accountBytes, &account)
+	if err != nil {
+		return nil, fmt.Errorf("json.Unmarshal.%s", err)
+	}
+	if account.TokenURI == "" {
+		account.TokenURI = googleTokenURL
+	}
+	block, _ := pem.Decode([]byte(account.PrivateKey))
+	if block == nil {
+		return nil, ErrInvalidPrivateKey
+	}
+	keyI, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("x509.ParsePKCS8PrivateKey.%s", err)
+	}
+	key, ok := keyI.(*rsa.PrivateKey)
+	if !ok {
+		return nil, ErrInvalidPrivateKey
+	}
+	signer.account = &account
+	signer.key = key
+	return signer, nil
+}
+
+// Sign sets a bearer token, refreshed a minute before it expires
+func (s *googleSigner) Sign(r *http.Request, body []byte) error {
+	s.Lock()
+	defer s.Unlock()
+	if s.token == "" || time.Now().After(s.expiresAt.Add(-time.Minute)) {
+		var (
+			token *googleToken
+			err   error
+		)
+		if s.account != nil {
+			token, err = s.exchangeJWT()
+		} else {
+			token, err = s.metadataToken()
+		}
+		if err != nil {
+			return err
+		}
+		s.token = token.AccessToken
+		s.expiresAt = time.Now().Add(time.Duration(token.ExpiresIn) * time.Second)
+	}
+	r.Header.Set("Authorization", fmt.Sprintf("Bearer %s", s.token))
+	return nil
+}
+
+// exchangeJWT - ref: https://developers.google.com/identity/protocols/oauth2/service-account#httprest
+func (s *googleSigner) exchangeJWT() (*googleToken, error) {
+	now := time.Now()
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"RS256","typ":"JWT"}`))
+	claims, err := json.Marshal(map[string]interface{}{
+		"iss":   s.account.ClientEmail,
+		"scope": strings.Join(s.scopes, " "),
+		"aud":   s.account.TokenURI,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("json.Marshal.%s", err)
+	}
+	unsigned := fmt.Sprintf("%s.%s", header, base64.RawURLEncoding.EncodeToString(claims))
+	hash := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, s.key, crypto.SHA256, hash[:])
+	if err != nil {
+		return nil, fmt.Errorf("rsa.SignPKCS1v15.%s", err)
+	}
+	assertion := fmt.Sprintf("%s.%s", unsigned, base64.RawURLEncoding.EncodeToString(signature))
+	res, err := s.httpcli.PostForm(s.account.TokenURI, url.Values{
+		"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+		"assertion":  {assertion},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("httpClient.PostForm.%s", err)
+	}
+	return decodeGoogleToken(res)
+}
+
+func (s *googleSigner) metadataToken() (*googleToken, error) {
+	req, err := http.NewRequest("GET", googleMetadataURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("http.NewRequest.%s", err)
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+	if len(s.scopes) > 0 {
+		req.URL.RawQuery = url.Values{"scopes": {strings.Join(s.scopes, ",")}}.Encode()
+	}
+	res, err := s.httpcli.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("httpClient.Do.%s", err)
+	}
+	return decodeGoogleToken(res)
+}
+
+func decodeGoogleToken(res *http.Response) (*googleToken, error) {
+	defer res.Body.Close()
+	resBody, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, fmt.Errorf("ioutil.ReadAll.%s", err)
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("google oauth2: %s : %s", res.Status, resBody)
+	}
+	var token googleToken
+	err = json.Unmarshal(resBody, &token)
+	if err != nil {
+		return nil, fmt.Errorf("json.Unmarshal.%s", err)
+	}
+	return &token, nil
+}
@@ -0,0 +1,24 @@
+package auth
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// tokenSigner provides token based http authentication
+type tokenSigner struct {
+	authorization string
+}
+
+// NewTokenSigner sets the Authorization header to "{scheme} {token}", ex: Bearer xxxx
+func NewTokenSigner(scheme, token string) Signer {
+	return &tokenSigner{
+		fmt.Sprintf("%s %s", scheme, token),
+	}
+}
+
+// Sign sign the request with token authentication
+func (s *tokenSigner) Sign(r *http.Request, body []byte) error {
+	r.Header.Set("Authorization", s.authorization)
+	return nil
+}
@@ -0,0 +1,56 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+)
+
+// APIKeyConfig - static key of a client
+type APIKeyConfig struct {
+	// Name identifies the client in logs
+	Name string `yaml:"name"`
+	Key  string `yaml:"key"`
+	// Collections the key may write to, any collection if omitted
+	Collections []string `yaml:"collections,flow"`
+	// Tenant the key writes as, if tenancy is enabled
+	Tenant string `yaml:"tenant"`
+	// Admin grants access to the admin API
+	Admin bool `yaml:"admin"`
+}
+
+// apiKeyVerifier compares keys digests in constant time, so timing tells nothing about keys
+type apiKeyVerifier struct {
+	keys []apiKey
+}
+
+type apiKey struct {
+	digest    [sha256.Size]byte
+	principal Principal
+}
+
+func newAPIKeyVerifier(cfgs []APIKeyConfig) *apiKeyVerifier {
+	v := &apiKeyVerifier{keys: make([]apiKey, 0, len(cfgs))}
+	for _, cfg := range cfgs {
+		v.keys = append(v.keys, apiKey{
+			digest:    sha256.Sum256([]byte(cfg.Key)),
+			principal: Principal{cfg.Name, cfg.Collections, cfg.Tenant, cfg.Admin},
+		})
+	}
+	return v
+}
+
+func (v *apiKeyVerifier) verify(key string) (*Principal, error) {
+	var (
+		digest = sha256.Sum256([]byte(key))
+		found  *Principal
+	)
+	for i := range v.keys {
+		if subtle.ConstantTimeCompare(digest[:], v.keys[i].digest[:]) == 1 && found == nil {
+			found = &v.keys[i].principal
+		}
+	}
+	if found == nil {
+		return nil, ErrUnauthenticated
+	}
+	return found, nil
+}
@@ -0,0 +1,104 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+var (
+	// ErrUnauthenticated - request has no valid credentials
+	ErrUnauthenticated = errors.New("ErrUnauthenticated - request credentials are missing or invalid")
+	// ErrForbidden - credentials do not grant access to the collection
+	ErrForbidden = errors.New("ErrForbidden - credentials do not grant access to this collection")
+	// ErrForbiddenAdmin - credentials do not grant access to the admin API
+	ErrForbiddenAdmin = errors.New("ErrForbiddenAdmin - credentials do not grant access to the admin API")
+)
+
+// Verifier authenticates incoming requests
+type Verifier interface {
+	// Verify returns the client the request headers authenticate, ErrUnauthenticated if none
+	Verify(header http.Header) (*Principal, error)
+}
+
+// Principal - authenticated client
+type Principal struct {
+	Name string
+	// Collections the client may write to, any collection if nil
+	Collections []string
+	// Tenant the client writes as, empty if its credentials carry none
+	Tenant string
+	// Admin tells whether the client may call the admin API
+	Admin bool
+}
+
+// CanWrite tells whether the client may write to the collection
+func (p *Principal) CanWrite(collectionName string) bool {
+	if p.Collections == nil {
+		return true
+	}
+	for _, name := range p.Collections {
+		if name == collectionName || name == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// VerifierConfig - credentials accepted by ingestion endpoints; requests are not authenticated if none is set
+type VerifierConfig struct {
+	APIKeys []APIKeyConfig `yaml:"api_keys,flow"`
+	JWT     *JWTConfig     `yaml:"jwt,omitempty"`
+}
+
+// Enabled tells whether requests must be authenticated
+func (c VerifierConfig) Enabled() bool {
+	return len(c.APIKeys) > 0 || c.JWT != nil
+}
+
+// NewVerifier accepts API keys and JWTs as configured, it returns nil if authentication is disabled
+func NewVerifier(cfg VerifierConfig) (Verifier, error) {
+	if !cfg.Enabled() {
+		return nil, nil
+	}
+	v := &verifier{}
+	if len(cfg.APIKeys) > 0 {
+		v.apiKeys = newAPIKeyVerifier(cfg.APIKeys)
+	}
+	if cfg.JWT != nil {
+		jwtVerifier, err := newJWTVerifier(*cfg.JWT)
+		if err != nil {
+			return nil, fmt.Errorf("newJWTVerifier.%s", err)
+		}
+		v.jwt = jwtVerifier
+	}
+	return v, nil
+}
+
+// verifier reads the X-API-Key header or the bearer token of the Authorization header.
+// Bearer tokens are verified as JWTs if they look like one and JWTs are accepted, as API keys otherwise.
+type verifier struct {
+	apiKeys *apiKeyVerifier
+	jwt     *jwtVerifier
+}
+
+func (v *verifier) Verify(header http.Header) (*Principal, error) {
+	if key := header.Get("X-API-Key"); key != "" {
+		if v.apiKeys == nil {
+			return nil, ErrUnauthenticated
+		}
+		return v.apiKeys.verify(key)
+	}
+	scheme, token, ok := strings.Cut(header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") || token == "" {
+		return nil, ErrUnauthenticated
+	}
+	if v.jwt != nil && strings.Count(token, ".") == 2 {
+		return v.jwt.verify(token)
+	}
+	if v.apiKeys == nil {
+		return nil, ErrUnauthenticated
+	}
+	return v.apiKeys.verify(token)
+}
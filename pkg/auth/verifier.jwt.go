@@ -0,0 +1,402 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultCollectionsClaim = "collections"
+	defaultTenantClaim      = "tenant"
+	defaultAdminClaim       = "admin"
+	// clockSkew tolerated on exp and nbf claims
+	clockSkew = time.Minute
+	// jwksMaxAge after which keys are fetched again
+	jwksMaxAge = time.Hour
+	// jwksMinAge before which an unknown key id does not trigger a fetch
+	jwksMinAge = time.Minute
+)
+
+var (
+	// ErrNoJWTKey - JWTs cannot be verified
+	ErrNoJWTKey = errors.New("ErrNoJWTKey - jwt requires one of secret|public_key_file|jwks_url")
+	// ErrInvalidPublicKey - public key file is not a PEM encoded RSA or ECDSA key
+	ErrInvalidPublicKey = errors.New("ErrInvalidPublicKey - public key must be a PEM encoded RSA or ECDSA key")
+)
+
+// JWTConfig - bearer tokens signed by an issuer.
+// Tokens must carry an exp claim and list the collections they may write to in the collections claim, "*" for any.
+type JWTConfig struct {
+	// Issuer and Audience the iss and aud claims must match, if set
+	Issuer   string `yaml:"issuer"`
+	Audience string `yaml:"audience"`
+	// Secret verifies HS256, HS384 and HS512 signatures
+	Secret string `yaml:"secret"`
+	// PublicKeyFile verifies RS*, PS* or ES* signatures, depending on its key type
+	PublicKeyFile string `yaml:"public_key_file"`
+	// JWKSURL serves the keys of the issuer, verifying RS*, PS* and ES* signatures
+	JWKSURL string `yaml:"jwks_url"`
+	// CollectionsClaim defaults to collections, it holds a list or a space separated string
+	CollectionsClaim string `yaml:"collections_claim"`
+	// TenantClaim defaults to tenant, it holds the tenant tokens write as if tenancy is enabled
+	TenantClaim string `yaml:"tenant_claim"`
+	// AdminClaim defaults to admin, tokens holding true in it may call the admin API
+	AdminClaim string `yaml:"admin_claim"`
+}
+
+type jwtVerifier struct {
+	issuer           string
+	audience         string
+	secret           []byte
+	publicKey        crypto.PublicKey
+	jwks             *jwks
+	collectionsClaim string
+	tenantClaim      string
+	adminClaim       string
+}
+
+func newJWTVerifier(cfg JWTConfig) (*jwtVerifier, error) {
+	v := &jwtVerifier{
+		issuer:           cfg.Issuer,
+		audience:         cfg.Audience,
+		collectionsClaim: cfg.CollectionsClaim,
+		tenantClaim:      cfg.TenantClaim,
+		adminClaim:       cfg.AdminClaim,
+	}
+	if v.collectionsClaim == "" {
+		v.collectionsClaim = defaultCollectionsClaim
+	}
+	if v.tenantClaim == "" {
+		v.tenantClaim = defaultTenantClaim
+	}
+	if v.adminClaim == "" {
+		v.adminClaim = defaultAdminClaim
+	}
+	switch {
+	case cfg.Secret != "":
+		v.secret = []byte(cfg.Secret)
+	case cfg.PublicKeyFile != "":
+		keyBytes, err := ioutil.ReadFile(cfg.PublicKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("ioutil.ReadFile.%s", err)
+		}
+		block, _ := pem.Decode(keyBytes)
+		if block == nil {
+			return nil, ErrInvalidPublicKey
+		}
+		v.publicKey, err = x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("x509.ParsePKIXPublicKey.%s", err)
+		}
+		switch v.publicKey.(type) {
+		case *rsa.PublicKey, *ecdsa.PublicKey:
+		default:
+			return nil, ErrInvalidPublicKey
+		}
+	case cfg.JWKSURL != "":
+		v.jwks = &jwks{
+			url:     cfg.JWKSURL,
+			httpcli: http.Client{Timeout: 10 * time.Second},
+		}
+	default:
+		return nil, ErrNoJWTKey
+	}
+	return v, nil
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// verify checks the signature then the claims of a JWT, ref: https://www.rfc-editor.org/rfc/rfc7519
+func (v *jwtVerifier) verify(token string) (*Principal, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrUnauthenticated
+	}
+	var header jwtHeader
+	if decodeJWTPart(parts[0], &header) != nil {
+		return nil, ErrUnauthenticated
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrUnauthenticated
+	}
+	key, err := v.key(header)
+	if err != nil {
+		return nil, err
+	}
+	if !verifySignature(header.Alg, key, []byte(parts[0]+"."+parts[1]), signature) {
+		return nil, ErrUnauthenticated
+	}
+	var claims map[string]json.RawMessage
+	if decodeJWTPart(parts[1], &claims) != nil {
+		return nil, ErrUnauthenticated
+	}
+	now := time.Now()
+	var exp, nbf float64
+	if json.Unmarshal(claims["exp"], &exp) != nil || now.After(time.Unix(int64(exp), 0).Add(clockSkew)) {
+		return nil, ErrUnauthenticated
+	}
+	if _, ok := claims["nbf"]; ok && (json.Unmarshal(claims["nbf"], &nbf) != nil || now.Add(clockSkew).Before(time.Unix(int64(nbf), 0))) {
+		return nil, ErrUnauthenticated
+	}
+	if v.issuer != "" {
+		var iss string
+		if json.Unmarshal(claims["iss"], &iss) != nil || iss != v.issuer {
+			return nil, ErrUnauthenticated
+		}
+	}
+	if v.audience != "" && !contains(stringsClaim(claims["aud"]), v.audience) {
+		return nil, ErrUnauthenticated
+	}
+	principal := &Principal{Collections: stringsClaim(claims[v.collectionsClaim])}
+	if principal.Collections == nil {
+		// tokens without the claim may write to no collection
+		principal.Collections = []string{}
+	}
+	json.Unmarshal(claims["sub"], &principal.Name)
+	json.Unmarshal(claims[v.tenantClaim], &principal.Tenant)
+	json.Unmarshal(claims[v.adminClaim], &principal.Admin)
+	return principal, nil
+}
+
+// key returns the key verifying tokens with the given header, the secret for HMAC algorithms
+func (v *jwtVerifier) key(header jwtHeader) (interface{}, error) {
+	switch {
+	case strings.HasPrefix(header.Alg, "HS"):
+		if v.secret == nil {
+			return nil, ErrUnauthenticated
+		}
+		return v.secret, nil
+	case v.publicKey != nil:
+		return v.publicKey, nil
+	case v.jwks != nil:
+		return v.jwks.key(header.Kid)
+	}
+	return nil, ErrUnauthenticated
+}
+
+func verifySignature(alg string, key interface{}, signed, signature []byte) bool {
+	if len(alg) != 5 {
+		return false
+	}
+	var hash crypto.Hash
+	switch alg[2:] {
+	case "256":
+		hash = crypto.SHA256
+	case "384":
+		hash = crypto.SHA384
+	case "512":
+		hash = crypto.SHA512
+	default:
+		return false
+	}
+	h := hash.New()
+	h.Write(signed)
+	digest := h.Sum(nil)
+	switch alg[:2] {
+	case "HS":
+		secret, ok := key.([]byte)
+		if !ok {
+			return false
+		}
+		mac := hmac.New(hash.New, secret)
+		mac.Write(signed)
+		return hmac.Equal(signature, mac.Sum(nil))
+	case "RS":
+		pub, ok := key.(*rsa.PublicKey)
+		return ok && rsa.VerifyPKCS1v15(pub, hash, digest, signature) == nil
+	case "PS":
+		pub, ok := key.(*rsa.PublicKey)
+		return ok && rsa.VerifyPSS(pub, hash, digest, signature, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash}) == nil
+	case "ES":
+		pub, ok := key.(*ecdsa.PublicKey)
+		if !ok {
+			return false
+		}
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		if len(signature) != 2*size {
+			return false
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		return ecdsa.Verify(pub, digest, r, s)
+	}
+	return false
+}
+
+func decodeJWTPart(part string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+// stringsClaim reads a claim holding a list of strings or a space separated string, nil if absent
+func stringsClaim(raw json.RawMessage) []string {
+	if raw == nil {
+		return nil
+	}
+	var list []string
+	if json.Unmarshal(raw, &list) == nil {
+		return list
+	}
+	var str string
+	if json.Unmarshal(raw, &str) == nil {
+		return strings.Fields(str)
+	}
+	return nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// jwks caches the keys of a JSON Web Key Set, ref: https://www.rfc-editor.org/rfc/rfc7517
+type jwks struct {
+	sync.Mutex
+	url       string
+	keys      map[string]crypto.PublicKey
+	fetchedAt time.Time
+	httpcli   http.Client
+}
+
+type jsonWebKey struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// key returns the key of the given id, keys are fetched again once stale or if the id is unknown
+func (j *jwks) key(kid string) (crypto.PublicKey, error) {
+	j.Lock()
+	defer j.Unlock()
+	age := time.Since(j.fetchedAt)
+	key, ok := j.lookup(kid)
+	if (!ok && age > jwksMinAge) || age > jwksMaxAge {
+		err := j.fetch()
+		if err != nil && !ok {
+			return nil, fmt.Errorf("fetch.%s", err)
+		}
+		key, ok = j.lookup(kid)
+	}
+	if !ok {
+		return nil, ErrUnauthenticated
+	}
+	return key, nil
+}
+
+// lookup finds a key by id, tokens without id are verified with the only key of the set
+func (j *jwks) lookup(kid string) (crypto.PublicKey, bool) {
+	if kid == "" && len(j.keys) == 1 {
+		for _, key := range j.keys {
+			return key, true
+		}
+	}
+	key, ok := j.keys[kid]
+	return key, ok
+}
+
+func (j *jwks) fetch() error {
+	// failed fetches are not retried before jwksMinAge either
+	j.fetchedAt = time.Now()
+	res, err := j.httpcli.Get(j.url)
+	if err != nil {
+		return fmt.Errorf("httpClient.Get.%s", err)
+	}
+	defer res.Body.Close()
+	resBody, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return fmt.Errorf("ioutil.ReadAll.%s", err)
+	}
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("jwks: %s : %s", res.Status, resBody)
+	}
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	err = json.Unmarshal(resBody, &set)
+	if err != nil {
+		return fmt.Errorf("json.Unmarshal.%s", err)
+	}
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.publicKey()
+		if err != nil {
+			// keys of unsupported types are ignored
+			continue
+		}
+		keys[jwk.Kid] = key
+	}
+	j.keys = keys
+	return nil
+}
+
+func (jwk *jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch jwk.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+		if err != nil {
+			return nil, fmt.Errorf("(n).%s", err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+		if err != nil {
+			return nil, fmt.Errorf("(e).%s", err)
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch jwk.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %s", jwk.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+		if err != nil {
+			return nil, fmt.Errorf("(x).%s", err)
+		}
+		y, err := base64.RawURLEncoding.DecodeString(jwk.Y)
+		if err != nil {
+			return nil, fmt.Errorf("(y).%s", err)
+		}
+		point := append([]byte{4}, x...)
+		return ecdsa.ParseUncompressedPublicKey(curve, append(point, y...))
+	}
+	return nil, fmt.Errorf("unsupported key type %s", jwk.Kty)
+}
@@ -0,0 +1,224 @@
+// Package client ships documents to bulklog over HTTP, one at a time or in batches, synchronously or in the background.
+//
+//	c := client.New("http://localhost:5017", client.WithAsync(0, nil), client.WithCompression())
+//	defer c.Close(context.Background())
+//	err := c.Append(ctx, "logs", "log", []byte(`{"message": "hello"}`))
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Client appends documents to collections of a bulklog server, it is safe for concurrent use
+type Client struct {
+	sync.Mutex
+	url     string
+	opts    options
+	batches map[batchKey]*batch
+	closed  bool
+	// ctx bounds the tries of batches, it is cancelled when Close gives up waiting for them
+	ctx    context.Context
+	cancel context.CancelFunc
+	// senders bounds the batches sent at once, queue the documents of async mode not sent yet
+	senders chan struct{}
+	queue   chan struct{}
+	sending sync.WaitGroup
+}
+
+// batchKey - documents of a bulk request
+type batchKey struct {
+	collection string
+	schema     string
+}
+
+type batch struct {
+	key       batchKey
+	documents []*document
+	bytes     int
+	timer     *time.Timer
+}
+
+// document - appended document, result is nil in async mode
+type document struct {
+	body   []byte
+	result chan error
+}
+
+// New returns a client of the bulklog server at url, such as http://localhost:5017.
+// Documents are sent one request at a time unless batching or async mode is enabled.
+func New(url string, options ...Option) *Client {
+	opts := defaultOptions()
+	for _, option := range options {
+		option(&opts)
+	}
+	if opts.concurrency <= 0 {
+		opts.concurrency = defaultConcurrency
+	}
+	if opts.maxTries <= 0 {
+		opts.maxTries = 1
+	}
+	if opts.batchBytes <= 0 {
+		opts.batchBytes = defaultBatchBytes
+	}
+	if opts.flushInterval <= 0 {
+		opts.flushInterval = defaultFlushInterval
+	}
+	// a batch never waits for documents its queue cannot hold
+	if opts.async && opts.batchDocuments > opts.queueSize {
+		opts.batchDocuments = opts.queueSize
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &Client{
+		url:     strings.TrimRight(url, "/"),
+		opts:    opts,
+		batches: make(map[batchKey]*batch),
+		ctx:     ctx,
+		cancel:  cancel,
+		senders: make(chan struct{}, opts.concurrency),
+	}
+	if opts.async {
+		c.queue = make(chan struct{}, opts.queueSize)
+	}
+	return c
+}
+
+func (c *Client) batching() bool {
+	return c.opts.batchDocuments > 0
+}
+
+// Append appends the JSON document body to a collection with the given schema.
+// Without async mode, it returns once bulklog accepted or rejected the document, rejections are *Error.
+// In async mode, it returns once the document is queued: errors come to the onError callback.
+func (c *Client) Append(ctx context.Context, collection, schema string, body []byte) error {
+	var compacted bytes.Buffer
+	err := json.Compact(&compacted, body)
+	if err != nil {
+		return ErrInvalidJSON
+	}
+	doc := &document{body: compacted.Bytes()}
+	key := batchKey{collection, schema}
+	if !c.opts.async {
+		doc.result = make(chan error, 1)
+	}
+	if !c.batching() {
+		if c.isClosed() {
+			return ErrClosed
+		}
+		return c.send(ctx, key, []*document{doc})[0]
+	}
+	if c.opts.async {
+		select {
+		case c.queue <- struct{}{}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	err = c.add(key, doc)
+	if err != nil {
+		if c.opts.async {
+			<-c.queue
+		}
+		return err
+	}
+	if c.opts.async {
+		return nil
+	}
+	select {
+	case err = <-doc.result:
+		return err
+	case <-ctx.Done():
+		// the document is still sent with its batch
+		return ctx.Err()
+	}
+}
+
+func (c *Client) isClosed() bool {
+	c.Lock()
+	defer c.Unlock()
+	return c.closed
+}
+
+// add appends doc to the batch of key, the batch is sent once full
+func (c *Client) add(key batchKey, doc *document) error {
+	c.Lock()
+	defer c.Unlock()
+	if c.closed {
+		return ErrClosed
+	}
+	b := c.batches[key]
+	if b != nil && b.bytes+len(doc.body)+1 > c.opts.batchBytes {
+		c.detach(b)
+		b = nil
+	}
+	if b == nil {
+		b = &batch{key: key}
+		b.timer = time.AfterFunc(c.opts.flushInterval, func() {
+			c.Lock()
+			defer c.Unlock()
+			if c.batches[key] == b {
+				c.detach(b)
+			}
+		})
+		c.batches[key] = b
+	}
+	b.documents = append(b.documents, doc)
+	b.bytes += len(doc.body) + 1
+	if len(b.documents) >= c.opts.batchDocuments || b.bytes >= c.opts.batchBytes {
+		c.detach(b)
+	}
+	return nil
+}
+
+// detach removes b from the pending batches and sends it in the background, the client must be locked
+func (c *Client) detach(b *batch) {
+	b.timer.Stop()
+	delete(c.batches, b.key)
+	c.sending.Add(1)
+	go func() {
+		defer c.sending.Done()
+		c.senders <- struct{}{}
+		defer func() { <-c.senders }()
+		c.send(c.ctx, b.key, b.documents)
+	}()
+}
+
+// Flush sends the pending batches and waits until every batch is sent, or ctx is done
+func (c *Client) Flush(ctx context.Context) error {
+	c.Lock()
+	for _, b := range c.batches {
+		c.detach(b)
+	}
+	c.Unlock()
+	sent := make(chan struct{})
+	go func() {
+		c.sending.Wait()
+		close(sent)
+	}()
+	select {
+	case <-sent:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close sends the pending batches and waits for them, until ctx is done: their remaining tries are then cancelled.
+// Documents appended afterward are refused with ErrClosed.
+func (c *Client) Close(ctx context.Context) error {
+	c.Lock()
+	c.closed = true
+	c.Unlock()
+	err := c.Flush(ctx)
+	if err != nil {
+		c.cancel()
+		c.sending.Wait()
+		return err
+	}
+	c.cancel()
+	return nil
+}
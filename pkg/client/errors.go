@@ -0,0 +1,28 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrClosed - documents are appended to a closed client
+	ErrClosed = errors.New("ErrClosed - client is closed")
+	// ErrInvalidJSON - document body is not JSON
+	ErrInvalidJSON = errors.New("ErrInvalidJSON - document body must be valid JSON")
+)
+
+// Error - request or document rejected by bulklog, with the status it was answered with
+type Error struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("bulklog %d: %s", e.StatusCode, e.Message)
+}
+
+// retryable tells whether a try may succeed later: the server is overloaded, unavailable or failed
+func (e *Error) retryable() bool {
+	return e.StatusCode == 429 || (e.StatusCode >= 500 && e.StatusCode != 501)
+}
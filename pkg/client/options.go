@@ -0,0 +1,136 @@
+package client
+
+import (
+	"net/http"
+	"time"
+)
+
+const (
+	defaultMaxTries       = 5
+	defaultBaseInterval   = 100 * time.Millisecond
+	defaultMaxInterval    = 10 * time.Second
+	defaultBatchDocuments = 500
+	defaultBatchBytes     = 1 << 20
+	defaultFlushInterval  = time.Second
+	defaultQueueSize      = 10000
+	defaultConcurrency    = 2
+	defaultTenantHeader   = "X-Tenant-ID"
+)
+
+// Option customizes a client
+type Option func(*options)
+
+type options struct {
+	httpClient   *http.Client
+	apiKey       string
+	tenant       string
+	tenantHeader string
+	compress     bool
+	// retries of a request
+	maxTries     int
+	baseInterval time.Duration
+	maxInterval  time.Duration
+	// batches, disabled unless batchDocuments is set
+	batchDocuments int
+	batchBytes     int
+	flushInterval  time.Duration
+	concurrency    int
+	// async mode
+	async     bool
+	queueSize int
+	onError   func(error)
+}
+
+func defaultOptions() options {
+	return options{
+		httpClient:   &http.Client{Timeout: 30 * time.Second},
+		tenantHeader: defaultTenantHeader,
+		maxTries:     defaultMaxTries,
+		baseInterval: defaultBaseInterval,
+		maxInterval:  defaultMaxInterval,
+		concurrency:  defaultConcurrency,
+		queueSize:    defaultQueueSize,
+		onError:      func(error) {},
+	}
+}
+
+// WithHTTPClient sends requests with httpClient, which defaults to a client timing out after 30 seconds
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(o *options) {
+		o.httpClient = httpClient
+	}
+}
+
+// WithAPIKey authenticates requests with an X-API-Key header
+func WithAPIKey(key string) Option {
+	return func(o *options) {
+		o.apiKey = key
+	}
+}
+
+// WithTenant names the tenant of documents in the X-Tenant-ID header, if the credentials carry none
+func WithTenant(tenantID string) Option {
+	return func(o *options) {
+		o.tenant = tenantID
+	}
+}
+
+// WithTenantHeader renames the header of WithTenant, as set by the tenancy header of bulklog
+func WithTenantHeader(header string) Option {
+	return func(o *options) {
+		o.tenantHeader = header
+	}
+}
+
+// WithCompression gzip compresses request bodies
+func WithCompression() Option {
+	return func(o *options) {
+		o.compress = true
+	}
+}
+
+// WithRetry tries requests up to maxTries times, waiting an exponential interval from base up to max between tries,
+// or as long as the server asks with Retry-After.
+// Network errors, 429 and 5xx responses are retried, other ones are not. 5 tries from 100 milliseconds up to 10 seconds by default.
+func WithRetry(maxTries int, base, max time.Duration) Option {
+	return func(o *options) {
+		o.maxTries, o.baseInterval, o.maxInterval = maxTries, base, max
+	}
+}
+
+// WithBatching groups documents of a collection and schema into bulk requests, sent once they count maxDocuments,
+// weigh maxBytes, or every flushInterval. Unset values default to 500 documents, 1 MiB and 1 second.
+func WithBatching(maxDocuments, maxBytes int, flushInterval time.Duration) Option {
+	return func(o *options) {
+		o.batchDocuments, o.batchBytes, o.flushInterval = maxDocuments, maxBytes, flushInterval
+		if o.batchDocuments <= 0 {
+			o.batchDocuments = defaultBatchDocuments
+		}
+	}
+}
+
+// WithConcurrency bounds the batches sent at once, 2 by default
+func WithConcurrency(n int) Option {
+	return func(o *options) {
+		o.concurrency = n
+	}
+}
+
+// WithAsync returns from Append as soon as documents are queued, they are sent in batches in the background.
+// queueSize bounds the documents waiting to be sent, 10000 by default; Append blocks while the queue is full.
+// onError is given the errors of documents which could not be sent, after retries.
+// Batching is enabled with its defaults, unless set.
+func WithAsync(queueSize int, onError func(error)) Option {
+	return func(o *options) {
+		o.async = true
+		if queueSize > 0 {
+			o.queueSize = queueSize
+		}
+		if onError != nil {
+			o.onError = onError
+		}
+		if o.batchDocuments <= 0 {
+			o.batchDocuments = defaultBatchDocuments
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package client
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// bulkResponse - statuses of the documents of a bulk request
+type bulkResponse struct {
+	Items []struct {
+		Status int    `json:"status"`
+		Error  string `json:"error"`
+	} `json:"items"`
+}
+
+// send posts documents to the _bulk endpoint of their collection and schema, it retries the request as a whole
+// when it fails and retries the documents rejected for a transient reason.
+// It returns and reports the error of each document, nil for the accepted ones.
+func (c *Client) send(ctx context.Context, key batchKey, documents []*document) []error {
+	var (
+		errs    = make([]error, len(documents))
+		pending = make([]int, len(documents))
+		path    = fmt.Sprintf("%s/v1/%s/%s/_bulk", c.url, url.PathEscape(key.collection), url.PathEscape(key.schema))
+	)
+	for i := range pending {
+		pending[i] = i
+	}
+	for try := 1; len(pending) > 0; try++ {
+		retryAfter, err := c.post(ctx, path, documents, pending, errs)
+		retry := make([]int, 0, len(pending))
+		for _, i := range pending {
+			if err != nil {
+				errs[i] = err
+			}
+			if apiErr, ok := errs[i].(*Error); (ok && apiErr.retryable()) || (!ok && errs[i] != nil && ctx.Err() == nil) {
+				retry = append(retry, i)
+			}
+		}
+		pending = retry
+		if len(pending) == 0 || try >= c.opts.maxTries {
+			break
+		}
+		if !c.wait(ctx, try, retryAfter) {
+			break
+		}
+	}
+	for i, doc := range documents {
+		c.resolve(key, doc, errs[i])
+	}
+	return errs
+}
+
+// post sends the pending documents in one request and sets their errors.
+// It returns the error of the request as a whole, and how long the server asked to wait before the next try.
+func (c *Client) post(ctx context.Context, path string, documents []*document, pending []int, errs []error) (time.Duration, error) {
+	var (
+		body   bytes.Buffer
+		writer io.Writer = &body
+		gz     *gzip.Writer
+	)
+	if c.opts.compress {
+		gz = gzip.NewWriter(&body)
+		writer = gz
+	}
+	for _, i := range pending {
+		writer.Write(documents[i].body)
+		writer.Write([]byte("\n"))
+	}
+	if gz != nil {
+		gz.Close()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, path, &body)
+	if err != nil {
+		return 0, fmt.Errorf("http.NewRequest.%s", err)
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	if c.opts.compress {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	if c.opts.apiKey != "" {
+		req.Header.Set("X-API-Key", c.opts.apiKey)
+	}
+	if c.opts.tenant != "" {
+		req.Header.Set(c.opts.tenantHeader, c.opts.tenant)
+	}
+	res, err := c.opts.httpClient.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("(POST %s).%s", path, err)
+	}
+	defer res.Body.Close()
+	resBody, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return 0, fmt.Errorf("(POST %s).ReadAll.%s", path, err)
+	}
+	retryAfter := parseRetryAfter(res.Header.Get("Retry-After"))
+	if res.StatusCode != http.StatusOK {
+		return retryAfter, &Error{StatusCode: res.StatusCode, Message: strings.TrimSpace(string(resBody))}
+	}
+	var bulkRes bulkResponse
+	err = json.Unmarshal(resBody, &bulkRes)
+	if err != nil {
+		return 0, fmt.Errorf("(POST %s).json.Unmarshal.%s", path, err)
+	}
+	if len(bulkRes.Items) != len(pending) {
+		return 0, fmt.Errorf("(POST %s): %d items for %d documents", path, len(bulkRes.Items), len(pending))
+	}
+	for j, i := range pending {
+		item := bulkRes.Items[j]
+		if item.Status >= 300 {
+			errs[i] = &Error{StatusCode: item.Status, Message: item.Error}
+		} else {
+			errs[i] = nil
+		}
+	}
+	return retryAfter, nil
+}
+
+// wait sleeps before the next try: as long as the server asked, or an exponential interval with jitter.
+// It returns false if ctx is done meanwhile.
+func (c *Client) wait(ctx context.Context, try int, retryAfter time.Duration) bool {
+	interval := retryAfter
+	if interval <= 0 {
+		interval = c.opts.baseInterval << uint(try-1)
+		if interval <= 0 || interval > c.opts.maxInterval {
+			interval = c.opts.maxInterval
+		}
+		interval = interval/2 + time.Duration(rand.Int63n(int64(interval/2)+1))
+	}
+	timer := time.NewTimer(interval)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// parseRetryAfter reads a Retry-After header given in seconds or as an HTTP date
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	seconds, err := strconv.Atoi(value)
+	if err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+	at, err := http.ParseTime(value)
+	if err == nil {
+		return time.Until(at)
+	}
+	return 0
+}
+
+// resolve hands the result of a document to its Append, or to onError in async mode
+func (c *Client) resolve(key batchKey, doc *document, err error) {
+	if doc.result != nil {
+		doc.result <- err
+		return
+	}
+	if c.queue != nil {
+		<-c.queue
+	}
+	if err != nil {
+		c.opts.onError(fmt.Errorf("%s/%s: %w", key.collection, key.schema, err))
+	}
+}
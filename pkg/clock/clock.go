@@ -0,0 +1,66 @@
+// Package clock abstracts the time source of decisions which instances sharing a buffer have to agree on, such as flushes
+package clock
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Clock - source of the current time, in UTC
+type Clock interface {
+	Now() time.Time
+}
+
+// Local - clock of the host
+var Local Clock = local{}
+
+type local struct{}
+
+func (local) Now() time.Time {
+	return time.Now().UTC()
+}
+
+// Func adapts a function to a clock, e.g. a fixed or moving time in tests
+type Func func() time.Time
+
+// Now - time returned by f
+func (f Func) Now() time.Time {
+	return f().UTC()
+}
+
+// Remote - clock of a server whose time is read on each call.
+// The offset between the server and the host is kept from the latest read, so that the clock keeps going while the server is unreachable.
+type Remote struct {
+	read   func() (time.Time, error)
+	offset atomic.Int64
+}
+
+// NewRemote - read returns the time of the server
+func NewRemote(read func() (time.Time, error)) *Remote {
+	return &Remote{read: read}
+}
+
+// Now - time of the server, or the host time shifted by the latest offset if it cannot be read
+func (r *Remote) Now() time.Time {
+	now, _ := r.Sync()
+	return now
+}
+
+// Sync reads the time of the server and records its offset, it returns the shifted host time along with the error if it cannot be read
+func (r *Remote) Sync() (time.Time, error) {
+	sentAt := time.Now()
+	remote, err := r.read()
+	if err != nil {
+		return sentAt.Add(time.Duration(r.offset.Load())).UTC(), err
+	}
+	// the server read its time half way through the round trip, on average
+	receivedAt := time.Now()
+	local := sentAt.Add(receivedAt.Sub(sentAt) / 2)
+	r.offset.Store(int64(remote.Sub(local)))
+	return remote.UTC(), nil
+}
+
+// Offset - how far the server clock was ahead of the host clock as of the latest read, negative if it was behind
+func (r *Remote) Offset() time.Duration {
+	return time.Duration(r.offset.Load())
+}
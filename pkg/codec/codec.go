@@ -0,0 +1,70 @@
+// Package codec encodes the documents buffered by persistent engines, and converts the bodies delivered by message outputs.
+package codec
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"fmt"
+
+	"github.com/khezen/bulklog/pkg/collection"
+)
+
+// markers starting each encoded document but gob ones: gob streams encoding a document never start with them.
+// Engines mark compressed entries with 0x00 and encrypted ones with 0x02, which formats must not use.
+const (
+	protobufMarker = 0x01
+	msgpackMarker  = 0x03
+	jsonMarker     = '{'
+)
+
+// ErrCorruptedDocument - a buffered document does not match the checksum it was encoded with
+var ErrCorruptedDocument = errors.New("ErrCorruptedDocument - buffered document does not match its checksum, it was corrupted once encoded")
+
+// Marshal encodes a document in the storage format
+func Marshal(format collection.StorageFormat, doc *collection.Document) ([]byte, error) {
+	switch format {
+	case collection.ProtobufStorage, "":
+		return marshalProtobuf(doc), nil
+	case collection.MsgpackStorage:
+		return marshalMsgpack(doc), nil
+	case collection.JSONStorage:
+		b, err := marshalJSON(doc)
+		if err != nil {
+			return nil, fmt.Errorf("marshalJSON.%s", err)
+		}
+		return b, nil
+	case collection.GobStorage:
+		var buf bytes.Buffer
+		err := gob.NewEncoder(&buf).Encode(doc)
+		if err != nil {
+			return nil, fmt.Errorf("gob.Encode.%s", err)
+		}
+		return buf.Bytes(), nil
+	}
+	return nil, collection.ErrUnsupportedStorageFormat
+}
+
+// Unmarshal decodes documents whatever the storage format they were encoded in, since a collection may change formats while documents are still buffered.
+// Documents whose checksum does not match their fields are returned along with ErrCorruptedDocument.
+func Unmarshal(b []byte) (doc collection.Document, err error) {
+	if !Marked(b) {
+		err = gob.NewDecoder(bytes.NewReader(b)).Decode(&doc)
+		if err != nil {
+			return doc, fmt.Errorf("gob.Decode.%s", err)
+		}
+		return doc, nil
+	}
+	switch b[0] {
+	case protobufMarker:
+		return unmarshalProtobuf(b)
+	case msgpackMarker:
+		return unmarshalMsgpack(b)
+	}
+	return unmarshalJSON(b)
+}
+
+// Marked tells whether b starts with the marker of a format, gob streams do not
+func Marked(b []byte) bool {
+	return len(b) > 0 && (b[0] == protobufMarker || b[0] == msgpackMarker || b[0] == jsonMarker)
+}
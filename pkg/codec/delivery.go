@@ -0,0 +1,86 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/khezen/bulklog/pkg/collection"
+	"github.com/khezen/bulklog/pkg/msgpack"
+)
+
+// Deliver converts a JSON body to the delivery format
+func Deliver(format collection.DeliveryFormat, body []byte) ([]byte, error) {
+	switch format {
+	case collection.JSONDelivery, "":
+		return body, nil
+	case collection.MsgpackDelivery:
+		decoder := json.NewDecoder(bytes.NewReader(body))
+		decoder.UseNumber()
+		var value interface{}
+		err := decoder.Decode(&value)
+		if err != nil {
+			return nil, fmt.Errorf("json.Decode.%s", err)
+		}
+		var e msgpack.Encoder
+		encodeMsgpack(&e, value)
+		return e.Bytes(), nil
+	}
+	return nil, collection.ErrUnsupportedDeliveryFormat
+}
+
+// encodeMsgpack encodes a decoded JSON value, integers as msgpack ints, other numbers as floats, map keys sorted
+func encodeMsgpack(e *msgpack.Encoder, value interface{}) {
+	switch value := value.(type) {
+	case nil:
+		e.Nil()
+	case bool:
+		e.Bool(value)
+	case string:
+		e.String(value)
+	case json.Number:
+		if i, err := value.Int64(); err == nil {
+			e.Int(i)
+			return
+		}
+		f, _ := value.Float64()
+		e.Float(f)
+	case []interface{}:
+		e.ArrayHeader(len(value))
+		for _, item := range value {
+			encodeMsgpack(e, item)
+		}
+	case map[string]interface{}:
+		keys := make([]string, 0, len(value))
+		for key := range value {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		e.MapHeader(len(keys))
+		for _, key := range keys {
+			e.String(key)
+			encodeMsgpack(e, value[key])
+		}
+	}
+}
+
+// Deliveries - delivery formats of collections, as outputs learn them on Ensure
+type Deliveries struct {
+	formats sync.Map
+}
+
+// Ensure records the delivery format of collec
+func (d *Deliveries) Ensure(collec *collection.Collection) {
+	d.formats.Store(collec.Name, collec.Serialization.Delivery)
+}
+
+// Deliver converts the body of doc to the delivery format of its collection, json if it is unknown
+func (d *Deliveries) Deliver(doc collection.Document) ([]byte, error) {
+	format, ok := d.formats.Load(doc.CollectionName)
+	if !ok {
+		return doc.Body, nil
+	}
+	return Deliver(format.(collection.DeliveryFormat), doc.Body)
+}
@@ -0,0 +1,65 @@
+package codec
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/khezen/bulklog/pkg/collection"
+)
+
+// jsonDocument - document as a JSON object, its body embedded as is unless it is not valid JSON
+type jsonDocument struct {
+	ID             uuid.UUID       `json:"id"`
+	PostedAt       time.Time       `json:"posted_at"`
+	CollectionName string          `json:"collection"`
+	SchemaName     string          `json:"schema"`
+	Body           json.RawMessage `json:"body,omitempty"`
+	// BodyBase64 - body which is not valid JSON
+	BodyBase64  []byte `json:"body_base64,omitempty"`
+	TraceParent string `json:"traceparent,omitempty"`
+}
+
+func marshalJSON(doc *collection.Document) ([]byte, error) {
+	encoded := jsonDocument{
+		ID:             doc.ID,
+		PostedAt:       doc.PostedAt.UTC(),
+		CollectionName: string(doc.CollectionName),
+		SchemaName:     string(doc.SchemaName),
+		TraceParent:    doc.TraceParent,
+	}
+	if !json.Valid(doc.Body) {
+		encoded.BodyBase64 = doc.Body
+		return json.Marshal(encoded)
+	}
+	b, err := json.Marshal(encoded)
+	if err != nil {
+		return nil, err
+	}
+	// the body is appended as is, json.Marshal would compact it
+	b = append(b[:len(b)-1], `,"body":`...)
+	b = append(b, doc.Body...)
+	return append(b, '}'), nil
+}
+
+// unmarshalJSON - JSON documents carry no checksum, a truncated one does not parse
+func unmarshalJSON(b []byte) (doc collection.Document, err error) {
+	var decoded jsonDocument
+	err = json.Unmarshal(b, &decoded)
+	if err != nil {
+		return doc, fmt.Errorf("json.Unmarshal.%s", err)
+	}
+	doc = collection.Document{
+		ID:             decoded.ID,
+		PostedAt:       decoded.PostedAt.UTC(),
+		CollectionName: collection.Name(decoded.CollectionName),
+		SchemaName:     collection.SchemaName(decoded.SchemaName),
+		Body:           []byte(decoded.Body),
+		TraceParent:    decoded.TraceParent,
+	}
+	if decoded.Body == nil {
+		doc.Body = decoded.BodyBase64
+	}
+	return doc, nil
+}
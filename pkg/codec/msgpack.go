@@ -0,0 +1,74 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/khezen/bulklog/pkg/collection"
+	"github.com/khezen/bulklog/pkg/msgpack"
+)
+
+// msgpackFields - id, posted_at, collection, schema, body, traceparent, then the checksum.
+// Fields added to collection.Document are appended before the checksum.
+const msgpackFields = 7
+
+// msgpackChecksumLen - bytes of the checksum, always encoded as uint 32
+const msgpackChecksumLen = 5
+
+// errWrongMsgpackDocument - the array does not hold the fields of a document
+var errWrongMsgpackDocument = errors.New("errWrongMsgpackDocument - msgpack document must be an array of its fields")
+
+// marshalMsgpack encodes a document as a marked array of its fields, their crc32c last
+func marshalMsgpack(doc *collection.Document) []byte {
+	var e msgpack.Encoder
+	e.ArrayHeader(msgpackFields)
+	e.Bin(doc.ID[:])
+	e.Int(doc.PostedAt.UnixNano())
+	e.String(string(doc.CollectionName))
+	e.String(string(doc.SchemaName))
+	e.Bin(doc.Body)
+	e.String(doc.TraceParent)
+	b := append([]byte{msgpackMarker}, e.Bytes()...)
+	checksum := crc32.Checksum(b[1:], castagnoli)
+	return binary.BigEndian.AppendUint32(append(b, 0xce), checksum)
+}
+
+func unmarshalMsgpack(b []byte) (doc collection.Document, err error) {
+	decoded, err := msgpack.NewDecoder(bytes.NewReader(b[1:])).Decode()
+	if err != nil {
+		return doc, fmt.Errorf("msgpack.Decode.%s", err)
+	}
+	fields, ok := decoded.([]interface{})
+	if !ok || len(fields) < msgpackFields {
+		return doc, errWrongMsgpackDocument
+	}
+	id, _ := fields[0].([]byte)
+	doc.ID, err = uuid.FromBytes(id)
+	if err != nil {
+		return doc, fmt.Errorf("uuid.FromBytes.%s", err)
+	}
+	switch postedAt := fields[1].(type) {
+	case int64:
+		doc.PostedAt = time.Unix(0, postedAt).UTC()
+	case uint64:
+		doc.PostedAt = time.Unix(0, int64(postedAt)).UTC()
+	default:
+		return doc, errWrongMsgpackDocument
+	}
+	collectionName, _ := fields[2].(string)
+	schemaName, _ := fields[3].(string)
+	doc.Body, _ = fields[4].([]byte)
+	doc.TraceParent, _ = fields[5].(string)
+	doc.CollectionName = collection.Name(collectionName)
+	doc.SchemaName = collection.SchemaName(schemaName)
+	checksum, _ := fields[len(fields)-1].(uint64)
+	if len(b) < 1+msgpackChecksumLen || crc32.Checksum(b[1:len(b)-msgpackChecksumLen], castagnoli) != uint32(checksum) {
+		return doc, ErrCorruptedDocument
+	}
+	return doc, nil
+}
@@ -0,0 +1,73 @@
+package codec
+
+import (
+	"fmt"
+	"hash/crc32"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/khezen/bulklog/pkg/collection"
+	"github.com/khezen/bulklog/pkg/proto"
+)
+
+// fields of the document message, fields added to collection.Document must be added here too
+const (
+	documentID          = 1
+	documentPostedAt    = 2 // fixed64, nanoseconds since epoch
+	documentCollection  = 3
+	documentSchema      = 4
+	documentBody        = 5
+	documentTraceParent = 6
+	// documentChecksum - fixed32, crc32c of the fields before it, always the last field
+	documentChecksum = 7
+)
+
+// documentChecksumLen - bytes of the checksum field, tag included
+const documentChecksumLen = 5
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// marshalProtobuf encodes a document as a marked protobuf message
+func marshalProtobuf(doc *collection.Document) []byte {
+	var e proto.Encoder
+	e.BytesField(documentID, doc.ID[:])
+	e.Fixed64(documentPostedAt, uint64(doc.PostedAt.UnixNano()))
+	e.String(documentCollection, string(doc.CollectionName))
+	e.String(documentSchema, string(doc.SchemaName))
+	e.BytesField(documentBody, doc.Body)
+	e.String(documentTraceParent, doc.TraceParent)
+	e.PutFixed32(documentChecksum, crc32.Checksum(e.Bytes(), castagnoli))
+	return append([]byte{protobufMarker}, e.Bytes()...)
+}
+
+func unmarshalProtobuf(b []byte) (doc collection.Document, err error) {
+	d := proto.NewDecoder(b[1:])
+	for d.Next() {
+		switch d.Field() {
+		case documentID:
+			doc.ID, err = uuid.FromBytes(d.Bytes())
+			if err != nil {
+				return doc, fmt.Errorf("uuid.FromBytes.%s", err)
+			}
+		case documentPostedAt:
+			doc.PostedAt = time.Unix(0, int64(d.Uint64())).UTC()
+		case documentCollection:
+			doc.CollectionName = collection.Name(d.String())
+		case documentSchema:
+			doc.SchemaName = collection.SchemaName(d.String())
+		case documentBody:
+			doc.Body = append([]byte(nil), d.Bytes()...)
+		case documentTraceParent:
+			doc.TraceParent = d.String()
+		case documentChecksum:
+			// documents encoded by older versions have no checksum
+			if len(b) < 1+documentChecksumLen || crc32.Checksum(b[1:len(b)-documentChecksumLen], castagnoli) != uint32(d.Uint64()) {
+				err = ErrCorruptedDocument
+			}
+		}
+	}
+	if d.Err() != nil {
+		return doc, fmt.Errorf("proto.Decode.%s", d.Err())
+	}
+	return doc, err
+}
@@ -0,0 +1,39 @@
+package collection
+
+import "context"
+
+// Ack - when documents are acknowledged to the client which posted them
+type Ack string
+
+const (
+	// AckDurable - once appended to the buffer, such as pushed to redis
+	AckDurable Ack = "durable"
+	// AckAsync - once processed and validated, documents being appended in the background
+	AckAsync Ack = "async"
+)
+
+// Validate reports unsupported ack modes, empty being the default of the collection
+func (a Ack) Validate() error {
+	switch a {
+	case "", AckDurable, AckAsync:
+		return nil
+	default:
+		return ErrUnsupportedAck
+	}
+}
+
+type ackContext struct{}
+
+// WithAck returns a copy of ctx carrying the ack mode the client asked for
+func WithAck(ctx context.Context, ack Ack) context.Context {
+	return context.WithValue(ctx, ackContext{}, ack)
+}
+
+// AckFrom returns the ack mode ctx carries, def if none
+func AckFrom(ctx context.Context, def Ack) Ack {
+	ack, ok := ctx.Value(ackContext{}).(Ack)
+	if !ok || ack == "" {
+		return def
+	}
+	return ack
+}
@@ -0,0 +1,47 @@
+package collection
+
+import (
+	"math"
+	"math/rand"
+	"time"
+)
+
+const (
+	defaultBackoffMultiplier = 2
+	defaultTryTimeout        = time.Minute
+)
+
+// Backoff spaces delivery retries of a pipe
+type Backoff struct {
+	Base        time.Duration
+	Multiplier  float64
+	MaxInterval time.Duration
+	// Jitter randomizes each interval by up to ±Jitter of its value, between 0 and 1
+	Jitter float64
+	// Timeout bounds each delivery try
+	Timeout time.Duration
+}
+
+// TryTimeout - how long a delivery try may last, one minute by default
+func (b Backoff) TryTimeout() time.Duration {
+	if b.Timeout <= 0 {
+		return defaultTryTimeout
+	}
+	return b.Timeout
+}
+
+// Interval to wait before the given retry iteration, starting at 0
+func (b Backoff) Interval(iteration int) time.Duration {
+	multiplier := b.Multiplier
+	if multiplier <= 0 {
+		multiplier = defaultBackoffMultiplier
+	}
+	interval := float64(b.Base) * math.Pow(multiplier, float64(iteration))
+	if b.MaxInterval > 0 && interval > float64(b.MaxInterval) {
+		interval = float64(b.MaxInterval)
+	}
+	if b.Jitter > 0 {
+		interval += interval * b.Jitter * (2*rand.Float64() - 1)
+	}
+	return time.Duration(interval)
+}
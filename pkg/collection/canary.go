@@ -0,0 +1,82 @@
+package collection
+
+import "hash/fnv"
+
+// CanaryConfig - share of the documents of an output conveyed to a canary output instead
+type CanaryConfig struct {
+	Output  string  `yaml:"output"`
+	Canary  string  `yaml:"canary"`
+	Percent float64 `yaml:"percent"`
+	// By - document|pipe, the unit which is split, document by default
+	By CanarySplit `yaml:"by"`
+}
+
+// CanarySplit - unit of a canary traffic split
+type CanarySplit string
+
+const (
+	// ByDocument - each document goes either to the output or to its canary
+	ByDocument CanarySplit = "document"
+	// ByPipe - the documents of a pipe go all together either to the output or to its canary
+	ByPipe CanarySplit = "pipe"
+)
+
+// Canary - documents routed to Output are routed to Canary instead if they fall within Percent
+type Canary struct {
+	Output string
+	Canary string
+	// Percent of documents or pipes, from 0 to 100
+	Percent float64
+	By      CanarySplit
+}
+
+// Canaries - extract canaries from config, in order
+func (c *Config) Canaries() ([]Canary, error) {
+	canaries := make([]Canary, 0, len(c.CanariesCfg))
+	for _, canaryCfg := range c.CanariesCfg {
+		switch canaryCfg.By {
+		case "":
+			canaryCfg.By = ByDocument
+		case ByDocument, ByPipe:
+		default:
+			return nil, ErrUnsupportedCanarySplit
+		}
+		if canaryCfg.Output == "" || canaryCfg.Canary == "" || canaryCfg.Output == canaryCfg.Canary ||
+			canaryCfg.Percent < 0 || canaryCfg.Percent > 100 {
+			return nil, ErrWrongCanary
+		}
+		canaries = append(canaries, Canary(canaryCfg))
+	}
+	return canaries, nil
+}
+
+// selects tells whether doc, of a pipe starting with first, goes to the canary.
+// Documents and pipes are selected by their ID, so that a document goes the same way on every try from any instance.
+func (c *Canary) selects(doc, first Document) bool {
+	if c.By == ByPipe {
+		doc = first
+	}
+	hash := fnv.New32a()
+	hash.Write(doc.ID[:])
+	return float64(hash.Sum32()%10000) < c.Percent*100
+}
+
+// canary returns the canary documents routed to outputName go to instead, nil if they are not split
+func (c *Collection) canary(outputName string) *Canary {
+	for i := range c.Canaries {
+		if c.Canaries[i].Output == outputName {
+			return &c.Canaries[i]
+		}
+	}
+	return nil
+}
+
+// isCanary tells whether outputName only receives the share of documents its output leaves it
+func (c *Collection) isCanary(outputName string) bool {
+	for i := range c.Canaries {
+		if c.Canaries[i].Canary == outputName {
+			return true
+		}
+	}
+	return false
+}
@@ -11,6 +11,9 @@ func New(cfg Config) (*Collection, error) {
 	if err != nil {
 		return nil, fmt.Errorf("FlushPeriod.%s", err)
 	}
+	if cfg.FlushCount < 0 || cfg.FlushBytes < 0 || cfg.MaxBodySize < 0 {
+		return nil, ErrLengthLowerThanZero
+	}
 	retentionPeriod, err := cfg.RetentionPeriod()
 	if err != nil {
 		return nil, fmt.Errorf("RetnetionPeriod.%s", err)
@@ -19,20 +22,158 @@ func New(cfg Config) (*Collection, error) {
 	if err != nil {
 		return nil, fmt.Errorf("Schemas.%s", err)
 	}
+	backoff, err := cfg.Backoff(flushPeriod)
+	if err != nil {
+		return nil, fmt.Errorf("Backoff.%s", err)
+	}
+	bufferLimits, err := cfg.BufferLimits()
+	if err != nil {
+		return nil, fmt.Errorf("BufferLimits.%s", err)
+	}
+	validation, err := cfg.Validation()
+	if err != nil {
+		return nil, fmt.Errorf("Validation.%s", err)
+	}
+	processors, err := cfg.Processors()
+	if err != nil {
+		return nil, fmt.Errorf("Processors.%s", err)
+	}
+	dedup, err := cfg.Dedup()
+	if err != nil {
+		return nil, fmt.Errorf("Dedup.%s", err)
+	}
+	priority, err := cfg.Priority()
+	if err != nil {
+		return nil, fmt.Errorf("Priority.%s", err)
+	}
+	ack, err := cfg.Ack()
+	if err != nil {
+		return nil, fmt.Errorf("Ack.%s", err)
+	}
+	routes, err := cfg.Routes()
+	if err != nil {
+		return nil, fmt.Errorf("Routes.%s", err)
+	}
+	reroutes, err := cfg.Reroutes()
+	if err != nil {
+		return nil, fmt.Errorf("Reroutes.%s", err)
+	}
+	canaries, err := cfg.Canaries()
+	if err != nil {
+		return nil, fmt.Errorf("Canaries.%s", err)
+	}
+	serialization, err := cfg.Serialization()
+	if err != nil {
+		return nil, fmt.Errorf("Serialization.%s", err)
+	}
+	metadata, err := cfg.Metadata()
+	if err != nil {
+		return nil, fmt.Errorf("Metadata.%s", err)
+	}
 	return &Collection{
 		Name:            cfg.Name,
 		FlushPeriod:     flushPeriod,
+		FlushCount:      cfg.FlushCount,
+		FlushBytes:      cfg.FlushBytes,
+		MaxBodySize:     cfg.MaxBodySize,
 		RetentionPeriod: retentionPeriod,
 		Schemas:         schemas,
+		BufferLimits:    bufferLimits,
+		Backoff:         backoff,
+		Validation:      validation,
+		Processors:      processors,
+		Dedup:           dedup,
+		Priority:        priority,
+		Ack:             ack,
+		Routes:          routes,
+		Reroutes:        reroutes,
+		Canaries:        canaries,
+		Serialization:   serialization,
+		Metadata:        metadata,
+		DocumentID:      cfg.DocumentID(),
 	}, nil
 }
 
 // Collection descrbies a document Template
 type Collection struct {
-	Name            Name
-	FlushPeriod     time.Duration
+	Name        Name
+	FlushPeriod time.Duration
+	FlushCount  int
+	FlushBytes  int64
+	// MaxBodySize bounds request bodies pushed to the collection, in bytes once decompressed; the server limit applies if 0
+	MaxBodySize     int64
 	RetentionPeriod time.Duration
 	Schemas         []Schema
+	BufferLimits    BufferLimits
+	Backoff         Backoff
+	Validation      ValidationPolicy
+	Processors      []Processor
+	Dedup           Dedup
+	Priority        Priority
+	Ack             Ack
+	Routes          []Route
+	Reroutes        []Reroute
+	Canaries        []Canary
+	Serialization   Serialization
+	// Metadata - fields set from the HTTP request documents are pushed with, nil if none
+	Metadata *Metadata
+	// DocumentID - where clients supply the ID of their documents
+	DocumentID DocumentID
+}
+
+// Dedup - documents sharing a key within window are collected once;
+// the key is a field of documents, or their content if empty
+type Dedup struct {
+	Key    string
+	Window time.Duration
+}
+
+// Enabled - whether documents are deduplicated
+func (d Dedup) Enabled() bool {
+	return d.Window > 0
+}
+
+// BufferLimits bounds the documents buffered between two flushes; zero means unbounded.
+// MaxBytes counts the bytes of document bodies, whatever the engine stores once encoded.
+type BufferLimits struct {
+	MaxDocuments int
+	MaxBytes     int64
+	Overflow     OverflowPolicy
+	BlockTimeout time.Duration
+}
+
+// Bounded - whether any limit is set
+func (l BufferLimits) Bounded() bool {
+	return l.MaxDocuments > 0 || l.MaxBytes > 0
+}
+
+// Fits - whether the given buffer usage is within limits
+func (l BufferLimits) Fits(documents int, bytes int64) bool {
+	return (l.MaxDocuments <= 0 || documents <= l.MaxDocuments) &&
+		(l.MaxBytes <= 0 || bytes <= l.MaxBytes)
+}
+
+// OverflowPolicy - what to do with documents which do not fit in the buffer
+type OverflowPolicy string
+
+const (
+	// Reject documents with ErrBufferOverflow
+	Reject OverflowPolicy = "reject"
+	// Block until documents fit or block timeout elapses
+	Block OverflowPolicy = "block"
+	// DropOldest drops the oldest buffered documents to make room
+	DropOldest OverflowPolicy = "drop_oldest"
+)
+
+// SizeTriggered - whether the buffer flushes on document count or size
+func (c *Collection) SizeTriggered() bool {
+	return c.FlushCount > 0 || c.FlushBytes > 0
+}
+
+// FlushThresholdReached - whether a buffer holding given documents and bytes must be flushed
+func (c *Collection) FlushThresholdReached(documents int, bytes int64) bool {
+	return (c.FlushCount > 0 && documents >= c.FlushCount) ||
+		(c.FlushBytes > 0 && bytes >= c.FlushBytes)
 }
 
 // Name of a collection
@@ -42,17 +183,42 @@ type Name string
 type Schema struct {
 	Name   SchemaName
 	Fields map[string]Field
+	// Validation - policy of the documents of the schema, the collection one if empty
+	Validation ValidationPolicy
+	// Outputs - outputs documents of the schema are conveyed to only, nil if they follow the collection routes
+	Outputs []string
+	// AlsoOutputs - outputs documents of the schema are conveyed to as well
+	AlsoOutputs []string
 }
 
 // SchemaName -
 type SchemaName string
 
+// Schema of given name, nil if the collection does not define it
+func (c *Collection) Schema(schemaName SchemaName) *Schema {
+	for i := range c.Schemas {
+		if c.Schemas[i].Name == schemaName {
+			return &c.Schemas[i]
+		}
+	}
+	return nil
+}
+
+// validation - policy of the documents of schema, the collection one unless schema sets its own
+func (c *Collection) validation(schema *Schema) ValidationPolicy {
+	if schema != nil && schema.Validation != "" {
+		return schema.Validation
+	}
+	return c.Validation
+}
+
 // Field -
 type Field struct {
 	Type       FieldType `yaml:"type"`
 	Length     int       `yaml:"length"`
 	MaxLength  int       `yaml:"max_length"`
 	DateFormat string    `yaml:"date_format"`
+	Required   bool      `yaml:"required"`
 }
 
 // FieldType -
@@ -11,12 +11,87 @@ import (
 type Config struct {
 	Name               Name                        `yaml:"name"`
 	FlushPeriodStr     string                      `yaml:"flush_period"`
+	FlushCount         int                         `yaml:"flush_count"`
+	FlushBytes         int64                       `yaml:"flush_bytes"`
+	MaxBodySize        int64                       `yaml:"max_body_size"`
 	RetentionPeriodStr string                      `yaml:"retention_period"`
 	SchemasCfg         map[SchemaName]SchemaConfig `yaml:"schemas"`
+	BufferCfg          BufferConfig                `yaml:"buffer"`
+	RetryCfg           RetryConfig                 `yaml:"retry"`
+	ValidationPolicy   ValidationPolicy            `yaml:"validation"`
+	ProcessorsCfg      []ProcessorConfig           `yaml:"processors"`
+	DedupCfg           DedupConfig                 `yaml:"dedup"`
+	PriorityCfg        Priority                    `yaml:"priority"`
+	AckCfg             Ack                         `yaml:"ack"`
+	RoutesCfg          []RouteConfig               `yaml:"routes"`
+	ReroutesCfg        []RerouteConfig             `yaml:"reroute"`
+	CanariesCfg        []CanaryConfig              `yaml:"canaries"`
+	SerializationCfg   SerializationConfig         `yaml:"serialization"`
+	MetadataCfg        MetadataConfig              `yaml:"metadata"`
+	DocumentIDCfg      DocumentIDConfig            `yaml:"document_id"`
 }
 
-// SchemaConfig -
-type SchemaConfig map[string]Field
+// DedupConfig - deduplication of documents collected within a window
+type DedupConfig struct {
+	Key       string `yaml:"key"`
+	WindowStr string `yaml:"window"`
+}
+
+// RetryConfig - delivery retries backoff
+type RetryConfig struct {
+	BaseStr        string  `yaml:"base"`
+	Multiplier     float64 `yaml:"multiplier"`
+	MaxIntervalStr string  `yaml:"max_interval"`
+	Jitter         float64 `yaml:"jitter"`
+	TimeoutStr     string  `yaml:"timeout"`
+}
+
+// BufferConfig - bounds of the collection buffer
+type BufferConfig struct {
+	MaxDocuments    int            `yaml:"max_documents"`
+	MaxBytes        int64          `yaml:"max_bytes"`
+	Overflow        OverflowPolicy `yaml:"overflow"`
+	BlockTimeoutStr string         `yaml:"block_timeout"`
+}
+
+// SchemaConfig - fields of a schema by field name, along with the validation and outputs of its documents
+type SchemaConfig struct {
+	Fields map[string]Field `yaml:"fields"`
+	// Validation - policy of the documents of the schema, the collection one if empty
+	Validation ValidationPolicy `yaml:"validation"`
+	// Outputs - documents of the schema are conveyed to these outputs only, whatever routes they match
+	Outputs []string `yaml:"outputs"`
+	// AlsoOutputs - outputs documents of the schema are conveyed to as well as those they are routed to
+	AlsoOutputs []string `yaml:"also_outputs"`
+}
+
+// schemaKeys - keys of a schema which are not field names
+var schemaKeys = map[string]struct{}{"fields": {}, "validation": {}, "outputs": {}, "also_outputs": {}}
+
+// UnmarshalYAML reads schemas listing their fields only, as older versions did, unless all their keys are schema keys
+func (c *SchemaConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var keys map[string]interface{}
+	err := unmarshal(&keys)
+	if err != nil {
+		return err
+	}
+	settings := len(keys) > 0
+	for key := range keys {
+		if _, ok := schemaKeys[key]; !ok {
+			settings = false
+			break
+		}
+	}
+	if settings {
+		type schemaConfig SchemaConfig
+		// a field named after a schema key does not unmarshal as one, such as validation: {type: string}
+		if err = unmarshal((*schemaConfig)(c)); err == nil {
+			return nil
+		}
+		*c = SchemaConfig{}
+	}
+	return unmarshal(&c.Fields)
+}
 
 // FlushPeriod - extract flush period from config
 func (c *Config) FlushPeriod() (time.Duration, error) {
@@ -34,6 +109,125 @@ func (c *Config) RetentionPeriod() (time.Duration, error) {
 	return period(c.RetentionPeriodStr)
 }
 
+// BufferLimits - extract buffer limits from config
+func (c *Config) BufferLimits() (limits BufferLimits, err error) {
+	limits = BufferLimits{
+		MaxDocuments: c.BufferCfg.MaxDocuments,
+		MaxBytes:     c.BufferCfg.MaxBytes,
+		Overflow:     c.BufferCfg.Overflow,
+	}
+	if limits.MaxDocuments < 0 || limits.MaxBytes < 0 {
+		return limits, ErrLengthLowerThanZero
+	}
+	switch limits.Overflow {
+	case "":
+		limits.Overflow = Reject
+	case Reject, Block, DropOldest:
+	default:
+		return limits, ErrUnsupportedOverflow
+	}
+	if c.BufferCfg.BlockTimeoutStr != "" {
+		limits.BlockTimeout, err = period(c.BufferCfg.BlockTimeoutStr)
+		if err != nil {
+			return limits, fmt.Errorf("period.%s", err)
+		}
+	}
+	return limits, nil
+}
+
+// Validation - extract schema validation policy from config, off by default
+func (c *Config) Validation() (ValidationPolicy, error) {
+	switch c.ValidationPolicy {
+	case "":
+		return ValidationOff, nil
+	case ValidationOff, ValidationReject, ValidationTag:
+		return c.ValidationPolicy, nil
+	default:
+		return c.ValidationPolicy, ErrUnsupportedValidation
+	}
+}
+
+// Priority - extract conveyance priority from config, normal by default
+func (c *Config) Priority() (Priority, error) {
+	switch c.PriorityCfg {
+	case "":
+		return Normal, nil
+	case High, Normal, Low:
+		return c.PriorityCfg, nil
+	default:
+		return c.PriorityCfg, ErrUnsupportedPriority
+	}
+}
+
+// Ack - extract the default ack mode from config, durable by default
+func (c *Config) Ack() (Ack, error) {
+	if err := c.AckCfg.Validate(); err != nil {
+		return c.AckCfg, err
+	}
+	if c.AckCfg == "" {
+		return AckDurable, nil
+	}
+	return c.AckCfg, nil
+}
+
+// Dedup - extract deduplication from config, disabled without window
+func (c *Config) Dedup() (dedup Dedup, err error) {
+	dedup.Key = c.DedupCfg.Key
+	if c.DedupCfg.WindowStr == "" {
+		return dedup, nil
+	}
+	dedup.Window, err = period(c.DedupCfg.WindowStr)
+	if err != nil {
+		return dedup, fmt.Errorf("period.%s", err)
+	}
+	if dedup.Window < 0 {
+		return dedup, ErrWrongPeriod
+	}
+	return dedup, nil
+}
+
+// Backoff - extract retries backoff from config, base defaults to flush period
+func (c *Config) Backoff(flushPeriod time.Duration) (backoff Backoff, err error) {
+	backoff = Backoff{
+		Base:       flushPeriod,
+		Multiplier: c.RetryCfg.Multiplier,
+		Jitter:     c.RetryCfg.Jitter,
+	}
+	if backoff.Multiplier == 0 {
+		backoff.Multiplier = defaultBackoffMultiplier
+	}
+	if backoff.Multiplier < 1 || backoff.Jitter < 0 || backoff.Jitter > 1 {
+		return backoff, ErrWrongBackoff
+	}
+	if c.RetryCfg.BaseStr != "" {
+		backoff.Base, err = period(c.RetryCfg.BaseStr)
+		if err != nil {
+			return backoff, fmt.Errorf("period.%s", err)
+		}
+	}
+	if c.RetryCfg.MaxIntervalStr != "" {
+		backoff.MaxInterval, err = period(c.RetryCfg.MaxIntervalStr)
+		if err != nil {
+			return backoff, fmt.Errorf("period.%s", err)
+		}
+	}
+	if c.RetryCfg.TimeoutStr != "" {
+		backoff.Timeout, err = period(c.RetryCfg.TimeoutStr)
+		if err != nil {
+			return backoff, fmt.Errorf("period.%s", err)
+		}
+		if backoff.Timeout <= 0 {
+			return backoff, ErrWrongBackoff
+		}
+	}
+	return backoff, nil
+}
+
+// Period parses a {quantity} {unit} duration such as 5 seconds
+func Period(periodStr string) (time.Duration, error) {
+	return period(periodStr)
+}
+
 func period(periodStr string) (period time.Duration, err error) {
 	periodStrSplit := strings.Split(periodStr, " ")
 	if len(periodStrSplit) != 2 {
@@ -54,9 +248,11 @@ func period(periodStr string) (period time.Duration, err error) {
 	case "seconds":
 		period = time.Duration(quantity * float64(time.Second))
 		break
-	case "milliseonds":
+	case "milliseconds", "milliseonds":
 		period = time.Duration(quantity * float64(time.Millisecond))
 		break
+	default:
+		return period, ErrWrongPeriod
 	}
 	return period, nil
 }
@@ -64,12 +260,22 @@ func period(periodStr string) (period time.Duration, err error) {
 // Schemas - extract schemas config
 func (c *Config) Schemas() ([]Schema, error) {
 	schemas := make([]Schema, 0, len(c.SchemasCfg))
-	for schemaName, fields := range c.SchemasCfg {
-		var ok bool
+	for schemaName, schemaCfg := range c.SchemasCfg {
+		switch schemaCfg.Validation {
+		case "", ValidationOff, ValidationReject, ValidationTag:
+		default:
+			return nil, ErrUnsupportedValidation
+		}
+		var (
+			ok     bool
+			fields = schemaCfg.Fields
+		)
+		if fields == nil {
+			fields = make(map[string]Field)
+		}
 		for key, field := range fields {
 			if field.Type == "" {
 				field.Type = String
-				fields[key] = field
 			}
 			if _, ok = FieldTypes[field.Type]; !ok {
 				return nil, ErrUnsupportedType
@@ -88,10 +294,14 @@ func (c *Config) Schemas() ([]Schema, error) {
 					return nil, ErrUnsupportedDateFormat
 				}
 			}
+			fields[key] = field
 		}
 		schemas = append(schemas, Schema{
-			Name:   schemaName,
-			Fields: fields,
+			Name:        schemaName,
+			Fields:      fields,
+			Validation:  schemaCfg.Validation,
+			Outputs:     schemaCfg.Outputs,
+			AlsoOutputs: schemaCfg.AlsoOutputs,
 		})
 	}
 	return schemas, nil
@@ -1,8 +1,13 @@
 package collection
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
+	"io"
 	"time"
 
 	"github.com/google/uuid"
@@ -20,26 +25,130 @@ type Document struct {
 	CollectionName Name
 	SchemaName     SchemaName
 	Body           []byte
+	// TraceParent - W3C trace context of the span which buffered the document, empty if untraced
+	TraceParent string
+	// dedupKey - digest the document is deduplicated on, empty if it is not; unexported so it is not buffered
+	dedupKey string
+}
+
+// DedupKey - digest the document is deduplicated on, empty if it is not
+func (d *Document) DedupKey() string {
+	return d.dedupKey
 }
 
 // NewDocument creates a document from es index, document type and its body
 func NewDocument(collectionName Name, schemaName SchemaName, body []byte) (*Document, error) {
+	bodyMap, err := parseBody(body)
+	if err != nil {
+		return nil, err
+	}
+	document := newDocument(collectionName, schemaName)
+	err = document.encode(bodyMap)
+	if err != nil {
+		return nil, err
+	}
+	return document, nil
+}
+
+// NewDocument creates a document of given schema, given the metadata of the request ctx carries if any, transformed by the collection processors
+// then validated according to the collection validation policy; ErrDropped if a processor drops it
+func (c *Collection) NewDocument(ctx context.Context, schemaName SchemaName, body []byte) (*Document, error) {
+	bodyMap, err := parseBody(body)
+	if err != nil {
+		return nil, err
+	}
+	document := newDocument(c.Name, schemaName)
+	request := RequestFrom(ctx)
+	if request != nil && c.Metadata != nil {
+		c.Metadata.apply(request, bodyMap)
+	}
+	for _, processor := range c.Processors {
+		if !processor.Process(document, bodyMap) {
+			return nil, ErrDropped
+		}
+	}
+	schema := c.Schema(schemaName)
+	if validation := c.validation(schema); schema != nil && validation != ValidationOff && validation != "" {
+		violations := schema.Validate(bodyMap)
+		if len(violations) > 0 {
+			if validation == ValidationReject {
+				return nil, &SchemaViolation{Violations: violations}
+			}
+			bodyMap[ViolationsField] = violations
+		}
+	}
+	id, supplied, err := c.suppliedID(request, bodyMap)
+	if err != nil {
+		return nil, err
+	}
+	if supplied {
+		document.ID = id
+	}
+	err = document.encode(bodyMap)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case supplied && c.Dedup.Enabled():
+		// retries of a document carry the ID its client supplied, whatever the dedup key
+		document.dedupKey = id.String()
+	case c.Dedup.Enabled():
+		document.dedupKey = c.Dedup.key(document, bodyMap)
+	}
+	return document, nil
+}
+
+// key - digest of the dedup key field, or of the body if the key is not set; empty if the field is missing
+func (d Dedup) key(document *Document, body map[string]interface{}) string {
+	var value []byte
+	if d.Key == "" {
+		value = document.Body
+	} else {
+		field, ok := lookup(body, d.Key)
+		if !ok || field == nil {
+			return ""
+		}
+		if str, ok := field.(string); ok {
+			value = []byte(str)
+		} else {
+			value, _ = json.Marshal(field)
+		}
+	}
+	digest := sha256.Sum256(value)
+	return hex.EncodeToString(digest[:])
+}
+
+// parseBody decodes a JSON object, numbers are kept as json.Number so they do not lose precision
+func parseBody(body []byte) (map[string]interface{}, error) {
 	var bodyMap map[string]interface{}
-	err := json.Unmarshal(body, &bodyMap)
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	err := decoder.Decode(&bodyMap)
 	if err != nil {
 		return nil, ErrUnparsableJSON
 	}
-	postedAt := time.Now().UTC()
-	// bodyMap["postedAt"] = postedAt
-	body, err = json.Marshal(bodyMap)
-	if err != nil {
+	if _, err = decoder.Token(); err != io.EOF {
 		return nil, ErrUnparsableJSON
 	}
+	if bodyMap == nil {
+		bodyMap = make(map[string]interface{})
+	}
+	return bodyMap, nil
+}
+
+func newDocument(collectionName Name, schemaName SchemaName) *Document {
 	return &Document{
 		ID:             uuid.New(),
-		PostedAt:       postedAt,
+		PostedAt:       time.Now().UTC(),
 		CollectionName: collectionName,
 		SchemaName:     schemaName,
-		Body:           body,
-	}, nil
+	}
+}
+
+func (d *Document) encode(bodyMap map[string]interface{}) (err error) {
+	d.Body, err = json.Marshal(bodyMap)
+	if err != nil {
+		return ErrUnparsableJSON
+	}
+	return nil
 }
@@ -6,7 +6,7 @@ import (
 
 var (
 	// ErrWrongPeriod -
-	ErrWrongPeriod = errors.New("ErrWrongPeriod")
+	ErrWrongPeriod = errors.New("ErrWrongPeriod - period must be {quantity} {hours|minutes|seconds|milliseconds}")
 
 	// ErrUnsupportedType -
 	ErrUnsupportedType = errors.New("ErrUnsupportedType")
@@ -16,4 +16,79 @@ var (
 
 	// ErrUnsupportedDateFormat -
 	ErrUnsupportedDateFormat = errors.New("ErrUnsupportedDateFormat")
+
+	// ErrWrongBackoff -
+	ErrWrongBackoff = errors.New("ErrWrongBackoff - retry multiplier must be >= 1, jitter between 0 and 1 and timeout positive")
+
+	// ErrUnsupportedOverflow -
+	ErrUnsupportedOverflow = errors.New("ErrUnsupportedOverflow - buffer overflow must be one of reject|block|drop_oldest")
+
+	// ErrUnsupportedPriority -
+	ErrUnsupportedPriority = errors.New("ErrUnsupportedPriority - priority must be one of high|normal|low")
+
+	// ErrWrongRoute -
+	ErrWrongRoute = errors.New("ErrWrongRoute - a route requires outputs")
+
+	// ErrWrongCanary -
+	ErrWrongCanary = errors.New("ErrWrongCanary - a canary requires an output and a canary output other than it, and a percent between 0 and 100")
+
+	// ErrUnsupportedCanarySplit -
+	ErrUnsupportedCanarySplit = errors.New("ErrUnsupportedCanarySplit - canary by must be one of document|pipe")
+
+	// ErrUnsupportedStorageFormat -
+	ErrUnsupportedStorageFormat = errors.New("ErrUnsupportedStorageFormat - serialization storage must be one of protobuf|msgpack|json|gob")
+
+	// ErrUnsupportedDeliveryFormat -
+	ErrUnsupportedDeliveryFormat = errors.New("ErrUnsupportedDeliveryFormat - serialization delivery must be one of json|msgpack")
+
+	// ErrWrongDocumentID -
+	ErrWrongDocumentID = errors.New("ErrWrongDocumentID - the document ID supplied must be a UUID string")
+
+	// ErrWrongMetadata -
+	ErrWrongMetadata = errors.New("ErrWrongMetadata - metadata headers require a field path and a header name")
+
+	// ErrWrongReroute -
+	ErrWrongReroute = errors.New("ErrWrongReroute - a reroute requires a collection other than its own")
+
+	// ErrWrongProcessor -
+	ErrWrongProcessor = errors.New("ErrWrongProcessor - a processor must be exactly one of rename|add|enrich|drop|timestamp|json|grok|user_agent|redact|drop_when|sample")
+
+	// ErrMissingProcessorField -
+	ErrMissingProcessorField = errors.New("ErrMissingProcessorField - the processor field is required")
+
+	// ErrMissingGrokPattern -
+	ErrMissingGrokPattern = errors.New("ErrMissingGrokPattern - grok processor requires at least one pattern")
+
+	// ErrUnknownGrokPattern -
+	ErrUnknownGrokPattern = errors.New("ErrUnknownGrokPattern - the pattern is neither built-in nor defined")
+
+	// ErrRecursiveGrokPattern -
+	ErrRecursiveGrokPattern = errors.New("ErrRecursiveGrokPattern - patterns reference each other too deeply")
+
+	// ErrNothingToRedact -
+	ErrNothingToRedact = errors.New("ErrNothingToRedact - redact processor requires fields, matchers or patterns")
+
+	// ErrUnknownMatcher -
+	ErrUnknownMatcher = errors.New("ErrUnknownMatcher - matcher must be one of email|credit_card|ipv4|ipv6")
+
+	// ErrUnsupportedRedactMethod -
+	ErrUnsupportedRedactMethod = errors.New("ErrUnsupportedRedactMethod - redact method must be one of mask|hash")
+
+	// ErrUnknownTimezone -
+	ErrUnknownTimezone = errors.New("ErrUnknownTimezone - timezone must be an IANA location such as Europe/Paris")
+
+	// ErrWrongCondition -
+	ErrWrongCondition = errors.New("ErrWrongCondition - condition must be {field} {==|!=|<|<=|>|>=} {JSON value}")
+
+	// ErrWrongSample -
+	ErrWrongSample = errors.New("ErrWrongSample - sample requires either every > 0 or rate between 0 and 1")
+
+	// ErrDropped - the document was dropped by a processor, it is accepted but not buffered
+	ErrDropped = errors.New("ErrDropped")
+
+	// ErrUnsupportedAck -
+	ErrUnsupportedAck = errors.New("ErrUnsupportedAck - ack must be one of durable|async")
+
+	// ErrUnsupportedValidation -
+	ErrUnsupportedValidation = errors.New("ErrUnsupportedValidation - validation must be one of off|reject|tag")
 )
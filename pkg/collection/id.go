@@ -0,0 +1,56 @@
+package collection
+
+import (
+	"net/http"
+
+	"github.com/google/uuid"
+)
+
+// DocumentIDConfig - where clients supply the ID of their documents, which is generated if they do not
+type DocumentIDConfig struct {
+	// Field - path of the field holding the ID, read once documents are processed
+	Field string `yaml:"field"`
+	// Header - request header holding the ID of a document pushed on its own
+	Header string `yaml:"header"`
+}
+
+// DocumentID - where clients supply the ID of their documents, the header name is canonical
+type DocumentID struct {
+	Field  string
+	Header string
+}
+
+// DocumentID - extract document ID from config
+func (c *Config) DocumentID() DocumentID {
+	documentID := DocumentID(c.DocumentIDCfg)
+	if documentID.Header != "" {
+		documentID.Header = http.CanonicalHeaderKey(documentID.Header)
+	}
+	return documentID
+}
+
+// suppliedID returns the ID the client supplied for the document of body, false if none.
+// The field wins over the header, which only applies to requests pushing a single document; ErrWrongDocumentID if the ID is not a UUID.
+func (c *Collection) suppliedID(request *Request, body map[string]interface{}) (uuid.UUID, bool, error) {
+	var value string
+	if c.DocumentID.Field != "" {
+		if field, ok := lookup(body, c.DocumentID.Field); ok && field != nil {
+			str, ok := field.(string)
+			if !ok {
+				return uuid.Nil, false, ErrWrongDocumentID
+			}
+			value = str
+		}
+	}
+	if value == "" && c.DocumentID.Header != "" && request != nil && request.Single {
+		value = request.Header.Get(c.DocumentID.Header)
+	}
+	if value == "" {
+		return uuid.Nil, false, nil
+	}
+	id, err := uuid.Parse(value)
+	if err != nil {
+		return uuid.Nil, false, ErrWrongDocumentID
+	}
+	return id, true, nil
+}
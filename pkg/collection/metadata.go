@@ -0,0 +1,108 @@
+package collection
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// MetadataConfig - fields set from the HTTP request which pushed documents, by field path
+type MetadataConfig struct {
+	// Headers - names of request headers by field path, e.g. request_id: X-Request-ID
+	Headers map[string]string `yaml:"headers"`
+	// ClientIP - field set to the address of the client
+	ClientIP string `yaml:"client_ip"`
+	// TrustForwardedFor - the client address is read from the X-Forwarded-For header appended by a reverse proxy
+	TrustForwardedFor bool `yaml:"trust_forwarded_for"`
+	// Overwrite - whether fields documents already have are overwritten
+	Overwrite bool `yaml:"overwrite"`
+}
+
+// Request - HTTP request documents were pushed with
+type Request struct {
+	Header     http.Header
+	RemoteAddr string
+	// Single - whether the request pushed a single document, whose ID the document ID header may hold
+	Single bool
+}
+
+type requestContext struct{}
+
+// WithRequest returns a copy of ctx carrying the request documents were pushed with
+func WithRequest(ctx context.Context, r *http.Request, single bool) context.Context {
+	return context.WithValue(ctx, requestContext{}, &Request{r.Header, r.RemoteAddr, single})
+}
+
+// RequestFrom returns the request ctx carries, nil if documents were not pushed over HTTP
+func RequestFrom(ctx context.Context) *Request {
+	request, _ := ctx.Value(requestContext{}).(*Request)
+	return request
+}
+
+// Metadata - fields set from requests, header names are canonical
+type Metadata struct {
+	Headers           map[string]string
+	ClientIP          string
+	TrustForwardedFor bool
+	Overwrite         bool
+}
+
+// Metadata - extract metadata from config, nil unless a field is set
+func (c *Config) Metadata() (*Metadata, error) {
+	if len(c.MetadataCfg.Headers) == 0 && c.MetadataCfg.ClientIP == "" {
+		return nil, nil
+	}
+	headers := make(map[string]string, len(c.MetadataCfg.Headers))
+	for path, name := range c.MetadataCfg.Headers {
+		if path == "" || name == "" {
+			return nil, ErrWrongMetadata
+		}
+		headers[path] = http.CanonicalHeaderKey(name)
+	}
+	return &Metadata{
+		Headers:           headers,
+		ClientIP:          c.MetadataCfg.ClientIP,
+		TrustForwardedFor: c.MetadataCfg.TrustForwardedFor,
+		Overwrite:         c.MetadataCfg.Overwrite,
+	}, nil
+}
+
+// apply sets the fields of body from request, headers the request does not have are not set.
+// Headers sent several times are joined by commas.
+func (m *Metadata) apply(request *Request, body map[string]interface{}) {
+	set := func(path, value string) {
+		if value == "" {
+			return
+		}
+		if !m.Overwrite {
+			if _, ok := lookup(body, path); ok {
+				return
+			}
+		}
+		store(body, path, value)
+	}
+	for path, name := range m.Headers {
+		set(path, strings.Join(request.Header.Values(name), ", "))
+	}
+	if m.ClientIP != "" {
+		set(m.ClientIP, m.clientIP(request))
+	}
+}
+
+func (m *Metadata) clientIP(request *Request) string {
+	if m.TrustForwardedFor {
+		if forwarded := request.Header.Values("X-Forwarded-For"); len(forwarded) > 0 {
+			// the last address is the one the proxy received the request from
+			hops := strings.Split(forwarded[len(forwarded)-1], ",")
+			if ip := strings.TrimSpace(hops[len(hops)-1]); ip != "" {
+				return ip
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(request.RemoteAddr)
+	if err != nil {
+		return request.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,46 @@
+package collection
+
+import "context"
+
+// Priority - how soon pipes of a collection are conveyed relative to the ones of other collections, when outputs are busy
+type Priority string
+
+const (
+	// High priority pipes are conveyed 4 times as often as low priority ones
+	High Priority = "high"
+	// Normal priority pipes are conveyed twice as often as low priority ones
+	Normal Priority = "normal"
+	// Low priority pipes are conveyed last, yet they are never starved
+	Low Priority = "low"
+)
+
+// Priorities - supported priorities, from the highest
+var Priorities = []Priority{High, Normal, Low}
+
+// Weight - share of busy outputs given to the pipes of a priority
+func (p Priority) Weight() int {
+	switch p {
+	case High:
+		return 4
+	case Low:
+		return 1
+	default:
+		return 2
+	}
+}
+
+type priorityContext struct{}
+
+// WithPriority returns a copy of ctx carrying the priority of the collection whose pipes are conveyed
+func WithPriority(ctx context.Context, priority Priority) context.Context {
+	return context.WithValue(ctx, priorityContext{}, priority)
+}
+
+// PriorityFrom returns the priority ctx carries, normal if none
+func PriorityFrom(ctx context.Context) Priority {
+	priority, ok := ctx.Value(priorityContext{}).(Priority)
+	if !ok || priority == "" {
+		return Normal
+	}
+	return priority
+}
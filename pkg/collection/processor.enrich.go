@@ -0,0 +1,82 @@
+package collection
+
+import (
+	"os"
+)
+
+// environment variables the region of the instance is read from, in order
+var regionEnv = []string{"REGION", "AWS_REGION", "AWS_DEFAULT_REGION", "GOOGLE_CLOUD_REGION", "AZURE_REGION"}
+
+// EnrichConfig - fields describing where documents were collected, by field path
+type EnrichConfig struct {
+	// Hostname - field set to the hostname of the instance
+	Hostname string `yaml:"hostname"`
+	// Pod - field set to the pod name, from POD_NAME or HOSTNAME in Kubernetes
+	Pod string `yaml:"pod"`
+	// Namespace - field set to the pod namespace, from POD_NAMESPACE
+	Namespace string `yaml:"namespace"`
+	// Region - field set to the region, from the first of REGION, AWS_REGION, AWS_DEFAULT_REGION, GOOGLE_CLOUD_REGION and AZURE_REGION which is set
+	Region string `yaml:"region"`
+	// Fields - static values by field path
+	Fields map[string]interface{} `yaml:"fields"`
+	// Env - names of environment variables by field path
+	Env map[string]string `yaml:"env"`
+	// Overwrite - whether fields documents already have are overwritten
+	Overwrite bool `yaml:"overwrite"`
+}
+
+// processor resolves values once, fields whose value is unknown are not set
+func (c *EnrichConfig) processor() (Processor, error) {
+	values := make(map[string]interface{})
+	set := func(path string, value interface{}) {
+		if path != "" && value != "" {
+			values[path] = value
+		}
+	}
+	for path, value := range normalize(c.Fields).(map[string]interface{}) {
+		set(path, value)
+	}
+	for path, name := range c.Env {
+		set(path, os.Getenv(name))
+	}
+	if c.Hostname != "" {
+		hostname, _ := os.Hostname()
+		set(c.Hostname, hostname)
+	}
+	if c.Pod != "" {
+		pod := os.Getenv("POD_NAME")
+		if pod == "" && os.Getenv("KUBERNETES_SERVICE_HOST") != "" {
+			// pods are named after their hostname unless spec.hostname is set
+			pod = os.Getenv("HOSTNAME")
+		}
+		set(c.Pod, pod)
+	}
+	set(c.Namespace, os.Getenv("POD_NAMESPACE"))
+	if c.Region != "" {
+		for _, name := range regionEnv {
+			if region := os.Getenv(name); region != "" {
+				set(c.Region, region)
+				break
+			}
+		}
+	}
+	return &enrichProcessor{values, c.Overwrite}, nil
+}
+
+// enrichProcessor sets fields describing the instance, keeping those documents already have unless overwriting
+type enrichProcessor struct {
+	values    map[string]interface{}
+	overwrite bool
+}
+
+func (p *enrichProcessor) Process(document *Document, body map[string]interface{}) bool {
+	for path, value := range p.values {
+		if !p.overwrite {
+			if _, ok := lookup(body, path); ok {
+				continue
+			}
+		}
+		store(body, path, normalize(value))
+	}
+	return true
+}
@@ -0,0 +1,44 @@
+package collection
+
+import (
+	"sort"
+)
+
+// renameProcessor moves fields from their path to a new one
+type renameProcessor map[string]string
+
+func (p renameProcessor) Process(document *Document, body map[string]interface{}) bool {
+	// in a stable order, so renames chained through a same field behave the same for every document
+	from := make([]string, 0, len(p))
+	for path := range p {
+		from = append(from, path)
+	}
+	sort.Strings(from)
+	for _, path := range from {
+		if value, ok := remove(body, path); ok {
+			store(body, p[path], value)
+		}
+	}
+	return true
+}
+
+// addProcessor sets static fields, overwriting existing ones
+type addProcessor map[string]interface{}
+
+func (p addProcessor) Process(document *Document, body map[string]interface{}) bool {
+	for path, value := range p {
+		// copied, so later processors do not alter the values added to other documents
+		store(body, path, normalize(value))
+	}
+	return true
+}
+
+// dropProcessor removes fields
+type dropProcessor []string
+
+func (p dropProcessor) Process(document *Document, body map[string]interface{}) bool {
+	for _, path := range p {
+		remove(body, path)
+	}
+	return true
+}
@@ -0,0 +1,171 @@
+package collection
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"regexp"
+	"strings"
+	"sync/atomic"
+)
+
+// conditionSyntax matches {field path} {operator} {JSON value}, such as level == "debug"
+var conditionSyntax = regexp.MustCompile(`^\s*([^\s=!<>]+)\s*(==|!=|<=|>=|<|>)\s*(.+?)\s*$`)
+
+// condition compares a field to a value, missing fields are null
+type condition struct {
+	path     string
+	operator string
+	value    interface{}
+}
+
+func parseCondition(str string) (*condition, error) {
+	match := conditionSyntax.FindStringSubmatch(str)
+	if match == nil {
+		return nil, ErrWrongCondition
+	}
+	cond := &condition{path: match[1], operator: match[2]}
+	decoder := json.NewDecoder(strings.NewReader(match[3]))
+	decoder.UseNumber()
+	if err := decoder.Decode(&cond.value); err != nil {
+		return nil, ErrWrongCondition
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return nil, ErrWrongCondition
+	}
+	return cond, nil
+}
+
+// parseConditions - conditions which must all hold
+func parseConditions(strs []string) ([]condition, error) {
+	conditions := make([]condition, 0, len(strs))
+	for _, str := range strs {
+		cond, err := parseCondition(str)
+		if err != nil {
+			return nil, fmt.Errorf("(%s).%s", str, err)
+		}
+		conditions = append(conditions, *cond)
+	}
+	return conditions, nil
+}
+
+func matchAll(conditions []condition, body map[string]interface{}) bool {
+	for i := range conditions {
+		if !conditions[i].match(body) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *condition) match(body map[string]interface{}) bool {
+	value, _ := lookup(body, c.path)
+	switch c.operator {
+	case "==":
+		return equal(value, c.value)
+	case "!=":
+		return !equal(value, c.value)
+	}
+	cmp, ok := compare(value, c.value)
+	if !ok {
+		return false
+	}
+	switch c.operator {
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	default:
+		return cmp >= 0
+	}
+}
+
+func equal(a, b interface{}) bool {
+	if cmp, ok := compare(a, b); ok {
+		return cmp == 0
+	}
+	// objects, arrays, booleans and null
+	encodedA, errA := json.Marshal(a)
+	encodedB, errB := json.Marshal(b)
+	return errA == nil && errB == nil && bytes.Equal(encodedA, encodedB)
+}
+
+// compare numbers or strings, ok is false for other values or values of different types
+func compare(a, b interface{}) (cmp int, ok bool) {
+	switch x := a.(type) {
+	case string:
+		y, ok := b.(string)
+		if !ok {
+			return 0, false
+		}
+		return strings.Compare(x, y), true
+	case json.Number:
+		y, ok := b.(json.Number)
+		if !ok {
+			return 0, false
+		}
+		fx, errX := x.Float64()
+		fy, errY := y.Float64()
+		if errX != nil || errY != nil {
+			return 0, false
+		}
+		switch {
+		case fx < fy:
+			return -1, true
+		case fx > fy:
+			return 1, true
+		default:
+			return 0, true
+		}
+	default:
+		return 0, false
+	}
+}
+
+// dropWhenProcessor drops documents matching all its conditions
+type dropWhenProcessor []condition
+
+func (p dropWhenProcessor) Process(document *Document, body map[string]interface{}) bool {
+	return !matchAll(p, body)
+}
+
+// SampleConfig - keep a share of documents
+type SampleConfig struct {
+	Every int      `yaml:"every"`
+	Rate  float64  `yaml:"rate"`
+	When  []string `yaml:"when"`
+}
+
+func (c *SampleConfig) processor() (Processor, error) {
+	if (c.Every > 0) == (c.Rate > 0) || c.Every < 0 || c.Rate < 0 || c.Rate > 1 {
+		return nil, ErrWrongSample
+	}
+	when, err := parseConditions(c.When)
+	if err != nil {
+		return nil, fmt.Errorf("when.%s", err)
+	}
+	return &sampleProcessor{every: uint64(c.Every), rate: c.Rate, when: when}, nil
+}
+
+// sampleProcessor keeps 1 in every documents, or documents with probability rate;
+// documents which do not match all the when conditions are all kept
+type sampleProcessor struct {
+	every uint64
+	rate  float64
+	when  []condition
+	seen  atomic.Uint64
+}
+
+func (p *sampleProcessor) Process(document *Document, body map[string]interface{}) bool {
+	if !matchAll(p.when, body) {
+		return true
+	}
+	if p.every > 0 {
+		return (p.seen.Add(1)-1)%p.every == 0
+	}
+	return rand.Float64() < p.rate
+}
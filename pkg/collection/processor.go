@@ -0,0 +1,194 @@
+package collection
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Processor transforms the body of a document before it is validated and buffered,
+// the document is dropped if it returns false
+type Processor interface {
+	Process(document *Document, body map[string]interface{}) bool
+}
+
+// ProcessorConfig - a step of the processor chain of a collection, exactly one processor must be set
+type ProcessorConfig struct {
+	Rename    map[string]string      `yaml:"rename"`
+	Add       map[string]interface{} `yaml:"add"`
+	Enrich    *EnrichConfig          `yaml:"enrich"`
+	Drop      []string               `yaml:"drop"`
+	Timestamp *TimestampConfig       `yaml:"timestamp"`
+	JSON      *JSONConfig            `yaml:"json"`
+	Grok      *GrokConfig            `yaml:"grok"`
+	UserAgent *UserAgentConfig       `yaml:"user_agent"`
+	Redact    *RedactConfig          `yaml:"redact"`
+	DropWhen  []string               `yaml:"drop_when"`
+	Sample    *SampleConfig          `yaml:"sample"`
+}
+
+// Processors - build the processor chain from config, in order
+func (c *Config) Processors() ([]Processor, error) {
+	processors := make([]Processor, 0, len(c.ProcessorsCfg))
+	for i, processorCfg := range c.ProcessorsCfg {
+		processor, err := processorCfg.Processor()
+		if err != nil {
+			return nil, fmt.Errorf("Processor(%d).%s", i, err)
+		}
+		if processor == nil {
+			// disabled
+			continue
+		}
+		processors = append(processors, processor)
+	}
+	return processors, nil
+}
+
+// Processor - build the processor of a step, nil if the step is disabled
+func (c *ProcessorConfig) Processor() (Processor, error) {
+	var (
+		processor Processor
+		count     int
+	)
+	if c.Rename != nil {
+		processor, count = renameProcessor(c.Rename), count+1
+	}
+	if c.Add != nil {
+		processor, count = addProcessor(normalize(c.Add).(map[string]interface{})), count+1
+	}
+	if c.Enrich != nil {
+		enrich, err := c.Enrich.processor()
+		if err != nil {
+			return nil, err
+		}
+		processor, count = enrich, count+1
+	}
+	if c.Drop != nil {
+		processor, count = dropProcessor(c.Drop), count+1
+	}
+	if c.Timestamp != nil {
+		timestamp, err := c.Timestamp.processor()
+		if err != nil {
+			return nil, err
+		}
+		processor, count = timestamp, count+1
+	}
+	if c.JSON != nil {
+		json, err := c.JSON.processor()
+		if err != nil {
+			return nil, err
+		}
+		processor, count = json, count+1
+	}
+	if c.Grok != nil {
+		grok, err := c.Grok.processor()
+		if err != nil {
+			return nil, err
+		}
+		processor, count = grok, count+1
+	}
+	if c.UserAgent != nil {
+		userAgent, err := c.UserAgent.processor()
+		if err != nil {
+			return nil, err
+		}
+		processor, count = userAgent, count+1
+	}
+	if c.Redact != nil {
+		redact, err := c.Redact.processor()
+		if err != nil {
+			return nil, err
+		}
+		processor, count = redact, count+1
+	}
+	if c.DropWhen != nil {
+		conditions, err := parseConditions(c.DropWhen)
+		if err != nil {
+			return nil, err
+		}
+		processor, count = dropWhenProcessor(conditions), count+1
+	}
+	if c.Sample != nil {
+		sample, err := c.Sample.processor()
+		if err != nil {
+			return nil, err
+		}
+		processor, count = sample, count+1
+	}
+	if count != 1 {
+		return nil, ErrWrongProcessor
+	}
+	return processor, nil
+}
+
+// normalize copies a value, converting maps decoded from yaml into maps which encode to JSON
+func normalize(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, elem := range v {
+			m[fmt.Sprint(key)] = normalize(elem)
+		}
+		return m
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, elem := range v {
+			m[key] = normalize(elem)
+		}
+		return m
+	case []interface{}:
+		s := make([]interface{}, len(v))
+		for i, elem := range v {
+			s[i] = normalize(elem)
+		}
+		return s
+	default:
+		return value
+	}
+}
+
+// Fields are referenced by their dot separated path, such as http.status
+
+func lookup(body map[string]interface{}, path string) (interface{}, bool) {
+	parent, key := parentOf(body, path, false)
+	if parent == nil {
+		return nil, false
+	}
+	value, ok := parent[key]
+	return value, ok
+}
+
+func store(body map[string]interface{}, path string, value interface{}) {
+	parent, key := parentOf(body, path, true)
+	if parent != nil {
+		parent[key] = value
+	}
+}
+
+func remove(body map[string]interface{}, path string) (interface{}, bool) {
+	parent, key := parentOf(body, path, false)
+	if parent == nil {
+		return nil, false
+	}
+	value, ok := parent[key]
+	delete(parent, key)
+	return value, ok
+}
+
+// parentOf - object holding the last segment of path, missing objects are created if create is set;
+// nil if a segment is not an object
+func parentOf(body map[string]interface{}, path string, create bool) (map[string]interface{}, string) {
+	segments := strings.Split(path, ".")
+	parent := body
+	for _, segment := range segments[:len(segments)-1] {
+		child, ok := parent[segment]
+		if !ok && create {
+			child = make(map[string]interface{})
+			parent[segment] = child
+		}
+		parent, ok = child.(map[string]interface{})
+		if !ok {
+			return nil, ""
+		}
+	}
+	return parent, segments[len(segments)-1]
+}
@@ -0,0 +1,149 @@
+package collection
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+)
+
+// GrokConfig - parse a raw field with grok patterns or regular expressions with named groups
+type GrokConfig struct {
+	Field       string            `yaml:"field"`
+	Patterns    []string          `yaml:"patterns"`
+	Definitions map[string]string `yaml:"definitions"`
+}
+
+// grokReference matches %{SYNTAX}, %{SYNTAX:SEMANTIC} and %{SYNTAX:SEMANTIC:TYPE}
+var grokReference = regexp.MustCompile(`%\{(\w+)(?::([\w.]+))?(?::(int|float))?\}`)
+
+// grokMaxDepth bounds the expansion of patterns referencing each other
+const grokMaxDepth = 32
+
+func (c *GrokConfig) processor() (Processor, error) {
+	field := c.Field
+	if field == "" {
+		field = "message"
+	}
+	if len(c.Patterns) == 0 {
+		return nil, ErrMissingGrokPattern
+	}
+	processor := &grokProcessor{field: field}
+	for i, pattern := range c.Patterns {
+		compiled, err := compileGrok(pattern, c.Definitions)
+		if err != nil {
+			return nil, fmt.Errorf("patterns[%d].%s", i, err)
+		}
+		processor.patterns = append(processor.patterns, *compiled)
+	}
+	return processor, nil
+}
+
+// grokPattern - compiled pattern, with the field path and type of its captures by group name
+type grokPattern struct {
+	regexp   *regexp.Regexp
+	captures map[string]grokCapture
+}
+
+type grokCapture struct {
+	path      string
+	fieldType string
+}
+
+func compileGrok(pattern string, definitions map[string]string) (*grokPattern, error) {
+	compiled := &grokPattern{captures: make(map[string]grokCapture)}
+	expanded, err := compiled.expand(pattern, definitions, 0)
+	if err != nil {
+		return nil, err
+	}
+	compiled.regexp, err = regexp.Compile(expanded)
+	if err != nil {
+		return nil, fmt.Errorf("regexp.Compile.%s", err)
+	}
+	for _, name := range compiled.regexp.SubexpNames() {
+		if _, ok := compiled.captures[name]; !ok && name != "" {
+			// named group of a regular expression, captured as is
+			compiled.captures[name] = grokCapture{path: name}
+		}
+	}
+	return compiled, nil
+}
+
+// expand replaces grok references by their definition, semantics become named groups
+func (p *grokPattern) expand(pattern string, definitions map[string]string, depth int) (string, error) {
+	if depth > grokMaxDepth {
+		return "", ErrRecursiveGrokPattern
+	}
+	var err error
+	expanded := grokReference.ReplaceAllStringFunc(pattern, func(reference string) string {
+		if err != nil {
+			return ""
+		}
+		match := grokReference.FindStringSubmatch(reference)
+		definition, ok := definitions[match[1]]
+		if !ok {
+			definition, ok = grokPatterns[match[1]]
+		}
+		if !ok {
+			err = fmt.Errorf("%s.%s", match[1], ErrUnknownGrokPattern)
+			return ""
+		}
+		definition, err = p.expand(definition, definitions, depth+1)
+		if match[2] == "" {
+			return "(?:" + definition + ")"
+		}
+		name := fmt.Sprintf("grok%d", len(p.captures))
+		p.captures[name] = grokCapture{path: match[2], fieldType: match[3]}
+		return fmt.Sprintf("(?P<%s>%s)", name, definition)
+	})
+	return expanded, err
+}
+
+// grokProcessor promotes the captures of the first pattern the field matches to fields of the document,
+// documents whose field matches no pattern are left as is
+type grokProcessor struct {
+	field    string
+	patterns []grokPattern
+}
+
+func (p *grokProcessor) Process(document *Document, body map[string]interface{}) bool {
+	value, ok := lookup(body, p.field)
+	if !ok {
+		return true
+	}
+	str, ok := value.(string)
+	if !ok {
+		return true
+	}
+	for i := range p.patterns {
+		pattern := &p.patterns[i]
+		match := pattern.regexp.FindStringSubmatchIndex(str)
+		if match == nil {
+			continue
+		}
+		for j, name := range pattern.regexp.SubexpNames() {
+			capture, ok := pattern.captures[name]
+			if !ok || match[2*j] < 0 {
+				continue
+			}
+			store(body, capture.path, capture.value(str[match[2*j]:match[2*j+1]]))
+		}
+		return true
+	}
+	return true
+}
+
+// value of a capture, converted to its type if it parses, as is otherwise
+func (c *grokCapture) value(str string) interface{} {
+	switch c.fieldType {
+	case "int":
+		if integer, err := strconv.ParseInt(str, 10, 64); err == nil {
+			return integer
+		}
+	case "float":
+		if float, err := strconv.ParseFloat(str, 64); err == nil && !math.IsInf(float, 0) && !math.IsNaN(float) {
+			return float
+		}
+	}
+	return str
+}
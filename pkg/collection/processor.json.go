@@ -0,0 +1,55 @@
+package collection
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+)
+
+// JSONConfig - extract JSON encoded in a string field
+type JSONConfig struct {
+	Field  string `yaml:"field"`
+	Target string `yaml:"target"`
+}
+
+func (c *JSONConfig) processor() (Processor, error) {
+	if c.Field == "" {
+		return nil, ErrMissingProcessorField
+	}
+	target := c.Target
+	if target == "" {
+		target = c.Field
+	}
+	return &jsonProcessor{c.Field, target}, nil
+}
+
+// jsonProcessor decodes a string field into the target field, fields which are not JSON strings are left as is
+type jsonProcessor struct {
+	field  string
+	target string
+}
+
+func (p *jsonProcessor) Process(document *Document, body map[string]interface{}) bool {
+	value, ok := lookup(body, p.field)
+	if !ok {
+		return true
+	}
+	str, ok := value.(string)
+	if !ok {
+		return true
+	}
+	var extracted interface{}
+	decoder := json.NewDecoder(bytes.NewReader([]byte(str)))
+	decoder.UseNumber()
+	if err := decoder.Decode(&extracted); err != nil {
+		return true
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return true
+	}
+	if p.target != p.field {
+		remove(body, p.field)
+	}
+	store(body, p.target, extracted)
+	return true
+}
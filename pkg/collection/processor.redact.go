@@ -0,0 +1,182 @@
+package collection
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// RedactMethod - how sensitive data is redacted
+type RedactMethod string
+
+const (
+	// Mask replaces sensitive data with the mask
+	Mask RedactMethod = "mask"
+	// Hash replaces sensitive data with its HMAC-SHA256, so documents holding the same data can still be correlated
+	Hash RedactMethod = "hash"
+)
+
+// defaultMask - replacement of masked data
+const defaultMask = "[REDACTED]"
+
+// redactMatchers - built-in matchers of sensitive data in string values
+var redactMatchers = map[string]string{
+	"email":       `%{EMAILADDRESS}`,
+	"credit_card": `\b(?:\d[ -]?){12,18}\d\b`,
+	"ipv4":        `\b%{IPV4}\b`,
+	"ipv6":        `%{IPV6}`,
+}
+
+// RedactConfig - mask or hash sensitive data before documents are buffered
+type RedactConfig struct {
+	Enabled  *bool        `yaml:"enabled"`
+	Fields   []string     `yaml:"fields"`
+	Matchers []string     `yaml:"matchers"`
+	Patterns []string     `yaml:"patterns"`
+	Method   RedactMethod `yaml:"method"`
+	Mask     string       `yaml:"mask"`
+	HashKey  string       `yaml:"hash_key"`
+}
+
+// processor - nil if redaction is disabled
+func (c *RedactConfig) processor() (Processor, error) {
+	if len(c.Fields) == 0 && len(c.Matchers) == 0 && len(c.Patterns) == 0 {
+		return nil, ErrNothingToRedact
+	}
+	processor := &redactProcessor{
+		fields:  c.Fields,
+		method:  c.Method,
+		mask:    c.Mask,
+		hashKey: []byte(c.HashKey),
+	}
+	switch processor.method {
+	case "":
+		processor.method = Mask
+	case Mask, Hash:
+	default:
+		return nil, ErrUnsupportedRedactMethod
+	}
+	if processor.mask == "" {
+		processor.mask = defaultMask
+	}
+	for _, matcher := range c.Matchers {
+		pattern, ok := redactMatchers[matcher]
+		if !ok {
+			return nil, fmt.Errorf("%s.%s", matcher, ErrUnknownMatcher)
+		}
+		compiled, err := compileGrok(pattern, nil)
+		if err != nil {
+			return nil, fmt.Errorf("%s.%s", matcher, err)
+		}
+		processor.matchers = append(processor.matchers, redactMatcher{compiled.regexp, matcher == "credit_card"})
+	}
+	for i, pattern := range c.Patterns {
+		compiled, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("patterns[%d].regexp.Compile.%s", i, err)
+		}
+		processor.matchers = append(processor.matchers, redactMatcher{regexp: compiled})
+	}
+	if c.Enabled != nil && !*c.Enabled {
+		return nil, nil
+	}
+	return processor, nil
+}
+
+type redactMatcher struct {
+	regexp *regexp.Regexp
+	// luhn - whether matches must pass the Luhn checksum, as card numbers do
+	luhn bool
+}
+
+// redactProcessor redacts the values of fields, then matches of sensitive data in every string value
+type redactProcessor struct {
+	fields   []string
+	matchers []redactMatcher
+	method   RedactMethod
+	mask     string
+	hashKey  []byte
+}
+
+func (p *redactProcessor) Process(document *Document, body map[string]interface{}) bool {
+	for _, path := range p.fields {
+		value, ok := lookup(body, path)
+		if !ok || value == nil {
+			continue
+		}
+		str, ok := value.(string)
+		if !ok {
+			encoded, _ := json.Marshal(value)
+			str = string(encoded)
+		}
+		store(body, path, p.redact(str))
+	}
+	if len(p.matchers) > 0 {
+		p.redactMatches(body)
+	}
+	return true
+}
+
+// redactMatches walks objects and arrays, replacing matches in their string values
+func (p *redactProcessor) redactMatches(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, elem := range v {
+			v[key] = p.redactMatches(elem)
+		}
+	case []interface{}:
+		for i, elem := range v {
+			v[i] = p.redactMatches(elem)
+		}
+	case string:
+		for _, matcher := range p.matchers {
+			v = matcher.regexp.ReplaceAllStringFunc(v, func(match string) string {
+				if matcher.luhn && !luhn(match) {
+					return match
+				}
+				return p.redact(match)
+			})
+		}
+		return v
+	}
+	return value
+}
+
+func (p *redactProcessor) redact(str string) string {
+	if p.method == Hash {
+		mac := hmac.New(sha256.New, p.hashKey)
+		mac.Write([]byte(str))
+		return hex.EncodeToString(mac.Sum(nil))
+	}
+	return p.mask
+}
+
+// luhn - whether the digits of str pass the Luhn checksum
+func luhn(str string) bool {
+	var (
+		sum    int
+		double bool
+	)
+	digits := strings.Map(func(r rune) rune {
+		if r < '0' || r > '9' {
+			return -1
+		}
+		return r
+	}, str)
+	for i := len(digits) - 1; i >= 0; i-- {
+		digit := int(digits[i] - '0')
+		if double {
+			digit *= 2
+			if digit > 9 {
+				digit -= 9
+			}
+		}
+		sum += digit
+		double = !double
+	}
+	return sum%10 == 0
+}
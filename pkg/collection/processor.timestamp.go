@@ -0,0 +1,114 @@
+package collection
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+)
+
+// formats of epoch timestamps
+const (
+	// Unix - seconds since epoch
+	Unix = "unix"
+	// UnixMs - milliseconds since epoch
+	UnixMs = "unix_ms"
+)
+
+// TimestampConfig - parse the time of the event a document describes into its postedAt
+type TimestampConfig struct {
+	Field  string `yaml:"field"`
+	Format string `yaml:"format"`
+	// Formats - fallbacks tried in order once Format did not parse
+	Formats []string `yaml:"formats"`
+	// Timezone - IANA location of times which do not tell their offset, UTC by default
+	Timezone string `yaml:"timezone"`
+	Keep     bool   `yaml:"keep"`
+}
+
+func (c *TimestampConfig) processor() (Processor, error) {
+	if c.Field == "" {
+		return nil, ErrMissingProcessorField
+	}
+	formats := make([]string, 0, 1+len(c.Formats))
+	if c.Format != "" {
+		formats = append(formats, c.Format)
+	}
+	formats = append(formats, c.Formats...)
+	if len(formats) == 0 {
+		formats = append(formats, time.RFC3339Nano)
+	}
+	location := time.UTC
+	if c.Timezone != "" {
+		var err error
+		location, err = time.LoadLocation(c.Timezone)
+		if err != nil {
+			return nil, ErrUnknownTimezone
+		}
+	}
+	return &timestampProcessor{c.Field, formats, location, c.Keep}, nil
+}
+
+// timestampProcessor sets the postedAt of documents from a field, which is removed unless kept;
+// documents whose field is missing or does not parse in any format keep the time they were collected at
+type timestampProcessor struct {
+	field    string
+	formats  []string
+	location *time.Location
+	keep     bool
+}
+
+func (p *timestampProcessor) Process(document *Document, body map[string]interface{}) bool {
+	value, ok := lookup(body, p.field)
+	if !ok {
+		return true
+	}
+	postedAt, ok := p.parse(value)
+	if !ok {
+		return true
+	}
+	document.PostedAt = postedAt.UTC()
+	if !p.keep {
+		remove(body, p.field)
+	}
+	return true
+}
+
+func (p *timestampProcessor) parse(value interface{}) (time.Time, bool) {
+	var str string
+	switch v := value.(type) {
+	case string:
+		str = v
+	case json.Number:
+		str = v.String()
+	default:
+		return time.Time{}, false
+	}
+	for _, format := range p.formats {
+		if postedAt, ok := p.parseAs(format, str); ok {
+			return postedAt, true
+		}
+	}
+	return time.Time{}, false
+}
+
+func (p *timestampProcessor) parseAs(format, str string) (time.Time, bool) {
+	switch format {
+	case Unix, UnixMs:
+		unit := time.Second
+		if format == UnixMs {
+			unit = time.Millisecond
+		}
+		// integers are parsed as such, so they do not lose precision
+		if epoch, err := strconv.ParseInt(str, 10, 64); err == nil {
+			return time.Unix(0, epoch*int64(unit)), true
+		}
+		epoch, err := strconv.ParseFloat(str, 64)
+		if err != nil {
+			return time.Time{}, false
+		}
+		return time.Unix(0, int64(epoch*float64(unit))), true
+	default:
+		postedAt, err := time.ParseInLocation(format, str, p.location)
+		return postedAt, err == nil
+	}
+}
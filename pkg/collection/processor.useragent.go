@@ -0,0 +1,206 @@
+package collection
+
+import (
+	"regexp"
+	"strings"
+)
+
+// UserAgentConfig - parse a user agent string into browser, OS and device fields
+type UserAgentConfig struct {
+	// Field - user_agent by default
+	Field string `yaml:"field"`
+	// Target - Field by default
+	Target string `yaml:"target"`
+}
+
+func (c *UserAgentConfig) processor() (Processor, error) {
+	field := c.Field
+	if field == "" {
+		field = "user_agent"
+	}
+	target := c.Target
+	if target == "" {
+		target = field
+	}
+	return &userAgentProcessor{field, target}, nil
+}
+
+// userAgentProcessor replaces a user agent string with the object it describes, fields which are not strings are left as is
+type userAgentProcessor struct {
+	field  string
+	target string
+}
+
+func (p *userAgentProcessor) Process(document *Document, body map[string]interface{}) bool {
+	value, ok := lookup(body, p.field)
+	if !ok {
+		return true
+	}
+	str, ok := value.(string)
+	if !ok || str == "" {
+		return true
+	}
+	if p.target != p.field {
+		remove(body, p.field)
+	}
+	store(body, p.target, parseUserAgent(str))
+	return true
+}
+
+// device types
+const (
+	deviceDesktop = "desktop"
+	deviceMobile  = "mobile"
+	deviceTablet  = "tablet"
+	deviceBot     = "bot"
+	deviceOther   = "other"
+)
+
+// uaRule - name of the client whose user agent matches re, re capturing its version
+type uaRule struct {
+	name string
+	re   *regexp.Regexp
+}
+
+var (
+	// botRules - crawlers and HTTP libraries, before browsers since some of them mimic browsers
+	botRules = []uaRule{
+		{"Googlebot", regexp.MustCompile(`Googlebot(?:-\w+)?/([\d.]+)`)},
+		{"Bingbot", regexp.MustCompile(`bingbot/([\d.]+)`)},
+		{"YandexBot", regexp.MustCompile(`YandexBot/([\d.]+)`)},
+		{"DuckDuckBot", regexp.MustCompile(`DuckDuckBot(?:-\w+)?/([\d.]+)`)},
+		{"Baiduspider", regexp.MustCompile(`Baiduspider(?:-\w+)?/([\d.]+)`)},
+		{"Applebot", regexp.MustCompile(`Applebot/([\d.]+)`)},
+		{"AhrefsBot", regexp.MustCompile(`AhrefsBot/([\d.]+)`)},
+		{"SemrushBot", regexp.MustCompile(`SemrushBot/([\d.~a-z]+)`)},
+		{"facebookexternalhit", regexp.MustCompile(`facebookexternalhit/([\d.]+)`)},
+		{"Twitterbot", regexp.MustCompile(`Twitterbot/([\d.]+)`)},
+		{"Slackbot", regexp.MustCompile(`Slackbot(?:-LinkExpanding)? ([\d.]+)`)},
+		{"curl", regexp.MustCompile(`^curl/([\d.]+)`)},
+		{"Wget", regexp.MustCompile(`^Wget/([\d.]+)`)},
+		{"python-requests", regexp.MustCompile(`python-requests/([\d.]+)`)},
+		{"Go-http-client", regexp.MustCompile(`Go-http-client/([\d.]+)`)},
+		{"okhttp", regexp.MustCompile(`okhttp/([\d.]+)`)},
+		{"Apache-HttpClient", regexp.MustCompile(`Apache-HttpClient/([\d.]+)`)},
+		{"PostmanRuntime", regexp.MustCompile(`PostmanRuntime/([\d.]+)`)},
+	}
+	// anyBot - crawlers which are not known by name
+	anyBot = regexp.MustCompile(`(?i)bot\b|crawl|spider|slurp|headless`)
+	// browserRules - in order, since browsers mention the engines they are built on
+	browserRules = []uaRule{
+		{"Edge", regexp.MustCompile(`Edg(?:e|A|iOS)?/([\d.]+)`)},
+		{"Opera", regexp.MustCompile(`(?:OPR|OPiOS)/([\d.]+)`)},
+		{"Samsung Internet", regexp.MustCompile(`SamsungBrowser/([\d.]+)`)},
+		{"Yandex Browser", regexp.MustCompile(`YaBrowser/([\d.]+)`)},
+		{"Vivaldi", regexp.MustCompile(`Vivaldi/([\d.]+)`)},
+		{"Firefox", regexp.MustCompile(`(?:Firefox|FxiOS)/([\d.]+)`)},
+		{"Chrome", regexp.MustCompile(`(?:Chrome|CriOS)/([\d.]+)`)},
+		{"Safari", regexp.MustCompile(`Version/([\d.]+).*Safari/`)},
+		{"Internet Explorer", regexp.MustCompile(`MSIE ([\d.]+)|Trident/.*rv:([\d.]+)`)},
+	}
+	windowsRe     = regexp.MustCompile(`Windows NT ([\d.]+)`)
+	iosRe         = regexp.MustCompile(`(?:iPhone|iPad|iPod).*? OS ([\d_]+)`)
+	macRe         = regexp.MustCompile(`Mac OS X ([\d_.]+)`)
+	androidRe     = regexp.MustCompile(`Android ([\d.]+)`)
+	chromeOSRe    = regexp.MustCompile(`CrOS \S+ ([\d.]+)`)
+	androidDevice = regexp.MustCompile(`Android [\d.]+; ([^;)]+?)(?: Build/[^;)]*)?\)`)
+	// windowsVersions - marketing names of NT versions
+	windowsVersions = map[string]string{
+		"10.0": "10", "6.3": "8.1", "6.2": "8", "6.1": "7", "6.0": "Vista", "5.2": "XP", "5.1": "XP",
+	}
+)
+
+// parseUserAgent renders the original string, name and version of the client, and its os and device when known
+func parseUserAgent(ua string) map[string]interface{} {
+	parsed := map[string]interface{}{"original": ua}
+	device := map[string]interface{}{}
+	osName, osVersion := parseOS(ua)
+	if osName != "" {
+		os := map[string]interface{}{"name": osName}
+		if osVersion != "" {
+			os["version"] = osVersion
+		}
+		parsed["os"] = os
+	}
+	name, version, isBot := parseClient(ua)
+	if name != "" {
+		parsed["name"] = name
+	}
+	if version != "" {
+		parsed["version"] = version
+	}
+	switch {
+	case isBot:
+		device["type"] = deviceBot
+	case strings.Contains(ua, "iPad") || strings.Contains(ua, "Tablet") || (osName == "Android" && !strings.Contains(ua, "Mobile")):
+		device["type"] = deviceTablet
+	case strings.Contains(ua, "Mobi") || strings.Contains(ua, "iPhone") || strings.Contains(ua, "iPod"):
+		device["type"] = deviceMobile
+	case osName == "Windows" || osName == "macOS" || osName == "Linux" || osName == "Chrome OS":
+		device["type"] = deviceDesktop
+	default:
+		device["type"] = deviceOther
+	}
+	switch {
+	case strings.Contains(ua, "iPhone"):
+		device["name"] = "iPhone"
+	case strings.Contains(ua, "iPad"):
+		device["name"] = "iPad"
+	case strings.Contains(ua, "iPod"):
+		device["name"] = "iPod"
+	case osName == "macOS":
+		device["name"] = "Mac"
+	default:
+		// reduced user agents tell K rather than the model
+		if m := androidDevice.FindStringSubmatch(ua); m != nil && m[1] != "K" {
+			device["name"] = strings.TrimSpace(m[1])
+		}
+	}
+	parsed["device"] = device
+	return parsed
+}
+
+func parseClient(ua string) (name, version string, isBot bool) {
+	for _, rule := range botRules {
+		if m := rule.re.FindStringSubmatch(ua); m != nil {
+			return rule.name, m[1], true
+		}
+	}
+	isBot = anyBot.MatchString(ua)
+	for _, rule := range browserRules {
+		if m := rule.re.FindStringSubmatch(ua); m != nil {
+			for _, group := range m[1:] {
+				if group != "" {
+					return rule.name, group, isBot
+				}
+			}
+			return rule.name, "", isBot
+		}
+	}
+	return "", "", isBot
+}
+
+func parseOS(ua string) (name, version string) {
+	if m := windowsRe.FindStringSubmatch(ua); m != nil {
+		if marketing, ok := windowsVersions[m[1]]; ok {
+			return "Windows", marketing
+		}
+		return "Windows", m[1]
+	}
+	if m := iosRe.FindStringSubmatch(ua); m != nil {
+		return "iOS", strings.ReplaceAll(m[1], "_", ".")
+	}
+	if m := macRe.FindStringSubmatch(ua); m != nil {
+		return "macOS", strings.ReplaceAll(m[1], "_", ".")
+	}
+	if m := androidRe.FindStringSubmatch(ua); m != nil {
+		return "Android", m[1]
+	}
+	if m := chromeOSRe.FindStringSubmatch(ua); m != nil {
+		return "Chrome OS", m[1]
+	}
+	if strings.Contains(ua, "Linux") {
+		return "Linux", ""
+	}
+	return "", ""
+}
@@ -0,0 +1,64 @@
+package collection
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Receipt - identity of an appended document, returned to the client which pushed it
+type Receipt struct {
+	ID       uuid.UUID `json:"id"`
+	PostedAt time.Time `json:"posted_at"`
+}
+
+// Receipts - receipts of the documents of a push, at the position of their body in it.
+// Documents which were not appended, such as dropped or duplicate ones, have none.
+type Receipts struct {
+	receipts []*Receipt
+}
+
+// NewReceipts - receipts of a push of n documents
+func NewReceipts(n int) *Receipts {
+	return &Receipts{make([]*Receipt, n)}
+}
+
+// Get returns the receipt of the document at position i, nil if it has none
+func (r *Receipts) Get(i int) *Receipt {
+	if i < 0 || i >= len(r.receipts) {
+		return nil
+	}
+	return r.receipts[i]
+}
+
+// set records the receipt of doc, at position i
+func (r *Receipts) set(i int, doc *Document) {
+	if i < 0 || i >= len(r.receipts) {
+		return
+	}
+	r.receipts[i] = &Receipt{doc.ID, doc.PostedAt}
+}
+
+type receiptsContext struct{}
+
+// WithReceipts returns a copy of ctx in which documents collected record their receipt
+func WithReceipts(ctx context.Context, receipts *Receipts) context.Context {
+	return context.WithValue(ctx, receiptsContext{}, receipts)
+}
+
+// RecordReceipts records the receipts of appended documents in the receipts ctx carries, if any.
+// positions - positions of the bodies of documents in the push, by document ID, in order since clients may supply the same ID twice;
+// documents it does not know, such as rerouted copies, are skipped.
+func RecordReceipts(ctx context.Context, positions map[uuid.UUID][]int, documents []Document) {
+	receipts, ok := ctx.Value(receiptsContext{}).(*Receipts)
+	if !ok {
+		return
+	}
+	for i := range documents {
+		if pending := positions[documents[i].ID]; len(pending) > 0 {
+			receipts.set(pending[0], &documents[i])
+			positions[documents[i].ID] = pending[1:]
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package collection
+
+import (
+	"fmt"
+
+	"github.com/google/uuid"
+)
+
+// RerouteConfig - documents matching all conditions are appended to Collection, instead of their own unless copied
+type RerouteConfig struct {
+	When       []string `yaml:"when"`
+	Collection Name     `yaml:"collection"`
+	Copy       bool     `yaml:"copy"`
+}
+
+// Reroute - documents matching all conditions are appended to Collection, a reroute without conditions matches every document
+type Reroute struct {
+	conditions []condition
+	Collection Name
+	// Copy - a copy of documents is appended to Collection, they are still appended to their own
+	Copy bool
+}
+
+// Reroutes - extract reroutes from config, in order
+func (c *Config) Reroutes() ([]Reroute, error) {
+	reroutes := make([]Reroute, 0, len(c.ReroutesCfg))
+	for i, rerouteCfg := range c.ReroutesCfg {
+		if rerouteCfg.Collection == "" || rerouteCfg.Collection == c.Name {
+			return nil, fmt.Errorf("reroute[%d].%s", i, ErrWrongReroute)
+		}
+		conditions, err := parseConditions(rerouteCfg.When)
+		if err != nil {
+			return nil, fmt.Errorf("reroute[%d].%s", i, err)
+		}
+		reroutes = append(reroutes, Reroute{
+			conditions: conditions,
+			Collection: rerouteCfg.Collection,
+			Copy:       rerouteCfg.Copy,
+		})
+	}
+	return reroutes, nil
+}
+
+// Reroute returns documents along with the copies reroutes make of them, each bound to the collection it is appended to.
+// Reroutes are evaluated in order: documents are copied by every copy they match and moved by the first other one, which ends the evaluation.
+// Copies are documents of their own, with a new ID. Documents which are not JSON objects stay in the collection.
+func (c *Collection) Reroute(documents []Document) []Document {
+	if len(c.Reroutes) == 0 {
+		return documents
+	}
+	rerouted := make([]Document, 0, len(documents))
+	for _, doc := range documents {
+		body, err := parseBody(doc.Body)
+		if err != nil {
+			rerouted = append(rerouted, doc)
+			continue
+		}
+		for i := range c.Reroutes {
+			reroute := &c.Reroutes[i]
+			if !matchAll(reroute.conditions, body) {
+				continue
+			}
+			if reroute.Copy {
+				copied := doc
+				copied.ID = uuid.New()
+				copied.CollectionName = reroute.Collection
+				rerouted = append(rerouted, copied)
+				continue
+			}
+			doc.CollectionName = reroute.Collection
+			break
+		}
+		rerouted = append(rerouted, doc)
+	}
+	return rerouted
+}
@@ -0,0 +1,117 @@
+package collection
+
+import "fmt"
+
+// RouteConfig - outputs which documents matching all conditions are conveyed to
+type RouteConfig struct {
+	When    []string `yaml:"when"`
+	Outputs []string `yaml:"outputs"`
+}
+
+// Route - documents matching all conditions are conveyed to outputs only, a route without conditions matches every document
+type Route struct {
+	conditions []condition
+	Outputs    []string
+}
+
+// Routes - extract routes from config, in order
+func (c *Config) Routes() ([]Route, error) {
+	routes := make([]Route, 0, len(c.RoutesCfg))
+	for i, routeCfg := range c.RoutesCfg {
+		if len(routeCfg.Outputs) == 0 {
+			return nil, fmt.Errorf("routes[%d].%s", i, ErrWrongRoute)
+		}
+		conditions, err := parseConditions(routeCfg.When)
+		if err != nil {
+			return nil, fmt.Errorf("routes[%d].%s", i, err)
+		}
+		routes = append(routes, Route{
+			conditions: conditions,
+			Outputs:    routeCfg.Outputs,
+		})
+	}
+	return routes, nil
+}
+
+// Route returns, by output name among outputNames, the documents routed to outputs.
+// Documents go to the outputs of their schema if it sets some, else by the first route they match;
+// documents which match none, or are not JSON objects, are routed to every output. Either way they also go to the also outputs of their schema.
+// Canary outputs receive the share of the documents routed to their output, which the output does not receive then.
+// It returns nil if the collection has neither routes, canaries nor schemas with outputs, every document is then routed to every output.
+func (c *Collection) Route(documents []Document, outputNames []string) map[string][]Document {
+	if len(c.Routes) == 0 && len(c.Canaries) == 0 && !c.schemasRouted() {
+		return nil
+	}
+	routed := make(map[string][]Document, len(outputNames))
+	for _, outputName := range outputNames {
+		routed[outputName] = make([]Document, 0, len(documents))
+	}
+	for _, doc := range documents {
+		targets := outputNames
+		schema := c.Schema(doc.SchemaName)
+		if schema != nil && len(schema.Outputs) > 0 {
+			targets = schema.Outputs
+		} else if route := c.route(doc); route != nil {
+			targets = route.Outputs
+		}
+		if schema != nil && len(schema.AlsoOutputs) > 0 {
+			targets = withOutputs(targets, schema.AlsoOutputs)
+		}
+		for _, outputName := range targets {
+			if c.isCanary(outputName) {
+				continue
+			}
+			if canary := c.canary(outputName); canary != nil && canary.selects(doc, documents[0]) {
+				outputName = canary.Canary
+			}
+			if _, ok := routed[outputName]; ok {
+				routed[outputName] = append(routed[outputName], doc)
+			}
+		}
+	}
+	return routed
+}
+
+// schemasRouted tells whether a schema of the collection sets outputs
+func (c *Collection) schemasRouted() bool {
+	for i := range c.Schemas {
+		if len(c.Schemas[i].Outputs) > 0 || len(c.Schemas[i].AlsoOutputs) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// withOutputs returns targets along with the outputs it does not list yet
+func withOutputs(targets, outputNames []string) []string {
+	merged := append(make([]string, 0, len(targets)+len(outputNames)), targets...)
+	for _, outputName := range outputNames {
+		listed := false
+		for _, target := range merged {
+			if target == outputName {
+				listed = true
+				break
+			}
+		}
+		if !listed {
+			merged = append(merged, outputName)
+		}
+	}
+	return merged
+}
+
+func (c *Collection) route(doc Document) *Route {
+	if len(c.Routes) == 0 {
+		return nil
+	}
+	body, err := parseBody(doc.Body)
+	if err != nil {
+		return nil
+	}
+	for i := range c.Routes {
+		if matchAll(c.Routes[i].conditions, body) {
+			return &c.Routes[i]
+		}
+	}
+	return nil
+}
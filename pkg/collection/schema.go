@@ -0,0 +1,129 @@
+package collection
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// ValidationPolicy - what to do with documents which do not conform to their schema
+type ValidationPolicy string
+
+const (
+	// ValidationOff accepts documents as they are, bulklog remains schema free
+	ValidationOff ValidationPolicy = "off"
+	// ValidationReject rejects non-conforming documents with ErrSchemaViolation
+	ValidationReject ValidationPolicy = "reject"
+	// ValidationTag accepts non-conforming documents, listing their violations in the ViolationsField
+	ValidationTag ValidationPolicy = "tag"
+)
+
+// ViolationsField - field holding the violations of documents tagged by the tag policy
+const ViolationsField = "_schema_violations"
+
+// SchemaViolation - a document does not conform to its schema
+type SchemaViolation struct {
+	Violations []string
+}
+
+func (v *SchemaViolation) Error() string {
+	return fmt.Sprintf("ErrSchemaViolation - %s", strings.Join(v.Violations, ", "))
+}
+
+// Validate lists the fields of the body which do not conform to the schema, sorted by field name.
+// Fields the schema does not define are allowed, null fields are missing ones.
+func (s *Schema) Validate(body map[string]interface{}) []string {
+	violations := make([]string, 0)
+	for key, field := range s.Fields {
+		value, ok := body[key]
+		if !ok || value == nil {
+			if field.Required {
+				violations = append(violations, fmt.Sprintf("%s: required", key))
+			}
+			continue
+		}
+		if reason := field.validate(value); reason != "" {
+			violations = append(violations, fmt.Sprintf("%s: %s", key, reason))
+		}
+	}
+	sort.Strings(violations)
+	return violations
+}
+
+// validate - why the value does not conform to the field, empty if it does
+func (f *Field) validate(value interface{}) string {
+	switch f.Type {
+	case Bool:
+		if _, ok := value.(bool); !ok {
+			return "expected bool"
+		}
+	case UInt8, UInt16, UInt32, UInt64:
+		number, ok := value.(json.Number)
+		if !ok {
+			return fmt.Sprintf("expected %s", f.Type)
+		}
+		if _, err := strconv.ParseUint(number.String(), 10, bitSize(f.Type)); err != nil {
+			return fmt.Sprintf("expected %s", f.Type)
+		}
+	case Int8, Int16, Int32, Int64:
+		number, ok := value.(json.Number)
+		if !ok {
+			return fmt.Sprintf("expected %s", f.Type)
+		}
+		if _, err := strconv.ParseInt(number.String(), 10, bitSize(f.Type)); err != nil {
+			return fmt.Sprintf("expected %s", f.Type)
+		}
+	case Float32, Float64:
+		number, ok := value.(json.Number)
+		if !ok {
+			return fmt.Sprintf("expected %s", f.Type)
+		}
+		float, err := number.Float64()
+		if err != nil || (f.Type == Float32 && math.Abs(float) > math.MaxFloat32) {
+			return fmt.Sprintf("expected %s", f.Type)
+		}
+	case String:
+		str, ok := value.(string)
+		if !ok {
+			return "expected string"
+		}
+		length := utf8.RuneCountInString(str)
+		if f.Length > 0 && length != f.Length {
+			return fmt.Sprintf("length must be %d", f.Length)
+		}
+		if f.MaxLength > 0 && length > f.MaxLength {
+			return fmt.Sprintf("length must be at most %d", f.MaxLength)
+		}
+	case DateTime:
+		str, ok := value.(string)
+		if !ok {
+			return "expected datetime"
+		}
+		if _, err := time.Parse(f.DateFormat, str); err != nil {
+			return fmt.Sprintf("expected datetime formatted as %s", f.DateFormat)
+		}
+	case Object:
+		if _, ok := value.(map[string]interface{}); !ok {
+			return "expected object"
+		}
+	}
+	return ""
+}
+
+func bitSize(fieldType FieldType) int {
+	switch fieldType {
+	case UInt8, Int8:
+		return 8
+	case UInt16, Int16:
+		return 16
+	case UInt32, Int32:
+		return 32
+	default:
+		return 64
+	}
+}
@@ -0,0 +1,59 @@
+package collection
+
+// SerializationConfig - how documents are buffered, and how outputs publishing them as messages deliver their bodies
+type SerializationConfig struct {
+	// Storage - protobuf|msgpack|json|gob, protobuf by default
+	Storage StorageFormat `yaml:"storage"`
+	// Delivery - json|msgpack, json by default
+	Delivery DeliveryFormat `yaml:"delivery"`
+}
+
+// StorageFormat - encoding of the documents buffered by persistent engines
+type StorageFormat string
+
+const (
+	// ProtobufStorage - compact binary messages, each one checksummed
+	ProtobufStorage StorageFormat = "protobuf"
+	// MsgpackStorage - MessagePack arrays, each one checksummed
+	MsgpackStorage StorageFormat = "msgpack"
+	// JSONStorage - JSON objects, readable with redis-cli or a text editor
+	JSONStorage StorageFormat = "json"
+	// GobStorage - Go gob streams, as buffered by older versions
+	GobStorage StorageFormat = "gob"
+)
+
+// DeliveryFormat - encoding of the document bodies published by message outputs
+type DeliveryFormat string
+
+const (
+	// JSONDelivery - bodies are delivered as they were collected
+	JSONDelivery DeliveryFormat = "json"
+	// MsgpackDelivery - bodies are converted to MessagePack maps
+	MsgpackDelivery DeliveryFormat = "msgpack"
+)
+
+// Serialization - storage and delivery formats of a collection
+type Serialization struct {
+	Storage  StorageFormat
+	Delivery DeliveryFormat
+}
+
+// Serialization - extract serialization from config, protobuf storage and json delivery by default
+func (c *Config) Serialization() (Serialization, error) {
+	serialization := Serialization(c.SerializationCfg)
+	switch serialization.Storage {
+	case "":
+		serialization.Storage = ProtobufStorage
+	case ProtobufStorage, MsgpackStorage, JSONStorage, GobStorage:
+	default:
+		return serialization, ErrUnsupportedStorageFormat
+	}
+	switch serialization.Delivery {
+	case "":
+		serialization.Delivery = JSONDelivery
+	case JSONDelivery, MsgpackDelivery:
+	default:
+		return serialization, ErrUnsupportedDeliveryFormat
+	}
+	return serialization, nil
+}
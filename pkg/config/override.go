@@ -0,0 +1,321 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// EnvPrefix prefixes environment variables overriding config fields
+const EnvPrefix = "BULKLOG_"
+
+var (
+	// ErrUnknownOverride - environment variable or flag matches no config field
+	ErrUnknownOverride = errors.New("ErrUnknownOverride - no config field matches this override")
+	// ErrUnsupportedOverride - config field cannot be set from a string
+	ErrUnsupportedOverride = errors.New("ErrUnsupportedOverride - this config field cannot be overridden")
+)
+
+// Override sets config fields from environment variables, then from command line flags,
+// so flags take precedence over environment variables which take precedence over the config file.
+//
+// Fields are named after their yaml path: persistence.redis.endpoint is overridden by
+// the BULKLOG_PERSISTENCE_REDIS_ENDPOINT environment variable and the --persistence.redis.endpoint flag.
+// Map entries and collections are named by their key, e.g. collections.logs.flush_period.
+// Lists are comma separated. Setting a field of an output which is not configured adds it.
+func (c *Config) Override(environ, args []string) error {
+	root := reflect.ValueOf(c).Elem()
+	for _, variable := range environ {
+		if !strings.HasPrefix(variable, EnvPrefix) {
+			continue
+		}
+		name, value, _ := strings.Cut(variable, "=")
+		path := strings.ToLower(strings.TrimPrefix(name, EnvPrefix))
+		err := override(root, path, "_", value)
+		if err != nil {
+			return fmt.Errorf("(%s).%s", name, err)
+		}
+	}
+	flags, err := parseFlags(args)
+	if err != nil {
+		return fmt.Errorf("parseFlags.%s", err)
+	}
+	for _, f := range flags {
+		err = override(root, f.name, ".", f.value)
+		if err != nil {
+			return fmt.Errorf("(--%s).%s", f.name, err)
+		}
+	}
+	return nil
+}
+
+type flag struct {
+	name  string
+	value string
+}
+
+// parseFlags reads --name=value, --name value and -name=value flags;
+// a flag without a value, such as --health.ping_outputs, is true.
+func parseFlags(args []string) ([]flag, error) {
+	flags := make([]flag, 0, len(args))
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		name, value, ok := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if !strings.HasPrefix(arg, "-") || name == "" {
+			return nil, fmt.Errorf("(%s).%s", arg, ErrUnknownOverride)
+		}
+		if !ok {
+			value = "true"
+			if i+1 < len(args) && !strings.HasPrefix(args[i+1], "-") {
+				i++
+				value = args[i]
+			}
+		}
+		flags = append(flags, flag{name, value})
+	}
+	return flags, nil
+}
+
+// override sets the field of v at path, whose segments are joined by sep
+func override(v reflect.Value, path, sep, value string) error {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.Type().Elem().Kind() != reflect.Struct {
+			break
+		}
+		elem := v
+		if v.IsNil() {
+			elem = reflect.New(v.Type().Elem())
+		}
+		err := override(elem.Elem(), path, sep, value)
+		if err == nil && v.IsNil() {
+			v.Set(elem)
+		}
+		return err
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			name := yamlName(field)
+			if name == "" {
+				continue
+			}
+			rest, ok := cutSegment(path, name, sep)
+			if !ok {
+				continue
+			}
+			var err error
+			if rest == "" {
+				err = setValue(v.Field(i), value)
+			} else {
+				err = override(v.Field(i), rest, sep, value)
+			}
+			if err != ErrUnknownOverride {
+				return err
+			}
+		}
+		return ErrUnknownOverride
+	case reflect.Map:
+		return overrideMap(v, path, sep, value)
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Struct {
+			return overrideSlice(v, path, sep, value)
+		}
+	}
+	return ErrUnknownOverride
+}
+
+// overrideMap sets a map entry, existing keys are matched first
+func overrideMap(v reflect.Value, path, sep, value string) error {
+	var (
+		keyType  = v.Type().Key()
+		elemType = v.Type().Elem()
+		keys     = make([]string, 0, v.Len())
+	)
+	if keyType.Kind() != reflect.String {
+		return ErrUnsupportedOverride
+	}
+	for _, key := range v.MapKeys() {
+		keys = append(keys, key.String())
+	}
+	// longest first, so a key is not shadowed by another one it starts with
+	sort.Slice(keys, func(i, j int) bool {
+		return len(keys[i]) > len(keys[j])
+	})
+	set := func(key, rest string) error {
+		elem := reflect.New(elemType).Elem()
+		mapKey := reflect.ValueOf(key).Convert(keyType)
+		if current := v.MapIndex(mapKey); current.IsValid() {
+			elem.Set(current)
+		}
+		var err error
+		if rest == "" {
+			err = setValue(elem, value)
+		} else {
+			err = override(elem, rest, sep, value)
+		}
+		if err != nil {
+			return err
+		}
+		if v.IsNil() {
+			v.Set(reflect.MakeMap(v.Type()))
+		}
+		v.SetMapIndex(mapKey, elem)
+		return nil
+	}
+	leaf := isLeaf(elemType)
+	for _, key := range keys {
+		rest, ok := cutSegment(path, strings.ToLower(key), sep)
+		if !ok || (leaf && rest != "") || (!leaf && rest == "") {
+			continue
+		}
+		err := set(key, rest)
+		if err != ErrUnknownOverride {
+			return err
+		}
+	}
+	if leaf {
+		return set(path, "")
+	}
+	for i := strings.Index(path, sep); i > 0; i = nextIndex(path, sep, i) {
+		err := set(path[:i], path[i+len(sep):])
+		if err != ErrUnknownOverride {
+			return err
+		}
+	}
+	return ErrUnknownOverride
+}
+
+// overrideSlice sets a field of the slice element named after the path first segment
+func overrideSlice(v reflect.Value, path, sep, value string) error {
+	nameField, ok := namedBy(v.Type().Elem())
+	if !ok {
+		return ErrUnsupportedOverride
+	}
+	for i := 0; i < v.Len(); i++ {
+		name := strings.ToLower(v.Index(i).Field(nameField).String())
+		rest, ok := cutSegment(path, name, sep)
+		if !ok || rest == "" {
+			continue
+		}
+		err := override(v.Index(i), rest, sep, value)
+		if err != ErrUnknownOverride {
+			return err
+		}
+	}
+	return ErrUnknownOverride
+}
+
+func setValue(v reflect.Value, value string) error {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.Type().Elem().Kind() == reflect.Struct {
+			return ErrUnknownOverride
+		}
+		elem := reflect.New(v.Type().Elem())
+		err := setValue(elem.Elem(), value)
+		if err != nil {
+			return err
+		}
+		v.Set(elem)
+	case reflect.String:
+		v.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("strconv.ParseBool.%s", err)
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(value, 10, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("strconv.ParseInt.%s", err)
+		}
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(value, 10, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("strconv.ParseUint.%s", err)
+		}
+		v.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(value, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("strconv.ParseFloat.%s", err)
+		}
+		v.SetFloat(f)
+	case reflect.Slice:
+		if !isLeaf(v.Type().Elem()) {
+			return ErrUnknownOverride
+		}
+		items := strings.Split(value, ",")
+		slice := reflect.MakeSlice(v.Type(), len(items), len(items))
+		for i, item := range items {
+			err := setValue(slice.Index(i), strings.TrimSpace(item))
+			if err != nil {
+				return err
+			}
+		}
+		v.Set(slice)
+	case reflect.Struct, reflect.Map:
+		return ErrUnknownOverride
+	default:
+		return ErrUnsupportedOverride
+	}
+	return nil
+}
+
+// yamlName returns the yaml key of a struct field, empty if it is not unmarshaled
+func yamlName(field reflect.StructField) string {
+	if field.PkgPath != "" {
+		return ""
+	}
+	name, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+	switch name {
+	case "-":
+		return ""
+	case "":
+		return strings.ToLower(field.Name)
+	}
+	return name
+}
+
+// namedBy returns the index of the name field of list elements, such as collections
+func namedBy(t reflect.Type) (int, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		if yamlName(t.Field(i)) == "name" && t.Field(i).Type.Kind() == reflect.String {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+func isLeaf(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Struct, reflect.Map:
+		return false
+	case reflect.Ptr, reflect.Slice:
+		return isLeaf(t.Elem())
+	}
+	return true
+}
+
+func cutSegment(path, name, sep string) (string, bool) {
+	if path == name {
+		return "", true
+	}
+	if strings.HasPrefix(path, name+sep) {
+		return path[len(name)+len(sep):], true
+	}
+	return "", false
+}
+
+func nextIndex(path, sep string, i int) int {
+	j := strings.Index(path[i+len(sep):], sep)
+	if j < 0 {
+		return -1
+	}
+	return i + len(sep) + j
+}
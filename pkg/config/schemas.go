@@ -1,29 +1,414 @@
 package config
 
 import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/khezen/bulklog/pkg/auth"
 	"github.com/khezen/bulklog/pkg/collection"
+	"github.com/khezen/bulklog/pkg/encryption"
+	"github.com/khezen/bulklog/pkg/input"
+	"github.com/khezen/bulklog/pkg/log"
 	"github.com/khezen/bulklog/pkg/output"
+	"github.com/khezen/bulklog/pkg/ratelimit"
+	"github.com/khezen/bulklog/pkg/tenant"
+	"github.com/khezen/bulklog/pkg/trace"
+)
+
+var (
+	// ErrWrongReloadInterval - reload interval must be positive
+	ErrWrongReloadInterval = errors.New("ErrWrongReloadInterval - reload interval must be positive")
+	// ErrWrongClockSkewTolerance - clock skew tolerance cannot be negative
+	ErrWrongClockSkewTolerance = errors.New("ErrWrongClockSkewTolerance - clock_skew_tolerance must not be negative")
+	// ErrWrongAppendBatch - append batches cannot wait, nor hold, less than nothing
+	ErrWrongAppendBatch = errors.New("ErrWrongAppendBatch - append_batch max_wait and max_documents must not be negative")
+	// ErrWrongExpiryNotice - pipes would be notified after they expire
+	ErrWrongExpiryNotice = errors.New("ErrWrongExpiryNotice - notice must be positive")
+	// ErrMissingWebhookURL - events have nowhere to be posted
+	ErrMissingWebhookURL = errors.New("ErrMissingWebhookURL - webhook requires url")
 )
 
 // Config contains all configuration for the logger
 type Config struct {
 	Port        int                 `yaml:"port"`
+	GRPC        GRPC                `yaml:"grpc"`
+	TLS         TLS                 `yaml:"tls"`
+	Auth        auth.VerifierConfig `yaml:"auth"`
+	RateLimit   ratelimit.Config    `yaml:"rate_limit"`
+	Body        Body                `yaml:"body"`
+	Tenancy     tenant.Config       `yaml:"tenancy"`
+	Log         log.Config          `yaml:"log"`
+	Tracing     trace.Config        `yaml:"tracing"`
+	Health      Health              `yaml:"health"`
+	Admin       Admin               `yaml:"admin"`
+	Reload      Reload              `yaml:"reload"`
 	Persistence Persistence         `yaml:"persistence"`
+	DeadLetter  DeadLetter          `yaml:"dead_letter"`
+	PipeExpiry  PipeExpiry          `yaml:"pipe_expiry"`
 	Output      output.Config       `yaml:"output"`
+	Input       input.Config        `yaml:"input"`
 	Collections []collection.Config `yaml:"collections,flow"`
+	AutoCreate  AutoCreate          `yaml:"auto_create"`
+}
+
+// AutoCreate - collections created on the fly from a template, for documents posted to unknown collections
+type AutoCreate struct {
+	Enabled bool `yaml:"enabled"`
+	// Template - settings of created collections, which are named after the collection documents are posted to
+	Template collection.Config `yaml:"template"`
+	// MaxCollections bounds how many collections are created, unbounded if 0
+	MaxCollections int `yaml:"max_collections"`
+}
+
+// Of - settings of a collection created on the fly
+func (a AutoCreate) Of(name collection.Name) collection.Config {
+	collecCfg := a.Template
+	collecCfg.Name = name
+	return collecCfg
+}
+
+// Body - bounds and media types of request bodies of the push endpoints
+type Body struct {
+	// MaxSize - bytes, both as received and once decompressed, 100MiB by default; collections may override it
+	MaxSize int64 `yaml:"max_size"`
+	// StrictContentType - bodies must be sent as application/json or application/x-ndjson, whatever Content-Type otherwise
+	StrictContentType bool `yaml:"strict_content_type"`
+}
+
+// GRPC - gRPC ingestion server, served over cleartext HTTP/2 unless TLS is set
+type GRPC struct {
+	Enabled bool `yaml:"enabled"`
+	// Port defaults to 5018
+	Port int `yaml:"port"`
+}
+
+// TLS - server side TLS of the HTTP and gRPC ingestion servers, which are plaintext unless cert_file is set
+type TLS struct {
+	CertFile string `yaml:"cert_file"`
+	KeyFile  string `yaml:"key_file"`
+	// ClientCAFile holds the CAs client certificates are verified against, for mutual TLS
+	ClientCAFile string     `yaml:"client_ca_file"`
+	ClientAuth   ClientAuth `yaml:"client_auth"`
+}
+
+// Enabled tells whether servers are served over TLS
+func (t TLS) Enabled() bool {
+	return t.CertFile != "" || t.KeyFile != ""
+}
+
+// ClientAuth - client certificate policy once client_ca_file is set
+type ClientAuth string
+
+const (
+	// RequireClientCert rejects clients without a valid certificate, this is the default
+	RequireClientCert ClientAuth = "require"
+	// VerifyClientCertIfGiven rejects clients with an invalid certificate only
+	VerifyClientCertIfGiven ClientAuth = "verify_if_given"
+)
+
+// Admin - admin API, served along with ingestion unless listen is set
+type Admin struct {
+	// Listen - address of a listener dedicated to the admin API, e.g. 127.0.0.1:5019, which the ingestion port does not serve then
+	Listen string `yaml:"listen"`
+}
+
+// Health - readiness checks settings
+type Health struct {
+	// PingOutputs adds the reachability of outputs which support it to readiness
+	PingOutputs bool `yaml:"ping_outputs"`
+}
+
+// Reload - hot reload of collections and outputs, on SIGHUP or config file change
+type Reload struct {
+	// Watch reloads the config whenever the content of the config file changes
+	Watch       bool   `yaml:"watch"`
+	IntervalStr string `yaml:"interval"`
+}
+
+const defaultReloadInterval = 10 * time.Second
+
+// Interval - how often the config file is checked for changes
+func (r Reload) Interval() (time.Duration, error) {
+	if r.IntervalStr == "" {
+		return defaultReloadInterval, nil
+	}
+	interval, err := collection.Period(r.IntervalStr)
+	if err != nil {
+		return 0, fmt.Errorf("collection.Period.%s", err)
+	}
+	if interval <= 0 {
+		return 0, ErrWrongReloadInterval
+	}
+	return interval, nil
 }
 
 // Persistence -
 type Persistence struct {
-	Enabled bool  `yaml:"enabled"`
-	Redis   Redis `yaml:"redis"`
+	Enabled bool   `yaml:"enabled"`
+	Engine  Engine `yaml:"engine"`
+	Redis   Redis  `yaml:"redis"`
+	Kafka   Kafka  `yaml:"kafka"`
+	Memory  Memory `yaml:"memory"`
+	Disk    Disk   `yaml:"disk"`
+	// Encryption of documents buffered in redis and on disk, loaded at startup
+	Encryption encryption.Config `yaml:"encryption"`
+	// Collections overrides engine settings per collection
+	Collections map[collection.Name]CollectionPersistence `yaml:"collections"`
+}
+
+// CollectionPersistence - engine of a collection, unset sections default to the global ones
+type CollectionPersistence struct {
+	Engine Engine  `yaml:"engine"`
+	Redis  *Redis  `yaml:"redis,omitempty"`
+	Kafka  *Kafka  `yaml:"kafka,omitempty"`
+	Memory *Memory `yaml:"memory,omitempty"`
+	Disk   *Disk   `yaml:"disk,omitempty"`
+}
+
+// Of returns the persistence settings of the given collection.
+// Setting an engine for a collection enables persistence for it.
+func (p Persistence) Of(name collection.Name) Persistence {
+	override, ok := p.Collections[name]
+	if !ok {
+		return p
+	}
+	if override.Engine != "" {
+		p.Enabled = true
+		p.Engine = override.Engine
+	}
+	if override.Redis != nil {
+		p.Redis = *override.Redis
+	}
+	if override.Kafka != nil {
+		p.Kafka = *override.Kafka
+	}
+	if override.Memory != nil {
+		p.Memory = *override.Memory
+	}
+	if override.Disk != nil {
+		p.Disk = *override.Disk
+	}
+	p.Collections = nil
+	return p
 }
 
+// Engine - buffering backend
+type Engine string
+
+const (
+	// RedisEngine buffers documents in redis lists
+	RedisEngine Engine = "redis"
+	// KafkaEngine buffers documents in kafka topics
+	KafkaEngine Engine = "kafka"
+	// MemoryEngine buffers documents in process memory
+	MemoryEngine Engine = "memory"
+	// DiskEngine buffers documents in write-ahead segment files
+	DiskEngine Engine = "disk"
+)
+
 // Redis - redis config
 type Redis struct {
 	Endpoint string `yaml:"endpoint"`
+	// Username authenticates as an ACL user with Password, Redis >= 6
+	Username string `yaml:"username"`
 	Password string `yaml:"password"`
 	DB       int    `yaml:"db"`
 	IdleConn int    `yaml:"idle_conn"`
 	MaxConn  int    `yaml:"max_conn"`
+	// Compression of buffered documents
+	Compression Compression `yaml:"compression"`
+	TLS         RedisTLS    `yaml:"tls"`
+	// Sentinel discovers the master through sentinels instead of dialing the endpoint
+	Sentinel *RedisSentinel `yaml:"sentinel,omitempty"`
+	// Cluster spreads collections over the nodes of a redis cluster instead of dialing the endpoint
+	Cluster *RedisCluster `yaml:"cluster,omitempty"`
+	// Clock - local|redis, time source of flushes and pipe creation times, local by default
+	Clock RedisClock `yaml:"clock"`
+	// ClockSkewToleranceStr - how far the clocks of instances may drift apart, 0 by default
+	ClockSkewToleranceStr string `yaml:"clock_skew_tolerance"`
+	// AppendBatch - documents appended concurrently to a buffer are pushed together
+	AppendBatch RedisAppendBatch `yaml:"append_batch"`
+}
+
+// RedisAppendBatch - appends gathered for up to MaxWait, or until they hold MaxDocuments, are pushed in one round trip
+type RedisAppendBatch struct {
+	// MaxWaitStr - 5 milliseconds by default, 0 pushes each append on its own
+	MaxWaitStr string `yaml:"max_wait"`
+	// MaxDocuments - 100 by default
+	MaxDocuments int `yaml:"max_documents"`
+}
+
+const (
+	defaultAppendBatchMaxWait      = 5 * time.Millisecond
+	defaultAppendBatchMaxDocuments = 100
+)
+
+// MaxWait - how long the first append of a batch waits for others
+func (a RedisAppendBatch) MaxWait() (time.Duration, error) {
+	if a.MaxWaitStr == "" {
+		return defaultAppendBatchMaxWait, nil
+	}
+	maxWait, err := collection.Period(a.MaxWaitStr)
+	if err != nil {
+		return 0, fmt.Errorf("collection.Period.%s", err)
+	}
+	if maxWait < 0 {
+		return 0, ErrWrongAppendBatch
+	}
+	return maxWait, nil
+}
+
+// Documents - how many documents a batch holds once it is pushed without waiting further
+func (a RedisAppendBatch) Documents() (int, error) {
+	switch {
+	case a.MaxDocuments < 0:
+		return 0, ErrWrongAppendBatch
+	case a.MaxDocuments == 0:
+		return defaultAppendBatchMaxDocuments, nil
+	default:
+		return a.MaxDocuments, nil
+	}
+}
+
+// RedisClock - time source of the instances sharing redis buffers
+type RedisClock string
+
+const (
+	// LocalClock - each instance reads its own clock, which should be kept in sync, e.g. by NTP
+	LocalClock RedisClock = "local"
+	// RedisTimeClock - instances read the clock of redis, with TIME, so that they agree on it
+	RedisTimeClock RedisClock = "redis"
+)
+
+// ClockSkewTolerance - flush periods are deemed over this long before they end, so that instances whose clocks lag behind do not delay flushes
+func (r *Redis) ClockSkewTolerance() (time.Duration, error) {
+	if r.ClockSkewToleranceStr == "" {
+		return 0, nil
+	}
+	tolerance, err := collection.Period(r.ClockSkewToleranceStr)
+	if err != nil {
+		return 0, fmt.Errorf("collection.Period.%s", err)
+	}
+	if tolerance < 0 {
+		return 0, ErrWrongClockSkewTolerance
+	}
+	return tolerance, nil
 }
+
+// RedisTLS - client side TLS of redis connections, sentinels included
+type RedisTLS struct {
+	Enabled bool `yaml:"enabled"`
+	// CAFile holds the CAs the server certificate is verified against, system ones otherwise
+	CAFile string `yaml:"ca_file"`
+	// CertFile and KeyFile hold the client certificate, for mutual TLS
+	CertFile string `yaml:"cert_file"`
+	KeyFile  string `yaml:"key_file"`
+	// ServerName defaults to the host dialed
+	ServerName         string `yaml:"server_name"`
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify"`
+}
+
+// RedisSentinel - sentinels monitoring the redis master
+type RedisSentinel struct {
+	// Master name the sentinels monitor
+	Master string   `yaml:"master"`
+	Addrs  []string `yaml:"addrs"`
+	// Password of the sentinels, the redis password authenticates against the master
+	Password string `yaml:"password"`
+}
+
+// RedisCluster - seed nodes of a redis cluster, the others are discovered from them
+type RedisCluster struct {
+	Addrs []string `yaml:"addrs"`
+}
+
+// Compression - codec of documents buffered in redis
+type Compression string
+
+const (
+	// NoCompression buffers base64 encoded documents
+	NoCompression Compression = "none"
+	// SnappyCompression buffers snappy compressed documents
+	SnappyCompression Compression = "snappy"
+	// GzipCompression buffers gzip compressed documents, smaller but slower than snappy
+	GzipCompression Compression = "gzip"
+	// ZstdCompression buffers zstd compressed documents
+	ZstdCompression Compression = "zstd"
+)
+
+// Kafka - kafka REST proxy config.
+// The buffer goes through the proxy rather than package kafka: its consumers keep a fetch position apart from committed offsets,
+// so flushes read past records still conveying while their offsets are committed later, in order, from conveyance goroutines.
+// The positions of kafka.Consumer only move on Commit, from the goroutine polling.
+type Kafka struct {
+	Endpoint    string            `yaml:"endpoint"`
+	Scheme      string            `yaml:"scheme"`
+	TopicPrefix string            `yaml:"topic_prefix"`
+	Group       string            `yaml:"group"`
+	BasicAuth   *auth.BasicConfig `yaml:"basic_auth,omitempty"`
+	// MaxFlushRecords - records a flush reads at most, 10000 by default
+	MaxFlushRecords int `yaml:"max_flush_records"`
+}
+
+// Memory - in-memory buffer config
+type Memory struct {
+	Capacity int `yaml:"capacity"`
+}
+
+// Disk - disk buffer config
+type Disk struct {
+	Directory string `yaml:"directory"`
+	Fsync     bool   `yaml:"fsync"`
+}
+
+// DeadLetter - destination of documents not delivered within retention period
+type DeadLetter struct {
+	Destination DeadLetterDestination `yaml:"destination"`
+	// Redis defaults to persistence redis config
+	Redis     *Redis `yaml:"redis,omitempty"`
+	KeyPrefix string `yaml:"key_prefix"`
+	Directory string `yaml:"directory"`
+	Output    string `yaml:"output"`
+}
+
+// PipeExpiry - events of pipes which outputs fail to digest as their retention period ends, they are logged and may be posted to a webhook
+type PipeExpiry struct {
+	// NoticeStr - how long before it expires a pipe is notified as expiring, pipes are only notified once expired unless set
+	NoticeStr string `yaml:"notice"`
+	// Webhook receives every event as a JSON POST
+	Webhook *PipeExpiryWebhook `yaml:"webhook,omitempty"`
+}
+
+// PipeExpiryWebhook - endpoint pipe expiry events are posted to
+type PipeExpiryWebhook struct {
+	URL     string            `yaml:"url"`
+	Headers map[string]string `yaml:"headers"`
+}
+
+// Notice - how long before it expires a pipe is notified as expiring, 0 if pipes are not
+func (p PipeExpiry) Notice() (time.Duration, error) {
+	if p.NoticeStr == "" {
+		return 0, nil
+	}
+	notice, err := collection.Period(p.NoticeStr)
+	if err != nil {
+		return 0, fmt.Errorf("collection.Period.%s", err)
+	}
+	if notice <= 0 {
+		return 0, ErrWrongExpiryNotice
+	}
+	return notice, nil
+}
+
+// DeadLetterDestination - dead letters backend
+type DeadLetterDestination string
+
+const (
+	// RedisDeadLetters stores dead letters in redis lists
+	RedisDeadLetters DeadLetterDestination = "redis"
+	// FileDeadLetters stores dead letters in local files
+	FileDeadLetters DeadLetterDestination = "file"
+	// OutputDeadLetters sends dead letters to a dedicated output
+	OutputDeadLetters DeadLetterDestination = "output"
+)
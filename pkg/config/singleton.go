@@ -25,12 +25,37 @@ func Get() (config *Config, err error) {
 	return singleton, nil
 }
 
-func loadConfig() (*Config, error) {
-	// where is config?
+// Load reads the config file again, so changes can be applied without a restart
+func Load() (config *Config, err error) {
+	config, err = loadConfig()
+	if err != nil {
+		return nil, fmt.Errorf("loadConfig.%s", err)
+	}
+	singleton = config
+	return config, nil
+}
+
+// Path of the config file, config.yaml in the CONFIG_PATH folder
+func Path() string {
 	configPath := strings.TrimRight(os.Getenv("CONFIG_PATH"), "/")
-	configFile := fmt.Sprintf("%s/config.yaml", configPath)
-	// Load config file
-	bytes, err := ioutil.ReadFile(configFile)
+	return fmt.Sprintf("%s/config.yaml", configPath)
+}
+
+// LoadFile reads and validates a config file as is, without environment and flag overrides
+func LoadFile(path string) (*Config, error) {
+	config, err := readFile(path)
+	if err != nil {
+		return nil, err
+	}
+	err = config.Validate()
+	if err != nil {
+		return nil, fmt.Errorf("Validate.\n%s", err)
+	}
+	return config, nil
+}
+
+func readFile(path string) (*Config, error) {
+	bytes, err := ioutil.ReadFile(path)
 	if err != nil {
 		return nil, fmt.Errorf("ioutil.ReadFile.%s", err)
 	}
@@ -41,3 +66,19 @@ func loadConfig() (*Config, error) {
 	}
 	return &config, nil
 }
+
+func loadConfig() (*Config, error) {
+	config, err := readFile(Path())
+	if err != nil {
+		return nil, err
+	}
+	err = config.Override(os.Environ(), os.Args[1:])
+	if err != nil {
+		return nil, fmt.Errorf("Override.%s", err)
+	}
+	err = config.Validate()
+	if err != nil {
+		return nil, fmt.Errorf("Validate.\n%s", err)
+	}
+	return config, nil
+}
@@ -0,0 +1,623 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/khezen/bulklog/pkg/auth"
+	"github.com/khezen/bulklog/pkg/collection"
+	"github.com/khezen/bulklog/pkg/output"
+	"github.com/khezen/bulklog/pkg/output/elastic"
+	"github.com/khezen/bulklog/pkg/tenant"
+)
+
+var (
+	// ErrMissingCollectionName - collection has no name
+	ErrMissingCollectionName = errors.New("ErrMissingCollectionName - collection name is required")
+	// ErrDuplicateCollection - collection name is used by a previous collection
+	ErrDuplicateCollection = errors.New("ErrDuplicateCollection - collection name is already used by another collection")
+	// ErrWrongFlushPeriod - documents of the collection would never be flushed
+	ErrWrongFlushPeriod = errors.New("ErrWrongFlushPeriod - flush_period must be positive, or flush_count or flush_bytes set")
+	// ErrRetentionShorterThanFlush - documents would expire before being flushed
+	ErrRetentionShorterThanFlush = errors.New("ErrRetentionShorterThanFlush - retention_period must be at least flush_period")
+	// ErrUnknownOutput - output type is not supported
+	ErrUnknownOutput = errors.New("ErrUnknownOutput - output type must be one of elasticsearch|opensearch|loki|s3|azure_blob|gcs|kafka|pulsar|pubsub|splunk|datadog|clickhouse|bigquery|postgres|syslog|otlp|webhooks|plugins")
+	// ErrUnknownEngine - persistence engine is not supported
+	ErrUnknownEngine = errors.New("ErrUnknownEngine - engine must be one of redis|kafka|memory|disk")
+	// ErrUnknownClock - redis clock is not supported
+	ErrUnknownClock = errors.New("ErrUnknownClock - clock must be one of local|redis")
+	// ErrUnknownCompression - redis compression is not supported
+	ErrUnknownCompression = errors.New("ErrUnknownCompression - compression must be one of none|snappy|gzip|zstd")
+	// ErrUsernameWithoutPassword - redis ACL users authenticate with a password
+	ErrUsernameWithoutPassword = errors.New("ErrUsernameWithoutPassword - redis username requires password")
+	// ErrRedisTopology - redis sentinel and cluster are both set
+	ErrRedisTopology = errors.New("ErrRedisTopology - redis sentinel and cluster are mutually exclusive")
+	// ErrMissingSentinelMaster - redis sentinel is incomplete
+	ErrMissingSentinelMaster = errors.New("ErrMissingSentinelMaster - redis sentinel requires master and addrs")
+	// ErrMissingClusterAddrs - redis cluster has no seed node
+	ErrMissingClusterAddrs = errors.New("ErrMissingClusterAddrs - redis cluster requires addrs")
+	// ErrClusterDB - redis cluster has a single database
+	ErrClusterDB = errors.New("ErrClusterDB - redis cluster only supports db 0")
+	// ErrUnknownDestination - dead letter destination is not supported
+	ErrUnknownDestination = errors.New("ErrUnknownDestination - destination must be one of redis|file|output")
+	// ErrUnknownCollection - settings are given for a collection which is not defined
+	ErrUnknownCollection = errors.New("ErrUnknownCollection - no collection has this name, these settings are never used")
+	// ErrUnknownSchema - settings are given for a schema which the collection does not define
+	ErrUnknownSchema = errors.New("ErrUnknownSchema - the collection has no schema with this name")
+	// ErrUndefinedOutput - dead letter output is not configured
+	ErrUndefinedOutput = errors.New("ErrUndefinedOutput - output is not configured")
+	// ErrMissingKeyPair - tls is given a certificate without key or a key without certificate
+	ErrMissingKeyPair = errors.New("ErrMissingKeyPair - tls requires both cert_file and key_file")
+	// ErrUnknownClientAuth - client certificate policy is not supported
+	ErrUnknownClientAuth = errors.New("ErrUnknownClientAuth - client_auth must be one of require|verify_if_given")
+	// ErrClientAuthWithoutCA - client certificates cannot be verified
+	ErrClientAuthWithoutCA = errors.New("ErrClientAuthWithoutCA - client_auth requires client_ca_file")
+	// ErrMissingAPIKey - api key has no value
+	ErrMissingAPIKey = errors.New("ErrMissingAPIKey - api key is required")
+	// ErrDuplicateAPIKey - api key is used by a previous entry
+	ErrDuplicateAPIKey = errors.New("ErrDuplicateAPIKey - api key is already used by another entry")
+	// ErrWrongMaxCollections - auto created collections bound is invalid
+	ErrWrongMaxCollections = errors.New("ErrWrongMaxCollections - max_collections must be >= 0")
+	// ErrDottedCollectionName - collection name would clash with the collection of a tenant
+	ErrDottedCollectionName = errors.New("ErrDottedCollectionName - collection names must not contain dots when tenancy is enabled, {tenant}.{collection} names tenant collections")
+	// ErrUnexpandedPlaceholder - value still holds an environment placeholder
+	ErrUnexpandedPlaceholder = errors.New("ErrUnexpandedPlaceholder - ${...} placeholders are not expanded, use BULKLOG_ environment variables instead")
+)
+
+// FieldError - invalid config field
+type FieldError struct {
+	// Path of the field, such as collections[1].flush_period
+	Path string
+	Err  error
+}
+
+func (e FieldError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Path, e.Err)
+}
+
+// ValidationError - every invalid field of a config
+type ValidationError []FieldError
+
+func (e ValidationError) Error() string {
+	messages := make([]string, 0, len(e))
+	for _, fieldErr := range e {
+		messages = append(messages, fieldErr.Error())
+	}
+	return strings.Join(messages, "\n")
+}
+
+// Validate checks the config before the engine starts.
+// It returns a ValidationError listing every invalid field, nil if the config is valid.
+func (c *Config) Validate() error {
+	var errs ValidationError
+	report := func(path string, err error) {
+		errs = append(errs, FieldError{path, err})
+	}
+	names := make(map[collection.Name]struct{}, len(c.Collections))
+	for i := range c.Collections {
+		collecCfg := &c.Collections[i]
+		path := fmt.Sprintf("collections[%d]", i)
+		if collecCfg.Name == "" {
+			report(path+".name", ErrMissingCollectionName)
+		} else if _, ok := names[collecCfg.Name]; ok {
+			report(path+".name", ErrDuplicateCollection)
+		}
+		names[collecCfg.Name] = struct{}{}
+		if c.Tenancy.Enabled && strings.Contains(string(collecCfg.Name), ".") {
+			report(path+".name", ErrDottedCollectionName)
+		}
+		validateCollection(collecCfg, path, report)
+	}
+	if c.AutoCreate.Enabled {
+		template := c.AutoCreate.Of("template")
+		validateCollection(&template, "auto_create.template", report)
+	}
+	if c.AutoCreate.MaxCollections < 0 {
+		report("auto_create.max_collections", ErrWrongMaxCollections)
+	}
+	for name := range c.Persistence.Collections {
+		if _, ok := names[name]; !ok {
+			report(fmt.Sprintf("persistence.collections.%s", name), ErrUnknownCollection)
+		}
+	}
+	validateEngine(c.Persistence.Engine, "persistence.engine", report)
+	validateRedis(&c.Persistence.Redis, "persistence.redis", report)
+	if err := c.Persistence.Encryption.Validate(); err != nil {
+		report("persistence.encryption", err)
+	}
+	for name, override := range c.Persistence.Collections {
+		validateEngine(override.Engine, fmt.Sprintf("persistence.collections.%s.engine", name), report)
+		if override.Redis != nil {
+			validateRedis(override.Redis, fmt.Sprintf("persistence.collections.%s.redis", name), report)
+		}
+	}
+	validateDeadLetter(c, report)
+	validateOutputs(&c.Output, names, report)
+	for i := range c.Collections {
+		validateRoutes(c.Collections[i].RoutesCfg, &c.Output, fmt.Sprintf("collections[%d]", i), report)
+		validateSchemaOutputs(c.Collections[i].SchemasCfg, &c.Output, fmt.Sprintf("collections[%d]", i), report)
+		validateCanaries(c.Collections[i].CanariesCfg, &c.Output, fmt.Sprintf("collections[%d]", i), report)
+		validateReroutes(c, &c.Collections[i], fmt.Sprintf("collections[%d]", i), report)
+	}
+	if c.AutoCreate.Enabled {
+		validateRoutes(c.AutoCreate.Template.RoutesCfg, &c.Output, "auto_create.template", report)
+		validateSchemaOutputs(c.AutoCreate.Template.SchemasCfg, &c.Output, "auto_create.template", report)
+		validateCanaries(c.AutoCreate.Template.CanariesCfg, &c.Output, "auto_create.template", report)
+	}
+	validateInputs(c, report)
+	validateTLS(c.TLS, report)
+	if c.Body.MaxSize < 0 {
+		report("body.max_size", collection.ErrLengthLowerThanZero)
+	}
+	validateAuth(&c.Auth, names, report)
+	if err := c.RateLimit.Validate(); err != nil {
+		report("rate_limit", err)
+	}
+	if err := c.Tenancy.Validate(); err != nil {
+		report("tenancy", err)
+	}
+	if _, err := c.Reload.Interval(); err != nil {
+		report("reload.interval", err)
+	}
+	if _, err := c.PipeExpiry.Notice(); err != nil {
+		report("pipe_expiry.notice", err)
+	}
+	if c.PipeExpiry.Webhook != nil && c.PipeExpiry.Webhook.URL == "" {
+		report("pipe_expiry.webhook.url", ErrMissingWebhookURL)
+	}
+	walkStrings(reflect.ValueOf(c).Elem(), "", func(path, value string) {
+		if strings.Contains(value, "${") {
+			report(path, ErrUnexpandedPlaceholder)
+		}
+	})
+	if len(errs) == 0 {
+		return nil
+	}
+	sort.SliceStable(errs, func(i, j int) bool {
+		return errs[i].Path < errs[j].Path
+	})
+	return errs
+}
+
+func validateCollection(collecCfg *collection.Config, path string, report func(string, error)) {
+	flushPeriod, err := collecCfg.FlushPeriod()
+	if err != nil {
+		report(path+".flush_period", err)
+	} else if flushPeriod < 0 || (flushPeriod == 0 && collecCfg.FlushCount <= 0 && collecCfg.FlushBytes <= 0) {
+		report(path+".flush_period", ErrWrongFlushPeriod)
+	}
+	if collecCfg.FlushCount < 0 {
+		report(path+".flush_count", collection.ErrLengthLowerThanZero)
+	}
+	if collecCfg.FlushBytes < 0 {
+		report(path+".flush_bytes", collection.ErrLengthLowerThanZero)
+	}
+	if collecCfg.MaxBodySize < 0 {
+		report(path+".max_body_size", collection.ErrLengthLowerThanZero)
+	}
+	retentionPeriod, retentionErr := collecCfg.RetentionPeriod()
+	if retentionErr != nil {
+		report(path+".retention_period", retentionErr)
+	} else if err == nil && retentionPeriod < flushPeriod {
+		report(path+".retention_period", ErrRetentionShorterThanFlush)
+	}
+	if _, err = collecCfg.Schemas(); err != nil {
+		report(path+".schemas", err)
+	}
+	if _, err = collecCfg.Backoff(flushPeriod); err != nil {
+		report(path+".retry", err)
+	}
+	if _, err = collecCfg.BufferLimits(); err != nil {
+		report(path+".buffer", err)
+	}
+	if _, err = collecCfg.Dedup(); err != nil {
+		report(path+".dedup.window", err)
+	}
+	if _, err = collecCfg.Validation(); err != nil {
+		report(path+".validation", err)
+	}
+	if _, err = collecCfg.Priority(); err != nil {
+		report(path+".priority", err)
+	}
+	if _, err = collecCfg.Ack(); err != nil {
+		report(path+".ack", err)
+	}
+	for i := range collecCfg.ProcessorsCfg {
+		if _, err = collecCfg.ProcessorsCfg[i].Processor(); err != nil {
+			report(fmt.Sprintf("%s.processors[%d]", path, i), err)
+		}
+	}
+	if _, err = collecCfg.Routes(); err != nil {
+		report(path+".routes", err)
+	}
+	if _, err = collecCfg.Reroutes(); err != nil {
+		report(path+".reroute", err)
+	}
+	if _, err = collecCfg.Canaries(); err != nil {
+		report(path+".canaries", err)
+	}
+	if _, err = collecCfg.Serialization(); err != nil {
+		report(path+".serialization", err)
+	}
+	if _, err = collecCfg.Metadata(); err != nil {
+		report(path+".metadata", err)
+	}
+}
+
+// validateReroutes reports reroutes to collections which do not exist, unless they can be created, or which lack schemas of the collection
+func validateReroutes(c *Config, collecCfg *collection.Config, path string, report func(string, error)) {
+	for i, reroute := range collecCfg.ReroutesCfg {
+		var target *collection.Config
+		for j := range c.Collections {
+			if c.Collections[j].Name == reroute.Collection {
+				target = &c.Collections[j]
+			}
+		}
+		if target == nil {
+			if !c.AutoCreate.Enabled {
+				report(fmt.Sprintf("%s.reroute[%d].collection", path, i), ErrUnknownCollection)
+			}
+			continue
+		}
+		for schemaName := range collecCfg.SchemasCfg {
+			if _, ok := target.SchemasCfg[schemaName]; !ok {
+				report(fmt.Sprintf("%s.reroute[%d].collection", path, i), ErrUnknownSchema)
+				break
+			}
+		}
+	}
+}
+
+func validateRoutes(routesCfg []collection.RouteConfig, outputCfg *output.Config, path string, report func(string, error)) {
+	for i, route := range routesCfg {
+		for j, outputName := range route.Outputs {
+			if !hasOutput(outputCfg, outputName) {
+				report(fmt.Sprintf("%s.routes[%d].outputs[%d]", path, i, j), ErrUndefinedOutput)
+			}
+		}
+	}
+}
+
+func validateSchemaOutputs(schemasCfg map[collection.SchemaName]collection.SchemaConfig, outputCfg *output.Config, path string, report func(string, error)) {
+	for schemaName, schemaCfg := range schemasCfg {
+		for i, outputName := range schemaCfg.Outputs {
+			if !hasOutput(outputCfg, outputName) {
+				report(fmt.Sprintf("%s.schemas.%s.outputs[%d]", path, schemaName, i), ErrUndefinedOutput)
+			}
+		}
+		for i, outputName := range schemaCfg.AlsoOutputs {
+			if !hasOutput(outputCfg, outputName) {
+				report(fmt.Sprintf("%s.schemas.%s.also_outputs[%d]", path, schemaName, i), ErrUndefinedOutput)
+			}
+		}
+	}
+}
+
+func validateCanaries(canariesCfg []collection.CanaryConfig, outputCfg *output.Config, path string, report func(string, error)) {
+	for i, canary := range canariesCfg {
+		if canary.Output != "" && !hasOutput(outputCfg, canary.Output) {
+			report(fmt.Sprintf("%s.canaries[%d].output", path, i), ErrUndefinedOutput)
+		}
+		if canary.Canary != "" && !hasOutput(outputCfg, canary.Canary) {
+			report(fmt.Sprintf("%s.canaries[%d].canary", path, i), ErrUndefinedOutput)
+		}
+	}
+}
+
+func validateRedis(redisCfg *Redis, path string, report func(string, error)) {
+	validateCompression(redisCfg.Compression, path+".compression", report)
+	switch redisCfg.Clock {
+	case "", LocalClock, RedisTimeClock:
+	default:
+		report(path+".clock", ErrUnknownClock)
+	}
+	if _, err := redisCfg.ClockSkewTolerance(); err != nil {
+		report(path+".clock_skew_tolerance", err)
+	}
+	if _, err := redisCfg.AppendBatch.MaxWait(); err != nil {
+		report(path+".append_batch.max_wait", err)
+	}
+	if _, err := redisCfg.AppendBatch.Documents(); err != nil {
+		report(path+".append_batch.max_documents", err)
+	}
+	if redisCfg.Username != "" && redisCfg.Password == "" {
+		report(path+".password", ErrUsernameWithoutPassword)
+	}
+	if (redisCfg.TLS.CertFile == "") != (redisCfg.TLS.KeyFile == "") {
+		report(path+".tls", ErrMissingKeyPair)
+	}
+	if redisCfg.Sentinel != nil && redisCfg.Cluster != nil {
+		report(path, ErrRedisTopology)
+	}
+	if redisCfg.Sentinel != nil && (redisCfg.Sentinel.Master == "" || len(redisCfg.Sentinel.Addrs) == 0) {
+		report(path+".sentinel", ErrMissingSentinelMaster)
+	}
+	if redisCfg.Cluster != nil {
+		if len(redisCfg.Cluster.Addrs) == 0 {
+			report(path+".cluster.addrs", ErrMissingClusterAddrs)
+		}
+		if redisCfg.DB != 0 {
+			report(path+".db", ErrClusterDB)
+		}
+	}
+}
+
+func validateCompression(compression Compression, path string, report func(string, error)) {
+	switch compression {
+	case "", NoCompression, SnappyCompression, GzipCompression, ZstdCompression:
+	default:
+		report(path, ErrUnknownCompression)
+	}
+}
+
+func validateEngine(engine Engine, path string, report func(string, error)) {
+	switch engine {
+	case "", RedisEngine, KafkaEngine, MemoryEngine, DiskEngine:
+	default:
+		report(path, ErrUnknownEngine)
+	}
+}
+
+func validateDeadLetter(c *Config, report func(string, error)) {
+	switch c.DeadLetter.Destination {
+	case "", RedisDeadLetters, FileDeadLetters:
+	case OutputDeadLetters:
+		if c.DeadLetter.Output == "" || !hasOutput(&c.Output, c.DeadLetter.Output) {
+			report("dead_letter.output", ErrUndefinedOutput)
+		}
+	default:
+		report("dead_letter.destination", ErrUnknownDestination)
+	}
+	if c.DeadLetter.Redis != nil {
+		validateRedis(c.DeadLetter.Redis, "dead_letter.redis", report)
+	}
+}
+
+func validateOutputs(outputCfg *output.Config, names map[collection.Name]struct{}, report func(string, error)) {
+	for _, name := range outputCfg.Unknown() {
+		report(fmt.Sprintf("output.%s", name), ErrUnknownOutput)
+	}
+	for path, collections := range outputCfg.Collections() {
+		for _, name := range collections {
+			if _, ok := names[name]; !ok {
+				report(fmt.Sprintf("output.%s.%s", path, name), ErrUnknownCollection)
+			}
+		}
+	}
+	if outputCfg.AzureBlob != nil {
+		if err := outputCfg.AzureBlob.Tier.Validate(); err != nil {
+			report("output.azure_blob.tier", err)
+		}
+	}
+	if outputCfg.GCS != nil {
+		if err := outputCfg.GCS.StorageClass.Validate(); err != nil {
+			report("output.gcs.storage_class", err)
+		}
+	}
+	if outputCfg.Pulsar != nil {
+		if err := outputCfg.Pulsar.Compression.Validate(); err != nil {
+			report("output.pulsar.compression", err)
+		}
+	}
+	if outputCfg.Loki != nil {
+		if err := outputCfg.Loki.Compression.Validate(); err != nil {
+			report("output.loki.compression", err)
+		}
+	}
+	if outputCfg.Splunk != nil {
+		if err := outputCfg.Splunk.Compression.Validate(); err != nil {
+			report("output.splunk.compression", err)
+		}
+	}
+	if outputCfg.ClickHouse != nil {
+		if err := outputCfg.ClickHouse.Compression.Validate(); err != nil {
+			report("output.clickhouse.compression", err)
+		}
+	}
+	if outputCfg.OTLP != nil {
+		if err := outputCfg.OTLP.Compression.Validate(); err != nil {
+			report("output.otlp.compression", err)
+		}
+	}
+	for name, webhookCfg := range outputCfg.Webhooks {
+		if err := webhookCfg.Compression.Validate(); err != nil {
+			report(fmt.Sprintf("output.webhooks.%s.compression", name), err)
+		}
+	}
+	for name, pluginCfg := range outputCfg.Plugins {
+		if err := pluginCfg.Validate(); err != nil {
+			report(fmt.Sprintf("output.plugins.%s.command", name), err)
+		}
+	}
+	if err := outputCfg.CircuitBreaker.Validate(); err != nil {
+		report("output.circuit_breaker", err)
+	}
+	if err := outputCfg.Pool.Validate(); err != nil {
+		report("output.pool", err)
+	}
+	if err := outputCfg.Batch.Validate(); err != nil {
+		report("output.batch", err)
+	}
+	for name, dryRun := range outputCfg.DryRun.Outputs {
+		if err := outputCfg.ValidateDryRun(name, dryRun); err != nil {
+			report(fmt.Sprintf("output.dry_run.outputs.%s", name), err)
+		}
+	}
+	if outputCfg.OpenSearch != nil {
+		if err := outputCfg.OpenSearch.Index.Validate(); err != nil {
+			report("output.opensearch.index", err)
+		}
+		for name, index := range outputCfg.OpenSearch.Indices {
+			if err := index.Validate(); err != nil {
+				report(fmt.Sprintf("output.opensearch.indices.%s", name), err)
+			}
+		}
+		if err := outputCfg.OpenSearch.Dynamic.Validate(); err != nil {
+			report("output.opensearch.dynamic", err)
+		}
+		if err := outputCfg.OpenSearch.Compression.Validate(); err != nil {
+			report("output.opensearch.compression", err)
+		}
+		if err := outputCfg.OpenSearch.ID.Validate(); err != nil {
+			report("output.opensearch.id", err)
+		}
+		if err := outputCfg.OpenSearch.OpType.Validate(outputCfg.OpenSearch.DataStream); err != nil {
+			report("output.opensearch.op_type", err)
+		}
+	}
+	if outputCfg.Elastic == nil {
+		return
+	}
+	if err := outputCfg.Elastic.Index.Validate(); err != nil {
+		report("output.elasticsearch.index", err)
+	}
+	for name, index := range outputCfg.Elastic.Indices {
+		if err := index.Validate(); err != nil {
+			report(fmt.Sprintf("output.elasticsearch.indices.%s", name), err)
+		}
+	}
+	if err := outputCfg.Elastic.Template.Validate(); err != nil {
+		report("output.elasticsearch.template", err)
+	}
+	if err := outputCfg.Elastic.Dynamic.Validate(); err != nil {
+		report("output.elasticsearch.dynamic", err)
+	}
+	if err := outputCfg.Elastic.Compression.Validate(); err != nil {
+		report("output.elasticsearch.compression", err)
+	}
+	if err := outputCfg.Elastic.ID.Validate(); err != nil {
+		report("output.elasticsearch.id", err)
+	}
+	if err := outputCfg.Elastic.OpType.Validate(outputCfg.Elastic.DataStream); err != nil {
+		report("output.elasticsearch.op_type", err)
+	}
+	if outputCfg.Elastic.DataStream && outputCfg.Elastic.Template == elastic.LegacyTemplate {
+		report("output.elasticsearch.data_stream", elastic.ErrLegacyDataStream)
+	}
+	if outputCfg.Elastic.ILM != nil {
+		if err := outputCfg.Elastic.ILM.Validate(outputCfg.Elastic.DataStream); err != nil {
+			report("output.elasticsearch.ilm", err)
+		}
+	}
+}
+
+func validateInputs(c *Config, report func(string, error)) {
+	for name, pluginCfg := range c.Input.Plugins {
+		if err := pluginCfg.Validate(); err != nil {
+			report(fmt.Sprintf("input.plugins.%s.command", name), err)
+		}
+	}
+	for path, target := range c.Input.Targets() {
+		var collecCfg *collection.Config
+		for i := range c.Collections {
+			if c.Collections[i].Name == target.Collection {
+				collecCfg = &c.Collections[i]
+			}
+		}
+		if collecCfg == nil {
+			report(fmt.Sprintf("input.%s.collection", path), ErrUnknownCollection)
+			continue
+		}
+		if _, ok := collecCfg.SchemasCfg[target.Schema]; !ok {
+			report(fmt.Sprintf("input.%s.schema", path), ErrUnknownSchema)
+		}
+	}
+}
+
+func validateTLS(tlsCfg TLS, report func(string, error)) {
+	if tlsCfg.Enabled() || tlsCfg.ClientCAFile != "" {
+		if tlsCfg.CertFile == "" {
+			report("tls.cert_file", ErrMissingKeyPair)
+		}
+		if tlsCfg.KeyFile == "" {
+			report("tls.key_file", ErrMissingKeyPair)
+		}
+	}
+	switch tlsCfg.ClientAuth {
+	case "":
+	case RequireClientCert, VerifyClientCertIfGiven:
+		if tlsCfg.ClientCAFile == "" {
+			report("tls.client_auth", ErrClientAuthWithoutCA)
+		}
+	default:
+		report("tls.client_auth", ErrUnknownClientAuth)
+	}
+}
+
+func validateAuth(authCfg *auth.VerifierConfig, names map[collection.Name]struct{}, report func(string, error)) {
+	keys := make(map[string]struct{}, len(authCfg.APIKeys))
+	for i, apiKey := range authCfg.APIKeys {
+		path := fmt.Sprintf("auth.api_keys[%d]", i)
+		if apiKey.Key == "" {
+			report(path+".key", ErrMissingAPIKey)
+		} else if _, ok := keys[apiKey.Key]; ok {
+			report(path+".key", ErrDuplicateAPIKey)
+		}
+		keys[apiKey.Key] = struct{}{}
+		if apiKey.Tenant != "" && !tenant.ValidID(apiKey.Tenant) {
+			report(path+".tenant", tenant.ErrWrongTenant)
+		}
+		for j, name := range apiKey.Collections {
+			if _, ok := names[collection.Name(name)]; !ok && name != "*" {
+				report(fmt.Sprintf("%s.collections[%d]", path, j), ErrUnknownCollection)
+			}
+		}
+	}
+	if jwt := authCfg.JWT; jwt != nil && jwt.Secret == "" && jwt.PublicKeyFile == "" && jwt.JWKSURL == "" {
+		report("auth.jwt", auth.ErrNoJWTKey)
+	}
+}
+
+// hasOutput tells whether the output, named as in the outputs map, is configured
+func hasOutput(outputCfg *output.Config, name string) bool {
+	if webhookName, ok := strings.CutPrefix(name, "webhook."); ok {
+		_, ok = outputCfg.Webhooks[webhookName]
+		return ok
+	}
+	if pluginName, ok := strings.CutPrefix(name, "plugin."); ok {
+		_, ok = outputCfg.Plugins[pluginName]
+		return ok
+	}
+	v := reflect.ValueOf(outputCfg).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		if yamlName(v.Type().Field(i)) == name && v.Field(i).Kind() == reflect.Ptr {
+			return !v.Field(i).IsNil()
+		}
+	}
+	return false
+}
+
+// walkStrings calls fn with the path of every string value of v
+func walkStrings(v reflect.Value, path string, fn func(path, value string)) {
+	join := func(name string) string {
+		if path == "" {
+			return name
+		}
+		return path + "." + name
+	}
+	switch v.Kind() {
+	case reflect.Ptr:
+		if !v.IsNil() {
+			walkStrings(v.Elem(), path, fn)
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if name := yamlName(v.Type().Field(i)); name != "" {
+				walkStrings(v.Field(i), join(name), fn)
+			}
+		}
+	case reflect.Map:
+		for _, key := range v.MapKeys() {
+			walkStrings(v.MapIndex(key), join(fmt.Sprint(key.Interface())), fn)
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			walkStrings(v.Index(i), fmt.Sprintf("%s[%d]", path, i), fn)
+		}
+	case reflect.String:
+		fn(path, v.String())
+	}
+}
@@ -0,0 +1,23 @@
+package config
+
+import "testing"
+
+func TestValidateCompression(t *testing.T) {
+	compressions := map[Compression]error{
+		"":                nil,
+		NoCompression:     nil,
+		SnappyCompression: nil,
+		GzipCompression:   nil,
+		ZstdCompression:   nil,
+		"lz4":             ErrUnknownCompression,
+	}
+	for compression, want := range compressions {
+		var got error
+		validateCompression(compression, "persistence.redis.compression", func(path string, err error) {
+			got = err
+		})
+		if got != want {
+			t.Errorf("validateCompression(%q) = %v, want %v", compression, got, want)
+		}
+	}
+}
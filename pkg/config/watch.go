@@ -0,0 +1,50 @@
+package config
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io/ioutil"
+	"time"
+)
+
+// Watch checks the config file every interval until stop is closed
+// and signals the returned channel whenever its content changes.
+// Content is compared rather than modification times
+// so files replaced through symlinks, as mounted config maps are, are detected too.
+func Watch(interval time.Duration, stop <-chan struct{}) <-chan struct{} {
+	changes := make(chan struct{}, 1)
+	go func() {
+		var (
+			ticker  = time.NewTicker(interval)
+			current = checksum()
+		)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				next := checksum()
+				if next == nil || bytes.Equal(next, current) {
+					continue
+				}
+				current = next
+				select {
+				case changes <- struct{}{}:
+				default:
+				}
+			}
+		}
+	}()
+	return changes
+}
+
+// checksum of the config file, nil if it cannot be read
+func checksum() []byte {
+	content, err := ioutil.ReadFile(Path())
+	if err != nil {
+		return nil
+	}
+	sum := sha256.Sum256(content)
+	return sum[:]
+}
@@ -0,0 +1,85 @@
+package encryption
+
+import (
+	"encoding/base64"
+	"errors"
+
+	"github.com/khezen/bulklog/pkg/auth"
+)
+
+// KeySize - bytes of AES-256 keys
+const KeySize = 32
+
+var (
+	// ErrWrongKey - key is not base64 encoded 32 bytes
+	ErrWrongKey = errors.New("ErrWrongKey - keys must be 32 bytes, base64 encoded")
+	// ErrKeySources - several sources are given the key
+	ErrKeySources = errors.New("ErrKeySources - key, key_file and kms are mutually exclusive")
+	// ErrMissingKey - previous keys are given without the current one
+	ErrMissingKey = errors.New("ErrMissingKey - previous_keys require key, key_file or kms")
+	// ErrMissingCiphertext - kms has no data key to decrypt
+	ErrMissingCiphertext = errors.New("ErrMissingCiphertext - kms requires ciphertext_blob")
+)
+
+// Config - AES-256-GCM encryption of buffered documents, disabled unless a key is set
+type Config struct {
+	// Key - base64 encoded key, usually set by BULKLOG_PERSISTENCE_ENCRYPTION_KEY rather than in the config file
+	Key string `yaml:"key"`
+	// KeyFile holds the base64 encoded key, such as a mounted secret
+	KeyFile string `yaml:"key_file"`
+	// KMS decrypts the data key at startup
+	KMS *KMS `yaml:"kms,omitempty"`
+	// PreviousKeys - base64 encoded keys which documents buffered before a key rotation were encrypted with, only used to decrypt them
+	PreviousKeys []string `yaml:"previous_keys"`
+}
+
+// KMS - data key encrypted by AWS KMS
+type KMS struct {
+	// CiphertextBlob - base64 encoded data key, as given by aws kms generate-data-key --key-spec AES_256
+	CiphertextBlob string `yaml:"ciphertext_blob"`
+	// Endpoint defaults to https://kms.{region}.amazonaws.com
+	Endpoint string          `yaml:"endpoint"`
+	AWSAuth  *auth.AWSConfig `yaml:"aws_auth,omitempty"`
+}
+
+// Enabled tells whether documents are encrypted
+func (c Config) Enabled() bool {
+	return c.Key != "" || c.KeyFile != "" || c.KMS != nil
+}
+
+// Validate checks key sources and the keys given in the config
+func (c Config) Validate() error {
+	sources := 0
+	for _, set := range []bool{c.Key != "", c.KeyFile != "", c.KMS != nil} {
+		if set {
+			sources++
+		}
+	}
+	switch {
+	case sources > 1:
+		return ErrKeySources
+	case sources == 0 && len(c.PreviousKeys) > 0:
+		return ErrMissingKey
+	case c.KMS != nil && c.KMS.CiphertextBlob == "":
+		return ErrMissingCiphertext
+	}
+	if c.Key != "" {
+		if _, err := decodeKey(c.Key); err != nil {
+			return err
+		}
+	}
+	for _, key := range c.PreviousKeys {
+		if _, err := decodeKey(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func decodeKey(encoded string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(key) != KeySize {
+		return nil, ErrWrongKey
+	}
+	return key, nil
+}
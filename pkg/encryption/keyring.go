@@ -0,0 +1,126 @@
+package encryption
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// keyIDSize - bytes of the key ID sealed payloads start with, so that they are opened by the key they were sealed with
+const keyIDSize = 4
+
+var (
+	// ErrUnknownKey - payload was sealed with a key which is neither the current nor a previous one
+	ErrUnknownKey = errors.New("ErrUnknownKey - payload was encrypted with a key which is not configured, add it to previous_keys")
+	// ErrCorrupted - payload does not authenticate against its key
+	ErrCorrupted = errors.New("ErrCorrupted - payload is truncated or was tampered with")
+)
+
+// Keyring seals payloads with the current key, and opens those sealed with the current or a previous key.
+// Sealed payloads layout: | key ID | nonce | ciphertext and tag |
+type Keyring struct {
+	current [keyIDSize]byte
+	aeads   map[[keyIDSize]byte]cipher.AEAD
+}
+
+// New loads the keys of cfg, nil if encryption is disabled
+func New(cfg Config) (*Keyring, error) {
+	if !cfg.Enabled() {
+		return nil, nil
+	}
+	var (
+		key []byte
+		err error
+	)
+	switch {
+	case cfg.Key != "":
+		key, err = decodeKey(cfg.Key)
+	case cfg.KeyFile != "":
+		key, err = readKeyFile(cfg.KeyFile)
+	default:
+		key, err = decryptDataKey(cfg.KMS)
+	}
+	if err != nil {
+		return nil, err
+	}
+	k := &Keyring{aeads: make(map[[keyIDSize]byte]cipher.AEAD, 1+len(cfg.PreviousKeys))}
+	k.current, err = k.add(key)
+	if err != nil {
+		return nil, err
+	}
+	for _, encoded := range cfg.PreviousKeys {
+		key, err = decodeKey(encoded)
+		if err != nil {
+			return nil, err
+		}
+		_, err = k.add(key)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return k, nil
+}
+
+func (k *Keyring) add(key []byte) (id [keyIDSize]byte, err error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return id, fmt.Errorf("aes.NewCipher.%s", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return id, fmt.Errorf("cipher.NewGCM.%s", err)
+	}
+	digest := sha256.Sum256(key)
+	copy(id[:], digest[:])
+	if _, ok := k.aeads[id]; !ok {
+		k.aeads[id] = aead
+	}
+	return id, nil
+}
+
+// Seal encrypts plaintext with the current key and a random nonce
+func (k *Keyring) Seal(plaintext []byte) ([]byte, error) {
+	aead := k.aeads[k.current]
+	sealed := make([]byte, keyIDSize+aead.NonceSize(), keyIDSize+aead.NonceSize()+len(plaintext)+aead.Overhead())
+	copy(sealed, k.current[:])
+	_, err := rand.Read(sealed[keyIDSize:])
+	if err != nil {
+		return nil, fmt.Errorf("rand.Read.%s", err)
+	}
+	return aead.Seal(sealed, sealed[keyIDSize:], plaintext, nil), nil
+}
+
+// Open decrypts payloads sealed by Seal, with the key they were sealed with
+func (k *Keyring) Open(sealed []byte) ([]byte, error) {
+	if len(sealed) < keyIDSize {
+		return nil, ErrCorrupted
+	}
+	var id [keyIDSize]byte
+	copy(id[:], sealed)
+	aead, ok := k.aeads[id]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	sealed = sealed[keyIDSize:]
+	if len(sealed) < aead.NonceSize()+aead.Overhead() {
+		return nil, ErrCorrupted
+	}
+	plaintext, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], nil)
+	if err != nil {
+		return nil, ErrCorrupted
+	}
+	return plaintext, nil
+}
+
+func readKeyFile(path string) ([]byte, error) {
+	encoded, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("ioutil.ReadFile.%s", err)
+	}
+	return decodeKey(strings.TrimSpace(string(encoded)))
+}
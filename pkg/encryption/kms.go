@@ -0,0 +1,66 @@
+package encryption
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/khezen/bulklog/pkg/auth"
+)
+
+const kmsTimeout = 30 * time.Second
+
+// decryptDataKey asks KMS to decrypt the data key of cfg, see https://docs.aws.amazon.com/kms/latest/APIReference/API_Decrypt.html
+func decryptDataKey(cfg *KMS) ([]byte, error) {
+	awsCfg := auth.AWSConfig{}
+	if cfg.AWSAuth != nil {
+		awsCfg = *cfg.AWSAuth
+	}
+	endpoint := cfg.Endpoint
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://kms.%s.amazonaws.com/", awsCfg.ResolvedRegion())
+	}
+	body, err := json.Marshal(map[string]string{"CiphertextBlob": cfg.CiphertextBlob})
+	if err != nil {
+		return nil, fmt.Errorf("json.Marshal.%s", err)
+	}
+	req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("http.NewRequest.%s", err)
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "TrentService.Decrypt")
+	err = auth.NewAWSSigner(awsCfg, "kms").Sign(req, body)
+	if err != nil {
+		return nil, fmt.Errorf("Sign.%s", err)
+	}
+	httpcli := http.Client{Timeout: kmsTimeout}
+	res, err := httpcli.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("httpcli.Do.%s", err)
+	}
+	defer res.Body.Close()
+	resBody, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, fmt.Errorf("ioutil.ReadAll.%s", err)
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("kms.Decrypt.%d.%s", res.StatusCode, resBody)
+	}
+	var decrypted struct {
+		Plaintext string `json:"Plaintext"`
+	}
+	err = json.Unmarshal(resBody, &decrypted)
+	if err != nil {
+		return nil, fmt.Errorf("json.Unmarshal.%s", err)
+	}
+	key, err := base64.StdEncoding.DecodeString(decrypted.Plaintext)
+	if err != nil || len(key) != KeySize {
+		return nil, ErrWrongKey
+	}
+	return key, nil
+}
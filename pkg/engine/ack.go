@@ -0,0 +1,40 @@
+package engine
+
+import (
+	"context"
+
+	"github.com/khezen/bulklog/pkg/collection"
+)
+
+// maxAsyncAppends bounds the appends in flight of documents acknowledged asynchronously,
+// beyond which documents are acknowledged once appended, so a slow buffer slows clients down rather than piling appends up
+const maxAsyncAppends = 1024
+
+// appendAsync appends documents in the background if they are acknowledged asynchronously, as ctx tells or collec by default.
+// It tells whether it did; appends which fail are logged, the documents are lost.
+func (e *engine) appendAsync(ctx context.Context, collec *collection.Collection, documents []collection.Document, claimed []string) bool {
+	if collection.AckFrom(ctx, collec.Ack) != collection.AckAsync {
+		return false
+	}
+	select {
+	case e.asyncAppends <- struct{}{}:
+	default:
+		return false
+	}
+	e.appending.Add(1)
+	// the request ends once documents are acknowledged
+	ctx = context.WithoutCancel(ctx)
+	go func() {
+		defer func() {
+			<-e.asyncAppends
+			e.appending.Done()
+		}()
+		err := e.dispatchRerouted(documents)
+		if err != nil {
+			e.releaseClaimed(collec.Name, claimed)
+			e.release(ctx, documents)
+			e.logger.Error("documents acknowledged asynchronously could not be appended", "collection", collec.Name, "documents", len(documents), "error", err)
+		}
+	}()
+	return true
+}
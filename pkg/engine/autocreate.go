@@ -0,0 +1,111 @@
+package engine
+
+import (
+	"fmt"
+	"maps"
+	"regexp"
+
+	"github.com/khezen/bulklog/pkg/collection"
+	"github.com/khezen/bulklog/pkg/config"
+	"github.com/khezen/bulklog/pkg/output"
+)
+
+// autoCollectionName - names of collections which can be created on the fly.
+// They end up in redis keys, file paths and index names, which elasticsearch requires lowercase.
+var autoCollectionName = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,63}$`)
+
+// createCollection creates a collection from the auto creation template, unless it exists already.
+// It gives up if the name is not allowed or the maximum of created collections is reached.
+func (e *engine) createCollection(name collection.Name) {
+	if !autoCollectionName.MatchString(string(name)) {
+		return
+	}
+	e.reloading.Lock()
+	defer e.reloading.Unlock()
+	e.RLock()
+	_, exists := e.collections[name]
+	autoCreate := e.autoCreate
+	outputs := e.outputs
+	e.RUnlock()
+	if exists || !autoCreate.Enabled {
+		return
+	}
+	if autoCreate.MaxCollections > 0 && len(e.autoCreated) >= autoCreate.MaxCollections {
+		e.logger.Warn("collection creation refused, max_collections reached", "collection", name)
+		return
+	}
+	err := e.addCollection(autoCreate.Of(name), e.persistenceCfg.Of(name), outputs, nil)
+	if err != nil {
+		e.logger.Error("collection creation failed", "collection", name, "error", err)
+		return
+	}
+	e.autoCreated[name] = struct{}{}
+	e.logger.Info("collection created", "collection", name)
+}
+
+// addCollection builds a collection and its buffer, then adds them to the engine.
+// The caller holds reloading; owner is recorded as the tenant of the collection, unless nil.
+func (e *engine) addCollection(collecCfg collection.Config, persistence config.Persistence, outputs map[string]output.Interface, owner *tenantCollection) error {
+	name := collecCfg.Name
+	collec, err := newCollection(collecCfg, outputs)
+	if err != nil {
+		return err
+	}
+	buffer, err := newBuffer(collec, persistence, e.keyring, outputs, e.deadLetters, e.expiry, e.logger.With("collection", name))
+	if err != nil {
+		return fmt.Errorf("newBuffer.%s", err)
+	}
+	e.Lock()
+	e.schemas = maps.Clone(e.schemas)
+	e.schemas[name] = schemaNames(collec)
+	e.collections = maps.Clone(e.collections)
+	e.collections[name] = collec
+	e.buffers = maps.Clone(e.buffers)
+	e.buffers[name] = buffer
+	e.dedups = maps.Clone(e.dedups)
+	e.dedups[name] = newDeduplicator(collec, persistence)
+	if owner != nil {
+		e.tenantCollections = maps.Clone(e.tenantCollections)
+		e.tenantCollections[name] = *owner
+	}
+	e.Unlock()
+	e.collectionsCfg[name] = collecCfg
+	e.persistence[name] = persistence
+	go buffer.Flusher()()
+	return nil
+}
+
+// collectionConfigs returns the settings of collections after a reload:
+// the ones of cfg, the ones created on the fly if auto creation is still enabled, with the new template,
+// and the ones of tenants if tenancy is still enabled and the collection they derive from is kept.
+// It also returns the collections created on the fly once reloaded, the ones which cfg now defines are not anymore,
+// and the tenant collections once reloaded.
+func (e *engine) collectionConfigs(cfg *config.Config) ([]collection.Config, map[collection.Name]struct{}, map[collection.Name]tenantCollection) {
+	collecCfgs := make([]collection.Config, 0, len(cfg.Collections)+len(e.autoCreated)+len(e.tenantCollections))
+	collecCfgs = append(collecCfgs, cfg.Collections...)
+	defined := make(map[collection.Name]collection.Config, len(cfg.Collections)+len(e.autoCreated))
+	for _, collecCfg := range cfg.Collections {
+		defined[collecCfg.Name] = collecCfg
+	}
+	autoCreated := make(map[collection.Name]struct{}, len(e.autoCreated))
+	for name := range e.autoCreated {
+		if _, ok := defined[name]; ok || !cfg.AutoCreate.Enabled {
+			continue
+		}
+		collecCfg := cfg.AutoCreate.Of(name)
+		collecCfgs = append(collecCfgs, collecCfg)
+		defined[name] = collecCfg
+		autoCreated[name] = struct{}{}
+	}
+	tenantCollections := make(map[collection.Name]tenantCollection, len(e.tenantCollections))
+	for name, owner := range e.tenantCollections {
+		baseCfg, ok := defined[owner.base]
+		if !ok || !cfg.Tenancy.Enabled {
+			continue
+		}
+		baseCfg.Name = name
+		collecCfgs = append(collecCfgs, baseCfg)
+		tenantCollections[name] = owner
+	}
+	return collecCfgs, autoCreated, tenantCollections
+}
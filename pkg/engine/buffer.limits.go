@@ -0,0 +1,53 @@
+package engine
+
+import (
+	"time"
+
+	"github.com/khezen/bulklog/pkg/collection"
+)
+
+const blockPollPeriod = 50 * time.Millisecond
+
+// admit appends documents according to the collection overflow policy.
+// tryAppend appends documents only if they fit within limits;
+// dropAndAppend drops the oldest buffered documents to make room for them.
+func admit(limits collection.BufferLimits, documents []collection.Document, tryAppend func() (bool, error), dropAndAppend func() (bool, error)) error {
+	if !limits.Fits(len(documents), documentsBytes(documents)) {
+		return ErrBufferOverflow
+	}
+	deadline := time.Now().Add(limits.BlockTimeout)
+	for {
+		ok, err := tryAppend()
+		if err != nil {
+			return err
+		}
+		if ok {
+			return nil
+		}
+		switch limits.Overflow {
+		case collection.DropOldest:
+			ok, err = dropAndAppend()
+			if err != nil {
+				return err
+			}
+			if !ok {
+				return ErrBufferOverflow
+			}
+			return nil
+		case collection.Block:
+			if !time.Now().Before(deadline) {
+				return ErrBufferOverflow
+			}
+			time.Sleep(blockPollPeriod)
+		default:
+			return ErrBufferOverflow
+		}
+	}
+}
+
+func documentsBytes(documents []collection.Document) (bytes int64) {
+	for _, doc := range documents {
+		bytes += int64(len(doc.Body))
+	}
+	return bytes
+}
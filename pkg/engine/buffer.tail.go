@@ -0,0 +1,50 @@
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/khezen/bulklog/pkg/collection"
+)
+
+// BufferTailer is implemented by buffers whose documents can be read before they are flushed
+type BufferTailer interface {
+	// Tail returns the last n documents buffered since the latest flush, oldest first
+	Tail(n int) ([]collection.Document, error)
+}
+
+// BufferedDocument - document buffered until the next flush of its collection, or pending in a pipe
+type BufferedDocument struct {
+	ID       string                `json:"id"`
+	PostedAt time.Time             `json:"posted_at"`
+	Schema   collection.SchemaName `json:"schema"`
+	Body     json.RawMessage       `json:"body"`
+}
+
+// Tail returns the last n documents a collection buffered since its latest flush, oldest first
+func (e *engine) Tail(collectionName collection.Name, n int) ([]BufferedDocument, error) {
+	e.RLock()
+	buffer, ok := e.buffers[collectionName]
+	e.RUnlock()
+	if !ok {
+		return nil, ErrNotFound
+	}
+	tailer, ok := buffer.(BufferTailer)
+	if !ok {
+		return nil, ErrTailUnsupported
+	}
+	documents, err := tailer.Tail(n)
+	if err != nil {
+		return nil, fmt.Errorf("Tail.%s", err)
+	}
+	return bufferedDocuments(documents), nil
+}
+
+// lastDocuments - the last n documents, all of them if n is not positive
+func lastDocuments(documents []collection.Document, n int) []collection.Document {
+	if n > 0 && len(documents) > n {
+		documents = documents[len(documents)-n:]
+	}
+	return documents
+}
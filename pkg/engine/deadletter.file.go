@@ -0,0 +1,90 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/khezen/bulklog/pkg/collection"
+)
+
+// fileDeadLetters stores each dead letter in {directory}/{collection}/{expiredAtUnixNano}.{uuid}.dlq
+type fileDeadLetters struct {
+	directory string
+}
+
+func newFileDeadLetters(directory string) (*fileDeadLetters, error) {
+	err := os.MkdirAll(directory, 0755)
+	if err != nil {
+		return nil, fmt.Errorf("os.MkdirAll.%s", err)
+	}
+	return &fileDeadLetters{directory}, nil
+}
+
+func (d *fileDeadLetters) Put(letter *DeadLetter) error {
+	letterBytes, err := encodeDeadLetter(letter)
+	if err != nil {
+		return fmt.Errorf("encodeDeadLetter.%s", err)
+	}
+	dir := filepath.Join(d.directory, string(letter.CollectionName))
+	err = os.MkdirAll(dir, 0755)
+	if err != nil {
+		return fmt.Errorf("os.MkdirAll.%s", err)
+	}
+	name := fmt.Sprintf("%d.%s.dlq", letter.ExpiredAt.UnixNano(), uuid.New())
+	tmpPath := filepath.Join(dir, fmt.Sprintf("%s.tmp", name))
+	err = writeDiskFile(tmpPath, letterBytes)
+	if err != nil {
+		return fmt.Errorf("writeDiskFile.%s", err)
+	}
+	err = os.Rename(tmpPath, filepath.Join(dir, name))
+	if err != nil {
+		return fmt.Errorf("os.Rename.%s", err)
+	}
+	return nil
+}
+
+func (d *fileDeadLetters) Drain(collectionName collection.Name) ([]DeadLetter, error) {
+	dir := filepath.Join(d.directory, string(collectionName))
+	entries, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return []DeadLetter{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ioutil.ReadDir.%s", err)
+	}
+	letters := make([]DeadLetter, 0, len(entries))
+	for _, entry := range entries {
+		if !strings.HasSuffix(entry.Name(), ".dlq") {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		letterBytes, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("ioutil.ReadFile.%s", err)
+		}
+		letter, err := decodeDeadLetter(letterBytes)
+		if err != nil {
+			return nil, fmt.Errorf("decodeDeadLetter.%s", err)
+		}
+		err = os.Remove(path)
+		if err != nil {
+			return nil, fmt.Errorf("os.Remove.%s", err)
+		}
+		letters = append(letters, letter)
+	}
+	return letters, nil
+}
+
+// Ping checks the dead letters directory is still there
+func (d *fileDeadLetters) Ping(ctx context.Context) error {
+	_, err := os.Stat(d.directory)
+	if err != nil {
+		return fmt.Errorf("os.Stat.%s", err)
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/khezen/bulklog/pkg/collection"
+	"github.com/khezen/bulklog/pkg/config"
+	"github.com/khezen/bulklog/pkg/output"
+)
+
+const (
+	defaultDeadLetterKeyPrefix = "bulklog.deadletters"
+	// deadLetterTimeout - how long the dead letter output may take to digest a letter
+	deadLetterTimeout = time.Minute
+)
+
+// DeadLetter - documents of an expired pipe with the outputs which failed to digest them
+type DeadLetter struct {
+	CollectionName collection.Name
+	StartedAt      time.Time
+	ExpiredAt      time.Time
+	// Failures - latest error by output name
+	Failures  map[string]string
+	Documents []collection.Document
+}
+
+// DeadLetters stores dead letters until they are redriven
+type DeadLetters interface {
+	Put(letter *DeadLetter) error
+	// Drain removes and returns the dead letters of a collection
+	Drain(collectionName collection.Name) ([]DeadLetter, error)
+}
+
+// NewDeadLetters - nil if no destination is configured.
+// The dead letter output, if any, is removed from outputs so it only receives dead letters.
+func NewDeadLetters(cfg *config.Config, outputs map[string]output.Interface) (DeadLetters, error) {
+	dlCfg := cfg.DeadLetter
+	switch dlCfg.Destination {
+	case "":
+		return nil, nil
+	case config.RedisDeadLetters:
+		redisCfg := dlCfg.Redis
+		if redisCfg == nil {
+			redisCfg = &cfg.Persistence.Redis
+		}
+		keyPrefix := dlCfg.KeyPrefix
+		if keyPrefix == "" {
+			keyPrefix = defaultDeadLetterKeyPrefix
+		}
+		return &redisDeadLetters{newRedisPool(redisCfg), keyPrefix}, nil
+	case config.FileDeadLetters:
+		return newFileDeadLetters(dlCfg.Directory)
+	case config.OutputDeadLetters:
+		out, ok := outputs[dlCfg.Output]
+		if !ok {
+			return nil, ErrDeadLetterOutputNotFound
+		}
+		delete(outputs, dlCfg.Output)
+		return &outputDeadLetters{out}, nil
+	default:
+		return nil, ErrUnknownDeadLetterDestination
+	}
+}
+
+// deadLetter stores documents which some outputs failed to digest
+func deadLetter(deadLetters DeadLetters, collectionName collection.Name, startedAt time.Time, failures map[string]error, documents []collection.Document, logger *slog.Logger) {
+	if len(failures) == 0 {
+		return
+	}
+	if deadLetters == nil {
+		logger.Error("documents expired", "documents", len(documents), "outputs", len(failures))
+		return
+	}
+	letter := &DeadLetter{
+		CollectionName: collectionName,
+		StartedAt:      startedAt,
+		ExpiredAt:      time.Now().UTC(),
+		Failures:       make(map[string]string, len(failures)),
+		Documents:      documents,
+	}
+	for outputName, err := range failures {
+		if err == nil {
+			letter.Failures[outputName] = "retention period expired"
+		} else {
+			letter.Failures[outputName] = err.Error()
+		}
+	}
+	err := deadLetters.Put(letter)
+	if err != nil {
+		logger.Error("dead letter failed", "documents", len(documents), "error", err)
+		return
+	}
+	logger.Warn("documents dead lettered", "documents", len(documents), "outputs", len(failures))
+}
+
+func encodeDeadLetter(letter *DeadLetter) ([]byte, error) {
+	var buf bytes.Buffer
+	err := gob.NewEncoder(&buf).Encode(letter)
+	if err != nil {
+		return nil, fmt.Errorf("gob.Encode.%s", err)
+	}
+	return buf.Bytes(), nil
+}
+
+func decodeDeadLetter(letterBytes []byte) (letter DeadLetter, err error) {
+	err = gob.NewDecoder(bytes.NewReader(letterBytes)).Decode(&letter)
+	if err != nil {
+		return letter, fmt.Errorf("gob.Decode.%s", err)
+	}
+	return letter, nil
+}
+
+// outputDeadLetters sends dead letters to an output
+type outputDeadLetters struct {
+	output output.Interface
+}
+
+func (d *outputDeadLetters) Put(letter *DeadLetter) error {
+	ctx, cancel := context.WithTimeout(context.Background(), deadLetterTimeout)
+	defer cancel()
+	return d.output.Digest(ctx, letter.Documents)
+}
+
+func (d *outputDeadLetters) Drain(collectionName collection.Name) ([]DeadLetter, error) {
+	return nil, ErrRedriveUnsupported
+}
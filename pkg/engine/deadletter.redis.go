@@ -0,0 +1,78 @@
+package engine
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/khezen/bulklog/pkg/collection"
+)
+
+// redisDeadLetters stores dead letters in a list per collection, {key_prefix}.{collection}
+type redisDeadLetters struct {
+	redis     *redis.Pool
+	keyPrefix string
+}
+
+func (d *redisDeadLetters) key(collectionName collection.Name) string {
+	return fmt.Sprintf("%s.%s", d.keyPrefix, collectionName)
+}
+
+func (d *redisDeadLetters) Put(letter *DeadLetter) error {
+	letterBytes, err := encodeDeadLetter(letter)
+	if err != nil {
+		return fmt.Errorf("encodeDeadLetter.%s", err)
+	}
+	conn := d.redis.Get()
+	defer conn.Close()
+	_, err = conn.Do("RPUSH", d.key(letter.CollectionName), base64.StdEncoding.EncodeToString(letterBytes))
+	if err != nil {
+		return fmt.Errorf("(RPUSH deadLettersKey letterBase64).%s", err)
+	}
+	return nil
+}
+
+func (d *redisDeadLetters) Drain(collectionName collection.Name) ([]DeadLetter, error) {
+	key := d.key(collectionName)
+	conn := d.redis.Get()
+	defer conn.Close()
+	err := conn.Send("MULTI")
+	if err != nil {
+		return nil, fmt.Errorf("MULTI.%s", err)
+	}
+	err = conn.Send("LRANGE", key, 0, -1)
+	if err != nil {
+		return nil, fmt.Errorf("(LRANGE deadLettersKey 0 -1).%s", err)
+	}
+	err = conn.Send("DEL", key)
+	if err != nil {
+		return nil, fmt.Errorf("(DEL deadLettersKey).%s", err)
+	}
+	results, err := redis.Values(conn.Do("EXEC"))
+	if err != nil {
+		return nil, fmt.Errorf("EXEC.%s", err)
+	}
+	letterStrings, err := redis.Strings(results[0], nil)
+	if err != nil {
+		return nil, fmt.Errorf("redis.Strings.%s", err)
+	}
+	letters := make([]DeadLetter, 0, len(letterStrings))
+	for _, letterBase64 := range letterStrings {
+		letterBytes, err := base64.StdEncoding.DecodeString(letterBase64)
+		if err != nil {
+			return nil, fmt.Errorf("base64.DecodeString.%s", err)
+		}
+		letter, err := decodeDeadLetter(letterBytes)
+		if err != nil {
+			return nil, fmt.Errorf("decodeDeadLetter.%s", err)
+		}
+		letters = append(letters, letter)
+	}
+	return letters, nil
+}
+
+// Ping checks redis connectivity
+func (d *redisDeadLetters) Ping(ctx context.Context) error {
+	return pingRedis(d.redis)
+}
@@ -0,0 +1,174 @@
+package engine
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/khezen/bulklog/pkg/collection"
+	"github.com/khezen/bulklog/pkg/config"
+)
+
+// deduplicator remembers the dedup keys of collected documents for a window
+type deduplicator interface {
+	// claim records keys, seen[i] is true if keys[i] was already recorded within window
+	claim(keys []string, window time.Duration) (seen []bool, err error)
+	// release forgets keys, so documents which could not be appended are not deduplicated when retried
+	release(keys []string) error
+}
+
+// newDeduplicator shares keys between instances through redis with redis engine, they are local to the instance otherwise
+func newDeduplicator(collec *collection.Collection, persistence config.Persistence) deduplicator {
+	if persistence.Enabled && (persistence.Engine == config.RedisEngine || persistence.Engine == "") {
+		return &redisDeduplicator{
+			redis:     newRedisPool(&persistence.Redis),
+			keyPrefix: fmt.Sprintf("%s.dedup.", redisKeyPrefix(&persistence.Redis, collec.Name)),
+		}
+	}
+	return &memoryDeduplicator{keys: make(map[string]time.Time)}
+}
+
+// deduplicate drops documents whose dedup key was claimed within the collection dedup window,
+// it returns the kept documents and the keys claimed for them
+func (e *engine) deduplicate(collec *collection.Collection, documents []collection.Document) ([]collection.Document, []string, error) {
+	if !collec.Dedup.Enabled() {
+		return documents, nil, nil
+	}
+	e.RLock()
+	dedup, ok := e.dedups[collec.Name]
+	e.RUnlock()
+	if !ok {
+		return documents, nil, nil
+	}
+	keys := make([]string, 0, len(documents))
+	for i := range documents {
+		if key := documents[i].DedupKey(); key != "" {
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) == 0 {
+		return documents, nil, nil
+	}
+	seen, err := dedup.claim(keys, collec.Dedup.Window)
+	if err != nil {
+		return nil, nil, fmt.Errorf("claim.%s", err)
+	}
+	var (
+		kept    = documents[:0:0]
+		claimed = make([]string, 0, len(keys))
+		k       = 0
+	)
+	for i := range documents {
+		if documents[i].DedupKey() == "" {
+			kept = append(kept, documents[i])
+			continue
+		}
+		if !seen[k] {
+			kept = append(kept, documents[i])
+			claimed = append(claimed, keys[k])
+		}
+		k++
+	}
+	return kept, claimed, nil
+}
+
+// releaseClaimed forgets the keys of documents which could not be appended
+func (e *engine) releaseClaimed(collectionName collection.Name, claimed []string) {
+	if len(claimed) == 0 {
+		return
+	}
+	e.RLock()
+	dedup, ok := e.dedups[collectionName]
+	e.RUnlock()
+	if !ok {
+		return
+	}
+	err := dedup.release(claimed)
+	if err != nil {
+		e.logger.Error("dedup keys release failed", "collection", collectionName, "error", err)
+	}
+}
+
+type redisDeduplicator struct {
+	redis     *redis.Pool
+	keyPrefix string
+}
+
+func (d *redisDeduplicator) claim(keys []string, window time.Duration) ([]bool, error) {
+	conn := d.redis.Get()
+	defer conn.Close()
+	for _, key := range keys {
+		err := conn.Send("SET", d.keyPrefix+key, 1, "PX", int64(window/time.Millisecond), "NX")
+		if err != nil {
+			return nil, fmt.Errorf("SET.%s", err)
+		}
+	}
+	err := conn.Flush()
+	if err != nil {
+		return nil, fmt.Errorf("Flush.%s", err)
+	}
+	seen := make([]bool, len(keys))
+	for i := range keys {
+		reply, err := conn.Receive()
+		if err != nil {
+			return nil, fmt.Errorf("SET.%s", err)
+		}
+		// SET NX replies nil if the key exists
+		seen[i] = reply == nil
+	}
+	return seen, nil
+}
+
+func (d *redisDeduplicator) release(keys []string) error {
+	conn := d.redis.Get()
+	defer conn.Close()
+	args := make([]interface{}, 0, len(keys))
+	for _, key := range keys {
+		args = append(args, d.keyPrefix+key)
+	}
+	_, err := conn.Do("DEL", args...)
+	if err != nil {
+		return fmt.Errorf("DEL.%s", err)
+	}
+	return nil
+}
+
+type memoryDeduplicator struct {
+	sync.Mutex
+	// expiry of keys
+	keys    map[string]time.Time
+	sweptAt time.Time
+}
+
+func (d *memoryDeduplicator) claim(keys []string, window time.Duration) ([]bool, error) {
+	d.Lock()
+	defer d.Unlock()
+	now := time.Now()
+	if now.Sub(d.sweptAt) > window {
+		for key, expiry := range d.keys {
+			if !now.Before(expiry) {
+				delete(d.keys, key)
+			}
+		}
+		d.sweptAt = now
+	}
+	seen := make([]bool, len(keys))
+	for i, key := range keys {
+		expiry, ok := d.keys[key]
+		seen[i] = ok && now.Before(expiry)
+		if !seen[i] {
+			d.keys[key] = now.Add(window)
+		}
+	}
+	return seen, nil
+}
+
+func (d *memoryDeduplicator) release(keys []string) error {
+	d.Lock()
+	defer d.Unlock()
+	for _, key := range keys {
+		delete(d.keys, key)
+	}
+	return nil
+}
@@ -0,0 +1,364 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/khezen/bulklog/pkg/collection"
+	"github.com/khezen/bulklog/pkg/config"
+	"github.com/khezen/bulklog/pkg/encryption"
+	"github.com/khezen/bulklog/pkg/output"
+	"github.com/khezen/bulklog/pkg/trace"
+)
+
+const (
+	diskSegmentName = "buffer.wal"
+	diskPipesDir    = "pipes"
+)
+
+type diskBuffer struct {
+	sync.Mutex
+	flusherState
+	reloadable
+	deadLetters DeadLetters
+	expiry      *ExpiryNotifier
+	logger      *slog.Logger
+	dir         string
+	pipesDir    string
+	fsync       bool
+	keyring     *encryption.Keyring
+	segment     *os.File
+	segmentSize int64
+	// documents and body bytes of the segment, tracked for buffer limits
+	segmentDocs  int
+	segmentBytes int64
+	// segmentChecksum - checksum of the records of the segment, recorded along with the pipe it becomes
+	segmentChecksum pipeChecksum
+	close           chan struct{}
+	stopOnce        sync.Once
+	closeOnce       sync.Once
+	conveying       sync.WaitGroup
+	// ctx is cancelled once shutdown stops waiting for conveyances
+	ctx    context.Context
+	cancel context.CancelFunc
+	pipes  pipeRegistry
+	integrity
+	recovery
+}
+
+// DiskBuffer appends documents to a write-ahead segment on local disk.
+// Segments are turned into pipes on flush and pending pipes are replayed on restart.
+// Records are encrypted by keyring unless it is nil.
+func DiskBuffer(collec *collection.Collection, diskCfg *config.Disk, keyring *encryption.Keyring, outputs map[string]output.Interface, deadLetters DeadLetters, expiry *ExpiryNotifier, logger *slog.Logger) (Buffer, error) {
+	dir := filepath.Join(diskCfg.Directory, string(collec.Name))
+	ctx, cancel := context.WithCancel(context.Background())
+	dbuffer := &diskBuffer{
+		deadLetters: deadLetters,
+		expiry:      expiry,
+		logger:      logger,
+		dir:         dir,
+		pipesDir:    filepath.Join(dir, diskPipesDir),
+		fsync:       diskCfg.Fsync,
+		keyring:     keyring,
+		close:       make(chan struct{}),
+		ctx:         ctx,
+		cancel:      cancel,
+	}
+	dbuffer.apply(collec, outputs)
+	err := os.MkdirAll(dbuffer.pipesDir, 0755)
+	if err != nil {
+		return nil, fmt.Errorf("os.MkdirAll.%s", err)
+	}
+	err = dbuffer.openSegment()
+	if err != nil {
+		return nil, fmt.Errorf("openSegment.%s", err)
+	}
+	err = dbuffer.conveyAll()
+	if err != nil {
+		return nil, fmt.Errorf("conveyAll.%s", err)
+	}
+	return dbuffer, nil
+}
+
+// openSegment opens the segment for appends, once a tail left invalid by a crash is truncated, so that new records are read back after the valid ones
+func (b *diskBuffer) openSegment() (err error) {
+	path := filepath.Join(b.dir, diskSegmentName)
+	b.segmentSize, b.segmentDocs, b.segmentBytes, b.segmentChecksum = 0, 0, 0, pipeChecksum{}
+	info, err := os.Stat(path)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("os.Stat.%s", err)
+	}
+	if err == nil && info.Size() > 0 {
+		stored, valid, err := readDiskSegment(path, b.keyring, b.logger)
+		if err != nil {
+			return fmt.Errorf("readDiskSegment.%s", err)
+		}
+		if valid < info.Size() {
+			b.logger.Warn("segment truncated to its last valid record", "segment", path, "dropped_bytes", info.Size()-valid)
+			err = os.Truncate(path, valid)
+			if err != nil {
+				return fmt.Errorf("os.Truncate.%s", err)
+			}
+		}
+		b.segmentSize = valid
+		b.segmentDocs, b.segmentBytes, b.segmentChecksum = len(stored.documents), documentsBytes(stored.documents), stored.checksum
+	}
+	b.segment, err = os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("os.OpenFile.%s", err)
+	}
+	return nil
+}
+
+func (b *diskBuffer) Append(doc *collection.Document) error {
+	return b.AppendBatch(*doc)
+}
+
+func (b *diskBuffer) AppendBatch(documents ...collection.Document) error {
+	records, checksum, err := encodeDiskRecords(b.keyring, b.collection().Serialization.Storage, documents...)
+	if err != nil {
+		return fmt.Errorf("encodeDiskRecords.%s", err)
+	}
+	limits := b.collection().BufferLimits
+	if !limits.Bounded() {
+		_, err = b.tryAppend(documents, records, checksum)
+		return err
+	}
+	return admit(limits, documents, func() (bool, error) {
+		return b.tryAppend(documents, records, checksum)
+	}, func() (bool, error) {
+		return b.dropAndAppend(documents)
+	})
+}
+
+// tryAppend writes records to the segment if documents fit within collection limits
+func (b *diskBuffer) tryAppend(documents []collection.Document, records []byte, checksum pipeChecksum) (bool, error) {
+	b.Lock()
+	defer b.Unlock()
+	bytes := documentsBytes(documents)
+	if !b.collection().BufferLimits.Fits(b.segmentDocs+len(documents), b.segmentBytes+bytes) {
+		return false, nil
+	}
+	_, err := b.segment.Write(records)
+	if err != nil {
+		// records partially written, e.g. on a full disk, are cut off so that the next ones follow valid records
+		truncErr := b.segment.Truncate(b.segmentSize)
+		if truncErr != nil {
+			b.logger.Error("segment truncation failed", "error", truncErr)
+		}
+		return false, fmt.Errorf("Write.%s", err)
+	}
+	b.segmentSize += int64(len(records))
+	b.segmentDocs += len(documents)
+	b.segmentBytes += bytes
+	b.segmentChecksum.documents += checksum.documents
+	b.segmentChecksum.sum += checksum.sum
+	if b.fsync {
+		err = b.segment.Sync()
+		if err != nil {
+			return false, fmt.Errorf("Sync.%s", err)
+		}
+	}
+	b.flushIfThresholdReached()
+	return true, nil
+}
+
+// dropAndAppend rewrites the segment without its oldest documents so the new ones fit
+func (b *diskBuffer) dropAndAppend(documents []collection.Document) (bool, error) {
+	b.Lock()
+	defer b.Unlock()
+	segmentPath := filepath.Join(b.dir, diskSegmentName)
+	stored, _, err := readDiskSegment(segmentPath, b.keyring, b.logger)
+	if err != nil {
+		return false, fmt.Errorf("readDiskSegment.%s", err)
+	}
+	if len(stored.corrupted) > 0 {
+		b.corruptedDocuments.Add(int64(len(stored.corrupted)))
+		b.logger.Error("corrupted documents dropped", "documents", len(stored.corrupted))
+	}
+	var (
+		buffered = stored.documents
+		limits   = b.collection().BufferLimits
+		bytes    = documentsBytes(documents)
+		kept     = documentsBytes(buffered)
+		i        int
+	)
+	for i < len(buffered) && !limits.Fits(len(buffered)-i+len(documents), kept+bytes) {
+		kept -= int64(len(buffered[i].Body))
+		i++
+	}
+	records, _, err := encodeDiskRecords(b.keyring, b.collection().Serialization.Storage, append(buffered[i:], documents...)...)
+	if err != nil {
+		return false, fmt.Errorf("encodeDiskRecords.%s", err)
+	}
+	tmpPath := fmt.Sprintf("%s.tmp", segmentPath)
+	err = writeDiskFile(tmpPath, records)
+	if err != nil {
+		return false, fmt.Errorf("writeDiskFile.%s", err)
+	}
+	err = b.segment.Close()
+	if err != nil {
+		return false, fmt.Errorf("Close.%s", err)
+	}
+	err = os.Rename(tmpPath, segmentPath)
+	if err != nil {
+		return false, fmt.Errorf("os.Rename.%s", err)
+	}
+	err = b.openSegment()
+	if err != nil {
+		return false, fmt.Errorf("openSegment.%s", err)
+	}
+	b.flushIfThresholdReached()
+	return true, nil
+}
+
+// Flush turns the current segment into a pipe and starts its conveyance
+func (b *diskBuffer) Flush(ctx context.Context) (err error) {
+	b.Lock()
+	defer b.Unlock()
+	return b.flush()
+}
+
+// flushIfThresholdReached flushes the segment once it reached the threshold, the lock must be held.
+// Failures are logged only: appended documents are stored already, the flusher turns them into a pipe later.
+func (b *diskBuffer) flushIfThresholdReached() {
+	if !b.collection().FlushThresholdReached(b.segmentDocs, b.segmentBytes) {
+		return
+	}
+	err := b.flush()
+	if err != nil {
+		b.logger.Error("flush failed", "error", err)
+	}
+}
+
+// flush turns the current segment into a pipe, the lock must be held
+func (b *diskBuffer) flush() (err error) {
+	if b.segmentSize == 0 {
+		return nil
+	}
+	var (
+		startedAt = time.Now().UTC()
+		pipePath  = filepath.Join(b.pipesDir, fmt.Sprintf("%d.%s.wal", startedAt.UnixNano(), uuid.New()))
+	)
+	err = writeDiskFile(diskPipeChecksumPath(pipePath), []byte(b.segmentChecksum.String()))
+	if err != nil {
+		return fmt.Errorf("writeDiskFile.%s", err)
+	}
+	err = b.segment.Close()
+	if err != nil {
+		return fmt.Errorf("Close.%s", err)
+	}
+	err = os.Rename(filepath.Join(b.dir, diskSegmentName), pipePath)
+	if err != nil {
+		return fmt.Errorf("os.Rename.%s", err)
+	}
+	err = b.openSegment()
+	if err != nil {
+		return fmt.Errorf("openSegment.%s", err)
+	}
+	span := startFlushSpan(b.collection().Name, nil)
+	span.SetAttributes(trace.String("bulklog.pipe", filepath.Base(pipePath)))
+	span.End()
+	b.conveying.Add(1)
+	go func() {
+		b.conveyPipe(trace.ContextWith(b.ctx, span.Context()), pipePath, startedAt)
+		b.conveying.Done()
+	}()
+	return nil
+}
+
+// Flusher flushes every tick
+func (b *diskBuffer) Flusher() func() {
+	return func() {
+		b.flusherStarted()
+		defer b.flusherStopped()
+		var (
+			ticker = newFlushTicker(b.collection().FlushPeriod)
+			err    error
+		)
+		for {
+			select {
+			case <-b.close:
+				ticker.Stop()
+				return
+			case <-b.reloaded():
+				ticker.Stop()
+				ticker = newFlushTicker(b.collection().FlushPeriod)
+				b.flusherReloaded()
+			case <-ticker.C:
+				b.flushAttempted()
+				err = b.Flush(b.ctx)
+				if err != nil {
+					b.logger.Error("flush failed", "error", err)
+				}
+				break
+			}
+		}
+	}
+}
+
+// Close stops the flusher; unflushed documents remain on disk for the next start
+func (b *diskBuffer) Close() {
+	b.closeOnce.Do(func() {
+		b.stopFlusher()
+		b.Lock()
+		defer b.Unlock()
+		err := b.segment.Close()
+		if err != nil {
+			b.logger.Error("segment close failed", "error", err)
+		}
+	})
+}
+
+// Shutdown turns the current segment into a pipe and waits for pipes conveyance.
+// Pipes which are not conveyed before ctx is done are replayed on the next start.
+func (b *diskBuffer) Shutdown(ctx context.Context) error {
+	b.stopFlusher()
+	err := b.Flush(ctx)
+	if err != nil {
+		b.Close()
+		return fmt.Errorf("Flush.%s", err)
+	}
+	err = waitConveying(ctx, &b.conveying, b.cancel)
+	b.Close()
+	return err
+}
+
+func (b *diskBuffer) stopFlusher() {
+	b.stopOnce.Do(func() {
+		close(b.close)
+	})
+}
+
+// Ping checks the pipes directory is still there
+func (b *diskBuffer) Ping(ctx context.Context) error {
+	_, err := os.Stat(b.pipesDir)
+	if err != nil {
+		return fmt.Errorf("os.Stat.%s", err)
+	}
+	return nil
+}
+
+// bufferedBytes - body bytes of documents of the current segment
+func (b *diskBuffer) bufferedBytes() (int64, error) {
+	b.Lock()
+	defer b.Unlock()
+	return b.segmentBytes, nil
+}
+
+// Tail reads the last n documents of the current segment
+func (b *diskBuffer) Tail(n int) ([]collection.Document, error) {
+	b.Lock()
+	defer b.Unlock()
+	stored, _, err := readDiskSegment(b.segment.Name(), b.keyring, b.logger)
+	if err != nil {
+		return nil, fmt.Errorf("readDiskSegment.%s", err)
+	}
+	return lastDocuments(stored.documents, n), nil
+}
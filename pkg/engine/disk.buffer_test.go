@@ -0,0 +1,53 @@
+package engine
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/khezen/bulklog/pkg/collection"
+	"github.com/khezen/bulklog/pkg/config"
+	"github.com/khezen/bulklog/pkg/output"
+)
+
+// TestDiskAppendFlushFailure checks documents appended to the segment are acknowledged even if the flush they trigger fails,
+// clients retrying them would buffer them twice
+func TestDiskAppendFlushFailure(t *testing.T) {
+	collec := testCollection()
+	collec.FlushCount = 2
+	collec.BufferLimits = collection.BufferLimits{MaxDocuments: 2, Overflow: collection.DropOldest}
+	dir := t.TempDir()
+	out := &recordingOutput{}
+	buffer, err := DiskBuffer(collec, &config.Disk{Directory: dir}, nil, map[string]output.Interface{"out": out}, nil, nil, discardLogger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer buffer.Close()
+	// pipes cannot be created without their directory
+	pipesDir := filepath.Join(dir, "logs", diskPipesDir)
+	err = os.RemoveAll(pipesDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	docs := []collection.Document{testDocument(t, `{"n":1}`), testDocument(t, `{"n":2}`), testDocument(t, `{"n":3}`)}
+	for i := range docs {
+		// the second append reaches the flush count, the third drops the oldest document
+		err = buffer.Append(&docs[i])
+		if err != nil {
+			t.Fatalf("Append %d: %s", i, err)
+		}
+	}
+	err = os.Mkdir(pipesDir, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = buffer.Flush(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	digested := out.wait(t, 2)
+	if len(digested) != 2 || digested[0].ID != docs[1].ID || digested[1].ID != docs[2].ID {
+		t.Fatalf("digested %d documents, want the 2 latest appended", len(digested))
+	}
+}
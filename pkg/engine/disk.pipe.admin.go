@@ -0,0 +1,180 @@
+package engine
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/khezen/bulklog/pkg/collection"
+)
+
+// Pipes lists pipe segments pending on disk
+func (b *diskBuffer) Pipes() ([]Pipe, error) {
+	entries, err := ioutil.ReadDir(b.pipesDir)
+	if err != nil {
+		return nil, fmt.Errorf("ioutil.ReadDir.%s", err)
+	}
+	pipes := make([]Pipe, 0, len(entries))
+	for _, entry := range entries {
+		if !strings.HasSuffix(entry.Name(), ".wal") {
+			continue
+		}
+		pipe, err := b.getPipeState(entry.Name(), entry.Size())
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("getPipeState.%s", err)
+		}
+		pipes = append(pipes, pipe)
+	}
+	sortPipes(pipes)
+	return pipes, nil
+}
+
+// RetryPipe cuts short the wait of the pipe outputs
+func (b *diskBuffer) RetryPipe(id string) error {
+	_, err := b.findPipe(id)
+	if err != nil {
+		return err
+	}
+	if pipe := b.pipes.get(id); pipe != nil {
+		pipe.retry()
+	}
+	return nil
+}
+
+// DiscardPipe deletes a pipe segment and stops its conveyance
+func (b *diskBuffer) DiscardPipe(id string) error {
+	pipePath, err := b.findPipe(id)
+	if err != nil {
+		return err
+	}
+	if pipe := b.pipes.get(id); pipe != nil {
+		pipe.discard()
+	}
+	deleteDiskPipe(pipePath, b.logger.With("pipe", filepath.Base(pipePath)))
+	return nil
+}
+
+// PipeDocuments decodes the records of a pipe segment
+func (b *diskBuffer) PipeDocuments(id string, offset, limit int) ([]collection.Document, int, error) {
+	pipePath, err := b.findPipe(id)
+	if err != nil {
+		return nil, 0, err
+	}
+	stored, _, err := readDiskSegment(pipePath, b.keyring, b.logger)
+	if err != nil {
+		if _, statErr := os.Stat(pipePath); os.IsNotExist(statErr) {
+			return nil, 0, ErrPipeNotFound
+		}
+		return nil, 0, fmt.Errorf("readDiskSegment.%s", err)
+	}
+	return pageDocuments(stored.documents, offset, limit), len(stored.documents), nil
+}
+
+// RestorePipe writes a pipe segment named after its creation time, outputs it is not pending for being recorded as done beforehand
+func (b *diskBuffer) RestorePipe(id string, createdAt time.Time, outputNames []string, documents []collection.Document) (bool, error) {
+	_, err := b.findPipe(id)
+	if err == nil {
+		return false, nil
+	}
+	if err != ErrPipeNotFound {
+		return false, fmt.Errorf("findPipe.%s", err)
+	}
+	records, checksum, err := encodeDiskRecords(b.keyring, b.collection().Serialization.Storage, documents...)
+	if err != nil {
+		return false, fmt.Errorf("encodeDiskRecords.%s", err)
+	}
+	var (
+		pipePath = filepath.Join(b.pipesDir, fmt.Sprintf("%d.%s.wal", createdAt.UnixNano(), id))
+		pending  = make(map[string]struct{}, len(outputNames))
+		done     strings.Builder
+	)
+	for _, outputName := range outputNames {
+		pending[outputName] = struct{}{}
+	}
+	for outputName := range b.outputs() {
+		if _, ok := pending[outputName]; !ok {
+			fmt.Fprintln(&done, outputName)
+		}
+	}
+	err = writeDiskFile(fmt.Sprintf("%s.done", pipePath), []byte(done.String()))
+	if err != nil {
+		return false, fmt.Errorf("writeDiskFile.%s", err)
+	}
+	err = writeDiskFile(diskPipeChecksumPath(pipePath), []byte(checksum.String()))
+	if err != nil {
+		return false, fmt.Errorf("writeDiskFile.%s", err)
+	}
+	// pipes are listed and resumed once renamed, whole
+	tmpPath := fmt.Sprintf("%s.tmp", pipePath)
+	err = writeDiskFile(tmpPath, records)
+	if err != nil {
+		return false, fmt.Errorf("writeDiskFile.%s", err)
+	}
+	err = os.Rename(tmpPath, pipePath)
+	if err != nil {
+		return false, fmt.Errorf("os.Rename.%s", err)
+	}
+	b.conveying.Add(1)
+	go func() {
+		b.conveyPipe(b.ctx, pipePath, createdAt.UTC())
+		b.conveying.Done()
+	}()
+	return true, nil
+}
+
+func (b *diskBuffer) findPipe(id string) (string, error) {
+	if strings.ContainsAny(id, `./\`) {
+		return "", ErrPipeNotFound
+	}
+	matches, err := filepath.Glob(filepath.Join(b.pipesDir, fmt.Sprintf("*.%s.wal", id)))
+	if err != nil {
+		return "", fmt.Errorf("filepath.Glob.%s", err)
+	}
+	if len(matches) == 0 {
+		return "", ErrPipeNotFound
+	}
+	return matches[0], nil
+}
+
+// getPipeState reads a pipe segment, outputs which did not digest it yet
+// and their retry state as tracked by this process
+func (b *diskBuffer) getPipeState(name string, size int64) (pipe Pipe, err error) {
+	pipePath := filepath.Join(b.pipesDir, name)
+	startedAtUnixNano, err := strconv.ParseInt(strings.SplitN(name, ".", 2)[0], 10, 64)
+	if err != nil {
+		return pipe, fmt.Errorf("strconv.ParseInt.%s", err)
+	}
+	stored, _, err := readDiskSegment(pipePath, b.keyring, b.logger)
+	if err != nil {
+		if _, statErr := os.Stat(pipePath); os.IsNotExist(statErr) {
+			return pipe, statErr
+		}
+		return pipe, fmt.Errorf("readDiskSegment.%s", err)
+	}
+	done, err := getDiskPipeDone(fmt.Sprintf("%s.done", pipePath))
+	if err != nil {
+		return pipe, fmt.Errorf("getDiskPipeDone.%s", err)
+	}
+	remaining := make([]string, 0, len(b.outputs()))
+	for outputName := range b.outputs() {
+		if _, ok := done[outputName]; !ok {
+			remaining = append(remaining, outputName)
+		}
+	}
+	sort.Strings(remaining)
+	pipe.ID = diskPipeID(name)
+	pipe.CreatedAt = time.Unix(0, startedAtUnixNano).UTC()
+	pipe.ExpiresAt = pipe.CreatedAt.Add(b.current.Load().collection.RetentionPeriod)
+	pipe.Documents = len(stored.documents)
+	pipe.Bytes = size
+	pipe.Outputs = b.pipes.get(pipe.ID).outputs(remaining)
+	return pipe, nil
+}
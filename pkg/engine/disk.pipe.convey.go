@@ -0,0 +1,178 @@
+package engine
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/khezen/bulklog/pkg/collection"
+	"github.com/khezen/bulklog/pkg/output"
+	"github.com/khezen/bulklog/pkg/trace"
+)
+
+// conveyAll resumes conveyance of pipes left by a previous run, then reports them
+func (b *diskBuffer) conveyAll() error {
+	entries, err := ioutil.ReadDir(b.pipesDir)
+	if err != nil {
+		return fmt.Errorf("ioutil.ReadDir.%s", err)
+	}
+	var (
+		foundAt = time.Now().UTC()
+		found   = make([]Pipe, 0, len(entries))
+	)
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasSuffix(name, ".wal") {
+			continue
+		}
+		startedAtUnixNano, err := strconv.ParseInt(strings.SplitN(name, ".", 2)[0], 10, 64)
+		if err != nil {
+			b.logger.Error("unparsable pipe name", "pipe", name)
+			continue
+		}
+		pipe, err := b.getPipeState(name, entry.Size())
+		if err != nil {
+			b.logger.Error("pipe state read failed", "pipe", name, "error", err)
+		} else {
+			found = append(found, pipe)
+		}
+		go b.conveyPipe(b.ctx, filepath.Join(b.pipesDir, name), time.Unix(0, startedAtUnixNano).UTC())
+	}
+	b.recovered(found, foundAt, b.logger)
+	return nil
+}
+
+// conveyPipe delivers a pipe segment to outputs which did not digest it yet.
+// Outputs which succeed are recorded in {pipe}.done so a restart does not resend to them.
+// ctx carries the span which created the pipe, none for pipes left by a previous run.
+// Pipes whose conveyance is cancelled are left on disk for the next start.
+func (b *diskBuffer) conveyPipe(ctx context.Context, pipePath string, startedAt time.Time) {
+	settings := b.current.Load()
+	ctx = collection.WithPriority(ctx, settings.collection.Priority)
+	logger := b.logger.With("pipe", filepath.Base(pipePath))
+	stored, _, err := readDiskSegment(pipePath, b.keyring, logger)
+	if err != nil {
+		logger.Error("pipe read failed", "error", err)
+		return
+	}
+	checksum, err := getDiskPipeChecksum(pipePath)
+	if err != nil {
+		logger.Error("pipe checksum read failed", "error", err)
+	}
+	donePath := fmt.Sprintf("%s.done", pipePath)
+	done, err := getDiskPipeDone(donePath)
+	if err != nil {
+		logger.Error("pipe done outputs read failed", "error", err)
+		return
+	}
+	remainingOutputs := make(map[string]output.Interface)
+	for outputName, cons := range settings.outputs {
+		if _, ok := done[outputName]; !ok {
+			remainingOutputs[outputName] = cons
+		}
+	}
+	b.verify(stored, checksum, b.deadLetters, settings.collection.Name, startedAt, outputNames(remainingOutputs), logger)
+	documents := stored.documents
+	if len(documents) == 0 {
+		deleteDiskPipe(pipePath, logger)
+		return
+	}
+	if len(remainingOutputs) == 0 {
+		deleteDiskPipe(pipePath, logger)
+		return
+	}
+	var (
+		pipeID    = diskPipeID(filepath.Base(pipePath))
+		expiresAt = startedAt.Add(settings.collection.RetentionPeriod)
+	)
+	if time.Now().UTC().After(expiresAt) {
+		failures := make(map[string]error, len(remainingOutputs))
+		for outputName := range remainingOutputs {
+			failures[outputName] = nil
+		}
+		deadLetterPending(b.deadLetters, b.expiry, settings.collection.Name, pipeID, startedAt, expiresAt, failures, documents, nil, logger)
+		deleteDiskPipe(pipePath, logger)
+		return
+	}
+	var (
+		mu   sync.Mutex
+		pipe = b.pipes.track(pipeID)
+	)
+	defer b.pipes.untrack(pipeID, pipe)
+	span := startConveySpan(trace.FromContext(ctx), settings.collection.Name, documents)
+	span.SetAttributes(trace.String("bulklog.pipe", filepath.Base(pipePath)))
+	failures, pending := conveySince(trace.ContextWith(ctx, span.Context()), pipeID, documents, remainingOutputs, settings.collection, startedAt, b.deadLetters, b.expiry, func(outputName string) {
+		mu.Lock()
+		defer mu.Unlock()
+		if pipe.isDiscarded() {
+			return
+		}
+		err := addDiskPipeDone(donePath, outputName)
+		if err != nil {
+			logger.Error("pipe done output write failed", "output", outputName, "error", err)
+		}
+	}, pipe, logger)
+	span.SetAttributes(trace.Int("bulklog.outputs.failed", len(failures)))
+	span.End()
+	if pipe.isDiscarded() || ctx.Err() != nil {
+		return
+	}
+	deadLetterPending(b.deadLetters, b.expiry, settings.collection.Name, pipeID, startedAt, expiresAt, failures, documents, pending, logger)
+	deleteDiskPipe(pipePath, logger)
+}
+
+// diskPipeID returns the UUID of a pipe from its file name, {startedAtUnixNano}.{uuid}.wal
+func diskPipeID(name string) string {
+	parts := strings.Split(name, ".")
+	if len(parts) != 3 {
+		return ""
+	}
+	return parts[1]
+}
+
+func getDiskPipeDone(donePath string) (map[string]struct{}, error) {
+	done := make(map[string]struct{})
+	file, err := os.Open(donePath)
+	if os.IsNotExist(err) {
+		return done, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("os.Open.%s", err)
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		done[scanner.Text()] = struct{}{}
+	}
+	return done, scanner.Err()
+}
+
+func addDiskPipeDone(donePath, outputName string) error {
+	file, err := os.OpenFile(donePath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("os.OpenFile.%s", err)
+	}
+	defer file.Close()
+	_, err = fmt.Fprintln(file, outputName)
+	if err != nil {
+		return fmt.Errorf("Fprintln.%s", err)
+	}
+	return file.Sync()
+}
+
+func deleteDiskPipe(pipePath string, logger *slog.Logger) {
+	for _, path := range []string{pipePath, fmt.Sprintf("%s.done", pipePath), diskPipeChecksumPath(pipePath)} {
+		err := os.Remove(path)
+		if err != nil && !os.IsNotExist(err) {
+			logger.Error("pipe delete failed", "error", err)
+		}
+	}
+}
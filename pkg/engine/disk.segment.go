@@ -0,0 +1,151 @@
+package engine
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/khezen/bulklog/pkg/codec"
+	"github.com/khezen/bulklog/pkg/collection"
+	"github.com/khezen/bulklog/pkg/encryption"
+)
+
+// segment record layout: | length uint32 | crc32 uint32 | encoded document, encrypted if configured |
+const diskRecordHeaderLen = 8
+
+// diskMaxRecordLen bounds encoded documents, so that a corrupted length does not allocate gigabytes on read
+const diskMaxRecordLen = 256 << 20
+
+// encodeDiskRecords returns the records of documents, and their checksum as pipes record it
+func encodeDiskRecords(keyring *encryption.Keyring, format collection.StorageFormat, documents ...collection.Document) ([]byte, pipeChecksum, error) {
+	var (
+		out      bytes.Buffer
+		header   = make([]byte, diskRecordHeaderLen)
+		checksum pipeChecksum
+	)
+	for i := range documents {
+		encoded, err := codec.Marshal(format, &documents[i])
+		if err != nil {
+			return nil, checksum, fmt.Errorf("codec.Marshal.%s", err)
+		}
+		encoded, err = sealEntry(keyring, encoded)
+		if err != nil {
+			return nil, checksum, fmt.Errorf("sealEntry.%s", err)
+		}
+		if len(encoded) > diskMaxRecordLen {
+			return nil, checksum, ErrRecordTooLarge
+		}
+		crc := crc32.ChecksumIEEE(encoded)
+		binary.BigEndian.PutUint32(header[0:4], uint32(len(encoded)))
+		binary.BigEndian.PutUint32(header[4:8], crc)
+		out.Write(header)
+		out.Write(encoded)
+		checksum.add(crc)
+	}
+	return out.Bytes(), checksum, nil
+}
+
+// readDiskSegment decodes every record of a segment file, the checksum of a record being its crc.
+// A truncated or corrupted tail, left by a crash during a write, is ignored: valid is the offset it starts at, the size of the file otherwise.
+func readDiskSegment(path string, keyring *encryption.Keyring, logger *slog.Logger) (stored storedDocuments, valid int64, err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return stored, 0, fmt.Errorf("os.Open.%s", err)
+	}
+	defer file.Close()
+	var (
+		reader  = bufio.NewReader(file)
+		header  = make([]byte, diskRecordHeaderLen)
+		payload []byte
+	)
+	stored.documents = make([]collection.Document, 0)
+	for {
+		_, err = io.ReadFull(reader, header)
+		if err == io.EOF {
+			return stored, valid, nil
+		}
+		if err != nil {
+			logger.Warn("truncated record header", "segment", path)
+			return stored, valid, nil
+		}
+		length := binary.BigEndian.Uint32(header[0:4])
+		if length > diskMaxRecordLen {
+			logger.Warn("corrupted record header", "segment", path)
+			return stored, valid, nil
+		}
+		payload = make([]byte, length)
+		_, err = io.ReadFull(reader, payload)
+		if err != nil {
+			logger.Warn("truncated record", "segment", path)
+			return stored, valid, nil
+		}
+		crc := crc32.ChecksumIEEE(payload)
+		if crc != binary.BigEndian.Uint32(header[4:8]) {
+			logger.Warn("corrupted record", "segment", path)
+			return stored, valid, nil
+		}
+		valid += diskRecordHeaderLen + int64(length)
+		stored.checksum.add(crc)
+		payload, err = openEntry(keyring, payload)
+		if err != nil {
+			return stored, valid, fmt.Errorf("openEntry.%s", err)
+		}
+		doc, err := codec.Unmarshal(payload)
+		if err == ErrCorruptedDocument {
+			stored.corrupted = append(stored.corrupted, doc)
+			continue
+		}
+		if err != nil {
+			return stored, valid, fmt.Errorf("codec.Unmarshal.%s", err)
+		}
+		stored.documents = append(stored.documents, doc)
+	}
+}
+
+// diskPipeChecksumPath - file recording the checksum of a pipe segment on flush
+func diskPipeChecksumPath(pipePath string) string {
+	return fmt.Sprintf("%s.sum", pipePath)
+}
+
+// getDiskPipeChecksum reads the checksum of a pipe segment, nil if it was flushed without one
+func getDiskPipeChecksum(pipePath string) (*pipeChecksum, error) {
+	content, err := ioutil.ReadFile(diskPipeChecksumPath(pipePath))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ioutil.ReadFile.%s", err)
+	}
+	checksum, err := parsePipeChecksum(strings.TrimSpace(string(content)))
+	if err != nil {
+		return nil, err
+	}
+	return &checksum, nil
+}
+
+// writeDiskFile writes and syncs a whole file
+func writeDiskFile(path string, content []byte) error {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("os.OpenFile.%s", err)
+	}
+	_, err = file.Write(content)
+	if err == nil {
+		err = file.Sync()
+	}
+	closeErr := file.Close()
+	if err != nil {
+		return fmt.Errorf("Write.%s", err)
+	}
+	if closeErr != nil {
+		return fmt.Errorf("Close.%s", closeErr)
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package engine
+
+import (
+	"fmt"
+
+	"github.com/khezen/bulklog/pkg/encryption"
+)
+
+// encryptedMarker starts entries and segment records sealed by the keyring, whatever they hold once opened.
+// Neither plaintext entries nor records start with it, so those buffered before encryption was enabled are still decoded.
+const encryptedMarker = 0x02
+
+// sealEntry encrypts an encoded entry, as is if encryption is disabled
+func sealEntry(keyring *encryption.Keyring, entry []byte) ([]byte, error) {
+	if keyring == nil {
+		return entry, nil
+	}
+	sealed, err := keyring.Seal(entry)
+	if err != nil {
+		return nil, fmt.Errorf("Seal.%s", err)
+	}
+	return append([]byte{encryptedMarker}, sealed...), nil
+}
+
+// openEntry decrypts entries sealed by sealEntry, and returns plaintext ones as is
+func openEntry(keyring *encryption.Keyring, entry []byte) ([]byte, error) {
+	if len(entry) == 0 || entry[0] != encryptedMarker {
+		return entry, nil
+	}
+	if keyring == nil {
+		return nil, ErrEncrypted
+	}
+	opened, err := keyring.Open(entry[1:])
+	if err != nil {
+		return nil, fmt.Errorf("Open.%s", err)
+	}
+	return opened, nil
+}
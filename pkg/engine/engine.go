@@ -1,82 +1,251 @@
 package engine
 
 import (
+	"context"
 	"fmt"
+	"log/slog"
+	"sync"
 
+	"github.com/google/uuid"
 	"github.com/khezen/bulklog/pkg/collection"
 	"github.com/khezen/bulklog/pkg/config"
+	"github.com/khezen/bulklog/pkg/encryption"
 	"github.com/khezen/bulklog/pkg/output"
+	"github.com/khezen/bulklog/pkg/tenant"
+	"github.com/khezen/bulklog/pkg/trace"
 )
 
 // Indexer indexes document in bulk request to elasticsearch
 type engine struct {
-	schemas map[collection.Name]map[collection.SchemaName]struct{}
-	buffers map[collection.Name]Buffer
+	// RWMutex guards the maps below, reloads replace them rather than mutate them
+	sync.RWMutex
+	schemas     map[collection.Name]map[collection.SchemaName]struct{}
+	buffers     map[collection.Name]Buffer
+	collections map[collection.Name]*collection.Collection
+	outputs     map[string]output.Interface
+	dedups      map[collection.Name]deduplicator
+	autoCreate  config.AutoCreate
+	tenancy     tenant.Config
+	// collections of tenants, named {tenant}.{collection}
+	tenantCollections map[collection.Name]tenantCollection
+	tenants           *tenant.Tracker
+	deadLetters       DeadLetters
+	expiry            *ExpiryNotifier
+	// keyring encrypts documents buffered in redis and on disk, nil unless persistence encryption is configured
+	keyring     *encryption.Keyring
+	logger      *slog.Logger
+	pingOutputs bool
+	// settings the current collections and outputs were built from, to detect changes on reload
+	reloading      sync.Mutex
+	collectionsCfg map[collection.Name]collection.Config
+	persistence    map[collection.Name]config.Persistence
+	outputsCfg     output.Config
+	deadLetterCfg  config.DeadLetter
+	pipeExpiryCfg  config.PipeExpiry
+	persistenceCfg config.Persistence
+	// collections created on the fly, guarded by reloading
+	autoCreated map[collection.Name]struct{}
+	// buffers of removed collections being drained
+	draining sync.WaitGroup
+	// appends of documents acknowledged asynchronously, asyncAppends holding a slot for each of them
+	appending    sync.WaitGroup
+	asyncAppends chan struct{}
+	pauses       *pauses
 }
 
 // New - Create new service for serving web REST requests
-func New(cfg *config.Config) (Engine, error) {
+func New(cfg *config.Config, logger *slog.Logger) (Engine, error) {
 	outputs, err := output.NewOutputs(&cfg.Output)
 	if err != nil {
 		return nil, fmt.Errorf("output.Newoutputs.%s", err)
 	}
-	schemas := make(map[collection.Name]map[collection.SchemaName]struct{})
-	buffers := make(map[collection.Name]Buffer)
+	pauses := newPauses()
+	outputs = output.NewGates(outputs, pauses.deliveries)
+	deadLetters, err := NewDeadLetters(cfg, outputs)
+	if err != nil {
+		return nil, fmt.Errorf("NewDeadLetters.%s", err)
+	}
+	expiry, err := NewExpiryNotifier(cfg.PipeExpiry)
+	if err != nil {
+		return nil, fmt.Errorf("NewExpiryNotifier.%s", err)
+	}
+	keyring, err := encryption.New(cfg.Persistence.Encryption)
+	if err != nil {
+		return nil, fmt.Errorf("encryption.New.%s", err)
+	}
+	e := &engine{
+		schemas:           make(map[collection.Name]map[collection.SchemaName]struct{}),
+		buffers:           make(map[collection.Name]Buffer),
+		collections:       make(map[collection.Name]*collection.Collection),
+		outputs:           outputs,
+		dedups:            make(map[collection.Name]deduplicator),
+		autoCreate:        cfg.AutoCreate,
+		tenancy:           cfg.Tenancy,
+		tenants:           tenant.NewTracker(cfg.Tenancy),
+		deadLetters:       deadLetters,
+		expiry:            expiry,
+		keyring:           keyring,
+		logger:            logger,
+		pingOutputs:       cfg.Health.PingOutputs,
+		collectionsCfg:    make(map[collection.Name]collection.Config),
+		persistence:       make(map[collection.Name]config.Persistence),
+		outputsCfg:        cfg.Output,
+		deadLetterCfg:     cfg.DeadLetter,
+		pipeExpiryCfg:     cfg.PipeExpiry,
+		persistenceCfg:    cfg.Persistence,
+		autoCreated:       make(map[collection.Name]struct{}),
+		tenantCollections: make(map[collection.Name]tenantCollection),
+		asyncAppends:      make(chan struct{}, maxAsyncAppends),
+		pauses:            pauses,
+	}
 	for _, collecCfg := range cfg.Collections {
-		collec, err := collection.New(collecCfg)
+		collec, err := newCollection(collecCfg, outputs)
 		if err != nil {
-			return nil, fmt.Errorf("collection.New.%s", err)
+			return nil, err
 		}
-		for _, cons := range outputs {
-			err = cons.Ensure(collec)
-			if err != nil {
-				return nil, fmt.Errorf("Ensure.%s", err)
-			}
+		persistence := cfg.Persistence.Of(collec.Name)
+		buffer, err := newBuffer(collec, persistence, keyring, outputs, deadLetters, expiry, logger.With("collection", collec.Name))
+		if err != nil {
+			return nil, fmt.Errorf("newBuffer(%s).%s", collec.Name, err)
 		}
-		schemas[collec.Name] = make(map[collection.SchemaName]struct{})
-		for _, schema := range collec.Schemas {
-			schemas[collec.Name][schema.Name] = struct{}{}
+		e.schemas[collec.Name] = schemaNames(collec)
+		e.collections[collec.Name] = collec
+		e.buffers[collec.Name] = buffer
+		e.dedups[collec.Name] = newDeduplicator(collec, persistence)
+		e.collectionsCfg[collec.Name] = collecCfg
+		e.persistence[collec.Name] = persistence
+		go buffer.Flusher()()
+	}
+	return e, nil
+}
+
+// newCollection builds a collection and ensures outputs are ready to digest it
+func newCollection(collecCfg collection.Config, outputs map[string]output.Interface) (*collection.Collection, error) {
+	collec, err := collection.New(collecCfg)
+	if err != nil {
+		return nil, fmt.Errorf("collection.New.%s", err)
+	}
+	for _, cons := range outputs {
+		err = cons.Ensure(context.Background(), collec)
+		if err != nil {
+			return nil, fmt.Errorf("Ensure.%s", err)
 		}
-		var buffer Buffer
-		if cfg.Persistence.Enabled {
-			buffer = RedisBuffer(collec, &cfg.Persistence.Redis, outputs)
-		} else {
-			buffer = DefaultBuffer(collec, outputs)
+	}
+	return collec, nil
+}
+
+func schemaNames(collec *collection.Collection) map[collection.SchemaName]struct{} {
+	names := make(map[collection.SchemaName]struct{}, len(collec.Schemas))
+	for _, schema := range collec.Schemas {
+		names[schema.Name] = struct{}{}
+	}
+	return names
+}
+
+func newBuffer(collec *collection.Collection, persistence config.Persistence, keyring *encryption.Keyring, outputs map[string]output.Interface, deadLetters DeadLetters, expiry *ExpiryNotifier, logger *slog.Logger) (Buffer, error) {
+	if !persistence.Enabled {
+		return DefaultBuffer(collec, outputs, deadLetters, expiry, logger), nil
+	}
+	switch persistence.Engine {
+	case config.RedisEngine, "":
+		return RedisBuffer(collec, &persistence.Redis, keyring, outputs, deadLetters, expiry, logger), nil
+	case config.KafkaEngine:
+		buffer, err := KafkaBuffer(collec, &persistence.Kafka, outputs, deadLetters, expiry, logger)
+		if err != nil {
+			return nil, fmt.Errorf("KafkaBuffer.%s", err)
 		}
-		buffers[collec.Name] = buffer
-		if collec.FlushPeriod > 0 {
-			go buffer.Flusher()()
+		return buffer, nil
+	case config.MemoryEngine:
+		return MemoryBuffer(collec, &persistence.Memory, outputs, deadLetters, expiry, logger), nil
+	case config.DiskEngine:
+		buffer, err := DiskBuffer(collec, &persistence.Disk, keyring, outputs, deadLetters, expiry, logger)
+		if err != nil {
+			return nil, fmt.Errorf("DiskBuffer.%s", err)
 		}
+		return buffer, nil
+	default:
+		return nil, ErrUnknownEngine
 	}
-	return &engine{
-		schemas,
-		buffers,
-	}, nil
 }
 
 // Collect document
-func (e *engine) Collect(collectionName collection.Name, schemaName collection.SchemaName, docBytes []byte) (err error) {
-	_, ok := e.schemas[collectionName]
-	if !ok {
-		return ErrNotFound
+func (e *engine) Collect(ctx context.Context, collectionName collection.Name, schemaName collection.SchemaName, docBytes []byte) (err error) {
+	collec, err := e.collectionOf(ctx, collectionName, schemaName)
+	if err != nil {
+		return err
 	}
-	if _, ok := e.schemas[collectionName][schemaName]; !ok {
-		return ErrNotFound
+	if e.pauses.rejects(collec.Name) {
+		return ErrCollectionPaused
+	}
+	document, err := collec.NewDocument(ctx, schemaName, docBytes)
+	if err == collection.ErrDropped {
+		return nil
+	}
+	if err != nil {
+		return documentError(err)
+	}
+	document.TraceParent = trace.FromContext(ctx).Traceparent()
+	documents, claimed, err := e.deduplicate(collec, []collection.Document{*document})
+	if err != nil {
+		return fmt.Errorf("deduplicate.%s", err)
+	}
+	if len(documents) == 0 {
+		return nil
+	}
+	documents, err = e.reroute(ctx, collec, documents)
+	if err != nil {
+		e.releaseClaimed(collec.Name, claimed)
+		return err
 	}
-	document, err := collection.NewDocument(collectionName, schemaName, docBytes)
+	err = e.reserve(ctx, documents)
 	if err != nil {
-		return fmt.Errorf("collection.NewDocument.%s", err)
+		e.releaseClaimed(collec.Name, claimed)
+		return err
+	}
+	positions := map[uuid.UUID][]int{document.ID: {0}}
+	if e.appendAsync(ctx, collec, documents, claimed) {
+		collection.RecordReceipts(ctx, positions, documents)
+		return nil
+	}
+	if len(collec.Reroutes) > 0 {
+		err = e.dispatchRerouted(documents)
+	} else {
+		err = e.Dispatch(document)
+	}
+	if err != nil {
+		e.releaseClaimed(collec.Name, claimed)
+		e.release(ctx, documents)
+	}
+	if err == ErrBufferFull || err == ErrBufferOverflow || err == ErrNotFound {
+		return err
 	}
-	err = e.Dispatch(document)
 	if err != nil {
 		return fmt.Errorf("Dispatch.%s", err)
 	}
+	collection.RecordReceipts(ctx, positions, documents)
 	return nil
 }
 
 // Dispatch takes incoming message into Elasticsearch
 func (e *engine) Dispatch(document *collection.Document) (err error) {
-	err = e.buffers[document.CollectionName].Append(document)
+	documents := []collection.Document{*document}
+	span := startAppendSpan(documents)
+	defer func() {
+		span.SetError(err)
+		span.End()
+	}()
+	document.TraceParent = documents[0].TraceParent
+	// the read lock keeps the buffer of a collection removed by a reload from being drained while appending
+	e.RLock()
+	defer e.RUnlock()
+	buffer, ok := e.buffers[document.CollectionName]
+	if !ok {
+		return ErrNotFound
+	}
+	err = buffer.Append(document)
+	if err == ErrBufferFull || err == ErrBufferOverflow {
+		return err
+	}
 	if err != nil {
 		return fmt.Errorf("Append.%s", err)
 	}
@@ -84,40 +253,343 @@ func (e *engine) Dispatch(document *collection.Document) (err error) {
 }
 
 // Collect document
-func (e *engine) CollectBatch(collectionName collection.Name, schemaName collection.SchemaName, docBytesSlice ...[]byte) (err error) {
-	_, ok := e.schemas[collectionName]
-	if !ok {
-		return ErrNotFound
+func (e *engine) CollectBatch(ctx context.Context, collectionName collection.Name, schemaName collection.SchemaName, docBytesSlice ...[]byte) (err error) {
+	collec, err := e.collectionOf(ctx, collectionName, schemaName)
+	if err != nil {
+		return err
 	}
-	if _, ok := e.schemas[collectionName][schemaName]; !ok {
-		return ErrNotFound
+	if e.pauses.rejects(collec.Name) {
+		return ErrCollectionPaused
 	}
 	length := len(docBytesSlice)
 	if length > 0 {
 		documents := make([]collection.Document, 0, length)
-		var docBytes []byte
-		for _, docBytes = range docBytesSlice {
-			document, err := collection.NewDocument(collectionName, schemaName, docBytes)
+		var (
+			positions   = make(map[uuid.UUID][]int, length)
+			traceParent = trace.FromContext(ctx).Traceparent()
+		)
+		for i, docBytes := range docBytesSlice {
+			document, err := collec.NewDocument(ctx, schemaName, docBytes)
+			if err == collection.ErrDropped {
+				continue
+			}
 			if err != nil {
-				return fmt.Errorf("collection.NewDocument.%s", err)
+				return documentError(err)
 			}
+			document.TraceParent = traceParent
 			documents = append(documents, *document)
+			positions[document.ID] = append(positions[document.ID], i)
+		}
+		documents, claimed, err := e.deduplicate(collec, documents)
+		if err != nil {
+			return fmt.Errorf("deduplicate.%s", err)
+		}
+		documents, err = e.reroute(ctx, collec, documents)
+		if err != nil {
+			e.releaseClaimed(collec.Name, claimed)
+			return err
+		}
+		err = e.reserve(ctx, documents)
+		if err != nil {
+			e.releaseClaimed(collec.Name, claimed)
+			return err
+		}
+		if e.appendAsync(ctx, collec, documents, claimed) {
+			collection.RecordReceipts(ctx, positions, documents)
+			return nil
+		}
+		err = e.dispatchRerouted(documents)
+		if err != nil {
+			e.releaseClaimed(collec.Name, claimed)
+			e.release(ctx, documents)
+		}
+		if err == ErrBufferFull || err == ErrBufferOverflow || err == ErrNotFound {
+			return err
 		}
-		err = e.DispatchBatch(documents...)
 		if err != nil {
 			return fmt.Errorf("Dispatch.%s", err)
 		}
+		collection.RecordReceipts(ctx, positions, documents)
 	}
 	return nil
 }
 
+// CollectBulk appends parsable documents in a single batch; unparsable ones are skipped
+// and reported at their position in the returned slice, dropped ones are not reported.
+func (e *engine) CollectBulk(ctx context.Context, collectionName collection.Name, schemaName collection.SchemaName, docBytesSlice ...[]byte) ([]error, error) {
+	collec, err := e.collectionOf(ctx, collectionName, schemaName)
+	if err != nil {
+		return nil, err
+	}
+	if e.pauses.rejects(collec.Name) {
+		return nil, ErrCollectionPaused
+	}
+	var (
+		errs        = make([]error, len(docBytesSlice))
+		documents   = make([]collection.Document, 0, len(docBytesSlice))
+		positions   = make(map[uuid.UUID][]int, len(docBytesSlice))
+		traceParent = trace.FromContext(ctx).Traceparent()
+	)
+	for i, docBytes := range docBytesSlice {
+		document, err := collec.NewDocument(ctx, schemaName, docBytes)
+		if err == collection.ErrDropped {
+			continue
+		}
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+		document.TraceParent = traceParent
+		documents = append(documents, *document)
+		positions[document.ID] = append(positions[document.ID], i)
+	}
+	documents, claimed, err := e.deduplicate(collec, documents)
+	if err != nil {
+		return nil, fmt.Errorf("deduplicate.%s", err)
+	}
+	if len(documents) == 0 {
+		return errs, nil
+	}
+	documents, err = e.reroute(ctx, collec, documents)
+	if err != nil {
+		e.releaseClaimed(collec.Name, claimed)
+		return nil, err
+	}
+	err = e.reserve(ctx, documents)
+	if err != nil {
+		e.releaseClaimed(collec.Name, claimed)
+		return nil, err
+	}
+	if e.appendAsync(ctx, collec, documents, claimed) {
+		collection.RecordReceipts(ctx, positions, documents)
+		return errs, nil
+	}
+	err = e.dispatchRerouted(documents)
+	if err != nil {
+		e.releaseClaimed(collec.Name, claimed)
+		e.release(ctx, documents)
+	}
+	if err == ErrBufferFull || err == ErrBufferOverflow || err == ErrNotFound {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Dispatch.%s", err)
+	}
+	collection.RecordReceipts(ctx, positions, documents)
+	return errs, nil
+}
+
 // Dispatch takes incoming message into Elasticsearch
 func (e *engine) DispatchBatch(documents ...collection.Document) (err error) {
 	if len(documents) > 0 {
-		err = e.buffers[documents[0].CollectionName].AppendBatch(documents...)
+		span := startAppendSpan(documents)
+		defer func() {
+			span.SetError(err)
+			span.End()
+		}()
+		e.RLock()
+		defer e.RUnlock()
+		buffer, ok := e.buffers[documents[0].CollectionName]
+		if !ok {
+			return ErrNotFound
+		}
+		err = buffer.AppendBatch(documents...)
+		if err == ErrBufferFull || err == ErrBufferOverflow {
+			return err
+		}
 		if err != nil {
 			return fmt.Errorf("Append.%s", err)
 		}
 	}
 	return nil
 }
+
+// collectionOf - collection of given name if it defines given schema, ErrNotFound otherwise.
+// Unknown collections are created on the fly if auto creation is enabled.
+// If ctx carries a tenant, it is the collection of the tenant, created on the fly as well unless max_tenants is reached.
+func (e *engine) collectionOf(ctx context.Context, collectionName collection.Name, schemaName collection.SchemaName) (*collection.Collection, error) {
+	e.RLock()
+	_, exists := e.collections[collectionName]
+	autoCreate := e.autoCreate.Enabled
+	tenancy := e.tenancy.Enabled
+	e.RUnlock()
+	if !exists && autoCreate {
+		e.createCollection(collectionName)
+	}
+	if tenantID := tenant.ID(ctx); tenantID != "" && tenancy {
+		var err error
+		collectionName, err = e.tenantCollectionOf(tenantID, collectionName)
+		if err != nil {
+			return nil, err
+		}
+	}
+	e.RLock()
+	defer e.RUnlock()
+	if _, ok := e.schemas[collectionName][schemaName]; !ok {
+		return nil, ErrNotFound
+	}
+	return e.collections[collectionName], nil
+}
+
+// MaxBodySize - body limit of the collection, 0 if it sets none or does not define given schema
+func (e *engine) MaxBodySize(ctx context.Context, collectionName collection.Name, schemaName collection.SchemaName) int64 {
+	collec, err := e.collectionOf(ctx, collectionName, schemaName)
+	if err != nil {
+		return 0
+	}
+	return collec.MaxBodySize
+}
+
+// documentError returns errors of invalid documents as is, so they are answered as such
+func documentError(err error) error {
+	if _, ok := err.(*collection.SchemaViolation); ok || err == collection.ErrUnparsableJSON || err == collection.ErrWrongDocumentID {
+		return err
+	}
+	return fmt.Errorf("collection.NewDocument.%s", err)
+}
+
+// Shutdown drains every collection buffer concurrently until ctx is done,
+// once documents acknowledged asynchronously are appended
+func (e *engine) Shutdown(ctx context.Context) error {
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+	)
+	err := waitConveying(ctx, &e.appending, nil)
+	if err != nil {
+		e.logger.Error("documents acknowledged asynchronously were not all appended", "error", err)
+	}
+	e.RLock()
+	buffers := e.buffers
+	e.RUnlock()
+	for name, buffer := range buffers {
+		wg.Add(1)
+		go func(name collection.Name, buffer Buffer) {
+			defer wg.Done()
+			err := buffer.Shutdown(ctx)
+			if err != nil {
+				e.logger.Error("shutdown failed", "collection", name, "error", err)
+				mu.Lock()
+				if firstErr == nil {
+					firstErr = fmt.Errorf("Shutdown(%s).%s", name, err)
+				}
+				mu.Unlock()
+			}
+		}(name, buffer)
+	}
+	wg.Wait()
+	err = waitConveying(ctx, &e.draining, nil)
+	if err != nil && firstErr == nil {
+		firstErr = fmt.Errorf("draining.%s", err)
+	}
+	return firstErr
+}
+
+// Redrive conveys dead letters of a collection again to the outputs which failed to digest them.
+// It returns the number of redriven documents.
+func (e *engine) Redrive(collectionName collection.Name) (int, error) {
+	e.RLock()
+	collec, ok := e.collections[collectionName]
+	currentOutputs := e.outputs
+	e.RUnlock()
+	if !ok {
+		return 0, ErrNotFound
+	}
+	if e.deadLetters == nil {
+		return 0, ErrRedriveUnsupported
+	}
+	letters, err := e.deadLetters.Drain(collectionName)
+	if err == ErrRedriveUnsupported {
+		return 0, err
+	}
+	if err != nil {
+		return 0, fmt.Errorf("Drain.%s", err)
+	}
+	documents := 0
+	for _, letter := range letters {
+		outputs := make(map[string]output.Interface)
+		for outputName := range letter.Failures {
+			if cons, ok := currentOutputs[outputName]; ok {
+				outputs[outputName] = cons
+			}
+		}
+		if len(outputs) == 0 {
+			continue
+		}
+		documents += len(letter.Documents)
+		go convey(context.Background(), letter.Documents, outputs, collec, e.deadLetters, e.expiry, e.logger.With("collection", collectionName))
+	}
+	return documents, nil
+}
+
+// Pipes lists pending pipes of a collection
+func (e *engine) Pipes(collectionName collection.Name) ([]Pipe, error) {
+	inspector, err := e.pipeInspector(collectionName)
+	if err != nil {
+		return nil, err
+	}
+	return inspector.Pipes()
+}
+
+// RetryPipe retries outputs of a pending pipe immediately
+func (e *engine) RetryPipe(collectionName collection.Name, id string) error {
+	inspector, err := e.pipeInspector(collectionName)
+	if err != nil {
+		return err
+	}
+	return inspector.RetryPipe(id)
+}
+
+// DiscardPipe deletes a pending pipe without dead lettering it
+func (e *engine) DiscardPipe(collectionName collection.Name, id string) error {
+	inspector, err := e.pipeInspector(collectionName)
+	if err != nil {
+		return err
+	}
+	return inspector.DiscardPipe(id)
+}
+
+// PipeDocuments returns up to limit documents of a pending pipe from offset on, decoded
+func (e *engine) PipeDocuments(collectionName collection.Name, id string, offset, limit int) (PipeDocuments, error) {
+	inspector, err := e.pipeInspector(collectionName)
+	if err != nil {
+		return PipeDocuments{}, err
+	}
+	documents, total, err := inspector.PipeDocuments(id, offset, limit)
+	if err != nil {
+		return PipeDocuments{}, err
+	}
+	return PipeDocuments{bufferedDocuments(documents), offset, total}, nil
+}
+
+// Outputs reports the circuit state and worker pool usage of outputs
+func (e *engine) Outputs() []output.State {
+	e.RLock()
+	outputs := e.outputs
+	e.RUnlock()
+	return output.States(outputs)
+}
+
+// Tenants reports the documents collected by each tenant and the bytes its collections buffer
+func (e *engine) Tenants() []tenant.Usage {
+	usages := e.tenants.Usage()
+	for i := range usages {
+		usages[i].BufferedBytes = e.tenantBufferedBytes(usages[i].Tenant)
+	}
+	return usages
+}
+
+func (e *engine) pipeInspector(collectionName collection.Name) (PipeInspector, error) {
+	e.RLock()
+	buffer, ok := e.buffers[collectionName]
+	e.RUnlock()
+	if !ok {
+		return nil, ErrNotFound
+	}
+	inspector, ok := buffer.(PipeInspector)
+	if !ok {
+		return nil, ErrPipesUnsupported
+	}
+	return inspector, nil
+}
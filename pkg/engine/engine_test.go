@@ -0,0 +1,67 @@
+package engine
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/khezen/bulklog/pkg/collection"
+)
+
+var discardLogger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+// recordingOutput digests documents by recording them
+type recordingOutput struct {
+	mu        sync.Mutex
+	documents []collection.Document
+}
+
+func (o *recordingOutput) Digest(ctx context.Context, documents []collection.Document) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.documents = append(o.documents, documents...)
+	return nil
+}
+
+func (o *recordingOutput) Ensure(ctx context.Context, collec *collection.Collection) error {
+	return nil
+}
+
+// wait returns the documents digested once there are n of them
+func (o *recordingOutput) wait(t *testing.T, n int) []collection.Document {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		o.mu.Lock()
+		documents := o.documents
+		o.mu.Unlock()
+		if len(documents) >= n {
+			return documents
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("output digested %d documents, want %d", len(documents), n)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func testCollection() *collection.Collection {
+	return &collection.Collection{
+		Name:            "logs",
+		FlushPeriod:     time.Hour,
+		RetentionPeriod: time.Hour,
+		Backoff:         collection.Backoff{Base: 10 * time.Millisecond, Multiplier: 2, MaxInterval: 100 * time.Millisecond},
+	}
+}
+
+func testDocument(t *testing.T, body string) collection.Document {
+	t.Helper()
+	doc, err := collection.NewDocument("logs", "event", []byte(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return *doc
+}
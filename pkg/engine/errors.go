@@ -1,8 +1,54 @@
 package engine
 
-import "errors"
+import (
+	"errors"
+
+	"github.com/khezen/bulklog/pkg/codec"
+)
 
 var (
 	// ErrNotFound -
 	ErrNotFound = errors.New("ErrNotFound")
+	// ErrBufferFull -
+	ErrBufferFull = errors.New("ErrBufferFull - buffer capacity has been reached")
+	// ErrBufferOverflow - collection buffer limits have been reached
+	ErrBufferOverflow = errors.New("ErrBufferOverflow - collection buffer is full, retry later")
+	// ErrUnsupportedBufferLimits -
+	ErrUnsupportedBufferLimits = errors.New("ErrUnsupportedBufferLimits - kafka engine does not support buffer limits")
+	// ErrUnknownDeadLetterDestination -
+	ErrUnknownDeadLetterDestination = errors.New("ErrUnknownDeadLetterDestination - dead letter destination must be one of redis|file|output")
+	// ErrDeadLetterOutputNotFound -
+	ErrDeadLetterOutputNotFound = errors.New("ErrDeadLetterOutputNotFound - dead letter output must be a configured output")
+	// ErrRedriveUnsupported -
+	ErrRedriveUnsupported = errors.New("ErrRedriveUnsupported - dead letters sent to an output cannot be redriven")
+	// ErrPipeNotFound -
+	ErrPipeNotFound = errors.New("ErrPipeNotFound - pipe is not pending anymore")
+	// ErrPipesUnsupported -
+	ErrPipesUnsupported = errors.New("ErrPipesUnsupported - pipes of memory and kafka engines cannot be managed, nor restored to kafka ones")
+	// ErrTailUnsupported -
+	ErrTailUnsupported = errors.New("ErrTailUnsupported - buffers of kafka engine cannot be tailed")
+	// ErrArchiveNotFound - no output archiving documents, or the replay source is not one
+	ErrArchiveNotFound = errors.New("ErrArchiveNotFound - replay source must be a configured output reading back its archive, such as s3, azure_blob or gcs")
+	// ErrWrongReplay -
+	ErrWrongReplay = errors.New("ErrWrongReplay - replay must end after it starts and target configured outputs other than its source")
+	// ErrWrongSnapshot -
+	ErrWrongSnapshot = errors.New("ErrWrongSnapshot - snapshot documents must have an ID, a posting time and a body, and pipes must be pending for configured outputs")
+	// ErrUnknownCompression - a buffered entry was compressed with a codec this version does not support
+	ErrUnknownCompression = errors.New("ErrUnknownCompression - buffered document codec is not supported")
+	// ErrCorruptedDocument - a buffered document does not match the checksum it was encoded with
+	ErrCorruptedDocument = codec.ErrCorruptedDocument
+	// ErrWrongChecksum - a pipe checksum is not {documents}:{sum}
+	ErrWrongChecksum = errors.New("ErrWrongChecksum - pipe checksum is unparsable")
+	// ErrEncrypted - a buffered entry was encrypted while encryption is not configured anymore
+	ErrEncrypted = errors.New("ErrEncrypted - buffered document is encrypted, persistence.encryption must be configured to decrypt it")
+	// ErrCollectionPaused - new documents of the collection are rejected until it is resumed
+	ErrCollectionPaused = errors.New("ErrCollectionPaused - collection is paused, retry later")
+	// ErrUnknownPauseMode -
+	ErrUnknownPauseMode = errors.New("ErrUnknownPauseMode - pause mode must be one of reject|buffer")
+	// ErrNotPaused - the collection or output to resume is not paused
+	ErrNotPaused = errors.New("ErrNotPaused - collection or output is not paused")
+	// ErrRecordTooLarge - a document is too large, once encoded, to be buffered on disk
+	ErrRecordTooLarge = errors.New("ErrRecordTooLarge - document exceeds the 256MiB a disk record holds once encoded")
+	// ErrUnknownEngine -
+	ErrUnknownEngine = errors.New("ErrUnknownEngine - persistence engine must be one of redis|kafka|memory|disk")
 )
@@ -0,0 +1,165 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/khezen/bulklog/pkg/output"
+)
+
+// Check - outcome of a health check, Error is empty if it passed
+type Check struct {
+	Name  string `json:"name"`
+	Error string `json:"error,omitempty"`
+}
+
+// Healthy - every check passed
+func Healthy(checks []Check) bool {
+	for _, check := range checks {
+		if check.Error != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// flusherState tracks the flusher goroutine of a buffer so a dead or stuck flusher can be detected
+type flusherState struct {
+	running     atomic.Bool
+	attemptedAt atomic.Int64
+}
+
+func (s *flusherState) flusherStarted() {
+	s.attemptedAt.Store(time.Now().UnixNano())
+	s.running.Store(true)
+}
+
+func (s *flusherState) flusherStopped() {
+	s.running.Store(false)
+}
+
+// flusherReloaded restarts the stuck flusher detection from the new flush period
+func (s *flusherState) flusherReloaded() {
+	s.attemptedAt.Store(time.Now().UnixNano())
+}
+
+func (s *flusherState) flushAttempted() {
+	s.attemptedAt.Store(time.Now().UnixNano())
+}
+
+// FlusherState reports whether the flusher runs and when it last attempted a flush
+func (s *flusherState) FlusherState() (running bool, attemptedAt time.Time) {
+	return s.running.Load(), time.Unix(0, s.attemptedAt.Load())
+}
+
+// Liveness fails if a flusher made no flush attempt for more than twice its flush period
+func (e *engine) Liveness() []Check {
+	e.RLock()
+	buffers, collections := e.buffers, e.collections
+	e.RUnlock()
+	checks := make([]Check, 0, len(buffers))
+	for name, buffer := range buffers {
+		collec := collections[name]
+		if collec.FlushPeriod <= 0 {
+			continue
+		}
+		check := Check{Name: fmt.Sprintf("collections.%s.flusher", name)}
+		running, attemptedAt := buffer.FlusherState()
+		if since := time.Since(attemptedAt); running && since > 2*collec.FlushPeriod {
+			check.Error = fmt.Sprintf("no flush attempt since %s", since.Round(time.Second))
+		}
+		checks = append(checks, check)
+	}
+	sortChecks(checks)
+	return checks
+}
+
+// Readiness checks flushers are running and buffer backends are reachable,
+// as well as outputs which support it if output pings are enabled
+func (e *engine) Readiness(ctx context.Context) []Check {
+	e.RLock()
+	buffers, collections, outputs := e.buffers, e.collections, e.outputs
+	e.RUnlock()
+	var (
+		checks = make([]Check, 0, len(buffers)*2+len(outputs)+1)
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+	)
+	run := func(name string, ping func(ctx context.Context) error) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			check := Check{Name: name}
+			err := await(ctx, ping)
+			if err != nil {
+				check.Error = err.Error()
+			}
+			mu.Lock()
+			checks = append(checks, check)
+			mu.Unlock()
+		}()
+	}
+	for name, buffer := range buffers {
+		run(fmt.Sprintf("collections.%s.buffer", name), buffer.Ping)
+		if collections[name].FlushPeriod <= 0 {
+			continue
+		}
+		check := Check{Name: fmt.Sprintf("collections.%s.flusher", name)}
+		if running, _ := buffer.FlusherState(); !running {
+			check.Error = "flusher is not running"
+		}
+		mu.Lock()
+		checks = append(checks, check)
+		mu.Unlock()
+	}
+	if pinger, ok := e.deadLetters.(output.Pinger); ok {
+		run("dead_letter", pinger.Ping)
+	}
+	if e.pingOutputs {
+		for name, cons := range outputs {
+			// outputs are pinged whatever their circuit state is
+			if pinger, ok := output.AsPinger(cons); ok {
+				run(fmt.Sprintf("outputs.%s", name), pinger.Ping)
+			}
+		}
+	}
+	wg.Wait()
+	sortChecks(checks)
+	return checks
+}
+
+// await returns ctx error if ping does not return before ctx is done,
+// for dependencies whose clients do not support contexts
+func await(ctx context.Context, ping func(ctx context.Context) error) error {
+	done := make(chan error, 1)
+	go func() {
+		done <- ping(ctx)
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func pingRedis(red *redis.Pool) error {
+	conn := red.Get()
+	defer conn.Close()
+	_, err := conn.Do("PING")
+	if err != nil {
+		return fmt.Errorf("PING.%s", err)
+	}
+	return nil
+}
+
+func sortChecks(checks []Check) {
+	sort.Slice(checks, func(i, j int) bool {
+		return checks[i].Name < checks[j].Name
+	})
+}
@@ -0,0 +1,146 @@
+package engine
+
+import (
+	"crypto/sha1"
+	"encoding/binary"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/khezen/bulklog/pkg/collection"
+	"github.com/khezen/bulklog/pkg/output"
+)
+
+// pipeChecksum - documents of a pipe and the sum of the checksums of their stored entries or records.
+// The sum does not depend on their order, so that it is kept up to date as documents are appended, or dropped, one by one.
+type pipeChecksum struct {
+	documents int64
+	sum       int64
+}
+
+func (c *pipeChecksum) add(checksum uint32) {
+	c.documents++
+	c.sum += int64(checksum)
+}
+
+// String - {documents}:{sum}, as pipes store it
+func (c pipeChecksum) String() string {
+	return fmt.Sprintf("%d:%d", c.documents, c.sum)
+}
+
+func parsePipeChecksum(s string) (c pipeChecksum, err error) {
+	parts := strings.SplitN(s, ":", 2)
+	if len(parts) != 2 {
+		return c, ErrWrongChecksum
+	}
+	c.documents, err = strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return c, ErrWrongChecksum
+	}
+	c.sum, err = strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return c, ErrWrongChecksum
+	}
+	return c, nil
+}
+
+// redisEntryChecksum - first 4 bytes of the SHA-1 of an entry, as scripts compute it with redis.sha1hex
+func redisEntryChecksum(entry []byte) uint32 {
+	digest := sha1.Sum(entry)
+	return binary.BigEndian.Uint32(digest[:4])
+}
+
+// storedDocuments - documents read back from a buffer or a pipe
+type storedDocuments struct {
+	documents []collection.Document
+	// corrupted - documents which do not match the checksum they were encoded with, they are not conveyed
+	corrupted []collection.Document
+	// checksum of the entries or records read, corrupted ones included
+	checksum pipeChecksum
+}
+
+// Integrity - checksum verifications of the pipes of a collection since the instance started
+type Integrity struct {
+	Collection    collection.Name `json:"collection"`
+	VerifiedPipes int64           `json:"verified_pipes"`
+	// MismatchedPipes - pipes whose documents, as read back, do not add up to the checksum recorded on flush
+	MismatchedPipes int64 `json:"mismatched_pipes"`
+	// CorruptedDocuments - documents which did not match their own checksum, dead lettered instead of conveyed
+	CorruptedDocuments int64 `json:"corrupted_documents"`
+}
+
+// IntegrityReporter is implemented by buffers which verify checksums of pipes before conveying them
+type IntegrityReporter interface {
+	Integrity() Integrity
+}
+
+// integrity counts checksum verifications of a buffer
+type integrity struct {
+	verifiedPipes      atomic.Int64
+	mismatchedPipes    atomic.Int64
+	corruptedDocuments atomic.Int64
+}
+
+func (i *integrity) Integrity() Integrity {
+	return Integrity{
+		VerifiedPipes:      i.verifiedPipes.Load(),
+		MismatchedPipes:    i.mismatchedPipes.Load(),
+		CorruptedDocuments: i.corruptedDocuments.Load(),
+	}
+}
+
+// verify checks the documents read from a pipe against the checksum recorded on flush, nil for pipes flushed without one,
+// and dead letters corrupted documents for outputNames.
+// Documents which match their own checksum are still conveyed if the pipe checksum does not match, as documents were lost or added rather than altered.
+func (i *integrity) verify(stored storedDocuments, expected *pipeChecksum, deadLetters DeadLetters, collectionName collection.Name, startedAt time.Time, outputNames []string, logger *slog.Logger) {
+	if expected != nil {
+		i.verifiedPipes.Add(1)
+		if *expected != stored.checksum {
+			i.mismatchedPipes.Add(1)
+			logger.Error("pipe checksum mismatch", "expected", expected.String(), "actual", stored.checksum.String())
+		}
+	}
+	if len(stored.corrupted) == 0 {
+		return
+	}
+	i.corruptedDocuments.Add(int64(len(stored.corrupted)))
+	logger.Error("corrupted documents", "documents", len(stored.corrupted))
+	failures := make(map[string]error, len(outputNames))
+	for _, outputName := range outputNames {
+		failures[outputName] = ErrCorruptedDocument
+	}
+	deadLetter(deadLetters, collectionName, startedAt, failures, stored.corrupted, logger)
+}
+
+func outputNames(outputs map[string]output.Interface) []string {
+	names := make([]string, 0, len(outputs))
+	for outputName := range outputs {
+		names = append(names, outputName)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Integrity reports checksum verifications of collections whose buffer verifies them
+func (e *engine) Integrity() []Integrity {
+	e.RLock()
+	defer e.RUnlock()
+	reports := make([]Integrity, 0, len(e.buffers))
+	for collectionName, buffer := range e.buffers {
+		reporter, ok := buffer.(IntegrityReporter)
+		if !ok {
+			continue
+		}
+		report := reporter.Integrity()
+		report.Collection = collectionName
+		reports = append(reports, report)
+	}
+	sort.Slice(reports, func(i, j int) bool {
+		return reports[i].Collection < reports[j].Collection
+	})
+	return reports
+}
@@ -1,11 +1,64 @@
 package engine
 
-import "github.com/khezen/bulklog/pkg/collection"
+import (
+	"context"
+	"time"
+
+	"github.com/khezen/bulklog/pkg/collection"
+	"github.com/khezen/bulklog/pkg/config"
+	"github.com/khezen/bulklog/pkg/output"
+	"github.com/khezen/bulklog/pkg/tenant"
+)
 
 // Engine -
 type Engine interface {
 	Collector
 	Dispatcher
+	// MaxBodySize - bytes request bodies pushed to a collection are bounded to, 0 if it sets no limit
+	MaxBodySize(ctx context.Context, collectionName collection.Name, schemaName collection.SchemaName) int64
+	Shutdown(ctx context.Context) error
+	// Reload applies collections and outputs of cfg without losing buffered documents
+	Reload(cfg *config.Config) error
+	// Redrive conveys dead letters of a collection again
+	Redrive(collectionName collection.Name) (int, error)
+	// Replay conveys documents a collection archived between from and to again, to selected outputs
+	Replay(collectionName collection.Name, request ReplayRequest) (Replay, error)
+	// Pipes lists pending pipes of a collection
+	Pipes(collectionName collection.Name) ([]Pipe, error)
+	// RetryPipe retries outputs of a pending pipe immediately
+	RetryPipe(collectionName collection.Name, id string) error
+	// DiscardPipe deletes a pending pipe without dead lettering it
+	DiscardPipe(collectionName collection.Name, id string) error
+	// PipeDocuments returns up to limit documents of a pending pipe, from offset on
+	PipeDocuments(collectionName collection.Name, id string, offset, limit int) (PipeDocuments, error)
+	// Snapshot reads the buffered documents and pending pipes of a collection
+	Snapshot(collectionName collection.Name) (Snapshot, error)
+	// Restore adds the buffered documents and pending pipes of a snapshot to a collection
+	Restore(collectionName collection.Name, snapshot Snapshot) (Restored, error)
+	// Tail returns the last n documents buffered by a collection since its latest flush
+	Tail(collectionName collection.Name, n int) ([]BufferedDocument, error)
+	// Outputs reports the circuit state and worker pool usage of outputs
+	Outputs() []output.State
+	// Tenants reports the usage and quotas of tenants
+	Tenants() []tenant.Usage
+	// PauseCollection rejects new documents of a collection, or buffers them without conveying its pipes, until it is resumed
+	PauseCollection(collectionName collection.Name, mode PauseMode) (Pause, error)
+	// ResumeCollection accepts and conveys documents of a paused collection again
+	ResumeCollection(collectionName collection.Name) error
+	// PauseOutput holds deliveries to an output until it is resumed
+	PauseOutput(outputName string) (Pause, error)
+	// ResumeOutput lets deliveries held for an output go
+	ResumeOutput(outputName string) error
+	// Pauses lists paused collections and outputs
+	Pauses() []Pause
+	// Integrity reports checksum verifications of the pipes of redis and disk collections
+	Integrity() []Integrity
+	// Recoveries reports the pipes redis and disk collections found left by previous runs
+	Recoveries() []Recovery
+	// Liveness detects stuck flushers
+	Liveness() []Check
+	// Readiness checks flushers and dependencies
+	Readiness(ctx context.Context) []Check
 }
 
 // Dispatcher dispatches documents
@@ -14,18 +67,31 @@ type Dispatcher interface {
 	DispatchBatch(documents ...collection.Document) error
 }
 
-// Collector collects documents
+// Collector collects documents, ctx carries the trace context of the caller
 type Collector interface {
-	Collect(collectionName collection.Name, schemaName collection.SchemaName, docBytes []byte) error
-	CollectBatch(collectionName collection.Name, schemaName collection.SchemaName, docBytesSlice ...[]byte) error
+	Collect(ctx context.Context, collectionName collection.Name, schemaName collection.SchemaName, docBytes []byte) error
+	CollectBatch(ctx context.Context, collectionName collection.Name, schemaName collection.SchemaName, docBytesSlice ...[]byte) error
+	// CollectBulk appends every parsable document at once and returns the parse error of each document, nil if it was appended
+	CollectBulk(ctx context.Context, collectionName collection.Name, schemaName collection.SchemaName, docBytesSlice ...[]byte) ([]error, error)
 }
 
 // Buffer -
 type Buffer interface {
 	Append(*collection.Document) error
 	AppendBatch(...collection.Document) error
-	Flush() error
+	// Flush moves buffered documents into a pipe, conveyed until the buffer shuts down
+	Flush(ctx context.Context) error
 	Flusher() func()
+	// Reload applies collection settings and outputs to documents flushed from now on
+	Reload(collec *collection.Collection, outputs map[string]output.Interface) error
+
+	// Ping checks the buffer backend is reachable
+	Ping(ctx context.Context) error
+	// FlusherState reports whether the flusher runs and when it last attempted a flush
+	FlusherState() (running bool, attemptedAt time.Time)
 
 	Close()
+	// Shutdown stops the flusher, flushes remaining documents
+	// and waits for pending conveyances until ctx is done
+	Shutdown(ctx context.Context) error
 }
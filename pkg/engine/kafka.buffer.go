@@ -0,0 +1,250 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/khezen/bulklog/pkg/codec"
+	"github.com/khezen/bulklog/pkg/collection"
+	"github.com/khezen/bulklog/pkg/config"
+	"github.com/khezen/bulklog/pkg/output"
+	"github.com/khezen/bulklog/pkg/trace"
+)
+
+const (
+	defaultKafkaGroup = "bulklog"
+	// defaultKafkaFlushRecords - records a flush stops fetching at, the next flushes read the following ones
+	defaultKafkaFlushRecords = 10000
+)
+
+type kafkaBuffer struct {
+	flusherState
+	reloadable
+	proxy       *kafkaProxy
+	deadLetters DeadLetters
+	expiry      *ExpiryNotifier
+	logger      *slog.Logger
+	topic       string
+	// maxFlushRecords bounds the records a flush fetches, so that it ends under continuous produce
+	maxFlushRecords int
+	commits         kafkaCommits
+	close           chan struct{}
+	closeOnce       sync.Once
+	conveying       sync.WaitGroup
+	// ctx is cancelled once shutdown stops waiting for conveyances
+	ctx      context.Context
+	cancel   context.CancelFunc
+	flushing sync.Mutex
+	// documents produced by this instance since the latest flush, for size based flushes
+	pendingMu    sync.Mutex
+	pendingDocs  int
+	pendingBytes int64
+}
+
+// KafkaBuffer stages documents in a kafka topic through a REST proxy.
+// Proxy consumers move their fetch position on every fetch, whereas kafka.Consumer only moves on Commit from the goroutine polling:
+// a flush would poll again the records of the flushes still conveying, which commit their offsets from their own goroutine.
+func KafkaBuffer(collec *collection.Collection, kafkaCfg *config.Kafka, outputs map[string]output.Interface, deadLetters DeadLetters, expiry *ExpiryNotifier, logger *slog.Logger) (Buffer, error) {
+	if collec.BufferLimits.Bounded() {
+		return nil, ErrUnsupportedBufferLimits
+	}
+	group := kafkaCfg.Group
+	if group == "" {
+		group = defaultKafkaGroup
+	}
+	maxFlushRecords := kafkaCfg.MaxFlushRecords
+	if maxFlushRecords <= 0 {
+		maxFlushRecords = defaultKafkaFlushRecords
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	kbuffer := &kafkaBuffer{
+		proxy:           newKafkaProxy(kafkaCfg),
+		deadLetters:     deadLetters,
+		expiry:          expiry,
+		logger:          logger,
+		topic:           fmt.Sprintf("%s%s", kafkaCfg.TopicPrefix, collec.Name),
+		maxFlushRecords: maxFlushRecords,
+		close:           make(chan struct{}),
+		ctx:             ctx,
+		cancel:          cancel,
+	}
+	kbuffer.apply(collec, outputs)
+	err := kbuffer.proxy.Subscribe(group, uuid.New().String(), kbuffer.topic)
+	if err != nil {
+		return nil, fmt.Errorf("Subscribe.%s", err)
+	}
+	return kbuffer, nil
+}
+
+// Reload rejects buffer limits, kafka buffers do not support them
+func (b *kafkaBuffer) Reload(collec *collection.Collection, outputs map[string]output.Interface) error {
+	if collec.BufferLimits.Bounded() {
+		return ErrUnsupportedBufferLimits
+	}
+	return b.reloadable.Reload(collec, outputs)
+}
+
+func (b *kafkaBuffer) Append(doc *collection.Document) error {
+	return b.AppendBatch(*doc)
+}
+
+func (b *kafkaBuffer) AppendBatch(documents ...collection.Document) (err error) {
+	var (
+		records = make([]kafkaRecord, 0, len(documents))
+		format  = b.collection().Serialization.Storage
+	)
+	for i := range documents {
+		value, err := codec.Marshal(format, &documents[i])
+		if err != nil {
+			return fmt.Errorf("codec.Marshal.%s", err)
+		}
+		records = append(records, kafkaRecord{
+			Key:   []byte(documents[i].ID.String()),
+			Value: value,
+		})
+	}
+	err = b.proxy.Produce(b.topic, records)
+	if err != nil {
+		return fmt.Errorf("Produce.%s", err)
+	}
+	if b.collection().SizeTriggered() {
+		b.pendingMu.Lock()
+		b.pendingDocs += len(documents)
+		b.pendingBytes += documentsBytes(documents)
+		reached := b.collection().FlushThresholdReached(b.pendingDocs, b.pendingBytes)
+		if reached {
+			b.pendingDocs, b.pendingBytes = 0, 0
+		}
+		b.pendingMu.Unlock()
+		if reached {
+			go func() {
+				err := b.Flush(b.ctx)
+				if err != nil {
+					b.logger.Error("flush failed", "error", err)
+				}
+			}()
+		}
+	}
+	return nil
+}
+
+// Flush reads pending records, up to maxFlushRecords, and conveys them to outputs.
+// Offsets are committed once conveyance ends, unless it was cancelled, and once the flushes read before are conveyed.
+// If a fetch fails, the records fetched before are conveyed all the same, as the consumer position already moved past them.
+func (b *kafkaBuffer) Flush(ctx context.Context) (err error) {
+	b.flushing.Lock()
+	defer b.flushing.Unlock()
+	var (
+		documents = make([]collection.Document, 0)
+		offsets   = make(map[int]int64)
+		records   []kafkaRecord
+		fetchErr  error
+	)
+	for fetched := 0; fetched < b.maxFlushRecords; fetched += len(records) {
+		records, fetchErr = b.proxy.Fetch(ctx)
+		if fetchErr != nil {
+			fetchErr = fmt.Errorf("Fetch.%s", fetchErr)
+			break
+		}
+		if len(records) == 0 {
+			break
+		}
+		for _, record := range records {
+			doc, err := codec.Unmarshal(record.Value)
+			if err != nil {
+				b.logger.Error("undecodable record", "partition", record.Partition, "offset", record.Offset, "error", err)
+			} else {
+				documents = append(documents, doc)
+			}
+			if record.Offset >= offsets[record.Partition] {
+				offsets[record.Partition] = record.Offset + 1
+			}
+		}
+	}
+	if len(offsets) == 0 {
+		return fetchErr
+	}
+	flush := b.commits.read(offsets)
+	settings := b.current.Load()
+	span := startFlushSpan(settings.collection.Name, documents)
+	span.SetAttributes(trace.String("bulklog.topic", b.topic))
+	span.End()
+	b.conveying.Add(1)
+	go func() {
+		defer b.conveying.Done()
+		if len(documents) > 0 {
+			convey(trace.ContextWith(b.ctx, span.Context()), documents, settings.outputs, settings.collection, b.deadLetters, b.expiry, b.logger)
+		}
+		// records of cancelled conveyances are fetched again on the next start, along with those of the flushes read after them
+		if b.ctx.Err() != nil {
+			return
+		}
+		b.commits.conveyed(flush, b.topic, b.proxy.Commit, b.logger)
+	}()
+	return fetchErr
+}
+
+// Flusher flushes every tick
+func (b *kafkaBuffer) Flusher() func() {
+	return func() {
+		b.flusherStarted()
+		defer b.flusherStopped()
+		var (
+			ticker = newFlushTicker(b.collection().FlushPeriod)
+			err    error
+		)
+		for {
+			select {
+			case <-b.close:
+				ticker.Stop()
+				return
+			case <-b.reloaded():
+				ticker.Stop()
+				ticker = newFlushTicker(b.collection().FlushPeriod)
+				b.flusherReloaded()
+			case <-ticker.C:
+				b.flushAttempted()
+				err = b.Flush(b.ctx)
+				if err != nil {
+					b.logger.Error("flush failed", "error", err)
+				}
+				break
+			}
+		}
+	}
+}
+
+func (b *kafkaBuffer) Close() {
+	b.closeOnce.Do(func() {
+		close(b.close)
+		err := b.proxy.Unsubscribe()
+		if err != nil {
+			b.logger.Error("unsubscribe failed", "error", err)
+		}
+	})
+}
+
+// Shutdown conveys pending records before leaving the consumer group.
+// Records whose offsets are not committed before ctx is done are fetched again on the next start.
+func (b *kafkaBuffer) Shutdown(ctx context.Context) error {
+	err := b.Flush(ctx)
+	if err != nil {
+		b.Close()
+		return fmt.Errorf("Flush.%s", err)
+	}
+	err = waitConveying(ctx, &b.conveying, b.cancel)
+	b.Close()
+	return err
+}
+
+// Ping requests the topic metadata to the REST proxy
+func (b *kafkaBuffer) Ping(ctx context.Context) error {
+	_, err := b.proxy.do(ctx, "GET", fmt.Sprintf("/topics/%s", b.topic), nil)
+	if err != nil {
+		return fmt.Errorf("(GET /topics/%s).%s", b.topic, err)
+	}
+	return nil
+}
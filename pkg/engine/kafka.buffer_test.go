@@ -0,0 +1,89 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/khezen/bulklog/pkg/codec"
+	"github.com/khezen/bulklog/pkg/collection"
+	"github.com/khezen/bulklog/pkg/config"
+	"github.com/khezen/bulklog/pkg/output"
+)
+
+// fakeKafkaProxy serves the consumer API of the REST proxy, fetches answering rounds in turn, then errors
+type fakeKafkaProxy struct {
+	mu        sync.Mutex
+	rounds    [][]kafkaRecord
+	committed chan []kafkaOffset
+}
+
+func (p *fakeKafkaProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.Method == "POST" && strings.HasSuffix(r.URL.Path, "/offsets"):
+		var body struct {
+			Offsets []kafkaOffset `json:"offsets"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		p.committed <- body.Offsets
+	case r.Method == "GET" && strings.HasSuffix(r.URL.Path, "/records"):
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		if len(p.rounds) == 0 {
+			http.Error(w, "consumer instance not found", http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(p.rounds[0])
+		p.rounds = p.rounds[1:]
+	case r.Method == "POST" || r.Method == "DELETE":
+		w.Write([]byte("{}"))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// TestKafkaFlushFetchFailure checks the records of the rounds fetched before a failing one are conveyed and committed,
+// since the proxy consumer position moved past them
+func TestKafkaFlushFetchFailure(t *testing.T) {
+	var (
+		docs    = []collection.Document{testDocument(t, `{"n":1}`), testDocument(t, `{"n":2}`)}
+		records []kafkaRecord
+	)
+	for i := range docs {
+		value, err := codec.Marshal("", &docs[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, kafkaRecord{Value: value, Partition: 0, Offset: int64(i)})
+	}
+	proxy := &fakeKafkaProxy{rounds: [][]kafkaRecord{records}, committed: make(chan []kafkaOffset, 1)}
+	srv := httptest.NewServer(proxy)
+	defer srv.Close()
+	out := &recordingOutput{}
+	buffer, err := KafkaBuffer(testCollection(), &config.Kafka{Endpoint: strings.TrimPrefix(srv.URL, "http://")}, map[string]output.Interface{"out": out}, nil, nil, discardLogger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer buffer.Close()
+	err = buffer.Flush(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "Fetch.") {
+		t.Fatalf("Flush: got %v, want the fetch error", err)
+	}
+	digested := out.wait(t, 2)
+	if len(digested) != 2 || digested[0].ID != docs[0].ID || digested[1].ID != docs[1].ID {
+		t.Fatalf("digested %d documents, want the 2 fetched", len(digested))
+	}
+	offsets := <-proxy.committed
+	if len(offsets) != 1 || offsets[0].Partition != 0 || offsets[0].Offset != 2 {
+		t.Fatalf("committed offsets %+v, want partition 0 at 2", offsets)
+	}
+	// a failing first round reads nothing
+	err = buffer.Flush(context.Background())
+	if err == nil {
+		t.Fatal("Flush: got no error")
+	}
+}
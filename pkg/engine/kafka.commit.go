@@ -0,0 +1,67 @@
+package engine
+
+import (
+	"log/slog"
+	"sync"
+)
+
+// kafkaFlush - next offsets of the partitions a flush read, by partition
+type kafkaFlush struct {
+	offsets  map[int]int64
+	conveyed bool
+}
+
+// kafkaCommits commits the offsets of flushes in the order they were read, whatever order their conveyances end in:
+// the offsets of a flush are committed once it, and every flush read before it, is conveyed,
+// so that a crash never leaves the records of a flush still retrying behind committed offsets.
+type kafkaCommits struct {
+	sync.Mutex
+	flushes []*kafkaFlush
+	// uncommitted - offsets of the conveyed flushes whose commit failed, merged into the next one
+	uncommitted map[int]int64
+}
+
+// read registers a flush, flushes must be read one at a time
+func (c *kafkaCommits) read(offsets map[int]int64) *kafkaFlush {
+	c.Lock()
+	defer c.Unlock()
+	flush := &kafkaFlush{offsets: offsets}
+	c.flushes = append(c.flushes, flush)
+	return flush
+}
+
+// conveyed commits the offsets of the flushes conveyed so far which no earlier flush is holding back
+func (c *kafkaCommits) conveyed(flush *kafkaFlush, topic string, commit func([]kafkaOffset) error, logger *slog.Logger) {
+	c.Lock()
+	defer c.Unlock()
+	flush.conveyed = true
+	i := 0
+	for ; i < len(c.flushes) && c.flushes[i].conveyed; i++ {
+		if c.uncommitted == nil {
+			c.uncommitted = make(map[int]int64)
+		}
+		for partition, offset := range c.flushes[i].offsets {
+			if offset > c.uncommitted[partition] {
+				c.uncommitted[partition] = offset
+			}
+		}
+	}
+	c.flushes = c.flushes[i:]
+	if len(c.uncommitted) == 0 {
+		return
+	}
+	offsets := make([]kafkaOffset, 0, len(c.uncommitted))
+	for partition, offset := range c.uncommitted {
+		offsets = append(offsets, kafkaOffset{
+			Topic:     topic,
+			Partition: partition,
+			Offset:    offset,
+		})
+	}
+	err := commit(offsets)
+	if err != nil {
+		logger.Error("offsets commit failed", "error", err)
+		return
+	}
+	c.uncommitted = nil
+}
@@ -0,0 +1,165 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/khezen/bulklog/pkg/auth"
+	"github.com/khezen/bulklog/pkg/config"
+)
+
+const kafkaBinaryContentType = "application/vnd.kafka.binary.v2+json"
+
+// kafkaProxy is a minimal client for the Confluent REST proxy v2 API
+type kafkaProxy struct {
+	baseURL  string
+	signer   auth.Signer
+	httpcli  http.Client
+	instance string
+}
+
+type kafkaRecord struct {
+	Key       []byte `json:"key,omitempty"`
+	Value     []byte `json:"value"`
+	Topic     string `json:"topic,omitempty"`
+	Partition int    `json:"partition,omitempty"`
+	Offset    int64  `json:"offset,omitempty"`
+}
+
+type kafkaOffset struct {
+	Topic     string `json:"topic"`
+	Partition int    `json:"partition"`
+	Offset    int64  `json:"offset"`
+}
+
+func newKafkaProxy(kafkaCfg *config.Kafka) *kafkaProxy {
+	scheme := kafkaCfg.Scheme
+	if scheme == "" {
+		scheme = "http"
+	}
+	var signer auth.Signer
+	if kafkaCfg.BasicAuth != nil {
+		signer = auth.NewBasicSigner(*kafkaCfg.BasicAuth)
+	}
+	return &kafkaProxy{
+		baseURL: fmt.Sprintf("%s://%s", scheme, kafkaCfg.Endpoint),
+		signer:  signer,
+		httpcli: http.Client{
+			Timeout: 30 * time.Second,
+		},
+	}
+}
+
+// Produce sends records to the given topic
+func (p *kafkaProxy) Produce(topic string, records []kafkaRecord) error {
+	body, err := json.Marshal(map[string]interface{}{"records": records})
+	if err != nil {
+		return fmt.Errorf("json.Marshal.%s", err)
+	}
+	_, err = p.do(context.Background(), "POST", fmt.Sprintf("/topics/%s", topic), body)
+	if err != nil {
+		return fmt.Errorf("(POST /topics/%s).%s", topic, err)
+	}
+	return nil
+}
+
+// Subscribe creates a consumer instance in group and subscribes it to topics
+func (p *kafkaProxy) Subscribe(group, instance string, topics ...string) error {
+	body, err := json.Marshal(map[string]string{
+		"name":               instance,
+		"format":             "binary",
+		"auto.offset.reset":  "earliest",
+		"auto.commit.enable": "false",
+	})
+	if err != nil {
+		return fmt.Errorf("json.Marshal.%s", err)
+	}
+	_, err = p.do(context.Background(), "POST", fmt.Sprintf("/consumers/%s", group), body)
+	if err != nil {
+		return fmt.Errorf("(POST /consumers/%s).%s", group, err)
+	}
+	p.instance = fmt.Sprintf("/consumers/%s/instances/%s", group, instance)
+	body, err = json.Marshal(map[string][]string{"topics": topics})
+	if err != nil {
+		return fmt.Errorf("json.Marshal.%s", err)
+	}
+	_, err = p.do(context.Background(), "POST", fmt.Sprintf("%s/subscription", p.instance), body)
+	if err != nil {
+		return fmt.Errorf("(POST %s/subscription).%s", p.instance, err)
+	}
+	return nil
+}
+
+// Fetch returns the next records available to the consumer instance
+func (p *kafkaProxy) Fetch(ctx context.Context) (records []kafkaRecord, err error) {
+	resBody, err := p.do(ctx, "GET", fmt.Sprintf("%s/records", p.instance), nil)
+	if err != nil {
+		return nil, fmt.Errorf("(GET %s/records).%s", p.instance, err)
+	}
+	err = json.Unmarshal(resBody, &records)
+	if err != nil {
+		return nil, fmt.Errorf("json.Unmarshal.%s", err)
+	}
+	return records, nil
+}
+
+// Commit commits offsets for the consumer instance
+func (p *kafkaProxy) Commit(offsets []kafkaOffset) error {
+	body, err := json.Marshal(map[string]interface{}{"offsets": offsets})
+	if err != nil {
+		return fmt.Errorf("json.Marshal.%s", err)
+	}
+	_, err = p.do(context.Background(), "POST", fmt.Sprintf("%s/offsets", p.instance), body)
+	if err != nil {
+		return fmt.Errorf("(POST %s/offsets).%s", p.instance, err)
+	}
+	return nil
+}
+
+// Unsubscribe destroys the consumer instance
+func (p *kafkaProxy) Unsubscribe() error {
+	if p.instance == "" {
+		return nil
+	}
+	_, err := p.do(context.Background(), "DELETE", p.instance, nil)
+	if err != nil {
+		return fmt.Errorf("(DELETE %s).%s", p.instance, err)
+	}
+	p.instance = ""
+	return nil
+}
+
+func (p *kafkaProxy) do(ctx context.Context, method, path string, body []byte) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, method, p.baseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("http.NewRequest.%s", err)
+	}
+	req.Header.Set("Accept", kafkaBinaryContentType)
+	if body != nil {
+		req.Header.Set("Content-Type", kafkaBinaryContentType)
+	}
+	if p.signer != nil {
+		err = p.signer.Sign(req, body)
+		if err != nil {
+			return nil, fmt.Errorf("Sign.%s", err)
+		}
+	}
+	res, err := p.httpcli.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("httpClient.Do.%s", err)
+	}
+	defer res.Body.Close()
+	resBody, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, fmt.Errorf("ioutil.ReadAll.%s", err)
+	}
+	if res.StatusCode >= 300 {
+		return nil, fmt.Errorf("kafka: %s : %s", res.Status, resBody)
+	}
+	return resBody, nil
+}
@@ -0,0 +1,233 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/khezen/bulklog/pkg/collection"
+	"github.com/khezen/bulklog/pkg/config"
+	"github.com/khezen/bulklog/pkg/output"
+	"github.com/khezen/bulklog/pkg/trace"
+)
+
+const bufferLimit = 10000
+
+// memoryBuffer is related to a collection
+// It keeps documents in process memory until they are flushed to outputs.
+type memoryBuffer struct {
+	sync.Mutex
+	flusherState
+	reloadable
+	deadLetters DeadLetters
+	expiry      *ExpiryNotifier
+	logger      *slog.Logger
+	capacity    int
+	close       chan struct{}
+	closeOnce   sync.Once
+	conveying   sync.WaitGroup
+	// ctx is cancelled once shutdown stops waiting for conveyances
+	ctx       context.Context
+	cancel    context.CancelFunc
+	documents []collection.Document
+	bytes     int64
+}
+
+// MemoryBuffer creates a new process-local buffer.
+// capacity bounds the number of buffered documents; zero means unbounded.
+func MemoryBuffer(collec *collection.Collection, memoryCfg *config.Memory, outputs map[string]output.Interface, deadLetters DeadLetters, expiry *ExpiryNotifier, logger *slog.Logger) Buffer {
+	ctx, cancel := context.WithCancel(context.Background())
+	mbuffer := &memoryBuffer{
+		Mutex:       sync.Mutex{},
+		deadLetters: deadLetters,
+		expiry:      expiry,
+		logger:      logger,
+		capacity:    memoryCfg.Capacity,
+		close:       make(chan struct{}),
+		ctx:         ctx,
+		cancel:      cancel,
+		documents:   make([]collection.Document, 0),
+	}
+	mbuffer.apply(collec, outputs)
+	return mbuffer
+}
+
+// DefaultBuffer creates a new unbounded memory buffer
+func DefaultBuffer(collec *collection.Collection, outputs map[string]output.Interface, deadLetters DeadLetters, expiry *ExpiryNotifier, logger *slog.Logger) Buffer {
+	return MemoryBuffer(collec, &config.Memory{}, outputs, deadLetters, expiry, logger)
+}
+
+// Append to buffer
+func (b *memoryBuffer) Append(d *collection.Document) error {
+	return b.AppendBatch(*d)
+}
+
+// AppendBatch to buffer
+func (b *memoryBuffer) AppendBatch(documents ...collection.Document) error {
+	limits := b.collection().BufferLimits
+	if !limits.Bounded() {
+		_, err := b.tryAppend(documents)
+		return err
+	}
+	return admit(limits, documents, func() (bool, error) {
+		return b.tryAppend(documents)
+	}, func() (bool, error) {
+		return b.dropAndAppend(documents)
+	})
+}
+
+// tryAppend appends documents if they fit within collection limits
+func (b *memoryBuffer) tryAppend(documents []collection.Document) (bool, error) {
+	b.Lock()
+	defer b.Unlock()
+	if b.capacity > 0 && len(b.documents)+len(documents) > b.capacity {
+		return false, ErrBufferFull
+	}
+	bytes := documentsBytes(documents)
+	if !b.collection().BufferLimits.Fits(len(b.documents)+len(documents), b.bytes+bytes) {
+		return false, nil
+	}
+	b.documents = append(b.documents, documents...)
+	b.bytes += bytes
+	b.flushIfThresholdReached()
+	return true, nil
+}
+
+// dropAndAppend drops the oldest documents until the new ones fit
+func (b *memoryBuffer) dropAndAppend(documents []collection.Document) (bool, error) {
+	b.Lock()
+	defer b.Unlock()
+	var (
+		limits = b.collection().BufferLimits
+		bytes  = documentsBytes(documents)
+		kept   = b.bytes
+		i      int
+	)
+	for i < len(b.documents) && !limits.Fits(len(b.documents)-i+len(documents), kept+bytes) {
+		kept -= int64(len(b.documents[i].Body))
+		i++
+	}
+	if b.capacity > 0 && len(b.documents)-i+len(documents) > b.capacity {
+		return false, ErrBufferFull
+	}
+	b.documents = append(b.documents[i:], documents...)
+	b.bytes = kept + bytes
+	b.flushIfThresholdReached()
+	return true, nil
+}
+
+// Flush the buffer
+func (b *memoryBuffer) Flush(ctx context.Context) (bubbledErr error) {
+	b.Lock()
+	defer b.Unlock()
+	b.flush()
+	return nil
+}
+
+func (b *memoryBuffer) flushIfThresholdReached() {
+	if b.collection().FlushThresholdReached(len(b.documents), b.bytes) {
+		b.flush()
+	}
+}
+
+// flush conveys buffered documents, the lock must be held
+func (b *memoryBuffer) flush() {
+	documentsLen := len(b.documents)
+	if documentsLen == 0 {
+		return
+	}
+	settings := b.current.Load()
+	span := startFlushSpan(settings.collection.Name, b.documents)
+	span.End()
+	b.conveying.Add(1)
+	go func(documents []collection.Document) {
+		convey(trace.ContextWith(b.ctx, span.Context()), documents, settings.outputs, settings.collection, b.deadLetters, b.expiry, b.logger)
+		b.conveying.Done()
+	}(b.documents)
+	b.documents = make([]collection.Document, 0, bufferLimit)
+	b.bytes = 0
+}
+
+// RestorePipe conveys the documents of a pipe to its outputs, as a pipe kept in memory
+func (b *memoryBuffer) RestorePipe(id string, createdAt time.Time, outputNames []string, documents []collection.Document) (bool, error) {
+	settings := b.current.Load()
+	b.conveying.Add(1)
+	go func() {
+		conveyFrom(b.ctx, id, createdAt, documents, selectOutputs(settings.outputs, outputNames), settings.collection, b.deadLetters, b.expiry, b.logger)
+		b.conveying.Done()
+	}()
+	return true, nil
+}
+
+// Flusher flushes every tick
+func (b *memoryBuffer) Flusher() func() {
+	return func() {
+		b.flusherStarted()
+		defer b.flusherStopped()
+		var (
+			ticker = newFlushTicker(b.collection().FlushPeriod)
+			err    error
+		)
+		for {
+			select {
+			case <-b.close:
+				ticker.Stop()
+				return
+			case <-b.reloaded():
+				ticker.Stop()
+				ticker = newFlushTicker(b.collection().FlushPeriod)
+				b.flusherReloaded()
+			case <-ticker.C:
+				b.flushAttempted()
+				err = b.Flush(b.ctx)
+				if err != nil {
+					b.logger.Error("flush failed", "error", err)
+				}
+				break
+			}
+		}
+	}
+}
+
+// Close stops the flusher, flushes remaining documents
+// and waits for pending conveyances to end
+func (b *memoryBuffer) Close() {
+	err := b.Shutdown(context.Background())
+	if err != nil {
+		b.logger.Error("shutdown failed", "error", err)
+	}
+}
+
+// Shutdown stops the flusher, flushes remaining documents
+// and waits for pending conveyances until ctx is done
+func (b *memoryBuffer) Shutdown(ctx context.Context) error {
+	b.closeOnce.Do(func() {
+		close(b.close)
+	})
+	err := b.Flush(ctx)
+	if err != nil {
+		return fmt.Errorf("Flush.%s", err)
+	}
+	return waitConveying(ctx, &b.conveying, b.cancel)
+}
+
+// Ping - memory is always reachable
+func (b *memoryBuffer) Ping(ctx context.Context) error {
+	return nil
+}
+
+// bufferedBytes - body bytes of documents buffered since the last flush
+func (b *memoryBuffer) bufferedBytes() (int64, error) {
+	b.Lock()
+	defer b.Unlock()
+	return b.bytes, nil
+}
+
+// Tail copies the last n buffered documents
+func (b *memoryBuffer) Tail(n int) ([]collection.Document, error) {
+	b.Lock()
+	defer b.Unlock()
+	return append([]collection.Document(nil), lastDocuments(b.documents, n)...), nil
+}
@@ -0,0 +1,177 @@
+package engine
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/khezen/bulklog/pkg/collection"
+	"github.com/khezen/bulklog/pkg/output"
+	"github.com/khezen/bulklog/pkg/trace"
+)
+
+// convey documents to outputs through pipes!
+// Documents which outputs did not digest before retention ends are dead lettered, the ones left once ctx is done are dropped.
+// ctx carries the span which created the pipe, if any, and is given the collection priority.
+func convey(ctx context.Context, documents []collection.Document, outputs map[string]output.Interface, collec *collection.Collection, deadLetters DeadLetters, expiry *ExpiryNotifier, logger *slog.Logger) {
+	conveyFrom(ctx, uuid.New().String(), time.Now().UTC(), documents, outputs, collec, deadLetters, expiry, logger)
+}
+
+// conveyFrom conveys documents as convey does, for a pipe created at startedAt
+func conveyFrom(ctx context.Context, pipeID string, startedAt time.Time, documents []collection.Document, outputs map[string]output.Interface, collec *collection.Collection, deadLetters DeadLetters, expiry *ExpiryNotifier, logger *slog.Logger) {
+	ctx = collection.WithPriority(ctx, collec.Priority)
+	span := startConveySpan(trace.FromContext(ctx), collec.Name, documents)
+	failures, pending := conveySince(trace.ContextWith(ctx, span.Context()), pipeID, documents, outputs, collec, startedAt, deadLetters, expiry, nil, nil, logger)
+	span.SetAttributes(trace.Int("bulklog.outputs.failed", len(failures)))
+	span.End()
+	if ctx.Err() != nil {
+		logger.Error("conveyance cancelled", "documents", len(documents), "error", ctx.Err())
+		return
+	}
+	deadLetterPending(deadLetters, expiry, collec.Name, pipeID, startedAt, startedAt.Add(collec.RetentionPeriod), failures, documents, pending, logger)
+}
+
+// conveySince conveys documents of a pipe to the outputs they are routed to until all of them succeed, retention ends or ctx is done.
+// delivered, if not nil, is called each time an output has digested the documents.
+// Outputs which report the documents they failed to digest are only retried with those, the ones they rejected for good are dead lettered right away.
+// Outputs which asked to be retried later than the backoff tells, such as with a Retry-After header, are not tried again until then.
+// Failed tries are notified to expiry, which reports the pipe as expiring once the next try is within its notice.
+// Each delivery attempt is recorded as a span child of the one ctx carries, and bounded by the backoff try timeout.
+// pipe, if not nil, is informed of failures and may cut waits short or discard the documents, in which case nil is returned.
+// It returns the latest error of each output which did not digest the documents, nil once ctx is done,
+// along with the documents left to outputs which digested part of them.
+func conveySince(
+	ctx context.Context,
+	pipeID string,
+	documents []collection.Document,
+	outputs map[string]output.Interface,
+	collec *collection.Collection,
+	startedAt time.Time,
+	deadLetters DeadLetters,
+	expiry *ExpiryNotifier,
+	delivered func(outputName string),
+	pipe *pipeState,
+	logger *slog.Logger) (map[string]error, map[string][]collection.Document) {
+	outputs, pending := routePipe(collec, documents, outputs, delivered)
+	var (
+		collectionName = collec.Name
+		backoff        = collec.Backoff
+		dieAt          = startedAt.Add(collec.RetentionPeriod)
+		i              int
+		failed         map[string]output.Interface
+		failures       map[string]error
+		previous       map[string]error
+		latestTryAt    time.Time
+		nextTryAt      time.Time
+		cons           output.Interface
+		outputName     string
+		wg             sync.WaitGroup
+		mu             sync.Mutex
+		// notBefore - next try of each failed output
+		notBefore = make(map[string]time.Time)
+		// deferred - failed outputs which are not due for retry yet
+		deferred map[string]output.Interface
+	)
+	for {
+		latestTryAt = time.Now().UTC()
+		wg = sync.WaitGroup{}
+		previous = failures
+		failed = nil
+		failures = nil
+		deferred = nil
+		for outputName, cons = range outputs {
+			if latestTryAt.Before(notBefore[outputName]) {
+				if deferred == nil {
+					deferred = make(map[string]output.Interface)
+				}
+				deferred[outputName] = cons
+				continue
+			}
+			wg.Add(1)
+			go func(outputName string, cons output.Interface) {
+				defer wg.Done()
+				mu.Lock()
+				left, ok := pending[outputName]
+				mu.Unlock()
+				if !ok {
+					left = documents
+				}
+				err := digest(ctx, pipeID, outputName, cons, left, i+1, backoff.TryTimeout())
+				if err != nil {
+					logger.Warn("digest failed", "output", outputName, "error", err)
+					retry, rejected, reason := splitRejected(left, err)
+					if len(rejected) > 0 {
+						deadLetter(deadLetters, collectionName, startedAt, map[string]error{outputName: reason}, rejected, logger)
+					}
+					mu.Lock()
+					if len(retry) < len(left) {
+						pending[outputName] = retry
+					}
+					if len(retry) > 0 {
+						if failed == nil {
+							failed = make(map[string]output.Interface)
+							failures = make(map[string]error)
+						}
+						failed[outputName] = cons
+						failures[outputName] = err
+					}
+					mu.Unlock()
+					if len(retry) > 0 {
+						return
+					}
+				}
+				if delivered != nil {
+					delivered(outputName)
+				}
+			}(outputName, cons)
+		}
+		wg.Wait()
+		if ctx.Err() != nil {
+			return nil, nil
+		}
+		for outputName, cons = range deferred {
+			if failed == nil {
+				failed = make(map[string]output.Interface)
+				failures = make(map[string]error)
+			}
+			failed[outputName] = cons
+			failures[outputName] = previous[outputName]
+		}
+		if len(failed) == 0 || time.Now().UTC().After(dieAt) {
+			return failures, pending
+		}
+		outputs = failed
+		backoffAt := latestTryAt.Add(backoff.Interval(i))
+		nextTryAt = time.Time{}
+		for outputName = range failed {
+			if _, ok := deferred[outputName]; !ok {
+				notBefore[outputName] = retryAt(backoffAt, failures[outputName])
+			}
+			if nextTryAt.IsZero() || notBefore[outputName].Before(nextTryAt) {
+				nextTryAt = notBefore[outputName]
+			}
+		}
+		if nextTryAt.After(dieAt) {
+			return failures, pending
+		}
+		for outputName = range failed {
+			if _, ok := deferred[outputName]; !ok {
+				pipe.failed(outputName, latestTryAt, failures[outputName], notBefore[outputName])
+				expiry.failed(collectionName, pipeID, outputName, len(documents), startedAt, dieAt, latestTryAt, notBefore[outputName], failures[outputName], logger)
+			}
+		}
+		i++
+		if waitFor := time.Until(nextTryAt); waitFor > 0 {
+			pipe.wait(ctx, waitFor)
+		}
+		if pipe.isDiscarded() || ctx.Err() != nil {
+			return nil, nil
+		}
+		if time.Now().Before(nextTryAt) {
+			// retried on demand, every output is tried right away
+			notBefore = make(map[string]time.Time)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package engine
+
+import (
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/khezen/bulklog/pkg/collection"
+	"github.com/khezen/bulklog/pkg/output/partial"
+)
+
+// splitRejected splits the documents of a failed try into the ones to retry, and the ones the output rejected for good along with the reason.
+// Every document is retried unless the output reported which ones failed.
+func splitRejected(documents []collection.Document, err error) (retry, rejected []collection.Document, reason error) {
+	var partialErr *partial.Error
+	if !errors.As(err, &partialErr) || partialErr.Total != len(documents) {
+		return documents, nil, nil
+	}
+	retry = make([]collection.Document, 0, len(partialErr.Failures))
+	for _, failure := range partialErr.Failures {
+		if failure.Index < 0 || failure.Index >= len(documents) {
+			continue
+		}
+		if !failure.Permanent {
+			retry = append(retry, documents[failure.Index])
+			continue
+		}
+		rejected = append(rejected, documents[failure.Index])
+		if reason == nil {
+			reason = errors.New(failure.Reason)
+		}
+	}
+	return retry, rejected, reason
+}
+
+// deadLetterPending notifies the pipe as expired and dead letters documents outputs failed to digest before retention ended.
+// Outputs which digested part of the documents only, listed in pending, get their own letter of the documents they have left.
+func deadLetterPending(
+	deadLetters DeadLetters,
+	expiry *ExpiryNotifier,
+	collectionName collection.Name,
+	pipeID string,
+	startedAt, expiresAt time.Time,
+	failures map[string]error,
+	documents []collection.Document,
+	pending map[string][]collection.Document,
+	logger *slog.Logger) {
+	if len(failures) > 0 {
+		expiry.expired(collectionName, pipeID, len(documents), startedAt, expiresAt, failures, logger)
+	}
+	whole := make(map[string]error, len(failures))
+	for outputName, err := range failures {
+		left, ok := pending[outputName]
+		if !ok {
+			whole[outputName] = err
+			continue
+		}
+		deadLetter(deadLetters, collectionName, startedAt, map[string]error{outputName: err}, left, logger)
+	}
+	deadLetter(deadLetters, collectionName, startedAt, whole, documents, logger)
+}
@@ -0,0 +1,140 @@
+package engine
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/khezen/bulklog/pkg/collection"
+	"github.com/khezen/bulklog/pkg/output"
+)
+
+// PauseMode - what a paused collection does with new documents
+type PauseMode string
+
+const (
+	// PauseReject - new documents are rejected with ErrCollectionPaused, pending pipes are still conveyed
+	PauseReject PauseMode = "reject"
+	// PauseBuffer - new documents are buffered and flushed as usual, but pipes of the collection are not conveyed until it is resumed
+	PauseBuffer PauseMode = "buffer"
+)
+
+// Pause - collection or output paused by this instance
+type Pause struct {
+	Collection collection.Name `json:"collection,omitempty"`
+	Output     string          `json:"output,omitempty"`
+	Mode       PauseMode       `json:"mode,omitempty"`
+	Since      time.Time       `json:"since"`
+}
+
+// pauses - collections and outputs paused by this instance, until it restarts
+type pauses struct {
+	sync.RWMutex
+	collections map[collection.Name]Pause
+	// deliveries are held by the gates of outputs
+	deliveries *output.Pauses
+}
+
+func newPauses() *pauses {
+	return &pauses{
+		collections: make(map[collection.Name]Pause),
+		deliveries:  output.NewPauses(),
+	}
+}
+
+// rejects tells whether new documents of a collection are rejected
+func (p *pauses) rejects(collectionName collection.Name) bool {
+	p.RLock()
+	defer p.RUnlock()
+	return p.collections[collectionName].Mode == PauseReject
+}
+
+// PauseCollection pauses a collection as mode tells, switching modes if it was paused already
+func (e *engine) PauseCollection(collectionName collection.Name, mode PauseMode) (Pause, error) {
+	switch mode {
+	case "":
+		mode = PauseReject
+	case PauseReject, PauseBuffer:
+	default:
+		return Pause{}, ErrUnknownPauseMode
+	}
+	e.RLock()
+	_, ok := e.collections[collectionName]
+	e.RUnlock()
+	if !ok {
+		return Pause{}, ErrNotFound
+	}
+	e.pauses.Lock()
+	defer e.pauses.Unlock()
+	pause, paused := e.pauses.collections[collectionName]
+	if !paused {
+		pause = Pause{Collection: collectionName, Since: time.Now().UTC()}
+	}
+	pause.Mode = mode
+	if mode == PauseBuffer {
+		e.pauses.deliveries.PauseCollection(collectionName)
+	} else {
+		e.pauses.deliveries.ResumeCollection(collectionName)
+	}
+	e.pauses.collections[collectionName] = pause
+	e.logger.Warn("collection paused", "collection", collectionName, "mode", mode)
+	return pause, nil
+}
+
+// ResumeCollection accepts new documents of a collection, and conveys its pipes, again
+func (e *engine) ResumeCollection(collectionName collection.Name) error {
+	e.pauses.Lock()
+	defer e.pauses.Unlock()
+	if _, paused := e.pauses.collections[collectionName]; !paused {
+		return ErrNotPaused
+	}
+	delete(e.pauses.collections, collectionName)
+	e.pauses.deliveries.ResumeCollection(collectionName)
+	e.logger.Info("collection resumed", "collection", collectionName)
+	return nil
+}
+
+// PauseOutput holds deliveries to an output, of every collection: pipes pending for it accumulate until it is resumed
+func (e *engine) PauseOutput(outputName string) (Pause, error) {
+	e.RLock()
+	_, ok := e.outputs[outputName]
+	e.RUnlock()
+	if !ok {
+		return Pause{}, ErrNotFound
+	}
+	since := e.pauses.deliveries.PauseOutput(outputName)
+	e.logger.Warn("output paused", "output", outputName)
+	return Pause{Output: outputName, Since: since}, nil
+}
+
+// ResumeOutput lets the deliveries held for an output go
+func (e *engine) ResumeOutput(outputName string) error {
+	if !e.pauses.deliveries.ResumeOutput(outputName) {
+		return ErrNotPaused
+	}
+	e.logger.Info("output resumed", "output", outputName)
+	return nil
+}
+
+// Pauses lists paused collections, then paused outputs
+func (e *engine) Pauses() []Pause {
+	e.pauses.RLock()
+	paused := make([]Pause, 0, len(e.pauses.collections))
+	for _, pause := range e.pauses.collections {
+		paused = append(paused, pause)
+	}
+	e.pauses.RUnlock()
+	sort.Slice(paused, func(i, j int) bool {
+		return paused[i].Collection < paused[j].Collection
+	})
+	outputs := e.pauses.deliveries.PausedOutputs()
+	outputNames := make([]string, 0, len(outputs))
+	for outputName := range outputs {
+		outputNames = append(outputNames, outputName)
+	}
+	sort.Strings(outputNames)
+	for _, outputName := range outputNames {
+		paused = append(paused, Pause{Output: outputName, Since: outputs[outputName]})
+	}
+	return paused
+}
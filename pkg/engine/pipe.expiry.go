@@ -0,0 +1,147 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/khezen/bulklog/pkg/collection"
+	"github.com/khezen/bulklog/pkg/config"
+)
+
+const (
+	// PipeExpiring - an output failed to digest a pipe, and will not try again before the expiry notice
+	PipeExpiring = "pipe.expiring"
+	// PipeExpired - an output did not digest a pipe before its retention period ended, its documents are dead lettered
+	PipeExpired = "pipe.expired"
+	// expiryWebhookTimeout bounds the post of an event, which is not retried
+	expiryWebhookTimeout = 10 * time.Second
+)
+
+// PipeEvent - pipe an output fails to digest as its retention period ends
+type PipeEvent struct {
+	Type       string          `json:"type"`
+	Collection collection.Name `json:"collection"`
+	Pipe       string          `json:"pipe"`
+	Output     string          `json:"output"`
+	Documents  int             `json:"documents"`
+	CreatedAt  time.Time       `json:"created_at"`
+	ExpiresAt  time.Time       `json:"expires_at"`
+	// NextRetryAt - next try of the output, for expiring pipes
+	NextRetryAt *time.Time `json:"next_retry_at,omitempty"`
+	// Error - latest failure of the output
+	Error string `json:"error,omitempty"`
+}
+
+// ExpiryNotifier logs pipe events and posts them to a webhook, if any.
+// A nil ExpiryNotifier logs expired pipes only.
+type ExpiryNotifier struct {
+	notice  time.Duration
+	url     string
+	headers map[string]string
+	httpcli http.Client
+}
+
+// NewExpiryNotifier notifies pipe events as set by cfg
+func NewExpiryNotifier(cfg config.PipeExpiry) (*ExpiryNotifier, error) {
+	notice, err := cfg.Notice()
+	if err != nil {
+		return nil, fmt.Errorf("Notice.%s", err)
+	}
+	notifier := &ExpiryNotifier{
+		notice:  notice,
+		httpcli: http.Client{Timeout: expiryWebhookTimeout},
+	}
+	if cfg.Webhook != nil {
+		notifier.url = cfg.Webhook.URL
+		notifier.headers = cfg.Webhook.Headers
+	}
+	return notifier, nil
+}
+
+// failed notifies a pipe as expiring the first time a failed try of an output is followed by one within the notice:
+// the try at latestTryAt was before the notice, the next one at nextRetryAt is not. Pipes which expire before their next try are only notified as expired.
+func (n *ExpiryNotifier) failed(collectionName collection.Name, pipeID, outputName string, documents int, createdAt, expiresAt, latestTryAt, nextRetryAt time.Time, err error, logger *slog.Logger) {
+	if n == nil || n.notice <= 0 {
+		return
+	}
+	noticeAt := expiresAt.Add(-n.notice)
+	if !latestTryAt.Before(noticeAt) || nextRetryAt.Before(noticeAt) || nextRetryAt.After(expiresAt) {
+		return
+	}
+	event := PipeEvent{
+		Type:        PipeExpiring,
+		Collection:  collectionName,
+		Pipe:        pipeID,
+		Output:      outputName,
+		Documents:   documents,
+		CreatedAt:   createdAt,
+		ExpiresAt:   expiresAt,
+		NextRetryAt: &nextRetryAt,
+	}
+	if err != nil {
+		event.Error = err.Error()
+	}
+	logger.Warn("pipe expiring", "output", outputName, "expires_at", expiresAt, "next_retry_at", nextRetryAt, "error", err)
+	n.post(event, logger)
+}
+
+// expired notifies the outputs which did not digest the documents of a pipe before its retention period ended
+func (n *ExpiryNotifier) expired(collectionName collection.Name, pipeID string, documents int, createdAt, expiresAt time.Time, failures map[string]error, logger *slog.Logger) {
+	for outputName, err := range failures {
+		event := PipeEvent{
+			Type:       PipeExpired,
+			Collection: collectionName,
+			Pipe:       pipeID,
+			Output:     outputName,
+			Documents:  documents,
+			CreatedAt:  createdAt,
+			ExpiresAt:  expiresAt,
+		}
+		if err != nil {
+			event.Error = err.Error()
+		}
+		logger.Error("pipe expired", "output", outputName, "documents", documents, "expires_at", expiresAt, "error", err)
+		if n != nil {
+			n.post(event, logger)
+		}
+	}
+}
+
+// post sends the event to the webhook in the background, failures are logged
+func (n *ExpiryNotifier) post(event PipeEvent, logger *slog.Logger) {
+	if n.url == "" {
+		return
+	}
+	body, err := json.Marshal(event)
+	if err != nil {
+		logger.Error("pipe event encoding failed", "error", err)
+		return
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), expiryWebhookTimeout)
+		defer cancel()
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, bytes.NewReader(body))
+		if err != nil {
+			logger.Error("pipe event post failed", "event", event.Type, "error", err)
+			return
+		}
+		req.Header.Set("Content-Type", "application/json")
+		for name, value := range n.headers {
+			req.Header.Set(name, value)
+		}
+		res, err := n.httpcli.Do(req)
+		if err != nil {
+			logger.Error("pipe event post failed", "event", event.Type, "error", err)
+			return
+		}
+		res.Body.Close()
+		if res.StatusCode >= 300 {
+			logger.Error("pipe event post failed", "event", event.Type, "status", res.Status)
+		}
+	}()
+}
@@ -0,0 +1,221 @@
+package engine
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/khezen/bulklog/pkg/collection"
+	"github.com/khezen/bulklog/pkg/output/retry"
+)
+
+// Pipe - documents flushed together, pending delivery to some outputs
+type Pipe struct {
+	ID        string       `json:"id"`
+	CreatedAt time.Time    `json:"created_at"`
+	ExpiresAt time.Time    `json:"expires_at"`
+	Documents int          `json:"documents"`
+	Bytes     int64        `json:"bytes,omitempty"`
+	Outputs   []PipeOutput `json:"outputs"`
+}
+
+// PipeOutput - output which did not digest a pipe yet
+type PipeOutput struct {
+	Name string `json:"name"`
+	// Iteration - failed tries so far
+	Iteration   int        `json:"iteration"`
+	NextRetryAt *time.Time `json:"next_retry_at,omitempty"`
+	// Attempts - latest failed tries, oldest first
+	Attempts []PipeAttempt `json:"attempts,omitempty"`
+}
+
+// maxPipeAttempts - failed tries kept in the attempt history of a pipe output
+const maxPipeAttempts = 10
+
+// PipeAttempt - failed try of an output
+type PipeAttempt struct {
+	At    time.Time `json:"at"`
+	Error string    `json:"error"`
+}
+
+// appendAttempt adds a failed try to an attempt history, dropping the oldest tries beyond maxPipeAttempts
+func appendAttempt(attempts []PipeAttempt, at time.Time, err error) []PipeAttempt {
+	attempt := PipeAttempt{At: at}
+	if err != nil {
+		attempt.Error = err.Error()
+	}
+	attempts = append(attempts, attempt)
+	if len(attempts) > maxPipeAttempts {
+		attempts = attempts[len(attempts)-maxPipeAttempts:]
+	}
+	return attempts
+}
+
+// retryAt - when a failed try is retried: once the backoff interval elapsed,
+// or later if the destination asked so, such as with a Retry-After header
+func retryAt(backoffAt time.Time, err error) time.Time {
+	if at := retry.At(err); at.After(backoffAt) {
+		return at.UTC()
+	}
+	return backoffAt
+}
+
+// PipeInspector is implemented by buffers whose pending pipes can be managed
+type PipeInspector interface {
+	// Pipes lists pending pipes, oldest first
+	Pipes() ([]Pipe, error)
+	// RetryPipe retries outputs of a pipe immediately
+	RetryPipe(id string) error
+	// DiscardPipe deletes a pipe without dead lettering it
+	DiscardPipe(id string) error
+	// PipeDocuments returns up to limit documents of a pipe from offset on, and how many documents it holds
+	PipeDocuments(id string, offset, limit int) ([]collection.Document, int, error)
+}
+
+// PipeDocuments - page of the documents a pending pipe holds, in their flush order
+type PipeDocuments struct {
+	Documents []BufferedDocument `json:"documents"`
+	Offset    int                `json:"offset"`
+	Total     int                `json:"total"`
+}
+
+// pageDocuments - up to limit documents from offset on
+func pageDocuments(documents []collection.Document, offset, limit int) []collection.Document {
+	if offset >= len(documents) {
+		return []collection.Document{}
+	}
+	documents = documents[offset:]
+	if len(documents) > limit {
+		documents = documents[:limit]
+	}
+	return documents
+}
+
+func sortPipes(pipes []Pipe) {
+	sort.Slice(pipes, func(i, j int) bool {
+		return pipes[i].CreatedAt.Before(pipes[j].CreatedAt)
+	})
+}
+
+// pipeState lets admin requests reach the goroutines conveying a pipe.
+// Failures and next retry are tracked for engines which do not persist them.
+// A nil pipeState is valid and never wakes up nor gets discarded.
+type pipeState struct {
+	sync.Mutex
+	failures    map[string]int
+	attempts    map[string][]PipeAttempt
+	nextRetryAt time.Time
+	wake        chan struct{}
+	discarded   bool
+}
+
+// wait until d elapses, ctx is done or the pipe is retried or discarded
+func (p *pipeState) wait(ctx context.Context, d time.Duration) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	var wake chan struct{}
+	if p != nil {
+		p.Lock()
+		wake = p.wake
+		p.Unlock()
+	}
+	select {
+	case <-timer.C:
+	case <-wake:
+	case <-ctx.Done():
+	}
+}
+
+func (p *pipeState) retry() {
+	p.Lock()
+	defer p.Unlock()
+	close(p.wake)
+	p.wake = make(chan struct{})
+}
+
+func (p *pipeState) discard() {
+	p.Lock()
+	defer p.Unlock()
+	if !p.discarded {
+		p.discarded = true
+		close(p.wake)
+		p.wake = make(chan struct{})
+	}
+}
+
+func (p *pipeState) isDiscarded() bool {
+	if p == nil {
+		return false
+	}
+	p.Lock()
+	defer p.Unlock()
+	return p.discarded
+}
+
+func (p *pipeState) failed(outputName string, triedAt time.Time, err error, nextRetryAt time.Time) {
+	if p == nil {
+		return
+	}
+	p.Lock()
+	defer p.Unlock()
+	p.failures[outputName]++
+	p.attempts[outputName] = appendAttempt(p.attempts[outputName], triedAt, err)
+	p.nextRetryAt = nextRetryAt
+}
+
+// outputs returns retry state of the given outputs as tracked by this process
+func (p *pipeState) outputs(outputNames []string) []PipeOutput {
+	outputs := make([]PipeOutput, 0, len(outputNames))
+	if p != nil {
+		p.Lock()
+		defer p.Unlock()
+	}
+	for _, outputName := range outputNames {
+		pipeOutput := PipeOutput{Name: outputName}
+		if p != nil && p.failures[outputName] > 0 {
+			nextRetryAt := p.nextRetryAt
+			pipeOutput.Iteration = p.failures[outputName]
+			pipeOutput.NextRetryAt = &nextRetryAt
+			pipeOutput.Attempts = append([]PipeAttempt(nil), p.attempts[outputName]...)
+		}
+		outputs = append(outputs, pipeOutput)
+	}
+	return outputs
+}
+
+// pipeRegistry - pipes being conveyed by this process, by ID
+type pipeRegistry struct {
+	sync.Mutex
+	pipes map[string]*pipeState
+}
+
+func (r *pipeRegistry) track(id string) *pipeState {
+	r.Lock()
+	defer r.Unlock()
+	if r.pipes == nil {
+		r.pipes = make(map[string]*pipeState)
+	}
+	pipe := &pipeState{
+		failures: make(map[string]int),
+		attempts: make(map[string][]PipeAttempt),
+		wake:     make(chan struct{}),
+	}
+	r.pipes[id] = pipe
+	return pipe
+}
+
+func (r *pipeRegistry) untrack(id string, pipe *pipeState) {
+	r.Lock()
+	defer r.Unlock()
+	if r.pipes[id] == pipe {
+		delete(r.pipes, id)
+	}
+}
+
+// get returns nil if the pipe is not conveyed by this process
+func (r *pipeRegistry) get(id string) *pipeState {
+	r.Lock()
+	defer r.Unlock()
+	return r.pipes[id]
+}
@@ -0,0 +1,97 @@
+package engine
+
+import (
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/khezen/bulklog/pkg/collection"
+)
+
+// Recovery - pipes a previous run left pending, found as the instance started conveying them again
+type Recovery struct {
+	Collection  collection.Name `json:"collection"`
+	RecoveredAt time.Time       `json:"recovered_at"`
+	Pipes       int             `json:"pipes"`
+	Documents   int             `json:"documents"`
+	// OldestPipeAt - creation of the oldest pipe found, nil if none was
+	OldestPipeAt *time.Time `json:"oldest_pipe_at,omitempty"`
+	// OldestPipeAge - age of the oldest pipe as it was found
+	OldestPipeAge string `json:"oldest_pipe_age,omitempty"`
+	// ExpiredPipes - pipes already past retention, they get one more try before their documents are dead lettered
+	ExpiredPipes     int `json:"expired_pipes"`
+	ExpiredDocuments int `json:"expired_documents"`
+}
+
+// RecoveryReporter is implemented by buffers whose pipes outlive the instance
+type RecoveryReporter interface {
+	Recovery() Recovery
+}
+
+// add counts a pipe found pending
+func (r *Recovery) add(pipe Pipe, foundAt time.Time) {
+	r.Pipes++
+	r.Documents += pipe.Documents
+	if r.OldestPipeAt == nil || pipe.CreatedAt.Before(*r.OldestPipeAt) {
+		createdAt := pipe.CreatedAt
+		r.OldestPipeAt = &createdAt
+		r.OldestPipeAge = foundAt.Sub(createdAt).Round(time.Second).String()
+	}
+	if !foundAt.Before(pipe.ExpiresAt) {
+		r.ExpiredPipes++
+		r.ExpiredDocuments += pipe.Documents
+	}
+}
+
+// recovery - what a buffer recovered since the instance started
+type recovery struct {
+	mu     sync.Mutex
+	report Recovery
+}
+
+func (r *recovery) Recovery() Recovery {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.report
+}
+
+// recovered adds the pipes found pending to the report of the buffer, then logs it
+func (r *recovery) recovered(pipes []Pipe, foundAt time.Time, logger *slog.Logger) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.report.RecoveredAt = foundAt
+	for _, pipe := range pipes {
+		r.report.add(pipe, foundAt)
+	}
+	report := r.report
+	args := []interface{}{"pipes", report.Pipes, "documents", report.Documents, "expired_pipes", report.ExpiredPipes, "expired_documents", report.ExpiredDocuments}
+	if report.OldestPipeAt != nil {
+		args = append(args, "oldest_pipe_age", report.OldestPipeAge)
+	}
+	if report.ExpiredPipes > 0 {
+		logger.Warn("recovery report", args...)
+		return
+	}
+	logger.Info("recovery report", args...)
+}
+
+// Recoveries reports the pipes collections recovered from previous runs
+func (e *engine) Recoveries() []Recovery {
+	e.RLock()
+	defer e.RUnlock()
+	reports := make([]Recovery, 0, len(e.buffers))
+	for collectionName, buffer := range e.buffers {
+		reporter, ok := buffer.(RecoveryReporter)
+		if !ok {
+			continue
+		}
+		report := reporter.Recovery()
+		report.Collection = collectionName
+		reports = append(reports, report)
+	}
+	sort.Slice(reports, func(i, j int) bool {
+		return reports[i].Collection < reports[j].Collection
+	})
+	return reports
+}
@@ -0,0 +1,94 @@
+package engine
+
+import (
+	"sync"
+	"time"
+)
+
+// redisAppender gathers the documents appended concurrently to a buffer, so that they are pushed in one transaction
+// rather than in one round trip each. Appends return once their batch is pushed, with its error if it failed.
+type redisAppender struct {
+	push         func(entries redisEntries) error
+	maxWait      time.Duration
+	maxDocuments int
+	mu           sync.Mutex
+	pending      *redisAppendBatch
+	// drained - appends are pushed on their own once the appender is drained, no timer would push them after shutdown
+	drained bool
+}
+
+// redisAppendBatch - documents of the appends waiting for the same push
+type redisAppendBatch struct {
+	entries redisEntries
+	pushed  chan struct{}
+	err     error
+}
+
+// newRedisAppender - appends are pushed on their own if maxWait is 0
+func newRedisAppender(push func(entries redisEntries) error, maxWait time.Duration, maxDocuments int) *redisAppender {
+	return &redisAppender{
+		push:         push,
+		maxWait:      maxWait,
+		maxDocuments: maxDocuments,
+	}
+}
+
+// append waits for other appends for up to maxWait, unless the batch holds maxDocuments, then pushes them all
+func (a *redisAppender) append(entries redisEntries) error {
+	if a.maxWait <= 0 {
+		return a.push(entries)
+	}
+	a.mu.Lock()
+	batch := a.pending
+	if batch == nil {
+		if a.drained || len(entries.encoded) >= a.maxDocuments {
+			a.mu.Unlock()
+			return a.push(entries)
+		}
+		batch = &redisAppendBatch{
+			entries: redisEntries{
+				encoded: make([]interface{}, 0, a.maxDocuments),
+				sizes:   make([]interface{}, 0, a.maxDocuments),
+			},
+			pushed: make(chan struct{}),
+		}
+		a.pending = batch
+		time.AfterFunc(a.maxWait, func() {
+			a.send(batch)
+		})
+	}
+	batch.entries.encoded = append(batch.entries.encoded, entries.encoded...)
+	batch.entries.sizes = append(batch.entries.sizes, entries.sizes...)
+	full := len(batch.entries.encoded) >= a.maxDocuments
+	a.mu.Unlock()
+	if full {
+		a.send(batch)
+	}
+	<-batch.pushed
+	return batch.err
+}
+
+// send pushes batch, unless it was pushed already
+func (a *redisAppender) send(batch *redisAppendBatch) {
+	a.mu.Lock()
+	if a.pending != batch {
+		a.mu.Unlock()
+		return
+	}
+	a.pending = nil
+	a.mu.Unlock()
+	batch.err = a.push(batch.entries)
+	close(batch.pushed)
+}
+
+// drain pushes the pending batch without waiting further, such as before the buffer is flushed on shutdown.
+// Later appends are pushed as they come.
+func (a *redisAppender) drain() {
+	a.mu.Lock()
+	batch := a.pending
+	a.drained = true
+	a.mu.Unlock()
+	if batch != nil {
+		a.send(batch)
+	}
+}
@@ -0,0 +1,109 @@
+package engine
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/khezen/bulklog/pkg/codec"
+	"github.com/khezen/bulklog/pkg/collection"
+	"github.com/khezen/bulklog/pkg/config"
+	"github.com/khezen/bulklog/pkg/encryption"
+	"github.com/khezen/bulklog/pkg/snappy"
+	"github.com/khezen/bulklog/pkg/zstd"
+)
+
+// compressedMarker starts compressed entries. Neither it nor the markers of codec formats are base64 characters,
+// so base64 gob entries are still decoded.
+const compressedMarker = 0x00
+
+// codecs of compressed entries, following the marker
+const (
+	snappyCodec byte = 's'
+	gzipCodec   byte = 'g'
+	zstdCodec   byte = 'z'
+)
+
+// encodeRedisDocument encodes a document in the storage format, compressed if configured, then encrypted by keyring unless it is nil.
+// Uncompressed gob entries are base64 encoded as older versions did, since gob streams have no marker.
+func encodeRedisDocument(doc *collection.Document, format collection.StorageFormat, compression config.Compression, keyring *encryption.Keyring) (string, error) {
+	entry, err := codec.Marshal(format, doc)
+	if err != nil {
+		return "", fmt.Errorf("codec.Marshal.%s", err)
+	}
+	switch compression {
+	case config.SnappyCompression:
+		entry = append([]byte{compressedMarker, snappyCodec}, snappy.Encode(entry)...)
+	case config.GzipCompression:
+		compressed := bytes.NewBuffer([]byte{compressedMarker, gzipCodec})
+		gz := gzip.NewWriter(compressed)
+		_, err := gz.Write(entry)
+		if err == nil {
+			err = gz.Close()
+		}
+		if err != nil {
+			return "", fmt.Errorf("gzip.Write.%s", err)
+		}
+		entry = compressed.Bytes()
+	case config.ZstdCompression:
+		entry = append([]byte{compressedMarker, zstdCodec}, zstd.Encode(entry)...)
+	default:
+		if !codec.Marked(entry) {
+			entry = []byte(base64.StdEncoding.EncodeToString(entry))
+		}
+	}
+	entry, err = sealEntry(keyring, entry)
+	if err != nil {
+		return "", fmt.Errorf("sealEntry.%s", err)
+	}
+	return string(entry), nil
+}
+
+// decodeRedisDocument decodes entries whatever the format, compression and encryption they were buffered with
+func decodeRedisDocument(entry []byte, keyring *encryption.Keyring) (doc collection.Document, err error) {
+	entry, err = openEntry(keyring, entry)
+	if err != nil {
+		return doc, fmt.Errorf("openEntry.%s", err)
+	}
+	var docBytes []byte
+	switch {
+	case len(entry) >= 2 && entry[0] == compressedMarker && entry[1] == snappyCodec:
+		docBytes, err = snappy.Decode(entry[2:])
+		if err != nil {
+			return doc, fmt.Errorf("snappy.Decode.%s", err)
+		}
+	case len(entry) >= 2 && entry[0] == compressedMarker && entry[1] == gzipCodec:
+		gz, err := gzip.NewReader(bytes.NewReader(entry[2:]))
+		if err != nil {
+			return doc, fmt.Errorf("gzip.NewReader.%s", err)
+		}
+		docBytes, err = ioutil.ReadAll(gz)
+		if err != nil {
+			return doc, fmt.Errorf("gzip.Read.%s", err)
+		}
+	case len(entry) >= 2 && entry[0] == compressedMarker && entry[1] == zstdCodec:
+		docBytes, err = ioutil.ReadAll(zstd.NewReader(bytes.NewReader(entry[2:])))
+		if err != nil {
+			return doc, fmt.Errorf("zstd.Read.%s", err)
+		}
+	case len(entry) >= 1 && entry[0] == compressedMarker:
+		return doc, ErrUnknownCompression
+	case codec.Marked(entry):
+		docBytes = entry
+	default:
+		docBytes, err = base64.StdEncoding.DecodeString(string(entry))
+		if err != nil {
+			return doc, fmt.Errorf("base64.std.decode.%s", err)
+		}
+	}
+	doc, err = codec.Unmarshal(docBytes)
+	if err == ErrCorruptedDocument {
+		return doc, err
+	}
+	if err != nil {
+		return doc, fmt.Errorf("codec.Unmarshal.%s", err)
+	}
+	return doc, nil
+}
@@ -0,0 +1,60 @@
+package engine
+
+import (
+	"bytes"
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/khezen/bulklog/pkg/collection"
+	"github.com/khezen/bulklog/pkg/config"
+	"github.com/khezen/bulklog/pkg/encryption"
+)
+
+// TestRedisDocumentRoundTrip checks entries decode whatever the compression, storage format and encryption they were buffered with
+func TestRedisDocumentRoundTrip(t *testing.T) {
+	keyring, err := encryption.New(encryption.Config{Key: base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{7}, 32))})
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc := testDocument(t, `{"msg":"`+strings.Repeat("buffered ", 100)+`"}`)
+	markers := map[config.Compression]string{
+		config.SnappyCompression: "\x00s",
+		config.GzipCompression:   "\x00g",
+		config.ZstdCompression:   "\x00z",
+	}
+	for _, compression := range []config.Compression{"", config.NoCompression, config.SnappyCompression, config.GzipCompression, config.ZstdCompression} {
+		for _, format := range []collection.StorageFormat{collection.ProtobufStorage, collection.MsgpackStorage, collection.JSONStorage, collection.GobStorage} {
+			for _, keys := range []*encryption.Keyring{nil, keyring} {
+				entry, err := encodeRedisDocument(&doc, format, compression, keys)
+				if err != nil {
+					t.Fatalf("%s %s: encodeRedisDocument: %s", compression, format, err)
+				}
+				if marker, ok := markers[compression]; ok && keys == nil && !strings.HasPrefix(entry, marker) {
+					t.Fatalf("%s %s: entry starts with %q, want %q", compression, format, entry[:2], marker)
+				}
+				if compression != "" && compression != config.NoCompression && keys == nil && len(entry) >= len(doc.Body) {
+					t.Fatalf("%s %s: entry of %d bytes, not compressed", compression, format, len(entry))
+				}
+				decoded, err := decodeRedisDocument([]byte(entry), keys)
+				if err != nil {
+					t.Fatalf("%s %s: decodeRedisDocument: %s", compression, format, err)
+				}
+				if decoded.ID != doc.ID || !bytes.Equal(decoded.Body, doc.Body) || decoded.SchemaName != doc.SchemaName {
+					t.Fatalf("%s %s: decoded %+v, want %+v", compression, format, decoded, doc)
+				}
+			}
+		}
+	}
+}
+
+func TestRedisDocumentUnknownCodec(t *testing.T) {
+	_, err := decodeRedisDocument([]byte("\x00x..."), nil)
+	if err != ErrUnknownCompression {
+		t.Fatalf("decodeRedisDocument: got %v, want %v", err, ErrUnknownCompression)
+	}
+	_, err = decodeRedisDocument([]byte("\x00zcorrupted"), nil)
+	if err == nil {
+		t.Fatal("decodeRedisDocument of a corrupted zstd entry: got no error")
+	}
+}
@@ -0,0 +1,122 @@
+package engine
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// redisFlushScript moves the buffer list KEYS[1] into the new pipe documents list KEYS[5],
+// adding the pipe with fields ARGV[3:] to the stream KEYS[4], if the flush time KEYS[3] still is ARGV[1], empty if unset.
+// It resets the buffer size KEYS[2] and the list of entry sizes KEYS[7], and sets the flush time to ARGV[2].
+// The buffer checksum KEYS[6] moves to the checksum field of the pipe, unless the buffer was filled before checksums were kept.
+// It returns the number of flushed documents, -1 if another instance flushed since the flush time was read.
+var redisFlushScript = redis.NewScript(7, `
+local flushedAt = redis.call("GET", KEYS[3]) or ""
+if flushedAt ~= ARGV[1] then
+	return -1
+end
+local documents = redis.call("LLEN", KEYS[1])
+redis.call("SET", KEYS[3], ARGV[2])
+if documents == 0 then
+	return 0
+end
+redis.call("RENAME", KEYS[1], KEYS[5])
+redis.call("DEL", KEYS[2], KEYS[7])
+local fields = {unpack(ARGV, 3)}
+local checksum = redis.call("HMGET", KEYS[6], "documents", "sum")
+if checksum[1] and checksum[2] then
+	table.insert(fields, "checksum")
+	table.insert(fields, checksum[1] .. ":" .. checksum[2])
+end
+redis.call("DEL", KEYS[6])
+redis.call("XADD", KEYS[4], "*", unpack(fields))
+return documents
+`)
+
+// redisFlushedAtScript sets the flush time KEYS[1] to ARGV[1] unless it holds a value other than ARGV[2], empty if unset.
+// Keys of another type are replaced, and the flush time is kept from expiring.
+// It returns the flush time.
+var redisFlushedAtScript = redis.NewScript(1, `
+local kind = redis.call("TYPE", KEYS[1]).ok
+if kind == "string" then
+	local flushedAt = redis.call("GET", KEYS[1])
+	if flushedAt ~= ARGV[2] then
+		redis.call("PERSIST", KEYS[1])
+		return flushedAt
+	end
+elseif kind ~= "none" then
+	redis.call("DEL", KEYS[1])
+end
+redis.call("SET", KEYS[1], ARGV[1])
+return ARGV[1]
+`)
+
+// initFlushedAt reads the flush time of the buffer, setting it to now if it is missing.
+// Instances which start on a fresh redis thus share the same first flush period, the one which sets it first.
+func (b *redisBuffer) initFlushedAt() (time.Time, error) {
+	conn := b.redis.Get()
+	defer conn.Close()
+	now := b.clock.Now()
+	flushedAtStr, err := redis.String(redisFlushedAtScript.Do(conn, b.timeKey, now.Format(time.RFC3339Nano), ""))
+	if err != nil {
+		return now, fmt.Errorf("(EVALSHA flushedAt).%s", err)
+	}
+	_, flushedAt, err := b.checkFlushedAt(conn, flushedAtStr, now)
+	return flushedAt, err
+}
+
+// getFlushedAt reads the flush time of the buffer, as stored and parsed.
+// A missing flush time is set to now, as well as an unparsable one, rather than failing every flush.
+func (b *redisBuffer) getFlushedAt(conn redis.Conn, now time.Time) (string, time.Time, error) {
+	flushedAtStr, err := redis.String(conn.Do("GET", b.timeKey))
+	switch {
+	case err == redis.ErrNil:
+		b.logger.Warn("flush time missing, initialized")
+		return b.repairFlushedAt(conn, "", now)
+	case err != nil && strings.HasPrefix(err.Error(), "WRONGTYPE"):
+		b.logger.Warn("flush time of the wrong type, repaired")
+		return b.repairFlushedAt(conn, "", now)
+	case err != nil:
+		return "", now, fmt.Errorf("(GET collection.flushedAt).%s", err)
+	}
+	return b.checkFlushedAt(conn, flushedAtStr, now)
+}
+
+// checkFlushedAt parses a flush time, it is repaired if it is unparsable
+func (b *redisBuffer) checkFlushedAt(conn redis.Conn, flushedAtStr string, now time.Time) (string, time.Time, error) {
+	flushedAt, err := time.Parse(time.RFC3339Nano, flushedAtStr)
+	if err == nil {
+		return flushedAtStr, flushedAt, nil
+	}
+	b.logger.Warn("flush time unparsable, repaired", "flushed_at", flushedAtStr, "error", err)
+	return b.repairFlushedAt(conn, flushedAtStr, now)
+}
+
+// repairFlushedAt sets the flush time to now if it still is invalid, invalid being empty if unset.
+// Another instance may have repaired it meanwhile, the flush time it set is returned then.
+func (b *redisBuffer) repairFlushedAt(conn redis.Conn, invalid string, now time.Time) (string, time.Time, error) {
+	flushedAtStr, err := redis.String(redisFlushedAtScript.Do(conn, b.timeKey, now.Format(time.RFC3339Nano), invalid))
+	if err != nil {
+		return "", now, fmt.Errorf("(EVALSHA flushedAt).%s", err)
+	}
+	flushedAt, err := time.Parse(time.RFC3339Nano, flushedAtStr)
+	if err != nil {
+		return "", now, fmt.Errorf("parseFlushedAtStr.%s", err)
+	}
+	return flushedAtStr, flushedAt, nil
+}
+
+// flushRedis atomically moves the buffer into a new pipe unless it was flushed since flushedAt was read
+func (b *redisBuffer) flushRedis(conn redis.Conn, flushedAt, pipeKey string, fields []interface{}, now time.Time) (documents int, err error) {
+	args := make([]interface{}, 0, len(fields)+9)
+	args = append(args, b.bufferKey, b.bytesKey, b.timeKey, b.streamKey, fmt.Sprintf("%s.buffer", pipeKey), b.checksumKey, b.sizesKey, flushedAt, now.Format(time.RFC3339Nano))
+	args = append(args, fields...)
+	documents, err = redis.Int(redisFlushScript.Do(conn, args...))
+	if err != nil {
+		return 0, fmt.Errorf("(EVALSHA flush).%s", err)
+	}
+	return documents, nil
+}
@@ -1,190 +1,365 @@
 package engine
 
 import (
-	"bytes"
-	"encoding/base64"
-	"encoding/gob"
+	"context"
 	"fmt"
+	"log/slog"
+	"sync"
 	"time"
 
 	"github.com/gomodule/redigo/redis"
 	"github.com/google/uuid"
+	"github.com/khezen/bulklog/pkg/clock"
 	"github.com/khezen/bulklog/pkg/collection"
 	"github.com/khezen/bulklog/pkg/config"
-	"github.com/khezen/bulklog/pkg/log"
+	"github.com/khezen/bulklog/pkg/encryption"
 	"github.com/khezen/bulklog/pkg/output"
+	"github.com/khezen/bulklog/pkg/trace"
 )
 
 type redisBuffer struct {
+	flusherState
+	reloadable
 	redis         *redis.Pool
-	collection    *collection.Collection
-	outputs       map[string]output.Interface
+	compression   config.Compression
+	keyring       *encryption.Keyring
+	deadLetters   DeadLetters
+	expiry        *ExpiryNotifier
+	logger        *slog.Logger
 	bufferKey     string
+	bytesKey      string
+	sizesKey      string
+	checksumKey   string
 	timeKey       string
 	pipeKeyPrefix string
+	streamKey     string
+	consumer      string
+	// clock - time source of flushes, shared with the other instances if it is the clock of redis
+	clock clock.Clock
+	// skewTolerance - flush periods are over this long before they end
+	skewTolerance time.Duration
 	flushedAt     time.Time
 	close         chan struct{}
+	closeOnce     sync.Once
+	conveying     sync.WaitGroup
+	// ctx is cancelled once shutdown stops waiting for conveyances
+	ctx      context.Context
+	cancel   context.CancelFunc
+	flushing sync.Mutex
+	pipes    pipeRegistry
+	lease    *redisLease
+	// appends - documents appended to a buffer without limits are pushed in batches
+	appends *redisAppender
+	integrity
+	recovery
 }
 
-// RedisBuffer -
-func RedisBuffer(collec *collection.Collection, redisCfg *config.Redis, outputs map[string]output.Interface) Buffer {
+// RedisBuffer - documents are encrypted by keyring unless it is nil
+func RedisBuffer(collec *collection.Collection, redisCfg *config.Redis, keyring *encryption.Keyring, outputs map[string]output.Interface, deadLetters DeadLetters, expiry *ExpiryNotifier, logger *slog.Logger) Buffer {
+	keyPrefix := redisKeyPrefix(redisCfg, collec.Name)
+	ctx, cancel := context.WithCancel(context.Background())
+	red := newRedisPool(redisCfg)
+	// validated on load
+	skewTolerance, _ := redisCfg.ClockSkewTolerance()
+	appendMaxWait, _ := redisCfg.AppendBatch.MaxWait()
+	appendMaxDocuments, _ := redisCfg.AppendBatch.Documents()
+	timeSource := newRedisClock(red, redisCfg, skewTolerance, logger)
 	rbuffer := &redisBuffer{
-		redis: &redis.Pool{
-			MaxActive:   redisCfg.MaxConn,
-			Wait:        true,
-			MaxIdle:     redisCfg.IdleConn,
-			IdleTimeout: 5 * time.Minute,
-			Dial: func() (redis.Conn, error) {
-				c, err := redis.Dial("tcp", redisCfg.Endpoint)
-				if err != nil {
-					return nil, err
-				}
-				if redisCfg.Password != "" {
-					if _, err := c.Do("AUTH", redisCfg.Password); err != nil {
-						c.Close()
-						return nil, err
-					}
-				}
-				if _, err := c.Do("SELECT", redisCfg.DB); err != nil {
-					c.Close()
-					return nil, err
-				}
-				return c, nil
-			},
-			TestOnBorrow: func(c redis.Conn, t time.Time) error {
-				if time.Since(t) < time.Minute {
-					return nil
-				}
-				_, err := c.Do("PING")
-				return err
-			},
-		},
-		collection:    collec,
-		outputs:       outputs,
-		bufferKey:     fmt.Sprintf("bulklog.%s.buffer", collec.Name),
-		timeKey:       fmt.Sprintf("bulklog.%s.flushedAt", collec.Name),
-		pipeKeyPrefix: fmt.Sprintf("bulklog.%s.pipes", collec.Name),
-		flushedAt:     time.Now().UTC(),
+		redis:         red,
+		compression:   redisCfg.Compression,
+		keyring:       keyring,
+		deadLetters:   deadLetters,
+		expiry:        expiry,
+		logger:        logger,
+		bufferKey:     fmt.Sprintf("%s.buffer", keyPrefix),
+		bytesKey:      fmt.Sprintf("%s.bufferBytes", keyPrefix),
+		sizesKey:      fmt.Sprintf("%s.bufferSizes", keyPrefix),
+		checksumKey:   fmt.Sprintf("%s.bufferChecksum", keyPrefix),
+		timeKey:       fmt.Sprintf("%s.flushedAt", keyPrefix),
+		pipeKeyPrefix: fmt.Sprintf("%s.pipes", keyPrefix),
+		streamKey:     fmt.Sprintf("%s.pipes.stream", keyPrefix),
+		consumer:      redisStreamConsumer(),
+		clock:         timeSource,
+		skewTolerance: skewTolerance,
 		close:         make(chan struct{}),
+		ctx:           ctx,
+		cancel:        cancel,
+	}
+	rbuffer.appends = newRedisAppender(rbuffer.pushChecked, appendMaxWait, appendMaxDocuments)
+	rbuffer.apply(collec, outputs)
+	err := createRedisStreamGroups(rbuffer.redis, rbuffer.streamKey, outputs)
+	if err != nil {
+		logger.Error("output groups creation failed", "error", err)
 	}
-	redisConveyAll(rbuffer.redis, rbuffer.pipeKeyPrefix, rbuffer.outputs)
+	// instances flushing the buffer for the first time agree on when its first flush period started
+	rbuffer.flushedAt, err = rbuffer.initFlushedAt()
+	if err != nil {
+		logger.Error("flush time initialization failed", "error", err)
+		rbuffer.flushedAt = timeSource.Now()
+	}
+	// the report starts with the pipes of the stream left to this instance, before it claims them again
+	found, err := rbuffer.consumerStreamPipes()
+	if err != nil {
+		logger.Error("pending pipes listing failed", "error", err)
+	}
+	rbuffer.recovered(found, time.Now().UTC(), logger)
+	// instances sharing the buffer elect one of them to flush it every period, and to convey pipes flushed by earlier versions,
+	// hashes and lists, as they were
+	rbuffer.lease = newRedisLease(rbuffer.redis, fmt.Sprintf("%s.flushLease", keyPrefix), logger, func() {
+		foundAt := time.Now().UTC()
+		found := redisConveyAll(collection.WithPriority(rbuffer.ctx, rbuffer.collection().Priority), rbuffer.redis, rbuffer.keyring, rbuffer.pipeKeyPrefix, rbuffer.outputs(), collec.Name, deadLetters, expiry, &rbuffer.pipes, &rbuffer.integrity, logger)
+		if len(found) > 0 {
+			rbuffer.recovered(found, foundAt, logger)
+		}
+	})
+	rbuffer.conveying.Add(2)
+	go rbuffer.conveyStreams()
+	go rbuffer.reapPipes()
 	return rbuffer
 }
 
+// Reload creates the groups of added outputs before pipes are flushed to them
+func (b *redisBuffer) Reload(collec *collection.Collection, outputs map[string]output.Interface) error {
+	err := createRedisStreamGroups(b.redis, b.streamKey, outputs)
+	if err != nil {
+		return fmt.Errorf("createRedisStreamGroups.%s", err)
+	}
+	return b.reloadable.Reload(collec, outputs)
+}
+
 func (b *redisBuffer) Append(doc *collection.Document) (err error) {
-	var buf bytes.Buffer
-	err = gob.NewEncoder(&buf).Encode(*doc)
+	return b.AppendBatch(*doc)
+}
+
+func (b *redisBuffer) AppendBatch(documents ...collection.Document) (err error) {
+	entries := redisEntries{
+		encoded: make([]interface{}, 0, len(documents)),
+		sizes:   make([]interface{}, 0, len(documents)),
+	}
+	for i := range documents {
+		entry, err := encodeRedisDocument(&documents[i], b.collection().Serialization.Storage, b.compression, b.keyring)
+		if err != nil {
+			return fmt.Errorf("encodeRedisDocument.%s", err)
+		}
+		entries.encoded = append(entries.encoded, entry)
+		entries.sizes = append(entries.sizes, len(documents[i].Body))
+	}
+	limits := b.collection().BufferLimits
+	if limits.Bounded() {
+		err = admit(limits, documents, func() (bool, error) {
+			return b.admitRedis(entries, false)
+		}, func() (bool, error) {
+			return b.admitRedis(entries, true)
+		})
+		if err != nil {
+			return err
+		}
+		err = b.checkThreshold()
+		if err != nil {
+			b.logger.Error("flush failed", "error", err)
+		}
+		return nil
+	}
+	return b.appends.append(entries)
+}
+
+// redisEntries - encoded documents, and the sizes of their bodies which buffer limits and flush thresholds count
+type redisEntries struct {
+	encoded []interface{}
+	sizes   []interface{}
+}
+
+// pushChecked pushes encoded documents, then flushes the buffer if they filled it.
+// Documents are buffered once pushed, a failed flush is logged rather than failing their appends, which would be retried as duplicates.
+func (b *redisBuffer) pushChecked(entries redisEntries) error {
+	err := b.push(entries)
 	if err != nil {
-		return
+		return err
 	}
-	docBase64 := base64.StdEncoding.EncodeToString(buf.Bytes())
-	conn := b.redis.Get()
-	defer conn.Close()
-	_, err = conn.Do("RPUSH", b.bufferKey, docBase64)
+	err = b.checkThreshold()
 	if err != nil {
-		return fmt.Errorf("(RPUSH collection.buffer docBase64).%s", err)
+		b.logger.Error("flush failed", "error", err)
 	}
 	return nil
 }
 
-func (b *redisBuffer) AppendBatch(documents ...collection.Document) (err error) {
-	args := make([]interface{}, 0, len(documents)+1)
-	args = append(args, b.bufferKey)
-	for _, doc := range documents {
-		var buf bytes.Buffer
-		err = gob.NewEncoder(&buf).Encode(doc)
-		if err != nil {
-			return
-		}
-		args = append(args, base64.StdEncoding.EncodeToString(buf.Bytes()))
+// checkThreshold flushes the buffer if its size triggers flushes and reached the threshold
+func (b *redisBuffer) checkThreshold() error {
+	if !b.collection().SizeTriggered() {
+		return nil
 	}
-	conn := b.redis.Get()
-	defer conn.Close()
-	_, err = conn.Do("RPUSH", args...)
+	err := b.flushIfThresholdReached()
 	if err != nil {
-		return fmt.Errorf("(RPUSH collection.buffer docBase64).%s", err)
+		return fmt.Errorf("flushIfThresholdReached.%s", err)
 	}
 	return nil
 }
 
-func (b *redisBuffer) Flush() (err error) {
+// push appends encoded documents to the buffer and accounts their size and checksum.
+// The body size of each entry is kept in a list alongside the buffer, so that dropping the oldest entries accounts their sizes back.
+func (b *redisBuffer) push(entries redisEntries) (err error) {
 	var (
-		now     = time.Now().UTC()
-		pipeID  = uuid.New()
-		pipeKey = fmt.Sprintf("%s.%s", b.pipeKeyPrefix, pipeID)
+		size     int
+		checksum pipeChecksum
 	)
+	for i, entry := range entries.encoded {
+		size += entries.sizes[i].(int)
+		checksum.add(redisEntryChecksum([]byte(entry.(string))))
+	}
 	conn := b.redis.Get()
 	defer conn.Close()
-	flushedAtStr, err := conn.Do("GET", b.timeKey)
+	err = conn.Send("MULTI")
 	if err != nil {
-		return fmt.Errorf("(GET collection.flushedAt).%s", err)
-	}
-	if flushedAtStr != nil {
-		b.flushedAt, err = time.Parse(time.RFC3339Nano, string(flushedAtStr.([]byte)))
-		if err != nil {
-			return fmt.Errorf("parseFlushedAtStr.%s", err)
-		}
+		return fmt.Errorf("MULTI.%s", err)
 	}
-	if time.Since(b.flushedAt) < b.collection.FlushPeriod {
-		return
+	err = conn.Send("RPUSH", append([]interface{}{b.bufferKey}, entries.encoded...)...)
+	if err != nil {
+		return fmt.Errorf("(RPUSH collection.buffer entries).%s", err)
 	}
-	bufferLen, err := conn.Do("LLEN", b.bufferKey)
+	err = conn.Send("RPUSH", append([]interface{}{b.sizesKey}, entries.sizes...)...)
 	if err != nil {
-		return fmt.Errorf("(LLEN bufferKey).%s", err)
+		return fmt.Errorf("(RPUSH collection.bufferSizes sizes).%s", err)
 	}
-	if bufferLen == 0 {
-		_, err = conn.Do("SET", b.timeKey, now.Format(time.RFC3339Nano))
-		if err != nil {
-			return fmt.Errorf("(SET collection.flushedAt %s).%s", now.Format(time.RFC3339Nano), err)
-		}
-		b.flushedAt = now
-		return
+	err = conn.Send("INCRBY", b.bytesKey, size)
+	if err != nil {
+		return fmt.Errorf("(INCRBY collection.bufferBytes).%s", err)
 	}
-	pipeID = uuid.New()
-	pipeKey = fmt.Sprintf("%s.%s", b.pipeKeyPrefix, pipeID)
-	err = conn.Send("MULTI")
+	err = conn.Send("HINCRBY", b.checksumKey, "documents", checksum.documents)
 	if err != nil {
-		return fmt.Errorf("MULTI.%s", err)
+		return fmt.Errorf("(HINCRBY collection.bufferChecksum documents).%s", err)
 	}
-	err = newRedisPipe(conn, pipeKey, b.collection.FlushPeriod, b.collection.RetentionPeriod, now)
+	err = conn.Send("HINCRBY", b.checksumKey, "sum", checksum.sum)
 	if err != nil {
-		return fmt.Errorf("newRedisPipe.%s", err)
+		return fmt.Errorf("(HINCRBY collection.bufferChecksum sum).%s", err)
 	}
-	err = addRedisPipeoutputs(conn, pipeKey, b.outputs)
+	_, err = conn.Do("EXEC")
 	if err != nil {
-		return fmt.Errorf("addRedisPipeoutputs.%s", err)
+		return fmt.Errorf("EXEC.%s", err)
 	}
-	err = flushBuffer2RedisPipe(conn, b.bufferKey, pipeKey)
+	return nil
+}
+
+func (b *redisBuffer) flushIfThresholdReached() error {
+	b.flushing.Lock()
+	defer b.flushing.Unlock()
+	conn := b.redis.Get()
+	documents, err := redis.Int(conn.Do("LLEN", b.bufferKey))
 	if err != nil {
-		return fmt.Errorf("flushBuffer2RedisPipe.%s", err)
+		conn.Close()
+		return fmt.Errorf("(LLEN collection.buffer).%s", err)
+	}
+	size, err := redis.Int64(conn.Do("GET", b.bytesKey))
+	conn.Close()
+	if err != nil && err != redis.ErrNil {
+		return fmt.Errorf("(GET collection.bufferBytes).%s", err)
+	}
+	if !b.collection().FlushThresholdReached(documents, size) {
+		return nil
+	}
+	return b.flushLocked(b.ctx, true)
+}
+
+func (b *redisBuffer) Flush(ctx context.Context) (err error) {
+	return b.flush(ctx, false)
+}
+
+// periodicFlush flushes if this instance holds the flush lease, others check again one flush period later
+func (b *redisBuffer) periodicFlush() error {
+	if !b.lease.Held() {
+		b.flushing.Lock()
+		b.flushedAt = b.clock.Now()
+		b.flushing.Unlock()
+		return nil
+	}
+	return b.Flush(b.ctx)
+}
+
+// flush moves the buffer into a new pipe; unless forced, at most once per flush period
+func (b *redisBuffer) flush(ctx context.Context, force bool) (err error) {
+	b.flushing.Lock()
+	defer b.flushing.Unlock()
+	return b.flushLocked(ctx, force)
+}
+
+// flushLocked gives up if ctx is done before the flush script runs, the script itself is atomic
+func (b *redisBuffer) flushLocked(ctx context.Context, force bool) (err error) {
+	if ctx.Err() != nil {
+		return ctx.Err()
 	}
-	err = conn.Send("SET", b.timeKey, now.Format(time.RFC3339Nano))
+	var (
+		now      = b.clock.Now()
+		pipeID   = uuid.New()
+		pipeKey  = fmt.Sprintf("%s.%s", b.pipeKeyPrefix, pipeID)
+		settings = b.current.Load()
+	)
+	conn := b.redis.Get()
+	defer conn.Close()
+	flushedAtStr, flushedAt, err := b.getFlushedAt(conn, now)
 	if err != nil {
-		return fmt.Errorf("(SET collection.flushedAt %s).%s", now.Format(time.RFC3339Nano), err)
+		return fmt.Errorf("getFlushedAt.%s", err)
 	}
-	_, err = conn.Do("EXEC")
+	b.flushedAt = flushedAt
+	if !force && now.Sub(b.flushedAt) < settings.collection.FlushPeriod-b.skewTolerance {
+		return nil
+	}
+	// the span is recorded only if a pipe is created, its context is written in the pipe beforehand
+	span := startFlushSpan(settings.collection.Name, nil)
+	fields := redisStreamPipeFields(pipeID.String(), settings.collection.Backoff, settings.collection.RetentionPeriod, now, span.Context().Traceparent())
+	documents, err := b.flushRedis(conn, flushedAtStr, pipeKey, fields, now)
 	if err != nil {
-		return fmt.Errorf("EXEC.%s", err)
+		span.SetError(err)
+		span.End()
+		return fmt.Errorf("flushRedis.%s", err)
+	}
+	if documents < 0 {
+		// flushed by another instance meanwhile, its flush time is read on the next flush
+		return nil
 	}
 	b.flushedAt = now
-	go presetRedisConvey(b.redis, pipeKey, b.outputs, now, b.collection.FlushPeriod, b.collection.RetentionPeriod)
+	if documents == 0 {
+		return nil
+	}
+	span.SetAttributes(
+		trace.String("bulklog.pipe", pipeKey),
+		trace.Int("bulklog.documents", documents),
+	)
+	span.End()
+	// conveyed right away rather than on the next poll, by this instance unless another one reads it first
+	b.conveying.Add(1)
+	go func() {
+		b.readStreamPipes()
+		b.conveying.Done()
+	}()
 	return nil
 }
 
 // Flusher flushes every tick
 func (b *redisBuffer) Flusher() func() {
 	return func() {
+		b.flusherStarted()
+		defer b.flusherStopped()
 		var (
 			timer   *time.Timer
 			waitFor time.Duration
 			err     error
 		)
 		for {
-			waitFor = b.collection.FlushPeriod - time.Since(b.flushedAt)
-			if waitFor <= 0 {
-				err := b.Flush()
+			flushPeriod := b.collection().FlushPeriod
+			if flushPeriod <= 0 {
+				select {
+				case <-b.close:
+					return
+				case <-b.reloaded():
+					b.flusherReloaded()
+				}
+				continue
+			}
+			waitFor = flushPeriod - b.clock.Now().Sub(b.flushedAt)
+			if waitFor <= b.skewTolerance {
+				b.flushAttempted()
+				err := b.periodicFlush()
 				if err != nil {
-					log.Err().Printf("Flush.%s)\n", err)
+					b.logger.Error("flush failed", "error", err)
 					timer = time.NewTimer(time.Second)
 					<-timer.C
 				}
@@ -193,11 +368,16 @@ func (b *redisBuffer) Flusher() func() {
 			timer = time.NewTimer(waitFor)
 			select {
 			case <-b.close:
+				timer.Stop()
 				return
+			case <-b.reloaded():
+				timer.Stop()
+				b.flusherReloaded()
 			case <-timer.C:
-				err = b.Flush()
+				b.flushAttempted()
+				err = b.periodicFlush()
 				if err != nil {
-					log.Err().Printf("Flush.%s)\n", err)
+					b.logger.Error("flush failed", "error", err)
 				}
 				break
 			}
@@ -206,5 +386,63 @@ func (b *redisBuffer) Flusher() func() {
 }
 
 func (b *redisBuffer) Close() {
-	b.close <- struct{}{}
+	b.closeOnce.Do(func() {
+		close(b.close)
+		err := b.lease.Close()
+		if err != nil {
+			b.logger.Error("lease release failed", "error", err)
+		}
+	})
+}
+
+// Shutdown flushes the buffer regardless of the flush period and waits for pipes conveyance.
+// Pipes which are not conveyed before ctx is done remain in redis for the next start.
+func (b *redisBuffer) Shutdown(ctx context.Context) error {
+	b.Close()
+	b.appends.drain()
+	err := b.flush(ctx, true)
+	if err != nil {
+		return fmt.Errorf("flush.%s", err)
+	}
+	return waitConveying(ctx, &b.conveying, b.cancel)
+}
+
+// Ping checks redis connectivity
+func (b *redisBuffer) Ping(ctx context.Context) error {
+	return pingRedis(b.redis)
+}
+
+// bufferedBytes - bytes of the bodies of documents buffered since the last flush
+func (b *redisBuffer) bufferedBytes() (int64, error) {
+	conn := b.redis.Get()
+	defer conn.Close()
+	size, err := redis.Int64(conn.Do("GET", b.bytesKey))
+	if err != nil && err != redis.ErrNil {
+		return 0, fmt.Errorf("(GET collection.bufferBytes).%s", err)
+	}
+	return size, nil
+}
+
+// Tail decodes the last n entries of the buffer list, entries which cannot be decoded are skipped
+func (b *redisBuffer) Tail(n int) ([]collection.Document, error) {
+	start := -n
+	if n <= 0 {
+		start = 0
+	}
+	conn := b.redis.Get()
+	defer conn.Close()
+	entries, err := redis.ByteSlices(conn.Do("LRANGE", b.bufferKey, start, -1))
+	if err != nil {
+		return nil, fmt.Errorf("(LRANGE collection.buffer).%s", err)
+	}
+	documents := make([]collection.Document, 0, len(entries))
+	for _, entry := range entries {
+		doc, err := decodeRedisDocument(entry, b.keyring)
+		if err != nil {
+			b.logger.Warn("buffered document decode failed", "error", err)
+			continue
+		}
+		documents = append(documents, doc)
+	}
+	return documents, nil
 }
@@ -0,0 +1,73 @@
+package engine
+
+import (
+	"fmt"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// redisAdmitScript appends the ARGV[4] entries following it to the buffer list KEYS[1] if they fit within limits,
+// dropping the oldest documents first when ARGV[3] is 1. The body sizes of the entries follow them in ARGV.
+// KEYS[2] holds the body size of the buffer in bytes, KEYS[3] its checksum as redisEntryChecksum computes it,
+// KEYS[4] the body size of each entry. Entries buffered before sizes were kept count their stored size when dropped.
+var redisAdmitScript = redis.NewScript(4, `
+local maxDocuments = tonumber(ARGV[1])
+local maxBytes = tonumber(ARGV[2])
+local drop = ARGV[3] == "1"
+local incoming = tonumber(ARGV[4])
+local incomingBytes = 0
+local function checksum(entry)
+	return tonumber(string.sub(redis.sha1hex(entry), 1, 8), 16)
+end
+local sum = 0
+for i = 5, 4 + incoming do
+	incomingBytes = incomingBytes + tonumber(ARGV[i + incoming])
+	sum = sum + checksum(ARGV[i])
+end
+local documents = redis.call("LLEN", KEYS[1])
+local sized = redis.call("LLEN", KEYS[4])
+local bytes = tonumber(redis.call("GET", KEYS[2]) or "0")
+while (maxDocuments > 0 and documents + incoming > maxDocuments) or (maxBytes > 0 and bytes + incomingBytes > maxBytes) do
+	if not drop or documents == 0 then
+		return 0
+	end
+	local oldest = redis.call("LPOP", KEYS[1])
+	if sized < documents then
+		bytes = bytes - string.len(oldest)
+	else
+		bytes = bytes - tonumber(redis.call("LPOP", KEYS[4]))
+		sized = sized - 1
+	end
+	documents = documents - 1
+	redis.call("HINCRBY", KEYS[3], "documents", -1)
+	sum = sum - checksum(oldest)
+end
+for i = 5, 4 + incoming do
+	redis.call("RPUSH", KEYS[1], ARGV[i])
+	redis.call("RPUSH", KEYS[4], ARGV[i + incoming])
+end
+redis.call("SET", KEYS[2], bytes + incomingBytes)
+redis.call("HINCRBY", KEYS[3], "documents", incoming)
+redis.call("HINCRBY", KEYS[3], "sum", sum)
+return 1
+`)
+
+// admitRedis appends encoded documents within collection limits
+func (b *redisBuffer) admitRedis(entries redisEntries, drop bool) (bool, error) {
+	limits := b.collection().BufferLimits
+	dropFlag := 0
+	if drop {
+		dropFlag = 1
+	}
+	args := make([]interface{}, 0, 2*len(entries.encoded)+8)
+	args = append(args, b.bufferKey, b.bytesKey, b.checksumKey, b.sizesKey, limits.MaxDocuments, limits.MaxBytes, dropFlag, len(entries.encoded))
+	args = append(args, entries.encoded...)
+	args = append(args, entries.sizes...)
+	conn := b.redis.Get()
+	defer conn.Close()
+	admitted, err := redis.Int(redisAdmitScript.Do(conn, args...))
+	if err != nil {
+		return false, fmt.Errorf("(EVALSHA admit).%s", err)
+	}
+	return admitted == 1, nil
+}
@@ -0,0 +1,46 @@
+package engine
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/khezen/bulklog/pkg/clock"
+	"github.com/khezen/bulklog/pkg/config"
+)
+
+// redisTime reads the clock of redis
+func redisTime(red *redis.Pool) (time.Time, error) {
+	conn := red.Get()
+	defer conn.Close()
+	values, err := redis.Int64s(conn.Do("TIME"))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("TIME.%s", err)
+	}
+	if len(values) != 2 {
+		return time.Time{}, fmt.Errorf("TIME.unexpected reply of %d values", len(values))
+	}
+	return time.Unix(values[0], values[1]*int64(time.Microsecond)).UTC(), nil
+}
+
+// newRedisClock returns the time source of a redis buffer.
+// Instances using their local clock check it against redis on start, and warn if they drifted beyond tolerance.
+func newRedisClock(red *redis.Pool, redisCfg *config.Redis, tolerance time.Duration, logger *slog.Logger) clock.Clock {
+	remote := clock.NewRemote(func() (time.Time, error) {
+		return redisTime(red)
+	})
+	if redisCfg.Clock == config.RedisTimeClock {
+		return remote
+	}
+	if tolerance > 0 {
+		_, err := remote.Sync()
+		switch {
+		case err != nil:
+			logger.Error("clock skew check failed", "error", err)
+		case remote.Offset() > tolerance || remote.Offset() < -tolerance:
+			logger.Warn("clock skew beyond tolerance", "offset", remote.Offset(), "tolerance", tolerance)
+		}
+	}
+	return clock.Local
+}
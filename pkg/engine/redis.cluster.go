@@ -0,0 +1,487 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/khezen/bulklog/pkg/config"
+)
+
+var (
+	// ErrCrossSlot - a pipeline or a transaction targets keys of different slots
+	ErrCrossSlot = errors.New("ErrCrossSlot - commands sent together must target keys of a same slot")
+	// ErrNoClusterNode - none of the cluster nodes could be reached
+	ErrNoClusterNode = errors.New("ErrNoClusterNode - no redis cluster node is reachable")
+	// ErrUnexpectedReceive - Receive was called without a pending reply
+	ErrUnexpectedReceive = errors.New("ErrUnexpectedReceive - no reply is pending")
+	// ErrClosedConn - the connection was used after being closed
+	ErrClosedConn = errors.New("ErrClosedConn - redis cluster connection is closed")
+)
+
+// clusterSlots - number of hash slots of a redis cluster
+const clusterSlots = 16384
+
+// redisCluster maps the slots of a redis cluster to its nodes.
+// ref: https://redis.io/docs/reference/cluster-spec/
+type redisCluster struct {
+	redisCfg *config.Redis
+	sync.RWMutex
+	// nodes[slot] is the address of the node serving slot, empty until the slots are loaded
+	nodes []string
+}
+
+func newRedisCluster(redisCfg *config.Redis) *redisCluster {
+	return &redisCluster{
+		redisCfg: redisCfg,
+		nodes:    make([]string, clusterSlots),
+	}
+}
+
+func (c *redisCluster) conn() redis.Conn {
+	return &redisClusterConn{
+		cluster: c,
+		conns:   make(map[string]redis.Conn),
+	}
+}
+
+// node returns the address of the node serving slot, loading the slots if unknown
+func (c *redisCluster) node(slot int) (string, error) {
+	c.RLock()
+	addr := c.nodes[slot]
+	c.RUnlock()
+	if addr != "" {
+		return addr, nil
+	}
+	err := c.refresh()
+	if err != nil {
+		return "", err
+	}
+	c.RLock()
+	defer c.RUnlock()
+	if c.nodes[slot] == "" {
+		return "", ErrNoClusterNode
+	}
+	return c.nodes[slot], nil
+}
+
+// anyNode returns a node for commands without keys
+func (c *redisCluster) anyNode() (string, error) {
+	return c.node(0)
+}
+
+// refresh loads the slots from the first reachable node, seed nodes first
+func (c *redisCluster) refresh() error {
+	addrs := append([]string{}, c.redisCfg.Cluster.Addrs...)
+	c.RLock()
+	known := make(map[string]struct{})
+	for _, addr := range c.nodes {
+		if _, ok := known[addr]; !ok && addr != "" {
+			known[addr] = struct{}{}
+			addrs = append(addrs, addr)
+		}
+	}
+	c.RUnlock()
+	var lastErr error = ErrNoClusterNode
+	for _, addr := range addrs {
+		nodes, err := c.slots(addr)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		c.Lock()
+		c.nodes = nodes
+		c.Unlock()
+		return nil
+	}
+	return fmt.Errorf("refresh.%s", lastErr)
+}
+
+func (c *redisCluster) slots(addr string) ([]string, error) {
+	conn, err := c.dial(addr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	ranges, err := redis.Values(conn.Do("CLUSTER", "SLOTS"))
+	if err != nil {
+		return nil, err
+	}
+	host, _, _ := net.SplitHostPort(addr)
+	nodes := make([]string, clusterSlots)
+	for _, rangeI := range ranges {
+		// start, end, [master host, master port, ...], replicas...
+		slotRange, err := redis.Values(rangeI, nil)
+		if err != nil || len(slotRange) < 3 {
+			return nil, fmt.Errorf("(CLUSTER SLOTS).%s", redis.ErrNil)
+		}
+		start, err := redis.Int(slotRange[0], nil)
+		if err != nil {
+			return nil, err
+		}
+		end, err := redis.Int(slotRange[1], nil)
+		if err != nil {
+			return nil, err
+		}
+		master, err := redis.Values(slotRange[2], nil)
+		if err != nil || len(master) < 2 {
+			return nil, fmt.Errorf("(CLUSTER SLOTS).%s", redis.ErrNil)
+		}
+		masterHost, err := redis.String(master[0], nil)
+		if err != nil {
+			return nil, err
+		}
+		masterPort, err := redis.Int(master[1], nil)
+		if err != nil {
+			return nil, err
+		}
+		// an empty host is the one of the queried node
+		if masterHost == "" {
+			masterHost = host
+		}
+		masterAddr := net.JoinHostPort(masterHost, strconv.Itoa(masterPort))
+		for slot := start; slot <= end && slot < clusterSlots; slot++ {
+			nodes[slot] = masterAddr
+		}
+	}
+	return nodes, nil
+}
+
+func (c *redisCluster) dial(addr string) (redis.Conn, error) {
+	return dialRedis(addr, c.redisCfg)
+}
+
+// moved points slot to addr after a MOVED redirection, the other slots are reloaded in case several moved
+func (c *redisCluster) moved(slot int, addr string) {
+	c.Lock()
+	c.nodes[slot] = addr
+	c.Unlock()
+	go c.refresh()
+}
+
+// redisClusterConn routes commands to the node serving the slot of their first key.
+// Commands sent before a reply is received are pipelined to a same node, as are transactions,
+// so they must target keys of a same slot, which keys sharing a hash tag do.
+type redisClusterConn struct {
+	cluster *redisCluster
+	conns   map[string]redis.Conn
+	// bound is the node of the current pipeline or transaction
+	bound string
+	// queued commands wait for keyed command to tell which node they go to
+	queued  []clusterCommand
+	pending int
+	multi   bool
+	err     error
+}
+
+type clusterCommand struct {
+	name string
+	args []interface{}
+}
+
+func (c *redisClusterConn) Close() error {
+	var err error
+	for _, conn := range c.conns {
+		if closeErr := conn.Close(); closeErr != nil {
+			err = closeErr
+		}
+	}
+	c.conns = make(map[string]redis.Conn)
+	c.fail(ErrClosedConn)
+	return err
+}
+
+func (c *redisClusterConn) Err() error {
+	if c.err != nil {
+		return c.err
+	}
+	for _, conn := range c.conns {
+		if err := conn.Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *redisClusterConn) Send(commandName string, args ...interface{}) error {
+	err := c.bind(commandName, args)
+	if err != nil {
+		return err
+	}
+	c.queued = append(c.queued, clusterCommand{commandName, args})
+	return nil
+}
+
+func (c *redisClusterConn) Flush() error {
+	if len(c.queued) == 0 {
+		if c.bound == "" {
+			return nil
+		}
+		conn, err := c.node(c.bound)
+		if err != nil {
+			return err
+		}
+		return conn.Flush()
+	}
+	if c.bound == "" {
+		addr, err := c.cluster.anyNode()
+		if err != nil {
+			return c.fail(err)
+		}
+		c.bound = addr
+	}
+	conn, err := c.node(c.bound)
+	if err != nil {
+		return err
+	}
+	for _, cmd := range c.queued {
+		c.track(cmd.name)
+		err = conn.Send(cmd.name, cmd.args...)
+		if err != nil {
+			return c.fail(err)
+		}
+		c.pending++
+	}
+	c.queued = c.queued[:0]
+	err = conn.Flush()
+	if err != nil {
+		return c.fail(err)
+	}
+	return nil
+}
+
+func (c *redisClusterConn) Receive() (interface{}, error) {
+	if len(c.queued) > 0 {
+		err := c.Flush()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if c.pending == 0 || c.bound == "" {
+		return nil, ErrUnexpectedReceive
+	}
+	conn, err := c.node(c.bound)
+	if err != nil {
+		return nil, err
+	}
+	reply, err := conn.Receive()
+	c.pending--
+	c.redirected(err)
+	c.release()
+	return reply, err
+}
+
+// Do sends the command then returns its reply, discarding the ones of the commands sent before it.
+// Standalone commands follow MOVED and ASK redirections.
+func (c *redisClusterConn) Do(commandName string, args ...interface{}) (interface{}, error) {
+	standalone := len(c.queued) == 0 && c.pending == 0 && !c.multi
+	if commandName != "" {
+		err := c.Send(commandName, args...)
+		if err != nil {
+			return nil, err
+		}
+	}
+	err := c.Flush()
+	if err != nil {
+		return nil, err
+	}
+	var reply interface{}
+	for c.pending > 0 {
+		reply, err = c.Receive()
+		if _, ok := err.(redis.Error); err != nil && !ok {
+			return nil, err
+		}
+	}
+	if !standalone || commandName == "" {
+		return reply, err
+	}
+	redisErr, ok := err.(redis.Error)
+	if !ok {
+		return reply, err
+	}
+	fields := strings.Fields(string(redisErr))
+	if len(fields) != 3 || (fields[0] != "MOVED" && fields[0] != "ASK") {
+		return reply, err
+	}
+	conn, dialErr := c.node(fields[2])
+	if dialErr != nil {
+		return nil, dialErr
+	}
+	if fields[0] == "ASK" {
+		// the slot is migrating, only this command is asked to the importing node
+		_, askErr := conn.Do("ASKING")
+		if askErr != nil {
+			return nil, askErr
+		}
+	}
+	return conn.Do(commandName, args...)
+}
+
+// bind pins the node of the current pipeline or transaction from its first keyed command
+func (c *redisClusterConn) bind(commandName string, args []interface{}) error {
+	key, ok := commandKey(commandName, args)
+	if !ok {
+		return nil
+	}
+	addr, err := c.cluster.node(keySlot(key))
+	if err != nil {
+		return c.fail(err)
+	}
+	if c.bound == "" {
+		c.bound = addr
+		return nil
+	}
+	if c.bound != addr {
+		return ErrCrossSlot
+	}
+	return nil
+}
+
+// release unbinds the node once nothing is left pending, so the next commands are routed on their own
+func (c *redisClusterConn) release() {
+	if c.pending == 0 && len(c.queued) == 0 && !c.multi {
+		c.bound = ""
+	}
+}
+
+func (c *redisClusterConn) track(commandName string) {
+	switch strings.ToUpper(commandName) {
+	case "MULTI":
+		c.multi = true
+	case "EXEC", "DISCARD":
+		c.multi = false
+	}
+}
+
+// redirected updates the slots when a node answers that a key moved
+func (c *redisClusterConn) redirected(err error) {
+	redisErr, ok := err.(redis.Error)
+	if !ok {
+		return
+	}
+	fields := strings.Fields(string(redisErr))
+	if len(fields) != 3 || fields[0] != "MOVED" {
+		return
+	}
+	slot, convErr := strconv.Atoi(fields[1])
+	if convErr != nil || slot < 0 || slot >= clusterSlots {
+		return
+	}
+	c.cluster.moved(slot, fields[2])
+}
+
+// node returns the connection to addr, dialing it the first time
+func (c *redisClusterConn) node(addr string) (redis.Conn, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+	if conn, ok := c.conns[addr]; ok {
+		return conn, nil
+	}
+	conn, err := c.cluster.dial(addr)
+	if err != nil {
+		return nil, c.fail(err)
+	}
+	c.conns[addr] = conn
+	return conn, nil
+}
+
+// fail breaks the connection, pipelined replies cannot be matched to their commands anymore
+func (c *redisClusterConn) fail(err error) error {
+	if c.err == nil {
+		c.err = err
+	}
+	return err
+}
+
+// commandKey returns the key a command is routed by.
+// SCAN is routed by the hash tag of its MATCH pattern, so pipes of a collection are scanned on their node.
+func commandKey(commandName string, args []interface{}) (string, bool) {
+	switch strings.ToUpper(commandName) {
+	case "PING", "MULTI", "EXEC", "DISCARD", "AUTH", "SELECT", "INFO", "ROLE", "ASKING", "CLUSTER", "SCRIPT":
+		return "", false
+	case "SCAN":
+		for i := 1; i+1 < len(args); i++ {
+			if strings.ToUpper(argString(args[i])) == "MATCH" {
+				pattern := argString(args[i+1])
+				if hashTag(pattern) != pattern {
+					return pattern, true
+				}
+			}
+		}
+		return "", false
+	case "XREADGROUP", "XREAD":
+		for i := 0; i+1 < len(args); i++ {
+			if strings.ToUpper(argString(args[i])) == "STREAMS" {
+				return argString(args[i+1]), true
+			}
+		}
+		return "", false
+	case "XGROUP", "XINFO":
+		if len(args) < 2 {
+			return "", false
+		}
+		return argString(args[1]), true
+	case "EVAL", "EVALSHA":
+		if len(args) < 3 {
+			return "", false
+		}
+		if numKeys, err := strconv.Atoi(argString(args[1])); err != nil || numKeys == 0 {
+			return "", false
+		}
+		return argString(args[2]), true
+	default:
+		if len(args) == 0 {
+			return "", false
+		}
+		return argString(args[0]), true
+	}
+}
+
+func argString(arg interface{}) string {
+	switch arg := arg.(type) {
+	case string:
+		return arg
+	case []byte:
+		return string(arg)
+	default:
+		return fmt.Sprint(arg)
+	}
+}
+
+// hashTag returns the part of key between the first { and the next }, or key if there is none
+func hashTag(key string) string {
+	start := strings.IndexByte(key, '{')
+	if start < 0 {
+		return key
+	}
+	end := strings.IndexByte(key[start+1:], '}')
+	if end <= 0 {
+		return key
+	}
+	return key[start+1 : start+1+end]
+}
+
+func keySlot(key string) int {
+	return int(crc16([]byte(hashTag(key))) % clusterSlots)
+}
+
+// crc16 - CRC16-CCITT (XMODEM) used by redis cluster to hash keys
+func crc16(data []byte) uint16 {
+	var crc uint16
+	for _, b := range data {
+		crc ^= uint16(b) << 8
+		for i := 0; i < 8; i++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
@@ -0,0 +1,129 @@
+package engine
+
+import (
+	"fmt"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/google/uuid"
+)
+
+const (
+	// redisLeaseTTL - how long a lease outlives its holder, before another instance takes over
+	redisLeaseTTL = 15 * time.Second
+	// redisLeaseRenewPeriod - how often the holder renews its lease, and others try to take it over
+	redisLeaseRenewPeriod = redisLeaseTTL / 3
+)
+
+// redisLeaseScript renews the lease KEYS[1] for ARGV[2] milliseconds if its token is ARGV[1], or acquires it if it is free.
+// It returns 1 if the lease is held by ARGV[1].
+var redisLeaseScript = redis.NewScript(1, `
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	redis.call("PEXPIRE", KEYS[1], ARGV[2])
+	return 1
+end
+if redis.call("SET", KEYS[1], ARGV[1], "NX", "PX", ARGV[2]) then
+	return 1
+end
+return 0
+`)
+
+// redisReleaseLeaseScript deletes the lease KEYS[1] if its token is ARGV[1]
+var redisReleaseLeaseScript = redis.NewScript(1, `
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// redisLease elects one instance among the ones sharing a redis, it holds the lease as long as it renews it.
+// If the holder dies, the lease expires and another instance takes it over on its next renewal.
+type redisLease struct {
+	redis     *redis.Pool
+	key       string
+	token     string
+	logger    *slog.Logger
+	held      atomic.Bool
+	stop      chan struct{}
+	stopOnce  sync.Once
+	renewing  sync.WaitGroup
+	onAcquire func()
+}
+
+// newRedisLease tries to acquire the lease once then keeps renewing it in the background until closed.
+// onAcquire is called each time this instance becomes the holder.
+func newRedisLease(red *redis.Pool, key string, logger *slog.Logger, onAcquire func()) *redisLease {
+	lease := &redisLease{
+		redis:     red,
+		key:       key,
+		token:     uuid.New().String(),
+		logger:    logger,
+		stop:      make(chan struct{}),
+		onAcquire: onAcquire,
+	}
+	lease.renew()
+	lease.renewing.Add(1)
+	go lease.renewer()
+	return lease
+}
+
+// Held tells whether this instance holds the lease.
+// It may have expired unnoticed for up to redisLeaseRenewPeriod if redis became unreachable.
+func (l *redisLease) Held() bool {
+	return l.held.Load()
+}
+
+func (l *redisLease) renewer() {
+	defer l.renewing.Done()
+	ticker := time.NewTicker(redisLeaseRenewPeriod)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+			l.renew()
+		}
+	}
+}
+
+func (l *redisLease) renew() {
+	conn := l.redis.Get()
+	held, err := redis.Bool(redisLeaseScript.Do(conn, l.key, l.token, int64(redisLeaseTTL/time.Millisecond)))
+	conn.Close()
+	if err != nil {
+		l.logger.Error("lease renewal failed", "error", err)
+		held = false
+	}
+	if l.held.Swap(held) != held {
+		if held {
+			l.logger.Info("lease acquired")
+			if l.onAcquire != nil {
+				go l.onAcquire()
+			}
+		} else {
+			l.logger.Info("lease lost")
+		}
+	}
+}
+
+// Close stops renewing the lease and releases it, so another instance takes it over right away
+func (l *redisLease) Close() error {
+	l.stopOnce.Do(func() {
+		close(l.stop)
+	})
+	l.renewing.Wait()
+	if !l.held.Swap(false) {
+		return nil
+	}
+	conn := l.redis.Get()
+	defer conn.Close()
+	_, err := redisReleaseLeaseScript.Do(conn, l.key, l.token)
+	if err != nil {
+		return fmt.Errorf("(EVALSHA release).%s", err)
+	}
+	return nil
+}
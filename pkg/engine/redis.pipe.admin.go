@@ -0,0 +1,400 @@
+package engine
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/khezen/bulklog/pkg/collection"
+)
+
+// Pipes lists pipes pending in redis, whichever instance conveys them
+func (b *redisBuffer) Pipes() ([]Pipe, error) {
+	pipes, err := b.streamPipes()
+	if err != nil {
+		return nil, fmt.Errorf("streamPipes.%s", err)
+	}
+	pipeKeys, err := scanRedisPipes(b.redis, b.pipeKeyPrefix)
+	if err != nil {
+		return nil, fmt.Errorf("scanRedisPipes.%s", err)
+	}
+	for _, pipeKey := range pipeKeys {
+		pipe, err := getRedisPipeState(b.redis, pipeKey)
+		if err == errRedisPipeNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("getRedisPipeState.%s", err)
+		}
+		pipe.ID = strings.TrimPrefix(pipeKey, b.pipeKeyPrefix+".")
+		pipes = append(pipes, pipe)
+	}
+	sortPipes(pipes)
+	return pipes, nil
+}
+
+// RetryPipe resets the retry schedule of a pipe so its outputs are retried now.
+// Outputs conveyed by other instances are retried once their current wait ends,
+// or claimed on the next poll of any instance for pipes flushed to the stream.
+func (b *redisBuffer) RetryPipe(id string) error {
+	pipe, exists, err := findRedisStreamPipe(b.redis, b.streamKey, id)
+	if err != nil {
+		return fmt.Errorf("findRedisStreamPipe.%s", err)
+	}
+	if exists {
+		return b.retryStreamPipe(pipe)
+	}
+	pipeKey := fmt.Sprintf("%s.%s", b.pipeKeyPrefix, id)
+	exists, err = redisPipeExists(b.redis, pipeKey)
+	if err != nil {
+		return fmt.Errorf("redisPipeExists.%s", err)
+	}
+	if !exists {
+		return ErrPipeNotFound
+	}
+	conn := b.redis.Get()
+	_, err = conn.Do("DEL", fmt.Sprintf("%s.nextRetryAt", pipeKey))
+	conn.Close()
+	if err != nil {
+		return fmt.Errorf("(DEL pipeKey.nextRetryAt).%s", err)
+	}
+	if pipe := b.pipes.get(pipeKey); pipe != nil {
+		pipe.retry()
+	}
+	return nil
+}
+
+// DiscardPipe deletes a pipe; instances conveying it give up before their next try
+func (b *redisBuffer) DiscardPipe(id string) error {
+	pipeKey := fmt.Sprintf("%s.%s", b.pipeKeyPrefix, id)
+	pipe, exists, err := findRedisStreamPipe(b.redis, b.streamKey, id)
+	if err != nil {
+		return fmt.Errorf("findRedisStreamPipe.%s", err)
+	}
+	if exists {
+		outputs := b.outputs()
+		for outputName := range outputs {
+			if state := b.pipes.get(redisStreamStateKey(pipe.entryID, outputName)); state != nil {
+				state.discard()
+			}
+		}
+		err = deleteRedisStreamPipe(b.redis, b.streamKey, pipeKey, pipe.entryID, outputs)
+		if err != nil {
+			return fmt.Errorf("deleteRedisStreamPipe.%s", err)
+		}
+		return nil
+	}
+	exists, err = redisPipeExists(b.redis, pipeKey)
+	if err != nil {
+		return fmt.Errorf("redisPipeExists.%s", err)
+	}
+	if !exists {
+		return ErrPipeNotFound
+	}
+	if pipe := b.pipes.get(pipeKey); pipe != nil {
+		pipe.discard()
+	}
+	err = deleteRedisPipe(b.redis, pipeKey)
+	if err != nil {
+		return fmt.Errorf("deleteRedisPipe.%s", err)
+	}
+	return nil
+}
+
+// PipeDocuments reads a page of the documents of a pipe, flushed to the stream or not
+func (b *redisBuffer) PipeDocuments(id string, offset, limit int) ([]collection.Document, int, error) {
+	pipeKey := fmt.Sprintf("%s.%s", b.pipeKeyPrefix, id)
+	_, exists, err := findRedisStreamPipe(b.redis, b.streamKey, id)
+	if err != nil {
+		return nil, 0, fmt.Errorf("findRedisStreamPipe.%s", err)
+	}
+	if !exists {
+		exists, err = redisPipeExists(b.redis, pipeKey)
+		if err != nil {
+			return nil, 0, fmt.Errorf("redisPipeExists.%s", err)
+		}
+	}
+	if !exists {
+		return nil, 0, ErrPipeNotFound
+	}
+	documents, total, err := getRedisPipeDocumentsRange(b.redis, b.keyring, pipeKey, offset, limit)
+	if err != nil {
+		return nil, 0, fmt.Errorf("getRedisPipeDocumentsRange.%s", err)
+	}
+	return documents, total, nil
+}
+
+// RestorePipe writes a pipe as pipes flushed by earlier versions were, hash and lists,
+// so that it is pending for some outputs only, and conveys it; the lease holder resumes it if this instance stops.
+func (b *redisBuffer) RestorePipe(id string, createdAt time.Time, outputNames []string, documents []collection.Document) (bool, error) {
+	_, exists, err := findRedisStreamPipe(b.redis, b.streamKey, id)
+	if err != nil {
+		return false, fmt.Errorf("findRedisStreamPipe.%s", err)
+	}
+	if exists {
+		return false, nil
+	}
+	var (
+		encoded  = make([]interface{}, 0, len(documents))
+		checksum pipeChecksum
+	)
+	for i := range documents {
+		entry, err := encodeRedisDocument(&documents[i], b.collection().Serialization.Storage, b.compression, b.keyring)
+		if err != nil {
+			return false, fmt.Errorf("encodeRedisDocument.%s", err)
+		}
+		encoded = append(encoded, entry)
+		checksum.add(redisEntryChecksum([]byte(entry)))
+	}
+	var (
+		collec  = b.collection()
+		pipeKey = fmt.Sprintf("%s.%s", b.pipeKeyPrefix, id)
+		fields  = append(redisStreamPipeFields(id, collec.Backoff, collec.RetentionPeriod, createdAt.UTC(), ""), "checksum", checksum.String())
+	)
+	created, err := createRedisPipe(b.redis, pipeKey, fields, encoded, outputNames)
+	if err != nil {
+		return false, fmt.Errorf("createRedisPipe.%s", err)
+	}
+	if !created {
+		return false, nil
+	}
+	b.conveying.Add(1)
+	go func() {
+		redisConvey(collection.WithPriority(b.ctx, collec.Priority), b.redis, b.keyring, pipeKey, b.outputs(), collec.Name, b.deadLetters, b.expiry, &b.pipes, &b.integrity, b.logger.With("pipe", pipeKey))
+		b.conveying.Done()
+	}()
+	return true, nil
+}
+
+func scanRedisPipes(red *redis.Pool, pipeKeyPrefix string) ([]string, error) {
+	var (
+		pattern  = fmt.Sprintf(`%s.????????-????-????-????-????????????`, pipeKeyPrefix)
+		pipeKeys = make([]string, 0)
+		cursor   = 0
+	)
+	conn := red.Get()
+	defer conn.Close()
+	for {
+		values, err := redis.Values(conn.Do("SCAN", cursor, "MATCH", pattern))
+		if err != nil {
+			return nil, fmt.Errorf("SCAN.%s", err)
+		}
+		cursor, err = redis.Int(values[0], nil)
+		if err != nil {
+			return nil, fmt.Errorf("(SCAN cursor).%s", err)
+		}
+		keys, err := redis.Strings(values[1], nil)
+		if err != nil {
+			return nil, fmt.Errorf("(SCAN keys).%s", err)
+		}
+		pipeKeys = append(pipeKeys, keys...)
+		if cursor == 0 {
+			return pipeKeys, nil
+		}
+	}
+}
+
+// getRedisPipeState reads a pipe creation time, size and retry state of its remaining outputs
+func getRedisPipeState(red *redis.Pool, pipeKey string) (pipe Pipe, err error) {
+	var retentionPeriod time.Duration
+	pipe.CreatedAt, _, retentionPeriod, err = getRedisPipe(red, pipeKey)
+	if err != nil {
+		return pipe, err
+	}
+	pipe.ExpiresAt = pipe.CreatedAt.Add(retentionPeriod)
+	conn := red.Get()
+	defer conn.Close()
+	err = conn.Send("MULTI")
+	if err != nil {
+		return pipe, fmt.Errorf("MULTI.%s", err)
+	}
+	for _, cmd := range [][]interface{}{
+		{"LLEN", fmt.Sprintf("%s.buffer", pipeKey)},
+		{"LRANGE", fmt.Sprintf("%s.outputs", pipeKey), 0, -1},
+		{"HGETALL", fmt.Sprintf("%s.iterations", pipeKey)},
+		{"HGETALL", fmt.Sprintf("%s.nextRetryAt", pipeKey)},
+		{"HGETALL", fmt.Sprintf("%s.attempts", pipeKey)},
+	} {
+		err = conn.Send(cmd[0].(string), cmd[1:]...)
+		if err != nil {
+			return pipe, fmt.Errorf("(%s %s).%s", cmd[0], cmd[1], err)
+		}
+	}
+	results, err := redis.Values(conn.Do("EXEC"))
+	if err != nil {
+		return pipe, fmt.Errorf("EXEC.%s", err)
+	}
+	pipe.Documents, err = redis.Int(results[0], nil)
+	if err != nil {
+		return pipe, fmt.Errorf("(LLEN pipeKey.buffer).%s", err)
+	}
+	outputNames, err := redis.Strings(results[1], nil)
+	if err != nil {
+		return pipe, fmt.Errorf("(LRANGE pipeKey.outputs).%s", err)
+	}
+	iterations, err := redis.StringMap(results[2], nil)
+	if err != nil {
+		return pipe, fmt.Errorf("(HGETALL pipeKey.iterations).%s", err)
+	}
+	nextRetries, err := redis.StringMap(results[3], nil)
+	if err != nil {
+		return pipe, fmt.Errorf("(HGETALL pipeKey.nextRetryAt).%s", err)
+	}
+	attempts, err := parseRedisPipeAttempts(results[4], nil)
+	if err != nil {
+		return pipe, fmt.Errorf("parseRedisPipeAttempts.%s", err)
+	}
+	pipe.Outputs = make([]PipeOutput, 0, len(outputNames))
+	for _, outputName := range outputNames {
+		pipeOutput := PipeOutput{Name: outputName}
+		pipeOutput.Iteration, _ = strconv.Atoi(iterations[outputName])
+		if nextRetryAt, err := time.Parse(time.RFC3339Nano, nextRetries[outputName]); err == nil {
+			pipeOutput.NextRetryAt = &nextRetryAt
+		}
+		pipeOutput.Attempts = attempts[outputName]
+		pipe.Outputs = append(pipe.Outputs, pipeOutput)
+	}
+	return pipe, nil
+}
+
+// streamPipes lists the pipes of the stream with the outputs which did not acknowledge them yet
+func (b *redisBuffer) streamPipes() ([]Pipe, error) {
+	streamPipes, err := listRedisStreamPipes(b.redis, b.streamKey)
+	if err != nil {
+		return nil, fmt.Errorf("listRedisStreamPipes.%s", err)
+	}
+	pipes := make([]Pipe, 0, len(streamPipes))
+	if len(streamPipes) == 0 {
+		return pipes, nil
+	}
+	lastDelivered, err := redisStreamGroups(b.redis, b.streamKey)
+	if err != nil {
+		return nil, fmt.Errorf("redisStreamGroups.%s", err)
+	}
+	outputNames := make([]string, 0, len(lastDelivered))
+	pending := make(map[string]map[string]redisStreamPending, len(lastDelivered))
+	for outputName := range b.outputs() {
+		if _, ok := lastDelivered[outputName]; !ok {
+			continue
+		}
+		entries, err := pendingRedisStreamPipes(b.redis, b.streamKey, outputName, "-", "+")
+		if err != nil {
+			return nil, fmt.Errorf("pendingRedisStreamPipes.%s", err)
+		}
+		pending[outputName] = make(map[string]redisStreamPending, len(entries))
+		for _, entry := range entries {
+			pending[outputName][entry.entryID] = entry
+		}
+		outputNames = append(outputNames, outputName)
+	}
+	sort.Strings(outputNames)
+	conn := b.redis.Get()
+	defer conn.Close()
+	for _, streamPipe := range streamPipes {
+		pipeKey := fmt.Sprintf("%s.%s", b.pipeKeyPrefix, streamPipe.id)
+		documents, err := redis.Int(conn.Do("LLEN", fmt.Sprintf("%s.buffer", pipeKey)))
+		if err != nil {
+			return nil, fmt.Errorf("(LLEN pipeKey.buffer).%s", err)
+		}
+		attempts, err := parseRedisPipeAttempts(conn.Do("HGETALL", fmt.Sprintf("%s.attempts", pipeKey)))
+		if err != nil {
+			return nil, fmt.Errorf("parseRedisPipeAttempts.%s", err)
+		}
+		pipe := Pipe{
+			ID:        streamPipe.id,
+			CreatedAt: streamPipe.startedAt,
+			ExpiresAt: streamPipe.expiresAt(),
+			Documents: documents,
+			Outputs:   make([]PipeOutput, 0, len(outputNames)),
+		}
+		for _, outputName := range outputNames {
+			entry, isPending := pending[outputName][streamPipe.entryID]
+			switch {
+			case isPending:
+				nextRetryAt := time.Now().UTC().Add(b.claimIdle(streamPipe, entry, outputName) - entry.idle)
+				pipe.Outputs = append(pipe.Outputs, PipeOutput{Name: outputName, Iteration: entry.deliveries, NextRetryAt: &nextRetryAt, Attempts: attempts[outputName]})
+			case redisStreamIDBefore(lastDelivered[outputName], streamPipe.entryID):
+				// not delivered to any instance yet
+				pipe.Outputs = append(pipe.Outputs, PipeOutput{Name: outputName})
+			}
+		}
+		pipes = append(pipes, pipe)
+	}
+	return pipes, nil
+}
+
+// consumerStreamPipes lists the pipes of the stream pending for this consumer, those a previous run of the instance left unacknowledged as it starts
+func (b *redisBuffer) consumerStreamPipes() ([]Pipe, error) {
+	entryIDs := make(map[string]struct{})
+	for outputName := range b.outputs() {
+		entries, err := pendingRedisStreamPipes(b.redis, b.streamKey, outputName, "-", "+")
+		if err != nil {
+			return nil, fmt.Errorf("pendingRedisStreamPipes.%s", err)
+		}
+		for _, entry := range entries {
+			if entry.consumer == b.consumer {
+				entryIDs[entry.entryID] = struct{}{}
+			}
+		}
+	}
+	pipes := make([]Pipe, 0, len(entryIDs))
+	if len(entryIDs) == 0 {
+		return pipes, nil
+	}
+	streamPipes, err := listRedisStreamPipes(b.redis, b.streamKey)
+	if err != nil {
+		return nil, fmt.Errorf("listRedisStreamPipes.%s", err)
+	}
+	conn := b.redis.Get()
+	defer conn.Close()
+	for _, streamPipe := range streamPipes {
+		if _, ok := entryIDs[streamPipe.entryID]; !ok {
+			continue
+		}
+		documents, err := redis.Int(conn.Do("LLEN", fmt.Sprintf("%s.%s.buffer", b.pipeKeyPrefix, streamPipe.id)))
+		if err != nil {
+			return nil, fmt.Errorf("(LLEN pipeKey.buffer).%s", err)
+		}
+		pipes = append(pipes, Pipe{
+			ID:        streamPipe.id,
+			CreatedAt: streamPipe.startedAt,
+			ExpiresAt: streamPipe.expiresAt(),
+			Documents: documents,
+		})
+	}
+	return pipes, nil
+}
+
+// retryStreamPipe makes the outputs pending for a pipe claimable right away, and wakes the ones this process conveys
+func (b *redisBuffer) retryStreamPipe(pipe redisStreamPipe) error {
+	for outputName := range b.outputs() {
+		entries, err := pendingRedisStreamPipes(b.redis, b.streamKey, outputName, pipe.entryID, pipe.entryID)
+		if err != nil {
+			return fmt.Errorf("pendingRedisStreamPipes.%s", err)
+		}
+		for _, entry := range entries {
+			// idle enough for the try which is woken to claim it, including a retry its output asked for
+			idle := b.claimIdle(pipe, entry, outputName)
+			if idle < redisStreamClaimAfter {
+				idle = redisStreamClaimAfter
+			}
+			err = rewindRedisStreamPipe(b.redis, b.streamKey, outputName, entry, idle)
+			if err != nil {
+				return fmt.Errorf("rewindRedisStreamPipe.%s", err)
+			}
+		}
+		conn := b.redis.Get()
+		_, err = conn.Do("HDEL", fmt.Sprintf("%s.%s.nextRetryAt", b.pipeKeyPrefix, pipe.id), outputName)
+		conn.Close()
+		if err != nil {
+			return fmt.Errorf("(HDEL pipeKey.nextRetryAt outputName).%s", err)
+		}
+		if state := b.pipes.get(redisStreamStateKey(pipe.entryID, outputName)); state != nil {
+			state.retry()
+		}
+	}
+	return nil
+}
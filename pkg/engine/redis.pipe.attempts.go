@@ -0,0 +1,64 @@
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// Failed tries are recorded per output in the hash {pipeKey}.attempts keyed by output name,
+// valued by the JSON array of the latest maxPipeAttempts tries. A single instance conveys an output of a pipe at once.
+
+func addRedisPipeAttempt(red *redis.Pool, pipeKey, outputName string, triedAt time.Time, tryErr error) error {
+	conn := red.Get()
+	defer conn.Close()
+	attemptsKey := fmt.Sprintf("%s.attempts", pipeKey)
+	var attempts []PipeAttempt
+	attemptsBytes, err := redis.Bytes(conn.Do("HGET", attemptsKey, outputName))
+	if err != nil && err != redis.ErrNil {
+		return fmt.Errorf("(HGET pipeKey.attempts outputName).%s", err)
+	}
+	if err == nil {
+		err = json.Unmarshal(attemptsBytes, &attempts)
+		if err != nil {
+			return fmt.Errorf("json.Unmarshal.%s", err)
+		}
+	}
+	attemptsBytes, err = json.Marshal(appendAttempt(attempts, triedAt, tryErr))
+	if err != nil {
+		return fmt.Errorf("json.Marshal.%s", err)
+	}
+	_, err = conn.Do("HSET", attemptsKey, outputName, attemptsBytes)
+	if err != nil {
+		return fmt.Errorf("(HSET pipeKey.attempts outputName).%s", err)
+	}
+	return nil
+}
+
+// parseRedisPipeAttempts parses the failed tries of each output replied by HGETALL {pipeKey}.attempts
+func parseRedisPipeAttempts(reply interface{}, err error) (map[string][]PipeAttempt, error) {
+	fields, err := redis.StringMap(reply, err)
+	if err != nil {
+		return nil, fmt.Errorf("(HGETALL pipeKey.attempts).%s", err)
+	}
+	attempts := make(map[string][]PipeAttempt, len(fields))
+	for outputName, attemptsStr := range fields {
+		var outputAttempts []PipeAttempt
+		err = json.Unmarshal([]byte(attemptsStr), &outputAttempts)
+		if err != nil {
+			return nil, fmt.Errorf("json.Unmarshal.%s", err)
+		}
+		attempts[outputName] = outputAttempts
+	}
+	return attempts, nil
+}
+
+func deleteRedisPipeAttempts(conn redis.Conn, pipeKey string) (err error) {
+	err = conn.Send("DEL", fmt.Sprintf("%s.attempts", pipeKey))
+	if err != nil {
+		return fmt.Errorf("(DEL pipeKey.attempts).%s", err)
+	}
+	return nil
+}
@@ -37,21 +37,6 @@ func getRedisPipeoutputs(red *redis.Pool, pipeKey string, outputs map[string]out
 	return remainingoutputs, nil
 }
 
-func addRedisPipeoutputs(conn redis.Conn, pipeKey string, outputs map[string]output.Interface) (err error) {
-	key := fmt.Sprintf("%s.outputs", pipeKey)
-	args := make([]interface{}, 0, len(outputs)+1)
-	args = append(args, key)
-	var outputName string
-	for outputName = range outputs {
-		args = append(args, outputName)
-	}
-	err = conn.Send("RPUSH", args...)
-	if err != nil {
-		return fmt.Errorf("(RPUSH pipeKey.outputs outputNames...).%s", err)
-	}
-	return
-}
-
 func deleteRedisPipeoutput(red *redis.Pool, pipeKey, outputName string) (err error) {
 	conn := red.Get()
 	defer conn.Close()
@@ -1,149 +1,228 @@
 package engine
 
 import (
+	"context"
 	"fmt"
-	"math"
+	"log/slog"
 	"strconv"
 	"sync"
 	"time"
 
 	"github.com/gomodule/redigo/redis"
-	"github.com/khezen/bulklog/pkg/log"
+	"github.com/khezen/bulklog/pkg/collection"
+	"github.com/khezen/bulklog/pkg/encryption"
 	"github.com/khezen/bulklog/pkg/output"
+	"github.com/khezen/bulklog/pkg/trace"
 )
 
-func redisConvey(red *redis.Pool, pipeKey string, outputs map[string]output.Interface) {
-	startedAt, retryPeriod, retentionPeriod, err := getRedisPipe(red, pipeKey)
+func redisConvey(ctx context.Context, red *redis.Pool, keyring *encryption.Keyring, pipeKey string, outputs map[string]output.Interface, collectionName collection.Name, deadLetters DeadLetters, expiry *ExpiryNotifier, pipes *pipeRegistry, checks *integrity, logger *slog.Logger) {
+	// already conveyed by this process
+	if pipes.get(pipeKey) != nil {
+		return
+	}
+	startedAt, backoff, retentionPeriod, err := getRedisPipe(red, pipeKey)
 	if err == errRedisPipeNotFound {
 		err = deleteRedisPipe(red, pipeKey)
 		if err != nil {
-			log.Err().Printf("deleteRedisPipe.%s)\n", err)
+			logger.Error("pipe delete failed", "error", err)
 		}
 		return
 	}
 	if err != nil {
-		log.Err().Printf("getRedisPipe.%s)\n", err)
+		logger.Error("pipe read failed", "error", err)
 		return
 	}
 	presetRedisConvey(
-		red, pipeKey,
+		ctx,
+		red, keyring, pipeKey,
 		outputs,
+		collectionName,
 		startedAt,
-		retryPeriod, retentionPeriod,
+		backoff, retentionPeriod,
+		deadLetters,
+		expiry,
+		pipes,
+		checks,
+		logger,
 	)
 }
 
+// presetRedisConvey conveys a pipe to its remaining outputs, each of them on its own retry schedule.
+// ctx carries the span which created the pipe, none for pipes left by a previous run.
+// Pipes whose conveyance is cancelled are left in redis for the next start.
 func presetRedisConvey(
-	red *redis.Pool, pipeKey string,
+	ctx context.Context,
+	red *redis.Pool, keyring *encryption.Keyring, pipeKey string,
 	outputs map[string]output.Interface,
+	collectionName collection.Name,
 	startedAt time.Time,
-	retryPeriod, retentionPeriod time.Duration) {
-	var (
-		dieAt               = startedAt.Add(retentionPeriod)
-		dieAtUnixNano       = dieAt.UnixNano()
-		currentTimeUnixNano = time.Now().UTC().UnixNano()
-		err                 error
-	)
-	if currentTimeUnixNano > dieAtUnixNano {
-		err = deleteRedisPipe(red, pipeKey)
-		if err != nil {
-			log.Err().Printf("deleteRedisPipe.%s)\n", err)
-		} else {
-			return
-		}
+	backoff collection.Backoff,
+	retentionPeriod time.Duration,
+	deadLetters DeadLetters,
+	expiry *ExpiryNotifier,
+	pipes *pipeRegistry,
+	checks *integrity,
+	logger *slog.Logger) {
+	dieAt := startedAt.Add(retentionPeriod)
+	stored, err := getRedisPipeDocuments(red, keyring, pipeKey)
+	if err != nil {
+		logger.Error("pipe documents read failed", "error", err)
+		return
 	}
-	documents, err := getRedisPipeDocuments(red, pipeKey)
+	remainingoutputs, err := getRedisPipeoutputs(red, pipeKey, outputs)
 	if err != nil {
-		log.Err().Printf("getRedisPipeDocuments.%s)\n", err)
+		logger.Error("pipe outputs read failed", "error", err)
 		return
 	}
+	checksum, err := getRedisPipeChecksum(red, pipeKey)
+	if err != nil {
+		logger.Error("pipe checksum read failed", "error", err)
+	}
+	checks.verify(stored, checksum, deadLetters, collectionName, startedAt, outputNames(remainingoutputs), logger)
+	documents := stored.documents
 	if len(documents) == 0 {
 		err = deleteRedisPipe(red, pipeKey)
 		if err != nil {
-			log.Err().Printf("deleteRedisPipe.%s)\n", err)
+			logger.Error("pipe delete failed", "error", err)
 		}
 		return
 	}
 	var (
-		remainingoutputs  map[string]output.Interface
-		nextTryAtUnixNano int64
-		iteration         int
-		latestTryAt       time.Time
-		waitFor           time.Duration
-		timer             *time.Timer
-		wg                sync.WaitGroup
+		failures = make(map[string]error)
+		pending  = make(map[string][]collection.Document)
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		pipe     = pipes.track(pipeKey)
+		span     = startConveySpan(trace.FromContext(ctx), collectionName, documents)
 	)
-	for {
-		latestTryAt = time.Now().UTC()
-		remainingoutputs, err = getRedisPipeoutputs(red, pipeKey, outputs)
+	defer pipes.untrack(pipeKey, pipe)
+	span.SetAttributes(trace.String("bulklog.pipe", pipeKey))
+	for outputName, cons := range remainingoutputs {
+		wg.Add(1)
+		go func(outputName string, cons output.Interface) {
+			defer wg.Done()
+			delivered, left, err := conveyRedisPipeOutput(trace.ContextWith(ctx, span.Context()), red, pipeKey, outputName, cons, documents, collectionName, startedAt, backoff, dieAt, deadLetters, expiry, pipe, logger)
+			if !delivered {
+				mu.Lock()
+				failures[outputName] = err
+				if len(left) < len(documents) {
+					pending[outputName] = left
+				}
+				mu.Unlock()
+			}
+		}(outputName, cons)
+	}
+	wg.Wait()
+	span.SetAttributes(trace.Int("bulklog.outputs.failed", len(failures)))
+	span.End()
+	if pipe.isDiscarded() || ctx.Err() != nil {
+		return
+	}
+	deadLetterPending(deadLetters, expiry, collectionName, redisPipeID(pipeKey), startedAt, dieAt, failures, documents, pending, logger)
+	err = deleteRedisPipe(red, pipeKey)
+	if err != nil {
+		logger.Error("pipe delete failed", "error", err)
+	}
+}
+
+// conveyRedisPipeOutput retries an output on its own schedule until it digests documents, retention ends or ctx is done.
+// It gives up if the pipe is discarded, by this process or by deleting its keys.
+// Documents the output reports as failed are the only ones retried, the ones it rejected for good are dead lettered right away.
+// Which documents are left is not persisted, a pipe resumed by another run is conveyed whole again.
+// It returns whether the output digested documents, the ones it has left otherwise and its latest digest error.
+func conveyRedisPipeOutput(
+	ctx context.Context,
+	red *redis.Pool, pipeKey, outputName string,
+	cons output.Interface,
+	documents []collection.Document,
+	collectionName collection.Name,
+	startedAt time.Time,
+	backoff collection.Backoff,
+	dieAt time.Time,
+	deadLetters DeadLetters,
+	expiry *ExpiryNotifier,
+	pipe *pipeState,
+	logger *slog.Logger) (delivered bool, left []collection.Document, lastErr error) {
+	// a previous run delivered the pipe but stopped before removing the output from it
+	delivered, err := redisPipeDelivered(red, pipeKey, outputName)
+	if err != nil {
+		logger.Error("pipe delivery read failed", "output", outputName, "error", err)
+	}
+	if delivered {
+		err = deleteRedisPipeoutput(red, pipeKey, outputName)
 		if err != nil {
-			log.Err().Printf("getRedisPipeoutputs.%s)\n", err)
-			return
+			logger.Error("pipe output delete failed", "output", outputName, "error", err)
 		}
-		if len(remainingoutputs) == 0 {
-			err = deleteRedisPipe(red, pipeKey)
-			if err != nil {
-				log.Err().Printf("deleteRedisPipe.%s)\n", err)
-			}
-			return
+		return true, nil, nil
+	}
+	// resume the retry schedule of a pipe left by a previous run
+	nextRetryAt, err := getRedisPipeNextRetryAt(red, pipeKey, outputName)
+	if err != nil {
+		logger.Error("pipe next retry read failed", "output", outputName, "error", err)
+	}
+	attempt := 1
+	for {
+		if nextRetryAt.After(dieAt) || time.Now().After(dieAt) {
+			return false, documents, lastErr
 		}
-		wg = sync.WaitGroup{}
-		for outputName, cons := range remainingoutputs {
-			wg.Add(1)
-			go func(outputName string, cons output.Interface) {
-				err = cons.Digest(documents)
-				if err != nil {
-					log.Err().Printf("Digest.%s)\n", err)
-					err = nil
-				} else {
-					err = deleteRedisPipeoutput(red, pipeKey, outputName)
-					if err != nil {
-						log.Err().Printf("deleteRedisPipeoutput.%s)\n", err)
-					}
-				}
-				wg.Done()
-			}(outputName, cons)
+		if waitFor := time.Until(nextRetryAt); waitFor > 0 {
+			pipe.wait(ctx, waitFor)
 		}
-		wg.Wait()
-		currentTimeUnixNano = time.Now().UTC().UnixNano()
-		if len(remainingoutputs) == 0 || currentTimeUnixNano > dieAtUnixNano {
-			err = deleteRedisPipe(red, pipeKey)
-			if err != nil {
-				log.Err().Printf("deleteRedisPipe.%s)\n", err)
-			} else {
-				return
-			}
+		if ctx.Err() != nil {
+			return false, documents, lastErr
 		}
-		iteration, err = getRedisPipeIteration(red, pipeKey)
+		exists, err := redisPipeExists(red, pipeKey)
 		if err != nil {
-			log.Err().Printf("getRedisPipeIteration.%s)\n", err)
-			waitFor = retryPeriod - time.Since(latestTryAt)
-			continue
+			logger.Error("pipe existence check failed", "error", err)
+		} else if !exists {
+			pipe.discard()
 		}
-		waitFor = retryPeriod*time.Duration(math.Pow(2, float64(iteration))) - time.Since(latestTryAt)
-		nextTryAtUnixNano = currentTimeUnixNano + int64(waitFor)
-		if nextTryAtUnixNano > dieAtUnixNano {
-			err = deleteRedisPipe(red, pipeKey)
+		if pipe.isDiscarded() {
+			return false, documents, lastErr
+		}
+		latestTryAt := time.Now().UTC()
+		lastErr = digest(ctx, redisPipeID(pipeKey), outputName, cons, documents, attempt, backoff.TryTimeout())
+		if lastErr != nil {
+			logger.Warn("digest failed", "output", outputName, "error", lastErr)
+			retry, rejected, reason := splitRejected(documents, lastErr)
+			if len(rejected) > 0 {
+				deadLetter(deadLetters, collectionName, startedAt, map[string]error{outputName: reason}, rejected, logger)
+			}
+			documents = retry
+		}
+		if lastErr == nil || len(documents) == 0 {
+			err = setRedisPipeDelivered(red, pipeKey, outputName)
+			if err != nil {
+				logger.Error("pipe delivery write failed", "output", outputName, "error", err)
+			}
+			err = deleteRedisPipeoutput(red, pipeKey, outputName)
 			if err != nil {
-				log.Err().Printf("deleteRedisPipe.%s)\n", err)
-			} else {
-				return
+				logger.Error("pipe output delete failed", "output", outputName, "error", err)
 			}
+			return true, nil, nil
 		}
-		err = incrRedisPipeIteration(red, pipeKey)
+		iteration, err := incrRedisPipeIteration(red, pipeKey, outputName)
 		if err != nil {
-			log.Err().Printf("incrRedisPipeIteration.%s)\n", err)
-			return
+			logger.Error("pipe iteration increment failed", "output", outputName, "error", err)
+			iteration = attempt
 		}
-		if waitFor <= 0 {
-			continue
+		attempt = iteration + 1
+		nextRetryAt = retryAt(latestTryAt.Add(backoff.Interval(iteration-1)), lastErr)
+		err = setRedisPipeNextRetryAt(red, pipeKey, outputName, nextRetryAt)
+		if err != nil {
+			logger.Error("pipe next retry write failed", "output", outputName, "error", err)
 		}
-		timer = time.NewTimer(waitFor)
-		<-timer.C
+		err = addRedisPipeAttempt(red, pipeKey, outputName, latestTryAt, lastErr)
+		if err != nil {
+			logger.Error("pipe attempt write failed", "output", outputName, "error", err)
+		}
+		expiry.failed(collectionName, redisPipeID(pipeKey), outputName, len(documents), startedAt, dieAt, latestTryAt, nextRetryAt, lastErr, logger)
 	}
 }
 
-func redisConveyAll(red *redis.Pool, pipeKeyPrefix string, outputs map[string]output.Interface) {
+// redisConveyAll conveys the pipes flushed by earlier versions, hashes and lists, which this process does not convey yet.
+// It returns the state of those pipes as they were found.
+func redisConveyAll(ctx context.Context, red *redis.Pool, keyring *encryption.Keyring, pipeKeyPrefix string, outputs map[string]output.Interface, collectionName collection.Name, deadLetters DeadLetters, expiry *ExpiryNotifier, pipes *pipeRegistry, checks *integrity, logger *slog.Logger) (found []Pipe) {
 	var (
 		pattern      = fmt.Sprintf(`%s.????????-????-????-????-????????????`, pipeKeyPrefix)
 		maxTries     = 20
@@ -166,7 +245,7 @@ func redisConveyAll(red *redis.Pool, pipeKeyPrefix string, outputs map[string]ou
 			scanResultsI, err = conn.Do("SCAN", cursor, "MATCH", pattern)
 			conn.Close()
 			if err != nil {
-				log.Err().Printf("SCAN.%s; Try: %d\n", err, i)
+				logger.Error("pipes scan failed", "try", i, "error", err)
 				success = false
 				break
 			}
@@ -174,20 +253,35 @@ func redisConveyAll(red *redis.Pool, pipeKeyPrefix string, outputs map[string]ou
 			cursorI = scanResults[0]
 			cursor, err = strconv.Atoi(string(cursorI.([]byte)))
 			if err != nil {
-				log.Err().Printf("strconv.%s; Try: %d\n", err, i)
+				logger.Error("pipes scan cursor unparsable", "try", i, "error", err)
 				success = false
 				break
 			}
 			pipeKeysI = scanResults[1]
 			pipeKeys = pipeKeysI.([]interface{})
 			for _, pipeKeyI = range pipeKeys {
-				go redisConvey(red, string(pipeKeyI.([]byte)), outputs)
+				pipeKey := string(pipeKeyI.([]byte))
+				if pipes.get(pipeKey) == nil {
+					pipe, err := getRedisPipeState(red, pipeKey)
+					if err == nil {
+						pipe.ID = redisPipeID(pipeKey)
+						found = append(found, pipe)
+					} else if err != errRedisPipeNotFound {
+						logger.Error("pipe state read failed", "pipe", pipeKey, "error", err)
+					}
+				}
+				go redisConvey(ctx, red, keyring, pipeKey, outputs, collectionName, deadLetters, expiry, pipes, checks, logger.With("pipe", pipeKey))
 			}
 			success = true
 		}
 		if !success {
 			timer = time.NewTimer(retryPeriod)
-			<-timer.C
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				return found
+			}
 			continue
 		}
 		break
@@ -195,4 +289,88 @@ func redisConveyAll(red *redis.Pool, pipeKeyPrefix string, outputs map[string]ou
 	if !success {
 		panic(fmt.Errorf("redis KEYS kept failing after %d retries", maxTries))
 	}
+	return found
+}
+
+// redisReapPeriod - how often the lease holder looks for pipes flushed by earlier versions that no instance conveys anymore
+const redisReapPeriod = time.Minute
+
+// reapPipes resumes orphaned pipes while this instance holds the lease, until the buffer is closed.
+// Pipes flushed to the stream need no reaper, they are claimed by the polls of any instance.
+func (b *redisBuffer) reapPipes() {
+	defer b.conveying.Done()
+	ticker := time.NewTicker(redisReapPeriod)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-b.close:
+			return
+		case <-ticker.C:
+			if !b.lease.Held() {
+				continue
+			}
+			err := redisReap(collection.WithPriority(b.ctx, b.collection().Priority), b.redis, b.keyring, b.pipeKeyPrefix, b.outputs(), b.collection().Name, b.deadLetters, b.expiry, &b.pipes, &b.integrity, b.logger)
+			if err != nil {
+				b.logger.Error("pipes reap failed", "error", err)
+			}
+		}
+	}
+}
+
+// redisReap conveys the pipes whose conveyance died, e.g. with the instance conveying them.
+// Pipes past retention are dead lettered and deleted, others resume their retry schedule.
+func redisReap(ctx context.Context, red *redis.Pool, keyring *encryption.Keyring, pipeKeyPrefix string, outputs map[string]output.Interface, collectionName collection.Name, deadLetters DeadLetters, expiry *ExpiryNotifier, pipes *pipeRegistry, checks *integrity, logger *slog.Logger) error {
+	pipeKeys, err := scanRedisPipes(red, pipeKeyPrefix)
+	if err != nil {
+		return fmt.Errorf("scanRedisPipes.%s", err)
+	}
+	for _, pipeKey := range pipeKeys {
+		if pipes.get(pipeKey) != nil {
+			continue
+		}
+		orphaned, err := redisPipeOrphaned(red, pipeKey, outputs)
+		if err != nil {
+			logger.Error("pipe orphan check failed", "pipe", pipeKey, "error", err)
+			continue
+		}
+		if orphaned {
+			logger.Warn("orphaned pipe resumed", "pipe", pipeKey)
+			go redisConvey(ctx, red, keyring, pipeKey, outputs, collectionName, deadLetters, expiry, pipes, checks, logger.With("pipe", pipeKey))
+		}
+	}
+	return nil
+}
+
+// redisPipeOrphaned tells whether no instance conveys a pipe anymore: its retention is over,
+// or the next try of every remaining output is overdue by redisStreamClaimAfter.
+// An instance conveying a pipe always schedules the next try of an output before waiting for it.
+func redisPipeOrphaned(red *redis.Pool, pipeKey string, outputs map[string]output.Interface) (bool, error) {
+	startedAt, _, retentionPeriod, err := getRedisPipe(red, pipeKey)
+	if err == errRedisPipeNotFound {
+		// partially deleted, conveying it deletes the rest
+		return true, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("getRedisPipe.%s", err)
+	}
+	if time.Now().After(startedAt.Add(retentionPeriod)) {
+		return true, nil
+	}
+	remainingoutputs, err := getRedisPipeoutputs(red, pipeKey, outputs)
+	if err != nil {
+		return false, fmt.Errorf("getRedisPipeoutputs.%s", err)
+	}
+	for outputName := range remainingoutputs {
+		nextRetryAt, err := getRedisPipeNextRetryAt(red, pipeKey, outputName)
+		if err != nil {
+			return false, fmt.Errorf("getRedisPipeNextRetryAt.%s", err)
+		}
+		if nextRetryAt.Before(startedAt) {
+			nextRetryAt = startedAt
+		}
+		if time.Since(nextRetryAt) < redisStreamClaimAfter {
+			return false, nil
+		}
+	}
+	return true, nil
 }
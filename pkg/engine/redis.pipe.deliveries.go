@@ -0,0 +1,45 @@
+package engine
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// Deliveries are recorded per output in the hash {pipeKey}.deliveries keyed by output name, valued by the idempotency key,
+// before the output is removed from the pipe: a pipe resumed after a crash in between is not delivered again to it.
+// A crash between a delivery and its record still delivers the pipe twice, with the same idempotency key so downstreams can dedupe it.
+
+// redisPipeID returns the UUID of a pipe from its key, {pipeKeyPrefix}.{uuid}
+func redisPipeID(pipeKey string) string {
+	return pipeKey[strings.LastIndex(pipeKey, ".")+1:]
+}
+
+func setRedisPipeDelivered(red *redis.Pool, pipeKey, outputName string) (err error) {
+	conn := red.Get()
+	defer conn.Close()
+	_, err = conn.Do("HSET", fmt.Sprintf("%s.deliveries", pipeKey), outputName, idempotencyKey(redisPipeID(pipeKey), outputName))
+	if err != nil {
+		return fmt.Errorf("(HSET pipeKey.deliveries outputName).%s", err)
+	}
+	return nil
+}
+
+func redisPipeDelivered(red *redis.Pool, pipeKey, outputName string) (delivered bool, err error) {
+	conn := red.Get()
+	defer conn.Close()
+	delivered, err = redis.Bool(conn.Do("HEXISTS", fmt.Sprintf("%s.deliveries", pipeKey), outputName))
+	if err != nil {
+		return false, fmt.Errorf("(HEXISTS pipeKey.deliveries outputName).%s", err)
+	}
+	return delivered, nil
+}
+
+func deleteRedisPipeDeliveries(conn redis.Conn, pipeKey string) (err error) {
+	err = conn.Send("DEL", fmt.Sprintf("%s.deliveries", pipeKey))
+	if err != nil {
+		return fmt.Errorf("(DEL pipeKey.deliveries).%s", err)
+	}
+	return nil
+}
@@ -1,56 +1,90 @@
 package engine
 
 import (
-	"bytes"
-	"encoding/base64"
-	"encoding/gob"
 	"fmt"
 
 	"github.com/gomodule/redigo/redis"
 	"github.com/khezen/bulklog/pkg/collection"
+	"github.com/khezen/bulklog/pkg/encryption"
 )
 
-func flushBuffer2RedisPipe(conn redis.Conn, bufferKey, pipeKey string) (err error) {
-	err = conn.Send("RENAME", bufferKey, fmt.Sprintf("%s.buffer", pipeKey))
-	if err != nil {
-		return fmt.Errorf("RENAME(bufferKey pipeKey.buffer).%s", err)
-	}
-	return nil
-}
-
-func getRedisPipeDocuments(red *redis.Pool, pipeKey string) (documents []collection.Document, err error) {
+// getRedisPipeDocuments reads the documents of a pipe, along with the checksum of their entries
+func getRedisPipeDocuments(red *redis.Pool, keyring *encryption.Keyring, pipeKey string) (stored storedDocuments, err error) {
 	conn := red.Get()
 	defer conn.Close()
 	bufferKey := fmt.Sprintf("%s.buffer", pipeKey)
 	documentsLenI, err := conn.Do("LLEN", bufferKey)
 	if err != nil {
-		return nil, fmt.Errorf("(LLEN pipeKey.buffer).%s", err)
+		return stored, fmt.Errorf("(LLEN pipeKey.buffer).%s", err)
 	}
 	documentsLen := documentsLenI.(int64)
+	stored.documents = make([]collection.Document, 0, documentsLen)
 	if documentsLen == 0 {
-		return []collection.Document{}, nil
+		return stored, nil
 	}
 	docStringsI, err := conn.Do("LRANGE", bufferKey, 0, documentsLen)
 	if err != nil {
-		return nil, fmt.Errorf("(LRANGE pipeKey.buffer 0 documentsLen).%s", err)
+		return stored, fmt.Errorf("(LRANGE pipeKey.buffer 0 documentsLen).%s", err)
 	}
 	docStrings := docStringsI.([]interface{})
-	documents = make([]collection.Document, 0, documentsLen)
-	var buf *bytes.Buffer
-	for _, docBase64 := range docStrings {
-		docBytes, err := base64.StdEncoding.DecodeString(string(docBase64.([]byte)))
+	for _, entryI := range docStrings {
+		entry := entryI.([]byte)
+		stored.checksum.add(redisEntryChecksum(entry))
+		doc, err := decodeRedisDocument(entry, keyring)
+		if err == ErrCorruptedDocument {
+			stored.corrupted = append(stored.corrupted, doc)
+			continue
+		}
 		if err != nil {
-			return nil, fmt.Errorf("base64.std.decode.%s", err)
+			return stored, fmt.Errorf("decodeRedisDocument.%s", err)
+		}
+		stored.documents = append(stored.documents, doc)
+	}
+	return stored, nil
+}
+
+// getRedisPipeDocumentsRange reads up to limit documents of a pipe from offset on, and how many it holds
+func getRedisPipeDocumentsRange(red *redis.Pool, keyring *encryption.Keyring, pipeKey string, offset, limit int) (documents []collection.Document, total int, err error) {
+	conn := red.Get()
+	defer conn.Close()
+	bufferKey := fmt.Sprintf("%s.buffer", pipeKey)
+	err = conn.Send("MULTI")
+	if err != nil {
+		return nil, 0, fmt.Errorf("MULTI.%s", err)
+	}
+	err = conn.Send("LLEN", bufferKey)
+	if err != nil {
+		return nil, 0, fmt.Errorf("(LLEN pipeKey.buffer).%s", err)
+	}
+	err = conn.Send("LRANGE", bufferKey, offset, offset+limit-1)
+	if err != nil {
+		return nil, 0, fmt.Errorf("(LRANGE pipeKey.buffer offset offset+limit-1).%s", err)
+	}
+	results, err := redis.Values(conn.Do("EXEC"))
+	if err != nil {
+		return nil, 0, fmt.Errorf("EXEC.%s", err)
+	}
+	total, err = redis.Int(results[0], nil)
+	if err != nil {
+		return nil, 0, fmt.Errorf("(LLEN pipeKey.buffer).%s", err)
+	}
+	entries, err := redis.ByteSlices(results[1], nil)
+	if err != nil {
+		return nil, 0, fmt.Errorf("(LRANGE pipeKey.buffer offset offset+limit-1).%s", err)
+	}
+	documents = make([]collection.Document, 0, len(entries))
+	for _, entry := range entries {
+		doc, err := decodeRedisDocument(entry, keyring)
+		if err == ErrCorruptedDocument {
+			// dead lettered once the pipe is conveyed, they are not snapshotted
+			continue
 		}
-		buf = bytes.NewBuffer(docBytes)
-		var doc collection.Document
-		err = gob.NewDecoder(buf).Decode(&doc)
 		if err != nil {
-			return nil, fmt.Errorf("(gob.decode.%s", err)
+			return nil, 0, fmt.Errorf("decodeRedisDocument.%s", err)
 		}
 		documents = append(documents, doc)
 	}
-	return documents, nil
+	return documents, total, nil
 }
 
 func deleteRedisPipeDocuments(conn redis.Conn, pipeKey string) (err error) {
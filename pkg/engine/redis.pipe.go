@@ -7,7 +7,7 @@ import (
 	"time"
 
 	"github.com/gomodule/redigo/redis"
-	"github.com/khezen/bulklog/pkg/log"
+	"github.com/khezen/bulklog/pkg/collection"
 )
 
 var (
@@ -16,80 +16,148 @@ var (
 
 func getRedisPipe(red *redis.Pool, pipeKey string) (
 	startedAt time.Time,
-	retryPeriod, retentionPeriod time.Duration,
+	backoff collection.Backoff,
+	retentionPeriod time.Duration,
 	err error) {
 	conn := red.Get()
 	defer conn.Close()
 	err = conn.Send("MULTI")
 	if err != nil {
-		return time.Time{}, 0, 0, fmt.Errorf("MULTI.%s", err)
+		return time.Time{}, backoff, 0, fmt.Errorf("MULTI.%s", err)
 	}
 	defer func() {
 		if err != nil {
-			_, err = conn.Do("DISCRD")
-			if err != nil {
-				log.Err().Printf("DISCARD.%s\n", err)
+			_, discardErr := conn.Do("DISCARD")
+			if discardErr != nil {
+				err = fmt.Errorf("%s; DISCARD.%s", err, discardErr)
 			}
 		}
 	}()
 	err = conn.Send("HGET", pipeKey, "retryPeriodNano")
 	if err != nil {
-		return time.Time{}, 0, 0, fmt.Errorf("(HGET pipeKey retryPeriodNano).%s", err)
+		return time.Time{}, backoff, 0, fmt.Errorf("(HGET pipeKey retryPeriodNano).%s", err)
 	}
 	err = conn.Send("HGET", pipeKey, "retentionPeriodNano")
 	if err != nil {
-		return time.Time{}, 0, 0, fmt.Errorf("(HGET pipeKey retentionPeriodNano).%s", err)
+		return time.Time{}, backoff, 0, fmt.Errorf("(HGET pipeKey retentionPeriodNano).%s", err)
 	}
 	err = conn.Send("HGET", pipeKey, "startedAt")
 	if err != nil {
-		return time.Time{}, 0, 0, fmt.Errorf("(HGET pipeKey startedAt).%s", err)
+		return time.Time{}, backoff, 0, fmt.Errorf("(HGET pipeKey startedAt).%s", err)
+	}
+	err = conn.Send("HMGET", pipeKey, "backoffMultiplier", "backoffMaxIntervalNano", "backoffJitter")
+	if err != nil {
+		return time.Time{}, backoff, 0, fmt.Errorf("(HMGET pipeKey backoff).%s", err)
 	}
 	resultsI, err := conn.Do("EXEC")
 	if err != nil {
-		return time.Time{}, 0, 0, fmt.Errorf("EXEC.%s", err)
+		return time.Time{}, backoff, 0, fmt.Errorf("EXEC.%s", err)
 	}
 	results := resultsI.([]interface{})
 	if results[0] == nil {
-		return time.Time{}, 0, 0, errRedisPipeNotFound
+		return time.Time{}, backoff, 0, errRedisPipeNotFound
 	}
 	retryPeriodStr := string(results[0].([]byte))
 	retryPeriodInt, err := strconv.Atoi(retryPeriodStr)
 	if err != nil {
-		return time.Time{}, 0, 0, fmt.Errorf("retryPeriodAtoi.%s", err)
+		return time.Time{}, backoff, 0, fmt.Errorf("retryPeriodAtoi.%s", err)
 	}
-	retryPeriod = time.Duration(retryPeriodInt)
+	backoff.Base = time.Duration(retryPeriodInt)
 	retentionPeriodStr := string(results[1].([]byte))
 	retentionPeriodInt, err := strconv.Atoi(retentionPeriodStr)
 	if err != nil {
-		return time.Time{}, 0, 0, fmt.Errorf("retentionPeriodAtoi.%s", err)
+		return time.Time{}, backoff, 0, fmt.Errorf("retentionPeriodAtoi.%s", err)
 	}
 	retentionPeriod = time.Duration(retentionPeriodInt)
 	startedAtStr := string(results[2].([]byte))
 	startedAt, err = time.Parse(time.RFC3339Nano, startedAtStr)
 	if err != nil {
-		return time.Time{}, 0, 0, fmt.Errorf("parseStartedAtStr.%s", err)
+		return time.Time{}, backoff, 0, fmt.Errorf("parseStartedAtStr.%s", err)
+	}
+	// pipes created by earlier versions have no backoff fields
+	backoffFields := results[3].([]interface{})
+	if backoffFields[0] != nil {
+		backoff.Multiplier, err = strconv.ParseFloat(string(backoffFields[0].([]byte)), 64)
+		if err != nil {
+			return time.Time{}, backoff, 0, fmt.Errorf("backoffMultiplierParseFloat.%s", err)
+		}
+	}
+	if backoffFields[1] != nil {
+		maxIntervalInt, err := strconv.ParseInt(string(backoffFields[1].([]byte)), 10, 64)
+		if err != nil {
+			return time.Time{}, backoff, 0, fmt.Errorf("backoffMaxIntervalParseInt.%s", err)
+		}
+		backoff.MaxInterval = time.Duration(maxIntervalInt)
+	}
+	if backoffFields[2] != nil {
+		backoff.Jitter, err = strconv.ParseFloat(string(backoffFields[2].([]byte)), 64)
+		if err != nil {
+			return time.Time{}, backoff, 0, fmt.Errorf("backoffJitterParseFloat.%s", err)
+		}
 	}
-	return startedAt, retryPeriod, retentionPeriod, nil
+	return startedAt, backoff, retentionPeriod, nil
 }
 
-func newRedisPipe(conn redis.Conn, pipeKey string, retryPeriod, retentionPeriod time.Duration, startedAt time.Time) (err error) {
-	err = conn.Send("HSET", pipeKey, "retryPeriodNano", int64(retryPeriod))
+// getRedisPipeChecksum reads the checksum of a pipe written by RestorePipe, nil if it was written without one
+func getRedisPipeChecksum(red *redis.Pool, pipeKey string) (*pipeChecksum, error) {
+	conn := red.Get()
+	defer conn.Close()
+	checksumStr, err := redis.String(conn.Do("HGET", pipeKey, "checksum"))
+	if err == redis.ErrNil {
+		return nil, nil
+	}
 	if err != nil {
-		return fmt.Errorf("(HSET pipeKey retryPeriodNano %d).%s", retryPeriod, err)
+		return nil, fmt.Errorf("(HGET pipeKey checksum).%s", err)
 	}
-	err = conn.Send("HSET", pipeKey, "retentionPeriodNano", int64(retentionPeriod))
+	checksum, err := parsePipeChecksum(checksumStr)
 	if err != nil {
-		return fmt.Errorf("(HSET pipeKey retentionPeriodNano %d).%s", retentionPeriod, err)
+		return nil, err
 	}
-	err = conn.Send("HSET", pipeKey, "startedAt", startedAt.Format(time.RFC3339Nano))
+	return &checksum, nil
+}
+
+// createRedisPipe writes a pipe as a hash of fields, along with its documents and the outputs it is pending for.
+// It returns false if the pipe exists already, or is written concurrently.
+func createRedisPipe(red *redis.Pool, pipeKey string, fields []interface{}, encoded []interface{}, outputNames []string) (created bool, err error) {
+	conn := red.Get()
+	defer conn.Close()
+	_, err = conn.Do("WATCH", pipeKey)
 	if err != nil {
-		return fmt.Errorf("(HSET pipeKey startedAt %s).%s", startedAt.Format(time.RFC3339Nano), err)
+		return false, fmt.Errorf("(WATCH pipeKey).%s", err)
 	}
-	err = setRedisPipeIteration(conn, pipeKey, 0)
+	exists, err := redis.Bool(conn.Do("EXISTS", pipeKey))
+	if err != nil || exists {
+		conn.Do("UNWATCH")
+		if err != nil {
+			return false, fmt.Errorf("(EXISTS pipeKey).%s", err)
+		}
+		return false, nil
+	}
+	outputs := make([]interface{}, 0, len(outputNames)+1)
+	outputs = append(outputs, fmt.Sprintf("%s.outputs", pipeKey))
+	for _, outputName := range outputNames {
+		outputs = append(outputs, outputName)
+	}
+	bufferKey := fmt.Sprintf("%s.buffer", pipeKey)
+	for _, cmd := range [][]interface{}{
+		{"MULTI"},
+		{"DEL", bufferKey, outputs[0]},
+		append([]interface{}{"RPUSH", bufferKey}, encoded...),
+		append([]interface{}{"RPUSH"}, outputs...),
+		// the hash is written last as it tells the pipe exists
+		append([]interface{}{"HMSET", pipeKey}, fields...),
+	} {
+		err = conn.Send(cmd[0].(string), cmd[1:]...)
+		if err != nil {
+			return false, fmt.Errorf("%s.%s", cmd[0], err)
+		}
+	}
+	reply, err := conn.Do("EXEC")
 	if err != nil {
-		return fmt.Errorf("setRedisPipeIteration.%s", err)
+		return false, fmt.Errorf("EXEC.%s", err)
 	}
-	return nil
+	// nil once the pipe was written concurrently
+	return reply != nil, nil
 }
 
 func deleteRedisPipe(red *redis.Pool, pipeKey string) (err error) {
@@ -111,9 +179,31 @@ func deleteRedisPipe(red *redis.Pool, pipeKey string) (err error) {
 	if err != nil {
 		return fmt.Errorf("deleteRedisPipeDocuments.%s", err)
 	}
+	err = deleteRedisPipeIterations(conn, pipeKey)
+	if err != nil {
+		return fmt.Errorf("deleteRedisPipeIterations.%s", err)
+	}
+	err = deleteRedisPipeDeliveries(conn, pipeKey)
+	if err != nil {
+		return fmt.Errorf("deleteRedisPipeDeliveries.%s", err)
+	}
+	err = deleteRedisPipeAttempts(conn, pipeKey)
+	if err != nil {
+		return fmt.Errorf("deleteRedisPipeAttempts.%s", err)
+	}
 	_, err = conn.Do("EXEC")
 	if err != nil {
 		return fmt.Errorf("EXEC.%s", err)
 	}
 	return nil
 }
+
+func redisPipeExists(red *redis.Pool, pipeKey string) (bool, error) {
+	conn := red.Get()
+	defer conn.Close()
+	exists, err := redis.Bool(conn.Do("EXISTS", pipeKey))
+	if err != nil {
+		return false, fmt.Errorf("(EXISTS pipeKey).%s", err)
+	}
+	return exists, nil
+}
@@ -2,38 +2,51 @@ package engine
 
 import (
 	"fmt"
-	"strconv"
+	"time"
 
 	"github.com/gomodule/redigo/redis"
 )
 
-func getRedisPipeIteration(red *redis.Pool, pipeKey string) (i int, err error) {
+// Retry state is tracked per output in two hashes keyed by output name:
+// {pipeKey}.iterations holds failed tries and {pipeKey}.nextRetryAt the time of the next try.
+
+func incrRedisPipeIteration(red *redis.Pool, pipeKey, outputName string) (iteration int, err error) {
 	conn := red.Get()
 	defer conn.Close()
-	iStr, err := conn.Do("HGET", pipeKey, "iteration")
+	iteration, err = redis.Int(conn.Do("HINCRBY", fmt.Sprintf("%s.iterations", pipeKey), outputName, 1))
 	if err != nil {
-		return -1, fmt.Errorf("(HGET pipeKey iteration).%s", err)
-	}
-	if iStr == nil {
-		return 0, nil
+		return 0, fmt.Errorf("(HINCRBY pipeKey.iterations outputName 1).%s", err)
 	}
-	return strconv.Atoi(string(iStr.([]byte)))
+	return iteration, nil
 }
 
-func setRedisPipeIteration(conn redis.Conn, pipeKey string, iter int) (err error) {
-	err = conn.Send("HSET", pipeKey, "iteration", iter)
+func getRedisPipeNextRetryAt(red *redis.Pool, pipeKey, outputName string) (nextRetryAt time.Time, err error) {
+	conn := red.Get()
+	defer conn.Close()
+	nextRetryAtStr, err := conn.Do("HGET", fmt.Sprintf("%s.nextRetryAt", pipeKey), outputName)
 	if err != nil {
-		return fmt.Errorf("(HSET pipeKey iteration %d).%s", iter, err)
+		return time.Time{}, fmt.Errorf("(HGET pipeKey.nextRetryAt outputName).%s", err)
 	}
-	return nil
+	if nextRetryAtStr == nil {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339Nano, string(nextRetryAtStr.([]byte)))
 }
 
-func incrRedisPipeIteration(red *redis.Pool, pipeKey string) (err error) {
+func setRedisPipeNextRetryAt(red *redis.Pool, pipeKey, outputName string, nextRetryAt time.Time) (err error) {
 	conn := red.Get()
 	defer conn.Close()
-	_, err = conn.Do("HINCRBY", pipeKey, "iteration", 1)
+	_, err = conn.Do("HSET", fmt.Sprintf("%s.nextRetryAt", pipeKey), outputName, nextRetryAt.Format(time.RFC3339Nano))
+	if err != nil {
+		return fmt.Errorf("(HSET pipeKey.nextRetryAt outputName %s).%s", nextRetryAt.Format(time.RFC3339Nano), err)
+	}
+	return nil
+}
+
+func deleteRedisPipeIterations(conn redis.Conn, pipeKey string) (err error) {
+	err = conn.Send("DEL", fmt.Sprintf("%s.iterations", pipeKey), fmt.Sprintf("%s.nextRetryAt", pipeKey))
 	if err != nil {
-		return fmt.Errorf("(HINCRBY pipeKey iteration 1).%s", err)
+		return fmt.Errorf("(DEL pipeKey.iterations pipeKey.nextRetryAt).%s", err)
 	}
 	return nil
 }
@@ -0,0 +1,119 @@
+package engine
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/khezen/bulklog/pkg/collection"
+	"github.com/khezen/bulklog/pkg/config"
+)
+
+// ErrInvalidRedisCA - redis ca_file holds no PEM certificate
+var ErrInvalidRedisCA = errors.New("ErrInvalidRedisCA - redis ca_file contains no valid PEM certificate")
+
+func newRedisPool(redisCfg *config.Redis) *redis.Pool {
+	dial := func() (redis.Conn, error) {
+		return dialRedis(redisCfg.Endpoint, redisCfg)
+	}
+	switch {
+	case redisCfg.Cluster != nil:
+		cluster := newRedisCluster(redisCfg)
+		dial = func() (redis.Conn, error) {
+			return cluster.conn(), nil
+		}
+	case redisCfg.Sentinel != nil:
+		dial = func() (redis.Conn, error) {
+			return dialSentinelMaster(redisCfg)
+		}
+	}
+	return &redis.Pool{
+		MaxActive:   redisCfg.MaxConn,
+		Wait:        true,
+		MaxIdle:     redisCfg.IdleConn,
+		IdleTimeout: 5 * time.Minute,
+		Dial:        dial,
+		TestOnBorrow: func(c redis.Conn, t time.Time) error {
+			if time.Since(t) < time.Minute {
+				return nil
+			}
+			_, err := c.Do("PING")
+			return err
+		},
+	}
+}
+
+func dialRedis(addr string, redisCfg *config.Redis) (redis.Conn, error) {
+	c, err := dialRedisTLS(addr, &redisCfg.TLS)
+	if err != nil {
+		return nil, err
+	}
+	err = authRedis(c, redisCfg.Username, redisCfg.Password)
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+	if _, err := c.Do("SELECT", redisCfg.DB); err != nil {
+		c.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// dialRedisTLS dials addr, over TLS if enabled.
+// Certificate files are read on each dial so renewed certificates are picked up by new connections.
+func dialRedisTLS(addr string, tlsCfg *config.RedisTLS) (redis.Conn, error) {
+	if !tlsCfg.Enabled {
+		return redis.Dial("tcp", addr)
+	}
+	tlsConfig := &tls.Config{
+		ServerName:         tlsCfg.ServerName,
+		InsecureSkipVerify: tlsCfg.InsecureSkipVerify,
+	}
+	if tlsCfg.CAFile != "" {
+		caBytes, err := ioutil.ReadFile(tlsCfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("ioutil.ReadFile.%s", err)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(caBytes) {
+			return nil, ErrInvalidRedisCA
+		}
+	}
+	if tlsCfg.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(tlsCfg.CertFile, tlsCfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("tls.LoadX509KeyPair.%s", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return redis.Dial("tcp", addr, redis.DialUseTLS(true), redis.DialTLSConfig(tlsConfig))
+}
+
+// authRedis authenticates as the ACL user username if set, as the default user otherwise
+func authRedis(c redis.Conn, username, password string) error {
+	if password == "" {
+		return nil
+	}
+	var err error
+	if username != "" {
+		_, err = c.Do("AUTH", username, password)
+	} else {
+		_, err = c.Do("AUTH", password)
+	}
+	return err
+}
+
+// redisKeyPrefix - prefix of the keys of a collection.
+// With redis cluster, the collection name is a hash tag so all its keys land on the same slot,
+// which lets pipes be renamed, transactions and scripts span several keys. Standalone keys are left untouched.
+func redisKeyPrefix(redisCfg *config.Redis, collectionName collection.Name) string {
+	if redisCfg.Cluster != nil {
+		return fmt.Sprintf("bulklog.{%s}", collectionName)
+	}
+	return fmt.Sprintf("bulklog.%s", collectionName)
+}
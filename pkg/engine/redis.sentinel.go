@@ -0,0 +1,95 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/khezen/bulklog/pkg/config"
+)
+
+var (
+	// ErrNoSentinel - none of the sentinels knows the master
+	ErrNoSentinel = errors.New("ErrNoSentinel - no sentinel could resolve the redis master")
+	// ErrNotMaster - the resolved address is not a master, a failover is in progress
+	ErrNotMaster = errors.New("ErrNotMaster - redis node is not a master")
+)
+
+// dialSentinelMaster asks the sentinels where the master is and dials it
+func dialSentinelMaster(redisCfg *config.Redis) (redis.Conn, error) {
+	var lastErr error = ErrNoSentinel
+	for _, sentinelAddr := range redisCfg.Sentinel.Addrs {
+		addr, err := sentinelMasterAddr(sentinelAddr, redisCfg)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		c, err := dialRedis(addr, redisCfg)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		role, err := redis.Values(c.Do("ROLE"))
+		if err != nil || len(role) == 0 || fmt.Sprintf("%s", role[0]) != "master" {
+			c.Close()
+			lastErr = ErrNotMaster
+			continue
+		}
+		return &sentinelConn{Conn: c}, nil
+	}
+	return nil, fmt.Errorf("dialSentinelMaster.%s", lastErr)
+}
+
+func sentinelMasterAddr(sentinelAddr string, redisCfg *config.Redis) (string, error) {
+	// sentinels have no database to SELECT
+	c, err := dialRedisTLS(sentinelAddr, &redisCfg.TLS)
+	if err != nil {
+		return "", err
+	}
+	defer c.Close()
+	err = authRedis(c, "", redisCfg.Sentinel.Password)
+	if err != nil {
+		return "", err
+	}
+	hostPort, err := redis.Strings(c.Do("SENTINEL", "get-master-addr-by-name", redisCfg.Sentinel.Master))
+	if err != nil {
+		return "", err
+	}
+	if len(hostPort) != 2 {
+		return "", ErrNoSentinel
+	}
+	return net.JoinHostPort(hostPort[0], hostPort[1]), nil
+}
+
+// sentinelConn breaks once its node was demoted, so the pool dials the new master instead of reusing it
+type sentinelConn struct {
+	redis.Conn
+	err error
+}
+
+func (c *sentinelConn) Err() error {
+	if c.err != nil {
+		return c.err
+	}
+	return c.Conn.Err()
+}
+
+func (c *sentinelConn) Do(commandName string, args ...interface{}) (interface{}, error) {
+	reply, err := c.Conn.Do(commandName, args...)
+	c.check(err)
+	return reply, err
+}
+
+func (c *sentinelConn) Receive() (interface{}, error) {
+	reply, err := c.Conn.Receive()
+	c.check(err)
+	return reply, err
+}
+
+func (c *sentinelConn) check(err error) {
+	if redisErr, ok := err.(redis.Error); ok && strings.HasPrefix(string(redisErr), "READONLY") {
+		c.err = ErrNotMaster
+	}
+}
@@ -0,0 +1,266 @@
+package engine
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/khezen/bulklog/pkg/collection"
+	"github.com/khezen/bulklog/pkg/output"
+	"github.com/khezen/bulklog/pkg/output/retry"
+	"github.com/khezen/bulklog/pkg/trace"
+)
+
+const (
+	// redisStreamReadCount - pipes read at once from an output group
+	redisStreamReadCount = 16
+	// redisStreamPendingCount - pending pipes of an output group checked per poll
+	redisStreamPendingCount = 100
+	// redisStreamPollPeriod - how often pipes flushed by other instances, and pending ones, are polled
+	redisStreamPollPeriod = time.Second
+	// redisStreamClaimAfter - idle time after which pipes delivered to another instance are claimed,
+	// it must exceed the time an output takes to digest a pipe
+	redisStreamClaimAfter = 5 * time.Minute
+)
+
+// redisStreamConsumer names this instance in output groups, so it resumes its pending pipes after a restart
+func redisStreamConsumer() string {
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		return uuid.New().String()
+	}
+	return hostname
+}
+
+// redisStreamStateKey - pipe registry key of a pipe conveyed to an output
+func redisStreamStateKey(entryID, outputName string) string {
+	return fmt.Sprintf("%s/%s", entryID, outputName)
+}
+
+// conveyStreams conveys the pipes flushed by any instance and claims the stale ones until the buffer is closed
+func (b *redisBuffer) conveyStreams() {
+	defer b.conveying.Done()
+	ticker := time.NewTicker(redisStreamPollPeriod)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-b.close:
+			return
+		case <-ticker.C:
+			b.readStreamPipes()
+			b.claimStreamPipes()
+		}
+	}
+}
+
+// readStreamPipes conveys the pipes which were never delivered to outputs
+func (b *redisBuffer) readStreamPipes() {
+	outputs := b.outputs()
+	for outputName, cons := range outputs {
+		for {
+			pipes, err := readRedisStreamPipes(b.redis, b.streamKey, outputName, b.consumer)
+			if err != nil {
+				b.logger.Error("pipes read failed", "output", outputName, "error", err)
+				// the stream was deleted along with its groups
+				if strings.Contains(err.Error(), "NOGROUP") {
+					err = createRedisStreamGroups(b.redis, b.streamKey, outputs)
+					if err != nil {
+						b.logger.Error("output groups creation failed", "error", err)
+					}
+				}
+				break
+			}
+			for _, pipe := range pipes {
+				b.conveying.Add(1)
+				go b.conveyStreamPipe(pipe, outputName, cons, 1)
+			}
+			if len(pipes) < redisStreamReadCount {
+				break
+			}
+		}
+	}
+}
+
+// claimStreamPipes conveys pending pipes which are due for retry and not conveyed by this process:
+// the ones this instance conveyed before a restart, and the ones of instances which stopped conveying them.
+func (b *redisBuffer) claimStreamPipes() {
+	outputs := b.outputs()
+	for outputName, cons := range outputs {
+		pending, err := pendingRedisStreamPipes(b.redis, b.streamKey, outputName, "-", "+")
+		if err != nil {
+			b.logger.Error("pending pipes read failed", "output", outputName, "error", err)
+			continue
+		}
+		for _, entry := range pending {
+			if b.pipes.get(redisStreamStateKey(entry.entryID, outputName)) != nil {
+				continue
+			}
+			pipe, exists, err := getRedisStreamPipe(b.redis, b.streamKey, entry.entryID)
+			if err != nil {
+				b.logger.Error("pending pipe read failed", "output", outputName, "error", err)
+				continue
+			}
+			if !exists {
+				// discarded while pending for an output this instance did not know
+				err = ackRedisStreamEntry(b.redis, b.streamKey, outputName, entry.entryID)
+				if err != nil {
+					b.logger.Error("pipe ack failed", "output", outputName, "error", err)
+				}
+				continue
+			}
+			minIdle := b.claimIdle(pipe, entry, outputName)
+			if entry.idle < minIdle {
+				continue
+			}
+			pipe, claimed, err := claimRedisStreamPipe(b.redis, b.streamKey, outputName, b.consumer, entry.entryID, minIdle)
+			if err != nil {
+				b.logger.Error("pipe claim failed", "output", outputName, "error", err)
+				continue
+			}
+			if !claimed || pipe.id == "" {
+				continue
+			}
+			b.conveying.Add(1)
+			go b.conveyStreamPipe(pipe, outputName, cons, entry.deliveries+1)
+		}
+	}
+}
+
+// claimIdle - idle time after which a pending pipe is retried: its backoff interval since the latest try, or until the retry its output asked for,
+// at least redisStreamClaimAfter for pipes of other instances. Pipes whose next try is after retention are claimed to be dead lettered.
+func (b *redisBuffer) claimIdle(pipe redisStreamPipe, entry redisStreamPending, outputName string) time.Duration {
+	minIdle := pipe.backoff.Interval(entry.deliveries - 1)
+	nextRetryAt, err := getRedisPipeNextRetryAt(b.redis, fmt.Sprintf("%s.%s", b.pipeKeyPrefix, pipe.id), outputName)
+	if err != nil {
+		b.logger.Error("pipe next retry read failed", "output", outputName, "error", err)
+	} else if waitFor := entry.idle + time.Until(nextRetryAt); waitFor > minIdle {
+		minIdle = waitFor
+	}
+	if time.Now().Add(minIdle - entry.idle).After(pipe.expiresAt()) {
+		minIdle = 0
+	}
+	if entry.consumer != b.consumer && minIdle < redisStreamClaimAfter {
+		minIdle = redisStreamClaimAfter
+	}
+	return minIdle
+}
+
+// conveyStreamPipe retries an output on the pipe schedule until it digests documents or retention ends,
+// as long as this instance keeps the pipe claimed. deliveries counts tries so far, this one included.
+// Documents the output reports as failed are the only ones retried, until the pipe is claimed by another run which conveys it whole.
+// Once the buffer conveyances are cancelled, the pipe is left pending for the next start.
+func (b *redisBuffer) conveyStreamPipe(pipe redisStreamPipe, outputName string, cons output.Interface, deliveries int) {
+	defer b.conveying.Done()
+	var (
+		collectionName = b.collection().Name
+		pipeKey        = fmt.Sprintf("%s.%s", b.pipeKeyPrefix, pipe.id)
+		stateKey       = redisStreamStateKey(pipe.entryID, outputName)
+		state          = b.pipes.track(stateKey)
+		logger         = b.logger.With("pipe", pipeKey, "output", outputName)
+		dieAt          = pipe.expiresAt()
+		lastErr        error
+	)
+	defer b.pipes.untrack(stateKey, state)
+	stored, err := getRedisPipeDocuments(b.redis, b.keyring, pipeKey)
+	if err != nil {
+		logger.Error("pipe documents read failed", "error", err)
+		return
+	}
+	b.verify(stored, pipe.checksum, b.deadLetters, b.collection().Name, pipe.startedAt, []string{outputName}, logger)
+	documents := stored.documents
+	if len(documents) == 0 {
+		b.ackStreamPipe(pipe, pipeKey, outputName, logger)
+		return
+	}
+	if routed := b.collection().Route(documents, []string{outputName}); routed != nil {
+		documents = routed[outputName]
+	}
+	if len(documents) == 0 {
+		b.ackStreamPipe(pipe, pipeKey, outputName, logger)
+		return
+	}
+	// a previous try delivered the pipe but stopped before acknowledging it
+	delivered, err := redisPipeDelivered(b.redis, pipeKey, outputName)
+	if err != nil {
+		logger.Error("pipe delivery read failed", "error", err)
+	}
+	if delivered {
+		b.ackStreamPipe(pipe, pipeKey, outputName, logger)
+		return
+	}
+	span := startConveySpan(trace.Parse(pipe.traceparent), collectionName, documents)
+	span.SetAttributes(trace.String("bulklog.pipe", pipeKey), trace.String("bulklog.output", outputName))
+	defer span.End()
+	ctx := trace.ContextWith(collection.WithPriority(b.ctx, b.collection().Priority), span.Context())
+	for {
+		if time.Now().After(dieAt) {
+			break
+		}
+		latestTryAt := time.Now().UTC()
+		lastErr = digest(ctx, pipe.id, outputName, cons, documents, deliveries, pipe.backoff.TryTimeout())
+		if ctx.Err() != nil {
+			return
+		}
+		if lastErr != nil {
+			logger.Warn("digest failed", "error", lastErr)
+			retry, rejected, reason := splitRejected(documents, lastErr)
+			if len(rejected) > 0 {
+				deadLetter(b.deadLetters, collectionName, pipe.startedAt, map[string]error{outputName: reason}, rejected, logger)
+			}
+			documents = retry
+		}
+		if lastErr == nil || len(documents) == 0 {
+			err = setRedisPipeDelivered(b.redis, pipeKey, outputName)
+			if err != nil {
+				logger.Error("pipe delivery write failed", "error", err)
+			}
+			b.ackStreamPipe(pipe, pipeKey, outputName, logger)
+			return
+		}
+		err = addRedisPipeAttempt(b.redis, pipeKey, outputName, latestTryAt, lastErr)
+		if err != nil {
+			logger.Error("pipe attempt write failed", "error", err)
+		}
+		nextRetryAt := retryAt(latestTryAt.Add(pipe.backoff.Interval(deliveries-1)), lastErr)
+		interval := nextRetryAt.Sub(latestTryAt)
+		if nextRetryAt.After(dieAt) {
+			break
+		}
+		// retries later than the backoff tells are persisted, so that instances claiming the pipe wait as well
+		if !retry.At(lastErr).IsZero() {
+			err = setRedisPipeNextRetryAt(b.redis, pipeKey, outputName, nextRetryAt)
+			if err != nil {
+				logger.Error("pipe next retry write failed", "error", err)
+			}
+		}
+		b.expiry.failed(collectionName, pipe.id, outputName, len(documents), pipe.startedAt, dieAt, latestTryAt, nextRetryAt, lastErr, logger)
+		state.wait(ctx, time.Until(nextRetryAt))
+		if state.isDiscarded() || ctx.Err() != nil {
+			return
+		}
+		// claiming fails if the pipe was discarded, or claimed by another instance meanwhile
+		claimedPipe, claimed, err := claimRedisStreamPipe(b.redis, b.streamKey, outputName, b.consumer, pipe.entryID, interval)
+		if err != nil {
+			// left pending, it is claimed again by the next polls
+			logger.Error("pipe claim failed", "error", err)
+			return
+		}
+		if !claimed || claimedPipe.id == "" {
+			return
+		}
+		deliveries++
+	}
+	span.SetAttributes(trace.Int("bulklog.outputs.failed", 1))
+	deadLetterPending(b.deadLetters, b.expiry, collectionName, pipe.id, pipe.startedAt, dieAt, map[string]error{outputName: lastErr}, documents, nil, logger)
+	b.ackStreamPipe(pipe, pipeKey, outputName, logger)
+}
+
+func (b *redisBuffer) ackStreamPipe(pipe redisStreamPipe, pipeKey, outputName string, logger *slog.Logger) {
+	_, err := ackRedisStreamPipe(b.redis, b.streamKey, pipeKey, pipe.entryID, outputName, b.outputs())
+	if err != nil {
+		logger.Error("pipe ack failed", "error", err)
+	}
+}
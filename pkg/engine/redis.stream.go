@@ -0,0 +1,423 @@
+package engine
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/khezen/bulklog/pkg/collection"
+	"github.com/khezen/bulklog/pkg/output"
+)
+
+// Pipes are entries of a stream per collection, {pipeKeyPrefix}.stream, and their documents a list, {pipeKey}.buffer.
+// Each output reads the stream through its own consumer group, so outputs are conveyed by any instance independently:
+// the pending entries of a group are the pipes its output did not digest yet, their delivery count the tries so far.
+// Pipes are deleted once every output acknowledged them.
+
+// redisStreamPipe - pipe as stored in a stream entry
+type redisStreamPipe struct {
+	entryID         string
+	id              string
+	startedAt       time.Time
+	backoff         collection.Backoff
+	retentionPeriod time.Duration
+	traceparent     string
+	// checksum of the documents buffered, nil if the buffer was filled before checksums were kept
+	checksum *pipeChecksum
+}
+
+// expiresAt - end of the pipe retention period
+func (p redisStreamPipe) expiresAt() time.Time {
+	return p.startedAt.Add(p.retentionPeriod)
+}
+
+// redisStreamPipeFields - fields of the stream entry of a new pipe.
+// expiresAt is derived from startedAt and retentionPeriodNano, for operators reading the stream.
+func redisStreamPipeFields(pipeID string, backoff collection.Backoff, retentionPeriod time.Duration, startedAt time.Time, traceparent string) []interface{} {
+	return []interface{}{
+		"pipe", pipeID,
+		"startedAt", startedAt.Format(time.RFC3339Nano),
+		"expiresAt", startedAt.Add(retentionPeriod).Format(time.RFC3339Nano),
+		"retentionPeriodNano", int64(retentionPeriod),
+		"retryPeriodNano", int64(backoff.Base),
+		"backoffMultiplier", strconv.FormatFloat(backoff.Multiplier, 'g', -1, 64),
+		"backoffMaxIntervalNano", int64(backoff.MaxInterval),
+		"backoffJitter", strconv.FormatFloat(backoff.Jitter, 'g', -1, 64),
+		"tryTimeoutNano", int64(backoff.Timeout),
+		"traceparent", traceparent,
+	}
+}
+
+// parseRedisStreamPipes parses the [[id, [field, value...]]...] entries replied by XRANGE and XCLAIM.
+// Entries deleted since they were delivered have no fields, they are parsed as pipes without ID.
+func parseRedisStreamPipes(reply interface{}, err error) ([]redisStreamPipe, error) {
+	entries, err := redis.Values(reply, err)
+	if err != nil {
+		return nil, err
+	}
+	pipes := make([]redisStreamPipe, 0, len(entries))
+	for _, entryI := range entries {
+		entry, err := redis.Values(entryI, nil)
+		if err != nil {
+			return nil, err
+		}
+		if len(entry) < 2 {
+			continue
+		}
+		entryID, err := redis.String(entry[0], nil)
+		if err != nil {
+			return nil, err
+		}
+		if entry[1] == nil {
+			pipes = append(pipes, redisStreamPipe{entryID: entryID})
+			continue
+		}
+		fields, err := redis.StringMap(entry[1], nil)
+		if err != nil {
+			return nil, err
+		}
+		pipe, err := parseRedisStreamPipe(entryID, fields)
+		if err != nil {
+			return nil, err
+		}
+		pipes = append(pipes, pipe)
+	}
+	return pipes, nil
+}
+
+func parseRedisStreamPipe(entryID string, fields map[string]string) (pipe redisStreamPipe, err error) {
+	pipe.entryID = entryID
+	pipe.id = fields["pipe"]
+	pipe.traceparent = fields["traceparent"]
+	pipe.startedAt, err = time.Parse(time.RFC3339Nano, fields["startedAt"])
+	if err != nil {
+		return pipe, fmt.Errorf("parseStartedAtStr.%s", err)
+	}
+	retentionPeriodInt, err := strconv.ParseInt(fields["retentionPeriodNano"], 10, 64)
+	if err != nil {
+		return pipe, fmt.Errorf("retentionPeriodParseInt.%s", err)
+	}
+	pipe.retentionPeriod = time.Duration(retentionPeriodInt)
+	retryPeriodInt, err := strconv.ParseInt(fields["retryPeriodNano"], 10, 64)
+	if err != nil {
+		return pipe, fmt.Errorf("retryPeriodParseInt.%s", err)
+	}
+	pipe.backoff.Base = time.Duration(retryPeriodInt)
+	pipe.backoff.Multiplier, err = strconv.ParseFloat(fields["backoffMultiplier"], 64)
+	if err != nil {
+		return pipe, fmt.Errorf("backoffMultiplierParseFloat.%s", err)
+	}
+	maxIntervalInt, err := strconv.ParseInt(fields["backoffMaxIntervalNano"], 10, 64)
+	if err != nil {
+		return pipe, fmt.Errorf("backoffMaxIntervalParseInt.%s", err)
+	}
+	pipe.backoff.MaxInterval = time.Duration(maxIntervalInt)
+	pipe.backoff.Jitter, err = strconv.ParseFloat(fields["backoffJitter"], 64)
+	if err != nil {
+		return pipe, fmt.Errorf("backoffJitterParseFloat.%s", err)
+	}
+	// pipes flushed before tries were bounded have no timeout, they get the default one
+	if tryTimeoutStr, ok := fields["tryTimeoutNano"]; ok {
+		tryTimeoutInt, err := strconv.ParseInt(tryTimeoutStr, 10, 64)
+		if err != nil {
+			return pipe, fmt.Errorf("tryTimeoutParseInt.%s", err)
+		}
+		pipe.backoff.Timeout = time.Duration(tryTimeoutInt)
+	}
+	// pipes flushed from a buffer filled before checksums were kept are not verified
+	if checksumStr, ok := fields["checksum"]; ok {
+		checksum, err := parsePipeChecksum(checksumStr)
+		if err != nil {
+			return pipe, fmt.Errorf("parsePipeChecksum.%s", err)
+		}
+		pipe.checksum = &checksum
+	}
+	return pipe, nil
+}
+
+// getRedisStreamPipe returns the pipe of the given entry, exists is false if it was deleted
+func getRedisStreamPipe(red *redis.Pool, streamKey, entryID string) (pipe redisStreamPipe, exists bool, err error) {
+	conn := red.Get()
+	defer conn.Close()
+	pipes, err := parseRedisStreamPipes(conn.Do("XRANGE", streamKey, entryID, entryID))
+	if err != nil {
+		return pipe, false, fmt.Errorf("(XRANGE streamKey entryID entryID).%s", err)
+	}
+	if len(pipes) == 0 {
+		return pipe, false, nil
+	}
+	return pipes[0], true, nil
+}
+
+// listRedisStreamPipes returns every pipe of the stream, oldest first
+func listRedisStreamPipes(red *redis.Pool, streamKey string) ([]redisStreamPipe, error) {
+	conn := red.Get()
+	defer conn.Close()
+	pipes, err := parseRedisStreamPipes(conn.Do("XRANGE", streamKey, "-", "+"))
+	if err != nil {
+		return nil, fmt.Errorf("(XRANGE streamKey - +).%s", err)
+	}
+	return pipes, nil
+}
+
+// findRedisStreamPipe returns the pipe with the given ID, exists is false if there is none
+func findRedisStreamPipe(red *redis.Pool, streamKey, pipeID string) (pipe redisStreamPipe, exists bool, err error) {
+	pipes, err := listRedisStreamPipes(red, streamKey)
+	if err != nil {
+		return pipe, false, err
+	}
+	for _, pipe = range pipes {
+		if pipe.id == pipeID {
+			return pipe, true, nil
+		}
+	}
+	return pipe, false, nil
+}
+
+// createRedisStreamGroups creates the consumer groups of outputs which have none.
+// Groups start at the end of the stream, outputs are only conveyed pipes flushed once they are configured.
+func createRedisStreamGroups(red *redis.Pool, streamKey string, outputs map[string]output.Interface) error {
+	conn := red.Get()
+	defer conn.Close()
+	for outputName := range outputs {
+		_, err := conn.Do("XGROUP", "CREATE", streamKey, outputName, "$", "MKSTREAM")
+		if redisErr, ok := err.(redis.Error); ok && strings.HasPrefix(string(redisErr), "BUSYGROUP") {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("(XGROUP CREATE streamKey %s $ MKSTREAM).%s", outputName, err)
+		}
+	}
+	return nil
+}
+
+// readRedisStreamPipes delivers to consumer the pipes the output group was never delivered
+func readRedisStreamPipes(red *redis.Pool, streamKey, outputName, consumer string) ([]redisStreamPipe, error) {
+	conn := red.Get()
+	defer conn.Close()
+	reply, err := conn.Do("XREADGROUP", "GROUP", outputName, consumer, "COUNT", redisStreamReadCount, "STREAMS", streamKey, ">")
+	if err != nil {
+		return nil, fmt.Errorf("(XREADGROUP GROUP %s consumer STREAMS streamKey >).%s", outputName, err)
+	}
+	if reply == nil {
+		return nil, nil
+	}
+	streams, err := redis.Values(reply, nil)
+	if err != nil || len(streams) == 0 {
+		return nil, fmt.Errorf("(XREADGROUP GROUP %s consumer STREAMS streamKey >).%s", outputName, redis.ErrNil)
+	}
+	stream, err := redis.Values(streams[0], nil)
+	if err != nil || len(stream) != 2 {
+		return nil, fmt.Errorf("(XREADGROUP GROUP %s consumer STREAMS streamKey >).%s", outputName, redis.ErrNil)
+	}
+	return parseRedisStreamPipes(stream[1], nil)
+}
+
+// redisStreamPending - pending entry of an output group
+type redisStreamPending struct {
+	entryID    string
+	consumer   string
+	idle       time.Duration
+	deliveries int
+}
+
+// pendingRedisStreamPipes lists the pipes delivered to the output group and not acknowledged yet.
+// start and end bound the listed entry IDs, - and + for all of them.
+func pendingRedisStreamPipes(red *redis.Pool, streamKey, outputName, start, end string) ([]redisStreamPending, error) {
+	conn := red.Get()
+	defer conn.Close()
+	entries, err := redis.Values(conn.Do("XPENDING", streamKey, outputName, start, end, redisStreamPendingCount))
+	if err != nil {
+		return nil, fmt.Errorf("(XPENDING streamKey %s start end count).%s", outputName, err)
+	}
+	pending := make([]redisStreamPending, 0, len(entries))
+	for _, entryI := range entries {
+		var (
+			entry  redisStreamPending
+			idleMs int64
+		)
+		fields, err := redis.Values(entryI, nil)
+		if err == nil {
+			_, err = redis.Scan(fields, &entry.entryID, &entry.consumer, &idleMs, &entry.deliveries)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("(XPENDING streamKey %s start end count).%s", outputName, err)
+		}
+		entry.idle = time.Duration(idleMs) * time.Millisecond
+		pending = append(pending, entry)
+	}
+	return pending, nil
+}
+
+// claimRedisStreamPipe delivers a pending pipe to consumer if it stayed idle for at least minIdle,
+// which fails if someone else claimed it in between. claimed is false if it was not delivered.
+func claimRedisStreamPipe(red *redis.Pool, streamKey, outputName, consumer, entryID string, minIdle time.Duration) (pipe redisStreamPipe, claimed bool, err error) {
+	conn := red.Get()
+	defer conn.Close()
+	pipes, err := parseRedisStreamPipes(conn.Do("XCLAIM", streamKey, outputName, consumer, int64(minIdle/time.Millisecond), entryID))
+	if err != nil {
+		return pipe, false, fmt.Errorf("(XCLAIM streamKey %s consumer minIdle entryID).%s", outputName, err)
+	}
+	if len(pipes) == 0 {
+		return pipe, false, nil
+	}
+	return pipes[0], true, nil
+}
+
+// rewindRedisStreamPipe makes a pending pipe claimable right away, its owner and delivery count are left untouched
+func rewindRedisStreamPipe(red *redis.Pool, streamKey, outputName string, pending redisStreamPending, idle time.Duration) error {
+	conn := red.Get()
+	defer conn.Close()
+	_, err := conn.Do("XCLAIM", streamKey, outputName, pending.consumer, 0, pending.entryID, "IDLE", int64(idle/time.Millisecond), "JUSTID")
+	if err != nil {
+		return fmt.Errorf("(XCLAIM streamKey %s consumer 0 entryID IDLE idle JUSTID).%s", outputName, err)
+	}
+	return nil
+}
+
+// redisStreamAckScript acknowledges the entry ARGV[1] of stream KEYS[1] for the group ARGV[2],
+// then deletes it with its documents list KEYS[2], deliveries hash KEYS[3] and attempts hash KEYS[4] if no group among ARGV[3:] still has to convey it.
+// Groups which were never delivered the entry still have to. It returns 1 if the pipe was deleted.
+var redisStreamAckScript = redis.NewScript(4, `
+redis.call("XACK", KEYS[1], ARGV[2], ARGV[1])
+local function before(a, b)
+	local ams, aseq = string.match(a, "(%d+)-(%d+)")
+	local bms, bseq = string.match(b, "(%d+)-(%d+)")
+	if tonumber(ams) ~= tonumber(bms) then
+		return tonumber(ams) < tonumber(bms)
+	end
+	return tonumber(aseq) < tonumber(bseq)
+end
+local lastDelivered = {}
+for _, group in ipairs(redis.call("XINFO", "GROUPS", KEYS[1])) do
+	local info = {}
+	for i = 1, #group, 2 do
+		info[group[i]] = group[i + 1]
+	end
+	lastDelivered[info["name"]] = info["last-delivered-id"]
+end
+for i = 3, #ARGV do
+	local last = lastDelivered[ARGV[i]]
+	if last then
+		if before(last, ARGV[1]) then
+			return 0
+		end
+		if #redis.call("XPENDING", KEYS[1], ARGV[i], ARGV[1], ARGV[1], 1) > 0 then
+			return 0
+		end
+	end
+end
+redis.call("XDEL", KEYS[1], ARGV[1])
+redis.call("DEL", KEYS[2], KEYS[3], KEYS[4])
+return 1
+`)
+
+// ackRedisStreamPipe acknowledges a pipe for an output, deleting it once the other outputs are done with it
+func ackRedisStreamPipe(red *redis.Pool, streamKey, pipeKey, entryID, outputName string, outputs map[string]output.Interface) (deleted bool, err error) {
+	args := make([]interface{}, 0, len(outputs)+6)
+	args = append(args, streamKey, fmt.Sprintf("%s.buffer", pipeKey), fmt.Sprintf("%s.deliveries", pipeKey), fmt.Sprintf("%s.attempts", pipeKey), entryID, outputName)
+	for name := range outputs {
+		args = append(args, name)
+	}
+	conn := red.Get()
+	defer conn.Close()
+	deleted, err = redis.Bool(redisStreamAckScript.Do(conn, args...))
+	if err != nil {
+		return false, fmt.Errorf("redisStreamAckScript.%s", err)
+	}
+	return deleted, nil
+}
+
+// ackRedisStreamEntry acknowledges an entry for an output without checking whether other outputs are done with it
+func ackRedisStreamEntry(red *redis.Pool, streamKey, outputName, entryID string) error {
+	conn := red.Get()
+	defer conn.Close()
+	_, err := conn.Do("XACK", streamKey, outputName, entryID)
+	if err != nil {
+		return fmt.Errorf("(XACK streamKey %s entryID).%s", outputName, err)
+	}
+	return nil
+}
+
+// redisStreamGroups returns the last entry ID delivered to each group of the stream
+func redisStreamGroups(red *redis.Pool, streamKey string) (map[string]string, error) {
+	conn := red.Get()
+	defer conn.Close()
+	groups, err := redis.Values(conn.Do("XINFO", "GROUPS", streamKey))
+	if redisErr, ok := err.(redis.Error); ok && strings.HasPrefix(string(redisErr), "ERR no such key") {
+		return map[string]string{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("(XINFO GROUPS streamKey).%s", err)
+	}
+	lastDelivered := make(map[string]string, len(groups))
+	for _, groupI := range groups {
+		fields, err := redis.Values(groupI, nil)
+		if err != nil {
+			return nil, fmt.Errorf("(XINFO GROUPS streamKey).%s", err)
+		}
+		// group info mixes strings and integers, only strings are needed
+		info := make(map[string]string, len(fields)/2)
+		for i := 0; i+1 < len(fields); i += 2 {
+			key, _ := redis.String(fields[i], nil)
+			value, _ := redis.String(fields[i+1], nil)
+			info[key] = value
+		}
+		lastDelivered[info["name"]] = info["last-delivered-id"]
+	}
+	return lastDelivered, nil
+}
+
+// redisStreamIDBefore tells whether the stream entry ID a, formatted as {ms}-{seq}, is lower than b
+func redisStreamIDBefore(a, b string) bool {
+	var aMs, aSeq, bMs, bSeq uint64
+	fmt.Sscanf(a, "%d-%d", &aMs, &aSeq)
+	fmt.Sscanf(b, "%d-%d", &bMs, &bSeq)
+	if aMs != bMs {
+		return aMs < bMs
+	}
+	return aSeq < bSeq
+}
+
+// deleteRedisStreamPipe deletes a pipe and its documents, acknowledging it for every output so none retries it
+func deleteRedisStreamPipe(red *redis.Pool, streamKey, pipeKey, entryID string, outputs map[string]output.Interface) (err error) {
+	conn := red.Get()
+	defer conn.Close()
+	err = conn.Send("MULTI")
+	if err != nil {
+		return fmt.Errorf("MULTI.%s", err)
+	}
+	for outputName := range outputs {
+		err = conn.Send("XACK", streamKey, outputName, entryID)
+		if err != nil {
+			return fmt.Errorf("(XACK streamKey %s entryID).%s", outputName, err)
+		}
+	}
+	err = conn.Send("XDEL", streamKey, entryID)
+	if err != nil {
+		return fmt.Errorf("(XDEL streamKey entryID).%s", err)
+	}
+	err = deleteRedisPipeDocuments(conn, pipeKey)
+	if err != nil {
+		return fmt.Errorf("deleteRedisPipeDocuments.%s", err)
+	}
+	err = deleteRedisPipeDeliveries(conn, pipeKey)
+	if err != nil {
+		return fmt.Errorf("deleteRedisPipeDeliveries.%s", err)
+	}
+	err = deleteRedisPipeAttempts(conn, pipeKey)
+	if err != nil {
+		return fmt.Errorf("deleteRedisPipeAttempts.%s", err)
+	}
+	err = deleteRedisPipeIterations(conn, pipeKey)
+	if err != nil {
+		return fmt.Errorf("deleteRedisPipeIterations.%s", err)
+	}
+	_, err = conn.Do("EXEC")
+	if err != nil {
+		return fmt.Errorf("EXEC.%s", err)
+	}
+	return nil
+}
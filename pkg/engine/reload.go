@@ -0,0 +1,229 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/khezen/bulklog/pkg/collection"
+	"github.com/khezen/bulklog/pkg/config"
+	"github.com/khezen/bulklog/pkg/output"
+)
+
+// bufferSettings - collection and outputs documents are flushed with
+type bufferSettings struct {
+	collection *collection.Collection
+	outputs    map[string]output.Interface
+}
+
+// reloadable holds the settings of a buffer, swapped as a whole on reload.
+// Documents flushed after a reload are conveyed with the new settings,
+// pipes flushed before keep the outputs they were flushed with.
+type reloadable struct {
+	current    atomic.Pointer[bufferSettings]
+	reloadOnce sync.Once
+	reload     chan struct{}
+}
+
+func (r *reloadable) collection() *collection.Collection {
+	return r.current.Load().collection
+}
+
+func (r *reloadable) outputs() map[string]output.Interface {
+	return r.current.Load().outputs
+}
+
+func (r *reloadable) apply(collec *collection.Collection, outputs map[string]output.Interface) {
+	r.current.Store(&bufferSettings{collec, outputs})
+}
+
+// reloaded is signaled on reload so the flusher picks up the new flush period
+func (r *reloadable) reloaded() chan struct{} {
+	r.reloadOnce.Do(func() {
+		r.reload = make(chan struct{}, 1)
+	})
+	return r.reload
+}
+
+// Reload applies collection settings and outputs to documents flushed from now on
+func (r *reloadable) Reload(collec *collection.Collection, outputs map[string]output.Interface) error {
+	r.apply(collec, outputs)
+	select {
+	case r.reloaded() <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// flushTicker ticks every flush period, it never ticks if the period is not positive
+type flushTicker struct {
+	ticker *time.Ticker
+	C      <-chan time.Time
+}
+
+func newFlushTicker(period time.Duration) *flushTicker {
+	if period <= 0 {
+		return &flushTicker{}
+	}
+	ticker := time.NewTicker(period)
+	return &flushTicker{ticker, ticker.C}
+}
+
+func (t *flushTicker) Stop() {
+	if t.ticker != nil {
+		t.ticker.Stop()
+	}
+}
+
+// Reload applies collections and outputs of cfg without losing buffered documents.
+// New collections get a buffer, changed ones are reloaded in place
+// and buffers of removed ones are drained in the background.
+// Persistence, dead letter and pipe expiry changes require a restart.
+func (e *engine) Reload(cfg *config.Config) error {
+	e.reloading.Lock()
+	defer e.reloading.Unlock()
+	var (
+		outputs        = e.outputs
+		outputsChanged = !reflect.DeepEqual(e.outputsCfg, cfg.Output)
+		err            error
+	)
+	if outputsChanged {
+		outputs, err = output.NewOutputs(&cfg.Output)
+		if err != nil {
+			return fmt.Errorf("output.NewOutputs.%s", err)
+		}
+		outputs = output.NewGates(outputs, e.pauses.deliveries)
+	}
+	if !reflect.DeepEqual(e.deadLetterCfg, cfg.DeadLetter) {
+		e.logger.Warn("dead letter changes require a restart")
+	}
+	if !reflect.DeepEqual(e.pipeExpiryCfg, cfg.PipeExpiry) {
+		e.logger.Warn("pipe expiry changes require a restart")
+	}
+	type change struct {
+		collection  *collection.Collection
+		config      collection.Config
+		buffer      Buffer
+		persistence config.Persistence
+	}
+	var (
+		collecCfgs, autoCreated, tenantCollections = e.collectionConfigs(cfg)
+		added                                      = make([]change, 0)
+		reloaded                                   = make([]change, 0)
+		kept                                       = make(map[collection.Name]struct{}, len(collecCfgs))
+	)
+	closeAdded := func() {
+		for _, c := range added {
+			c.buffer.Close()
+		}
+	}
+	for _, collecCfg := range collecCfgs {
+		name := collecCfg.Name
+		kept[name] = struct{}{}
+		currentCfg, exists := e.collectionsCfg[name]
+		if exists && !outputsChanged && reflect.DeepEqual(currentCfg, collecCfg) {
+			continue
+		}
+		collec, err := newCollection(collecCfg, outputs)
+		if err != nil {
+			closeAdded()
+			return fmt.Errorf("newCollection(%s).%s", name, err)
+		}
+		persistenceName := name
+		if owner, ok := tenantCollections[name]; ok {
+			persistenceName = owner.base
+		}
+		persistence := cfg.Persistence.Of(persistenceName)
+		if exists {
+			if !reflect.DeepEqual(e.persistence[name], persistence) {
+				e.logger.Warn("persistence changes require a restart", "collection", name)
+			}
+			reloaded = append(reloaded, change{collection: collec, config: collecCfg})
+			continue
+		}
+		buffer, err := newBuffer(collec, persistence, e.keyring, outputs, e.deadLetters, e.expiry, e.logger.With("collection", collec.Name))
+		if err != nil {
+			closeAdded()
+			return fmt.Errorf("newBuffer(%s).%s", collec.Name, err)
+		}
+		added = append(added, change{collec, collecCfg, buffer, persistence})
+	}
+	// buffers are reloaded first so a rejected change leaves its collection as it was
+	var firstErr error
+	applied := reloaded[:0]
+	for _, c := range reloaded {
+		err = e.buffers[c.collection.Name].Reload(c.collection, outputs)
+		if err != nil {
+			e.logger.Error("collection reload failed", "collection", c.collection.Name, "error", err)
+			if firstErr == nil {
+				firstErr = fmt.Errorf("Reload(%s).%s", c.collection.Name, err)
+			}
+			continue
+		}
+		applied = append(applied, c)
+	}
+	var (
+		schemas     = make(map[collection.Name]map[collection.SchemaName]struct{}, len(kept))
+		buffers     = make(map[collection.Name]Buffer, len(kept))
+		collections = make(map[collection.Name]*collection.Collection, len(kept))
+		dedups      = make(map[collection.Name]deduplicator, len(kept))
+		removed     = make(map[collection.Name]Buffer)
+	)
+	for name, buffer := range e.buffers {
+		if _, ok := kept[name]; !ok {
+			removed[name] = buffer
+			delete(e.collectionsCfg, name)
+			delete(e.persistence, name)
+			continue
+		}
+		schemas[name] = e.schemas[name]
+		buffers[name] = buffer
+		dedups[name] = e.dedups[name]
+		collections[name] = e.collections[name]
+	}
+	for _, c := range applied {
+		schemas[c.collection.Name] = schemaNames(c.collection)
+		collections[c.collection.Name] = c.collection
+		e.collectionsCfg[c.collection.Name] = c.config
+	}
+	for _, c := range added {
+		schemas[c.collection.Name] = schemaNames(c.collection)
+		collections[c.collection.Name] = c.collection
+		buffers[c.collection.Name] = c.buffer
+		dedups[c.collection.Name] = newDeduplicator(c.collection, c.persistence)
+		e.collectionsCfg[c.collection.Name] = c.config
+		e.persistence[c.collection.Name] = c.persistence
+	}
+	// waits for appends in progress, so removed buffers get no more documents once drained
+	e.Lock()
+	e.schemas, e.buffers, e.collections, e.dedups, e.outputs = schemas, buffers, collections, dedups, outputs
+	e.autoCreate = cfg.AutoCreate
+	e.autoCreated = autoCreated
+	e.tenantCollections = tenantCollections
+	e.tenancy = cfg.Tenancy
+	e.Unlock()
+	e.tenants.Reload(cfg.Tenancy)
+	e.outputsCfg = cfg.Output
+	for _, c := range added {
+		go c.buffer.Flusher()()
+		e.logger.Info("collection added", "collection", c.collection.Name)
+	}
+	for _, c := range applied {
+		e.logger.Info("collection reloaded", "collection", c.collection.Name)
+	}
+	for name, buffer := range removed {
+		e.logger.Info("collection removed", "collection", name)
+		e.draining.Add(1)
+		go func(name collection.Name, buffer Buffer) {
+			defer e.draining.Done()
+			err := buffer.Shutdown(context.Background())
+			if err != nil {
+				e.logger.Error("removed collection drain failed", "collection", name, "error", err)
+			}
+		}(name, buffer)
+	}
+	return firstErr
+}
@@ -0,0 +1,159 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"time"
+
+	"github.com/khezen/bulklog/pkg/collection"
+	"github.com/khezen/bulklog/pkg/output"
+)
+
+// replayListTimeout bounds the listing of archived objects, made while the replay is requested
+const replayListTimeout = time.Minute
+
+// ReplayRequest - documents to replay, posted between From and To, and the outputs to replay them to
+type ReplayRequest struct {
+	From time.Time `json:"from"`
+	// To defaults to now
+	To time.Time `json:"to"`
+	// Source - output to read the archive from, the only archiving output by default
+	Source string `json:"source"`
+	// Outputs default to every output but the archiving ones
+	Outputs []string `json:"outputs"`
+}
+
+// Replay - replay in progress
+type Replay struct {
+	Source  string    `json:"source"`
+	Outputs []string  `json:"outputs"`
+	From    time.Time `json:"from"`
+	To      time.Time `json:"to"`
+	// Objects - archived objects to read
+	Objects int `json:"objects"`
+}
+
+// Replay lists the objects a collection archived between from and to, then conveys their documents
+// to the requested outputs in the background, one object at a time.
+// Documents are conveyed as a new pipe would be: outputs which do not digest them before retention ends dead letter them.
+func (e *engine) Replay(collectionName collection.Name, request ReplayRequest) (Replay, error) {
+	e.RLock()
+	collec, ok := e.collections[collectionName]
+	currentOutputs := e.outputs
+	e.RUnlock()
+	if !ok {
+		return Replay{}, ErrNotFound
+	}
+	if request.To.IsZero() {
+		request.To = time.Now().UTC()
+	}
+	if !request.From.Before(request.To) {
+		return Replay{}, ErrWrongReplay
+	}
+	source, archiver, err := replaySource(currentOutputs, request.Source)
+	if err != nil {
+		return Replay{}, err
+	}
+	outputs, err := replayOutputs(currentOutputs, source, request.Outputs)
+	if err != nil {
+		return Replay{}, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), replayListTimeout)
+	keys, err := archiver.Archived(ctx, collectionName, request.From, request.To)
+	cancel()
+	if err != nil {
+		return Replay{}, fmt.Errorf("Archived.%s", err)
+	}
+	replay := Replay{
+		Source:  source,
+		Outputs: make([]string, 0, len(outputs)),
+		From:    request.From.UTC(),
+		To:      request.To.UTC(),
+		Objects: len(keys),
+	}
+	for outputName := range outputs {
+		replay.Outputs = append(replay.Outputs, outputName)
+	}
+	sort.Strings(replay.Outputs)
+	logger := e.logger.With("collection", collectionName, "replay", source)
+	logger.Info("replay started", "objects", len(keys), "outputs", replay.Outputs, "from", replay.From, "to", replay.To)
+	go replayArchive(archiver, keys, replay, outputs, collec, e.deadLetters, e.expiry, logger)
+	return replay, nil
+}
+
+// replaySource returns the output named source, or the only archiving one if source is empty
+func replaySource(outputs map[string]output.Interface, source string) (string, output.Archiver, error) {
+	if source != "" {
+		archiver, ok := output.Unwrap(outputs[source]).(output.Archiver)
+		if !ok {
+			return "", nil, ErrArchiveNotFound
+		}
+		return source, archiver, nil
+	}
+	var archiver output.Archiver
+	for outputName, cons := range outputs {
+		if candidate, ok := output.Unwrap(cons).(output.Archiver); ok {
+			if archiver != nil {
+				// ambiguous
+				return "", nil, ErrArchiveNotFound
+			}
+			source, archiver = outputName, candidate
+		}
+	}
+	if archiver == nil {
+		return "", nil, ErrArchiveNotFound
+	}
+	return source, archiver, nil
+}
+
+// replayOutputs returns the outputs named, or every output which does not archive documents if none is
+func replayOutputs(outputs map[string]output.Interface, source string, names []string) (map[string]output.Interface, error) {
+	selected := make(map[string]output.Interface)
+	if len(names) == 0 {
+		for outputName, cons := range outputs {
+			if _, ok := output.Unwrap(cons).(output.Archiver); !ok {
+				selected[outputName] = cons
+			}
+		}
+	}
+	for _, outputName := range names {
+		cons, ok := outputs[outputName]
+		if !ok || outputName == source {
+			return nil, ErrWrongReplay
+		}
+		selected[outputName] = cons
+	}
+	if len(selected) == 0 {
+		return nil, ErrWrongReplay
+	}
+	return selected, nil
+}
+
+// replayArchive conveys the documents of each object which were posted during the replay range
+func replayArchive(archiver output.Archiver, keys []string, replay Replay, outputs map[string]output.Interface, collec *collection.Collection, deadLetters DeadLetters, expiry *ExpiryNotifier, logger *slog.Logger) {
+	var documents, failed int
+	for _, key := range keys {
+		ctx, cancel := context.WithTimeout(context.Background(), collec.Backoff.TryTimeout())
+		archived, err := archiver.ArchivedDocuments(ctx, key)
+		cancel()
+		if err != nil {
+			logger.Error("archived object read failed", "object", key, "error", err)
+			failed++
+			continue
+		}
+		replayed := make([]collection.Document, 0, len(archived))
+		for _, doc := range archived {
+			if !doc.PostedAt.Before(replay.From) && doc.PostedAt.Before(replay.To) {
+				replayed = append(replayed, doc)
+			}
+		}
+		if len(replayed) == 0 {
+			continue
+		}
+		documents += len(replayed)
+		convey(context.Background(), replayed, outputs, collec, deadLetters, expiry, logger)
+	}
+	logger.Info("replay done", "objects", len(keys), "failed_objects", failed, "documents", documents)
+}
@@ -0,0 +1,62 @@
+package engine
+
+import (
+	"context"
+
+	"github.com/khezen/bulklog/pkg/collection"
+)
+
+// reroute binds documents, and the copies reroutes of collec make of them, to the collections they are appended to.
+// Collections are resolved as collectionOf does, so they are created if needed and are those of the tenant carried by ctx, if any.
+func (e *engine) reroute(ctx context.Context, collec *collection.Collection, documents []collection.Document) ([]collection.Document, error) {
+	if len(collec.Reroutes) == 0 {
+		return documents, nil
+	}
+	type target struct {
+		collection collection.Name
+		schema     collection.SchemaName
+	}
+	var (
+		rerouted = collec.Reroute(documents)
+		resolved = make(map[target]collection.Name)
+	)
+	for i := range rerouted {
+		doc := &rerouted[i]
+		if doc.CollectionName == collec.Name {
+			continue
+		}
+		t := target{doc.CollectionName, doc.SchemaName}
+		name, ok := resolved[t]
+		if !ok {
+			targetCollec, err := e.collectionOf(ctx, t.collection, t.schema)
+			if err != nil {
+				return nil, err
+			}
+			name = targetCollec.Name
+			resolved[t] = name
+		}
+		doc.CollectionName = name
+	}
+	return rerouted, nil
+}
+
+// dispatchRerouted appends documents to the buffers of their collections, a batch per collection
+func (e *engine) dispatchRerouted(documents []collection.Document) error {
+	var (
+		order   = make([]collection.Name, 0, 1)
+		batches = make(map[collection.Name][]collection.Document, 1)
+	)
+	for _, doc := range documents {
+		if _, ok := batches[doc.CollectionName]; !ok {
+			order = append(order, doc.CollectionName)
+		}
+		batches[doc.CollectionName] = append(batches[doc.CollectionName], doc)
+	}
+	for _, name := range order {
+		err := e.DispatchBatch(batches[name]...)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
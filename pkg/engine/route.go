@@ -0,0 +1,36 @@
+package engine
+
+import (
+	"github.com/khezen/bulklog/pkg/collection"
+	"github.com/khezen/bulklog/pkg/output"
+)
+
+// routePipe returns the outputs documents of a pipe are routed to by the collection routes,
+// along with the documents routed to outputs which are not routed every document.
+// delivered, if not nil, is called for outputs which no document is routed to, they are done with the pipe.
+func routePipe(collec *collection.Collection, documents []collection.Document, outputs map[string]output.Interface, delivered func(outputName string)) (map[string]output.Interface, map[string][]collection.Document) {
+	pending := make(map[string][]collection.Document)
+	outputNames := make([]string, 0, len(outputs))
+	for outputName := range outputs {
+		outputNames = append(outputNames, outputName)
+	}
+	routed := collec.Route(documents, outputNames)
+	if routed == nil {
+		return outputs, pending
+	}
+	routedOutputs := make(map[string]output.Interface, len(outputs))
+	for outputName, cons := range outputs {
+		switch len(routed[outputName]) {
+		case 0:
+			if delivered != nil {
+				delivered(outputName)
+			}
+		case len(documents):
+			routedOutputs[outputName] = cons
+		default:
+			routedOutputs[outputName] = cons
+			pending[outputName] = routed[outputName]
+		}
+	}
+	return routedOutputs, pending
+}
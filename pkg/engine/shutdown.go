@@ -0,0 +1,25 @@
+package engine
+
+import (
+	"context"
+	"sync"
+)
+
+// waitConveying waits for pending conveyances to end, or for ctx to be done.
+// In the latter case cancel, if not nil, cancels the conveyances still pending so they stop delivering.
+func waitConveying(ctx context.Context, conveying *sync.WaitGroup, cancel context.CancelFunc) error {
+	done := make(chan struct{})
+	go func() {
+		conveying.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		if cancel != nil {
+			cancel()
+		}
+		return ctx.Err()
+	}
+}
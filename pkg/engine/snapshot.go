@@ -0,0 +1,203 @@
+package engine
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/khezen/bulklog/pkg/collection"
+	"github.com/khezen/bulklog/pkg/output"
+)
+
+// Snapshot - documents a collection buffers and pipes pending delivery, in a form any engine can restore
+type Snapshot struct {
+	Collection collection.Name    `json:"collection"`
+	TakenAt    time.Time          `json:"taken_at"`
+	Buffer     []BufferedDocument `json:"buffer"`
+	Pipes      []SnapshotPipe     `json:"pipes"`
+}
+
+// SnapshotPipe - pending pipe, along with the outputs which did not digest it yet
+type SnapshotPipe struct {
+	ID        string             `json:"id"`
+	CreatedAt time.Time          `json:"created_at"`
+	Outputs   []string           `json:"outputs"`
+	Documents []BufferedDocument `json:"documents"`
+}
+
+// Restored - documents appended to the buffer and pipes added by a restore
+type Restored struct {
+	Documents int `json:"documents"`
+	Pipes     int `json:"pipes"`
+	// SkippedPipes - pipes which were pending already, such as with a snapshot restored twice
+	SkippedPipes int `json:"skipped_pipes"`
+}
+
+// PipeRestorer is implemented by buffers which can take over pipes of a snapshot
+type PipeRestorer interface {
+	// RestorePipe adds a pipe pending for outputNames and conveys it, created at createdAt as far as retention goes.
+	// It returns false if a pipe of the same ID is pending already.
+	RestorePipe(id string, createdAt time.Time, outputNames []string, documents []collection.Document) (bool, error)
+}
+
+// Snapshot reads the buffer of a collection and, for redis and disk collections, its pending pipes along with their documents.
+// Snapshots leave the collection as is: documents keep being flushed and conveyed meanwhile.
+func (e *engine) Snapshot(collectionName collection.Name) (Snapshot, error) {
+	e.RLock()
+	buffer, ok := e.buffers[collectionName]
+	e.RUnlock()
+	if !ok {
+		return Snapshot{}, ErrNotFound
+	}
+	tailer, ok := buffer.(BufferTailer)
+	if !ok {
+		return Snapshot{}, ErrTailUnsupported
+	}
+	snapshot := Snapshot{
+		Collection: collectionName,
+		TakenAt:    time.Now().UTC(),
+		Pipes:      make([]SnapshotPipe, 0),
+	}
+	documents, err := tailer.Tail(0)
+	if err != nil {
+		return Snapshot{}, fmt.Errorf("Tail.%s", err)
+	}
+	snapshot.Buffer = bufferedDocuments(documents)
+	inspector, ok := buffer.(PipeInspector)
+	if !ok {
+		return snapshot, nil
+	}
+	pipes, err := inspector.Pipes()
+	if err != nil {
+		return Snapshot{}, fmt.Errorf("Pipes.%s", err)
+	}
+	for _, pipe := range pipes {
+		if len(pipe.Outputs) == 0 || pipe.Documents == 0 {
+			continue
+		}
+		documents, _, err := inspector.PipeDocuments(pipe.ID, 0, pipe.Documents)
+		if err == ErrPipeNotFound {
+			// delivered meanwhile
+			continue
+		}
+		if err != nil {
+			return Snapshot{}, fmt.Errorf("PipeDocuments.%s", err)
+		}
+		snapshotPipe := SnapshotPipe{
+			ID:        pipe.ID,
+			CreatedAt: pipe.CreatedAt,
+			Outputs:   make([]string, 0, len(pipe.Outputs)),
+			Documents: bufferedDocuments(documents),
+		}
+		for _, pipeOutput := range pipe.Outputs {
+			snapshotPipe.Outputs = append(snapshotPipe.Outputs, pipeOutput.Name)
+		}
+		snapshot.Pipes = append(snapshot.Pipes, snapshotPipe)
+	}
+	return snapshot, nil
+}
+
+// Restore appends the buffered documents of a snapshot to the buffer of a collection, and adds its pipes pending for the same outputs.
+// The snapshot is checked as a whole first, so that a wrong one is not restored partly.
+func (e *engine) Restore(collectionName collection.Name, snapshot Snapshot) (Restored, error) {
+	e.RLock()
+	buffer, ok := e.buffers[collectionName]
+	currentOutputs := e.outputs
+	e.RUnlock()
+	if !ok {
+		return Restored{}, ErrNotFound
+	}
+	buffered, err := snapshotDocuments(collectionName, snapshot.Buffer)
+	if err != nil {
+		return Restored{}, err
+	}
+	pipes := make([][]collection.Document, 0, len(snapshot.Pipes))
+	for _, pipe := range snapshot.Pipes {
+		documents, err := snapshotDocuments(collectionName, pipe.Documents)
+		if err != nil {
+			return Restored{}, err
+		}
+		err = validateSnapshotPipe(pipe, currentOutputs)
+		if err != nil {
+			return Restored{}, err
+		}
+		pipes = append(pipes, documents)
+	}
+	restorer, ok := buffer.(PipeRestorer)
+	if !ok && len(pipes) > 0 {
+		return Restored{}, ErrPipesUnsupported
+	}
+	var restored Restored
+	for i, pipe := range snapshot.Pipes {
+		if len(pipes[i]) == 0 {
+			continue
+		}
+		added, err := restorer.RestorePipe(pipe.ID, pipe.CreatedAt, pipe.Outputs, pipes[i])
+		if err != nil {
+			return restored, fmt.Errorf("RestorePipe.%s", err)
+		}
+		if added {
+			restored.Pipes++
+		} else {
+			restored.SkippedPipes++
+		}
+	}
+	if len(buffered) > 0 {
+		err = buffer.AppendBatch(buffered...)
+		if err != nil {
+			return restored, err
+		}
+	}
+	restored.Documents = len(buffered)
+	return restored, nil
+}
+
+func validateSnapshotPipe(pipe SnapshotPipe, outputs map[string]output.Interface) error {
+	if _, err := uuid.Parse(pipe.ID); err != nil || pipe.CreatedAt.IsZero() || len(pipe.Outputs) == 0 {
+		return ErrWrongSnapshot
+	}
+	for _, outputName := range pipe.Outputs {
+		if _, ok := outputs[outputName]; !ok {
+			return ErrWrongSnapshot
+		}
+	}
+	return nil
+}
+
+// selectOutputs - outputs among the named ones
+func selectOutputs(outputs map[string]output.Interface, names []string) map[string]output.Interface {
+	selected := make(map[string]output.Interface, len(names))
+	for _, outputName := range names {
+		if cons, ok := outputs[outputName]; ok {
+			selected[outputName] = cons
+		}
+	}
+	return selected
+}
+
+func bufferedDocuments(documents []collection.Document) []BufferedDocument {
+	buffered := make([]BufferedDocument, 0, len(documents))
+	for _, doc := range documents {
+		buffered = append(buffered, BufferedDocument{doc.ID.String(), doc.PostedAt, doc.SchemaName, doc.Body})
+	}
+	return buffered
+}
+
+// snapshotDocuments returns the documents of a snapshot, in collectionName which may differ from the one they were snapshotted from
+func snapshotDocuments(collectionName collection.Name, buffered []BufferedDocument) ([]collection.Document, error) {
+	documents := make([]collection.Document, 0, len(buffered))
+	for _, doc := range buffered {
+		id, err := uuid.Parse(doc.ID)
+		if err != nil || doc.PostedAt.IsZero() || len(doc.Body) == 0 {
+			return nil, ErrWrongSnapshot
+		}
+		documents = append(documents, collection.Document{
+			ID:             id,
+			PostedAt:       doc.PostedAt,
+			CollectionName: collectionName,
+			SchemaName:     doc.Schema,
+			Body:           []byte(doc.Body),
+		})
+	}
+	return documents, nil
+}
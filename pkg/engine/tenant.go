@@ -0,0 +1,141 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/khezen/bulklog/pkg/collection"
+	"github.com/khezen/bulklog/pkg/tenant"
+)
+
+// tenantCollection - tenant a collection belongs to, and the collection its settings derive from
+type tenantCollection struct {
+	tenant string
+	base   collection.Name
+}
+
+// tenantCollectionName - collection of a tenant, prefixed by the tenant ID like its redis keys, files and indices
+func tenantCollectionName(tenantID string, name collection.Name) collection.Name {
+	return collection.Name(fmt.Sprintf("%s.%s", tenantID, name))
+}
+
+// tenantCollectionOf returns the name of the tenant collection deriving from name,
+// the collection is created first if it does not exist yet and name is a collection.
+func (e *engine) tenantCollectionOf(tenantID string, name collection.Name) (collection.Name, error) {
+	tenantName := tenantCollectionName(tenantID, name)
+	e.RLock()
+	_, exists := e.collections[tenantName]
+	e.RUnlock()
+	if !exists {
+		err := e.createTenantCollection(tenantID, name)
+		if err != nil {
+			return "", err
+		}
+	}
+	return tenantName, nil
+}
+
+// createTenantCollection creates the collection of a tenant with the settings and persistence of the collection it derives from,
+// unless it exists already. Tenant collections do not derive from one another.
+// It returns tenant.ErrTooManyTenants if the tenant has no collection yet and max_tenants other tenants have.
+func (e *engine) createTenantCollection(tenantID string, base collection.Name) error {
+	if strings.Contains(string(base), ".") {
+		return nil
+	}
+	name := tenantCollectionName(tenantID, base)
+	e.reloading.Lock()
+	defer e.reloading.Unlock()
+	e.RLock()
+	_, exists := e.collections[name]
+	outputs := e.outputs
+	maxTenants := e.tenancy.MaxTenants
+	tenantCollections := e.tenantCollections
+	e.RUnlock()
+	baseCfg, ok := e.collectionsCfg[base]
+	if exists || !ok {
+		return nil
+	}
+	if maxTenants > 0 && !hasTenant(tenantCollections, tenantID) && countTenants(tenantCollections) >= maxTenants {
+		e.logger.Warn("tenant collection creation refused, max_tenants reached", "collection", name, "tenant", tenantID)
+		return tenant.ErrTooManyTenants
+	}
+	baseCfg.Name = name
+	err := e.addCollection(baseCfg, e.persistence[base], outputs, &tenantCollection{tenantID, base})
+	if err != nil {
+		e.logger.Error("tenant collection creation failed", "collection", name, "tenant", tenantID, "error", err)
+		return nil
+	}
+	e.logger.Info("tenant collection created", "collection", name, "tenant", tenantID)
+	return nil
+}
+
+func hasTenant(tenantCollections map[collection.Name]tenantCollection, tenantID string) bool {
+	for _, owner := range tenantCollections {
+		if owner.tenant == tenantID {
+			return true
+		}
+	}
+	return false
+}
+
+// countTenants - tenants owning collections
+func countTenants(tenantCollections map[collection.Name]tenantCollection) int {
+	tenants := make(map[string]struct{})
+	for _, owner := range tenantCollections {
+		tenants[owner.tenant] = struct{}{}
+	}
+	return len(tenants)
+}
+
+// reserve counts documents against the quotas of the tenant carried by ctx, if any.
+// The bytes buffered by the tenant collections are only read if the tenant has a buffered bytes quota.
+func (e *engine) reserve(ctx context.Context, documents []collection.Document) error {
+	tenantID := tenant.ID(ctx)
+	if tenantID == "" || len(documents) == 0 {
+		return nil
+	}
+	var buffered int64
+	if e.tenants.Quotas(tenantID).BufferedBytes > 0 {
+		buffered = e.tenantBufferedBytes(tenantID)
+	}
+	return e.tenants.Reserve(tenantID, len(documents), documentsBytes(documents), buffered)
+}
+
+// release uncounts documents reserved for the tenant carried by ctx, which could not be buffered
+func (e *engine) release(ctx context.Context, documents []collection.Document) {
+	tenantID := tenant.ID(ctx)
+	if tenantID == "" || len(documents) == 0 {
+		return
+	}
+	e.tenants.Release(tenantID, len(documents), documentsBytes(documents))
+}
+
+// bufferSizer - buffers which tell how many bytes of documents they hold until their next flush
+type bufferSizer interface {
+	bufferedBytes() (int64, error)
+}
+
+// tenantBufferedBytes - bytes held by the buffers of the tenant collections, buffers which cannot tell are not counted
+func (e *engine) tenantBufferedBytes(tenantID string) (bytes int64) {
+	e.RLock()
+	tenantCollections := e.tenantCollections
+	buffers := e.buffers
+	e.RUnlock()
+	for name, owner := range tenantCollections {
+		if owner.tenant != tenantID {
+			continue
+		}
+		sizer, ok := buffers[name].(bufferSizer)
+		if !ok {
+			continue
+		}
+		size, err := sizer.bufferedBytes()
+		if err != nil {
+			e.logger.Error("buffered bytes read failed", "collection", name, "error", err)
+			continue
+		}
+		bytes += size
+	}
+	return bytes
+}
@@ -0,0 +1,47 @@
+package engine
+
+import (
+	"context"
+	"testing"
+
+	"github.com/khezen/bulklog/pkg/collection"
+	"github.com/khezen/bulklog/pkg/config"
+	"github.com/khezen/bulklog/pkg/tenant"
+)
+
+// TestMaxTenants checks tenants beyond max_tenants get no collection, while the ones admitted keep creating theirs
+func TestMaxTenants(t *testing.T) {
+	schemas := map[collection.SchemaName]collection.SchemaConfig{
+		"event": {Fields: map[string]collection.Field{"msg": {Type: collection.String}}},
+	}
+	e, err := New(&config.Config{
+		Collections: []collection.Config{
+			{Name: "logs", FlushPeriodStr: "1 hours", RetentionPeriodStr: "1 hours", SchemasCfg: schemas},
+			{Name: "audit", FlushPeriodStr: "1 hours", RetentionPeriodStr: "1 hours", SchemasCfg: schemas},
+		},
+		Tenancy: tenant.Config{Enabled: true, MaxTenants: 1},
+	}, discardLogger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer e.Shutdown(context.Background())
+	teamA := tenant.WithID(context.Background(), "team-a")
+	err = e.Collect(teamA, "logs", "event", []byte(`{"msg":"a"}`))
+	if err != nil {
+		t.Fatalf("Collect of the first tenant: %s", err)
+	}
+	err = e.Collect(tenant.WithID(context.Background(), "team-b"), "logs", "event", []byte(`{"msg":"b"}`))
+	if err != tenant.ErrTooManyTenants {
+		t.Fatalf("Collect of a tenant beyond max_tenants: got %v, want %v", err, tenant.ErrTooManyTenants)
+	}
+	err = e.Collect(teamA, "audit", "event", []byte(`{"msg":"a"}`))
+	if err != nil {
+		t.Fatalf("Collect of the first tenant to another collection: %s", err)
+	}
+	eng := e.(*engine)
+	eng.RLock()
+	defer eng.RUnlock()
+	if _, ok := eng.collections["team-b.logs"]; ok || len(eng.tenantCollections) != 2 {
+		t.Fatalf("tenant collections %v, want the ones of team-a only", eng.tenantCollections)
+	}
+}
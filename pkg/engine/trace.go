@@ -0,0 +1,103 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"github.com/khezen/bulklog/pkg/collection"
+	"github.com/khezen/bulklog/pkg/output"
+	"github.com/khezen/bulklog/pkg/output/idempotency"
+	"github.com/khezen/bulklog/pkg/trace"
+	"time"
+)
+
+// spans of the document journey:
+// bulklog.append (buffering) <- bulklog.flush (pipe creation) -> bulklog.convey -> bulklog.digest (delivery attempt).
+// Flushes and conveyances gather documents from many requests, so they link to the append spans.
+const (
+	appendSpanName = "bulklog.append"
+	flushSpanName  = "bulklog.flush"
+	conveySpanName = "bulklog.convey"
+	digestSpanName = "bulklog.digest"
+)
+
+// startAppendSpan starts a span child of the trace context documents were posted with
+// and records it in the documents so flushes and conveyances can link to it.
+func startAppendSpan(documents []collection.Document) *trace.Span {
+	if len(documents) == 0 {
+		return nil
+	}
+	span := trace.Start(
+		trace.Parse(documents[0].TraceParent), appendSpanName, trace.KindProducer,
+		trace.String("bulklog.collection", string(documents[0].CollectionName)),
+		trace.Int("bulklog.documents", len(documents)),
+	)
+	if traceParent := span.Context().Traceparent(); traceParent != "" {
+		for i := range documents {
+			documents[i].TraceParent = traceParent
+		}
+	}
+	return span
+}
+
+func startFlushSpan(collectionName collection.Name, documents []collection.Document) *trace.Span {
+	span := trace.Start(
+		trace.SpanContext{}, flushSpanName, trace.KindInternal,
+		trace.String("bulklog.collection", string(collectionName)),
+	)
+	if documents != nil {
+		span.SetAttributes(trace.Int("bulklog.documents", len(documents)))
+		linkDocuments(span, documents)
+	}
+	return span
+}
+
+func startConveySpan(parent trace.SpanContext, collectionName collection.Name, documents []collection.Document) *trace.Span {
+	span := trace.Start(
+		parent, conveySpanName, trace.KindConsumer,
+		trace.String("bulklog.collection", string(collectionName)),
+		trace.Int("bulklog.documents", len(documents)),
+	)
+	linkDocuments(span, documents)
+	return span
+}
+
+// idempotencyKey - key of the delivery of a pipe to an output, the same for every try
+func idempotencyKey(pipeID, outputName string) string {
+	return fmt.Sprintf("%s/%s", pipeID, outputName)
+}
+
+func linkDocuments(span *trace.Span, documents []collection.Document) {
+	if span == nil {
+		return
+	}
+	for i := range documents {
+		span.AddLink(trace.Parse(documents[i].TraceParent))
+	}
+}
+
+// digest delivers documents to an output within a span of the delivery attempt, child of the span ctx carries.
+// The attempt is cancelled once ctx is done or timeout elapses.
+// ctx carries the pipe ID, and the idempotency key of the delivery made of the pipe ID and the output name.
+// The attempt waits beforehand while the output, or the collection, is paused.
+func digest(ctx context.Context, pipeID, outputName string, cons output.Interface, documents []collection.Document, attempt int, timeout time.Duration) error {
+	if gate, ok := cons.(*output.Gate); ok && len(documents) > 0 {
+		err := gate.Await(ctx, documents[0].CollectionName)
+		if err != nil {
+			return err
+		}
+	}
+	key := idempotencyKey(pipeID, outputName)
+	span := trace.Start(
+		trace.FromContext(ctx), digestSpanName, trace.KindClient,
+		trace.String("bulklog.output", outputName),
+		trace.Int("bulklog.attempt", attempt),
+		trace.String("bulklog.idempotency_key", key),
+	)
+	ctx = idempotency.WithPipe(idempotency.WithKey(trace.ContextWith(ctx, span.Context()), key), pipeID)
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	err := cons.Digest(ctx, documents)
+	cancel()
+	span.SetError(err)
+	span.End()
+	return err
+}
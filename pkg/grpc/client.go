@@ -0,0 +1,137 @@
+package grpc
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Client performs unary calls against a single gRPC endpoint
+type Client struct {
+	baseURL string
+	headers map[string]string
+	signer  Signer
+	httpcli http.Client
+}
+
+// Signer signs the requests of calls, such as the signers of package auth
+type Signer interface {
+	Sign(r *http.Request, body []byte) error
+}
+
+type metadataContext struct{}
+
+// WithMetadata returns a copy of ctx whose calls send headers along with the ones of the client, such as routing headers
+func WithMetadata(ctx context.Context, headers map[string]string) context.Context {
+	return context.WithValue(ctx, metadataContext{}, headers)
+}
+
+// NewClient - endpoint is host:port, insecure dials h2c instead of TLS
+func NewClient(endpoint string, insecure bool, tlsConfig *tls.Config, headers map[string]string) *Client {
+	var protocols http.Protocols
+	scheme := "https"
+	if insecure {
+		scheme = "http"
+		protocols.SetUnencryptedHTTP2(true)
+	} else {
+		protocols.SetHTTP2(true)
+	}
+	return &Client{
+		baseURL: fmt.Sprintf("%s://%s", scheme, endpoint),
+		headers: headers,
+		httpcli: http.Client{
+			Timeout: time.Minute,
+			Transport: &http.Transport{
+				Protocols:       &protocols,
+				TLSClientConfig: tlsConfig,
+				IdleConnTimeout: 30 * time.Second,
+			},
+		},
+	}
+}
+
+// NewSignedClient - calls are signed by signer, wrap wraps the transport unless nil, such as to honor dry runs
+func NewSignedClient(endpoint string, insecure bool, signer Signer, wrap func(http.RoundTripper) http.RoundTripper) *Client {
+	c := NewClient(endpoint, insecure, nil, nil)
+	c.signer = signer
+	if wrap != nil {
+		c.httpcli.Transport = wrap(c.httpcli.Transport)
+	}
+	return c
+}
+
+// Invoke calls /{service}/{method} with a protobuf encoded request until ctx is done
+func (c *Client) Invoke(ctx context.Context, fullMethod string, request []byte) ([]byte, error) {
+	var body bytes.Buffer
+	err := WriteMessage(&body, request)
+	if err != nil {
+		return nil, fmt.Errorf("WriteMessage.%s", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", c.baseURL+fullMethod, bytes.NewReader(body.Bytes()))
+	if err != nil {
+		return nil, fmt.Errorf("http.NewRequest.%s", err)
+	}
+	req.Header.Set("Content-Type", ContentType)
+	req.Header.Set("TE", "trailers")
+	for key, value := range c.headers {
+		req.Header.Set(key, value)
+	}
+	if metadata, ok := ctx.Value(metadataContext{}).(map[string]string); ok {
+		for key, value := range metadata {
+			req.Header.Set(key, value)
+		}
+	}
+	if c.signer != nil {
+		err = c.signer.Sign(req, body.Bytes())
+		if err != nil {
+			return nil, fmt.Errorf("Sign.%s", err)
+		}
+	}
+	res, err := c.httpcli.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("httpClient.Do.%s", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		resBody, _ := ioutil.ReadAll(res.Body)
+		return nil, fmt.Errorf("grpc: %s : %s", res.Status, resBody)
+	}
+	response, err := ReadMessage(res.Body)
+	if err != nil && err != io.EOF {
+		return nil, fmt.Errorf("ReadMessage.%s", err)
+	}
+	// drain the body so trailers are available
+	_, err = io.Copy(ioutil.Discard, res.Body)
+	if err != nil {
+		return nil, fmt.Errorf("io.Copy.%s", err)
+	}
+	status := statusOf(res.Trailer)
+	if status == nil {
+		// trailers-only responses carry status in headers
+		status = statusOf(res.Header)
+	}
+	if status != nil && status.Code != OK {
+		return nil, status
+	}
+	return response, nil
+}
+
+func statusOf(h http.Header) *Status {
+	codeStr := h.Get("Grpc-Status")
+	if codeStr == "" {
+		return nil
+	}
+	code, err := strconv.Atoi(codeStr)
+	if err != nil {
+		return &Status{Unknown, codeStr}
+	}
+	message, _ := url.PathUnescape(h.Get("Grpc-Message"))
+	return &Status{Code(code), message}
+}
@@ -0,0 +1,86 @@
+// Package grpc implements the subset of gRPC over HTTP/2 used by bulklog:
+// unary calls on the client side and unary/client streaming handlers on the server side.
+// Messages are opaque protobuf payloads, see package proto.
+// ref: https://github.com/grpc/grpc/blob/master/doc/PROTOCOL-HTTP2.md
+package grpc
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const (
+	// ContentType - gRPC content type
+	ContentType = "application/grpc"
+	// maxMessageSize bounds received messages
+	maxMessageSize = 16 << 20
+)
+
+var (
+	// ErrCompressed - compressed messages are not supported
+	ErrCompressed = errors.New("ErrCompressed - compressed grpc messages are not supported")
+	// ErrMessageTooLarge -
+	ErrMessageTooLarge = errors.New("ErrMessageTooLarge - grpc message exceeds 16MB")
+)
+
+// Code - gRPC status code
+type Code int
+
+// ref: https://grpc.github.io/grpc/core/md_doc_statuscodes.html
+const (
+	OK                 Code = 0
+	Canceled           Code = 1
+	Unknown            Code = 2
+	InvalidArgument    Code = 3
+	DeadlineExceeded   Code = 4
+	NotFound           Code = 5
+	PermissionDenied   Code = 7
+	ResourceExhausted  Code = 8
+	FailedPrecondition Code = 9
+	Unimplemented      Code = 12
+	Internal           Code = 13
+	Unavailable        Code = 14
+	Unauthenticated    Code = 16
+)
+
+// Status - error returned by a gRPC call
+type Status struct {
+	Code    Code
+	Message string
+}
+
+func (s *Status) Error() string {
+	return fmt.Sprintf("grpc: code %d: %s", s.Code, s.Message)
+}
+
+// WriteMessage writes a length prefixed message
+func WriteMessage(w io.Writer, msg []byte) error {
+	header := make([]byte, 5)
+	binary.BigEndian.PutUint32(header[1:], uint32(len(msg)))
+	_, err := w.Write(append(header, msg...))
+	return err
+}
+
+// ReadMessage reads a length prefixed message, io.EOF at the end of the stream
+func ReadMessage(r io.Reader) ([]byte, error) {
+	header := make([]byte, 5)
+	_, err := io.ReadFull(r, header)
+	if err != nil {
+		return nil, err
+	}
+	if header[0] != 0 {
+		return nil, ErrCompressed
+	}
+	length := binary.BigEndian.Uint32(header[1:])
+	if length > maxMessageSize {
+		return nil, ErrMessageTooLarge
+	}
+	msg := make([]byte, length)
+	_, err = io.ReadFull(r, msg)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return msg, err
+}
@@ -0,0 +1,257 @@
+package grpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMessageFraming(t *testing.T) {
+	var buf bytes.Buffer
+	// field 1 varint 150, the protobuf encoding example
+	err := WriteMessage(&buf, []byte{0x08, 0x96, 0x01})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := hex.EncodeToString(buf.Bytes()), "0000000003089601"; got != want {
+		t.Fatalf("WriteMessage = %s, want %s", got, want)
+	}
+	WriteMessage(&buf, nil)
+	msg, err := ReadMessage(&buf)
+	if err != nil || !bytes.Equal(msg, []byte{0x08, 0x96, 0x01}) {
+		t.Fatalf("ReadMessage = %x, %v", msg, err)
+	}
+	msg, err = ReadMessage(&buf)
+	if err != nil || len(msg) != 0 {
+		t.Fatalf("ReadMessage of an empty message = %x, %v", msg, err)
+	}
+	_, err = ReadMessage(&buf)
+	if err != io.EOF {
+		t.Fatalf("ReadMessage at the end of the stream: got %v, want %v", err, io.EOF)
+	}
+}
+
+func TestReadMessageInvalid(t *testing.T) {
+	frames := map[string]struct {
+		frame string
+		err   error
+	}{
+		"compressed":       {"0100000003089601", ErrCompressed},
+		"too large":        {"0001000001", ErrMessageTooLarge},
+		"truncated":        {"00000000030896", io.ErrUnexpectedEOF},
+		"truncated header": {"000000", io.ErrUnexpectedEOF},
+	}
+	for name, frame := range frames {
+		t.Run(name, func(t *testing.T) {
+			b, _ := hex.DecodeString(frame.frame)
+			_, err := ReadMessage(bytes.NewReader(b))
+			if err != frame.err {
+				t.Fatalf("ReadMessage: got %v, want %v", err, frame.err)
+			}
+		})
+	}
+}
+
+// FuzzReadMessage checks arbitrary streams are read or rejected rather than panicking, and messages read frame back as they were read
+func FuzzReadMessage(f *testing.F) {
+	for _, frame := range []string{"0000000003089601", "000000000000000000000103", "0100000003089601", "0001000001", "00000000030896"} {
+		b, _ := hex.DecodeString(frame)
+		f.Add(b)
+	}
+	f.Fuzz(func(t *testing.T, stream []byte) {
+		var (
+			r      = bytes.NewReader(stream)
+			framed bytes.Buffer
+		)
+		for {
+			msg, err := ReadMessage(r)
+			if err != nil {
+				break
+			}
+			WriteMessage(&framed, msg)
+		}
+		if !bytes.HasPrefix(stream, framed.Bytes()) {
+			t.Fatalf("messages read from %x frame as %x", stream, framed.Bytes())
+		}
+	})
+}
+
+// h2cServer serves handler over unencrypted HTTP/2, as gRPC clients dial insecure endpoints
+func h2cServer(t *testing.T, handler http.Handler) *httptest.Server {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor != 2 {
+			t.Errorf("request over %s, want HTTP/2", r.Proto)
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	var protocols http.Protocols
+	protocols.SetUnencryptedHTTP2(true)
+	srv.Config.Protocols = &protocols
+	srv.Start()
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestUnaryCall(t *testing.T) {
+	mux := NewServeMux()
+	mux.HandleUnary("/bulklog.v1.Echo/Echo", func(ctx context.Context, request []byte) ([]byte, error) {
+		return append([]byte("echo:"), request...), nil
+	})
+	mux.HandleUnary("/bulklog.v1.Echo/Fail", func(ctx context.Context, request []byte) ([]byte, error) {
+		return nil, &Status{ResourceExhausted, "quota exceeded: 100% of documents_per_day"}
+	})
+	mux.HandleUnary("/bulklog.v1.Echo/Crash", func(ctx context.Context, request []byte) ([]byte, error) {
+		return nil, errors.New("boom")
+	})
+	srv := h2cServer(t, mux)
+	client := NewClient(strings.TrimPrefix(srv.URL, "http://"), true, nil, map[string]string{"Authorization": "Bearer token"})
+
+	response, err := client.Invoke(context.Background(), "/bulklog.v1.Echo/Echo", []byte("ping"))
+	if err != nil || string(response) != "echo:ping" {
+		t.Fatalf("Invoke = %q, %v", response, err)
+	}
+	calls := map[string]*Status{
+		"/bulklog.v1.Echo/Fail":    {ResourceExhausted, "quota exceeded: 100% of documents_per_day"},
+		"/bulklog.v1.Echo/Crash":   {Internal, "boom"},
+		"/bulklog.v1.Echo/Missing": {Unimplemented, "unknown method /bulklog.v1.Echo/Missing"},
+	}
+	for method, want := range calls {
+		_, err = client.Invoke(context.Background(), method, []byte("ping"))
+		status, ok := err.(*Status)
+		if !ok || *status != *want {
+			t.Errorf("Invoke %s: got %v, want %v", method, err, want)
+		}
+	}
+}
+
+func TestClientStreamCall(t *testing.T) {
+	mux := NewServeMux()
+	mux.HandleStream("/bulklog.v1.Collect/Stream", func(ctx context.Context, recv func() ([]byte, error)) ([]byte, error) {
+		var all []byte
+		for {
+			msg, err := recv()
+			if err == io.EOF {
+				return all, nil
+			}
+			if err != nil {
+				return nil, err
+			}
+			all = append(all, msg...)
+		}
+	})
+	srv := h2cServer(t, mux)
+	var body bytes.Buffer
+	for _, msg := range []string{"a", "bc", "", "def"} {
+		WriteMessage(&body, []byte(msg))
+	}
+	res := post(t, srv, "/bulklog.v1.Collect/Stream", body.Bytes())
+	response, err := ReadMessage(res.Body)
+	if err != nil || string(response) != "abcdef" {
+		t.Fatalf("response = %q, %v", response, err)
+	}
+	io.Copy(io.Discard, res.Body)
+	if status := res.Trailer.Get("Grpc-Status"); status != "0" {
+		t.Fatalf("grpc-status trailer = %q, want 0", status)
+	}
+}
+
+// TestStatusTrailers checks the wire format of statuses: trailers, with percent encoded messages
+func TestStatusTrailers(t *testing.T) {
+	mux := NewServeMux()
+	mux.HandleUnary("/bulklog.v1.Echo/Fail", func(ctx context.Context, request []byte) ([]byte, error) {
+		return nil, &Status{InvalidArgument, "schéma invalide"}
+	})
+	srv := h2cServer(t, mux)
+	var body bytes.Buffer
+	WriteMessage(&body, []byte("ping"))
+	res := post(t, srv, "/bulklog.v1.Echo/Fail", body.Bytes())
+	rest, _ := io.ReadAll(res.Body)
+	if len(rest) != 0 {
+		t.Fatalf("failed call has a %d bytes response message", len(rest))
+	}
+	if got := res.Header.Get("Content-Type"); got != ContentType {
+		t.Fatalf("content-type = %q, want %q", got, ContentType)
+	}
+	if got := res.Trailer.Get("Grpc-Status"); got != "3" {
+		t.Fatalf("grpc-status trailer = %q, want 3", got)
+	}
+	if got := res.Trailer.Get("Grpc-Message"); got != "sch%C3%A9ma%20invalide" {
+		t.Fatalf("grpc-message trailer = %q, want sch%%C3%%A9ma%%20invalide", got)
+	}
+	res = post(t, srv, "/bulklog.v1.Echo/Fail", []byte{1, 0, 0, 0, 0})
+	io.Copy(io.Discard, res.Body)
+	if got := res.Trailer.Get("Grpc-Status"); got != "12" {
+		t.Fatalf("grpc-status of a compressed request = %q, want 12", got)
+	}
+}
+
+// TestTrailersOnly checks the status of responses made of headers only, as servers answer calls they fail right away
+func TestTrailersOnly(t *testing.T) {
+	srv := h2cServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Type") != ContentType || r.Header.Get("Te") != "trailers" {
+			t.Errorf("request headers %v", r.Header)
+		}
+		w.Header().Set("Content-Type", ContentType)
+		w.Header().Set("Grpc-Status", "16")
+		w.Header().Set("Grpc-Message", "invalid%20token")
+		w.WriteHeader(http.StatusOK)
+	}))
+	client := NewClient(strings.TrimPrefix(srv.URL, "http://"), true, nil, nil)
+	_, err := client.Invoke(context.Background(), "/bulklog.v1.Echo/Echo", nil)
+	status, ok := err.(*Status)
+	if !ok || *status != (Status{Unauthenticated, "invalid token"}) {
+		t.Fatalf("Invoke: got %v, want code %d", err, Unauthenticated)
+	}
+}
+
+type tokenSigner struct{}
+
+func (tokenSigner) Sign(r *http.Request, body []byte) error {
+	r.Header.Set("Authorization", "Bearer "+string(body[5:]))
+	return nil
+}
+
+// TestSignedCall checks signed clients sign the framed request, and send the metadata of call contexts
+func TestSignedCall(t *testing.T) {
+	srv := h2cServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer ping" || r.Header.Get("X-Goog-Request-Params") != "write_stream=s" {
+			t.Errorf("request headers %v", r.Header)
+		}
+		writeResponse(w, []byte("pong"), nil)
+	}))
+	wrapped := false
+	client := NewSignedClient(strings.TrimPrefix(srv.URL, "http://"), true, tokenSigner{}, func(base http.RoundTripper) http.RoundTripper {
+		wrapped = true
+		return base
+	})
+	ctx := WithMetadata(context.Background(), map[string]string{"x-goog-request-params": "write_stream=s"})
+	response, err := client.Invoke(ctx, "/bulklog.v1.Echo/Echo", []byte("ping"))
+	if err != nil || string(response) != "pong" || !wrapped {
+		t.Fatalf("Invoke = %q, %v, wrapped %v", response, err, wrapped)
+	}
+}
+
+func post(t *testing.T, srv *httptest.Server, path string, body []byte) *http.Response {
+	t.Helper()
+	var protocols http.Protocols
+	protocols.SetUnencryptedHTTP2(true)
+	httpcli := http.Client{Transport: &http.Transport{Protocols: &protocols}}
+	req, err := http.NewRequest("POST", srv.URL+path, bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", ContentType)
+	req.Header.Set("TE", "trailers")
+	res, err := httpcli.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { res.Body.Close() })
+	return res
+}
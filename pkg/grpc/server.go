@@ -0,0 +1,110 @@
+package grpc
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// UnaryHandler handles a unary call, request and response are protobuf encoded
+type UnaryHandler func(ctx context.Context, request []byte) ([]byte, error)
+
+// StreamHandler handles a client streaming call, recv returns io.EOF once the client closed its side of the stream
+type StreamHandler func(ctx context.Context, recv func() ([]byte, error)) ([]byte, error)
+
+// ServeMux routes calls to the handler of their /{service}/{method} path.
+// Errors returned by handlers are sent as *Status, Internal if they are not.
+type ServeMux struct {
+	handlers map[string]http.HandlerFunc
+}
+
+// NewServeMux -
+func NewServeMux() *ServeMux {
+	return &ServeMux{make(map[string]http.HandlerFunc)}
+}
+
+// HandleUnary registers the handler of a unary method
+func (m *ServeMux) HandleUnary(fullMethod string, handler UnaryHandler) {
+	m.handlers[fullMethod] = func(w http.ResponseWriter, r *http.Request) {
+		request, err := ReadMessage(r.Body)
+		if err != nil {
+			writeResponse(w, nil, readStatus(err))
+			return
+		}
+		response, err := handler(r.Context(), request)
+		writeResponse(w, response, err)
+	}
+}
+
+// HandleStream registers the handler of a client streaming method
+func (m *ServeMux) HandleStream(fullMethod string, handler StreamHandler) {
+	m.handlers[fullMethod] = func(w http.ResponseWriter, r *http.Request) {
+		recv := func() ([]byte, error) {
+			msg, err := ReadMessage(r.Body)
+			if err == io.EOF {
+				return nil, err
+			}
+			if err != nil {
+				return nil, readStatus(err)
+			}
+			return msg, nil
+		}
+		response, err := handler(r.Context(), recv)
+		writeResponse(w, response, err)
+	}
+}
+
+// ServeHTTP serves gRPC calls, the server must accept HTTP/2
+func (m *ServeMux) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || !strings.HasPrefix(r.Header.Get("Content-Type"), ContentType) {
+		http.Error(w, "grpc: expects POST application/grpc requests", http.StatusUnsupportedMediaType)
+		return
+	}
+	handler, ok := m.handlers[r.URL.Path]
+	if !ok {
+		writeResponse(w, nil, &Status{Unimplemented, "unknown method " + r.URL.Path})
+		return
+	}
+	handler(w, r)
+}
+
+// writeResponse writes the response message if err is nil and the call status as trailers
+func writeResponse(w http.ResponseWriter, response []byte, err error) {
+	w.Header().Set("Content-Type", ContentType)
+	w.Header().Set("Trailer", "Grpc-Status, Grpc-Message")
+	w.WriteHeader(http.StatusOK)
+	status := &Status{Code: OK}
+	if err != nil {
+		var ok bool
+		status, ok = err.(*Status)
+		if !ok {
+			status = &Status{Internal, err.Error()}
+		}
+	} else {
+		err = WriteMessage(w, response)
+		if err != nil {
+			// the client is gone, there is no one to tell
+			return
+		}
+	}
+	w.Header().Set("Grpc-Status", strconv.Itoa(int(status.Code)))
+	if status.Message != "" {
+		w.Header().Set("Grpc-Message", url.PathEscape(status.Message))
+	}
+}
+
+// readStatus - status of a request message which could not be read
+func readStatus(err error) *Status {
+	switch err {
+	case io.EOF:
+		return &Status{InvalidArgument, "missing request message"}
+	case ErrCompressed:
+		return &Status{Unimplemented, err.Error()}
+	case ErrMessageTooLarge:
+		return &Status{ResourceExhausted, err.Error()}
+	}
+	return &Status{InvalidArgument, err.Error()}
+}
@@ -0,0 +1,109 @@
+package input
+
+import (
+	"fmt"
+	"log/slog"
+
+	"github.com/khezen/bulklog/pkg/collection"
+	"github.com/khezen/bulklog/pkg/input/fluentd"
+	"github.com/khezen/bulklog/pkg/input/gelf"
+	"github.com/khezen/bulklog/pkg/input/kafka"
+	"github.com/khezen/bulklog/pkg/input/otlp"
+	"github.com/khezen/bulklog/pkg/input/plugin"
+	"github.com/khezen/bulklog/pkg/input/syslog"
+)
+
+// Config -
+type Config struct {
+	Syslog  *syslog.Config  `yaml:"syslog,omitempty"`
+	GELF    *gelf.Config    `yaml:"gelf,omitempty"`
+	Fluentd *fluentd.Config `yaml:"fluentd,omitempty"`
+	OTLP    *otlp.Config    `yaml:"otlp,omitempty"`
+	Kafka   *kafka.Config   `yaml:"kafka,omitempty"`
+	// Plugins - inputs run as subprocesses, by name
+	Plugins map[string]plugin.Config `yaml:"plugins,omitempty"`
+}
+
+// Targets returns, by field path, the collection and schema inputs append documents to
+func (c *Config) Targets() map[string]Target {
+	targets := make(map[string]Target)
+	if c.Syslog != nil {
+		targets["syslog"] = Target{c.Syslog.Collection, c.Syslog.Schema}
+	}
+	if c.GELF != nil {
+		targets["gelf"] = Target{c.GELF.Collection, c.GELF.Schema}
+	}
+	if c.Fluentd != nil {
+		for i, r := range c.Fluentd.Routes {
+			targets[fmt.Sprintf("fluentd.routes[%d]", i)] = Target{r.Collection, r.Schema}
+		}
+	}
+	if c.OTLP != nil {
+		for i, r := range c.OTLP.Routes {
+			targets[fmt.Sprintf("otlp.routes[%d]", i)] = Target{r.Collection, r.Schema}
+		}
+	}
+	if c.Kafka != nil {
+		for i, t := range c.Kafka.Topics {
+			targets[fmt.Sprintf("kafka.topics[%d]", i)] = Target{t.Collection, t.Schema}
+		}
+	}
+	for name, pluginCfg := range c.Plugins {
+		targets[fmt.Sprintf("plugins.%s", name)] = Target{pluginCfg.Collection, pluginCfg.Schema}
+	}
+	return targets
+}
+
+// Target - collection and schema documents of an input are appended to
+type Target struct {
+	Collection collection.Name
+	Schema     collection.SchemaName
+}
+
+// NewInputs -
+func NewInputs(cfg *Config, collector Collector, logger *slog.Logger) (map[string]Interface, error) {
+	inputs := make(map[string]Interface)
+	if cfg.Syslog != nil {
+		syslogInput, err := syslog.New(*cfg.Syslog, collector, logger.With("input", "syslog"))
+		if err != nil {
+			return nil, fmt.Errorf("syslog.New.%s", err)
+		}
+		inputs["syslog"] = syslogInput
+	}
+	if cfg.GELF != nil {
+		gelfInput, err := gelf.New(*cfg.GELF, collector, logger.With("input", "gelf"))
+		if err != nil {
+			return nil, fmt.Errorf("gelf.New.%s", err)
+		}
+		inputs["gelf"] = gelfInput
+	}
+	if cfg.Fluentd != nil {
+		fluentdInput, err := fluentd.New(*cfg.Fluentd, collector, logger.With("input", "fluentd"))
+		if err != nil {
+			return nil, fmt.Errorf("fluentd.New.%s", err)
+		}
+		inputs["fluentd"] = fluentdInput
+	}
+	if cfg.OTLP != nil {
+		otlpInput, err := otlp.New(*cfg.OTLP, collector, logger.With("input", "otlp"))
+		if err != nil {
+			return nil, fmt.Errorf("otlp.New.%s", err)
+		}
+		inputs["otlp"] = otlpInput
+	}
+	if cfg.Kafka != nil {
+		kafkaInput, err := kafka.New(*cfg.Kafka, collector, logger.With("input", "kafka"))
+		if err != nil {
+			return nil, fmt.Errorf("kafka.New.%s", err)
+		}
+		inputs["kafka"] = kafkaInput
+	}
+	for name, pluginCfg := range cfg.Plugins {
+		pluginInput, err := plugin.New(pluginCfg, collector, logger.With("input", fmt.Sprintf("plugin.%s", name)))
+		if err != nil {
+			return nil, fmt.Errorf("plugin.New(%s).%s", name, err)
+		}
+		inputs[fmt.Sprintf("plugin.%s", name)] = pluginInput
+	}
+	return inputs, nil
+}
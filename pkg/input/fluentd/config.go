@@ -0,0 +1,24 @@
+package fluentd
+
+import "github.com/khezen/bulklog/pkg/collection"
+
+// Config -
+type Config struct {
+	Enabled bool `yaml:"enabled"`
+	// Address to listen on, such as :24224
+	Address string `yaml:"address"`
+	// SharedKey requires clients to authenticate with the handshake of the forward protocol
+	SharedKey string `yaml:"shared_key"`
+	// SelfHostname is sent to clients during the handshake, defaults to the os hostname
+	SelfHostname string `yaml:"self_hostname"`
+	// Routes map tags to collections, the first matching route is used
+	Routes []Route `yaml:"routes,flow"`
+}
+
+// Route - documents of the tags matching Match are appended to Collection as Schema.
+// As in fluentd, * matches a tag part and ** zero or more parts, such as app.** for app.web.access.
+type Route struct {
+	Match      string                `yaml:"match"`
+	Collection collection.Name       `yaml:"collection"`
+	Schema     collection.SchemaName `yaml:"schema"`
+}
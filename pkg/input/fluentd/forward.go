@@ -0,0 +1,220 @@
+package fluentd
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"time"
+	"unicode/utf8"
+
+	"github.com/khezen/bulklog/pkg/msgpack"
+)
+
+// eventTimeExt - extension type of fluentd EventTime, seconds and nanoseconds as big endian uint32
+const eventTimeExt = 0
+
+var (
+	// ErrMalformedMessage - message is none of the Message, Forward and PackedForward modes
+	ErrMalformedMessage = errors.New("ErrMalformedMessage - fluentd message must be [tag, time, record] or [tag, entries]")
+	// ErrMalformedEntry - entry is not [time, record]
+	ErrMalformedEntry = errors.New("ErrMalformedEntry - fluentd entry must be [time, record]")
+	// ErrUnsupportedCompression -
+	ErrUnsupportedCompression = errors.New("ErrUnsupportedCompression - fluentd compressed option must be text or gzip")
+)
+
+type event struct {
+	time   time.Time
+	record map[interface{}]interface{}
+}
+
+// forwardMessage - events of a tag, chunk is set if the client expects an ack
+type forwardMessage struct {
+	tag    string
+	events []event
+	chunk  string
+}
+
+// parseMessage reads the Message, Forward, PackedForward and CompressedPackedForward modes
+// ref: https://github.com/fluent/fluentd/wiki/Forward-Protocol-Specification-v1
+func parseMessage(v interface{}) (*forwardMessage, error) {
+	array, ok := v.([]interface{})
+	if !ok || len(array) < 2 {
+		return nil, ErrMalformedMessage
+	}
+	tag, ok := toString(array[0])
+	if !ok {
+		return nil, ErrMalformedMessage
+	}
+	var (
+		msg     = &forwardMessage{tag: tag}
+		options interface{}
+		err     error
+	)
+	switch entries := array[1].(type) {
+	case []interface{}:
+		if len(array) > 2 {
+			options = array[2]
+		}
+		msg.events = make([]event, 0, len(entries))
+		for _, entry := range entries {
+			e, err := parseEntry(entry)
+			if err != nil {
+				return nil, err
+			}
+			msg.events = append(msg.events, e)
+		}
+	case []byte, string:
+		if len(array) > 2 {
+			options = array[2]
+		}
+		packed, _ := toBytes(entries)
+		msg.events, err = parsePackedEntries(packed, option(options, "compressed"))
+		if err != nil {
+			return nil, err
+		}
+	default:
+		if len(array) < 3 {
+			return nil, ErrMalformedMessage
+		}
+		if len(array) > 3 {
+			options = array[3]
+		}
+		e, err := parseEntry([]interface{}{array[1], array[2]})
+		if err != nil {
+			return nil, err
+		}
+		msg.events = []event{e}
+	}
+	msg.chunk, _ = toString(option(options, "chunk"))
+	return msg, nil
+}
+
+func parsePackedEntries(packed []byte, compressed interface{}) ([]event, error) {
+	var reader io.Reader = bytes.NewReader(packed)
+	switch compression, _ := toString(compressed); compression {
+	case "", "text":
+	case "gzip":
+		gzipReader, err := gzip.NewReader(reader)
+		if err != nil {
+			return nil, fmt.Errorf("gzip.NewReader.%s", err)
+		}
+		defer gzipReader.Close()
+		reader = gzipReader
+	default:
+		return nil, ErrUnsupportedCompression
+	}
+	var (
+		decoder = msgpack.NewDecoder(reader)
+		events  = make([]event, 0)
+	)
+	for {
+		entry, err := decoder.Decode()
+		if err == io.EOF {
+			return events, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Decode.%s", err)
+		}
+		e, err := parseEntry(entry)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+}
+
+func parseEntry(v interface{}) (e event, err error) {
+	entry, ok := v.([]interface{})
+	if !ok || len(entry) < 2 {
+		return e, ErrMalformedEntry
+	}
+	e.record, ok = entry[1].(map[interface{}]interface{})
+	if !ok {
+		return e, ErrMalformedEntry
+	}
+	switch t := entry[0].(type) {
+	case int64:
+		e.time = time.Unix(t, 0)
+	case uint64:
+		e.time = time.Unix(int64(t), 0)
+	case float64:
+		whole, frac := math.Modf(t)
+		e.time = time.Unix(int64(whole), int64(frac*1e9))
+	case msgpack.Ext:
+		if t.Type != eventTimeExt || len(t.Data) != 8 {
+			return e, ErrMalformedEntry
+		}
+		e.time = time.Unix(int64(binary.BigEndian.Uint32(t.Data)), int64(binary.BigEndian.Uint32(t.Data[4:])))
+	default:
+		return e, ErrMalformedEntry
+	}
+	return e, nil
+}
+
+func option(options interface{}, name string) interface{} {
+	m, ok := options.(map[interface{}]interface{})
+	if !ok {
+		return nil
+	}
+	return m[name]
+}
+
+// toString reads str, and bin as older fluentd versions send strings as raw bytes
+func toString(v interface{}) (string, bool) {
+	switch s := v.(type) {
+	case string:
+		return s, true
+	case []byte:
+		return string(s), true
+	}
+	return "", false
+}
+
+func toBytes(v interface{}) ([]byte, bool) {
+	switch b := v.(type) {
+	case string:
+		return []byte(b), true
+	case []byte:
+		return b, true
+	}
+	return nil, false
+}
+
+// jsonValue converts decoded msgpack values into values encoding/json accepts
+func jsonValue(v interface{}) interface{} {
+	switch value := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(value))
+		for key, elem := range value {
+			keyStr, ok := toString(key)
+			if !ok {
+				keyStr = fmt.Sprint(key)
+			}
+			m[keyStr] = jsonValue(elem)
+		}
+		return m
+	case []interface{}:
+		array := make([]interface{}, len(value))
+		for i, elem := range value {
+			array[i] = jsonValue(elem)
+		}
+		return array
+	case []byte:
+		if utf8.Valid(value) {
+			return string(value)
+		}
+		// encoded as base64
+		return value
+	case msgpack.Ext:
+		return value.Data
+	case float64:
+		if math.IsNaN(value) || math.IsInf(value, 0) {
+			return nil
+		}
+	}
+	return v
+}
@@ -0,0 +1,95 @@
+package fluentd
+
+import (
+	"crypto/rand"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/khezen/bulklog/pkg/msgpack"
+)
+
+var (
+	// ErrMalformedPing - client did not answer HELO with PING
+	ErrMalformedPing = errors.New("ErrMalformedPing - fluentd client must answer HELO with PING")
+	// ErrWrongSharedKey -
+	ErrWrongSharedKey = errors.New("ErrWrongSharedKey - fluentd client shared key does not match")
+)
+
+// handshake authenticates the client with the shared key: HELO, PING, PONG.
+// User authentication is not required, so HELO carries no auth salt.
+func (f *Fluentd) handshake(w io.Writer, decoder *msgpack.Decoder) error {
+	nonce := make([]byte, 16)
+	_, err := rand.Read(nonce)
+	if err != nil {
+		return fmt.Errorf("rand.Read.%s", err)
+	}
+	var helo msgpack.Encoder
+	helo.ArrayHeader(2)
+	helo.String("HELO")
+	helo.MapHeader(3)
+	helo.String("nonce")
+	helo.Bin(nonce)
+	helo.String("auth")
+	helo.String("")
+	helo.String("keepalive")
+	helo.Bool(true)
+	_, err = w.Write(helo.Bytes())
+	if err != nil {
+		return fmt.Errorf("(write HELO).%s", err)
+	}
+	v, err := decoder.Decode()
+	if err != nil {
+		return fmt.Errorf("(read PING).%s", err)
+	}
+	ping, ok := v.([]interface{})
+	if !ok || len(ping) < 4 {
+		return ErrMalformedPing
+	}
+	var fields [4]string
+	for i := range fields {
+		fields[i], ok = toString(ping[i])
+		if !ok {
+			return ErrMalformedPing
+		}
+	}
+	if fields[0] != "PING" {
+		return ErrMalformedPing
+	}
+	var (
+		clientHostname = fields[1]
+		salt           = fields[2]
+		expected       = digest(salt, clientHostname, string(nonce), f.sharedKey)
+		authenticated  = subtle.ConstantTimeCompare([]byte(expected), []byte(fields[3])) == 1
+		reason         = ""
+	)
+	if !authenticated {
+		reason = "shared_key mismatch"
+	}
+	var pong msgpack.Encoder
+	pong.ArrayHeader(5)
+	pong.String("PONG")
+	pong.Bool(authenticated)
+	pong.String(reason)
+	pong.String(f.hostname)
+	pong.String(digest(salt, f.hostname, string(nonce), f.sharedKey))
+	_, err = w.Write(pong.Bytes())
+	if err != nil {
+		return fmt.Errorf("(write PONG).%s", err)
+	}
+	if !authenticated {
+		return ErrWrongSharedKey
+	}
+	return nil
+}
+
+func digest(parts ...string) string {
+	h := sha512.New()
+	for _, part := range parts {
+		io.WriteString(h, part)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
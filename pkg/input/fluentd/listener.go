@@ -0,0 +1,229 @@
+package fluentd
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/khezen/bulklog/pkg/collection"
+	"github.com/khezen/bulklog/pkg/msgpack"
+)
+
+// idleTimeout closes connections which send nothing, fluentd reconnects as needed
+const idleTimeout = 5 * time.Minute
+
+// ErrNoListenAddress -
+var ErrNoListenAddress = errors.New("ErrNoListenAddress - fluentd input requires an address")
+
+// Collector appends documents to a collection, see input.Collector
+type Collector interface {
+	CollectBatch(ctx context.Context, collectionName collection.Name, schemaName collection.SchemaName, docBytesSlice ...[]byte) error
+}
+
+// Fluentd receives events with the fluentd forward protocol and appends them as documents
+type Fluentd struct {
+	address   string
+	sharedKey string
+	hostname  string
+	routes    []Route
+	collector Collector
+	logger    *slog.Logger
+
+	mu       sync.Mutex
+	closed   bool
+	listener net.Listener
+	conns    map[net.Conn]struct{}
+	serving  sync.WaitGroup
+}
+
+// New returns fluentd as an input
+func New(cfg Config, collector Collector, logger *slog.Logger) (*Fluentd, error) {
+	if cfg.Address == "" {
+		return nil, ErrNoListenAddress
+	}
+	if cfg.SelfHostname == "" {
+		cfg.SelfHostname, _ = os.Hostname()
+	}
+	return &Fluentd{
+		address:   cfg.Address,
+		sharedKey: cfg.SharedKey,
+		hostname:  cfg.SelfHostname,
+		routes:    cfg.Routes,
+		collector: collector,
+		logger:    logger,
+		conns:     make(map[net.Conn]struct{}),
+	}, nil
+}
+
+// Serve opens the TCP listener and blocks until Close
+func (f *Fluentd) Serve() (err error) {
+	f.mu.Lock()
+	if f.closed {
+		f.mu.Unlock()
+		return nil
+	}
+	f.listener, err = net.Listen("tcp", f.address)
+	if err != nil {
+		f.mu.Unlock()
+		return fmt.Errorf("net.Listen.%s", err)
+	}
+	f.logger.Info("opening fluentd input", "addr", f.listener.Addr().String())
+	f.mu.Unlock()
+	defer f.serving.Wait()
+	for {
+		conn, err := f.listener.Accept()
+		if err != nil {
+			if f.isClosed() {
+				return nil
+			}
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				continue
+			}
+			f.Close()
+			return fmt.Errorf("Accept.%s", err)
+		}
+		f.mu.Lock()
+		if f.closed {
+			f.mu.Unlock()
+			conn.Close()
+			return nil
+		}
+		f.conns[conn] = struct{}{}
+		f.serving.Add(1)
+		f.mu.Unlock()
+		go f.serveConn(conn)
+	}
+}
+
+// Close stops listening and closes connections; events not acked yet are resent by clients in ack mode
+func (f *Fluentd) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return nil
+	}
+	f.closed = true
+	if f.listener != nil {
+		f.listener.Close()
+	}
+	for conn := range f.conns {
+		conn.Close()
+	}
+	return nil
+}
+
+func (f *Fluentd) isClosed() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.closed
+}
+
+func (f *Fluentd) serveConn(conn net.Conn) {
+	defer func() {
+		// a malformed message must not bring down the process serving other clients
+		if r := recover(); r != nil {
+			f.logger.Error("fluentd connection closed", "sender", conn.RemoteAddr().String(), "panic", r)
+		}
+		f.mu.Lock()
+		delete(f.conns, conn)
+		f.mu.Unlock()
+		conn.Close()
+		f.serving.Done()
+	}()
+	var (
+		logger  = f.logger.With("sender", conn.RemoteAddr().String())
+		decoder = msgpack.NewDecoder(bufio.NewReader(conn))
+	)
+	if f.sharedKey != "" {
+		conn.SetDeadline(time.Now().Add(idleTimeout))
+		err := f.handshake(conn, decoder)
+		if err != nil {
+			logger.Warn("fluentd handshake failed", "error", err)
+			return
+		}
+	}
+	for {
+		conn.SetReadDeadline(time.Now().Add(idleTimeout))
+		v, err := decoder.Decode()
+		if err == io.EOF || (err != nil && f.isClosed()) {
+			return
+		}
+		if err != nil {
+			logger.Warn("fluentd connection closed", "error", err)
+			return
+		}
+		msg, err := parseMessage(v)
+		if err != nil {
+			logger.Warn("fluentd message dropped", "error", err)
+			continue
+		}
+		err = f.collect(msg)
+		if err != nil {
+			// without ack the client sends the chunk again
+			logger.Warn("fluentd message dropped", "tag", msg.tag, "error", err)
+			continue
+		}
+		if msg.chunk != "" {
+			err = f.ack(conn, msg.chunk)
+			if err != nil {
+				logger.Warn("fluentd connection closed", "error", err)
+				return
+			}
+		}
+	}
+}
+
+// collect appends events of the message to the collection of its tag route,
+// events of tags no route matches are dropped
+func (f *Fluentd) collect(msg *forwardMessage) error {
+	r, ok := f.route(msg.tag)
+	if !ok {
+		f.logger.Debug("fluentd events not routed", "tag", msg.tag, "count", len(msg.events))
+		return nil
+	}
+	docBytesSlice := make([][]byte, 0, len(msg.events))
+	for _, e := range msg.events {
+		doc := jsonValue(e.record).(map[string]interface{})
+		if _, ok := doc["tag"]; !ok {
+			doc["tag"] = msg.tag
+		}
+		if _, ok := doc["time"]; !ok {
+			doc["time"] = e.time.UTC().Format(time.RFC3339Nano)
+		}
+		docBytes, err := json.Marshal(doc)
+		if err != nil {
+			return fmt.Errorf("json.Marshal.%s", err)
+		}
+		docBytesSlice = append(docBytesSlice, docBytes)
+	}
+	if len(docBytesSlice) == 0 {
+		return nil
+	}
+	err := f.collector.CollectBatch(context.Background(), r.Collection, r.Schema, docBytesSlice...)
+	if err != nil {
+		return fmt.Errorf("CollectBatch.%s", err)
+	}
+	return nil
+}
+
+func (f *Fluentd) ack(conn net.Conn, chunk string) error {
+	var ack msgpack.Encoder
+	ack.MapHeader(1)
+	ack.String("ack")
+	ack.String(chunk)
+	conn.SetWriteDeadline(time.Now().Add(idleTimeout))
+	_, err := conn.Write(ack.Bytes())
+	if err != nil {
+		return fmt.Errorf("(write ack).%s", err)
+	}
+	return nil
+}
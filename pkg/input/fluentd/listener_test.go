@@ -0,0 +1,166 @@
+package fluentd
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/khezen/bulklog/pkg/collection"
+	"github.com/khezen/bulklog/pkg/msgpack"
+)
+
+// panickingCollector panics on the first batch, then records documents
+type panickingCollector struct {
+	mu       sync.Mutex
+	panicked bool
+	docs     chan string
+}
+
+func (c *panickingCollector) CollectBatch(ctx context.Context, collectionName collection.Name, schemaName collection.SchemaName, docBytesSlice ...[]byte) error {
+	c.mu.Lock()
+	panicked := c.panicked
+	c.panicked = true
+	c.mu.Unlock()
+	if !panicked {
+		panic("collector failure")
+	}
+	for _, doc := range docBytesSlice {
+		c.docs <- string(doc)
+	}
+	return nil
+}
+
+func serveFluentd(t *testing.T, collector Collector) string {
+	f, err := New(Config{
+		Address:      "127.0.0.1:0",
+		SelfHostname: "bulklog",
+		Routes:       []Route{{Match: "app.**", Collection: "logs", Schema: "event"}},
+	}, collector, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	go f.Serve()
+	t.Cleanup(func() { f.Close() })
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		f.mu.Lock()
+		listener := f.listener
+		f.mu.Unlock()
+		if listener != nil {
+			return listener.Addr().String()
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("fluentd input did not start listening")
+	return ""
+}
+
+func message(tag string, record map[string]string) []byte {
+	var e msgpack.Encoder
+	e.ArrayHeader(3)
+	e.String(tag)
+	e.Uint(1700000000)
+	e.MapHeader(len(record))
+	for k, v := range record {
+		e.String(k)
+		e.String(v)
+	}
+	return e.Bytes()
+}
+
+// TestServeMalformedFrames checks malformed frames are dropped, and a connection making the server panic only loses itself
+func TestServeMalformedFrames(t *testing.T) {
+	collector := &panickingCollector{docs: make(chan string, 1)}
+	addr := serveFluentd(t, collector)
+	// a map keyed by an extension, which used to panic the decoder
+	frame, _ := hex.DecodeString("81d40100c0")
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = conn.Write(append(frame, message("app.web", map[string]string{"msg": "panics"})...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, err = conn.Read(make([]byte, 1))
+	if err != io.EOF {
+		t.Fatalf("connection: got %v, want it closed by the server", err)
+	}
+	conn.Close()
+	conn, err = net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("fluentd input stopped serving: %s", err)
+	}
+	defer conn.Close()
+	_, err = conn.Write(message("app.web", map[string]string{"msg": "served"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case doc := <-collector.docs:
+		if want := `{"msg":"served","tag":"app.web","time":"2023-11-14T22:13:20Z"}`; doc != want {
+			t.Fatalf("document %s, want %s", doc, want)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("message was not collected")
+	}
+}
+
+// FuzzParseMessage checks arbitrary frames of clients are parsed or rejected rather than panicking, and records parsed convert to JSON
+func FuzzParseMessage(f *testing.F) {
+	f.Add(message("app.web", map[string]string{"msg": "served"}))
+	// Forward mode, [tag, [[time, record]], {chunk}]
+	var forward msgpack.Encoder
+	forward.ArrayHeader(3)
+	forward.String("app.web")
+	forward.ArrayHeader(1)
+	forward.ArrayHeader(2)
+	forward.Uint(1700000000)
+	forward.MapHeader(1)
+	forward.String("msg")
+	forward.String("forwarded")
+	forward.MapHeader(1)
+	forward.String("chunk")
+	forward.String("p8n9gmxTQVC8/nh2wlKKeQ==")
+	f.Add(forward.Bytes())
+	// PackedForward mode, [tag, bin of entries, {compressed: text}]
+	var entry msgpack.Encoder
+	entry.ArrayHeader(2)
+	entry.Uint(1700000000)
+	entry.MapHeader(0)
+	var packed msgpack.Encoder
+	packed.ArrayHeader(3)
+	packed.String("app.web")
+	packed.Bin(append(entry.Bytes(), entry.Bytes()...))
+	packed.MapHeader(1)
+	packed.String("compressed")
+	packed.String("text")
+	f.Add(packed.Bytes())
+	frame, _ := hex.DecodeString("81d40100c0")
+	f.Add(frame)
+	f.Fuzz(func(t *testing.T, frame []byte) {
+		v, err := msgpack.NewDecoder(bytes.NewReader(frame)).Decode()
+		if err != nil {
+			return
+		}
+		msg, err := parseMessage(v)
+		if err != nil {
+			return
+		}
+		// records become documents as collect converts them
+		for _, e := range msg.events {
+			_, err = json.Marshal(jsonValue(e.record))
+			if err != nil {
+				t.Fatalf("json.Marshal of record %#v: %s", e.record, err)
+			}
+		}
+	})
+}
@@ -0,0 +1,36 @@
+package fluentd
+
+import "strings"
+
+// matchTag tells whether tag matches pattern, where * matches a single part and ** zero or more parts
+func matchTag(pattern, tag string) bool {
+	return matchParts(strings.Split(pattern, "."), strings.Split(tag, "."))
+}
+
+func matchParts(pattern, tag []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(tag); i++ {
+				if matchParts(pattern[1:], tag[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(tag) == 0 || (pattern[0] != "*" && pattern[0] != tag[0]) {
+			return false
+		}
+		pattern, tag = pattern[1:], tag[1:]
+	}
+	return len(tag) == 0
+}
+
+// route returns the first route matching tag
+func (f *Fluentd) route(tag string) (Route, bool) {
+	for _, r := range f.routes {
+		if matchTag(r.Match, tag) {
+			return r, true
+		}
+	}
+	return Route{}, false
+}
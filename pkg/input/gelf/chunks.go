@@ -0,0 +1,99 @@
+package gelf
+
+import (
+	"bytes"
+	"errors"
+	"sync"
+	"time"
+)
+
+const (
+	// chunkHeaderSize - magic bytes, message ID, sequence number and count
+	chunkHeaderSize = 12
+	maxChunks       = 128
+	// chunkTimeout drops messages whose chunks did not all arrive
+	chunkTimeout = 5 * time.Second
+)
+
+var (
+	// ErrMalformedChunk -
+	ErrMalformedChunk = errors.New("ErrMalformedChunk - gelf chunk header is invalid")
+
+	chunkMagic = []byte{0x1e, 0x0f}
+)
+
+type pendingMessage struct {
+	chunks    [][]byte
+	received  int
+	size      int
+	expiresAt time.Time
+}
+
+// chunks reassembles chunked UDP messages
+type chunks struct {
+	sync.Mutex
+	pending map[string]*pendingMessage
+}
+
+func newChunks() *chunks {
+	return &chunks{pending: make(map[string]*pendingMessage)}
+}
+
+func isChunk(datagram []byte) bool {
+	return bytes.HasPrefix(datagram, chunkMagic)
+}
+
+// add stores a chunk and returns the message once all its chunks are received
+func (c *chunks) add(datagram []byte, now time.Time) ([]byte, error) {
+	if len(datagram) < chunkHeaderSize {
+		return nil, ErrMalformedChunk
+	}
+	var (
+		id       = string(datagram[2:10])
+		sequence = int(datagram[10])
+		count    = int(datagram[11])
+	)
+	if count == 0 || count > maxChunks || sequence >= count {
+		return nil, ErrMalformedChunk
+	}
+	c.Lock()
+	defer c.Unlock()
+	msg, ok := c.pending[id]
+	if !ok {
+		msg = &pendingMessage{chunks: make([][]byte, count), expiresAt: now.Add(chunkTimeout)}
+		c.pending[id] = msg
+	}
+	if len(msg.chunks) != count {
+		delete(c.pending, id)
+		return nil, ErrMalformedChunk
+	}
+	if msg.chunks[sequence] != nil {
+		return nil, nil
+	}
+	msg.chunks[sequence] = append([]byte(nil), datagram[chunkHeaderSize:]...)
+	msg.received++
+	msg.size += len(datagram) - chunkHeaderSize
+	if msg.size > maxMessageSize {
+		delete(c.pending, id)
+		return nil, ErrMessageTooLarge
+	}
+	if msg.received < count {
+		return nil, nil
+	}
+	delete(c.pending, id)
+	return bytes.Join(msg.chunks, nil), nil
+}
+
+// expire drops incomplete messages older than chunkTimeout and returns how many were dropped
+func (c *chunks) expire(now time.Time) int {
+	c.Lock()
+	defer c.Unlock()
+	dropped := 0
+	for id, msg := range c.pending {
+		if now.After(msg.expiresAt) {
+			delete(c.pending, id)
+			dropped++
+		}
+	}
+	return dropped
+}
@@ -0,0 +1,14 @@
+package gelf
+
+import "github.com/khezen/bulklog/pkg/collection"
+
+// Config -
+type Config struct {
+	Enabled bool `yaml:"enabled"`
+	// UDP listen address, such as :12201; UDP is not served if empty
+	UDP string `yaml:"udp"`
+	// HTTP listen address, such as :12202, messages are posted to /gelf; HTTP is not served if empty
+	HTTP       string                `yaml:"http"`
+	Collection collection.Name       `yaml:"collection"`
+	Schema     collection.SchemaName `yaml:"schema"`
+}
@@ -0,0 +1,204 @@
+package gelf
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/khezen/bulklog/pkg/collection"
+)
+
+// maxDatagramSize - GELF UDP chunks are at most 8192 bytes
+const maxDatagramSize = 8192
+
+// ErrNoListenAddress -
+var ErrNoListenAddress = errors.New("ErrNoListenAddress - gelf input requires a udp or http address")
+
+// Collector appends documents to a collection, see input.Collector
+type Collector interface {
+	Collect(ctx context.Context, collectionName collection.Name, schemaName collection.SchemaName, docBytes []byte) error
+}
+
+// GELF receives Graylog GELF messages and appends them as documents
+type GELF struct {
+	udpAddr    string
+	collection collection.Name
+	schema     collection.SchemaName
+	collector  Collector
+	logger     *slog.Logger
+	chunks     *chunks
+	httpServer *http.Server
+
+	mu     sync.Mutex
+	closed bool
+	packet net.PacketConn
+}
+
+// New returns GELF as an input
+func New(cfg Config, collector Collector, logger *slog.Logger) (*GELF, error) {
+	if cfg.UDP == "" && cfg.HTTP == "" {
+		return nil, ErrNoListenAddress
+	}
+	g := &GELF{
+		udpAddr:    cfg.UDP,
+		collection: cfg.Collection,
+		schema:     cfg.Schema,
+		collector:  collector,
+		logger:     logger,
+		chunks:     newChunks(),
+	}
+	if cfg.HTTP != "" {
+		mux := http.NewServeMux()
+		mux.HandleFunc("/gelf", g.handleMessage)
+		g.httpServer = &http.Server{Addr: cfg.HTTP, Handler: mux}
+	}
+	return g, nil
+}
+
+// Serve opens the UDP and HTTP listeners and blocks until Close
+func (g *GELF) Serve() (err error) {
+	g.mu.Lock()
+	if g.closed {
+		g.mu.Unlock()
+		return nil
+	}
+	if g.udpAddr != "" {
+		g.packet, err = net.ListenPacket("udp", g.udpAddr)
+		if err != nil {
+			g.mu.Unlock()
+			return fmt.Errorf("net.ListenPacket.%s", err)
+		}
+		g.logger.Info("opening gelf input", "network", "udp", "addr", g.packet.LocalAddr().String())
+	}
+	g.mu.Unlock()
+	errs := make(chan error, 2)
+	if g.packet != nil {
+		go func() { errs <- g.serveUDP() }()
+	}
+	if g.httpServer != nil {
+		go func() {
+			g.logger.Info("opening gelf input", "network", "http", "addr", g.httpServer.Addr)
+			err := g.httpServer.ListenAndServe()
+			if err == http.ErrServerClosed {
+				err = nil
+			}
+			errs <- err
+		}()
+	}
+	err = <-errs
+	if err != nil {
+		g.Close()
+		return fmt.Errorf("serve.%s", err)
+	}
+	return nil
+}
+
+// Close stops listening, HTTP requests in progress are interrupted
+func (g *GELF) Close() error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.closed {
+		return nil
+	}
+	g.closed = true
+	if g.packet != nil {
+		g.packet.Close()
+	}
+	if g.httpServer != nil {
+		g.httpServer.Close()
+	}
+	return nil
+}
+
+func (g *GELF) isClosed() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.closed
+}
+
+// serveUDP reads plain, compressed and chunked messages
+func (g *GELF) serveUDP() error {
+	var (
+		buf        = make([]byte, maxDatagramSize)
+		nextExpire = time.Now().Add(chunkTimeout)
+	)
+	for {
+		n, addr, err := g.packet.ReadFrom(buf)
+		if err != nil {
+			if g.isClosed() {
+				return nil
+			}
+			return fmt.Errorf("ReadFrom.%s", err)
+		}
+		now := time.Now()
+		if now.After(nextExpire) {
+			if dropped := g.chunks.expire(now); dropped > 0 {
+				g.logger.Warn("incomplete gelf messages dropped", "count", dropped)
+			}
+			nextExpire = now.Add(chunkTimeout)
+		}
+		raw := buf[:n]
+		if isChunk(raw) {
+			raw, err = g.chunks.add(raw, now)
+			if err != nil {
+				g.logger.Warn("gelf chunk dropped", "sender", addr.String(), "error", err)
+				continue
+			}
+			if raw == nil {
+				continue
+			}
+		}
+		err = g.collect(raw, now)
+		if err != nil {
+			g.logger.Warn("gelf message dropped", "sender", addr.String(), "error", err)
+		}
+	}
+}
+
+// POST /gelf
+func (g *GELF) handleMessage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "gelf: expects POST requests", http.StatusMethodNotAllowed)
+		return
+	}
+	raw, err := ioutil.ReadAll(io.LimitReader(r.Body, maxMessageSize+1))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(raw) > maxMessageSize {
+		http.Error(w, ErrMessageTooLarge.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+	docBytes, err := ToDocument(raw, time.Now())
+	if err != nil {
+		http.Error(w, fmt.Sprintf("ToDocument.%s", err), http.StatusBadRequest)
+		return
+	}
+	err = g.collector.Collect(r.Context(), g.collection, g.schema, docBytes)
+	if err != nil {
+		g.logger.Warn("gelf message rejected", "sender", r.RemoteAddr, "error", err)
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (g *GELF) collect(raw []byte, receivedAt time.Time) error {
+	docBytes, err := ToDocument(raw, receivedAt)
+	if err != nil {
+		return fmt.Errorf("ToDocument.%s", err)
+	}
+	err = g.collector.Collect(context.Background(), g.collection, g.schema, docBytes)
+	if err != nil {
+		return fmt.Errorf("Collect.%s", err)
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package gelf
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"strings"
+	"time"
+)
+
+// maxMessageSize bounds decompressed messages
+const maxMessageSize = 1 << 20
+
+var (
+	// ErrMissingShortMessage - short_message is required by GELF
+	ErrMissingShortMessage = errors.New("ErrMissingShortMessage - gelf message requires a short_message")
+	// ErrMessageTooLarge -
+	ErrMessageTooLarge = errors.New("ErrMessageTooLarge - gelf message exceeds 1MB once decompressed")
+
+	gzipMagic = []byte{0x1f, 0x8b}
+)
+
+// ToDocument converts a GELF message, plain, gzip or zlib compressed, into a document.
+// Additional fields lose their leading underscore; the timestamp is rendered as a UTC datetime,
+// the reception time if the message has none.
+// ref: https://go2docs.graylog.org/current/getting_in_log_data/gelf.html
+func ToDocument(raw []byte, receivedAt time.Time) ([]byte, error) {
+	raw, err := decompress(raw)
+	if err != nil {
+		return nil, fmt.Errorf("decompress.%s", err)
+	}
+	var msg map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	err = decoder.Decode(&msg)
+	if err != nil {
+		return nil, fmt.Errorf("json.Decode.%s", err)
+	}
+	if shortMessage, ok := msg["short_message"].(string); !ok || shortMessage == "" {
+		return nil, ErrMissingShortMessage
+	}
+	doc := make(map[string]interface{}, len(msg))
+	for key, value := range msg {
+		switch {
+		case key == "version" || key == "_id":
+			// _id is reserved by GELF
+		case key == "timestamp":
+			// seconds since epoch, with optional decimal milliseconds
+			if number, ok := value.(json.Number); ok {
+				if seconds, err := number.Float64(); err == nil {
+					whole, frac := math.Modf(seconds)
+					receivedAt = time.Unix(int64(whole), int64(math.Round(frac*1e3))*int64(time.Millisecond))
+				}
+			}
+		case strings.HasPrefix(key, "_"):
+			doc[key[1:]] = value
+		default:
+			doc[key] = value
+		}
+	}
+	doc["timestamp"] = receivedAt.UTC().Format(time.RFC3339Nano)
+	return json.Marshal(doc)
+}
+
+func decompress(raw []byte) ([]byte, error) {
+	var (
+		reader io.ReadCloser
+		err    error
+	)
+	switch {
+	case bytes.HasPrefix(raw, gzipMagic):
+		reader, err = gzip.NewReader(bytes.NewReader(raw))
+	case len(raw) > 1 && raw[0]&0x0f == 8 && (uint16(raw[0])<<8|uint16(raw[1]))%31 == 0:
+		// zlib header: deflate method and checksum over the first 2 bytes
+		reader, err = zlib.NewReader(bytes.NewReader(raw))
+	default:
+		return raw, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	decompressed, err := ioutil.ReadAll(io.LimitReader(reader, maxMessageSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(decompressed) > maxMessageSize {
+		return nil, ErrMessageTooLarge
+	}
+	return decompressed, nil
+}
@@ -0,0 +1,38 @@
+package gelf
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+// FuzzToDocument checks arbitrary messages, compressed or not, convert or are rejected rather than panicking, documents being JSON objects
+func FuzzToDocument(f *testing.F) {
+	raw := []byte(`{"version":"1.1","host":"example.org","short_message":"A short message","timestamp":1385053862.3072,"level":1,"_user_id":9001,"_id":"x"}`)
+	f.Add(raw)
+	var gzipped bytes.Buffer
+	gz := gzip.NewWriter(&gzipped)
+	gz.Write(raw)
+	gz.Close()
+	f.Add(gzipped.Bytes())
+	var zlibbed bytes.Buffer
+	zw := zlib.NewWriter(&zlibbed)
+	zw.Write(raw)
+	zw.Close()
+	f.Add(zlibbed.Bytes())
+	receivedAt := time.Date(2013, time.November, 21, 17, 11, 2, 0, time.UTC)
+	f.Fuzz(func(t *testing.T, raw []byte) {
+		doc, err := ToDocument(raw, receivedAt)
+		if err != nil {
+			return
+		}
+		var fields map[string]interface{}
+		err = json.Unmarshal(doc, &fields)
+		if err != nil || fields["timestamp"] == nil {
+			t.Fatalf("document %s of %x: %v", doc, raw, err)
+		}
+	})
+}
@@ -0,0 +1,21 @@
+package input
+
+import (
+	"context"
+
+	"github.com/khezen/bulklog/pkg/collection"
+)
+
+// Interface - listener receiving documents from a protocol bulklog does not serve over HTTP
+type Interface interface {
+	// Serve blocks until the input is closed, it returns nil once closed
+	Serve() error
+	Close() error
+}
+
+// Collector appends documents to a collection, as the engine does
+type Collector interface {
+	Collect(ctx context.Context, collectionName collection.Name, schemaName collection.SchemaName, docBytes []byte) error
+	CollectBatch(ctx context.Context, collectionName collection.Name, schemaName collection.SchemaName, docBytesSlice ...[]byte) error
+	CollectBulk(ctx context.Context, collectionName collection.Name, schemaName collection.SchemaName, docBytesSlice ...[]byte) ([]error, error)
+}
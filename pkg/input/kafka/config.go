@@ -0,0 +1,25 @@
+package kafka
+
+import (
+	"github.com/khezen/bulklog/pkg/collection"
+	wire "github.com/khezen/bulklog/pkg/kafka"
+)
+
+// Config -
+type Config struct {
+	Enabled bool     `yaml:"enabled"`
+	Brokers []string `yaml:"brokers"`
+	// Group of the consumer, instances sharing it split partitions between them; defaults to bulklog
+	Group string `yaml:"group"`
+	// StartOffset of partitions the group committed no offset for, earliest|latest; defaults to latest
+	StartOffset wire.StartOffset `yaml:"start_offset"`
+	// Topics map topics to collections
+	Topics []Topic `yaml:"topics,flow"`
+}
+
+// Topic - messages of the topic are appended to Collection as Schema
+type Topic struct {
+	Topic      string                `yaml:"topic"`
+	Collection collection.Name       `yaml:"collection"`
+	Schema     collection.SchemaName `yaml:"schema"`
+}
@@ -0,0 +1,188 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/khezen/bulklog/pkg/collection"
+	wire "github.com/khezen/bulklog/pkg/kafka"
+)
+
+const (
+	defaultGroup = "bulklog"
+	// retryPeriod between attempts once brokers or collections failed
+	retryPeriod = 5 * time.Second
+)
+
+// ErrDuplicateTopic -
+var ErrDuplicateTopic = errors.New("ErrDuplicateTopic - kafka input topic is mapped to more than one collection")
+
+// Collector appends documents to a collection, see input.Collector
+type Collector interface {
+	CollectBulk(ctx context.Context, collectionName collection.Name, schemaName collection.SchemaName, docBytesSlice ...[]byte) ([]error, error)
+}
+
+// Kafka consumes topics as a member of a consumer group and appends their messages as documents.
+// Offsets are committed once messages are appended, so messages are appended at least once.
+type Kafka struct {
+	consumer  *wire.Consumer
+	topics    map[string]Topic
+	collector Collector
+	logger    *slog.Logger
+
+	ctx     context.Context
+	cancel  context.CancelFunc
+	mu      sync.Mutex
+	serving bool
+	done    chan struct{}
+}
+
+// New returns kafka as an input
+func New(cfg Config, collector Collector, logger *slog.Logger) (*Kafka, error) {
+	if cfg.Group == "" {
+		cfg.Group = defaultGroup
+	}
+	var (
+		topics = make(map[string]Topic, len(cfg.Topics))
+		names  = make([]string, 0, len(cfg.Topics))
+	)
+	for _, t := range cfg.Topics {
+		if _, ok := topics[t.Topic]; ok {
+			return nil, ErrDuplicateTopic
+		}
+		topics[t.Topic] = t
+		names = append(names, t.Topic)
+	}
+	consumer, err := wire.NewConsumer(wire.ConsumerConfig{
+		Brokers:     cfg.Brokers,
+		Group:       cfg.Group,
+		Topics:      names,
+		StartOffset: cfg.StartOffset,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("kafka.NewConsumer.%s", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Kafka{
+		consumer:  consumer,
+		topics:    topics,
+		collector: collector,
+		logger:    logger,
+		ctx:       ctx,
+		cancel:    cancel,
+		done:      make(chan struct{}),
+	}, nil
+}
+
+// Serve consumes topics until Close.
+// Messages which could not be appended are polled again, after a while, from their last committed offset.
+func (k *Kafka) Serve() error {
+	k.mu.Lock()
+	if k.ctx.Err() != nil {
+		k.mu.Unlock()
+		return nil
+	}
+	k.serving = true
+	k.mu.Unlock()
+	defer close(k.done)
+	defer func() {
+		err := k.consumer.Close()
+		if err != nil {
+			k.logger.Warn("leaving kafka consumer group failed", "error", err)
+		}
+	}()
+	k.logger.Info("opening kafka input")
+	for k.ctx.Err() == nil {
+		records, err := k.consumer.Poll()
+		if err != nil {
+			k.logger.Warn("kafka poll failed", "error", err)
+			k.wait()
+			continue
+		}
+		if len(records) == 0 {
+			continue
+		}
+		err = k.collect(records)
+		if err != nil {
+			if k.ctx.Err() != nil {
+				break
+			}
+			k.logger.Warn("kafka messages could not be appended", "error", err)
+			k.wait()
+			continue
+		}
+		err = k.consumer.Commit(records)
+		if err != nil {
+			k.logger.Warn("kafka offset commit failed", "error", err)
+		}
+	}
+	return nil
+}
+
+// Close stops consuming; messages appended but not committed yet are consumed again on restart
+func (k *Kafka) Close() error {
+	k.mu.Lock()
+	k.cancel()
+	serving := k.serving
+	k.mu.Unlock()
+	if serving {
+		<-k.done
+	}
+	return nil
+}
+
+func (k *Kafka) wait() {
+	select {
+	case <-k.ctx.Done():
+	case <-time.After(retryPeriod):
+	}
+}
+
+// collect appends records by topic; unparsable messages are dropped so they do not block their partition
+func (k *Kafka) collect(records []wire.Record) error {
+	var (
+		byTopic = make(map[string][]wire.Record)
+		order   = make([]string, 0)
+	)
+	for _, rec := range records {
+		if _, ok := byTopic[rec.Topic]; !ok {
+			order = append(order, rec.Topic)
+		}
+		byTopic[rec.Topic] = append(byTopic[rec.Topic], rec)
+	}
+	for _, topic := range order {
+		var (
+			t             = k.topics[topic]
+			recs          = byTopic[topic]
+			docBytesSlice = make([][]byte, 0, len(recs))
+		)
+		for _, rec := range recs {
+			docBytesSlice = append(docBytesSlice, toDocument(rec.Value))
+		}
+		errs, err := k.collector.CollectBulk(k.ctx, t.Collection, t.Schema, docBytesSlice...)
+		if err != nil {
+			return fmt.Errorf("CollectBulk(%s).%s", topic, err)
+		}
+		for i, docErr := range errs {
+			if docErr != nil {
+				k.logger.Warn("dropping kafka message", "topic", topic, "partition", recs[i].Partition, "offset", recs[i].Offset, "error", docErr)
+			}
+		}
+	}
+	return nil
+}
+
+// toDocument uses JSON object messages as documents, other messages are wrapped in the message field
+func toDocument(value []byte) []byte {
+	var obj map[string]json.RawMessage
+	if json.Unmarshal(value, &obj) == nil && obj != nil {
+		return value
+	}
+	doc, _ := json.Marshal(map[string]string{"message": string(value)})
+	return doc
+}
@@ -0,0 +1,22 @@
+package otlp
+
+import "github.com/khezen/bulklog/pkg/collection"
+
+// Config -
+type Config struct {
+	Enabled bool `yaml:"enabled"`
+	// HTTP listen address, such as :4318, logs are posted to /v1/logs; OTLP/HTTP is not served if empty
+	HTTP string `yaml:"http"`
+	// GRPC listen address, such as :4317; OTLP/gRPC is not served if empty
+	GRPC string `yaml:"grpc"`
+	// Routes select the collection of records by resource attributes, the first matching route is used
+	Routes []Route `yaml:"routes,flow"`
+}
+
+// Route - records whose resource has all the attributes of Match are appended to Collection as Schema,
+// a route without attributes matches every record
+type Route struct {
+	Match      map[string]string     `yaml:"match"`
+	Collection collection.Name       `yaml:"collection"`
+	Schema     collection.SchemaName `yaml:"schema"`
+}
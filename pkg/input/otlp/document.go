@@ -0,0 +1,58 @@
+package otlp
+
+import (
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/khezen/bulklog/pkg/otlp"
+)
+
+// toDocument renders a log record with its resource and scope as a document
+func toDocument(record *otlp.LogRecord, resource map[string]interface{}, scope otlp.Scope, receivedAt time.Time) map[string]interface{} {
+	timestamp := record.TimeUnixNano
+	if timestamp == 0 {
+		timestamp = record.ObservedTimeUnixNano
+	}
+	at := receivedAt
+	if timestamp != 0 {
+		at = time.Unix(0, int64(timestamp))
+	}
+	doc := map[string]interface{}{
+		"timestamp": at.UTC().Format(time.RFC3339Nano),
+		"resource":  resource,
+	}
+	if record.SeverityNumber != 0 {
+		doc["severity_number"] = record.SeverityNumber
+	}
+	if record.SeverityText != "" {
+		doc["severity_text"] = record.SeverityText
+	}
+	if record.Body != nil {
+		doc["body"] = record.Body.Interface()
+	}
+	if len(record.Attributes) > 0 {
+		doc["attributes"] = otlp.KvlistOf(record.Attributes).Interface()
+	}
+	if scope.Name != "" {
+		doc["scope"] = scope.Name
+	}
+	if len(record.TraceID) > 0 {
+		doc["trace_id"] = hex.EncodeToString(record.TraceID)
+	}
+	if len(record.SpanID) > 0 {
+		doc["span_id"] = hex.EncodeToString(record.SpanID)
+	}
+	return doc
+}
+
+// matches tells whether the resource has every attribute of the route
+func (r *Route) matches(resource map[string]interface{}) bool {
+	for key, expected := range r.Match {
+		value, ok := resource[key]
+		if !ok || fmt.Sprint(value) != expected {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,241 @@
+package otlp
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/khezen/bulklog/pkg/collection"
+	"github.com/khezen/bulklog/pkg/grpc"
+	"github.com/khezen/bulklog/pkg/otlp"
+)
+
+const (
+	logsExportMethod = "/opentelemetry.proto.collector.logs.v1.LogsService/Export"
+	// maxRequestSize bounds decompressed request bodies
+	maxRequestSize = 16 << 20
+)
+
+var (
+	// ErrNoListenAddress -
+	ErrNoListenAddress = errors.New("ErrNoListenAddress - otlp input requires an http or grpc address")
+	// ErrNoRoute - no route matches the resource of the records
+	ErrNoRoute = errors.New("ErrNoRoute - no route matches the resource attributes")
+	// ErrRequestTooLarge -
+	ErrRequestTooLarge = errors.New("ErrRequestTooLarge - otlp request exceeds 16MB")
+)
+
+// Collector appends documents to a collection, see input.Collector
+type Collector interface {
+	CollectBatch(ctx context.Context, collectionName collection.Name, schemaName collection.SchemaName, docBytesSlice ...[]byte) error
+}
+
+// OTLP receives OpenTelemetry logs over OTLP/HTTP and OTLP/gRPC and appends their records as documents
+type OTLP struct {
+	routes     []Route
+	collector  Collector
+	logger     *slog.Logger
+	httpServer *http.Server
+	grpcServer *http.Server
+}
+
+// New returns OTLP as an input
+func New(cfg Config, collector Collector, logger *slog.Logger) (*OTLP, error) {
+	if cfg.HTTP == "" && cfg.GRPC == "" {
+		return nil, ErrNoListenAddress
+	}
+	o := &OTLP{
+		routes:    cfg.Routes,
+		collector: collector,
+		logger:    logger,
+	}
+	if cfg.HTTP != "" {
+		mux := http.NewServeMux()
+		mux.HandleFunc("/v1/logs", o.handleExport)
+		o.httpServer = &http.Server{Addr: cfg.HTTP, Handler: mux}
+	}
+	if cfg.GRPC != "" {
+		mux := grpc.NewServeMux()
+		mux.HandleUnary(logsExportMethod, o.export)
+		var protocols http.Protocols
+		protocols.SetUnencryptedHTTP2(true)
+		o.grpcServer = &http.Server{Addr: cfg.GRPC, Handler: mux, Protocols: &protocols}
+	}
+	return o, nil
+}
+
+// Serve opens the HTTP and gRPC listeners and blocks until Close
+func (o *OTLP) Serve() error {
+	servers := make([]*http.Server, 0, 2)
+	for _, srv := range []*http.Server{o.httpServer, o.grpcServer} {
+		if srv != nil {
+			servers = append(servers, srv)
+		}
+	}
+	errs := make(chan error, len(servers))
+	for _, srv := range servers {
+		go func(srv *http.Server) {
+			o.logger.Info("opening otlp input", "addr", srv.Addr)
+			err := srv.ListenAndServe()
+			if err == http.ErrServerClosed {
+				err = nil
+			}
+			errs <- err
+		}(srv)
+	}
+	err := <-errs
+	if err != nil {
+		o.Close()
+		return fmt.Errorf("ListenAndServe.%s", err)
+	}
+	return nil
+}
+
+// Close stops listening, requests in progress are interrupted and retried by exporters
+func (o *OTLP) Close() error {
+	for _, srv := range []*http.Server{o.httpServer, o.grpcServer} {
+		if srv != nil {
+			srv.Close()
+		}
+	}
+	return nil
+}
+
+// POST /v1/logs, protobuf or JSON encoded
+func (o *OTLP) handleExport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "otlp: expects POST requests", http.StatusMethodNotAllowed)
+		return
+	}
+	var body io.Reader = r.Body
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		gzipReader, err := gzip.NewReader(r.Body)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("gzip.NewReader.%s", err), http.StatusBadRequest)
+			return
+		}
+		defer gzipReader.Close()
+		body = gzipReader
+	}
+	buf, err := ioutil.ReadAll(io.LimitReader(body, maxRequestSize+1))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(buf) > maxRequestSize {
+		http.Error(w, ErrRequestTooLarge.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+	isJSON := strings.HasPrefix(r.Header.Get("Content-Type"), "application/json")
+	var request otlp.ExportLogsServiceRequest
+	if isJSON {
+		err = json.Unmarshal(buf, &request)
+	} else {
+		err = request.UnmarshalProto(buf)
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("unmarshal.%s", err), http.StatusBadRequest)
+		return
+	}
+	response, err := o.collect(r.Context(), &request)
+	if err != nil {
+		// 503 is retried by exporters
+		o.logger.Warn("otlp logs rejected", "sender", r.RemoteAddr, "error", err)
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	if isJSON {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-protobuf")
+	w.WriteHeader(http.StatusOK)
+	w.Write(response.MarshalProto())
+}
+
+// rpc Export(ExportLogsServiceRequest) returns (ExportLogsServiceResponse)
+func (o *OTLP) export(ctx context.Context, buf []byte) ([]byte, error) {
+	var request otlp.ExportLogsServiceRequest
+	err := request.UnmarshalProto(buf)
+	if err != nil {
+		return nil, &grpc.Status{Code: grpc.InvalidArgument, Message: err.Error()}
+	}
+	response, err := o.collect(ctx, &request)
+	if err != nil {
+		// UNAVAILABLE is retried by exporters
+		o.logger.Warn("otlp logs rejected", "error", err)
+		return nil, &grpc.Status{Code: grpc.Unavailable, Message: err.Error()}
+	}
+	return response.MarshalProto(), nil
+}
+
+type route struct {
+	collection collection.Name
+	schema     collection.SchemaName
+}
+
+// collect appends records to the collection their resource is routed to.
+// Records no route matches are rejected as a partial success.
+func (o *OTLP) collect(ctx context.Context, request *otlp.ExportLogsServiceRequest) (*otlp.ExportLogsServiceResponse, error) {
+	var (
+		receivedAt = time.Now()
+		batches    = make(map[route][][]byte)
+		order      = make([]route, 0)
+		rejected   int64
+	)
+	for i := range request.ResourceLogs {
+		rl := &request.ResourceLogs[i]
+		resource := otlp.KvlistOf(rl.Resource.Attributes).Interface().(map[string]interface{})
+		r, ok := o.route(resource)
+		for j := range rl.ScopeLogs {
+			sl := &rl.ScopeLogs[j]
+			if !ok {
+				rejected += int64(len(sl.LogRecords))
+				continue
+			}
+			for k := range sl.LogRecords {
+				docBytes, err := json.Marshal(toDocument(&sl.LogRecords[k], resource, sl.Scope, receivedAt))
+				if err != nil {
+					return nil, fmt.Errorf("json.Marshal.%s", err)
+				}
+				if _, exists := batches[r]; !exists {
+					order = append(order, r)
+				}
+				batches[r] = append(batches[r], docBytes)
+			}
+		}
+	}
+	for _, r := range order {
+		err := o.collector.CollectBatch(ctx, r.collection, r.schema, batches[r]...)
+		if err != nil {
+			return nil, fmt.Errorf("CollectBatch(%s).%s", r.collection, err)
+		}
+	}
+	response := &otlp.ExportLogsServiceResponse{}
+	if rejected > 0 {
+		response.PartialSuccess = &otlp.ExportLogsPartialSuccess{
+			RejectedLogRecords: rejected,
+			ErrorMessage:       ErrNoRoute.Error(),
+		}
+	}
+	return response, nil
+}
+
+func (o *OTLP) route(resource map[string]interface{}) (route, bool) {
+	for i := range o.routes {
+		if o.routes[i].matches(resource) {
+			return route{o.routes[i].Collection, o.routes[i].Schema}, true
+		}
+	}
+	return route{}, false
+}
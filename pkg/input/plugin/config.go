@@ -0,0 +1,14 @@
+package plugin
+
+import (
+	"github.com/khezen/bulklog/pkg/collection"
+	"github.com/khezen/bulklog/pkg/plugin"
+)
+
+// Config -
+type Config struct {
+	plugin.Config `yaml:",inline"`
+	// Collection and Schema documents are appended to, unless batches tell otherwise
+	Collection collection.Name       `yaml:"collection"`
+	Schema     collection.SchemaName `yaml:"schema"`
+}
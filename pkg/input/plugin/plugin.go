@@ -0,0 +1,175 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/khezen/bulklog/pkg/collection"
+	"github.com/khezen/bulklog/pkg/plugin"
+)
+
+const (
+	// restartPeriod between the exit of the plugin and its restart
+	restartPeriod = 5 * time.Second
+	// stopTimeout - time the plugin has to exit once its stdin is closed
+	stopTimeout = 5 * time.Second
+)
+
+// Collector appends documents to a collection, see input.Collector
+type Collector interface {
+	CollectBulk(ctx context.Context, collectionName collection.Name, schemaName collection.SchemaName, docBytesSlice ...[]byte) ([]error, error)
+}
+
+// batch - line the plugin writes to stdout
+type batch struct {
+	// ID - if set, the batch is acknowledged once appended
+	ID         json.RawMessage       `json:"id,omitempty"`
+	Collection collection.Name       `json:"collection"`
+	Schema     collection.SchemaName `json:"schema"`
+	Documents  []json.RawMessage     `json:"documents"`
+}
+
+// ack - line written to the plugin stdin once its batch is appended, or failed to
+type ack struct {
+	ID    json.RawMessage `json:"id"`
+	Error string          `json:"error,omitempty"`
+	// Rejected - documents which are invalid, by index, those are dropped
+	Rejected map[int]string `json:"rejected,omitempty"`
+}
+
+// Plugin runs a plugin process and appends the batches it writes to stdout.
+// The process is started again after a while once it exited, until Close.
+type Plugin struct {
+	cfg       Config
+	collector Collector
+	logger    *slog.Logger
+
+	ctx     context.Context
+	cancel  context.CancelFunc
+	mu      sync.Mutex
+	serving bool
+	done    chan struct{}
+}
+
+// New returns the plugin as an input
+func New(cfg Config, collector Collector, logger *slog.Logger) (*Plugin, error) {
+	err := cfg.Validate()
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Plugin{
+		cfg:       cfg,
+		collector: collector,
+		logger:    logger,
+		ctx:       ctx,
+		cancel:    cancel,
+		done:      make(chan struct{}),
+	}, nil
+}
+
+// Serve runs the plugin until Close
+func (p *Plugin) Serve() error {
+	p.mu.Lock()
+	if p.ctx.Err() != nil {
+		p.mu.Unlock()
+		return nil
+	}
+	p.serving = true
+	p.mu.Unlock()
+	defer close(p.done)
+	p.logger.Info("starting input plugin", "command", p.cfg.Command)
+	for p.ctx.Err() == nil {
+		err := p.run()
+		if p.ctx.Err() != nil {
+			break
+		}
+		p.logger.Warn("input plugin exited", "error", err)
+		select {
+		case <-p.ctx.Done():
+		case <-time.After(restartPeriod):
+		}
+	}
+	return nil
+}
+
+// Close stops the plugin, which has a while to exit once its stdin is closed
+func (p *Plugin) Close() error {
+	p.mu.Lock()
+	p.cancel()
+	serving := p.serving
+	p.mu.Unlock()
+	if serving {
+		<-p.done
+	}
+	return nil
+}
+
+// run appends batches of the process until it exits or the input is closed
+func (p *Plugin) run() error {
+	process, err := plugin.Start(p.cfg.Config)
+	if err != nil {
+		return fmt.Errorf("plugin.Start.%s", err)
+	}
+	for {
+		select {
+		case line := <-process.Lines():
+			err = p.collect(process, line)
+			if err != nil {
+				process.Kill()
+				return err
+			}
+		case <-process.Exited():
+			return process.Err()
+		case <-p.ctx.Done():
+			return process.Close(stopTimeout)
+		}
+	}
+}
+
+func (p *Plugin) collect(process *plugin.Process, line []byte) error {
+	var b batch
+	err := json.Unmarshal(line, &b)
+	if err != nil {
+		p.logger.Warn("dropping input plugin line", "error", err)
+		return nil
+	}
+	if b.Collection == "" {
+		b.Collection = p.cfg.Collection
+	}
+	if b.Schema == "" {
+		b.Schema = p.cfg.Schema
+	}
+	docBytesSlice := make([][]byte, 0, len(b.Documents))
+	for _, doc := range b.Documents {
+		docBytesSlice = append(docBytesSlice, doc)
+	}
+	a := ack{ID: b.ID}
+	errs, err := p.collector.CollectBulk(p.ctx, b.Collection, b.Schema, docBytesSlice...)
+	if err != nil {
+		a.Error = err.Error()
+	}
+	for i, docErr := range errs {
+		if docErr != nil {
+			if a.Rejected == nil {
+				a.Rejected = make(map[int]string)
+			}
+			a.Rejected[i] = docErr.Error()
+		}
+	}
+	if len(b.ID) == 0 {
+		if a.Error != "" || len(a.Rejected) > 0 {
+			p.logger.Warn("dropping input plugin batch", "collection", b.Collection, "error", a.Error, "rejected", len(a.Rejected))
+		}
+		return nil
+	}
+	ackBytes, err := json.Marshal(a)
+	if err != nil {
+		return fmt.Errorf("json.Marshal.%s", err)
+	}
+	return process.Write(ackBytes)
+}
@@ -0,0 +1,14 @@
+package syslog
+
+import "github.com/khezen/bulklog/pkg/collection"
+
+// Config -
+type Config struct {
+	Enabled bool `yaml:"enabled"`
+	// UDP listen address, such as :514; UDP is not served if empty
+	UDP string `yaml:"udp"`
+	// TCP listen address, such as :514; TCP is not served if empty
+	TCP        string                `yaml:"tcp"`
+	Collection collection.Name       `yaml:"collection"`
+	Schema     collection.SchemaName `yaml:"schema"`
+}
@@ -0,0 +1,279 @@
+package syslog
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/khezen/bulklog/pkg/collection"
+)
+
+const (
+	// maxMessageSize bounds received messages, large enough for any UDP datagram
+	maxMessageSize = 64 << 10
+	// idleTimeout closes TCP connections which send nothing
+	idleTimeout = 5 * time.Minute
+)
+
+var (
+	// ErrNoListenAddress -
+	ErrNoListenAddress = errors.New("ErrNoListenAddress - syslog input requires a udp or tcp address")
+	// ErrMessageTooLarge -
+	ErrMessageTooLarge = errors.New("ErrMessageTooLarge - syslog message exceeds 64KB")
+)
+
+// Collector appends documents to a collection, see input.Collector
+type Collector interface {
+	Collect(ctx context.Context, collectionName collection.Name, schemaName collection.SchemaName, docBytes []byte) error
+}
+
+// Syslog listens for syslog messages and appends them as documents
+type Syslog struct {
+	udpAddr    string
+	tcpAddr    string
+	collection collection.Name
+	schema     collection.SchemaName
+	collector  Collector
+	logger     *slog.Logger
+
+	mu       sync.Mutex
+	closed   bool
+	packet   net.PacketConn
+	listener net.Listener
+	conns    map[net.Conn]struct{}
+	serving  sync.WaitGroup
+}
+
+// New returns syslog as an input
+func New(cfg Config, collector Collector, logger *slog.Logger) (*Syslog, error) {
+	if cfg.UDP == "" && cfg.TCP == "" {
+		return nil, ErrNoListenAddress
+	}
+	return &Syslog{
+		udpAddr:    cfg.UDP,
+		tcpAddr:    cfg.TCP,
+		collection: cfg.Collection,
+		schema:     cfg.Schema,
+		collector:  collector,
+		logger:     logger,
+		conns:      make(map[net.Conn]struct{}),
+	}, nil
+}
+
+// Serve opens the UDP and TCP listeners and blocks until Close
+func (s *Syslog) Serve() (err error) {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	if s.udpAddr != "" {
+		s.packet, err = net.ListenPacket("udp", s.udpAddr)
+		if err != nil {
+			s.mu.Unlock()
+			return fmt.Errorf("net.ListenPacket.%s", err)
+		}
+		s.logger.Info("opening syslog input", "network", "udp", "addr", s.packet.LocalAddr().String())
+	}
+	if s.tcpAddr != "" {
+		s.listener, err = net.Listen("tcp", s.tcpAddr)
+		if err != nil {
+			if s.packet != nil {
+				s.packet.Close()
+			}
+			s.mu.Unlock()
+			return fmt.Errorf("net.Listen.%s", err)
+		}
+		s.logger.Info("opening syslog input", "network", "tcp", "addr", s.listener.Addr().String())
+	}
+	s.mu.Unlock()
+	errs := make(chan error, 2)
+	if s.packet != nil {
+		go func() { errs <- s.serveUDP() }()
+	}
+	if s.listener != nil {
+		go func() { errs <- s.serveTCP() }()
+	}
+	err = <-errs
+	if err != nil {
+		s.Close()
+	}
+	s.serving.Wait()
+	return err
+}
+
+// Close stops listening and closes connections; messages being read are lost
+func (s *Syslog) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	if s.packet != nil {
+		s.packet.Close()
+	}
+	if s.listener != nil {
+		s.listener.Close()
+	}
+	for conn := range s.conns {
+		conn.Close()
+	}
+	return nil
+}
+
+func (s *Syslog) isClosed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closed
+}
+
+// serveUDP reads one message per datagram
+func (s *Syslog) serveUDP() error {
+	buf := make([]byte, maxMessageSize)
+	for {
+		n, addr, err := s.packet.ReadFrom(buf)
+		if err != nil {
+			if s.isClosed() {
+				return nil
+			}
+			return fmt.Errorf("ReadFrom.%s", err)
+		}
+		s.collect(buf[:n], hostOf(addr))
+	}
+}
+
+func (s *Syslog) serveTCP() error {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			if s.isClosed() {
+				return nil
+			}
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				continue
+			}
+			return fmt.Errorf("Accept.%s", err)
+		}
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			conn.Close()
+			return nil
+		}
+		s.conns[conn] = struct{}{}
+		s.serving.Add(1)
+		s.mu.Unlock()
+		go s.serveConn(conn)
+	}
+}
+
+// serveConn reads messages framed with octet counting or, if they do not start with a length, newlines (RFC6587)
+func (s *Syslog) serveConn(conn net.Conn) {
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		conn.Close()
+		s.serving.Done()
+	}()
+	var (
+		sender = hostOf(conn.RemoteAddr())
+		reader = bufio.NewReaderSize(conn, 4096)
+	)
+	for {
+		conn.SetReadDeadline(time.Now().Add(idleTimeout))
+		raw, err := readFrame(reader)
+		if len(raw) > 0 {
+			s.collect(raw, sender)
+		}
+		if err == io.EOF || (err != nil && s.isClosed()) {
+			return
+		}
+		if err != nil {
+			s.logger.Warn("syslog connection closed", "sender", sender, "error", err)
+			return
+		}
+	}
+}
+
+func readFrame(reader *bufio.Reader) ([]byte, error) {
+	first, err := reader.Peek(1)
+	if err != nil {
+		return nil, err
+	}
+	if first[0] >= '1' && first[0] <= '9' {
+		// the length fits in the buffer, senders which never send the space cannot grow memory
+		lengthStr, err := reader.ReadSlice(' ')
+		if err == bufio.ErrBufferFull {
+			return nil, ErrMessageTooLarge
+		}
+		if err != nil {
+			return nil, err
+		}
+		length, err := strconv.Atoi(string(lengthStr[:len(lengthStr)-1]))
+		if err != nil {
+			return nil, fmt.Errorf("strconv.Atoi.%s", err)
+		}
+		if length > maxMessageSize {
+			return nil, ErrMessageTooLarge
+		}
+		raw := make([]byte, length)
+		_, err = io.ReadFull(reader, raw)
+		return raw, err
+	}
+	var line []byte
+	for {
+		chunk, isPrefix, err := reader.ReadLine()
+		line = append(line, chunk...)
+		if len(line) > maxMessageSize {
+			return nil, ErrMessageTooLarge
+		}
+		if err != nil || !isPrefix {
+			if err == io.EOF && len(line) > 0 {
+				err = nil
+			}
+			return line, err
+		}
+	}
+}
+
+// collect appends the message, messages which cannot be appended are dropped as senders cannot be told
+func (s *Syslog) collect(raw []byte, sender string) {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 {
+		return
+	}
+	msg, err := ParseMessage(raw, time.Now(), sender)
+	if err != nil {
+		s.logger.Warn("syslog message dropped", "sender", sender, "error", err)
+		return
+	}
+	docBytes, err := json.Marshal(msg)
+	if err != nil {
+		s.logger.Warn("syslog message dropped", "sender", sender, "error", err)
+		return
+	}
+	err = s.collector.Collect(context.Background(), s.collection, s.schema, docBytes)
+	if err != nil {
+		s.logger.Warn("syslog message dropped", "sender", sender, "error", err)
+	}
+}
+
+func hostOf(addr net.Addr) string {
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+	return host
+}
@@ -0,0 +1,35 @@
+package syslog
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// TestReadFrameNoLengthEnd checks octet counted frames whose length never ends are rejected once the buffer is full
+func TestReadFrameNoLengthEnd(t *testing.T) {
+	reader := bufio.NewReaderSize(strings.NewReader(strings.Repeat("1", 1<<20)), 4096)
+	_, err := readFrame(reader)
+	if err != ErrMessageTooLarge {
+		t.Fatalf("readFrame of a length never ending: got %v, want %v", err, ErrMessageTooLarge)
+	}
+}
+
+// FuzzReadFrame checks arbitrary TCP streams are split into frames or rejected rather than panicking, frames staying within maxMessageSize
+func FuzzReadFrame(f *testing.F) {
+	f.Add([]byte("<34>1 2003-10-11T22:14:15.003Z mymachine su - ID47 - 'su root' failed\n<13>Oct 11 22:14:15 host app: msg\n"))
+	f.Add([]byte("11 <13>1 - - - - - -11 <13>1 - - - - - -"))
+	f.Fuzz(func(t *testing.T, stream []byte) {
+		reader := bufio.NewReaderSize(bytes.NewReader(stream), 4096)
+		for {
+			frame, err := readFrame(reader)
+			if err != nil {
+				return
+			}
+			if len(frame) > maxMessageSize {
+				t.Fatalf("frame of %d bytes", len(frame))
+			}
+		}
+	})
+}
@@ -0,0 +1,191 @@
+package syslog
+
+import (
+	"bytes"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	nilValue = "-"
+	// rfc3164Timestamp - Mmm dd hh:mm:ss, days are padded with a space
+	rfc3164Timestamp = time.Stamp
+)
+
+var (
+	// ErrMissingPriority - message does not start with <PRI>
+	ErrMissingPriority = errors.New("ErrMissingPriority - syslog message must start with <PRI>")
+	// ErrWrongPriority - PRI is not a number between 0 and 191
+	ErrWrongPriority = errors.New("ErrWrongPriority - syslog priority must be between 0 and 191")
+	// ErrMalformedHeader - RFC5424 header is missing fields
+	ErrMalformedHeader = errors.New("ErrMalformedHeader - syslog header is missing fields")
+	// ErrMalformedStructuredData - RFC5424 structured data is not closed
+	ErrMalformedStructuredData = errors.New("ErrMalformedStructuredData - syslog structured data is not closed")
+
+	bom = []byte("\xef\xbb\xbf")
+)
+
+// Message - syslog message, fields are named as in documents
+type Message struct {
+	Facility       int    `json:"facility"`
+	Severity       int    `json:"severity"`
+	Timestamp      string `json:"timestamp"`
+	Hostname       string `json:"hostname,omitempty"`
+	AppName        string `json:"app_name,omitempty"`
+	ProcID         string `json:"proc_id,omitempty"`
+	MsgID          string `json:"msg_id,omitempty"`
+	StructuredData string `json:"structured_data,omitempty"`
+	Message        string `json:"message"`
+}
+
+// ParseMessage parses RFC5424 messages, and RFC3164 ones as sent by BSD syslog devices.
+// The timestamp defaults to receivedAt, the hostname to the sender address.
+// ref: https://tools.ietf.org/html/rfc5424#section-6 https://tools.ietf.org/html/rfc3164#section-4.1
+func ParseMessage(raw []byte, receivedAt time.Time, sender string) (*Message, error) {
+	raw = bytes.TrimRight(raw, "\r\n\x00")
+	if len(raw) == 0 || raw[0] != '<' {
+		return nil, ErrMissingPriority
+	}
+	end := bytes.IndexByte(raw, '>')
+	if end < 2 || end > 4 {
+		return nil, ErrMissingPriority
+	}
+	pri, err := strconv.Atoi(string(raw[1:end]))
+	if err != nil || pri < 0 || pri > 191 {
+		return nil, ErrWrongPriority
+	}
+	msg := &Message{
+		Facility: pri / 8,
+		Severity: pri % 8,
+	}
+	rest := raw[end+1:]
+	if bytes.HasPrefix(rest, []byte("1 ")) {
+		err = msg.parseRFC5424(rest[2:])
+	} else {
+		msg.parseRFC3164(rest, receivedAt)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if msg.Timestamp == "" {
+		msg.Timestamp = receivedAt.UTC().Format(time.RFC3339Nano)
+	}
+	if msg.Hostname == "" {
+		msg.Hostname = sender
+	}
+	return msg, nil
+}
+
+// parseRFC5424 parses TIMESTAMP HOSTNAME APP-NAME PROCID MSGID STRUCTURED-DATA [MSG]
+func (m *Message) parseRFC5424(raw []byte) error {
+	fields := make([]string, 5)
+	for i := range fields {
+		field, rest, ok := bytes.Cut(raw, []byte(" "))
+		if !ok {
+			return ErrMalformedHeader
+		}
+		if string(field) != nilValue {
+			fields[i] = string(field)
+		}
+		raw = rest
+	}
+	if fields[0] != "" {
+		timestamp, err := time.Parse(time.RFC3339Nano, fields[0])
+		if err == nil {
+			m.Timestamp = timestamp.UTC().Format(time.RFC3339Nano)
+		}
+	}
+	m.Hostname, m.AppName, m.ProcID, m.MsgID = fields[1], fields[2], fields[3], fields[4]
+	sd, rest, err := cutStructuredData(raw)
+	if err != nil {
+		return err
+	}
+	m.StructuredData = sd
+	rest = bytes.TrimPrefix(rest, []byte(" "))
+	m.Message = text(bytes.TrimPrefix(rest, bom))
+	return nil
+}
+
+// cutStructuredData splits the structured data, "-" or [SD-ELEMENT]..., from the message
+func cutStructuredData(raw []byte) (string, []byte, error) {
+	if len(raw) == 0 || raw[0] != '[' {
+		sd, rest, _ := bytes.Cut(raw, []byte(" "))
+		if string(sd) == nilValue {
+			sd = nil
+		}
+		return string(sd), rest, nil
+	}
+	var quoted bool
+	for i := 0; i < len(raw); i++ {
+		switch raw[i] {
+		case '\\':
+			// escaped ", \ and ] do not delimit anything
+			i++
+		case '"':
+			quoted = !quoted
+		case ']':
+			if quoted || (i+1 < len(raw) && raw[i+1] == '[') {
+				continue
+			}
+			return string(raw[:i+1]), raw[i+1:], nil
+		}
+	}
+	return "", nil, ErrMalformedStructuredData
+}
+
+// parseRFC3164 parses TIMESTAMP HOSTNAME TAG[PID]: MSG, a message without header is kept as is
+func (m *Message) parseRFC3164(raw []byte, receivedAt time.Time) {
+	if len(raw) > len(rfc3164Timestamp) && raw[len(rfc3164Timestamp)] == ' ' {
+		timestamp, err := time.ParseInLocation(rfc3164Timestamp, string(raw[:len(rfc3164Timestamp)]), time.Local)
+		if err == nil {
+			m.Timestamp = withYear(timestamp, receivedAt).UTC().Format(time.RFC3339Nano)
+			raw = raw[len(rfc3164Timestamp)+1:]
+			hostname, rest, ok := bytes.Cut(raw, []byte(" "))
+			if ok {
+				m.Hostname = string(hostname)
+				raw = rest
+			}
+		}
+	}
+	// TAG is alphanumeric, up to 32 characters, followed by [PID] or a colon
+	end := bytes.IndexAny(raw, "[: ")
+	if end > 0 && end <= 32 && raw[end] != ' ' {
+		tag := raw[:end]
+		rest := raw[end:]
+		if rest[0] == '[' {
+			pidEnd := bytes.IndexByte(rest, ']')
+			if pidEnd > 0 {
+				m.ProcID = string(rest[1:pidEnd])
+				rest = rest[pidEnd+1:]
+			}
+		}
+		if bytes.HasPrefix(rest, []byte(":")) {
+			m.AppName = string(tag)
+			raw = bytes.TrimPrefix(rest[1:], []byte(" "))
+		} else {
+			m.ProcID = ""
+		}
+	}
+	m.Message = text(raw)
+}
+
+// withYear sets the year RFC3164 timestamps lack, the previous one if the message would be from the future,
+// such as a December message received in January
+func withYear(timestamp, receivedAt time.Time) time.Time {
+	timestamp = time.Date(receivedAt.Year(), timestamp.Month(), timestamp.Day(), timestamp.Hour(), timestamp.Minute(), timestamp.Second(), 0, time.Local)
+	if timestamp.After(receivedAt.Add(24 * time.Hour)) {
+		timestamp = timestamp.AddDate(-1, 0, 0)
+	}
+	return timestamp
+}
+
+// text replaces invalid UTF-8 so the message can be a JSON string
+func text(raw []byte) string {
+	if utf8.Valid(raw) {
+		return string(raw)
+	}
+	return strings.ToValidUTF8(string(raw), "�")
+}
@@ -0,0 +1,30 @@
+package syslog
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+// FuzzParseMessage checks arbitrary messages are parsed or rejected rather than panicking, messages parsed being valid documents
+func FuzzParseMessage(f *testing.F) {
+	f.Add([]byte("<34>1 2003-10-11T22:14:15.003Z mymachine su - ID47 - \xef\xbb\xbf'su root' failed"))
+	f.Add([]byte(`<165>1 2003-10-11T22:14:15.003Z host app 1 ID [exampleSDID@32473 iut="3" eventSource="App\]"][b] msg`))
+	f.Add([]byte("<13>Oct 11 22:14:15 host app[42]: msg"))
+	f.Add([]byte("<13>no header"))
+	receivedAt := time.Date(2003, time.October, 12, 0, 0, 0, 0, time.UTC)
+	f.Fuzz(func(t *testing.T, raw []byte) {
+		msg, err := ParseMessage(raw, receivedAt, "10.0.0.1")
+		if err != nil {
+			return
+		}
+		if !utf8.ValidString(msg.Message) {
+			t.Fatalf("message %q of %q is not valid UTF-8", msg.Message, raw)
+		}
+		_, err = json.Marshal(msg)
+		if err != nil {
+			t.Fatalf("json.Marshal of %#v: %s", msg, err)
+		}
+	})
+}
@@ -0,0 +1,112 @@
+package kafka
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// pool keeps a connection per broker
+type pool struct {
+	sync.Mutex
+	timeout time.Duration
+	conns   map[string]*conn
+}
+
+func newPool(timeout time.Duration) *pool {
+	return &pool{
+		timeout: timeout,
+		conns:   make(map[string]*conn),
+	}
+}
+
+func (p *pool) get(addr string) (*conn, error) {
+	p.Lock()
+	defer p.Unlock()
+	if c, ok := p.conns[addr]; ok {
+		return c, nil
+	}
+	netConn, err := net.DialTimeout("tcp", addr, p.timeout)
+	if err != nil {
+		return nil, fmt.Errorf("net.Dial.%s", err)
+	}
+	c := &conn{
+		Conn:   netConn,
+		reader: bufio.NewReader(netConn),
+	}
+	p.conns[addr] = c
+	return c, nil
+}
+
+func (p *pool) drop(addr string) {
+	p.Lock()
+	defer p.Unlock()
+	if c, ok := p.conns[addr]; ok {
+		c.Close()
+		delete(p.conns, addr)
+	}
+}
+
+func (p *pool) close() {
+	p.Lock()
+	defer p.Unlock()
+	for addr, c := range p.conns {
+		c.Close()
+		delete(p.conns, addr)
+	}
+}
+
+type conn struct {
+	net.Conn
+	sync.Mutex
+	reader        *bufio.Reader
+	correlationID int32
+}
+
+func (c *conn) roundTrip(apiKey, apiVersion int16, body []byte, expectResponse bool, timeout time.Duration) ([]byte, error) {
+	c.Lock()
+	defer c.Unlock()
+	c.correlationID++
+	var e encoder
+	e.int32(0) // size placeholder
+	e.int16(apiKey)
+	e.int16(apiVersion)
+	e.int32(c.correlationID)
+	id := clientID
+	e.nullableString(&id)
+	e.buf = append(e.buf, body...)
+	binary.BigEndian.PutUint32(e.buf[0:4], uint32(len(e.buf)-4))
+	err := c.SetDeadline(time.Now().Add(timeout))
+	if err != nil {
+		return nil, fmt.Errorf("SetDeadline.%s", err)
+	}
+	_, err = c.Write(e.buf)
+	if err != nil {
+		return nil, fmt.Errorf("Write.%s", err)
+	}
+	if !expectResponse {
+		return nil, nil
+	}
+	header := make([]byte, 8)
+	_, err = io.ReadFull(c.reader, header)
+	if err != nil {
+		return nil, fmt.Errorf("ReadFull.%s", err)
+	}
+	size := int32(binary.BigEndian.Uint32(header[0:4]))
+	if correlationID := int32(binary.BigEndian.Uint32(header[4:8])); correlationID != c.correlationID {
+		return nil, fmt.Errorf("kafka: unexpected correlation id %d, expected %d", correlationID, c.correlationID)
+	}
+	if size < 4 {
+		return nil, fmt.Errorf("kafka: invalid response size %d", size)
+	}
+	res := make([]byte, size-4)
+	_, err = io.ReadFull(c.reader, res)
+	if err != nil {
+		return nil, fmt.Errorf("ReadFull.%s", err)
+	}
+	return res, nil
+}
@@ -0,0 +1,496 @@
+package kafka
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// StartOffset - where a consumer group starts reading partitions it committed no offset for
+type StartOffset string
+
+const (
+	// Earliest - oldest message retained by the broker
+	Earliest StartOffset = "earliest"
+	// Latest - messages produced after the consumer joined
+	Latest StartOffset = "latest"
+)
+
+var (
+	// ErrNoGroup - consumer has no group
+	ErrNoGroup = errors.New("ErrNoGroup - kafka consumer requires a group")
+	// ErrNoTopic - consumer subscribes to no topic
+	ErrNoTopic = errors.New("ErrNoTopic - kafka consumer requires at least one topic")
+	// ErrUnknownStartOffset - start offset is not supported
+	ErrUnknownStartOffset = errors.New("ErrUnknownStartOffset - start offset must be one of earliest|latest")
+)
+
+// ConsumerConfig -
+type ConsumerConfig struct {
+	Brokers     []string
+	Group       string
+	Topics      []string
+	StartOffset StartOffset
+	// SessionTimeout after which the group coordinator evicts a consumer which stopped heartbeating
+	SessionTimeout time.Duration
+	// RebalanceTimeout members are given to rejoin the group on rebalance
+	RebalanceTimeout time.Duration
+	// MaxWait brokers wait for messages before answering a fetch
+	MaxWait time.Duration
+	// MaxBytes fetched per partition
+	MaxBytes int32
+	Timeout  time.Duration
+}
+
+// Consumer reads topics as a member of a consumer group using the kafka wire protocol.
+// Partitions are assigned with the range strategy; offsets are committed to the group coordinator.
+// Poll and Commit must be called from a single goroutine.
+type Consumer struct {
+	cfg   ConsumerConfig
+	conns *pool
+	meta  *metadata
+
+	coordinator string
+	memberID    string
+	generation  int32
+	positions   map[topicPartition]int64
+
+	rejoin     atomic.Bool
+	stop       chan struct{}
+	heartbeats sync.WaitGroup
+}
+
+// NewConsumer -
+func NewConsumer(cfg ConsumerConfig) (*Consumer, error) {
+	if cfg.Group == "" {
+		return nil, ErrNoGroup
+	}
+	if len(cfg.Topics) == 0 {
+		return nil, ErrNoTopic
+	}
+	switch cfg.StartOffset {
+	case "":
+		cfg.StartOffset = Latest
+	case Earliest, Latest:
+	default:
+		return nil, ErrUnknownStartOffset
+	}
+	if cfg.SessionTimeout <= 0 {
+		cfg.SessionTimeout = 10 * time.Second
+	}
+	if cfg.RebalanceTimeout <= 0 {
+		cfg.RebalanceTimeout = 30 * time.Second
+	}
+	if cfg.MaxWait <= 0 {
+		cfg.MaxWait = 500 * time.Millisecond
+	}
+	if cfg.MaxBytes <= 0 {
+		cfg.MaxBytes = 1 << 20
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 30 * time.Second
+	}
+	return &Consumer{
+		cfg:   cfg,
+		conns: newPool(cfg.Timeout),
+	}, nil
+}
+
+// Poll fetches records of the partitions assigned to the consumer, joining the group first as needed.
+// Positions only move forward on Commit, so records which are not committed are polled again.
+func (c *Consumer) Poll() ([]Record, error) {
+	if c.positions == nil || c.rejoin.Load() {
+		err := c.join()
+		if err != nil {
+			return nil, fmt.Errorf("join.%s", err)
+		}
+	}
+	if len(c.positions) == 0 {
+		// more members than partitions, this one waits for a rebalance
+		time.Sleep(c.cfg.MaxWait)
+		return nil, nil
+	}
+	meta, err := c.metadata()
+	if err != nil {
+		return nil, fmt.Errorf("metadata.%s", err)
+	}
+	byLeader := make(map[string]map[topicPartition]int64)
+	for tp, offset := range c.positions {
+		leader, ok := meta.leader(tp)
+		if !ok {
+			c.meta = nil
+			return nil, fmt.Errorf("kafka: no leader for %s[%d]", tp.topic, tp.partition)
+		}
+		if byLeader[leader.addr] == nil {
+			byLeader[leader.addr] = make(map[topicPartition]int64)
+		}
+		byLeader[leader.addr][tp] = offset
+	}
+	type result struct {
+		fetched map[topicPartition]fetchedPartition
+		err     error
+	}
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		results = make(map[string]result, len(byLeader))
+	)
+	for addr, offsets := range byLeader {
+		wg.Add(1)
+		go func(addr string, offsets map[topicPartition]int64) {
+			defer wg.Done()
+			fetched, err := c.fetch(addr, offsets)
+			mu.Lock()
+			results[addr] = result{fetched, err}
+			mu.Unlock()
+		}(addr, offsets)
+	}
+	wg.Wait()
+	var (
+		records    = make([]Record, 0)
+		outOfRange = make([]topicPartition, 0)
+	)
+	for addr, res := range results {
+		if res.err != nil {
+			c.meta = nil
+			return nil, fmt.Errorf("fetch(%s).%s", addr, res.err)
+		}
+		for tp, part := range res.fetched {
+			switch part.err {
+			case 0:
+				records = append(records, part.records...)
+			case errOffsetOutOfRange:
+				outOfRange = append(outOfRange, tp)
+			case errNotLeaderForPartition, errUnknownTopicOrPartition:
+				c.meta = nil
+			default:
+				return nil, fmt.Errorf("%s[%d]: %s", tp.topic, tp.partition, part.err)
+			}
+		}
+	}
+	if len(outOfRange) > 0 {
+		offsets, err := c.listOffsets(outOfRange)
+		if err != nil {
+			return nil, fmt.Errorf("listOffsets.%s", err)
+		}
+		for tp, offset := range offsets {
+			c.positions[tp] = offset
+		}
+	}
+	sort.SliceStable(records, func(i, j int) bool {
+		if records[i].Topic != records[j].Topic {
+			return records[i].Topic < records[j].Topic
+		}
+		if records[i].Partition != records[j].Partition {
+			return records[i].Partition < records[j].Partition
+		}
+		return records[i].Offset < records[j].Offset
+	})
+	return records, nil
+}
+
+// Commit moves positions past records and commits the offsets of every assigned partition.
+// Records of partitions revoked since they were polled are ignored, their new owner reads them again.
+func (c *Consumer) Commit(records []Record) error {
+	for _, rec := range records {
+		tp := topicPartition{rec.Topic, rec.Partition}
+		if offset, ok := c.positions[tp]; ok && rec.Offset >= offset {
+			c.positions[tp] = rec.Offset + 1
+		}
+	}
+	if len(c.positions) == 0 {
+		return nil
+	}
+	var e encoder
+	encodeOffsetCommitRequest(&e, c.cfg.Group, c.generation, c.memberID, c.positions)
+	res, err := c.coordinatorRoundTrip(apiKeyOffsetCommit, 2, e.buf, c.cfg.Timeout)
+	if err != nil {
+		return fmt.Errorf("coordinatorRoundTrip.%s", err)
+	}
+	err = decodeOffsetCommitResponse(&decoder{buf: res})
+	if err != nil {
+		c.handleGroupError(err)
+		return fmt.Errorf("decodeOffsetCommitResponse.%s", err)
+	}
+	return nil
+}
+
+// Close leaves the group, so its partitions are assigned to other members right away
+func (c *Consumer) Close() error {
+	c.stopHeartbeat()
+	defer c.conns.close()
+	if c.memberID == "" || c.coordinator == "" {
+		return nil
+	}
+	var e encoder
+	encodeLeaveGroupRequest(&e, c.cfg.Group, c.memberID)
+	res, err := c.coordinatorRoundTrip(apiKeyLeaveGroup, 0, e.buf, c.cfg.Timeout)
+	if err != nil {
+		return fmt.Errorf("coordinatorRoundTrip.%s", err)
+	}
+	err = decodeErrorResponse(&decoder{buf: res})
+	if err != nil {
+		return fmt.Errorf("decodeErrorResponse.%s", err)
+	}
+	return nil
+}
+
+// join joins the group, syncs the partitions assigned to the consumer and reads their committed offsets
+func (c *Consumer) join() error {
+	c.stopHeartbeat()
+	c.positions = nil
+	var e encoder
+	encodeJoinGroupRequest(&e, c.cfg.Group, c.memberID, int32(c.cfg.SessionTimeout/time.Millisecond), int32(c.cfg.RebalanceTimeout/time.Millisecond), c.cfg.Topics)
+	res, err := c.coordinatorRoundTrip(apiKeyJoinGroup, 1, e.buf, c.cfg.RebalanceTimeout+c.cfg.Timeout)
+	if err != nil {
+		return fmt.Errorf("coordinatorRoundTrip.%s", err)
+	}
+	joined, err := decodeJoinGroupResponse(&decoder{buf: res})
+	if err != nil {
+		c.handleGroupError(err)
+		return fmt.Errorf("decodeJoinGroupResponse.%s", err)
+	}
+	c.memberID, c.generation = joined.memberID, joined.generation
+	topics := append([]string{}, c.cfg.Topics...)
+	for _, member := range joined.members {
+		topics = append(topics, member.topics...)
+	}
+	c.meta, err = requestMetadata(c.conns, c.cfg.Brokers, dedupe(topics), c.cfg.Timeout)
+	if err != nil {
+		return fmt.Errorf("requestMetadata.%s", err)
+	}
+	var assignments map[string]map[string][]int32
+	if joined.leader == joined.memberID {
+		assignments = assignRange(joined.members, c.meta)
+	}
+	e = encoder{}
+	encodeSyncGroupRequest(&e, c.cfg.Group, c.generation, c.memberID, assignments)
+	res, err = c.coordinatorRoundTrip(apiKeySyncGroup, 0, e.buf, c.cfg.RebalanceTimeout+c.cfg.Timeout)
+	if err != nil {
+		return fmt.Errorf("coordinatorRoundTrip.%s", err)
+	}
+	assignment, err := decodeSyncGroupResponse(&decoder{buf: res})
+	if err != nil {
+		c.handleGroupError(err)
+		return fmt.Errorf("decodeSyncGroupResponse.%s", err)
+	}
+	positions := make(map[topicPartition]int64)
+	if len(assignment) > 0 {
+		e = encoder{}
+		encodeOffsetFetchRequest(&e, c.cfg.Group, assignment)
+		res, err = c.coordinatorRoundTrip(apiKeyOffsetFetch, 1, e.buf, c.cfg.Timeout)
+		if err != nil {
+			return fmt.Errorf("coordinatorRoundTrip.%s", err)
+		}
+		committed, err := decodeOffsetFetchResponse(&decoder{buf: res})
+		if err != nil {
+			return fmt.Errorf("decodeOffsetFetchResponse.%s", err)
+		}
+		uncommitted := make([]topicPartition, 0)
+		for topic, partitions := range assignment {
+			for _, index := range partitions {
+				tp := topicPartition{topic, index}
+				offset, ok := committed[tp]
+				if !ok || offset < 0 {
+					uncommitted = append(uncommitted, tp)
+					continue
+				}
+				positions[tp] = offset
+			}
+		}
+		if len(uncommitted) > 0 {
+			offsets, err := c.listOffsets(uncommitted)
+			if err != nil {
+				return fmt.Errorf("listOffsets.%s", err)
+			}
+			for tp, offset := range offsets {
+				positions[tp] = offset
+			}
+		}
+	}
+	c.positions = positions
+	c.rejoin.Store(false)
+	c.stop = make(chan struct{})
+	c.heartbeats.Add(1)
+	go c.heartbeat(c.stop, c.coordinator, c.generation, c.memberID)
+	return nil
+}
+
+// heartbeat keeps the consumer in the group until stopped, it flags a rejoin on rebalance
+func (c *Consumer) heartbeat(stop chan struct{}, coordinator string, generation int32, memberID string) {
+	defer c.heartbeats.Done()
+	ticker := time.NewTicker(c.cfg.SessionTimeout / 3)
+	defer ticker.Stop()
+	var e encoder
+	encodeHeartbeatRequest(&e, c.cfg.Group, generation, memberID)
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		conn, err := c.conns.get(coordinator)
+		if err != nil {
+			continue
+		}
+		res, err := conn.roundTrip(apiKeyHeartbeat, 0, e.buf, true, c.cfg.Timeout)
+		if err != nil {
+			// the session expires if the coordinator cannot be reached again, the next heartbeat tells so
+			c.conns.drop(coordinator)
+			continue
+		}
+		if err = decodeErrorResponse(&decoder{buf: res}); err != nil {
+			c.rejoin.Store(true)
+			return
+		}
+	}
+}
+
+func (c *Consumer) stopHeartbeat() {
+	if c.stop != nil {
+		close(c.stop)
+		c.stop = nil
+	}
+	c.heartbeats.Wait()
+}
+
+// handleGroupError resets the member id or the coordinator as the group coordinator requires
+func (c *Consumer) handleGroupError(err error) {
+	switch err {
+	case errUnknownMemberID:
+		c.memberID = ""
+		c.rejoin.Store(true)
+	case errIllegalGeneration, errRebalanceInProgress:
+		c.rejoin.Store(true)
+	case errNotCoordinator, errCoordinatorNotAvailable, errCoordinatorLoadInProcess:
+		c.coordinator = ""
+		c.rejoin.Store(true)
+	}
+}
+
+// coordinatorRoundTrip sends a request to the group coordinator, found first if unknown
+func (c *Consumer) coordinatorRoundTrip(apiKey, apiVersion int16, body []byte, timeout time.Duration) ([]byte, error) {
+	if c.coordinator == "" {
+		coordinator, err := c.findCoordinator()
+		if err != nil {
+			return nil, fmt.Errorf("findCoordinator.%s", err)
+		}
+		c.coordinator = coordinator
+	}
+	conn, err := c.conns.get(c.coordinator)
+	if err != nil {
+		c.coordinator = ""
+		return nil, fmt.Errorf("conn.%s", err)
+	}
+	res, err := conn.roundTrip(apiKey, apiVersion, body, true, timeout)
+	if err != nil {
+		c.conns.drop(c.coordinator)
+		c.coordinator = ""
+		return nil, fmt.Errorf("roundTrip.%s", err)
+	}
+	return res, nil
+}
+
+// metadata returns topics metadata, requested again once leaders moved
+func (c *Consumer) metadata() (*metadata, error) {
+	if c.meta != nil {
+		return c.meta, nil
+	}
+	meta, err := requestMetadata(c.conns, c.cfg.Brokers, c.cfg.Topics, c.cfg.Timeout)
+	if err != nil {
+		return nil, fmt.Errorf("requestMetadata.%s", err)
+	}
+	c.meta = meta
+	return meta, nil
+}
+
+func (c *Consumer) findCoordinator() (string, error) {
+	var e encoder
+	encodeFindCoordinatorRequest(&e, c.cfg.Group)
+	for _, addr := range c.cfg.Brokers {
+		conn, err := c.conns.get(addr)
+		if err != nil {
+			continue
+		}
+		res, err := conn.roundTrip(apiKeyFindCoordinator, 1, e.buf, true, c.cfg.Timeout)
+		if err != nil {
+			c.conns.drop(addr)
+			continue
+		}
+		return decodeFindCoordinatorResponse(&decoder{buf: res})
+	}
+	return "", ErrNoBroker
+}
+
+func (c *Consumer) fetch(addr string, offsets map[topicPartition]int64) (map[topicPartition]fetchedPartition, error) {
+	var e encoder
+	encodeFetchRequest(&e, offsets, c.cfg.MaxWait, c.cfg.MaxBytes)
+	conn, err := c.conns.get(addr)
+	if err != nil {
+		return nil, fmt.Errorf("conn.%s", err)
+	}
+	res, err := conn.roundTrip(apiKeyFetch, 4, e.buf, true, c.cfg.MaxWait+c.cfg.Timeout)
+	if err != nil {
+		c.conns.drop(addr)
+		return nil, fmt.Errorf("roundTrip.%s", err)
+	}
+	return decodeFetchResponse(&decoder{buf: res}, offsets)
+}
+
+// listOffsets reads the start offset of partitions from their leaders
+func (c *Consumer) listOffsets(tps []topicPartition) (map[topicPartition]int64, error) {
+	timestamp := latestTimestamp
+	if c.cfg.StartOffset == Earliest {
+		timestamp = earliestTimestamp
+	}
+	meta, err := c.metadata()
+	if err != nil {
+		return nil, fmt.Errorf("metadata.%s", err)
+	}
+	byLeader := make(map[string][]topicPartition)
+	for _, tp := range tps {
+		leader, ok := meta.leader(tp)
+		if !ok {
+			return nil, fmt.Errorf("kafka: no leader for %s[%d]", tp.topic, tp.partition)
+		}
+		byLeader[leader.addr] = append(byLeader[leader.addr], tp)
+	}
+	offsets := make(map[topicPartition]int64, len(tps))
+	for addr, tps := range byLeader {
+		var e encoder
+		encodeListOffsetsRequest(&e, tps, timestamp)
+		conn, err := c.conns.get(addr)
+		if err != nil {
+			return nil, fmt.Errorf("conn.%s", err)
+		}
+		res, err := conn.roundTrip(apiKeyListOffsets, 1, e.buf, true, c.cfg.Timeout)
+		if err != nil {
+			c.conns.drop(addr)
+			return nil, fmt.Errorf("roundTrip.%s", err)
+		}
+		leaderOffsets, err := decodeListOffsetsResponse(&decoder{buf: res})
+		if err != nil {
+			return nil, fmt.Errorf("decodeListOffsetsResponse.%s", err)
+		}
+		for tp, offset := range leaderOffsets {
+			offsets[tp] = offset
+		}
+	}
+	return offsets, nil
+}
+
+func dedupe(values []string) []string {
+	seen := make(map[string]struct{}, len(values))
+	unique := values[:0]
+	for _, v := range values {
+		if _, ok := seen[v]; ok {
+			continue
+		}
+		seen[v] = struct{}{}
+		unique = append(unique, v)
+	}
+	return unique
+}
@@ -0,0 +1,226 @@
+package kafka
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"time"
+)
+
+// timestamps of list offsets requests
+const (
+	earliestTimestamp int64 = -2
+	latestTimestamp   int64 = -1
+)
+
+type topicPartition struct {
+	topic     string
+	partition int32
+}
+
+// Record - consumed message
+type Record struct {
+	Topic     string
+	Partition int32
+	Offset    int64
+	Key       []byte
+	Value     []byte
+	Time      time.Time
+}
+
+type fetchedPartition struct {
+	err     Error
+	records []Record
+}
+
+// encodeListOffsetsRequest encodes a list offsets v1 request
+func encodeListOffsetsRequest(e *encoder, tps []topicPartition, timestamp int64) {
+	e.int32(-1) // replica id
+	byTopic := make(map[string][]int32)
+	for _, tp := range tps {
+		byTopic[tp.topic] = append(byTopic[tp.topic], tp.partition)
+	}
+	e.int32(int32(len(byTopic)))
+	for topic, partitions := range byTopic {
+		e.string(topic)
+		e.int32(int32(len(partitions)))
+		for _, index := range partitions {
+			e.int32(index)
+			e.int64(timestamp)
+		}
+	}
+}
+
+// decodeListOffsetsResponse decodes a list offsets v1 response
+func decodeListOffsetsResponse(d *decoder) (map[topicPartition]int64, error) {
+	offsets := make(map[topicPartition]int64)
+	topicsLen := d.int32()
+	for i := int32(0); i < topicsLen && d.err == nil; i++ {
+		topic := d.string()
+		partsLen := d.int32()
+		for j := int32(0); j < partsLen && d.err == nil; j++ {
+			index := d.int32()
+			errCode := d.int16()
+			d.int64() // timestamp
+			offset := d.int64()
+			if errCode != 0 {
+				return nil, fmt.Errorf("%s[%d]: %s", topic, index, Error(errCode))
+			}
+			offsets[topicPartition{topic, index}] = offset
+		}
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+	return offsets, nil
+}
+
+// encodeFetchRequest encodes a fetch v4 request
+func encodeFetchRequest(e *encoder, offsets map[topicPartition]int64, maxWait time.Duration, maxBytes int32) {
+	e.int32(-1) // replica id
+	e.int32(int32(maxWait / time.Millisecond))
+	e.int32(1) // min bytes
+	e.int32(maxBytes)
+	e.int8(0) // isolation level: read uncommitted
+	byTopic := make(map[string][]topicPartition)
+	for tp := range offsets {
+		byTopic[tp.topic] = append(byTopic[tp.topic], tp)
+	}
+	e.int32(int32(len(byTopic)))
+	for topic, tps := range byTopic {
+		e.string(topic)
+		e.int32(int32(len(tps)))
+		for _, tp := range tps {
+			e.int32(tp.partition)
+			e.int64(offsets[tp])
+			e.int32(maxBytes)
+		}
+	}
+}
+
+// decodeFetchResponse decodes a fetch v4 response,
+// records before the offsets fetched, which compressed batches may hold, are dropped
+func decodeFetchResponse(d *decoder, offsets map[topicPartition]int64) (map[topicPartition]fetchedPartition, error) {
+	fetched := make(map[topicPartition]fetchedPartition)
+	d.int32() // throttle time
+	topicsLen := d.int32()
+	for i := int32(0); i < topicsLen && d.err == nil; i++ {
+		topic := d.string()
+		partsLen := d.int32()
+		for j := int32(0); j < partsLen && d.err == nil; j++ {
+			tp := topicPartition{topic, d.int32()}
+			errCode := d.int16()
+			d.int64() // high watermark
+			d.int64() // last stable offset
+			abortedLen := d.int32()
+			for k := int32(0); k < abortedLen && d.err == nil; k++ {
+				d.int64() // producer id
+				d.int64() // first offset
+			}
+			recordSet := d.bytes()
+			if d.err != nil {
+				break
+			}
+			if errCode != 0 {
+				fetched[tp] = fetchedPartition{err: Error(errCode)}
+				continue
+			}
+			records, err := decodeRecordBatches(tp, recordSet, offsets[tp])
+			if err != nil {
+				return nil, fmt.Errorf("%s[%d]: %s", tp.topic, tp.partition, err)
+			}
+			fetched[tp] = fetchedPartition{records: records}
+		}
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+	return fetched, nil
+}
+
+// decodeRecordBatches decodes v2 record batches, the last one is ignored if truncated
+func decodeRecordBatches(tp topicPartition, b []byte, from int64) ([]Record, error) {
+	records := make([]Record, 0)
+	for len(b) >= 12 {
+		d := &decoder{buf: b}
+		baseOffset := d.int64()
+		batchLen := d.int32()
+		if int(batchLen) > len(d.buf) {
+			break
+		}
+		batch := &decoder{buf: d.next(int(batchLen))}
+		b = d.buf
+		batch.int32() // partition leader epoch
+		if magic := batch.int8(); magic != 2 {
+			return nil, fmt.Errorf("unsupported record batch version %d", magic)
+		}
+		batch.int32() // crc
+		attributes := batch.int16()
+		batch.int32() // last offset delta
+		firstTimestamp := batch.int64()
+		maxTimestamp := batch.int64()
+		batch.int64() // producer id
+		batch.int16() // producer epoch
+		batch.int32() // base sequence
+		count := batch.int32()
+		if batch.err != nil {
+			return nil, batch.err
+		}
+		if attributes&0x20 != 0 {
+			// control batch, such as a transaction marker
+			continue
+		}
+		switch attributes & 0x07 {
+		case 0:
+		case 1:
+			gz, err := gzip.NewReader(bytes.NewReader(batch.buf))
+			if err != nil {
+				return nil, fmt.Errorf("gzip.NewReader.%s", err)
+			}
+			batch.buf, err = ioutil.ReadAll(gz)
+			if err != nil {
+				return nil, fmt.Errorf("gzip.Read.%s", err)
+			}
+		default:
+			return nil, fmt.Errorf("unsupported compression codec %d", attributes&0x07)
+		}
+		logAppendTime := attributes&0x08 != 0
+		for i := int32(0); i < count && batch.err == nil; i++ {
+			rec := &decoder{buf: batch.next(int(batch.varint()))}
+			rec.int8() // attributes
+			timestampDelta := rec.varint()
+			offsetDelta := rec.varint()
+			key := rec.varbytes()
+			value := rec.varbytes()
+			headersLen := rec.varint()
+			for k := int64(0); k < headersLen && rec.err == nil; k++ {
+				rec.varbytes() // key
+				rec.varbytes() // value
+			}
+			if rec.err != nil {
+				return nil, rec.err
+			}
+			offset := baseOffset + offsetDelta
+			if offset < from {
+				continue
+			}
+			timestamp := firstTimestamp + timestampDelta
+			if logAppendTime {
+				timestamp = maxTimestamp
+			}
+			records = append(records, Record{
+				Topic:     tp.topic,
+				Partition: tp.partition,
+				Offset:    offset,
+				Key:       key,
+				Value:     value,
+				Time:      time.Unix(0, timestamp*int64(time.Millisecond)).UTC(),
+			})
+		}
+		if batch.err != nil {
+			return nil, batch.err
+		}
+	}
+	return records, nil
+}
@@ -0,0 +1,89 @@
+package kafka
+
+import (
+	"encoding/hex"
+	"testing"
+	"time"
+)
+
+func TestEncodeFetchRequestGolden(t *testing.T) {
+	var e encoder
+	encodeFetchRequest(&e, map[topicPartition]int64{{"logs", 3}: 42}, 500*time.Millisecond, 1<<20)
+	want := "ffffffff" + // replica id
+		"000001f4" + // max wait ms
+		"00000001" + // min bytes
+		"00100000" + // max bytes
+		"00" + // isolation level
+		"00000001" + "00046c6f6773" + // topics, logs
+		"00000001" + "00000003" + "000000000000002a" + "00100000" // partitions, index, fetch offset, partition max bytes
+	if got := hex.EncodeToString(e.buf); got != want {
+		t.Fatalf("fetch request =\n%s\nwant\n%s", got, want)
+	}
+}
+
+// goldenFetchResponse - fetch v4 response of goldenBatch for partition 3 of topic logs, and of an error for partition 4
+const goldenFetchResponse = "00000000" + // throttle time
+	"00000001" + "00046c6f6773" + // topics, logs
+	"00000002" + // partitions
+	"00000003" + "0000" + "0000000000000002" + "0000000000000002" + "00000000" + // index, error, high watermark, last stable offset, aborted transactions
+	"0000005e" + goldenBatch + // record set
+	"00000004" + "0001" + "ffffffffffffffff" + "ffffffffffffffff" + "ffffffff" + "ffffffff" // offset out of range, null record set
+
+// goldenListOffsetsResponse - list offsets v1 response of offset 16 for partition 3 of topic logs
+const goldenListOffsetsResponse = "00000001" + "00046c6f6773" + "00000001" + "00000003" + "0000" + "ffffffffffffffff" + "0000000000000010"
+
+func TestDecodeFetchResponseGolden(t *testing.T) {
+	buf, err := hex.DecodeString(goldenFetchResponse)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fetched, err := decodeFetchResponse(&decoder{buf: buf}, map[topicPartition]int64{{"logs", 3}: 1, {"logs", 4}: 7})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertRecords(t, fetched[topicPartition{"logs", 3}].records, []Record{
+		{Topic: "logs", Partition: 3, Offset: 1, Value: []byte(`{"msg":"served"}`), Time: batchTime.Add(1500 * time.Millisecond)},
+	})
+	if err := fetched[topicPartition{"logs", 4}].err; err != errOffsetOutOfRange {
+		t.Fatalf("partition 4 error = %v, want %v", err, errOffsetOutOfRange)
+	}
+	_, err = decodeFetchResponse(&decoder{buf: buf[:30]}, nil)
+	if err != errShortBuffer {
+		t.Fatalf("truncated response: got %v, want %v", err, errShortBuffer)
+	}
+}
+
+func TestListOffsetsGolden(t *testing.T) {
+	var e encoder
+	encodeListOffsetsRequest(&e, []topicPartition{{"logs", 3}}, earliestTimestamp)
+	want := "ffffffff" + "00000001" + "00046c6f6773" + "00000001" + "00000003" + "fffffffffffffffe"
+	if got := hex.EncodeToString(e.buf); got != want {
+		t.Fatalf("list offsets request =\n%s\nwant\n%s", got, want)
+	}
+	buf, _ := hex.DecodeString(goldenListOffsetsResponse)
+	offsets, err := decodeListOffsetsResponse(&decoder{buf: buf})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if offset := offsets[topicPartition{"logs", 3}]; offset != 16 {
+		t.Fatalf("offset = %d, want 16", offset)
+	}
+}
+
+// FuzzDecodeFetchResponse checks arbitrary fetch responses are decoded or rejected rather than panicking
+func FuzzDecodeFetchResponse(f *testing.F) {
+	buf, _ := hex.DecodeString(goldenFetchResponse)
+	f.Add(buf)
+	f.Fuzz(func(t *testing.T, buf []byte) {
+		decodeFetchResponse(&decoder{buf: buf}, map[topicPartition]int64{{"logs", 3}: 1})
+	})
+}
+
+// FuzzDecodeListOffsetsResponse checks arbitrary list offsets responses are decoded or rejected rather than panicking
+func FuzzDecodeListOffsetsResponse(f *testing.F) {
+	buf, _ := hex.DecodeString(goldenListOffsetsResponse)
+	f.Add(buf)
+	f.Fuzz(func(t *testing.T, buf []byte) {
+		decodeListOffsetsResponse(&decoder{buf: buf})
+	})
+}
@@ -0,0 +1,304 @@
+package kafka
+
+import (
+	"fmt"
+	"sort"
+)
+
+// consumerProtocol is the only partition assignment strategy bulklog consumers support
+const consumerProtocol = "range"
+
+type groupMember struct {
+	id     string
+	topics []string
+}
+
+type joinResult struct {
+	generation int32
+	leader     string
+	memberID   string
+	members    []groupMember
+}
+
+// encodeFindCoordinatorRequest encodes a find coordinator v1 request for a group
+func encodeFindCoordinatorRequest(e *encoder, group string) {
+	e.string(group)
+	e.int8(0) // key type: group
+}
+
+// decodeFindCoordinatorResponse decodes a find coordinator v1 response
+func decodeFindCoordinatorResponse(d *decoder) (string, error) {
+	d.int32() // throttle time
+	errCode := d.int16()
+	d.string() // error message
+	d.int32()  // node id
+	host := d.string()
+	port := d.int32()
+	if d.err != nil {
+		return "", d.err
+	}
+	if errCode != 0 {
+		return "", Error(errCode)
+	}
+	return fmt.Sprintf("%s:%d", host, port), nil
+}
+
+// encodeJoinGroupRequest encodes a join group v1 request
+func encodeJoinGroupRequest(e *encoder, group, memberID string, sessionTimeout, rebalanceTimeout int32, topics []string) {
+	e.string(group)
+	e.int32(sessionTimeout)
+	e.int32(rebalanceTimeout)
+	e.string(memberID)
+	e.string("consumer")
+	e.int32(1)
+	e.string(consumerProtocol)
+	var meta encoder
+	meta.int16(0) // version
+	meta.int32(int32(len(topics)))
+	for _, topic := range topics {
+		meta.string(topic)
+	}
+	meta.bytes(nil) // user data
+	e.bytes(meta.buf)
+}
+
+// decodeJoinGroupResponse decodes a join group v1 response
+func decodeJoinGroupResponse(d *decoder) (*joinResult, error) {
+	errCode := d.int16()
+	res := &joinResult{generation: d.int32()}
+	d.string() // protocol
+	res.leader = d.string()
+	res.memberID = d.string()
+	membersLen := d.int32()
+	for i := int32(0); i < membersLen && d.err == nil; i++ {
+		member := groupMember{id: d.string()}
+		meta := &decoder{buf: d.bytes()}
+		meta.int16() // version
+		topicsLen := meta.int32()
+		for j := int32(0); j < topicsLen && meta.err == nil; j++ {
+			member.topics = append(member.topics, meta.string())
+		}
+		if meta.err != nil {
+			return nil, fmt.Errorf("member %s metadata: %s", member.id, meta.err)
+		}
+		res.members = append(res.members, member)
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+	if errCode != 0 {
+		return nil, Error(errCode)
+	}
+	return res, nil
+}
+
+// encodeSyncGroupRequest encodes a sync group v0 request, only the leader sends assignments
+func encodeSyncGroupRequest(e *encoder, group string, generation int32, memberID string, assignments map[string]map[string][]int32) {
+	e.string(group)
+	e.int32(generation)
+	e.string(memberID)
+	members := make([]string, 0, len(assignments))
+	for member := range assignments {
+		members = append(members, member)
+	}
+	sort.Strings(members)
+	e.int32(int32(len(members)))
+	for _, member := range members {
+		e.string(member)
+		e.bytes(encodeAssignment(assignments[member]))
+	}
+}
+
+// decodeSyncGroupResponse decodes a sync group v0 response
+func decodeSyncGroupResponse(d *decoder) (map[string][]int32, error) {
+	errCode := d.int16()
+	assignment := d.bytes()
+	if d.err != nil {
+		return nil, d.err
+	}
+	if errCode != 0 {
+		return nil, Error(errCode)
+	}
+	return decodeAssignment(assignment)
+}
+
+func encodeAssignment(assignment map[string][]int32) []byte {
+	topics := make([]string, 0, len(assignment))
+	for topic := range assignment {
+		topics = append(topics, topic)
+	}
+	sort.Strings(topics)
+	var e encoder
+	e.int16(0) // version
+	e.int32(int32(len(topics)))
+	for _, topic := range topics {
+		e.string(topic)
+		e.int32(int32(len(assignment[topic])))
+		for _, index := range assignment[topic] {
+			e.int32(index)
+		}
+	}
+	e.bytes(nil) // user data
+	return e.buf
+}
+
+func decodeAssignment(b []byte) (map[string][]int32, error) {
+	assignment := make(map[string][]int32)
+	if len(b) == 0 {
+		// the member was assigned no partition
+		return assignment, nil
+	}
+	d := &decoder{buf: b}
+	d.int16() // version
+	topicsLen := d.int32()
+	for i := int32(0); i < topicsLen && d.err == nil; i++ {
+		topic := d.string()
+		partsLen := d.int32()
+		for j := int32(0); j < partsLen && d.err == nil; j++ {
+			assignment[topic] = append(assignment[topic], d.int32())
+		}
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+	return assignment, nil
+}
+
+// assignRange spreads partitions of each topic over its members in contiguous ranges,
+// as the range assignor of the java client does
+func assignRange(members []groupMember, meta *metadata) map[string]map[string][]int32 {
+	assignments := make(map[string]map[string][]int32, len(members))
+	byTopic := make(map[string][]string)
+	for _, member := range members {
+		assignments[member.id] = make(map[string][]int32)
+		for _, topic := range member.topics {
+			byTopic[topic] = append(byTopic[topic], member.id)
+		}
+	}
+	for topic, memberIDs := range byTopic {
+		sort.Strings(memberIDs)
+		partitions := make([]int32, 0, len(meta.topics[topic]))
+		for _, part := range meta.topics[topic] {
+			partitions = append(partitions, part.index)
+		}
+		sort.Slice(partitions, func(i, j int) bool {
+			return partitions[i] < partitions[j]
+		})
+		per, extra := len(partitions)/len(memberIDs), len(partitions)%len(memberIDs)
+		start := 0
+		for i, memberID := range memberIDs {
+			n := per
+			if i < extra {
+				n++
+			}
+			if n > 0 {
+				assignments[memberID][topic] = partitions[start : start+n]
+			}
+			start += n
+		}
+	}
+	return assignments
+}
+
+// encodeHeartbeatRequest encodes a heartbeat v0 request
+func encodeHeartbeatRequest(e *encoder, group string, generation int32, memberID string) {
+	e.string(group)
+	e.int32(generation)
+	e.string(memberID)
+}
+
+// encodeLeaveGroupRequest encodes a leave group v0 request
+func encodeLeaveGroupRequest(e *encoder, group, memberID string) {
+	e.string(group)
+	e.string(memberID)
+}
+
+// decodeErrorResponse decodes heartbeat and leave group v0 responses, which only hold an error code
+func decodeErrorResponse(d *decoder) error {
+	errCode := d.int16()
+	if d.err != nil {
+		return d.err
+	}
+	if errCode != 0 {
+		return Error(errCode)
+	}
+	return nil
+}
+
+// encodeOffsetFetchRequest encodes an offset fetch v1 request
+func encodeOffsetFetchRequest(e *encoder, group string, assignment map[string][]int32) {
+	e.string(group)
+	e.int32(int32(len(assignment)))
+	for topic, partitions := range assignment {
+		e.string(topic)
+		e.int32(int32(len(partitions)))
+		for _, index := range partitions {
+			e.int32(index)
+		}
+	}
+}
+
+// decodeOffsetFetchResponse decodes an offset fetch v1 response,
+// partitions the group committed no offset for are -1
+func decodeOffsetFetchResponse(d *decoder) (map[topicPartition]int64, error) {
+	offsets := make(map[topicPartition]int64)
+	topicsLen := d.int32()
+	for i := int32(0); i < topicsLen && d.err == nil; i++ {
+		topic := d.string()
+		partsLen := d.int32()
+		for j := int32(0); j < partsLen && d.err == nil; j++ {
+			index := d.int32()
+			offset := d.int64()
+			d.string() // metadata
+			errCode := d.int16()
+			if errCode != 0 {
+				return nil, fmt.Errorf("%s[%d]: %s", topic, index, Error(errCode))
+			}
+			offsets[topicPartition{topic, index}] = offset
+		}
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+	return offsets, nil
+}
+
+// encodeOffsetCommitRequest encodes an offset commit v2 request
+func encodeOffsetCommitRequest(e *encoder, group string, generation int32, memberID string, offsets map[topicPartition]int64) {
+	e.string(group)
+	e.int32(generation)
+	e.string(memberID)
+	e.int64(-1) // retention time: broker default
+	byTopic := make(map[string][]topicPartition)
+	for tp := range offsets {
+		byTopic[tp.topic] = append(byTopic[tp.topic], tp)
+	}
+	e.int32(int32(len(byTopic)))
+	for topic, tps := range byTopic {
+		e.string(topic)
+		e.int32(int32(len(tps)))
+		for _, tp := range tps {
+			e.int32(tp.partition)
+			e.int64(offsets[tp])
+			e.nullableString(nil)
+		}
+	}
+}
+
+// decodeOffsetCommitResponse decodes an offset commit v2 response
+func decodeOffsetCommitResponse(d *decoder) error {
+	topicsLen := d.int32()
+	for i := int32(0); i < topicsLen && d.err == nil; i++ {
+		d.string() // topic
+		partsLen := d.int32()
+		for j := int32(0); j < partsLen && d.err == nil; j++ {
+			d.int32() // partition
+			errCode := d.int16()
+			if errCode != 0 {
+				// returned as is, so the consumer can tell it must rejoin the group
+				return Error(errCode)
+			}
+		}
+	}
+	return d.err
+}
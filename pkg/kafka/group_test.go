@@ -0,0 +1,149 @@
+package kafka
+
+import (
+	"encoding/hex"
+	"reflect"
+	"testing"
+)
+
+// TestJoinGroupRequestGolden checks members subscribe with the consumer protocol of java consumers, so they may share a group
+func TestJoinGroupRequestGolden(t *testing.T) {
+	var e encoder
+	encodeJoinGroupRequest(&e, "bulklog", "", 10000, 30000, []string{"logs"})
+	want := "0007" + hex.EncodeToString([]byte("bulklog")) + // group id
+		"00002710" + // session timeout
+		"00007530" + // rebalance timeout
+		"0000" + // member id
+		"0008" + hex.EncodeToString([]byte("consumer")) + // protocol type
+		"00000001" + "0005" + hex.EncodeToString([]byte("range")) + // protocols, name
+		"00000010" + "0000" + "00000001" + "00046c6f6773" + "00000000" // subscription: version, topics, empty user data
+	if got := hex.EncodeToString(e.buf); got != want {
+		t.Fatalf("join group request =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestAssignmentGolden(t *testing.T) {
+	assignment := map[string][]int32{"logs": {0, 2}, "audit": {1}}
+	want := "0000" + "00000002" + // version, topics
+		"0005" + hex.EncodeToString([]byte("audit")) + "00000001" + "00000001" +
+		"0004" + hex.EncodeToString([]byte("logs")) + "00000002" + "00000000" + "00000002" +
+		"00000000" // empty user data
+	encoded := encodeAssignment(assignment)
+	if got := hex.EncodeToString(encoded); got != want {
+		t.Fatalf("assignment =\n%s\nwant\n%s", got, want)
+	}
+	decoded, err := decodeAssignment(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, assignment) {
+		t.Fatalf("decoded assignment %v, want %v", decoded, assignment)
+	}
+	decoded, err = decodeAssignment(nil)
+	if err != nil || len(decoded) != 0 {
+		t.Fatalf("empty assignment = %v, %v", decoded, err)
+	}
+}
+
+// TestAssignRange checks partitions are assigned as the java range assignor does:
+// contiguous ranges in member id order, the first members taking one more partition when they do not divide evenly
+func TestAssignRange(t *testing.T) {
+	meta := &metadata{topics: map[string][]partition{
+		"logs":  {{6, 1}, {5, 1}, {4, 1}, {3, 1}, {2, 1}, {1, 1}, {0, 1}},
+		"audit": {{0, 1}},
+	}}
+	members := []groupMember{
+		{id: "c", topics: []string{"logs"}},
+		{id: "a", topics: []string{"logs", "audit"}},
+		{id: "b", topics: []string{"logs", "audit"}},
+	}
+	want := map[string]map[string][]int32{
+		"a": {"logs": {0, 1, 2}, "audit": {0}},
+		"b": {"logs": {3, 4}},
+		"c": {"logs": {5, 6}},
+	}
+	if got := assignRange(members, meta); !reflect.DeepEqual(got, want) {
+		t.Fatalf("assignRange = %v, want %v", got, want)
+	}
+}
+
+func TestOffsetCommitRoundTrip(t *testing.T) {
+	var e encoder
+	encodeOffsetCommitRequest(&e, "bulklog", 3, "member-1", map[topicPartition]int64{{"logs", 0}: 42})
+	d := &decoder{buf: e.buf}
+	group, generation, member := d.string(), d.int32(), d.string()
+	retention := d.int64()
+	topics, topic, partitions, index, offset := d.int32(), d.string(), d.int32(), d.int32(), d.int64()
+	metadata := d.string()
+	if d.err != nil || len(d.buf) != 0 {
+		t.Fatalf("offset commit request: %v, %d trailing bytes", d.err, len(d.buf))
+	}
+	if group != "bulklog" || generation != 3 || member != "member-1" || retention != -1 ||
+		topics != 1 || topic != "logs" || partitions != 1 || index != 0 || offset != 42 || metadata != "" {
+		t.Fatalf("offset commit request %s %d %s %d %d %s %d %d %d %q", group, generation, member, retention, topics, topic, partitions, index, offset, metadata)
+	}
+}
+
+// FuzzDecodeAssignment checks arbitrary assignments of group leaders are decoded or rejected rather than panicking, and assignments decoded encode back to themselves
+func FuzzDecodeAssignment(f *testing.F) {
+	f.Add(encodeAssignment(map[string][]int32{"logs": {0, 2}, "audit": {1}}))
+	f.Add([]byte{})
+	f.Fuzz(func(t *testing.T, b []byte) {
+		assignment, err := decodeAssignment(b)
+		if err != nil {
+			return
+		}
+		decoded, err := decodeAssignment(encodeAssignment(assignment))
+		if err != nil || !reflect.DeepEqual(decoded, assignment) {
+			t.Fatalf("assignment %v decoded from %x round trips as %v, %v", assignment, b, decoded, err)
+		}
+	})
+}
+
+// FuzzDecodeGroupResponses checks arbitrary responses of group coordinators are decoded or rejected rather than panicking
+func FuzzDecodeGroupResponses(f *testing.F) {
+	var coordinator encoder
+	coordinator.int32(0)
+	coordinator.int16(0)
+	coordinator.nullableString(nil)
+	coordinator.int32(1)
+	coordinator.string("localhost")
+	coordinator.int32(9092)
+	f.Add(coordinator.buf)
+	var join encoder
+	join.int16(0)
+	join.int32(3)
+	join.string(consumerProtocol)
+	join.string("member-1")
+	join.string("member-1")
+	join.int32(1)
+	join.string("member-1")
+	var meta encoder
+	meta.int16(0)
+	meta.int32(1)
+	meta.string("logs")
+	meta.bytes(nil)
+	join.bytes(meta.buf)
+	f.Add(join.buf)
+	var sync encoder
+	sync.int16(0)
+	sync.bytes(encodeAssignment(map[string][]int32{"logs": {0}}))
+	f.Add(sync.buf)
+	var offsets encoder
+	offsets.int32(1)
+	offsets.string("logs")
+	offsets.int32(1)
+	offsets.int32(0)
+	offsets.int64(42)
+	offsets.nullableString(nil)
+	offsets.int16(0)
+	f.Add(offsets.buf)
+	f.Fuzz(func(t *testing.T, buf []byte) {
+		decodeFindCoordinatorResponse(&decoder{buf: buf})
+		decodeJoinGroupResponse(&decoder{buf: buf})
+		decodeSyncGroupResponse(&decoder{buf: buf})
+		decodeOffsetFetchResponse(&decoder{buf: buf})
+		decodeOffsetCommitResponse(&decoder{buf: buf})
+		decodeErrorResponse(&decoder{buf: buf})
+	})
+}
@@ -0,0 +1,108 @@
+package kafka
+
+import (
+	"fmt"
+	"time"
+)
+
+type broker struct {
+	nodeID int32
+	addr   string
+}
+
+type partition struct {
+	index  int32
+	leader int32
+}
+
+type metadata struct {
+	brokers map[int32]broker
+	topics  map[string][]partition
+}
+
+// requestMetadata asks the first bootstrap broker which can be reached for metadata of topics
+func requestMetadata(conns *pool, brokers, topics []string, timeout time.Duration) (*metadata, error) {
+	var e encoder
+	encodeMetadataRequest(&e, topics)
+	for _, addr := range brokers {
+		c, err := conns.get(addr)
+		if err != nil {
+			continue
+		}
+		res, err := c.roundTrip(apiKeyMetadata, 1, e.buf, true, timeout)
+		if err != nil {
+			conns.drop(addr)
+			continue
+		}
+		meta, err := decodeMetadataResponse(&decoder{buf: res})
+		if err != nil {
+			return nil, fmt.Errorf("decodeMetadataResponse.%s", err)
+		}
+		return meta, nil
+	}
+	return nil, ErrNoBroker
+}
+
+func (m *metadata) leader(tp topicPartition) (broker, bool) {
+	for _, part := range m.topics[tp.topic] {
+		if part.index == tp.partition {
+			b, ok := m.brokers[part.leader]
+			return b, ok
+		}
+	}
+	return broker{}, false
+}
+
+func encodeMetadataRequest(e *encoder, topics []string) {
+	e.int32(int32(len(topics)))
+	for _, topic := range topics {
+		e.string(topic)
+	}
+}
+
+// decodeMetadataResponse decodes a metadata v1 response
+func decodeMetadataResponse(d *decoder) (*metadata, error) {
+	meta := &metadata{
+		brokers: make(map[int32]broker),
+		topics:  make(map[string][]partition),
+	}
+	brokersLen := d.int32()
+	for i := int32(0); i < brokersLen && d.err == nil; i++ {
+		nodeID := d.int32()
+		host := d.string()
+		port := d.int32()
+		d.string() // rack
+		meta.brokers[nodeID] = broker{nodeID, fmt.Sprintf("%s:%d", host, port)}
+	}
+	d.int32() // controller id
+	topicsLen := d.int32()
+	for i := int32(0); i < topicsLen && d.err == nil; i++ {
+		errCode := d.int16()
+		name := d.string()
+		d.int8() // is internal
+		partitionsLen := d.int32()
+		partitions := make([]partition, 0)
+		for j := int32(0); j < partitionsLen && d.err == nil; j++ {
+			d.int16() // partition error code
+			index := d.int32()
+			leader := d.int32()
+			replicasLen := d.int32()
+			for k := int32(0); k < replicasLen && d.err == nil; k++ {
+				d.int32()
+			}
+			isrLen := d.int32()
+			for k := int32(0); k < isrLen && d.err == nil; k++ {
+				d.int32()
+			}
+			partitions = append(partitions, partition{index, leader})
+		}
+		if errCode != 0 {
+			return nil, fmt.Errorf("topic %s: %s", name, Error(errCode))
+		}
+		meta.topics[name] = partitions
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+	return meta, nil
+}
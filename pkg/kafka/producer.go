@@ -0,0 +1,170 @@
+package kafka
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const clientID = "bulklog"
+
+var (
+	// ErrNoBroker - none of the bootstrap brokers could be reached
+	ErrNoBroker = errors.New("ErrNoBroker - none of the kafka brokers could be reached")
+	// ErrNoPartition - topic has no partition
+	ErrNoPartition = errors.New("ErrNoPartition - kafka topic has no partition")
+)
+
+// ProducerConfig -
+type ProducerConfig struct {
+	Brokers     []string
+	Acks        int16
+	Compression Compression
+	Timeout     time.Duration
+}
+
+// Producer publishes messages to kafka brokers using the kafka wire protocol
+type Producer struct {
+	sync.Mutex
+	cfg        ProducerConfig
+	conns      *pool
+	meta       *metadata
+	roundRobin uint32
+}
+
+// NewProducer -
+func NewProducer(cfg ProducerConfig) *Producer {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 30 * time.Second
+	}
+	return &Producer{
+		cfg:   cfg,
+		conns: newPool(cfg.Timeout),
+	}
+}
+
+// Produce publishes messages to the given topic.
+// Messages with a key are partitioned like the java client does, others are spread round robin.
+func (p *Producer) Produce(topic string, messages []Message) (err error) {
+	if len(messages) == 0 {
+		return nil
+	}
+	defer func() {
+		if err != nil {
+			p.Lock()
+			p.meta = nil
+			p.Unlock()
+		}
+	}()
+	meta, err := p.metadata(topic)
+	if err != nil {
+		return fmt.Errorf("metadata.%s", err)
+	}
+	partitions := meta.topics[topic]
+	if len(partitions) == 0 {
+		return ErrNoPartition
+	}
+	byPartition := make(map[int][]Message)
+	for _, msg := range messages {
+		var i int
+		if msg.Key != nil {
+			i = int(murmur2(msg.Key)&0x7fffffff) % len(partitions)
+		} else {
+			p.Lock()
+			i = int(p.roundRobin % uint32(len(partitions)))
+			p.roundRobin++
+			p.Unlock()
+		}
+		byPartition[i] = append(byPartition[i], msg)
+	}
+	byLeader := make(map[int32]map[int32][]Message)
+	for i, msgs := range byPartition {
+		part := partitions[i]
+		if byLeader[part.leader] == nil {
+			byLeader[part.leader] = make(map[int32][]Message)
+		}
+		byLeader[part.leader][part.index] = msgs
+	}
+	for leader, parts := range byLeader {
+		b, ok := meta.brokers[leader]
+		if !ok {
+			return fmt.Errorf("kafka: unknown leader %d", leader)
+		}
+		err = p.produce(b.addr, topic, parts)
+		if err != nil {
+			return fmt.Errorf("produce(%s).%s", b.addr, err)
+		}
+	}
+	return nil
+}
+
+func (p *Producer) produce(addr, topic string, parts map[int32][]Message) error {
+	var e encoder
+	e.nullableString(nil) // transactional id
+	e.int16(p.cfg.Acks)
+	e.int32(int32(p.cfg.Timeout / time.Millisecond))
+	e.int32(1)
+	e.string(topic)
+	e.int32(int32(len(parts)))
+	for index, msgs := range parts {
+		batch, err := encodeRecordBatch(msgs, p.cfg.Compression)
+		if err != nil {
+			return fmt.Errorf("encodeRecordBatch.%s", err)
+		}
+		e.int32(index)
+		e.bytes(batch)
+	}
+	c, err := p.conns.get(addr)
+	if err != nil {
+		return fmt.Errorf("conn.%s", err)
+	}
+	res, err := c.roundTrip(apiKeyProduce, 3, e.buf, p.cfg.Acks != 0, p.cfg.Timeout)
+	if err != nil {
+		p.conns.drop(addr)
+		return fmt.Errorf("roundTrip.%s", err)
+	}
+	if p.cfg.Acks == 0 {
+		return nil
+	}
+	d := &decoder{buf: res}
+	topicsLen := d.int32()
+	for i := int32(0); i < topicsLen && d.err == nil; i++ {
+		d.string()
+		partsLen := d.int32()
+		for j := int32(0); j < partsLen && d.err == nil; j++ {
+			index := d.int32()
+			errCode := d.int16()
+			d.int64() // base offset
+			d.int64() // log append time
+			if errCode != 0 {
+				return fmt.Errorf("partition %d: %s", index, Error(errCode))
+			}
+		}
+	}
+	return d.err
+}
+
+func (p *Producer) metadata(topic string) (*metadata, error) {
+	p.Lock()
+	meta := p.meta
+	p.Unlock()
+	if meta != nil {
+		if _, ok := meta.topics[topic]; ok {
+			return meta, nil
+		}
+	}
+	meta, err := requestMetadata(p.conns, p.cfg.Brokers, []string{topic}, p.cfg.Timeout)
+	if err != nil {
+		return nil, fmt.Errorf("requestMetadata.%s", err)
+	}
+	p.Lock()
+	p.meta = meta
+	p.Unlock()
+	return meta, nil
+}
+
+// Close closes connections to brokers
+func (p *Producer) Close() {
+	p.conns.close()
+}
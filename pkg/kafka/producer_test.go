@@ -0,0 +1,249 @@
+package kafka
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeBroker answers metadata v1 and produce v3 requests for the two partitions of topic logs, both led by itself
+type fakeBroker struct {
+	t        *testing.T
+	listener net.Listener
+	mu       sync.Mutex
+	// produced - record batches by partition
+	produced map[int32][][]byte
+}
+
+func newFakeBroker(t *testing.T) *fakeBroker {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &fakeBroker{t: t, listener: listener, produced: make(map[int32][][]byte)}
+	go b.serve()
+	t.Cleanup(func() { listener.Close() })
+	return b
+}
+
+func (b *fakeBroker) serve() {
+	for {
+		conn, err := b.listener.Accept()
+		if err != nil {
+			return
+		}
+		go b.handle(conn)
+	}
+}
+
+func (b *fakeBroker) handle(conn net.Conn) {
+	defer conn.Close()
+	var want int32
+	for {
+		size := make([]byte, 4)
+		_, err := io.ReadFull(conn, size)
+		if err != nil {
+			return
+		}
+		req := make([]byte, binary.BigEndian.Uint32(size))
+		_, err = io.ReadFull(conn, req)
+		if err != nil {
+			return
+		}
+		d := &decoder{buf: req}
+		apiKey, apiVersion, correlationID, clientID := d.int16(), d.int16(), d.int32(), d.string()
+		want++
+		if d.err != nil || correlationID != want || clientID != "bulklog" {
+			b.t.Errorf("request header: correlation id %d, client id %q, %v", correlationID, clientID, d.err)
+			return
+		}
+		var res encoder
+		res.int32(0) // size placeholder
+		res.int32(correlationID)
+		switch {
+		case apiKey == apiKeyMetadata && apiVersion == 1:
+			b.metadata(d, &res)
+		case apiKey == apiKeyProduce && apiVersion == 3:
+			if !b.produce(d, &res) {
+				continue
+			}
+		default:
+			b.t.Errorf("unexpected request %d v%d", apiKey, apiVersion)
+			return
+		}
+		binary.BigEndian.PutUint32(res.buf, uint32(len(res.buf)-4))
+		_, err = conn.Write(res.buf)
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (b *fakeBroker) metadata(d *decoder, res *encoder) {
+	if topics := d.int32(); topics != 1 || d.string() != "logs" {
+		b.t.Errorf("metadata request of topics other than logs")
+	}
+	host, portStr, _ := net.SplitHostPort(b.listener.Addr().String())
+	port, _ := strconv.Atoi(portStr)
+	encodeMetadataResponse(res, host, int32(port))
+}
+
+// encodeMetadataResponse encodes the metadata of topic logs, whose two partitions are led by the broker at host:port
+func encodeMetadataResponse(res *encoder, host string, port int32) {
+	res.int32(1) // brokers
+	res.int32(1)
+	res.string(host)
+	res.int32(port)
+	res.nullableString(nil) // rack
+	res.int32(1)            // controller id
+	res.int32(1)            // topics
+	res.int16(0)
+	res.string("logs")
+	res.int8(0)  // is internal
+	res.int32(2) // partitions
+	for index := int32(0); index < 2; index++ {
+		res.int16(0)
+		res.int32(index)
+		res.int32(1) // leader
+		res.int32(1) // replicas
+		res.int32(1)
+		res.int32(1) // isr
+		res.int32(1)
+	}
+}
+
+// produce stores the batches of a produce request, and tells whether it expects a response
+func (b *fakeBroker) produce(d *decoder, res *encoder) bool {
+	if transactionalID := d.int16(); transactionalID != -1 {
+		b.t.Errorf("transactional id of length %d, want null", transactionalID)
+	}
+	acks := d.int16()
+	d.int32() // timeout
+	if topics := d.int32(); topics != 1 || d.string() != "logs" {
+		b.t.Errorf("produce request of topics other than logs")
+	}
+	partitions := d.int32()
+	res.int32(1)
+	res.string("logs")
+	res.int32(partitions)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for i := int32(0); i < partitions && d.err == nil; i++ {
+		index := d.int32()
+		batch := d.bytes()
+		if crc := crc32.Checksum(batch[21:], crc32.MakeTable(crc32.Castagnoli)); crc != binary.BigEndian.Uint32(batch[17:21]) {
+			b.t.Errorf("batch of partition %d has an invalid crc", index)
+		}
+		b.produced[index] = append(b.produced[index], batch)
+		res.int32(index)
+		res.int16(0)  // error code
+		res.int64(0)  // base offset
+		res.int64(-1) // log append time
+	}
+	res.int32(0) // throttle time
+	if d.err != nil || len(d.buf) != 0 {
+		b.t.Errorf("produce request: %v, %d trailing bytes", d.err, len(d.buf))
+	}
+	return acks != 0
+}
+
+func (b *fakeBroker) records(partition int32) []Record {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var records []Record
+	for _, batch := range b.produced[partition] {
+		decoded, err := decodeRecordBatches(topicPartition{"logs", partition}, batch, 0)
+		if err != nil {
+			b.t.Fatal(err)
+		}
+		records = append(records, decoded...)
+	}
+	return records
+}
+
+func TestProduce(t *testing.T) {
+	broker := newFakeBroker(t)
+	producer := NewProducer(ProducerConfig{
+		Brokers:     []string{broker.listener.Addr().String()},
+		Acks:        1,
+		Compression: Gzip,
+		Timeout:     5 * time.Second,
+	})
+	defer producer.Close()
+	// keys of the java client murmur2 vectors: "21" and "foobar" hash to partition 0 of 2, "abc" to partition 1
+	messages := []Message{
+		{Key: []byte("21"), Value: []byte("a"), Time: batchTime},
+		{Key: []byte("abc"), Value: []byte("b"), Time: batchTime},
+		{Key: []byte("foobar"), Value: []byte("c"), Time: batchTime},
+	}
+	err := producer.Produce("logs", messages)
+	if err != nil {
+		t.Fatalf("Produce: %s", err)
+	}
+	assertRecords(t, broker.records(0), []Record{
+		{Topic: "logs", Partition: 0, Offset: 0, Key: []byte("21"), Value: []byte("a"), Time: batchTime},
+		{Topic: "logs", Partition: 0, Offset: 1, Key: []byte("foobar"), Value: []byte("c"), Time: batchTime},
+	})
+	assertRecords(t, broker.records(1), []Record{
+		{Topic: "logs", Partition: 1, Offset: 0, Key: []byte("abc"), Value: []byte("b"), Time: batchTime},
+	})
+	// unkeyed messages are spread round robin
+	err = producer.Produce("logs", []Message{{Value: []byte("d"), Time: batchTime}, {Value: []byte("e"), Time: batchTime}})
+	if err != nil {
+		t.Fatalf("Produce: %s", err)
+	}
+	if len(broker.records(0)) != 3 || len(broker.records(1)) != 2 {
+		t.Fatalf("unkeyed messages produced to partitions %d and %d times", len(broker.records(0))-2, len(broker.records(1))-1)
+	}
+}
+
+func TestProduceWithoutAcks(t *testing.T) {
+	broker := newFakeBroker(t)
+	producer := NewProducer(ProducerConfig{
+		Brokers: []string{broker.listener.Addr().String()},
+		Acks:    0,
+		Timeout: 5 * time.Second,
+	})
+	defer producer.Close()
+	err := producer.Produce("logs", []Message{{Key: []byte("abc"), Value: []byte("b"), Time: batchTime}})
+	if err != nil {
+		t.Fatalf("Produce: %s", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for len(broker.records(1)) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if len(broker.records(1)) != 1 {
+		t.Fatal("message was not produced")
+	}
+}
+
+func TestProduceNoBroker(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+	producer := NewProducer(ProducerConfig{Brokers: []string{addr}, Timeout: time.Second})
+	defer producer.Close()
+	err = producer.Produce("logs", []Message{{Value: []byte("a"), Time: batchTime}})
+	if err == nil {
+		t.Fatal("Produce without broker: got no error")
+	}
+}
+
+// FuzzDecodeMetadataResponse checks arbitrary metadata responses are decoded or rejected rather than panicking
+func FuzzDecodeMetadataResponse(f *testing.F) {
+	var res encoder
+	encodeMetadataResponse(&res, "localhost", 9092)
+	f.Add(res.buf)
+	f.Fuzz(func(t *testing.T, buf []byte) {
+		decodeMetadataResponse(&decoder{buf: buf})
+	})
+}
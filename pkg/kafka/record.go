@@ -0,0 +1,135 @@
+package kafka
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"time"
+)
+
+// Compression codec of record batches
+type Compression string
+
+const (
+	// None - no compression
+	None Compression = "none"
+	// Gzip - gzip compression
+	Gzip Compression = "gzip"
+)
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// Message - record to produce
+type Message struct {
+	Key   []byte
+	Value []byte
+	Time  time.Time
+}
+
+// encodeRecordBatch encodes messages as a v2 record batch
+func encodeRecordBatch(messages []Message, compression Compression) ([]byte, error) {
+	var (
+		first = messages[0].Time
+		max   = first
+		recs  encoder
+	)
+	for _, msg := range messages {
+		if msg.Time.After(max) {
+			max = msg.Time
+		}
+	}
+	for i, msg := range messages {
+		var rec encoder
+		rec.int8(0) // attributes
+		rec.varint(ms(msg.Time) - ms(first))
+		rec.varint(int64(i))
+		rec.varbytes(msg.Key)
+		rec.varbytes(msg.Value)
+		rec.varint(0) // headers
+		recs.varint(int64(len(rec.buf)))
+		recs.buf = append(recs.buf, rec.buf...)
+	}
+	var attributes int16
+	records := recs.buf
+	switch compression {
+	case Gzip:
+		attributes = 1
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		_, err := gz.Write(records)
+		if err != nil {
+			return nil, fmt.Errorf("gzip.Write.%s", err)
+		}
+		err = gz.Close()
+		if err != nil {
+			return nil, fmt.Errorf("gzip.Close.%s", err)
+		}
+		records = buf.Bytes()
+	case None, "":
+		break
+	default:
+		return nil, fmt.Errorf("unsupported compression %s", compression)
+	}
+	// fields covered by the crc
+	var body encoder
+	body.int16(attributes)
+	body.int32(int32(len(messages) - 1))
+	body.int64(ms(first))
+	body.int64(ms(max))
+	body.int64(-1) // producer id
+	body.int16(-1) // producer epoch
+	body.int32(-1) // base sequence
+	body.int32(int32(len(messages)))
+	body.buf = append(body.buf, records...)
+
+	var batch encoder
+	batch.int64(0)                                // base offset
+	batch.int32(int32(4 + 1 + 4 + len(body.buf))) // batch length
+	batch.int32(-1)                               // partition leader epoch
+	batch.int8(2)                                 // magic
+	batch.buf = append(batch.buf, 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(batch.buf[len(batch.buf)-4:], crc32.Checksum(body.buf, castagnoli))
+	batch.buf = append(batch.buf, body.buf...)
+	return batch.buf, nil
+}
+
+func ms(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
+
+// murmur2 - same partitioning hash as the java client
+func murmur2(data []byte) int32 {
+	const (
+		seed uint32 = 0x9747b28c
+		m    uint32 = 0x5bd1e995
+		r           = 24
+	)
+	length := len(data)
+	h := seed ^ uint32(length)
+	for i := 0; i+4 <= length; i += 4 {
+		k := binary.LittleEndian.Uint32(data[i : i+4])
+		k *= m
+		k ^= k >> r
+		k *= m
+		h *= m
+		h ^= k
+	}
+	tail := data[length&^3:]
+	switch len(tail) {
+	case 3:
+		h ^= uint32(tail[2]) << 16
+		fallthrough
+	case 2:
+		h ^= uint32(tail[1]) << 8
+		fallthrough
+	case 1:
+		h ^= uint32(tail[0])
+		h *= m
+	}
+	h ^= h >> 13
+	h *= m
+	h ^= h >> 15
+	return int32(h)
+}
@@ -0,0 +1,180 @@
+package kafka
+
+import (
+	"bytes"
+	"encoding/hex"
+	"hash/crc32"
+	"testing"
+	"time"
+)
+
+var batchTime = time.Unix(0, 1700000000000*int64(time.Millisecond)).UTC()
+
+// goldenBatch - v2 record batch of testMessages, laid out field by field after the protocol documentation
+// ref: https://kafka.apache.org/documentation/#recordbatch
+const goldenBatch = "0000000000000000" + // base offset
+	"00000052" + // batch length
+	"ffffffff" + // partition leader epoch
+	"02" + // magic
+	"aebfe90c" + // crc32c of the fields below
+	"0000" + // attributes
+	"00000001" + // last offset delta
+	"0000018bcfe56800" + // first timestamp
+	"0000018bcfe56ddc" + // max timestamp
+	"ffffffffffffffff" + // producer id
+	"ffff" + // producer epoch
+	"ffffffff" + // base sequence
+	"00000002" + // records count
+	"10" + "00" + "00" + "00" + "026b" + "0276" + "00" + // length, attributes, timestamp delta, offset delta, key, value, headers
+	"2e" + "00" + "b817" + "02" + "01" + "207b226d7367223a22736572766564227d" + "00"
+
+var testMessages = []Message{
+	{Key: []byte("k"), Value: []byte("v"), Time: batchTime},
+	{Value: []byte(`{"msg":"served"}`), Time: batchTime.Add(1500 * time.Millisecond)},
+}
+
+func TestEncodeRecordBatchGolden(t *testing.T) {
+	batch, err := encodeRecordBatch(testMessages, None)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := hex.EncodeToString(batch); got != goldenBatch {
+		t.Fatalf("encodeRecordBatch =\n%s\nwant\n%s", got, goldenBatch)
+	}
+}
+
+// TestCRC32C checks the checksum of record batches is CRC-32C, whose check value is the one of "123456789"
+func TestCRC32C(t *testing.T) {
+	if sum := crc32.Checksum([]byte("123456789"), castagnoli); sum != 0xe3069283 {
+		t.Fatalf("crc32c = %x, want e3069283", sum)
+	}
+}
+
+func TestDecodeRecordBatchesGolden(t *testing.T) {
+	batch, _ := hex.DecodeString(goldenBatch)
+	tp := topicPartition{"logs", 3}
+	records, err := decodeRecordBatches(tp, batch, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Record{
+		{Topic: "logs", Partition: 3, Offset: 0, Key: []byte("k"), Value: []byte("v"), Time: batchTime},
+		{Topic: "logs", Partition: 3, Offset: 1, Value: []byte(`{"msg":"served"}`), Time: batchTime.Add(1500 * time.Millisecond)},
+	}
+	assertRecords(t, records, want)
+	// records before the fetched offset are dropped
+	records, err = decodeRecordBatches(tp, batch, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertRecords(t, records, want[1:])
+}
+
+// FuzzDecodeRecordBatches checks arbitrary record sets of brokers are decoded or rejected rather than panicking
+func FuzzDecodeRecordBatches(f *testing.F) {
+	batch, _ := hex.DecodeString(goldenBatch)
+	f.Add(batch, int64(0))
+	gzipped, _ := encodeRecordBatch(testMessages, Gzip)
+	f.Add(gzipped, int64(1))
+	f.Fuzz(func(t *testing.T, b []byte, from int64) {
+		tp := topicPartition{"logs", 3}
+		records, err := decodeRecordBatches(tp, b, from)
+		if err != nil {
+			return
+		}
+		for _, rec := range records {
+			if rec.Topic != tp.topic || rec.Partition != tp.partition || rec.Offset < from {
+				t.Fatalf("record %s[%d] at offset %d, fetched from %d", rec.Topic, rec.Partition, rec.Offset, from)
+			}
+		}
+	})
+}
+
+func TestRecordBatchRoundTrip(t *testing.T) {
+	messages := make([]Message, 0, 500)
+	for i := 0; i < 500; i++ {
+		messages = append(messages, Message{
+			Key:   []byte{byte(i)},
+			Value: bytes.Repeat([]byte("document "), i%20+1),
+			Time:  batchTime.Add(time.Duration(i) * time.Second),
+		})
+	}
+	for _, compression := range []Compression{None, Gzip} {
+		t.Run(string(compression), func(t *testing.T) {
+			batch, err := encodeRecordBatch(messages, compression)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// the crc covers the fields from attributes on
+			if sum := crc32.Checksum(batch[21:], crc32.MakeTable(crc32.Castagnoli)); sum != uint32(batch[17])<<24|uint32(batch[18])<<16|uint32(batch[19])<<8|uint32(batch[20]) {
+				t.Fatalf("crc %x does not match the batch", batch[17:21])
+			}
+			records, err := decodeRecordBatches(topicPartition{"logs", 0}, batch, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(records) != len(messages) {
+				t.Fatalf("decoded %d records, want %d", len(records), len(messages))
+			}
+			for i, rec := range records {
+				if rec.Offset != int64(i) || !bytes.Equal(rec.Key, messages[i].Key) || !bytes.Equal(rec.Value, messages[i].Value) || !rec.Time.Equal(messages[i].Time) {
+					t.Fatalf("record %d = %+v, want %+v", i, rec, messages[i])
+				}
+			}
+		})
+	}
+}
+
+func TestDecodeRecordBatchesSkipped(t *testing.T) {
+	golden, _ := hex.DecodeString(goldenBatch)
+	control := append([]byte{}, golden...)
+	control[22] |= 0x20 // attributes: control batch
+	logAppend := append([]byte{}, golden...)
+	logAppend[22] |= 0x08 // attributes: log append time
+	logAppend[7] = 10     // base offset
+	var fetched []byte
+	fetched = append(fetched, control...)
+	fetched = append(fetched, logAppend...)
+	// brokers may send the last batch truncated
+	fetched = append(fetched, golden[:40]...)
+	records, err := decodeRecordBatches(topicPartition{"logs", 0}, fetched, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	maxTime := batchTime.Add(1500 * time.Millisecond)
+	assertRecords(t, records, []Record{
+		{Topic: "logs", Offset: 10, Key: []byte("k"), Value: []byte("v"), Time: maxTime},
+		{Topic: "logs", Offset: 11, Value: []byte(`{"msg":"served"}`), Time: maxTime},
+	})
+}
+
+// TestMurmur2 checks the vectors of the java client, so keyed messages land on the partitions java producers pick
+func TestMurmur2(t *testing.T) {
+	vectors := map[string]int32{
+		"21":                         -973932308,
+		"foobar":                     -790332482,
+		"a-little-bit-long-string":   -985981536,
+		"a-little-bit-longer-string": -1486304829,
+		"lkjh234lh9fiuh90y23oiuhsafujhadof229phr9h19h89h8": -58897971,
+		"abc": 479470107,
+	}
+	for key, want := range vectors {
+		if got := murmur2([]byte(key)); got != want {
+			t.Errorf("murmur2(%q) = %d, want %d", key, got, want)
+		}
+	}
+}
+
+func assertRecords(t *testing.T, records, want []Record) {
+	t.Helper()
+	if len(records) != len(want) {
+		t.Fatalf("decoded %d records, want %d", len(records), len(want))
+	}
+	for i := range records {
+		got := records[i]
+		if got.Topic != want[i].Topic || got.Partition != want[i].Partition || got.Offset != want[i].Offset ||
+			!bytes.Equal(got.Key, want[i].Key) || !bytes.Equal(got.Value, want[i].Value) || !got.Time.Equal(want[i].Time) {
+			t.Fatalf("record %d = %+v, want %+v", i, got, want[i])
+		}
+	}
+}
@@ -1,21 +1,70 @@
+// Package log builds the structured, leveled logger injected across bulklog.
 package log
 
 import (
-	"log"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
 	"os"
+	"strings"
+)
+
+const (
+	// ConsoleFormat - human readable key=value lines
+	ConsoleFormat = "console"
+	// JSONFormat - one JSON object per line
+	JSONFormat = "json"
 )
 
 var (
-	stderr = log.New(os.Stderr, "", log.Lshortfile)
-	stdout = log.New(os.Stdout, "", log.Lshortfile)
+	// ErrUnknownLevel -
+	ErrUnknownLevel = errors.New("ErrUnknownLevel - log level must be one of debug|info|warn|error")
+	// ErrUnknownFormat -
+	ErrUnknownFormat = errors.New("ErrUnknownFormat - log format must be one of console|json")
 )
 
-// Err returns a logger over stderr
-func Err() *log.Logger {
-	return stderr
+// Config -
+type Config struct {
+	Level  string `yaml:"level"`
+	Format string `yaml:"format"`
+	Output string `yaml:"output"`
 }
 
-// Out returns a logger over stdout
-func Out() *log.Logger {
-	return stderr
+// New creates a logger writing to stderr, stdout or a file
+func New(cfg Config) (*slog.Logger, error) {
+	var level slog.Level
+	switch strings.ToLower(cfg.Level) {
+	case "debug":
+		level = slog.LevelDebug
+	case "info", "":
+		level = slog.LevelInfo
+	case "warn":
+		level = slog.LevelWarn
+	case "error":
+		level = slog.LevelError
+	default:
+		return nil, ErrUnknownLevel
+	}
+	if cfg.Format != "" && cfg.Format != ConsoleFormat && cfg.Format != JSONFormat {
+		return nil, ErrUnknownFormat
+	}
+	var w io.Writer
+	switch cfg.Output {
+	case "stderr", "":
+		w = os.Stderr
+	case "stdout":
+		w = os.Stdout
+	default:
+		file, err := os.OpenFile(cfg.Output, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			return nil, fmt.Errorf("os.OpenFile.%s", err)
+		}
+		w = file
+	}
+	opts := &slog.HandlerOptions{Level: level}
+	if cfg.Format == JSONFormat {
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	}
+	return slog.New(slog.NewTextHandler(w, opts)), nil
 }
@@ -0,0 +1,227 @@
+// Package msgpack implements the MessagePack primitives needed by the fluentd forward input and the msgpack codecs.
+// ref: https://github.com/msgpack/msgpack/blob/master/spec.md
+package msgpack
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+)
+
+const (
+	// maxLength bounds strings, binaries and collections, so corrupt input cannot allocate without limit
+	maxLength = 64 << 20
+	// maxDepth bounds nested collections, so corrupt input cannot overflow the stack
+	maxDepth = 1024
+)
+
+var (
+	// ErrInvalidFormat - byte is not a MessagePack format
+	ErrInvalidFormat = errors.New("ErrInvalidFormat - 0xc1 is never used by msgpack")
+	// ErrTooLarge -
+	ErrTooLarge = errors.New("ErrTooLarge - msgpack object exceeds 64MB")
+	// ErrTooDeep -
+	ErrTooDeep = errors.New("ErrTooDeep - msgpack collections nest more than 1024 levels deep")
+)
+
+// Ext - extension type, such as fluentd EventTime
+type Ext struct {
+	Type int8
+	Data []byte
+}
+
+// Decoder reads MessagePack objects from a stream.
+// Maps are decoded as map[interface{}]interface{}, arrays as []interface{},
+// integers as int64 or uint64, floats as float64, str as string and bin as []byte.
+type Decoder struct {
+	r *bufio.Reader
+	// depth - collections being decoded
+	depth int
+}
+
+// NewDecoder -
+func NewDecoder(r io.Reader) *Decoder {
+	reader, ok := r.(*bufio.Reader)
+	if !ok {
+		reader = bufio.NewReader(r)
+	}
+	return &Decoder{r: reader}
+}
+
+// Decode reads the next object, io.EOF if the stream ends before it starts
+func (d *Decoder) Decode() (interface{}, error) {
+	b, err := d.r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	v, err := d.decode(b)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return v, err
+}
+
+func (d *Decoder) decode(b byte) (interface{}, error) {
+	switch {
+	case b <= 0x7f:
+		return int64(b), nil
+	case b >= 0xe0:
+		return int64(int8(b)), nil
+	case b&0xf0 == 0x80:
+		return d.decodeMap(int(b & 0x0f))
+	case b&0xf0 == 0x90:
+		return d.decodeArray(int(b & 0x0f))
+	case b&0xe0 == 0xa0:
+		return d.decodeString(int(b & 0x1f))
+	}
+	switch b {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xc4, 0xc5, 0xc6:
+		n, err := d.length(1 << (b - 0xc4))
+		if err != nil {
+			return nil, err
+		}
+		return d.bytes(n)
+	case 0xc7, 0xc8, 0xc9:
+		n, err := d.length(1 << (b - 0xc7))
+		if err != nil {
+			return nil, err
+		}
+		return d.decodeExt(n)
+	case 0xca:
+		u, err := d.uint(4)
+		return float64(math.Float32frombits(uint32(u))), err
+	case 0xcb:
+		u, err := d.uint(8)
+		return math.Float64frombits(u), err
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		return d.uint(1 << (b - 0xcc))
+	case 0xd0:
+		u, err := d.uint(1)
+		return int64(int8(u)), err
+	case 0xd1:
+		u, err := d.uint(2)
+		return int64(int16(u)), err
+	case 0xd2:
+		u, err := d.uint(4)
+		return int64(int32(u)), err
+	case 0xd3:
+		u, err := d.uint(8)
+		return int64(u), err
+	case 0xd4, 0xd5, 0xd6, 0xd7, 0xd8:
+		return d.decodeExt(1 << (b - 0xd4))
+	case 0xd9, 0xda, 0xdb:
+		n, err := d.length(1 << (b - 0xd9))
+		if err != nil {
+			return nil, err
+		}
+		return d.decodeString(n)
+	case 0xdc, 0xdd:
+		n, err := d.length(2 << (b - 0xdc))
+		if err != nil {
+			return nil, err
+		}
+		return d.decodeArray(n)
+	case 0xde, 0xdf:
+		n, err := d.length(2 << (b - 0xde))
+		if err != nil {
+			return nil, err
+		}
+		return d.decodeMap(n)
+	}
+	return nil, ErrInvalidFormat
+}
+
+func (d *Decoder) uint(size int) (uint64, error) {
+	buf := make([]byte, 8)
+	_, err := io.ReadFull(d.r, buf[8-size:])
+	if err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint64(buf), nil
+}
+
+func (d *Decoder) length(size int) (int, error) {
+	n, err := d.uint(size)
+	if err != nil {
+		return 0, err
+	}
+	if n > maxLength {
+		return 0, ErrTooLarge
+	}
+	return int(n), nil
+}
+
+func (d *Decoder) bytes(n int) ([]byte, error) {
+	buf := make([]byte, n)
+	_, err := io.ReadFull(d.r, buf)
+	return buf, err
+}
+
+func (d *Decoder) decodeString(n int) (interface{}, error) {
+	buf, err := d.bytes(n)
+	return string(buf), err
+}
+
+func (d *Decoder) decodeExt(n int) (interface{}, error) {
+	extType, err := d.r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	data, err := d.bytes(n)
+	if err != nil {
+		return nil, err
+	}
+	return Ext{int8(extType), data}, nil
+}
+
+func (d *Decoder) decodeArray(n int) (interface{}, error) {
+	if d.depth >= maxDepth {
+		return nil, ErrTooDeep
+	}
+	d.depth++
+	defer func() { d.depth-- }()
+	array := make([]interface{}, 0, min(n, 1024))
+	for i := 0; i < n; i++ {
+		v, err := d.Decode()
+		if err != nil {
+			return nil, err
+		}
+		array = append(array, v)
+	}
+	return array, nil
+}
+
+func (d *Decoder) decodeMap(n int) (interface{}, error) {
+	if d.depth >= maxDepth {
+		return nil, ErrTooDeep
+	}
+	d.depth++
+	defer func() { d.depth-- }()
+	m := make(map[interface{}]interface{}, min(n, 1024))
+	for i := 0; i < n; i++ {
+		key, err := d.Decode()
+		if err != nil {
+			return nil, err
+		}
+		value, err := d.Decode()
+		if err != nil {
+			return nil, err
+		}
+		if key != nil && !reflect.TypeOf(key).Comparable() {
+			// unhashable, such as maps, arrays, binaries and extensions
+			key = fmt.Sprint(key)
+		}
+		m[key] = value
+	}
+	return m, nil
+}
@@ -0,0 +1,67 @@
+package msgpack
+
+import (
+	"bytes"
+	"encoding/hex"
+	"reflect"
+	"testing"
+)
+
+// TestDecodeUnhashableKeys checks keys which cannot be map keys are stringified, instead of panicking on untrusted input
+func TestDecodeUnhashableKeys(t *testing.T) {
+	frames := map[string]map[interface{}]interface{}{
+		"81d40100c0":   {"{1 [0]}": nil},               // fixext 1 key
+		"81c4026162c3": {"[97 98]": true},              // bin key
+		"81920102a178": {"[1 2]": "x"},                 // array key
+		"81810101c0":   {"map[1:1]": nil},              // map key
+		"82c001a16b02": {nil: int64(1), "k": int64(2)}, // nil key
+	}
+	for frame, want := range frames {
+		buf, _ := hex.DecodeString(frame)
+		v, err := NewDecoder(bytes.NewReader(buf)).Decode()
+		if err != nil {
+			t.Fatalf("Decode(%s): %s", frame, err)
+		}
+		if !reflect.DeepEqual(v, want) {
+			t.Errorf("Decode(%s) = %#v, want %#v", frame, v, want)
+		}
+	}
+}
+
+// TestDecodeTooDeep checks nested collections are bounded, deeply nested input overflows the stack otherwise
+func TestDecodeTooDeep(t *testing.T) {
+	for _, header := range []byte{0x91, 0x81} {
+		buf := bytes.Repeat([]byte{header}, 1<<20)
+		_, err := NewDecoder(bytes.NewReader(buf)).Decode()
+		if err != ErrTooDeep {
+			t.Fatalf("Decode of %x nested collections: got %v, want %v", header, err, ErrTooDeep)
+		}
+	}
+	buf := append(bytes.Repeat([]byte{0x91}, maxDepth), 0xc0)
+	_, err := NewDecoder(bytes.NewReader(buf)).Decode()
+	if err != nil {
+		t.Fatalf("Decode of %d nested arrays: %s", maxDepth, err)
+	}
+}
+
+// FuzzDecode checks arbitrary fluentd frames decode or fail, rather than panic
+func FuzzDecode(f *testing.F) {
+	for _, frame := range []string{
+		"81d40100c0", "81c4026162c3", "81920102a178", "81810101c0", "82c001a16b02",
+		// a fluentd Message, [tag, time, record] with an EventTime
+		"93a76170702e776562d7006553f1000000000081a36d7367a473656e74",
+		"dc0003c0c2c3", "de0001a161cb3ff0000000000000", "c70300010203", "d9026869", "cf0000000000000001", "d3ffffffffffffffff",
+	} {
+		b, _ := hex.DecodeString(frame)
+		f.Add(b)
+	}
+	f.Fuzz(func(t *testing.T, frame []byte) {
+		d := NewDecoder(bytes.NewReader(frame))
+		for {
+			_, err := d.Decode()
+			if err != nil {
+				return
+			}
+		}
+	})
+}
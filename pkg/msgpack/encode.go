@@ -0,0 +1,123 @@
+package msgpack
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+// Encoder appends objects to a buffer
+type Encoder struct {
+	buf []byte
+}
+
+// Bytes returns the encoded objects
+func (e *Encoder) Bytes() []byte {
+	return e.buf
+}
+
+// ArrayHeader starts an array of n objects
+func (e *Encoder) ArrayHeader(n int) {
+	switch {
+	case n < 16:
+		e.buf = append(e.buf, 0x90|byte(n))
+	case n <= 0xffff:
+		e.buf = binary.BigEndian.AppendUint16(append(e.buf, 0xdc), uint16(n))
+	default:
+		e.buf = binary.BigEndian.AppendUint32(append(e.buf, 0xdd), uint32(n))
+	}
+}
+
+// MapHeader starts a map of n key value pairs
+func (e *Encoder) MapHeader(n int) {
+	switch {
+	case n < 16:
+		e.buf = append(e.buf, 0x80|byte(n))
+	case n <= 0xffff:
+		e.buf = binary.BigEndian.AppendUint16(append(e.buf, 0xde), uint16(n))
+	default:
+		e.buf = binary.BigEndian.AppendUint32(append(e.buf, 0xdf), uint32(n))
+	}
+}
+
+// String encodes a str
+func (e *Encoder) String(s string) {
+	n := len(s)
+	switch {
+	case n < 32:
+		e.buf = append(e.buf, 0xa0|byte(n))
+	case n <= 0xff:
+		e.buf = append(e.buf, 0xd9, byte(n))
+	case n <= 0xffff:
+		e.buf = binary.BigEndian.AppendUint16(append(e.buf, 0xda), uint16(n))
+	default:
+		e.buf = binary.BigEndian.AppendUint32(append(e.buf, 0xdb), uint32(n))
+	}
+	e.buf = append(e.buf, s...)
+}
+
+// Bin encodes a bin
+func (e *Encoder) Bin(b []byte) {
+	n := len(b)
+	switch {
+	case n <= 0xff:
+		e.buf = append(e.buf, 0xc4, byte(n))
+	case n <= 0xffff:
+		e.buf = binary.BigEndian.AppendUint16(append(e.buf, 0xc5), uint16(n))
+	default:
+		e.buf = binary.BigEndian.AppendUint32(append(e.buf, 0xc6), uint32(n))
+	}
+	e.buf = append(e.buf, b...)
+}
+
+// Bool -
+func (e *Encoder) Bool(b bool) {
+	if b {
+		e.buf = append(e.buf, 0xc3)
+	} else {
+		e.buf = append(e.buf, 0xc2)
+	}
+}
+
+// Nil -
+func (e *Encoder) Nil() {
+	e.buf = append(e.buf, 0xc0)
+}
+
+// Int encodes an int in its smallest form
+func (e *Encoder) Int(i int64) {
+	switch {
+	case i >= 0:
+		e.Uint(uint64(i))
+	case i >= -32:
+		e.buf = append(e.buf, byte(int8(i)))
+	case i >= math.MinInt8:
+		e.buf = append(e.buf, 0xd0, byte(int8(i)))
+	case i >= math.MinInt16:
+		e.buf = binary.BigEndian.AppendUint16(append(e.buf, 0xd1), uint16(int16(i)))
+	case i >= math.MinInt32:
+		e.buf = binary.BigEndian.AppendUint32(append(e.buf, 0xd2), uint32(int32(i)))
+	default:
+		e.buf = binary.BigEndian.AppendUint64(append(e.buf, 0xd3), uint64(i))
+	}
+}
+
+// Uint encodes an unsigned int in its smallest form
+func (e *Encoder) Uint(u uint64) {
+	switch {
+	case u <= 0x7f:
+		e.buf = append(e.buf, byte(u))
+	case u <= 0xff:
+		e.buf = append(e.buf, 0xcc, byte(u))
+	case u <= 0xffff:
+		e.buf = binary.BigEndian.AppendUint16(append(e.buf, 0xcd), uint16(u))
+	case u <= 0xffffffff:
+		e.buf = binary.BigEndian.AppendUint32(append(e.buf, 0xce), uint32(u))
+	default:
+		e.buf = binary.BigEndian.AppendUint64(append(e.buf, 0xcf), u)
+	}
+}
+
+// Float encodes a float 64
+func (e *Encoder) Float(f float64) {
+	e.buf = binary.BigEndian.AppendUint64(append(e.buf, 0xcb), math.Float64bits(f))
+}
@@ -0,0 +1,88 @@
+// Package otlp holds the OpenTelemetry protocol data model used by bulklog
+// with its JSON and protobuf encodings.
+// ref: https://github.com/open-telemetry/opentelemetry-proto
+package otlp
+
+// ExportLogsServiceRequest - opentelemetry.proto.collector.logs.v1
+type ExportLogsServiceRequest struct {
+	ResourceLogs []ResourceLogs `json:"resourceLogs"`
+}
+
+// ExportLogsServiceResponse - opentelemetry.proto.collector.logs.v1, empty if every record is accepted
+type ExportLogsServiceResponse struct {
+	PartialSuccess *ExportLogsPartialSuccess `json:"partialSuccess,omitempty"`
+}
+
+// ExportLogsPartialSuccess - records rejected by the receiver
+type ExportLogsPartialSuccess struct {
+	RejectedLogRecords int64  `json:"rejectedLogRecords,string,omitempty"`
+	ErrorMessage       string `json:"errorMessage,omitempty"`
+}
+
+// ResourceLogs - logs produced by a resource
+type ResourceLogs struct {
+	Resource  Resource    `json:"resource"`
+	ScopeLogs []ScopeLogs `json:"scopeLogs"`
+	SchemaURL string      `json:"schemaUrl,omitempty"`
+}
+
+// Resource - entity producing telemetry
+type Resource struct {
+	Attributes []KeyValue `json:"attributes,omitempty"`
+}
+
+// ScopeLogs - logs produced by an instrumentation scope
+type ScopeLogs struct {
+	Scope      Scope       `json:"scope"`
+	LogRecords []LogRecord `json:"logRecords"`
+	SchemaURL  string      `json:"schemaUrl,omitempty"`
+}
+
+// Scope - instrumentation scope
+type Scope struct {
+	Name    string `json:"name,omitempty"`
+	Version string `json:"version,omitempty"`
+}
+
+// LogRecord - ref: https://opentelemetry.io/docs/specs/otel/logs/data-model/
+type LogRecord struct {
+	TimeUnixNano         uint64     `json:"timeUnixNano,string,omitempty"`
+	ObservedTimeUnixNano uint64     `json:"observedTimeUnixNano,string,omitempty"`
+	SeverityNumber       int        `json:"severityNumber,omitempty"`
+	SeverityText         string     `json:"severityText,omitempty"`
+	Body                 *AnyValue  `json:"body,omitempty"`
+	Attributes           []KeyValue `json:"attributes,omitempty"`
+	Flags                uint32     `json:"flags,omitempty"`
+	TraceID              HexBytes   `json:"traceId,omitempty"`
+	SpanID               HexBytes   `json:"spanId,omitempty"`
+}
+
+// Severity numbers of the first level of each range
+const (
+	SeverityTrace = 1
+	SeverityDebug = 5
+	SeverityInfo  = 9
+	SeverityWarn  = 13
+	SeverityError = 17
+	SeverityFatal = 21
+)
+
+// SeverityNumber maps common level names to severity numbers, 0 if unknown
+func SeverityNumber(level string) int {
+	switch level {
+	case "trace", "TRACE":
+		return SeverityTrace
+	case "debug", "DEBUG":
+		return SeverityDebug
+	case "info", "INFO", "informational", "notice":
+		return SeverityInfo
+	case "warn", "WARN", "warning", "WARNING":
+		return SeverityWarn
+	case "error", "ERROR", "err", "crit", "critical":
+		return SeverityError
+	case "fatal", "FATAL", "panic", "alert", "emerg":
+		return SeverityFatal
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,307 @@
+package otlp
+
+import (
+	"errors"
+	"math"
+
+	"github.com/khezen/bulklog/pkg/proto"
+)
+
+// maxDepth bounds nested array and kvlist values, so corrupt requests cannot overflow the stack
+const maxDepth = 1024
+
+// ErrTooDeep - a value nests array and kvlist values more than maxDepth levels deep
+var ErrTooDeep = errors.New("ErrTooDeep - OTLP values nest more than 1024 levels deep")
+
+// MarshalProto encodes the request in protobuf wire format
+func (r *ExportLogsServiceRequest) MarshalProto() []byte {
+	var e proto.Encoder
+	for i := range r.ResourceLogs {
+		rl := &r.ResourceLogs[i]
+		e.Message(1, rl.marshalProto)
+	}
+	return e.Bytes()
+}
+
+func (rl *ResourceLogs) marshalProto(e *proto.Encoder) {
+	e.Message(1, func(e *proto.Encoder) {
+		marshalKeyValues(e, 1, rl.Resource.Attributes)
+	})
+	for i := range rl.ScopeLogs {
+		sl := &rl.ScopeLogs[i]
+		e.Message(2, sl.marshalProto)
+	}
+	e.String(3, rl.SchemaURL)
+}
+
+func (sl *ScopeLogs) marshalProto(e *proto.Encoder) {
+	e.Message(1, func(e *proto.Encoder) {
+		e.String(1, sl.Scope.Name)
+		e.String(2, sl.Scope.Version)
+	})
+	for i := range sl.LogRecords {
+		lr := &sl.LogRecords[i]
+		e.Message(2, lr.marshalProto)
+	}
+	e.String(3, sl.SchemaURL)
+}
+
+func (lr *LogRecord) marshalProto(e *proto.Encoder) {
+	e.Fixed64(1, lr.TimeUnixNano)
+	e.Uint64(2, uint64(lr.SeverityNumber))
+	e.String(3, lr.SeverityText)
+	if lr.Body != nil {
+		e.Message(5, lr.Body.marshalProto)
+	}
+	marshalKeyValues(e, 6, lr.Attributes)
+	e.Fixed32(8, lr.Flags)
+	e.BytesField(9, lr.TraceID)
+	e.BytesField(10, lr.SpanID)
+	e.Fixed64(11, lr.ObservedTimeUnixNano)
+}
+
+func marshalKeyValues(e *proto.Encoder, field int, kvs []KeyValue) {
+	for i := range kvs {
+		kv := &kvs[i]
+		e.Message(field, func(e *proto.Encoder) {
+			e.String(1, kv.Key)
+			e.Message(2, kv.Value.marshalProto)
+		})
+	}
+}
+
+func (v *AnyValue) marshalProto(e *proto.Encoder) {
+	// oneof members are encoded even if zero so the value type is kept
+	switch {
+	case v.StringValue != nil:
+		e.PutBytes(1, []byte(*v.StringValue))
+	case v.BoolValue != nil:
+		var b uint64
+		if *v.BoolValue {
+			b = 1
+		}
+		e.PutVarint(2, b)
+	case v.IntValue != nil:
+		e.PutVarint(3, uint64(*v.IntValue))
+	case v.DoubleValue != nil:
+		e.PutFixed64(4, math.Float64bits(*v.DoubleValue))
+	case v.IsArray():
+		e.Message(5, func(e *proto.Encoder) {
+			for i := range v.ArrayValue {
+				e.Message(1, v.ArrayValue[i].marshalProto)
+			}
+		})
+	case v.IsKvlist():
+		e.Message(6, func(e *proto.Encoder) {
+			marshalKeyValues(e, 1, v.KvlistValue)
+		})
+	case v.BytesValue != nil:
+		e.PutBytes(7, v.BytesValue)
+	}
+}
+
+// UnmarshalProto decodes a request in protobuf wire format, unknown fields are skipped
+func (r *ExportLogsServiceRequest) UnmarshalProto(buf []byte) error {
+	d := proto.NewDecoder(buf)
+	for d.Next() {
+		if d.Field() == 1 && d.WireType() == proto.Bytes {
+			var rl ResourceLogs
+			err := rl.unmarshalProto(d.Bytes())
+			if err != nil {
+				return err
+			}
+			r.ResourceLogs = append(r.ResourceLogs, rl)
+		}
+	}
+	return d.Err()
+}
+
+func (rl *ResourceLogs) unmarshalProto(buf []byte) error {
+	d := proto.NewDecoder(buf)
+	for d.Next() {
+		var err error
+		switch {
+		case d.WireType() != proto.Bytes:
+		case d.Field() == 1:
+			rl.Resource.Attributes, err = unmarshalKeyValues(d.Bytes(), 1, 0)
+		case d.Field() == 2:
+			var sl ScopeLogs
+			err = sl.unmarshalProto(d.Bytes())
+			rl.ScopeLogs = append(rl.ScopeLogs, sl)
+		case d.Field() == 3:
+			rl.SchemaURL = d.String()
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return d.Err()
+}
+
+func (sl *ScopeLogs) unmarshalProto(buf []byte) error {
+	d := proto.NewDecoder(buf)
+	for d.Next() {
+		switch {
+		case d.WireType() != proto.Bytes:
+		case d.Field() == 1:
+			scope := proto.NewDecoder(d.Bytes())
+			for scope.Next() {
+				switch scope.Field() {
+				case 1:
+					sl.Scope.Name = scope.String()
+				case 2:
+					sl.Scope.Version = scope.String()
+				}
+			}
+			if scope.Err() != nil {
+				return scope.Err()
+			}
+		case d.Field() == 2:
+			var lr LogRecord
+			err := lr.unmarshalProto(d.Bytes())
+			if err != nil {
+				return err
+			}
+			sl.LogRecords = append(sl.LogRecords, lr)
+		case d.Field() == 3:
+			sl.SchemaURL = d.String()
+		}
+	}
+	return d.Err()
+}
+
+func (lr *LogRecord) unmarshalProto(buf []byte) error {
+	d := proto.NewDecoder(buf)
+	for d.Next() {
+		var err error
+		switch d.Field() {
+		case 1:
+			lr.TimeUnixNano = d.Uint64()
+		case 2:
+			lr.SeverityNumber = int(d.Int64())
+		case 3:
+			lr.SeverityText = d.String()
+		case 5:
+			var body AnyValue
+			err = body.unmarshalProto(d.Bytes(), 0)
+			lr.Body = &body
+		case 6:
+			var attribute KeyValue
+			err = attribute.unmarshalProto(d.Bytes(), 0)
+			lr.Attributes = append(lr.Attributes, attribute)
+		case 8:
+			lr.Flags = uint32(d.Uint64())
+		case 9:
+			lr.TraceID = append(HexBytes{}, d.Bytes()...)
+		case 10:
+			lr.SpanID = append(HexBytes{}, d.Bytes()...)
+		case 11:
+			lr.ObservedTimeUnixNano = d.Uint64()
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return d.Err()
+}
+
+// unmarshalKeyValues decodes the repeated KeyValue field of a message, whose values are nested depth levels deep
+func unmarshalKeyValues(buf []byte, field, depth int) ([]KeyValue, error) {
+	var (
+		kvs []KeyValue
+		d   = proto.NewDecoder(buf)
+	)
+	for d.Next() {
+		if d.Field() != field || d.WireType() != proto.Bytes {
+			continue
+		}
+		var kv KeyValue
+		err := kv.unmarshalProto(d.Bytes(), depth)
+		if err != nil {
+			return nil, err
+		}
+		kvs = append(kvs, kv)
+	}
+	return kvs, d.Err()
+}
+
+func (kv *KeyValue) unmarshalProto(buf []byte, depth int) error {
+	d := proto.NewDecoder(buf)
+	for d.Next() {
+		switch d.Field() {
+		case 1:
+			kv.Key = d.String()
+		case 2:
+			err := kv.Value.unmarshalProto(d.Bytes(), depth)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return d.Err()
+}
+
+func (v *AnyValue) unmarshalProto(buf []byte, depth int) error {
+	if depth >= maxDepth {
+		return ErrTooDeep
+	}
+	d := proto.NewDecoder(buf)
+	for d.Next() {
+		switch d.Field() {
+		case 1:
+			s := d.String()
+			*v = AnyValue{StringValue: &s}
+		case 2:
+			b := d.Bool()
+			*v = AnyValue{BoolValue: &b}
+		case 3:
+			n := d.Int64()
+			*v = AnyValue{IntValue: &n}
+		case 4:
+			f := d.Double()
+			*v = AnyValue{DoubleValue: &f}
+		case 5:
+			values := make([]AnyValue, 0)
+			array := proto.NewDecoder(d.Bytes())
+			for array.Next() {
+				if array.Field() != 1 {
+					continue
+				}
+				var item AnyValue
+				err := item.unmarshalProto(array.Bytes(), depth+1)
+				if err != nil {
+					return err
+				}
+				values = append(values, item)
+			}
+			if array.Err() != nil {
+				return array.Err()
+			}
+			*v = ArrayOf(values)
+		case 6:
+			values, err := unmarshalKeyValues(d.Bytes(), 1, depth+1)
+			if err != nil {
+				return err
+			}
+			if values == nil {
+				values = make([]KeyValue, 0)
+			}
+			*v = KvlistOf(values)
+		case 7:
+			*v = AnyValue{BytesValue: append([]byte{}, d.Bytes()...)}
+		}
+	}
+	return d.Err()
+}
+
+// MarshalProto encodes the response in protobuf wire format
+func (r *ExportLogsServiceResponse) MarshalProto() []byte {
+	var e proto.Encoder
+	if r.PartialSuccess != nil {
+		e.Message(1, func(e *proto.Encoder) {
+			e.Int64(1, r.PartialSuccess.RejectedLogRecords)
+			e.String(2, r.PartialSuccess.ErrorMessage)
+		})
+	}
+	return e.Bytes()
+}
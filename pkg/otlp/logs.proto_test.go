@@ -0,0 +1,93 @@
+package otlp
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/khezen/bulklog/pkg/proto"
+)
+
+// nestedBody encodes a request whose log record body nests depth array or kvlist values around a string
+func nestedBody(depth int, kvlist bool) []byte {
+	var value proto.Encoder
+	value.String(1, "leaf")
+	for i := 0; i < depth; i++ {
+		var outer proto.Encoder
+		if kvlist {
+			outer.Message(6, func(e *proto.Encoder) {
+				e.Message(1, func(e *proto.Encoder) {
+					e.String(1, "k")
+					e.PutBytes(2, value.Bytes())
+				})
+			})
+		} else {
+			outer.Message(5, func(e *proto.Encoder) {
+				e.PutBytes(1, value.Bytes())
+			})
+		}
+		value = outer
+	}
+	var e proto.Encoder
+	e.Message(1, func(e *proto.Encoder) {
+		e.Message(2, func(e *proto.Encoder) {
+			e.Message(2, func(e *proto.Encoder) {
+				e.PutBytes(5, value.Bytes())
+			})
+		})
+	})
+	return e.Bytes()
+}
+
+// TestUnmarshalProtoTooDeep checks deeply nested values are rejected rather than overflowing the stack
+func TestUnmarshalProtoTooDeep(t *testing.T) {
+	for _, kvlist := range []bool{false, true} {
+		var r ExportLogsServiceRequest
+		err := r.UnmarshalProto(nestedBody(maxDepth, kvlist))
+		if err != ErrTooDeep {
+			t.Fatalf("UnmarshalProto of %d nested values (kvlist %v): got %v, want %v", maxDepth, kvlist, err, ErrTooDeep)
+		}
+		r = ExportLogsServiceRequest{}
+		err = r.UnmarshalProto(nestedBody(maxDepth-1, kvlist))
+		if err != nil {
+			t.Fatalf("UnmarshalProto of %d nested values (kvlist %v): %s", maxDepth-1, kvlist, err)
+		}
+	}
+}
+
+// FuzzUnmarshalProto checks arbitrary requests are decoded or rejected rather than panicking, and requests decoded encode back to what they decode from
+func FuzzUnmarshalProto(f *testing.F) {
+	f.Add(nestedBody(3, false))
+	f.Add(nestedBody(3, true))
+	body, attribute := "GET /", int64(200)
+	request := ExportLogsServiceRequest{ResourceLogs: []ResourceLogs{{
+		Resource: Resource{Attributes: []KeyValue{{Key: "service.name", Value: AnyValue{StringValue: &body}}}},
+		ScopeLogs: []ScopeLogs{{
+			Scope: Scope{Name: "http", Version: "1"},
+			LogRecords: []LogRecord{{
+				TimeUnixNano:   1700000000000000000,
+				SeverityNumber: 9,
+				SeverityText:   "INFO",
+				Body:           &AnyValue{StringValue: &body},
+				Attributes:     []KeyValue{{Key: "status", Value: AnyValue{IntValue: &attribute}}},
+				TraceID:        HexBytes{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16},
+				SpanID:         HexBytes{1, 2, 3, 4, 5, 6, 7, 8},
+			}},
+		}},
+	}}}
+	f.Add(request.MarshalProto())
+	f.Fuzz(func(t *testing.T, buf []byte) {
+		var r ExportLogsServiceRequest
+		if r.UnmarshalProto(buf) != nil {
+			return
+		}
+		encoded := r.MarshalProto()
+		var decoded ExportLogsServiceRequest
+		err := decoded.UnmarshalProto(encoded)
+		if err != nil {
+			t.Fatalf("UnmarshalProto of %x, encoded from %x: %s", encoded, buf, err)
+		}
+		if reencoded := decoded.MarshalProto(); !bytes.Equal(reencoded, encoded) {
+			t.Fatalf("MarshalProto round trip of %x: got %x, want %x", buf, reencoded, encoded)
+		}
+	})
+}
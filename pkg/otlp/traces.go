@@ -0,0 +1,66 @@
+package otlp
+
+// ExportTraceServiceRequest - opentelemetry.proto.collector.trace.v1
+type ExportTraceServiceRequest struct {
+	ResourceSpans []ResourceSpans `json:"resourceSpans"`
+}
+
+// ResourceSpans - spans produced by a resource
+type ResourceSpans struct {
+	Resource   Resource     `json:"resource"`
+	ScopeSpans []ScopeSpans `json:"scopeSpans"`
+	SchemaURL  string       `json:"schemaUrl,omitempty"`
+}
+
+// ScopeSpans - spans produced by an instrumentation scope
+type ScopeSpans struct {
+	Scope     Scope  `json:"scope"`
+	Spans     []Span `json:"spans"`
+	SchemaURL string `json:"schemaUrl,omitempty"`
+}
+
+// Span - ref: https://opentelemetry.io/docs/specs/otel/trace/api/#span
+type Span struct {
+	TraceID           HexBytes   `json:"traceId"`
+	SpanID            HexBytes   `json:"spanId"`
+	ParentSpanID      HexBytes   `json:"parentSpanId,omitempty"`
+	Flags             uint32     `json:"flags,omitempty"`
+	Name              string     `json:"name"`
+	Kind              int        `json:"kind,omitempty"`
+	StartTimeUnixNano uint64     `json:"startTimeUnixNano,string"`
+	EndTimeUnixNano   uint64     `json:"endTimeUnixNano,string"`
+	Attributes        []KeyValue `json:"attributes,omitempty"`
+	Links             []Link     `json:"links,omitempty"`
+	DroppedLinksCount uint32     `json:"droppedLinksCount,omitempty"`
+	Status            Status     `json:"status"`
+}
+
+// Span kinds
+const (
+	SpanKindInternal = 1
+	SpanKindServer   = 2
+	SpanKindClient   = 3
+	SpanKindProducer = 4
+	SpanKindConsumer = 5
+)
+
+// Link - causal relationship to a span of another trace
+type Link struct {
+	TraceID    HexBytes   `json:"traceId"`
+	SpanID     HexBytes   `json:"spanId"`
+	Attributes []KeyValue `json:"attributes,omitempty"`
+	Flags      uint32     `json:"flags,omitempty"`
+}
+
+// Status - outcome of the span operation
+type Status struct {
+	Message string `json:"message,omitempty"`
+	Code    int    `json:"code,omitempty"`
+}
+
+// Status codes
+const (
+	StatusUnset = 0
+	StatusOK    = 1
+	StatusError = 2
+)
@@ -0,0 +1,66 @@
+package otlp
+
+import (
+	"github.com/khezen/bulklog/pkg/proto"
+)
+
+// MarshalProto encodes the request in protobuf wire format
+func (r *ExportTraceServiceRequest) MarshalProto() []byte {
+	var e proto.Encoder
+	for i := range r.ResourceSpans {
+		rs := &r.ResourceSpans[i]
+		e.Message(1, rs.marshalProto)
+	}
+	return e.Bytes()
+}
+
+func (rs *ResourceSpans) marshalProto(e *proto.Encoder) {
+	e.Message(1, func(e *proto.Encoder) {
+		marshalKeyValues(e, 1, rs.Resource.Attributes)
+	})
+	for i := range rs.ScopeSpans {
+		ss := &rs.ScopeSpans[i]
+		e.Message(2, ss.marshalProto)
+	}
+	e.String(3, rs.SchemaURL)
+}
+
+func (ss *ScopeSpans) marshalProto(e *proto.Encoder) {
+	e.Message(1, func(e *proto.Encoder) {
+		e.String(1, ss.Scope.Name)
+		e.String(2, ss.Scope.Version)
+	})
+	for i := range ss.Spans {
+		s := &ss.Spans[i]
+		e.Message(2, s.marshalProto)
+	}
+	e.String(3, ss.SchemaURL)
+}
+
+func (s *Span) marshalProto(e *proto.Encoder) {
+	e.BytesField(1, s.TraceID)
+	e.BytesField(2, s.SpanID)
+	e.BytesField(4, s.ParentSpanID)
+	e.String(5, s.Name)
+	e.Uint64(6, uint64(s.Kind))
+	e.Fixed64(7, s.StartTimeUnixNano)
+	e.Fixed64(8, s.EndTimeUnixNano)
+	marshalKeyValues(e, 9, s.Attributes)
+	for i := range s.Links {
+		l := &s.Links[i]
+		e.Message(13, l.marshalProto)
+	}
+	e.Uint64(14, uint64(s.DroppedLinksCount))
+	e.Message(15, func(e *proto.Encoder) {
+		e.String(2, s.Status.Message)
+		e.Uint64(3, uint64(s.Status.Code))
+	})
+	e.Fixed32(16, s.Flags)
+}
+
+func (l *Link) marshalProto(e *proto.Encoder) {
+	e.BytesField(1, l.TraceID)
+	e.BytesField(2, l.SpanID)
+	marshalKeyValues(e, 4, l.Attributes)
+	e.Fixed32(6, l.Flags)
+}
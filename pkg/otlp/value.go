@@ -0,0 +1,201 @@
+package otlp
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"strconv"
+)
+
+// KeyValue - attribute
+type KeyValue struct {
+	Key   string   `json:"key"`
+	Value AnyValue `json:"value"`
+}
+
+// AnyValue - one of string, bool, int, double, array, kvlist or bytes
+type AnyValue struct {
+	StringValue *string
+	BoolValue   *bool
+	IntValue    *int64
+	DoubleValue *float64
+	ArrayValue  []AnyValue
+	KvlistValue []KeyValue
+	BytesValue  []byte
+	isArray     bool
+	isKvlist    bool
+}
+
+// StringValue -
+func StringValue(v string) AnyValue {
+	return AnyValue{StringValue: &v}
+}
+
+// ArrayOf -
+func ArrayOf(values []AnyValue) AnyValue {
+	return AnyValue{ArrayValue: values, isArray: true}
+}
+
+// KvlistOf -
+func KvlistOf(values []KeyValue) AnyValue {
+	return AnyValue{KvlistValue: values, isKvlist: true}
+}
+
+// IsArray -
+func (v AnyValue) IsArray() bool {
+	return v.isArray || v.ArrayValue != nil
+}
+
+// IsKvlist -
+func (v AnyValue) IsKvlist() bool {
+	return v.isKvlist || v.KvlistValue != nil
+}
+
+// FromInterface converts a decoded JSON value
+func FromInterface(i interface{}) AnyValue {
+	switch v := i.(type) {
+	case string:
+		return StringValue(v)
+	case bool:
+		return AnyValue{BoolValue: &v}
+	case float64:
+		if v == float64(int64(v)) {
+			n := int64(v)
+			return AnyValue{IntValue: &n}
+		}
+		return AnyValue{DoubleValue: &v}
+	case []interface{}:
+		values := make([]AnyValue, 0, len(v))
+		for _, item := range v {
+			values = append(values, FromInterface(item))
+		}
+		return ArrayOf(values)
+	case map[string]interface{}:
+		values := make([]KeyValue, 0, len(v))
+		for key, item := range v {
+			values = append(values, KeyValue{key, FromInterface(item)})
+		}
+		return KvlistOf(values)
+	default:
+		return AnyValue{}
+	}
+}
+
+// Interface converts the value to its JSON counterpart
+func (v AnyValue) Interface() interface{} {
+	switch {
+	case v.StringValue != nil:
+		return *v.StringValue
+	case v.BoolValue != nil:
+		return *v.BoolValue
+	case v.IntValue != nil:
+		return *v.IntValue
+	case v.DoubleValue != nil:
+		return *v.DoubleValue
+	case v.IsArray():
+		values := make([]interface{}, 0, len(v.ArrayValue))
+		for _, item := range v.ArrayValue {
+			values = append(values, item.Interface())
+		}
+		return values
+	case v.IsKvlist():
+		values := make(map[string]interface{}, len(v.KvlistValue))
+		for _, kv := range v.KvlistValue {
+			values[kv.Key] = kv.Value.Interface()
+		}
+		return values
+	case v.BytesValue != nil:
+		return v.BytesValue
+	default:
+		return nil
+	}
+}
+
+type jsonAnyValue struct {
+	StringValue *string         `json:"stringValue,omitempty"`
+	BoolValue   *bool           `json:"boolValue,omitempty"`
+	IntValue    json.RawMessage `json:"intValue,omitempty"`
+	DoubleValue *float64        `json:"doubleValue,omitempty"`
+	ArrayValue  *struct {
+		Values []AnyValue `json:"values"`
+	} `json:"arrayValue,omitempty"`
+	KvlistValue *struct {
+		Values []KeyValue `json:"values"`
+	} `json:"kvlistValue,omitempty"`
+	BytesValue []byte `json:"bytesValue,omitempty"`
+}
+
+// MarshalJSON - int64 are encoded as strings
+func (v AnyValue) MarshalJSON() ([]byte, error) {
+	j := jsonAnyValue{
+		StringValue: v.StringValue,
+		BoolValue:   v.BoolValue,
+		DoubleValue: v.DoubleValue,
+		BytesValue:  v.BytesValue,
+	}
+	if v.IntValue != nil {
+		j.IntValue = json.RawMessage(strconv.Quote(strconv.FormatInt(*v.IntValue, 10)))
+	}
+	if v.IsArray() {
+		j.ArrayValue = &struct {
+			Values []AnyValue `json:"values"`
+		}{v.ArrayValue}
+	}
+	if v.IsKvlist() {
+		j.KvlistValue = &struct {
+			Values []KeyValue `json:"values"`
+		}{v.KvlistValue}
+	}
+	return json.Marshal(j)
+}
+
+// UnmarshalJSON - int64 are accepted as strings or numbers
+func (v *AnyValue) UnmarshalJSON(b []byte) error {
+	var j jsonAnyValue
+	err := json.Unmarshal(b, &j)
+	if err != nil {
+		return err
+	}
+	*v = AnyValue{
+		StringValue: j.StringValue,
+		BoolValue:   j.BoolValue,
+		DoubleValue: j.DoubleValue,
+		BytesValue:  j.BytesValue,
+	}
+	if len(j.IntValue) > 0 {
+		var str string
+		if json.Unmarshal(j.IntValue, &str) != nil {
+			str = string(j.IntValue)
+		}
+		n, err := strconv.ParseInt(str, 10, 64)
+		if err != nil {
+			return err
+		}
+		v.IntValue = &n
+	}
+	if j.ArrayValue != nil {
+		*v = ArrayOf(j.ArrayValue.Values)
+	}
+	if j.KvlistValue != nil {
+		*v = KvlistOf(j.KvlistValue.Values)
+	}
+	return nil
+}
+
+// HexBytes - trace and span IDs are hex encoded in JSON
+type HexBytes []byte
+
+// MarshalJSON -
+func (h HexBytes) MarshalJSON() ([]byte, error) {
+	return json.Marshal(hex.EncodeToString(h))
+}
+
+// UnmarshalJSON -
+func (h *HexBytes) UnmarshalJSON(b []byte) error {
+	var str string
+	err := json.Unmarshal(b, &str)
+	if err != nil {
+		return err
+	}
+	*h, err = hex.DecodeString(str)
+	return err
+}
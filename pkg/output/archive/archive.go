@@ -0,0 +1,150 @@
+package archive
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/khezen/bulklog/pkg/collection"
+)
+
+// Line - archived document, one JSON object per line
+type Line struct {
+	ID             uuid.UUID             `json:"id"`
+	PostedAt       string                `json:"postedAt"`
+	CollectionName collection.Name       `json:"collection"`
+	SchemaName     collection.SchemaName `json:"schema"`
+	Body           json.RawMessage       `json:"body"`
+}
+
+// Object - archive object content
+type Object struct {
+	Key  string
+	Body []byte
+}
+
+// Render groups documents by collection and renders one gzip compressed NDJSON object per group.
+// Object keys look like {prefix}{collection}/yyyy/mm/dd/hh/{pipeID}.ndjson.gz,
+// where the time partition is the one of the earliest document
+// and pipeID is the ID of the pipe the documents are conveyed from, so retries overwrite the same object.
+// Documents conveyed outside of a pipe, such as dead letters, get an ID derived from their document IDs instead.
+func Render(prefix, pipeID string, documents []collection.Document) ([]Object, error) {
+	var (
+		groups = make(map[collection.Name][]collection.Document)
+		names  = make([]string, 0)
+	)
+	for _, doc := range documents {
+		if _, ok := groups[doc.CollectionName]; !ok {
+			names = append(names, string(doc.CollectionName))
+		}
+		groups[doc.CollectionName] = append(groups[doc.CollectionName], doc)
+	}
+	sort.Strings(names)
+	objects := make([]Object, 0, len(groups))
+	for _, name := range names {
+		group := groups[collection.Name(name)]
+		body, err := Encode(group)
+		if err != nil {
+			return nil, fmt.Errorf("Encode.%s", err)
+		}
+		objects = append(objects, Object{
+			Key:  Key(prefix, pipeID, group),
+			Body: body,
+		})
+	}
+	return objects, nil
+}
+
+// Key - object key of the given documents of a single collection, conveyed from the pipe pipeID if not empty
+func Key(prefix, pipeID string, documents []collection.Document) string {
+	earliest := documents[0].PostedAt
+	for _, doc := range documents {
+		if doc.PostedAt.Before(earliest) {
+			earliest = doc.PostedAt
+		}
+	}
+	if pipeID == "" {
+		ids := make([]string, 0, len(documents))
+		for _, doc := range documents {
+			ids = append(ids, doc.ID.String())
+		}
+		pipeID = uuid.NewSHA1(uuid.NameSpaceOID, []byte(strings.Join(ids, ","))).String()
+	}
+	return prefix + path.Join(
+		string(documents[0].CollectionName),
+		earliest.UTC().Format("2006/01/02/15"),
+		fmt.Sprintf("%s.ndjson.gz", pipeID),
+	)
+}
+
+// Encode renders documents as gzip compressed NDJSON
+func Encode(documents []collection.Document) ([]byte, error) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	encoder := json.NewEncoder(gz)
+	for _, doc := range documents {
+		err := encoder.Encode(Line{
+			ID:             doc.ID,
+			PostedAt:       doc.PostedAt.UTC().Format(time.RFC3339Nano),
+			CollectionName: doc.CollectionName,
+			SchemaName:     doc.SchemaName,
+			Body:           json.RawMessage(doc.Body),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("json.Encode.%s", err)
+		}
+	}
+	err := gz.Close()
+	if err != nil {
+		return nil, fmt.Errorf("gzip.Close.%s", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// Partitions - key prefixes of the objects a collection archived between from and to.
+// The hour before from is included, since an object is partitioned by its earliest document.
+func Partitions(prefix string, collectionName collection.Name, from, to time.Time) []string {
+	prefixes := make([]string, 0)
+	for hour := from.UTC().Truncate(time.Hour).Add(-time.Hour); !hour.After(to); hour = hour.Add(time.Hour) {
+		prefixes = append(prefixes, prefix+path.Join(string(collectionName), hour.Format("2006/01/02/15"))+"/")
+	}
+	return prefixes
+}
+
+// Decode reads documents back from gzip compressed NDJSON
+func Decode(body []byte) ([]collection.Document, error) {
+	gz, err := gzip.NewReader(bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("gzip.NewReader.%s", err)
+	}
+	defer gz.Close()
+	var (
+		decoder   = json.NewDecoder(gz)
+		documents = make([]collection.Document, 0)
+	)
+	for decoder.More() {
+		var line Line
+		err = decoder.Decode(&line)
+		if err != nil {
+			return nil, fmt.Errorf("json.Decode.%s", err)
+		}
+		postedAt, err := time.Parse(time.RFC3339Nano, line.PostedAt)
+		if err != nil {
+			return nil, fmt.Errorf("time.Parse.%s", err)
+		}
+		documents = append(documents, collection.Document{
+			ID:             line.ID,
+			PostedAt:       postedAt,
+			CollectionName: line.CollectionName,
+			SchemaName:     line.SchemaName,
+			Body:           []byte(line.Body),
+		})
+	}
+	return documents, nil
+}
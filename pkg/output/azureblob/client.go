@@ -0,0 +1,114 @@
+package azureblob
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/khezen/bulklog/pkg/auth"
+	"github.com/khezen/bulklog/pkg/collection"
+	"github.com/khezen/bulklog/pkg/output/archive"
+	"github.com/khezen/bulklog/pkg/output/dryrun"
+	"github.com/khezen/bulklog/pkg/output/idempotency"
+)
+
+const (
+	// apiVersion - x-ms-version of requests, bearer tokens require 2017-11-09 at least
+	apiVersion = "2021-12-02"
+	resource   = "https://storage.azure.com/"
+)
+
+// AzureBlob archives documents as gzip compressed NDJSON block blobs
+type AzureBlob struct {
+	signer  auth.Signer
+	baseURL string
+	prefix  string
+	tier    Tier
+	httpcli http.Client
+}
+
+// New returns azure blob storage as an output.
+// If endpoint is set, blobs are written to this blob service, such as the Azurite emulator.
+func New(cfg Config) (*AzureBlob, error) {
+	signer, err := auth.NewAzureSigner(cfg.AzureAuth, cfg.Account, resource)
+	if err != nil {
+		return nil, fmt.Errorf("auth.NewAzureSigner.%s", err)
+	}
+	endpoint := cfg.Endpoint
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://%s.blob.core.windows.net", cfg.Account)
+	}
+	return &AzureBlob{
+		signer,
+		fmt.Sprintf("%s/%s", strings.TrimSuffix(endpoint, "/"), cfg.Container),
+		cfg.Prefix,
+		cfg.Tier,
+		http.Client{
+			Transport: dryrun.Transport(&http.Transport{
+				MaxIdleConns:    10,
+				IdleConnTimeout: 30 * time.Second,
+			}),
+		},
+	}, nil
+}
+
+// Digest puts documents in azure blob storage
+func (c *AzureBlob) Digest(ctx context.Context, documents []collection.Document) error {
+	objects, err := archive.Render(c.prefix, idempotency.Pipe(ctx), documents)
+	if err != nil {
+		return fmt.Errorf("archive.Render.%s", err)
+	}
+	for _, object := range objects {
+		err = c.put(ctx, object)
+		if err != nil {
+			return fmt.Errorf("put.%s", err)
+		}
+	}
+	return nil
+}
+
+func (c *AzureBlob) put(ctx context.Context, object archive.Object) error {
+	req, err := http.NewRequestWithContext(ctx, "PUT", fmt.Sprintf("%s/%s", c.baseURL, object.Key), bytes.NewReader(object.Body))
+	if err != nil {
+		return fmt.Errorf("http.NewRequest.%s", err)
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	req.Header.Set("Content-Encoding", "gzip")
+	req.Header.Set("x-ms-blob-type", "BlockBlob")
+	if c.tier != "" {
+		req.Header.Set("x-ms-access-tier", string(c.tier))
+	}
+	_, err = c.do(req, object.Body)
+	return err
+}
+
+// do signs and sends the request, it returns the response body
+func (c *AzureBlob) do(req *http.Request, body []byte) ([]byte, error) {
+	req.Header.Set("x-ms-version", apiVersion)
+	err := c.signer.Sign(req, body)
+	if err != nil {
+		return nil, fmt.Errorf("Sign.%s", err)
+	}
+	res, err := c.httpcli.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("httpClient.Do.%s", err)
+	}
+	defer res.Body.Close()
+	resBody, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, fmt.Errorf("ioutil.ReadAll.%s", err)
+	}
+	if res.StatusCode >= 300 {
+		return nil, fmt.Errorf("azure blob: %s : %s", res.Status, resBody)
+	}
+	return resBody, nil
+}
+
+// Ensure - container is expected to exist
+func (c *AzureBlob) Ensure(ctx context.Context, collection *collection.Collection) error {
+	return nil
+}
@@ -0,0 +1,36 @@
+package azureblob
+
+import (
+	"errors"
+
+	"github.com/khezen/bulklog/pkg/auth"
+)
+
+// ErrUnknownTier -
+var ErrUnknownTier = errors.New("ErrUnknownTier - azure blob tier must be one of Hot|Cool|Cold|Archive")
+
+// Config -
+type Config struct {
+	Enabled   bool   `yaml:"enabled"`
+	Account   string `yaml:"account"`
+	Container string `yaml:"container"`
+	Prefix    string `yaml:"prefix"`
+	// Endpoint - blob service URL, https://{account}.blob.core.windows.net by default
+	Endpoint string `yaml:"endpoint"`
+	// Tier - access tier of blobs, the default tier of the account if empty
+	Tier      Tier             `yaml:"tier"`
+	AzureAuth auth.AzureConfig `yaml:"azure_auth"`
+}
+
+// Tier - blob access tier
+type Tier string
+
+// Validate reports unknown access tiers
+func (t Tier) Validate() error {
+	switch t {
+	case "", "Hot", "Cool", "Cold", "Archive":
+		return nil
+	default:
+		return ErrUnknownTier
+	}
+}
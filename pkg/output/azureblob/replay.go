@@ -0,0 +1,92 @@
+package azureblob
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/khezen/bulklog/pkg/collection"
+	"github.com/khezen/bulklog/pkg/output/archive"
+)
+
+// enumerationResults - page of a List Blobs response
+type enumerationResults struct {
+	Blobs struct {
+		Blob []struct {
+			Name string `xml:"Name"`
+		} `xml:"Blob"`
+	} `xml:"Blobs"`
+	NextMarker string `xml:"NextMarker"`
+}
+
+// Archived lists the blobs of a collection in the hourly partitions between from and to
+func (c *AzureBlob) Archived(ctx context.Context, collectionName collection.Name, from, to time.Time) ([]string, error) {
+	keys := make([]string, 0)
+	for _, prefix := range archive.Partitions(c.prefix, collectionName, from, to) {
+		partition, err := c.list(ctx, prefix)
+		if err != nil {
+			return nil, fmt.Errorf("list(%s).%s", prefix, err)
+		}
+		keys = append(keys, partition...)
+	}
+	return keys, nil
+}
+
+// ArchivedDocuments gets a blob and decodes its documents, blobs of the Archive tier must be rehydrated first
+func (c *AzureBlob) ArchivedDocuments(ctx context.Context, key string) ([]collection.Document, error) {
+	body, err := c.get(ctx, fmt.Sprintf("%s/%s", c.baseURL, key))
+	if err != nil {
+		return nil, fmt.Errorf("get.%s", err)
+	}
+	documents, err := archive.Decode(body)
+	if err != nil {
+		return nil, fmt.Errorf("archive.Decode.%s", err)
+	}
+	return documents, nil
+}
+
+// list returns the names of blobs starting with prefix, following markers
+func (c *AzureBlob) list(ctx context.Context, prefix string) ([]string, error) {
+	var (
+		keys   = make([]string, 0)
+		marker string
+	)
+	for {
+		query := url.Values{}
+		query.Set("restype", "container")
+		query.Set("comp", "list")
+		query.Set("prefix", prefix)
+		if marker != "" {
+			query.Set("marker", marker)
+		}
+		body, err := c.get(ctx, fmt.Sprintf("%s?%s", c.baseURL, query.Encode()))
+		if err != nil {
+			return nil, err
+		}
+		var page enumerationResults
+		err = xml.Unmarshal(body, &page)
+		if err != nil {
+			return nil, fmt.Errorf("xml.Unmarshal.%s", err)
+		}
+		for _, blob := range page.Blobs.Blob {
+			keys = append(keys, blob.Name)
+		}
+		if page.NextMarker == "" {
+			return keys, nil
+		}
+		marker = page.NextMarker
+	}
+}
+
+func (c *AzureBlob) get(ctx context.Context, blobURL string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", blobURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("http.NewRequest.%s", err)
+	}
+	// blobs are read as stored, the transport would otherwise decompress them
+	req.Header.Set("Accept-Encoding", "gzip")
+	return c.do(req, nil)
+}
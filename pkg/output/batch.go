@@ -0,0 +1,179 @@
+package output
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/khezen/bulklog/pkg/collection"
+	"github.com/khezen/bulklog/pkg/output/idempotency"
+	"github.com/khezen/bulklog/pkg/output/partial"
+	"github.com/khezen/bulklog/pkg/output/retry"
+)
+
+// ErrWrongBatch - batch settings are invalid
+var ErrWrongBatch = errors.New("ErrWrongBatch - batch max_documents and max_bytes must be >= 0")
+
+// BatchLimits - maximum batch sent at once to an output, unbounded unless set
+type BatchLimits struct {
+	MaxDocuments int   `yaml:"max_documents"`
+	MaxBytes     int64 `yaml:"max_bytes"`
+}
+
+// BatchConfig - maximum batch sent at once to every output, and to specific ones
+type BatchConfig struct {
+	MaxDocuments int   `yaml:"max_documents"`
+	MaxBytes     int64 `yaml:"max_bytes"`
+	// Outputs - limits of specific outputs by output name, e.g. elasticsearch, webhook.alerts or plugin.archive
+	Outputs map[string]BatchLimits `yaml:"outputs"`
+}
+
+// Enabled - whether batches are bounded
+func (l BatchLimits) Enabled() bool {
+	return l.MaxDocuments > 0 || l.MaxBytes > 0
+}
+
+// Validate reports invalid batch limits
+func (l BatchLimits) Validate() error {
+	if l.MaxDocuments < 0 || l.MaxBytes < 0 {
+		return ErrWrongBatch
+	}
+	return nil
+}
+
+// Limits - batch limits of an output
+func (c BatchConfig) Limits(outputName string) BatchLimits {
+	if limits, ok := c.Outputs[outputName]; ok {
+		return limits
+	}
+	return BatchLimits{
+		MaxDocuments: c.MaxDocuments,
+		MaxBytes:     c.MaxBytes,
+	}
+}
+
+// Validate reports invalid batch settings
+func (c BatchConfig) Validate() error {
+	err := BatchLimits{MaxDocuments: c.MaxDocuments, MaxBytes: c.MaxBytes}.Validate()
+	if err != nil {
+		return err
+	}
+	for _, limits := range c.Outputs {
+		err = limits.Validate()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Splitter digests documents in sub-batches bounded by document count and size, the size of documents being the one of their bodies.
+// A document larger than the size limit is digested alone.
+type Splitter struct {
+	Interface
+	limits BatchLimits
+}
+
+// NewSplitter bounds the batches out digests to limits
+func NewSplitter(out Interface, limits BatchLimits) *Splitter {
+	return &Splitter{
+		Interface: out,
+		limits:    limits,
+	}
+}
+
+// Digest digests sub-batches one after another.
+// If only some of them fail, it returns a *partial.Error reporting the documents of failed sub-batches,
+// and the ones left once ctx is done.
+// Once the destination asks to be retried later, the sub-batches left fail the same way without being tried.
+// Each sub-batch is given the pipe ID {pipe ID}-{first document ID}: only failed sub-batches are retried, so their first documents
+// never start a sub-batch which was delivered, and the objects of delivered sub-batches are not overwritten.
+func (s *Splitter) Digest(ctx context.Context, documents []collection.Document) error {
+	batches := s.split(documents)
+	if len(batches) == 1 {
+		return s.Interface.Digest(ctx, documents)
+	}
+	var (
+		partialErr = &partial.Error{Total: len(documents)}
+		firstErr   error
+		retryErr   error
+		failed     int
+		offset     int
+	)
+	for _, batch := range batches {
+		err := ctx.Err()
+		if err == nil {
+			err = retryErr
+		}
+		if err == nil {
+			err = s.Interface.Digest(batchContext(ctx, batch), batch)
+			if !retry.At(err).IsZero() {
+				retryErr = err
+			}
+		}
+		if err == nil {
+			offset += len(batch)
+			continue
+		}
+		failed++
+		if firstErr == nil {
+			firstErr = err
+		}
+		if batchErr, ok := err.(*partial.Error); ok && batchErr.Total == len(batch) {
+			for _, failure := range batchErr.Failures {
+				failure.Index += offset
+				partialErr.Failures = append(partialErr.Failures, failure)
+			}
+		} else {
+			for i := range batch {
+				partialErr.Failures = append(partialErr.Failures, partial.Failure{Index: offset + i, Reason: err.Error()})
+			}
+		}
+		offset += len(batch)
+	}
+	if failed == 0 {
+		return nil
+	}
+	// every sub-batch failed the same way as a single batch would
+	if _, ok := firstErr.(*partial.Error); !ok && failed == len(batches) {
+		return firstErr
+	}
+	if at := retry.At(retryErr); !at.IsZero() {
+		return &retry.Error{Err: partialErr, At: at}
+	}
+	return partialErr
+}
+
+// batchContext - ctx carrying the pipe ID of the sub-batch, if it carries one of the pipe
+func batchContext(ctx context.Context, batch []collection.Document) context.Context {
+	pipeID := idempotency.Pipe(ctx)
+	if pipeID == "" {
+		return ctx
+	}
+	return idempotency.WithPipe(ctx, fmt.Sprintf("%s-%s", pipeID, batch[0].ID))
+}
+
+func (s *Splitter) split(documents []collection.Document) [][]collection.Document {
+	var (
+		batches [][]collection.Document
+		start   int
+		size    int64
+	)
+	for i := range documents {
+		docSize := int64(len(documents[i].Body))
+		full := i > start &&
+			((s.limits.MaxDocuments > 0 && i-start >= s.limits.MaxDocuments) ||
+				(s.limits.MaxBytes > 0 && size+docSize > s.limits.MaxBytes))
+		if full {
+			batches = append(batches, documents[start:i])
+			start = i
+			size = 0
+		}
+		size += docSize
+	}
+	return append(batches, documents[start:])
+}
+
+func (s *Splitter) unwrap() Interface {
+	return s.Interface
+}
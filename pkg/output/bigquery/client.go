@@ -0,0 +1,315 @@
+package bigquery
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/khezen/bulklog/pkg/auth"
+	"github.com/khezen/bulklog/pkg/collection"
+	"github.com/khezen/bulklog/pkg/grpc"
+	"github.com/khezen/bulklog/pkg/output/dryrun"
+	"github.com/khezen/bulklog/pkg/proto"
+)
+
+const (
+	baseURL         = "https://bigquery.googleapis.com/bigquery/v2"
+	storageEndpoint = "bigquerystorage.googleapis.com:443"
+	// ref: https://cloud.google.com/bigquery/docs/reference/storage/rpc/google.cloud.bigquery.storage.v1#bigquerywrite
+	appendRowsMethod  = "/google.cloud.bigquery.storage.v1.BigQueryWrite/AppendRows"
+	scope             = "https://www.googleapis.com/auth/bigquery.insertdata"
+	adminScope        = "https://www.googleapis.com/auth/bigquery"
+	defaultMaxRetries = 5
+	retryBase         = time.Second
+	// maxRequestRows - serialized rows of an AppendRows request, which must stay under 10MB
+	maxRequestRows = 8 << 20
+)
+
+var (
+	// ErrUnknownCollection - Digest has been called before Ensure
+	ErrUnknownCollection = errors.New("ErrUnknownCollection - collection has not been ensured")
+	errAlreadyExists     = errors.New("errAlreadyExists")
+)
+
+// BigQuery streams documents into a table per collection with the Storage Write API
+type BigQuery struct {
+	sync.RWMutex
+	signer       auth.Signer
+	project      string
+	dataset      string
+	tables       map[collection.Name]string
+	createTables bool
+	maxRetries   int
+	httpcli      http.Client
+	writecli     *grpc.Client
+	// schemas - row encoding by collection, as learnt on Ensure
+	schemas map[collection.Name]*ProtoSchema
+}
+
+// New returns bigquery as an output
+func New(cfg Config) (*BigQuery, error) {
+	scopes := []string{scope}
+	if cfg.CreateTables {
+		scopes = []string{adminScope}
+	}
+	signer, err := auth.NewGoogleSigner(cfg.GoogleAuth, scopes...)
+	if err != nil {
+		return nil, fmt.Errorf("auth.NewGoogleSigner.%s", err)
+	}
+	if cfg.MaxRetries <= 0 {
+		cfg.MaxRetries = defaultMaxRetries
+	}
+	return &BigQuery{
+		signer:       signer,
+		project:      cfg.Project,
+		dataset:      cfg.Dataset,
+		tables:       cfg.Tables,
+		createTables: cfg.CreateTables,
+		maxRetries:   cfg.MaxRetries,
+		httpcli: http.Client{
+			Timeout:   time.Minute,
+			Transport: dryrun.Transport(nil),
+		},
+		writecli: grpc.NewSignedClient(storageEndpoint, false, signer, dryrun.Transport),
+		schemas:  make(map[collection.Name]*ProtoSchema),
+	}, nil
+}
+
+// Digest appends documents to the default stream of their tables with AppendRows.
+// The default stream commits rows once appended, at least once: pipes delivered again are appended again.
+func (c *BigQuery) Digest(ctx context.Context, documents []collection.Document) error {
+	groups := make(map[collection.Name][]collection.Document)
+	for _, doc := range documents {
+		groups[doc.CollectionName] = append(groups[doc.CollectionName], doc)
+	}
+	for collectionName, group := range groups {
+		c.RLock()
+		schema, ok := c.schemas[collectionName]
+		c.RUnlock()
+		if !ok {
+			return ErrUnknownCollection
+		}
+		rows := make([][]byte, 0, len(group))
+		for _, doc := range group {
+			row, err := schema.Row(doc)
+			if err != nil {
+				return fmt.Errorf("Row.%s", err)
+			}
+			rows = append(rows, row)
+		}
+		stream := fmt.Sprintf("projects/%s/datasets/%s/tables/%s/streams/_default", c.project, c.dataset, c.tableID(collectionName))
+		for _, chunk := range splitRows(rows) {
+			err := c.appendRows(ctx, stream, schema, chunk)
+			if err != nil {
+				return fmt.Errorf("appendRows.%s", err)
+			}
+		}
+	}
+	return nil
+}
+
+// Ensure learns how to encode the rows of the collection, and creates its table if create_tables is enabled
+func (c *BigQuery) Ensure(ctx context.Context, collec *collection.Collection) error {
+	c.Lock()
+	c.schemas[collec.Name] = NewProtoSchema(collec)
+	c.Unlock()
+	if !c.createTables {
+		return nil
+	}
+	table := RenderTable(TableReference{c.project, c.dataset, c.tableID(collec.Name)}, collec)
+	body, err := json.Marshal(table)
+	if err != nil {
+		return fmt.Errorf("json.Marshal.%s", err)
+	}
+	endpoint := fmt.Sprintf("%s/projects/%s/datasets/%s/tables", baseURL, c.project, c.dataset)
+	err = c.do(ctx, func() (bool, error) {
+		return c.post(ctx, endpoint, body)
+	})
+	if err != nil && err != errAlreadyExists {
+		return fmt.Errorf("do.%s", err)
+	}
+	return nil
+}
+
+func (c *BigQuery) tableID(collectionName collection.Name) string {
+	if table, ok := c.tables[collectionName]; ok {
+		return table
+	}
+	return string(collectionName)
+}
+
+// splitRows - rows of AppendRows requests, a row larger than the limit is in a request of its own
+func splitRows(rows [][]byte) [][][]byte {
+	var (
+		chunks [][][]byte
+		start  int
+		size   int
+	)
+	for i, row := range rows {
+		if i > start && size+len(row) > maxRequestRows {
+			chunks = append(chunks, rows[start:i])
+			start, size = i, 0
+		}
+		size += len(row)
+	}
+	return append(chunks, rows[start:])
+}
+
+// appendRows appends rows to stream in a single request, which succeeds or fails as a whole
+func (c *BigQuery) appendRows(ctx context.Context, stream string, schema *ProtoSchema, rows [][]byte) error {
+	var e proto.Encoder
+	e.String(1, stream)
+	e.Message(4, func(e *proto.Encoder) {
+		e.Message(1, func(e *proto.Encoder) {
+			e.PutBytes(1, schema.Descriptor())
+		})
+		e.Message(2, func(e *proto.Encoder) {
+			for _, row := range rows {
+				e.PutBytes(1, row)
+			}
+		})
+	})
+	request := e.Bytes()
+	// the stream routes the call to the server holding it
+	ctx = grpc.WithMetadata(ctx, map[string]string{"x-goog-request-params": "write_stream=" + stream})
+	return c.do(ctx, func() (bool, error) {
+		response, err := c.writecli.Invoke(ctx, appendRowsMethod, request)
+		if err != nil {
+			return retriable(err), fmt.Errorf("Invoke.%s", err)
+		}
+		err = decodeAppendRowsResponse(response, len(rows))
+		return retriable(err), err
+	})
+}
+
+// decodeAppendRowsResponse returns the error of an AppendRowsResponse, as a *grpc.Status unless rows were rejected
+func decodeAppendRowsResponse(response []byte, rows int) error {
+	var (
+		d         = proto.NewDecoder(response)
+		status    *grpc.Status
+		rowErrors int
+		first     string
+	)
+	for d.Next() {
+		switch d.Field() {
+		case 2:
+			status = &grpc.Status{}
+			status.Code, status.Message = decodeStatus(d.Bytes())
+		case 4:
+			rowErrors++
+			if rowErrors == 1 {
+				first = decodeRowError(d.Bytes())
+			}
+		}
+	}
+	if d.Err() != nil {
+		return fmt.Errorf("proto.Decode.%s", d.Err())
+	}
+	if rowErrors > 0 {
+		return fmt.Errorf("bigquery: %d/%d rows failed, first: %s", rowErrors, rows, first)
+	}
+	if status != nil && status.Code != grpc.OK {
+		return status
+	}
+	return nil
+}
+
+// decodeStatus decodes a google.rpc.Status
+func decodeStatus(buf []byte) (code grpc.Code, message string) {
+	d := proto.NewDecoder(buf)
+	for d.Next() {
+		switch d.Field() {
+		case 1:
+			code = grpc.Code(d.Int64())
+		case 2:
+			message = d.String()
+		}
+	}
+	return code, message
+}
+
+// decodeRowError renders a RowError as index: message
+func decodeRowError(buf []byte) string {
+	var (
+		d       = proto.NewDecoder(buf)
+		index   int64
+		message string
+	)
+	for d.Next() {
+		switch d.Field() {
+		case 1:
+			index = d.Int64()
+		case 3:
+			message = d.String()
+		}
+	}
+	return fmt.Sprintf("row %d: %s", index, message)
+}
+
+// retriable tells whether err is a quota, rate limit or availability error
+func retriable(err error) bool {
+	status, ok := err.(*grpc.Status)
+	return ok && (status.Code == grpc.ResourceExhausted || status.Code == grpc.Unavailable || status.Code == grpc.Internal)
+}
+
+// do runs call and retries it with exponential backoff on quota and rate limit errors, until ctx is done
+func (c *BigQuery) do(ctx context.Context, call func() (retry bool, err error)) error {
+	var (
+		err   error
+		retry bool
+	)
+	for i := 0; i <= c.maxRetries; i++ {
+		if i > 0 {
+			timer := time.NewTimer(retryBase * time.Duration(math.Pow(2, float64(i-1))))
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				return fmt.Errorf("%s; %s", err, ctx.Err())
+			}
+		}
+		retry, err = call()
+		if err == nil || !retry {
+			return err
+		}
+	}
+	return err
+}
+
+func (c *BigQuery) post(ctx context.Context, endpoint string, body []byte) (retry bool, err error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewReader(body))
+	if err != nil {
+		return false, fmt.Errorf("http.NewRequest.%s", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	err = c.signer.Sign(req, body)
+	if err != nil {
+		return false, fmt.Errorf("Sign.%s", err)
+	}
+	res, err := c.httpcli.Do(req)
+	if err != nil {
+		return true, fmt.Errorf("httpClient.Do.%s", err)
+	}
+	defer res.Body.Close()
+	resBody, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return true, fmt.Errorf("ioutil.ReadAll.%s", err)
+	}
+	if res.StatusCode == http.StatusConflict {
+		return false, errAlreadyExists
+	}
+	if res.StatusCode >= 300 {
+		retry = res.StatusCode == http.StatusTooManyRequests ||
+			res.StatusCode >= 500 ||
+			(res.StatusCode == http.StatusForbidden && (bytes.Contains(resBody, []byte("quotaExceeded")) || bytes.Contains(resBody, []byte("rateLimitExceeded"))))
+		return retry, fmt.Errorf("bigquery: %s : %s", res.Status, resBody)
+	}
+	return false, nil
+}
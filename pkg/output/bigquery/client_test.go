@@ -0,0 +1,310 @@
+package bigquery
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/khezen/bulklog/pkg/collection"
+	"github.com/khezen/bulklog/pkg/grpc"
+	"github.com/khezen/bulklog/pkg/output/dryrun"
+	"github.com/khezen/bulklog/pkg/proto"
+)
+
+type tokenSigner struct{}
+
+func (tokenSigner) Sign(r *http.Request, body []byte) error {
+	r.Header.Set("Authorization", "Bearer token")
+	return nil
+}
+
+// appendRowsRequest - fields of an AppendRowsRequest received by the fake server
+type appendRowsRequest struct {
+	stream     string
+	descriptor []byte
+	rows       [][]byte
+}
+
+// fakeBigQueryWrite serves AppendRows, answering with response
+type fakeBigQueryWrite struct {
+	mu       sync.Mutex
+	requests []appendRowsRequest
+	response []byte
+}
+
+func (f *fakeBigQueryWrite) appendRows(ctx context.Context, request []byte) ([]byte, error) {
+	var (
+		req appendRowsRequest
+		d   = proto.NewDecoder(request)
+	)
+	for d.Next() {
+		switch d.Field() {
+		case 1:
+			req.stream = d.String()
+		case 4:
+			data := proto.NewDecoder(d.Bytes())
+			for data.Next() {
+				inner := proto.NewDecoder(data.Bytes())
+				for inner.Next() {
+					if data.Field() == 1 {
+						req.descriptor = inner.Bytes()
+					} else {
+						req.rows = append(req.rows, inner.Bytes())
+					}
+				}
+			}
+		}
+	}
+	if d.Err() != nil {
+		return nil, &grpc.Status{Code: grpc.InvalidArgument, Message: d.Err().Error()}
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.requests = append(f.requests, req)
+	return f.response, nil
+}
+
+func newFakeBigQueryWrite(t *testing.T) (*fakeBigQueryWrite, *BigQuery) {
+	f := &fakeBigQueryWrite{}
+	mux := grpc.NewServeMux()
+	mux.HandleUnary(appendRowsMethod, f.appendRows)
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor != 2 || r.Header.Get("Authorization") != "Bearer token" ||
+			r.Header.Get("X-Goog-Request-Params") != "write_stream=projects/p/datasets/d/tables/app_logs/streams/_default" {
+			t.Errorf("request %s %v", r.Proto, r.Header)
+		}
+		mux.ServeHTTP(w, r)
+	}))
+	var protocols http.Protocols
+	protocols.SetUnencryptedHTTP2(true)
+	srv.Config.Protocols = &protocols
+	srv.Start()
+	t.Cleanup(srv.Close)
+	bq, err := New(Config{Project: "p", Dataset: "d", Tables: map[collection.Name]string{"logs": "app_logs"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bq.writecli = grpc.NewSignedClient(strings.TrimPrefix(srv.URL, "http://"), true, tokenSigner{}, dryrun.Transport)
+	return f, bq
+}
+
+var testCollection = &collection.Collection{
+	Name: "logs",
+	Schemas: []collection.Schema{{
+		Name: "event",
+		Fields: map[string]collection.Field{
+			"level":   {Type: collection.String},
+			"status":  {Type: collection.Int16},
+			"ok":      {Type: collection.Bool},
+			"latency": {Type: collection.Float64},
+			"at":      {Type: collection.DateTime, DateFormat: time.RFC3339},
+			"ctx":     {Type: collection.Object},
+		},
+	}},
+}
+
+// descriptorField - name, number, label and type of a FieldDescriptorProto
+type descriptorField struct {
+	name                string
+	number, label, kind uint64
+}
+
+func TestDigestAppendRows(t *testing.T) {
+	f, bq := newFakeBigQueryWrite(t)
+	err := bq.Ensure(context.Background(), testCollection)
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc, err := collection.NewDocument("logs", "event", []byte(`{"level":"warn","status":-2,"ok":false,"latency":0.5,"at":"2023-11-14T22:13:20Z","ctx":{"a":[1]},"other":1}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mismatched, err := collection.NewDocument("logs", "event", []byte(`{"level":3,"status":"abc","at":"yesterday"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = bq.Digest(context.Background(), []collection.Document{*doc, *mismatched})
+	if err != nil {
+		t.Fatalf("Digest: %s", err)
+	}
+	if len(f.requests) != 1 {
+		t.Fatalf("%d AppendRows requests, want 1", len(f.requests))
+	}
+	req := f.requests[0]
+	if req.stream != "projects/p/datasets/d/tables/app_logs/streams/_default" {
+		t.Fatalf("write_stream = %s", req.stream)
+	}
+	var (
+		d      = proto.NewDecoder(req.descriptor)
+		name   string
+		fields []descriptorField
+	)
+	for d.Next() {
+		if d.Field() == 1 {
+			name = d.String()
+			continue
+		}
+		var field descriptorField
+		inner := proto.NewDecoder(d.Bytes())
+		for inner.Next() {
+			switch inner.Field() {
+			case 1:
+				field.name = inner.String()
+			case 3:
+				field.number = inner.Uint64()
+			case 4:
+				field.label = inner.Uint64()
+			case 5:
+				field.kind = inner.Uint64()
+			}
+		}
+		fields = append(fields, field)
+	}
+	wantFields := []descriptorField{
+		{"id", 1, 1, typeString}, {"posted_at", 2, 1, typeInt64}, {"schema", 3, 1, typeString},
+		{"at", 4, 1, typeInt64}, {"ctx", 5, 1, typeString}, {"latency", 6, 1, typeDouble},
+		{"level", 7, 1, typeString}, {"ok", 8, 1, typeBool}, {"status", 9, 1, typeInt64},
+	}
+	if name != rowMessage || len(fields) != len(wantFields) {
+		t.Fatalf("descriptor %s: %+v", name, fields)
+	}
+	for i := range fields {
+		if fields[i] != wantFields[i] {
+			t.Fatalf("descriptor field %d = %+v, want %+v", i, fields[i], wantFields[i])
+		}
+	}
+	if len(req.rows) != 2 {
+		t.Fatalf("%d rows, want 2", len(req.rows))
+	}
+	row := decodeRow(t, req.rows[0])
+	want := map[int]interface{}{
+		1: doc.ID.String(),
+		2: uint64(doc.PostedAt.UnixMicro()),
+		3: "event",
+		4: uint64(1700000000000000),
+		5: `{"a":[1]}`,
+		6: math.Float64bits(0.5),
+		7: "warn",
+		8: uint64(0),
+		9: uint64(math.MaxUint64 - 1),
+	}
+	assertRow(t, row, want)
+	// values which do not match their column are NULL, strings keep others as JSON
+	row = decodeRow(t, req.rows[1])
+	assertRow(t, row, map[int]interface{}{1: mismatched.ID.String(), 2: uint64(mismatched.PostedAt.UnixMicro()), 3: "event", 7: "3"})
+}
+
+func decodeRow(t *testing.T, buf []byte) map[int]interface{} {
+	t.Helper()
+	row := make(map[int]interface{})
+	d := proto.NewDecoder(buf)
+	for d.Next() {
+		switch d.WireType() {
+		case proto.Bytes:
+			row[d.Field()] = d.String()
+		default:
+			row[d.Field()] = d.Uint64()
+		}
+	}
+	if d.Err() != nil {
+		t.Fatal(d.Err())
+	}
+	return row
+}
+
+func assertRow(t *testing.T, row, want map[int]interface{}) {
+	t.Helper()
+	if len(row) != len(want) {
+		t.Fatalf("row %v, want %v", row, want)
+	}
+	for field, value := range want {
+		if row[field] != value {
+			t.Fatalf("row field %d = %v, want %v", field, row[field], value)
+		}
+	}
+}
+
+func TestDigestAppendRowsErrors(t *testing.T) {
+	f, bq := newFakeBigQueryWrite(t)
+	doc, err := collection.NewDocument("logs", "event", []byte(`{"level":"warn"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = bq.Digest(context.Background(), []collection.Document{*doc})
+	if err != ErrUnknownCollection {
+		t.Fatalf("Digest before Ensure: got %v, want %v", err, ErrUnknownCollection)
+	}
+	bq.Ensure(context.Background(), testCollection)
+	responses := map[string]struct {
+		response func(e *proto.Encoder)
+		err      string
+	}{
+		"row errors": {
+			response: func(e *proto.Encoder) {
+				e.Message(4, func(e *proto.Encoder) {
+					e.PutVarint(1, 0)
+					e.PutVarint(2, 1)
+					e.String(3, "invalid level")
+				})
+			},
+			err: "appendRows.bigquery: 1/1 rows failed, first: row 0: invalid level",
+		},
+		"status": {
+			response: func(e *proto.Encoder) {
+				e.Message(2, func(e *proto.Encoder) {
+					e.PutVarint(1, uint64(grpc.InvalidArgument))
+					e.String(2, "schema mismatch")
+				})
+			},
+			err: "appendRows.grpc: code 3: schema mismatch",
+		},
+	}
+	for name, response := range responses {
+		t.Run(name, func(t *testing.T) {
+			var e proto.Encoder
+			response.response(&e)
+			f.mu.Lock()
+			f.requests, f.response = nil, e.Bytes()
+			f.mu.Unlock()
+			err := bq.Digest(context.Background(), []collection.Document{*doc})
+			if err == nil || err.Error() != response.err {
+				t.Fatalf("Digest: got %v, want %s", err, response.err)
+			}
+			if len(f.requests) != 1 {
+				t.Fatalf("%d AppendRows requests, want a single one as the error is not retriable", len(f.requests))
+			}
+		})
+	}
+}
+
+// TestDigestDryRun checks AppendRows calls of dry runs are recorded without reaching BigQuery
+func TestDigestDryRun(t *testing.T) {
+	f, bq := newFakeBigQueryWrite(t)
+	bq.Ensure(context.Background(), testCollection)
+	doc, err := collection.NewDocument("logs", "event", []byte(`{"level":"warn"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorder := dryrun.NewRecorder(nil)
+	err = bq.Digest(dryrun.WithRecorder(context.Background(), recorder), []collection.Document{*doc})
+	if err != nil {
+		t.Fatalf("Digest: %s", err)
+	}
+	if len(f.requests) != 0 || recorder.Requests() != 1 || recorder.Bytes() == 0 {
+		t.Fatalf("dry run: %d requests sent, %d recorded", len(f.requests), recorder.Requests())
+	}
+}
+
+func TestSplitRows(t *testing.T) {
+	large := make([]byte, maxRequestRows)
+	rows := [][]byte{{1}, {2}, large, {3}}
+	chunks := splitRows(rows)
+	if len(chunks) != 3 || len(chunks[0]) != 2 || len(chunks[1]) != 1 || len(chunks[2]) != 1 {
+		t.Fatalf("splitRows: %d chunks", len(chunks))
+	}
+}
@@ -0,0 +1,17 @@
+package bigquery
+
+import (
+	"github.com/khezen/bulklog/pkg/auth"
+	"github.com/khezen/bulklog/pkg/collection"
+)
+
+// Config -
+type Config struct {
+	Enabled      bool                       `yaml:"enabled"`
+	Project      string                     `yaml:"project"`
+	Dataset      string                     `yaml:"dataset"`
+	Tables       map[collection.Name]string `yaml:"tables"`
+	CreateTables bool                       `yaml:"create_tables"`
+	MaxRetries   int                        `yaml:"max_retries"`
+	GoogleAuth   auth.GoogleConfig          `yaml:"google_auth"`
+}
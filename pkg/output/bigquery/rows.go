@@ -0,0 +1,135 @@
+package bigquery
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/khezen/bulklog/pkg/collection"
+	"github.com/khezen/bulklog/pkg/proto"
+)
+
+// field types and labels of FieldDescriptorProto
+// ref: https://github.com/protocolbuffers/protobuf/blob/main/src/google/protobuf/descriptor.proto
+const (
+	typeDouble    = 1
+	typeInt64     = 3
+	typeBool      = 8
+	typeString    = 9
+	labelOptional = 1
+)
+
+// rowMessage - name of the message rows are encoded as
+const rowMessage = "Row"
+
+// ProtoSchema - protobuf encoding of the rows of a collection table, as the Storage Write API expects them.
+// Columns are fields numbered from 1 in the order of the table:
+// TIMESTAMP columns are int64 microseconds since epoch, JSON columns are strings.
+type ProtoSchema struct {
+	columns []TableField
+	fields  map[string]collection.Field
+}
+
+// NewProtoSchema - columns of the table RenderTable renders for collec
+func NewProtoSchema(collec *collection.Collection) *ProtoSchema {
+	table := RenderTable(TableReference{}, collec)
+	return &ProtoSchema{table.Schema.Fields, collectionFields(collec)}
+}
+
+// Descriptor renders the DescriptorProto of rows
+func (s *ProtoSchema) Descriptor() []byte {
+	var e proto.Encoder
+	e.String(1, rowMessage)
+	for i, column := range s.columns {
+		e.Message(2, func(e *proto.Encoder) {
+			e.String(1, column.Name)
+			e.PutVarint(3, uint64(i+1))
+			e.PutVarint(4, labelOptional)
+			e.PutVarint(5, protoType(column.Type))
+		})
+	}
+	return e.Bytes()
+}
+
+// Row encodes a document.
+// Field values which do not match their column type are left NULL, as well as fields which are not in collection schemas.
+func (s *ProtoSchema) Row(doc collection.Document) ([]byte, error) {
+	var body map[string]json.RawMessage
+	err := json.Unmarshal(doc.Body, &body)
+	if err != nil {
+		return nil, fmt.Errorf("json.Unmarshal.%s", err)
+	}
+	var e proto.Encoder
+	e.PutBytes(1, []byte(doc.ID.String()))
+	e.PutVarint(2, uint64(doc.PostedAt.UnixMicro()))
+	e.PutBytes(3, []byte(doc.SchemaName))
+	for i, column := range s.columns[3:] {
+		encodeValue(&e, i+4, body[column.Name], s.fields[column.Name])
+	}
+	return e.Bytes(), nil
+}
+
+func encodeValue(e *proto.Encoder, number int, raw json.RawMessage, field collection.Field) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return
+	}
+	switch field.Type {
+	case collection.Bool:
+		var b bool
+		if json.Unmarshal(raw, &b) != nil {
+			return
+		}
+		if b {
+			e.PutVarint(number, 1)
+		} else {
+			e.PutVarint(number, 0)
+		}
+	case collection.UInt8, collection.UInt16, collection.UInt32, collection.UInt64,
+		collection.Int8, collection.Int16, collection.Int32, collection.Int64:
+		i, err := strconv.ParseInt(string(raw), 10, 64)
+		if err != nil {
+			return
+		}
+		e.PutVarint(number, uint64(i))
+	case collection.Float32, collection.Float64:
+		f, err := strconv.ParseFloat(string(raw), 64)
+		if err != nil {
+			return
+		}
+		e.PutFixed64(number, math.Float64bits(f))
+	case collection.DateTime:
+		var str string
+		if json.Unmarshal(raw, &str) != nil {
+			return
+		}
+		date, err := time.Parse(field.DateFormat, str)
+		if err != nil {
+			return
+		}
+		e.PutVarint(number, uint64(date.UnixMicro()))
+	case collection.Object:
+		e.PutBytes(number, raw)
+	default:
+		var str string
+		if json.Unmarshal(raw, &str) != nil {
+			// numbers, booleans and nested values of string fields are kept as JSON
+			str = string(raw)
+		}
+		e.PutBytes(number, []byte(str))
+	}
+}
+
+func protoType(columnType string) uint64 {
+	switch columnType {
+	case "BOOLEAN":
+		return typeBool
+	case "INTEGER", "TIMESTAMP":
+		return typeInt64
+	case "FLOAT":
+		return typeDouble
+	default:
+		return typeString
+	}
+}
@@ -0,0 +1,99 @@
+package bigquery
+
+import (
+	"sort"
+
+	"github.com/khezen/bulklog/pkg/collection"
+)
+
+// TableSchema - ref: https://cloud.google.com/bigquery/docs/reference/rest/v2/tables#TableSchema
+type TableSchema struct {
+	Fields []TableField `json:"fields"`
+}
+
+// TableField -
+type TableField struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+	Mode string `json:"mode,omitempty"`
+}
+
+// Table - bigquery table definition
+type Table struct {
+	TableReference TableReference `json:"tableReference"`
+	Schema         TableSchema    `json:"schema"`
+	TimePartition  TimePartition  `json:"timePartitioning"`
+}
+
+// TableReference -
+type TableReference struct {
+	ProjectID string `json:"projectId"`
+	DatasetID string `json:"datasetId"`
+	TableID   string `json:"tableId"`
+}
+
+// TimePartition -
+type TimePartition struct {
+	Type  string `json:"type"`
+	Field string `json:"field"`
+}
+
+// RenderTable infers a table schema from collection schemas
+func RenderTable(ref TableReference, collec *collection.Collection) Table {
+	fields := collectionFields(collec)
+	names := make([]string, 0, len(fields))
+	for key := range fields {
+		names = append(names, key)
+	}
+	sort.Strings(names)
+	tableFields := []TableField{
+		{Name: "id", Type: "STRING", Mode: "REQUIRED"},
+		{Name: "posted_at", Type: "TIMESTAMP", Mode: "REQUIRED"},
+		{Name: "schema", Type: "STRING", Mode: "REQUIRED"},
+	}
+	for _, key := range names {
+		tableFields = append(tableFields, TableField{
+			Name: key,
+			Type: translateType(fields[key]),
+			Mode: "NULLABLE",
+		})
+	}
+	return Table{
+		TableReference: ref,
+		Schema:         TableSchema{tableFields},
+		TimePartition:  TimePartition{Type: "DAY", Field: "posted_at"},
+	}
+}
+
+// collectionFields - fields of every collection schema, but the ones named as metadata columns
+func collectionFields(collec *collection.Collection) map[string]collection.Field {
+	fields := make(map[string]collection.Field)
+	for _, schema := range collec.Schemas {
+		for key, field := range schema.Fields {
+			switch key {
+			case "id", "posted_at", "schema":
+				continue
+			}
+			fields[key] = field
+		}
+	}
+	return fields
+}
+
+func translateType(field collection.Field) string {
+	switch field.Type {
+	case collection.Bool:
+		return "BOOLEAN"
+	case collection.UInt8, collection.UInt16, collection.UInt32, collection.UInt64,
+		collection.Int8, collection.Int16, collection.Int32, collection.Int64:
+		return "INTEGER"
+	case collection.Float32, collection.Float64:
+		return "FLOAT"
+	case collection.DateTime:
+		return "TIMESTAMP"
+	case collection.Object:
+		return "JSON"
+	default:
+		return "STRING"
+	}
+}
@@ -0,0 +1,174 @@
+package output
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/khezen/bulklog/pkg/collection"
+)
+
+const defaultCoolDown = 30 * time.Second
+
+var (
+	// ErrCircuitOpen - the output failed too many times in a row, tries are skipped until its cool down ends
+	ErrCircuitOpen = errors.New("ErrCircuitOpen - output circuit breaker is open")
+	// ErrWrongBreaker - circuit breaker settings are invalid
+	ErrWrongBreaker = errors.New("ErrWrongBreaker - circuit_breaker failures must be >= 0 and cool_down positive")
+)
+
+// BreakerConfig - circuit breaker of every output, disabled unless failures is set
+type BreakerConfig struct {
+	Failures    int    `yaml:"failures"`
+	CoolDownStr string `yaml:"cool_down"`
+}
+
+// Enabled - whether outputs are guarded by a circuit breaker
+func (c BreakerConfig) Enabled() bool {
+	return c.Failures > 0
+}
+
+// CoolDown - how long an open circuit skips tries, 30 seconds by default
+func (c BreakerConfig) CoolDown() (time.Duration, error) {
+	if c.CoolDownStr == "" {
+		return defaultCoolDown, nil
+	}
+	coolDown, err := collection.Period(c.CoolDownStr)
+	if err != nil {
+		return 0, fmt.Errorf("collection.Period.%s", err)
+	}
+	return coolDown, nil
+}
+
+// Validate reports invalid circuit breaker settings
+func (c BreakerConfig) Validate() error {
+	if c.Failures < 0 {
+		return ErrWrongBreaker
+	}
+	coolDown, err := c.CoolDown()
+	if err != nil {
+		return err
+	}
+	if coolDown <= 0 {
+		return ErrWrongBreaker
+	}
+	return nil
+}
+
+// circuit states
+const (
+	// Closed - tries reach the output
+	Closed = "closed"
+	// Open - tries fail with ErrCircuitOpen until the cool down ends
+	Open = "open"
+	// HalfOpen - a single try probes the output, the others fail with ErrCircuitOpen
+	HalfOpen = "half_open"
+)
+
+// BreakerState - circuit state of an output
+type BreakerState struct {
+	State string `json:"state"`
+	// Failures - consecutive failed tries
+	Failures  int        `json:"failures"`
+	OpenUntil *time.Time `json:"open_until,omitempty"`
+}
+
+// Breaker stops trying an output after consecutive failures, for a cool down period.
+// Once it ends, one try probes the output: the circuit closes if it succeeds, opens again otherwise.
+type Breaker struct {
+	Interface
+	sync.Mutex
+	maxFailures int
+	coolDown    time.Duration
+	failures    int
+	state       string
+	openedAt    time.Time
+}
+
+// NewBreaker opens the circuit of out after maxFailures consecutive failed tries
+func NewBreaker(out Interface, maxFailures int, coolDown time.Duration) *Breaker {
+	return &Breaker{
+		Interface:   out,
+		maxFailures: maxFailures,
+		coolDown:    coolDown,
+		state:       Closed,
+	}
+}
+
+// Digest fails with ErrCircuitOpen without reaching the output while the circuit is open.
+// Tries cancelled by the caller, rather than timed out, do not count as failures.
+func (b *Breaker) Digest(ctx context.Context, documents []collection.Document) error {
+	if !b.allow() {
+		return ErrCircuitOpen
+	}
+	err := b.Interface.Digest(ctx, documents)
+	if err != nil && errors.Is(ctx.Err(), context.Canceled) {
+		b.cancelled()
+		return err
+	}
+	b.record(err)
+	return err
+}
+
+func (b *Breaker) allow() bool {
+	b.Lock()
+	defer b.Unlock()
+	switch b.state {
+	case Open:
+		if time.Since(b.openedAt) < b.coolDown {
+			return false
+		}
+		b.state = HalfOpen
+		return true
+	case HalfOpen:
+		// a probe is in flight
+		return false
+	default:
+		return true
+	}
+}
+
+func (b *Breaker) record(err error) {
+	b.Lock()
+	defer b.Unlock()
+	if err == nil {
+		b.failures = 0
+		b.state = Closed
+		return
+	}
+	b.failures++
+	if b.state == HalfOpen || b.failures >= b.maxFailures {
+		b.state = Open
+		b.openedAt = time.Now().UTC()
+	}
+}
+
+// cancelled lets another try probe the output if the cancelled one was probing it
+func (b *Breaker) cancelled() {
+	b.Lock()
+	defer b.Unlock()
+	if b.state == HalfOpen {
+		b.state = Open
+	}
+}
+
+func (b *Breaker) unwrap() Interface {
+	return b.Interface
+}
+
+// State reports the circuit state
+func (b *Breaker) State() BreakerState {
+	b.Lock()
+	defer b.Unlock()
+	state := BreakerState{
+		State:    b.state,
+		Failures: b.failures,
+	}
+	if b.state == Open {
+		openUntil := b.openedAt.Add(b.coolDown)
+		state.OpenUntil = &openUntil
+	}
+	return state
+}
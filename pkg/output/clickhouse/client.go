@@ -0,0 +1,169 @@
+package clickhouse
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/khezen/bulklog/pkg/auth"
+	"github.com/khezen/bulklog/pkg/collection"
+	"github.com/khezen/bulklog/pkg/output/compression"
+	"github.com/khezen/bulklog/pkg/output/dryrun"
+	"github.com/khezen/bulklog/pkg/output/retry"
+)
+
+var (
+	// ErrUnknownCollection - Digest has been called before Ensure
+	ErrUnknownCollection = errors.New("ErrUnknownCollection - collection has not been ensured")
+)
+
+// ClickHouse writes documents through ClickHouse HTTP interface
+type ClickHouse struct {
+	sync.RWMutex
+	signer       auth.Signer
+	endpoint     string
+	database     string
+	tableNames   map[collection.Name]string
+	rawColumn    string
+	createTables bool
+	tables       map[collection.Name]*Table
+	httpcli      http.Client
+	compression  compression.Compression
+}
+
+// New returns clickhouse as an output
+func New(cfg Config) *ClickHouse {
+	if cfg.Scheme == "" {
+		cfg.Scheme = "http"
+	}
+	var signer auth.Signer
+	if cfg.BasicAuth != nil {
+		signer = auth.NewBasicSigner(*cfg.BasicAuth)
+	}
+	return &ClickHouse{
+		signer:       signer,
+		endpoint:     fmt.Sprintf("%s://%s/", cfg.Scheme, cfg.Endpoint),
+		database:     cfg.Database,
+		tableNames:   cfg.Tables,
+		rawColumn:    cfg.RawColumn,
+		createTables: cfg.CreateTables,
+		tables:       make(map[collection.Name]*Table),
+		httpcli: http.Client{
+			Transport: dryrun.Transport(&http.Transport{
+				MaxIdleConns:    10,
+				IdleConnTimeout: 30 * time.Second,
+			}),
+		},
+		compression: cfg.Compression,
+	}
+}
+
+// Ping - ref: https://clickhouse.com/docs/en/interfaces/http
+func (c *ClickHouse) Ping(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", c.endpoint+"ping", nil)
+	if err != nil {
+		return fmt.Errorf("http.NewRequest.%s", err)
+	}
+	res, err := c.httpcli.Do(req)
+	if err != nil {
+		return fmt.Errorf("httpClient.Do.%s", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("clickhouse: %s", res.Status)
+	}
+	return nil
+}
+
+// Digest inserts documents in a single batch per collection
+func (c *ClickHouse) Digest(ctx context.Context, documents []collection.Document) error {
+	groups := make(map[collection.Name][]collection.Document)
+	for _, doc := range documents {
+		groups[doc.CollectionName] = append(groups[doc.CollectionName], doc)
+	}
+	for collectionName, group := range groups {
+		c.RLock()
+		table, ok := c.tables[collectionName]
+		c.RUnlock()
+		if !ok {
+			return ErrUnknownCollection
+		}
+		rows, err := table.Rows(group)
+		if err != nil {
+			return fmt.Errorf("Rows.%s", err)
+		}
+		err = c.query(ctx, table.InsertStatement(), rows)
+		if err != nil {
+			return fmt.Errorf("query.%s", err)
+		}
+	}
+	return nil
+}
+
+// Ensure maps collection schemas to table columns and optionally creates the table
+func (c *ClickHouse) Ensure(ctx context.Context, collec *collection.Collection) error {
+	name, ok := c.tableNames[collec.Name]
+	if !ok {
+		name = string(collec.Name)
+	}
+	if c.database != "" {
+		name = fmt.Sprintf("%s.%s", c.database, name)
+	}
+	table := NewTable(name, collec, c.rawColumn)
+	if c.createTables {
+		err := c.query(ctx, table.CreateStatement(), nil)
+		if err != nil {
+			return fmt.Errorf("query.%s", err)
+		}
+	}
+	c.Lock()
+	c.tables[collec.Name] = table
+	c.Unlock()
+	return nil
+}
+
+func (c *ClickHouse) query(ctx context.Context, query string, body []byte) error {
+	params := url.Values{}
+	params.Set("query", query)
+	params.Set("date_time_input_format", "best_effort")
+	params.Set("input_format_skip_unknown_fields", "1")
+	if body != nil {
+		var err error
+		body, err = c.compression.Encode(body)
+		if err != nil {
+			return fmt.Errorf("Encode.%s", err)
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", fmt.Sprintf("%s?%s", c.endpoint, params.Encode()), bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("http.NewRequest.%s", err)
+	}
+	if body != nil {
+		c.compression.SetHeader(req)
+	}
+	if c.signer != nil {
+		err = c.signer.Sign(req, body)
+		if err != nil {
+			return fmt.Errorf("Sign.%s", err)
+		}
+	}
+	res, err := c.httpcli.Do(req)
+	if err != nil {
+		return fmt.Errorf("httpClient.Do.%s", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode >= 300 {
+		resBody, err := ioutil.ReadAll(res.Body)
+		if err != nil {
+			return fmt.Errorf("ioutil.ReadAll.%s", err)
+		}
+		return retry.FromResponse(res, fmt.Errorf("clickhouse: %s : %s", res.Status, resBody))
+	}
+	return nil
+}
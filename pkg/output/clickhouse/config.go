@@ -0,0 +1,21 @@
+package clickhouse
+
+import (
+	"github.com/khezen/bulklog/pkg/auth"
+	"github.com/khezen/bulklog/pkg/collection"
+	"github.com/khezen/bulklog/pkg/output/compression"
+)
+
+// Config -
+type Config struct {
+	Enabled      bool                       `yaml:"enabled"`
+	Endpoint     string                     `yaml:"endpoint"`
+	Scheme       string                     `yaml:"scheme"`
+	Database     string                     `yaml:"database"`
+	Tables       map[collection.Name]string `yaml:"tables"`
+	RawColumn    string                     `yaml:"raw_column"`
+	CreateTables bool                       `yaml:"create_tables"`
+	BasicAuth    *auth.BasicConfig          `yaml:"basic_auth,omitempty"`
+	// Compression - Content-Encoding of inserted rows, none by default
+	Compression compression.Compression `yaml:"compression"`
+}
@@ -0,0 +1,148 @@
+package clickhouse
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/khezen/bulklog/pkg/collection"
+)
+
+const (
+	idColumn       = "id"
+	postedAtColumn = "posted_at"
+	schemaColumn   = "schema"
+	dateTime64     = "2006-01-02 15:04:05.999999999"
+)
+
+// Table - clickhouse table of a collection
+type Table struct {
+	Name      string
+	Columns   map[string]collection.Field
+	RawColumn string
+}
+
+// NewTable maps every schema field of the collection to a column
+func NewTable(name string, collec *collection.Collection, rawColumn string) *Table {
+	columns := make(map[string]collection.Field)
+	for _, schema := range collec.Schemas {
+		for key, field := range schema.Fields {
+			columns[key] = field
+		}
+	}
+	return &Table{name, columns, rawColumn}
+}
+
+// CreateStatement renders CREATE TABLE IF NOT EXISTS
+func (t *Table) CreateStatement() string {
+	var stmt strings.Builder
+	fmt.Fprintf(&stmt, "CREATE TABLE IF NOT EXISTS %s (", t.Name)
+	fmt.Fprintf(&stmt, "`%s` UUID, `%s` DateTime64(9, 'UTC'), `%s` LowCardinality(String)", idColumn, postedAtColumn, schemaColumn)
+	for _, key := range t.columnNames() {
+		fmt.Fprintf(&stmt, ", `%s` Nullable(%s)", key, translateType(t.Columns[key]))
+	}
+	if t.RawColumn != "" {
+		fmt.Fprintf(&stmt, ", `%s` String", t.RawColumn)
+	}
+	fmt.Fprintf(&stmt, ") ENGINE = MergeTree ORDER BY %s", postedAtColumn)
+	return stmt.String()
+}
+
+// InsertStatement renders INSERT INTO ... FORMAT JSONEachRow
+func (t *Table) InsertStatement() string {
+	return fmt.Sprintf("INSERT INTO %s FORMAT JSONEachRow", t.Name)
+}
+
+// Rows renders documents as JSONEachRow rows.
+// Fields which are not mapped to a column are kept as a JSON string in the raw column, if any.
+func (t *Table) Rows(documents []collection.Document) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	for _, doc := range documents {
+		var body map[string]interface{}
+		err := json.Unmarshal(doc.Body, &body)
+		if err != nil {
+			return nil, fmt.Errorf("json.Unmarshal.%s", err)
+		}
+		row := map[string]interface{}{
+			idColumn:       doc.ID.String(),
+			postedAtColumn: doc.PostedAt.UTC().Format(dateTime64),
+			schemaColumn:   string(doc.SchemaName),
+		}
+		unmapped := make(map[string]interface{})
+		for key, value := range body {
+			field, ok := t.Columns[key]
+			if !ok {
+				unmapped[key] = value
+				continue
+			}
+			if field.Type == collection.Object {
+				valueBytes, err := json.Marshal(value)
+				if err != nil {
+					return nil, fmt.Errorf("json.Marshal.%s", err)
+				}
+				value = string(valueBytes)
+			}
+			row[key] = value
+		}
+		if t.RawColumn != "" {
+			rawBytes, err := json.Marshal(unmapped)
+			if err != nil {
+				return nil, fmt.Errorf("json.Marshal.%s", err)
+			}
+			row[t.RawColumn] = string(rawBytes)
+		}
+		err = encoder.Encode(row)
+		if err != nil {
+			return nil, fmt.Errorf("json.Encode.%s", err)
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+func (t *Table) columnNames() []string {
+	names := make([]string, 0, len(t.Columns))
+	for key := range t.Columns {
+		names = append(names, key)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func translateType(field collection.Field) string {
+	switch field.Type {
+	case collection.Bool:
+		return "Bool"
+	case collection.UInt8:
+		return "UInt8"
+	case collection.UInt16:
+		return "UInt16"
+	case collection.UInt32:
+		return "UInt32"
+	case collection.UInt64:
+		return "UInt64"
+	case collection.Int8:
+		return "Int8"
+	case collection.Int16:
+		return "Int16"
+	case collection.Int32:
+		return "Int32"
+	case collection.Int64:
+		return "Int64"
+	case collection.Float32:
+		return "Float32"
+	case collection.Float64:
+		return "Float64"
+	case collection.DateTime:
+		return "DateTime64(9, 'UTC')"
+	case collection.String:
+		if field.Length > 0 {
+			return fmt.Sprintf("FixedString(%d)", field.Length)
+		}
+		return "String"
+	default:
+		return "String"
+	}
+}
@@ -0,0 +1,67 @@
+package compression
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/khezen/bulklog/pkg/zstd"
+)
+
+// Compression - Content-Encoding of the requests an output sends
+type Compression string
+
+const (
+	// None - requests are sent as is
+	None Compression = "none"
+	// Gzip - gzip compression, which most HTTP endpoints accept
+	Gzip Compression = "gzip"
+	// Zstd - zstandard compression, usually smaller than gzip but accepted by fewer endpoints
+	Zstd Compression = "zstd"
+)
+
+// ErrUnknownCompression -
+var ErrUnknownCompression = errors.New("ErrUnknownCompression - compression must be one of none|gzip|zstd")
+
+// Validate reports unknown compression codecs
+func (c Compression) Validate() error {
+	switch c {
+	case "", None, Gzip, Zstd:
+		return nil
+	default:
+		return ErrUnknownCompression
+	}
+}
+
+// Encode returns body compressed, as is if compression is none
+func (c Compression) Encode(body []byte) ([]byte, error) {
+	switch c {
+	case Gzip:
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		_, err := gz.Write(body)
+		if err == nil {
+			err = gz.Close()
+		}
+		if err != nil {
+			return nil, fmt.Errorf("gzip.Write.%s", err)
+		}
+		return buf.Bytes(), nil
+	case Zstd:
+		return zstd.Encode(body), nil
+	case "", None:
+		return body, nil
+	default:
+		return nil, ErrUnknownCompression
+	}
+}
+
+// SetHeader sets the Content-Encoding of a request whose body was encoded
+func (c Compression) SetHeader(req *http.Request) {
+	switch c {
+	case Gzip, Zstd:
+		req.Header.Set("Content-Encoding", string(c))
+	}
+}
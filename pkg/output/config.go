@@ -1,10 +1,151 @@
 package output
 
-import "github.com/khezen/bulklog/pkg/output/elastic"
+import (
+	"fmt"
+	"sort"
+
+	"github.com/khezen/bulklog/pkg/collection"
+	"github.com/khezen/bulklog/pkg/output/azureblob"
+	"github.com/khezen/bulklog/pkg/output/bigquery"
+	"github.com/khezen/bulklog/pkg/output/clickhouse"
+	"github.com/khezen/bulklog/pkg/output/datadog"
+	"github.com/khezen/bulklog/pkg/output/elastic"
+	"github.com/khezen/bulklog/pkg/output/gcs"
+	"github.com/khezen/bulklog/pkg/output/kafka"
+	"github.com/khezen/bulklog/pkg/output/loki"
+	"github.com/khezen/bulklog/pkg/output/opensearch"
+	"github.com/khezen/bulklog/pkg/output/otlp"
+	"github.com/khezen/bulklog/pkg/output/plugin"
+	"github.com/khezen/bulklog/pkg/output/postgres"
+	"github.com/khezen/bulklog/pkg/output/pubsub"
+	"github.com/khezen/bulklog/pkg/output/pulsar"
+	"github.com/khezen/bulklog/pkg/output/s3"
+	"github.com/khezen/bulklog/pkg/output/splunk"
+	"github.com/khezen/bulklog/pkg/output/syslog"
+	"github.com/khezen/bulklog/pkg/output/webhook"
+)
 
 // Config -
 type Config struct {
-	Elastic *elastic.Config `yaml:"elasticsearch,omitempty"`
+	Elastic    *elastic.Config           `yaml:"elasticsearch,omitempty"`
+	OpenSearch *opensearch.Config        `yaml:"opensearch,omitempty"`
+	Loki       *loki.Config              `yaml:"loki,omitempty"`
+	S3         *s3.Config                `yaml:"s3,omitempty"`
+	AzureBlob  *azureblob.Config         `yaml:"azure_blob,omitempty"`
+	GCS        *gcs.Config               `yaml:"gcs,omitempty"`
+	Kafka      *kafka.Config             `yaml:"kafka,omitempty"`
+	Pulsar     *pulsar.Config            `yaml:"pulsar,omitempty"`
+	PubSub     *pubsub.Config            `yaml:"pubsub,omitempty"`
+	Splunk     *splunk.Config            `yaml:"splunk,omitempty"`
+	Datadog    *datadog.Config           `yaml:"datadog,omitempty"`
+	ClickHouse *clickhouse.Config        `yaml:"clickhouse,omitempty"`
+	BigQuery   *bigquery.Config          `yaml:"bigquery,omitempty"`
+	Postgres   *postgres.Config          `yaml:"postgres,omitempty"`
+	Syslog     *syslog.Config            `yaml:"syslog,omitempty"`
+	OTLP       *otlp.Config              `yaml:"otlp,omitempty"`
+	Webhooks   map[string]webhook.Config `yaml:"webhooks,omitempty"`
+	// Plugins - outputs run as subprocesses, by name
+	Plugins map[string]plugin.Config `yaml:"plugins,omitempty"`
+	// CircuitBreaker guards every output
+	CircuitBreaker BreakerConfig `yaml:"circuit_breaker,omitempty"`
+	// Pool bounds concurrent tries of every output
+	Pool PoolConfig `yaml:"pool,omitempty"`
+	// Batch bounds the batches sent at once to outputs
+	Batch BatchConfig `yaml:"batch,omitempty"`
+	// DryRun - outputs whose requests are built but not sent to their destination
+	DryRun DryRunConfig `yaml:"dry_run,omitempty"`
+	// unknown output types found while unmarshaling
+	unknown []string
+}
+
+// types of outputs which can be configured
+var types = []string{"elasticsearch", "opensearch", "loki", "s3", "azure_blob", "gcs", "kafka", "pulsar", "pubsub", "splunk", "datadog", "clickhouse", "bigquery", "postgres", "syslog", "otlp", "webhooks", "plugins"}
+
+// UnmarshalYAML records output types which are not supported so validation can report them
+func (c *Config) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type plain Config
+	err := unmarshal((*plain)(c))
+	if err != nil {
+		return err
+	}
+	var sections map[string]interface{}
+	err = unmarshal(&sections)
+	if err != nil {
+		return err
+	}
+	c.unknown = nil
+	for name := range sections {
+		if !isType(name) && name != "circuit_breaker" && name != "pool" && name != "batch" && name != "dry_run" {
+			c.unknown = append(c.unknown, name)
+		}
+	}
+	sort.Strings(c.unknown)
+	return nil
+}
+
+// Unknown - output types of the config file which are not supported
+func (c *Config) Unknown() []string {
+	return c.unknown
+}
+
+// Collections returns, by field path, collections which outputs have specific settings for
+func (c *Config) Collections() map[string][]collection.Name {
+	refs := make(map[string][]collection.Name)
+	add := func(path string, names []collection.Name) {
+		if len(names) > 0 {
+			sort.Slice(names, func(i, j int) bool { return names[i] < names[j] })
+			refs[path] = names
+		}
+	}
+	if c.Elastic != nil {
+		add("elasticsearch.indices", keys(c.Elastic.Indices))
+	}
+	if c.OpenSearch != nil {
+		add("opensearch.indices", keys(c.OpenSearch.Indices))
+	}
+	if c.Pulsar != nil {
+		add("pulsar.topics", keys(c.Pulsar.Topics))
+	}
+	if c.PubSub != nil {
+		add("pubsub.topics", keys(c.PubSub.Topics))
+	}
+	if c.ClickHouse != nil {
+		add("clickhouse.tables", keys(c.ClickHouse.Tables))
+	}
+	if c.BigQuery != nil {
+		add("bigquery.tables", keys(c.BigQuery.Tables))
+	}
+	if c.Postgres != nil {
+		add("postgres.tables", keys(c.Postgres.Tables))
+		add("postgres.indexes", keys(c.Postgres.Indexes))
+	}
+	if c.OTLP != nil {
+		add("otlp.collections", keys(c.OTLP.Collections))
+	}
+	if c.Splunk != nil {
+		add("splunk.collections", keys(c.Splunk.Collections))
+	}
+	if c.Datadog != nil {
+		add("datadog.collections", keys(c.Datadog.Collections))
+	}
+	return refs
+}
+
+func keys[V any](m map[collection.Name]V) []collection.Name {
+	names := make([]collection.Name, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	return names
+}
+
+func isType(name string) bool {
+	for _, t := range types {
+		if t == name {
+			return true
+		}
+	}
+	return false
 }
 
 // NewOutputs -
@@ -14,5 +155,137 @@ func NewOutputs(cfg *Config) (map[string]Interface, error) {
 		elasticsearch := elastic.New(*cfg.Elastic)
 		outputs["elasticsearch"] = elasticsearch
 	}
+	if cfg.OpenSearch != nil {
+		outputs["opensearch"] = opensearch.New(*cfg.OpenSearch)
+	}
+	if cfg.Loki != nil {
+		outputs["loki"] = loki.New(*cfg.Loki)
+	}
+	if cfg.S3 != nil {
+		outputs["s3"] = s3.New(*cfg.S3)
+	}
+	if cfg.AzureBlob != nil {
+		azureBlob, err := azureblob.New(*cfg.AzureBlob)
+		if err != nil {
+			return nil, fmt.Errorf("azureblob.New.%s", err)
+		}
+		outputs["azure_blob"] = azureBlob
+	}
+	if cfg.GCS != nil {
+		gcsOutput, err := gcs.New(*cfg.GCS)
+		if err != nil {
+			return nil, fmt.Errorf("gcs.New.%s", err)
+		}
+		outputs["gcs"] = gcsOutput
+	}
+	if cfg.Kafka != nil {
+		kafkaOutput, err := kafka.New(*cfg.Kafka)
+		if err != nil {
+			return nil, fmt.Errorf("kafka.New.%s", err)
+		}
+		outputs["kafka"] = kafkaOutput
+	}
+	if cfg.Pulsar != nil {
+		pulsarOutput, err := pulsar.New(*cfg.Pulsar)
+		if err != nil {
+			return nil, fmt.Errorf("pulsar.New.%s", err)
+		}
+		outputs["pulsar"] = pulsarOutput
+	}
+	if cfg.PubSub != nil {
+		pubSub, err := pubsub.New(*cfg.PubSub)
+		if err != nil {
+			return nil, fmt.Errorf("pubsub.New.%s", err)
+		}
+		outputs["pubsub"] = pubSub
+	}
+	if cfg.Splunk != nil {
+		outputs["splunk"] = splunk.New(*cfg.Splunk)
+	}
+	if cfg.Datadog != nil {
+		datadogOutput, err := datadog.New(*cfg.Datadog)
+		if err != nil {
+			return nil, fmt.Errorf("datadog.New.%s", err)
+		}
+		outputs["datadog"] = datadogOutput
+	}
+	if cfg.ClickHouse != nil {
+		outputs["clickhouse"] = clickhouse.New(*cfg.ClickHouse)
+	}
+	if cfg.BigQuery != nil {
+		bigQuery, err := bigquery.New(*cfg.BigQuery)
+		if err != nil {
+			return nil, fmt.Errorf("bigquery.New.%s", err)
+		}
+		outputs["bigquery"] = bigQuery
+	}
+	if cfg.Postgres != nil {
+		postgresOutput, err := postgres.New(*cfg.Postgres)
+		if err != nil {
+			return nil, fmt.Errorf("postgres.New.%s", err)
+		}
+		outputs["postgres"] = postgresOutput
+	}
+	if cfg.Syslog != nil {
+		syslogOutput, err := syslog.New(*cfg.Syslog)
+		if err != nil {
+			return nil, fmt.Errorf("syslog.New.%s", err)
+		}
+		outputs["syslog"] = syslogOutput
+	}
+	if cfg.OTLP != nil {
+		otlpOutput, err := otlp.New(*cfg.OTLP)
+		if err != nil {
+			return nil, fmt.Errorf("otlp.New.%s", err)
+		}
+		outputs["otlp"] = otlpOutput
+	}
+	for name, webhookCfg := range cfg.Webhooks {
+		webhookOutput, err := webhook.New(webhookCfg)
+		if err != nil {
+			return nil, fmt.Errorf("webhook.New(%s).%s", name, err)
+		}
+		outputs[fmt.Sprintf("webhook.%s", name)] = webhookOutput
+	}
+	for name, pluginCfg := range cfg.Plugins {
+		pluginOutput, err := plugin.New(pluginCfg)
+		if err != nil {
+			return nil, fmt.Errorf("plugin.New(%s).%s", name, err)
+		}
+		outputs[fmt.Sprintf("plugin.%s", name)] = pluginOutput
+	}
+	// dry runs fail as their output would, breakers and pools guard them the same way
+	for name, dryRun := range cfg.DryRun.Outputs {
+		out, ok := outputs[name]
+		if !ok {
+			continue
+		}
+		mirror, err := dryRun.MirrorURL()
+		if err != nil {
+			return nil, fmt.Errorf("MirrorURL(%s).%s", name, err)
+		}
+		outputs[name] = NewDryRun(out, mirror)
+	}
+	if cfg.CircuitBreaker.Enabled() {
+		coolDown, err := cfg.CircuitBreaker.CoolDown()
+		if err != nil {
+			return nil, fmt.Errorf("CoolDown.%s", err)
+		}
+		for name, out := range outputs {
+			outputs[name] = NewBreaker(out, cfg.CircuitBreaker.Failures, coolDown)
+		}
+	}
+	// each sub-batch is a try of the breaker
+	for name, out := range outputs {
+		if limits := cfg.Batch.Limits(name); limits.Enabled() {
+			outputs[name] = NewSplitter(out, limits)
+		}
+	}
+	// tries are queued outside of the breaker, so queue timeouts do not open it
+	if cfg.Pool.Enabled() {
+		for name, out := range outputs {
+			outputs[name] = NewPool(out, cfg.Pool.Workers, cfg.Pool.Queue)
+		}
+	}
 	return outputs, nil
 }
@@ -0,0 +1,152 @@
+package datadog
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/khezen/bulklog/pkg/collection"
+	"github.com/khezen/bulklog/pkg/output/dryrun"
+	"github.com/khezen/bulklog/pkg/output/retry"
+)
+
+const defaultSite = "datadoghq.com"
+
+var (
+	// ErrUnsupportedCompression -
+	ErrUnsupportedCompression = errors.New("ErrUnsupportedCompression - datadog compression must be one of none|gzip")
+)
+
+// Datadog sends documents to the datadog logs intake API
+type Datadog struct {
+	apiKey       string
+	logsEndpoint string
+	validateURL  string
+	gzip         bool
+	hostname     string
+	tags         []string
+	collections  map[collection.Name]LogConfig
+	httpcli      http.Client
+}
+
+// New returns datadog as an output
+func New(cfg Config) (*Datadog, error) {
+	if cfg.Site == "" {
+		cfg.Site = defaultSite
+	}
+	if cfg.Endpoint == "" {
+		cfg.Endpoint = fmt.Sprintf("http-intake.logs.%s", cfg.Site)
+	}
+	if cfg.Scheme == "" {
+		cfg.Scheme = "https"
+	}
+	var compress bool
+	switch cfg.Compression {
+	case "gzip", "":
+		compress = true
+	case "none":
+		compress = false
+	default:
+		return nil, ErrUnsupportedCompression
+	}
+	if cfg.Hostname == "" {
+		cfg.Hostname, _ = os.Hostname()
+	}
+	return &Datadog{
+		cfg.APIKey,
+		fmt.Sprintf("%s://%s/api/v2/logs", cfg.Scheme, cfg.Endpoint),
+		fmt.Sprintf("https://api.%s/api/v1/validate", cfg.Site),
+		compress,
+		cfg.Hostname,
+		cfg.Tags,
+		cfg.Collections,
+		http.Client{
+			Transport: dryrun.Transport(&http.Transport{
+				MaxIdleConns:    10,
+				IdleConnTimeout: 30 * time.Second,
+			}),
+		},
+	}, nil
+}
+
+// Ping validates the API key
+func (c *Datadog) Ping(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", c.validateURL, nil)
+	if err != nil {
+		return fmt.Errorf("http.NewRequest.%s", err)
+	}
+	req.Header.Set("DD-API-KEY", c.apiKey)
+	res, err := c.httpcli.Do(req)
+	if err != nil {
+		return fmt.Errorf("httpClient.Do.%s", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("datadog: %s", res.Status)
+	}
+	return nil
+}
+
+// Digest sends documents in as few requests as the intake limits allow
+func (c *Datadog) Digest(ctx context.Context, documents []collection.Document) error {
+	payloads, err := RenderLogs(documents, c.hostname, c.tags, c.collections)
+	if err != nil {
+		return fmt.Errorf("RenderLogs.%s", err)
+	}
+	for _, payload := range payloads {
+		err = c.send(ctx, payload)
+		if err != nil {
+			return fmt.Errorf("send.%s", err)
+		}
+	}
+	return nil
+}
+
+func (c *Datadog) send(ctx context.Context, payload []byte) error {
+	body := payload
+	if c.gzip {
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		_, err := gz.Write(payload)
+		if err == nil {
+			err = gz.Close()
+		}
+		if err != nil {
+			return fmt.Errorf("gzip.Write.%s", err)
+		}
+		body = buf.Bytes()
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", c.logsEndpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("http.NewRequest.%s", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.gzip {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	req.Header.Set("DD-API-KEY", c.apiKey)
+	res, err := c.httpcli.Do(req)
+	if err != nil {
+		return fmt.Errorf("httpClient.Do.%s", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode >= 300 {
+		resBody, err := ioutil.ReadAll(res.Body)
+		if err != nil {
+			return fmt.Errorf("ioutil.ReadAll.%s", err)
+		}
+		return retry.FromResponse(res, fmt.Errorf("datadog: %s : %s", res.Status, resBody))
+	}
+	return nil
+}
+
+// Ensure - datadog has nothing to create
+func (c *Datadog) Ensure(ctx context.Context, collection *collection.Collection) error {
+	return nil
+}
@@ -0,0 +1,28 @@
+package datadog
+
+import "github.com/khezen/bulklog/pkg/collection"
+
+// Config -
+type Config struct {
+	Enabled bool `yaml:"enabled"`
+	// Site - datadog site, such as datadoghq.eu, datadoghq.com by default
+	Site string `yaml:"site"`
+	// Endpoint - logs intake host, overriding the one of the site, such as a proxy
+	Endpoint string `yaml:"endpoint"`
+	Scheme   string `yaml:"scheme"`
+	APIKey   string `yaml:"api_key"`
+	// Compression - none|gzip, gzip by default
+	Compression string `yaml:"compression"`
+	// Hostname - hostname of logs, the one of the instance by default
+	Hostname string `yaml:"hostname"`
+	// Tags - tags of every log, such as env:prod
+	Tags        []string                      `yaml:"tags"`
+	Collections map[collection.Name]LogConfig `yaml:"collections"`
+}
+
+// LogConfig - reserved attributes of the logs of a collection
+type LogConfig struct {
+	Source  string   `yaml:"source"`
+	Service string   `yaml:"service"`
+	Tags    []string `yaml:"tags"`
+}
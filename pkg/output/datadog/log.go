@@ -0,0 +1,90 @@
+package datadog
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/khezen/bulklog/pkg/collection"
+)
+
+const (
+	// maxEntries - logs of a request
+	maxEntries = 1000
+	// maxPayloadBytes - uncompressed size of a request
+	maxPayloadBytes = 5 * 1024 * 1024
+)
+
+// RenderLogs renders documents as datadog logs, in JSON arrays within the limits of the intake API.
+// Document fields are log attributes; reserved attributes the document does not set are derived from its collection and schema.
+// ref: https://docs.datadoghq.com/api/latest/logs/#send-logs
+func RenderLogs(documents []collection.Document, hostname string, tags []string, collections map[collection.Name]LogConfig) ([][]byte, error) {
+	var (
+		payloads = make([][]byte, 0)
+		payload  = []byte{'['}
+		entries  int
+	)
+	for _, doc := range documents {
+		entry, err := renderLog(doc, hostname, tags, collections[doc.CollectionName])
+		if err != nil {
+			return nil, fmt.Errorf("renderLog.%s", err)
+		}
+		if entries == maxEntries || (entries > 0 && len(payload)+len(entry)+1 > maxPayloadBytes) {
+			payloads = append(payloads, append(payload, ']'))
+			payload, entries = []byte{'['}, 0
+		}
+		if entries > 0 {
+			payload = append(payload, ',')
+		}
+		payload = append(payload, entry...)
+		entries++
+	}
+	if entries > 0 {
+		payloads = append(payloads, append(payload, ']'))
+	}
+	return payloads, nil
+}
+
+func renderLog(doc collection.Document, hostname string, tags []string, logCfg LogConfig) ([]byte, error) {
+	attributes := make(map[string]json.RawMessage)
+	if json.Unmarshal(doc.Body, &attributes) != nil {
+		// documents which are not objects are the message of their log
+		attributes = map[string]json.RawMessage{"message": json.RawMessage(doc.Body)}
+	}
+	source := logCfg.Source
+	if source == "" {
+		source = string(doc.CollectionName)
+	}
+	service := logCfg.Service
+	if service == "" {
+		service = string(doc.SchemaName)
+	}
+	allTags := make([]string, 0, len(tags)+len(logCfg.Tags)+2)
+	allTags = append(allTags, tags...)
+	allTags = append(allTags, logCfg.Tags...)
+	allTags = append(allTags, fmt.Sprintf("collection:%s", doc.CollectionName), fmt.Sprintf("schema:%s", doc.SchemaName))
+	reserved := map[string]interface{}{
+		"ddsource":  source,
+		"service":   service,
+		"hostname":  hostname,
+		"ddtags":    strings.Join(allTags, ","),
+		"timestamp": doc.PostedAt.UnixNano() / 1e6,
+	}
+	for key, value := range reserved {
+		if _, ok := attributes[key]; ok {
+			continue
+		}
+		if key == "timestamp" {
+			// the date of documents setting it prevails
+			if _, ok := attributes["date"]; ok {
+				continue
+			}
+		}
+		raw, err := json.Marshal(value)
+		if err != nil {
+			return nil, fmt.Errorf("json.Marshal.%s", err)
+		}
+		attributes[key] = raw
+	}
+	return json.Marshal(attributes)
+}
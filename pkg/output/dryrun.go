@@ -0,0 +1,170 @@
+package output
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+	"sync/atomic"
+
+	"github.com/khezen/bulklog/pkg/collection"
+	"github.com/khezen/bulklog/pkg/output/dryrun"
+	"github.com/khezen/bulklog/pkg/output/otlp"
+)
+
+var (
+	// ErrDryRunUnsupported - the output is not configured, or does not send HTTP requests
+	ErrDryRunUnsupported = errors.New("ErrDryRunUnsupported - dry_run requires a configured output sending HTTP requests")
+	// ErrWrongMirror - mirror is not an absolute http(s) URL
+	ErrWrongMirror = errors.New("ErrWrongMirror - dry_run mirror must be an absolute http or https URL")
+)
+
+// DryRunConfig - outputs which build their requests without sending them to their destination
+type DryRunConfig struct {
+	// Outputs - dry runs by output name, e.g. elasticsearch or webhook.alerts
+	Outputs map[string]DryRunOutput `yaml:"outputs"`
+}
+
+// DryRunOutput - requests are dropped unless a mirror is set
+type DryRunOutput struct {
+	// Mirror - scheme and host requests are sent to instead, such as a staging cluster; paths are kept as is
+	Mirror string `yaml:"mirror"`
+}
+
+// MirrorURL - nil unless a mirror is set
+func (c DryRunOutput) MirrorURL() (*url.URL, error) {
+	if c.Mirror == "" {
+		return nil, nil
+	}
+	mirror, err := url.Parse(c.Mirror)
+	if err != nil || (mirror.Scheme != "http" && mirror.Scheme != "https") || mirror.Host == "" {
+		return nil, ErrWrongMirror
+	}
+	return mirror, nil
+}
+
+// ValidateDryRun reports dry runs of outputs which are not configured or do not support them
+func (c *Config) ValidateDryRun(outputName string, dryRun DryRunOutput) error {
+	if !c.supportsDryRun(outputName) {
+		return ErrDryRunUnsupported
+	}
+	_, err := dryRun.MirrorURL()
+	return err
+}
+
+// supportsDryRun tells whether the output is configured and sends its documents over HTTP
+func (c *Config) supportsDryRun(outputName string) bool {
+	switch {
+	case outputName == "elasticsearch":
+		return c.Elastic != nil
+	case outputName == "opensearch":
+		return c.OpenSearch != nil
+	case outputName == "loki":
+		return c.Loki != nil
+	case outputName == "s3":
+		return c.S3 != nil
+	case outputName == "azure_blob":
+		return c.AzureBlob != nil
+	case outputName == "gcs":
+		return c.GCS != nil
+	case outputName == "pubsub":
+		return c.PubSub != nil
+	case outputName == "splunk":
+		return c.Splunk != nil
+	case outputName == "datadog":
+		return c.Datadog != nil
+	case outputName == "clickhouse":
+		return c.ClickHouse != nil
+	case outputName == "bigquery":
+		return c.BigQuery != nil
+	case outputName == "otlp":
+		return c.OTLP != nil && c.OTLP.Protocol != otlp.ProtocolGRPC
+	case strings.HasPrefix(outputName, "webhook."):
+		_, ok := c.Webhooks[strings.TrimPrefix(outputName, "webhook.")]
+		return ok
+	}
+	return false
+}
+
+// DryRunState - what a dry run output would have sent
+type DryRunState struct {
+	Digests   int64 `json:"digests"`
+	Documents int64 `json:"documents"`
+	// Requests - requests with a payload, and their payload bytes
+	Requests int64  `json:"requests"`
+	Bytes    int64  `json:"bytes"`
+	Mirror   string `json:"mirror,omitempty"`
+}
+
+// DryRun serializes documents and builds the requests of an output as it usually does,
+// then drops them, answering them as if they succeeded, or sends them to a mirror.
+type DryRun struct {
+	Interface
+	recorder  *dryrun.Recorder
+	digests   atomic.Int64
+	documents atomic.Int64
+}
+
+// NewDryRun records the requests of out, mirror receives them unless it is nil
+func NewDryRun(out Interface, mirror *url.URL) *DryRun {
+	return &DryRun{
+		Interface: out,
+		recorder:  dryrun.NewRecorder(mirror),
+	}
+}
+
+// Digest digests documents without their requests reaching the destination of the output
+func (d *DryRun) Digest(ctx context.Context, documents []collection.Document) error {
+	d.digests.Add(1)
+	d.documents.Add(int64(len(documents)))
+	return d.Interface.Digest(dryrun.WithRecorder(ctx, d.recorder), documents)
+}
+
+// Ensure builds the requests which set destinations up, such as index templates, the same way
+func (d *DryRun) Ensure(ctx context.Context, collec *collection.Collection) error {
+	return d.Interface.Ensure(dryrun.WithRecorder(ctx, d.recorder), collec)
+}
+
+// Ping pings the mirror, always succeeds without one
+func (d *DryRun) Ping(ctx context.Context) error {
+	pinger, ok := Unwrap(d.Interface).(Pinger)
+	if !ok {
+		return nil
+	}
+	return pinger.Ping(dryrun.WithRecorder(ctx, d.recorder))
+}
+
+func (d *DryRun) unwrap() Interface {
+	return d.Interface
+}
+
+// State reports what was digested so far
+func (d *DryRun) State() DryRunState {
+	state := DryRunState{
+		Digests:   d.digests.Load(),
+		Documents: d.documents.Load(),
+		Requests:  d.recorder.Requests(),
+		Bytes:     d.recorder.Bytes(),
+	}
+	if mirror := d.recorder.Mirror(); mirror != nil {
+		state.Mirror = mirror.String()
+	}
+	return state
+}
+
+// AsPinger returns the pinger of out through its guards, the dry run guarding it if any so that it does not reach its destination
+func AsPinger(out Interface) (Pinger, bool) {
+	if _, ok := Unwrap(out).(Pinger); !ok {
+		return nil, false
+	}
+	for {
+		if dryRun, ok := out.(*DryRun); ok {
+			return dryRun, true
+		}
+		wrapped, ok := out.(wrapper)
+		if !ok {
+			return out.(Pinger), true
+		}
+		out = wrapped.unwrap()
+	}
+}
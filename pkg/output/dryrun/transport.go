@@ -0,0 +1,117 @@
+package dryrun
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+)
+
+// Recorder counts the requests an output built in dry run, and sends them to its mirror if it has one
+type Recorder struct {
+	mirror   *url.URL
+	requests atomic.Int64
+	bytes    atomic.Int64
+}
+
+// NewRecorder - requests are dropped unless mirror is set
+func NewRecorder(mirror *url.URL) *Recorder {
+	return &Recorder{mirror: mirror}
+}
+
+// Requests - requests with a payload built so far
+func (r *Recorder) Requests() int64 {
+	return r.requests.Load()
+}
+
+// Bytes - payload bytes of the requests built so far, compressed if the output compresses them
+func (r *Recorder) Bytes() int64 {
+	return r.bytes.Load()
+}
+
+// Mirror - base URL requests are sent to, nil if they are dropped
+func (r *Recorder) Mirror() *url.URL {
+	return r.mirror
+}
+
+// grpcContentType - content type of gRPC calls, see package grpc
+const grpcContentType = "application/grpc"
+
+type recorderContext struct{}
+
+// WithRecorder returns a copy of ctx whose requests are recorded by r instead of being sent to their destination
+func WithRecorder(ctx context.Context, r *Recorder) context.Context {
+	return context.WithValue(ctx, recorderContext{}, r)
+}
+
+// transport sends the requests of contexts without recorder through base
+type transport struct {
+	base http.RoundTripper
+}
+
+// Transport returns base honoring the recorders of request contexts, http.DefaultTransport if base is nil
+func Transport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &transport{base}
+}
+
+// RoundTrip answers requests of dry runs with an empty JSON object, or an OK status for gRPC calls, unless they have a mirror
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	r, ok := req.Context().Value(recorderContext{}).(*Recorder)
+	if !ok {
+		return t.base.RoundTrip(req)
+	}
+	if req.Body != nil && req.Body != http.NoBody {
+		size := req.ContentLength
+		if size < 0 {
+			body, err := io.ReadAll(req.Body)
+			req.Body.Close()
+			if err != nil {
+				return nil, err
+			}
+			size = int64(len(body))
+			req = req.Clone(req.Context())
+			req.Body = io.NopCloser(strings.NewReader(string(body)))
+			req.ContentLength = size
+		}
+		r.requests.Add(1)
+		r.bytes.Add(size)
+	}
+	if r.mirror != nil {
+		mirrored := req.Clone(req.Context())
+		mirrored.URL.Scheme = r.mirror.Scheme
+		mirrored.URL.Host = r.mirror.Host
+		mirrored.Host = r.mirror.Host
+		return t.base.RoundTrip(mirrored)
+	}
+	if req.Body != nil {
+		req.Body.Close()
+	}
+	if strings.HasPrefix(req.Header.Get("Content-Type"), grpcContentType) {
+		// trailers-only response, the call succeeded without a response message
+		return &http.Response{
+			Status:     "200 OK",
+			StatusCode: http.StatusOK,
+			Proto:      "HTTP/2.0",
+			ProtoMajor: 2,
+			Header:     http.Header{"Content-Type": []string{grpcContentType}, "Grpc-Status": []string{"0"}},
+			Body:       http.NoBody,
+			Request:    req,
+		}, nil
+	}
+	return &http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": []string{"application/json"}},
+		Body:          io.NopCloser(strings.NewReader("{}")),
+		ContentLength: 2,
+		Request:       req,
+	}, nil
+}
@@ -0,0 +1,63 @@
+package elastic
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/khezen/bulklog/pkg/output/partial"
+)
+
+// BulkResponse - elasticsearch _bulk API response
+// ref: https://www.elastic.co/guide/en/elasticsearch/reference/current/docs-bulk.html#bulk-api-response-body
+type BulkResponse struct {
+	Took   int                   `json:"took"`
+	Errors bool                  `json:"errors"`
+	Items  []map[string]BulkItem `json:"items"`
+}
+
+// BulkItem - result of a single bulk action
+type BulkItem struct {
+	Index  string     `json:"_index"`
+	ID     string     `json:"_id"`
+	Status int        `json:"status"`
+	Error  *BulkError `json:"error,omitempty"`
+}
+
+// BulkError - reason of a bulk item failure
+type BulkError struct {
+	Type   string `json:"type"`
+	Reason string `json:"reason"`
+}
+
+// parseBulkResponse returns a *partial.Error reporting rejected items, if any.
+// Items are in the order of the bulk actions, one per document.
+// Items rejected with a 4xx status other than 429 Too Many Requests are rejected for good,
+// but creations conflicting with a document already indexed are not failures: a previous try created it.
+func parseBulkResponse(body []byte) error {
+	var res BulkResponse
+	err := json.Unmarshal(body, &res)
+	if err != nil {
+		return fmt.Errorf("json.Unmarshal.%s", err)
+	}
+	if !res.Errors {
+		return nil
+	}
+	partialErr := &partial.Error{Total: len(res.Items)}
+	for i, actions := range res.Items {
+		for action, item := range actions {
+			if item.Error == nil || (action == string(OpCreate) && item.Status == http.StatusConflict) {
+				continue
+			}
+			partialErr.Failures = append(partialErr.Failures, partial.Failure{
+				Index:     i,
+				Permanent: item.Status >= 400 && item.Status < 500 && item.Status != http.StatusTooManyRequests,
+				Reason:    fmt.Sprintf("elasticsearch: %d %s: %s", item.Status, item.Error.Type, item.Error.Reason),
+			})
+		}
+	}
+	if len(partialErr.Failures) == 0 {
+		return nil
+	}
+	return partialErr
+}
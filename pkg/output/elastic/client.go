@@ -2,15 +2,21 @@ package elastic
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/khezen/bulklog/pkg/auth"
 	"github.com/khezen/bulklog/pkg/collection"
+	"github.com/khezen/bulklog/pkg/output/compression"
+	"github.com/khezen/bulklog/pkg/output/dryrun"
+	"github.com/khezen/bulklog/pkg/output/partial"
+	"github.com/khezen/bulklog/pkg/output/retry"
 )
 
 var (
@@ -22,17 +28,22 @@ var (
 type Elastic struct {
 	signer                         auth.Signer
 	indeSettings                   IndexSettings
+	index                          IndexTemplate
+	indices                        map[collection.Name]IndexTemplate
 	bulkEndpoint, templateEndpoint string
 	httpcli                        http.Client
+	pingEndpoint                   string
+	templateAPI                    TemplateAPI
+	dynamic                        Dynamic
+	dataStream                     bool
+	ilm                            *ILMConfig
+	compression                    compression.Compression
+	id                             IDTemplate
+	opType                         OpType
 }
 
 // New returns a elasticsearch as a output
 func New(cfg Config) *Elastic {
-	if cfg.Scheme == "" {
-		cfg.Scheme = "http"
-	}
-	bulkEndpoint := fmt.Sprintf("%s://%s/_bulk", cfg.Scheme, cfg.Endpoint)
-	createTemplateEndpoint := fmt.Sprintf("%s://%s/_template", cfg.Scheme, cfg.Endpoint)
 	var signer auth.Signer
 	switch {
 	case cfg.AWSAuth != nil:
@@ -42,42 +53,77 @@ func New(cfg Config) *Elastic {
 		signer = auth.NewBasicSigner(*cfg.BasicAuth)
 		break
 	}
+	return NewSigned(cfg, signer)
+}
+
+// NewSigned returns a elasticsearch as a output, its requests are signed by signer if not nil
+func NewSigned(cfg Config, signer auth.Signer) *Elastic {
+	if cfg.Scheme == "" {
+		cfg.Scheme = "http"
+	}
+	bulkEndpoint := fmt.Sprintf("%s://%s/_bulk", cfg.Scheme, cfg.Endpoint)
+	createTemplateEndpoint := fmt.Sprintf("%s://%s/_template", cfg.Scheme, cfg.Endpoint)
 	if cfg.Shards <= 0 {
 		cfg.Shards = 1
 	}
+	if cfg.Index == "" {
+		cfg.Index = defaultIndexTemplate
+		if cfg.DataStream {
+			cfg.Index = defaultDataStreamTemplate
+		}
+	}
+	settings := IndexSettings{
+		NumberOfShards: cfg.Shards,
+	}
+	if cfg.ILM != nil {
+		settings.LifecycleName = cfg.ILM.PolicyName()
+	}
 	return &Elastic{
 		signer,
-		IndexSettings{
-			NumberOfShards: cfg.Shards,
-		},
+		settings,
+		cfg.Index,
+		cfg.Indices,
 		bulkEndpoint,
 		createTemplateEndpoint,
 		http.Client{
-			Transport: &http.Transport{
+			Transport: dryrun.Transport(&http.Transport{
 				MaxIdleConns:       10,
 				IdleConnTimeout:    30 * time.Second,
 				DisableCompression: true,
-			},
+			}),
 		},
+		fmt.Sprintf("%s://%s/", cfg.Scheme, cfg.Endpoint),
+		cfg.templateAPI(),
+		cfg.Dynamic,
+		cfg.DataStream,
+		cfg.ILM,
+		cfg.Compression,
+		cfg.ID,
+		cfg.opType(),
 	}
 }
 
 // Digest send bulk request to Elasticsearch
-func (c *Elastic) Digest(documents []collection.Document) error {
+func (c *Elastic) Digest(ctx context.Context, documents []collection.Document) error {
 	buf := bytes.NewBuffer([]byte{})
 	for _, doc := range documents {
-		docBytes, err := Digest(doc)
+		docBytes, err := Digest(doc, c.indexTemplate(doc.CollectionName), c.id, c.opType, c.templateAPI, c.dataStream)
 		if err != nil {
 			return fmt.Errorf("Digest.%s", err)
 		}
 		buf.Write(docBytes)
 	}
-	req, err := http.NewRequest("POST", c.bulkEndpoint, buf)
+	body, err := c.compression.Encode(buf.Bytes())
+	if err != nil {
+		return fmt.Errorf("Encode.%s", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", c.bulkEndpoint, bytes.NewReader(body))
 	if err != nil {
 		return fmt.Errorf("http.NewRequest.%s", err)
 	}
 	req.Header.Add("Content-Type", "application/json")
-	err = c.sign(req, buf.Bytes())
+	c.compression.SetHeader(req)
+	err = c.sign(req, body)
 	if err != nil {
 		return fmt.Errorf("Sign.%s", err)
 	}
@@ -85,26 +131,62 @@ func (c *Elastic) Digest(documents []collection.Document) error {
 	if err != nil {
 		return fmt.Errorf("httpClient.Do.%s", err)
 	}
+	defer res.Body.Close()
+	resBody, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return fmt.Errorf("ioutil.ReadAll.%s", err)
+	}
 	if res.StatusCode > 300 {
-		resBody, err := ioutil.ReadAll(res.Body)
+		return retry.FromResponse(res, fmt.Errorf("elasticsearch: %s : %s", res.Status, resBody))
+	}
+	err = parseBulkResponse(resBody)
+	if _, ok := err.(*partial.Error); ok {
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("parseBulkResponse.%s", err)
+	}
+	return nil
+}
+
+// Ensure creates or updates the lifecycle policy, the index template and the data stream of a collection in Elasticsearch,
+// so its indices are mapped after its schemas rather than dynamically
+func (c *Elastic) Ensure(ctx context.Context, collection *collection.Collection) error {
+	if c.ilm != nil {
+		err := c.ensurePolicy(ctx)
+		if err != nil {
+			return fmt.Errorf("ensurePolicy.%s", err)
+		}
+	}
+	if c.templateAPI == ComposableTemplate {
+		err := c.ensureComposableTemplate(ctx, collection)
+		if err != nil {
+			return fmt.Errorf("ensureComposableTemplate.%s", err)
+		}
+	} else {
+		err := c.ensureLegacyTemplate(ctx, collection)
+		if err != nil {
+			return err
+		}
+	}
+	if c.dataStream {
+		err := c.ensureDataStream(ctx, collection)
 		if err != nil {
-			return fmt.Errorf("ioutil.ReadAll.%s", err)
+			return fmt.Errorf("ensureDataStream.%s", err)
 		}
-		return fmt.Errorf("elasticsearch: %s : %b", res.Status, resBody)
 	}
 	return nil
 }
 
-// Ensure creates a template in Elasticsearch
-func (c *Elastic) Ensure(collection *collection.Collection) error {
+func (c *Elastic) ensureLegacyTemplate(ctx context.Context, collection *collection.Collection) error {
 	endpoint := fmt.Sprintf("%s/%s", c.templateEndpoint, collection.Name)
-	elasticIndex := RenderElasticIndex(collection, c.indeSettings)
+	elasticIndex := RenderElasticIndex(collection, c.indeSettings, c.indexTemplate(collection.Name), c.dynamic)
 	elasticIndexBytes, err := json.Marshal(elasticIndex)
 	if err != nil {
 		return fmt.Errorf("json.Marshal.%s", err)
 	}
 	buf := bytes.NewBuffer(elasticIndexBytes)
-	req, err := http.NewRequest("POST", endpoint, buf)
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, buf)
 	if err != nil {
 		return fmt.Errorf("http.NewRequest.%s", err)
 	}
@@ -124,6 +206,104 @@ func (c *Elastic) Ensure(collection *collection.Collection) error {
 	return nil
 }
 
+func (c *Elastic) ensureComposableTemplate(ctx context.Context, collection *collection.Collection) error {
+	elasticIndex, err := RenderComposableIndex(collection, c.indeSettings, c.indexTemplate(collection.Name), c.dynamic, c.dataStream)
+	if err != nil {
+		return fmt.Errorf("RenderComposableIndex.%s", err)
+	}
+	// prefixed not to replace built-in templates, such as logs
+	endpoint := fmt.Sprintf("%s_index_template/bulklog-%s", c.pingEndpoint, collection.Name)
+	_, err = c.put(ctx, endpoint, elasticIndex)
+	return err
+}
+
+func (c *Elastic) ensurePolicy(ctx context.Context) error {
+	policy, err := RenderPolicy(*c.ilm)
+	if err != nil {
+		return fmt.Errorf("RenderPolicy.%s", err)
+	}
+	endpoint := fmt.Sprintf("%s_ilm/policy/%s", c.pingEndpoint, c.ilm.PolicyName())
+	_, err = c.put(ctx, endpoint, policy)
+	return err
+}
+
+// ensureDataStream creates the data stream of a collection, unless its name depends on documents:
+// such data streams are created by elasticsearch on their first document
+func (c *Elastic) ensureDataStream(ctx context.Context, collection *collection.Collection) error {
+	name := c.indexTemplate(collection.Name).Pattern(collection.Name)
+	if strings.Contains(name, "*") {
+		return nil
+	}
+	endpoint := fmt.Sprintf("%s_data_stream/%s", c.pingEndpoint, name)
+	resBody, err := c.put(ctx, endpoint, nil)
+	if err != nil && !bytes.Contains(resBody, []byte("resource_already_exists_exception")) {
+		return err
+	}
+	return nil
+}
+
+// put creates or replaces a resource, failing unless elasticsearch acknowledges it
+func (c *Elastic) put(ctx context.Context, endpoint string, resource interface{}) ([]byte, error) {
+	var body []byte
+	if resource != nil {
+		var err error
+		body, err = json.Marshal(resource)
+		if err != nil {
+			return nil, fmt.Errorf("json.Marshal.%s", err)
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, "PUT", endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("http.NewRequest.%s", err)
+	}
+	req.Header.Add("Content-Type", "application/json")
+	err = c.sign(req, body)
+	if err != nil {
+		return nil, fmt.Errorf("Sign.%s", err)
+	}
+	res, err := c.httpcli.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("httpClient.Do.%s", err)
+	}
+	defer res.Body.Close()
+	resBody, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, fmt.Errorf("ioutil.ReadAll.%s", err)
+	}
+	if res.StatusCode != http.StatusOK {
+		return resBody, fmt.Errorf("elasticsearch: %s : %s", res.Status, resBody)
+	}
+	return resBody, nil
+}
+
+// Ping requests cluster info
+func (c *Elastic) Ping(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", c.pingEndpoint, nil)
+	if err != nil {
+		return fmt.Errorf("http.NewRequest.%s", err)
+	}
+	err = c.sign(req, nil)
+	if err != nil {
+		return fmt.Errorf("Sign.%s", err)
+	}
+	res, err := c.httpcli.Do(req)
+	if err != nil {
+		return fmt.Errorf("httpClient.Do.%s", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("elasticsearch: %s", res.Status)
+	}
+	return nil
+}
+
+func (c *Elastic) indexTemplate(collectionName collection.Name) IndexTemplate {
+	if template, ok := c.indices[collectionName]; ok {
+		return template
+	}
+	return c.index
+}
+
 func (c *Elastic) sign(req *http.Request, body []byte) (err error) {
 	if c.signer != nil {
 		err = c.signer.Sign(req, body)
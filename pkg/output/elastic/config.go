@@ -1,13 +1,177 @@
 package elastic
 
-import "github.com/khezen/bulklog/pkg/auth"
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/khezen/bulklog/pkg/auth"
+	"github.com/khezen/bulklog/pkg/collection"
+	"github.com/khezen/bulklog/pkg/output/compression"
+)
+
+var (
+	// ErrUnknownTemplateAPI - template must be legacy or composable
+	ErrUnknownTemplateAPI = errors.New("ErrUnknownTemplateAPI - template must be legacy|composable")
+	// ErrUnknownDynamic - dynamic must be an elasticsearch dynamic mapping parameter
+	ErrUnknownDynamic = errors.New("ErrUnknownDynamic - dynamic must be true|false|strict|runtime")
+	// ErrLegacyDataStream - data streams are matched by composable templates only
+	ErrLegacyDataStream = errors.New("ErrLegacyDataStream - data_stream requires composable template")
+	// ErrRolloverWithoutDataStream - indices named after dates are not rolled over
+	ErrRolloverWithoutDataStream = errors.New("ErrRolloverWithoutDataStream - ilm rollover requires data_stream")
+	// ErrEmptyPolicy - the lifecycle policy would have no action
+	ErrEmptyPolicy = errors.New("ErrEmptyPolicy - ilm requires rollover or delete_after")
+)
 
 // Config -
 type Config struct {
-	Enabled   bool              `yaml:"enabled"`
-	Endpoint  string            `yaml:"endpoint"`
-	Scheme    string            `yaml:"scheme"`
-	Shards    int               `yaml:"shards"`
-	AWSAuth   *auth.AWSConfig   `yaml:"aws_auth,omitempty"`
-	BasicAuth *auth.BasicConfig `yaml:"basic_auth,omitempty"`
+	Enabled   bool                              `yaml:"enabled"`
+	Endpoint  string                            `yaml:"endpoint"`
+	Scheme    string                            `yaml:"scheme"`
+	Shards    int                               `yaml:"shards"`
+	Index     IndexTemplate                     `yaml:"index"`
+	Indices   map[collection.Name]IndexTemplate `yaml:"indices"`
+	AWSAuth   *auth.AWSConfig                   `yaml:"aws_auth,omitempty"`
+	BasicAuth *auth.BasicConfig                 `yaml:"basic_auth,omitempty"`
+	// Template - API of the index templates created at startup, legacy unless data streams are enabled
+	Template TemplateAPI `yaml:"template"`
+	// Dynamic - how elasticsearch maps fields which are not in collection schemas
+	Dynamic Dynamic `yaml:"dynamic"`
+	// DataStream - documents are appended to data streams rather than indices
+	DataStream bool       `yaml:"data_stream"`
+	ILM        *ILMConfig `yaml:"ilm,omitempty"`
+	// ID - template of the _id of documents, {id} by default so that retried documents replace or skip those already indexed
+	ID IDTemplate `yaml:"id"`
+	// OpType - index|create, the bulk action of documents, index by default and create for data streams
+	OpType OpType `yaml:"op_type"`
+	// Compression - Content-Encoding of bulk requests, none by default
+	Compression compression.Compression `yaml:"compression"`
+}
+
+// TemplateAPI - elasticsearch index template API
+type TemplateAPI string
+
+const (
+	// LegacyTemplate - _template API, mappings are typed by schema
+	LegacyTemplate TemplateAPI = "legacy"
+	// ComposableTemplate - _index_template API of elasticsearch 7.8+, mappings of every schema are merged
+	ComposableTemplate TemplateAPI = "composable"
+)
+
+// Validate reports unknown template APIs
+func (t TemplateAPI) Validate() error {
+	switch t {
+	case "", LegacyTemplate, ComposableTemplate:
+		return nil
+	default:
+		return ErrUnknownTemplateAPI
+	}
+}
+
+// templateAPI - template API in use, composable for data streams unless set
+func (c Config) templateAPI() TemplateAPI {
+	if c.Template == "" {
+		if c.DataStream {
+			return ComposableTemplate
+		}
+		return LegacyTemplate
+	}
+	return c.Template
+}
+
+// opType - bulk action in use, data streams only accept creations
+func (c Config) opType() OpType {
+	if c.OpType == "" {
+		if c.DataStream {
+			return OpCreate
+		}
+		return OpIndex
+	}
+	return c.OpType
+}
+
+// Dynamic - elasticsearch dynamic mapping parameter
+// ref: https://www.elastic.co/guide/en/elasticsearch/reference/current/dynamic.html
+type Dynamic string
+
+// Validate reports unknown dynamic mapping parameters
+func (d Dynamic) Validate() error {
+	switch d {
+	case "", "true", "false", "strict", "runtime":
+		return nil
+	default:
+		return ErrUnknownDynamic
+	}
+}
+
+// ILMConfig - index lifecycle policy created at startup and applied to collection indices
+type ILMConfig struct {
+	// Policy - lifecycle policy name, bulklog by default
+	Policy         string      `yaml:"policy"`
+	Rollover       ILMRollover `yaml:"rollover"`
+	DeleteAfterStr string      `yaml:"delete_after"`
+}
+
+// ILMRollover - conditions to roll a data stream over to a new backing index, any of them triggers it
+type ILMRollover struct {
+	MaxAgeStr string `yaml:"max_age"`
+	// MaxPrimaryShardSize - elasticsearch byte size, such as 50gb
+	MaxPrimaryShardSize string `yaml:"max_primary_shard_size"`
+	MaxDocs             int64  `yaml:"max_docs"`
+}
+
+// Enabled - whether any rollover condition is set
+func (r ILMRollover) Enabled() bool {
+	return r.MaxAgeStr != "" || r.MaxPrimaryShardSize != "" || r.MaxDocs > 0
+}
+
+// MaxAge - index age triggering a rollover, 0 if none
+func (r ILMRollover) MaxAge() (time.Duration, error) {
+	return optionalPeriod(r.MaxAgeStr)
+}
+
+// DeleteAfter - index age, since its rollover for data streams, after which it is deleted, 0 if never
+func (c ILMConfig) DeleteAfter() (time.Duration, error) {
+	return optionalPeriod(c.DeleteAfterStr)
+}
+
+// PolicyName - lifecycle policy name
+func (c ILMConfig) PolicyName() string {
+	if c.Policy == "" {
+		return defaultPolicy
+	}
+	return c.Policy
+}
+
+// Validate reports lifecycle policies which cannot be created
+func (c ILMConfig) Validate(dataStream bool) error {
+	maxAge, err := c.Rollover.MaxAge()
+	if err != nil {
+		return err
+	}
+	deleteAfter, err := c.DeleteAfter()
+	if err != nil {
+		return err
+	}
+	if maxAge < 0 || deleteAfter < 0 || c.Rollover.MaxDocs < 0 {
+		return collection.ErrLengthLowerThanZero
+	}
+	if c.Rollover.Enabled() && !dataStream {
+		return ErrRolloverWithoutDataStream
+	}
+	if !c.Rollover.Enabled() && deleteAfter == 0 {
+		return ErrEmptyPolicy
+	}
+	return nil
+}
+
+func optionalPeriod(str string) (time.Duration, error) {
+	if str == "" {
+		return 0, nil
+	}
+	period, err := collection.Period(str)
+	if err != nil {
+		return 0, fmt.Errorf("collection.Period.%s", err)
+	}
+	return period, nil
 }
@@ -0,0 +1,137 @@
+package elastic
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/khezen/bulklog/pkg/collection"
+)
+
+var (
+	// ErrUnknownIDPlaceholder - id placeholder is neither {id}, {collection}, {schema} nor {field.<path>}
+	ErrUnknownIDPlaceholder = errors.New("ErrUnknownIDPlaceholder - id placeholders are {id}, {collection}, {schema} or {field.<path>}")
+	// ErrUnknownOpType - op_type must be a bulk action creating documents
+	ErrUnknownOpType = errors.New("ErrUnknownOpType - op_type must be index|create")
+	// ErrDataStreamOpType - data streams only accept creations
+	ErrDataStreamOpType = errors.New("ErrDataStreamOpType - data_stream requires op_type create")
+)
+
+// fieldPlaceholder - prefix of the placeholders replaced by a field of the document body
+const fieldPlaceholder = "field."
+
+// IDTemplate renders the _id of documents such as {collection}-{field.request_id}.
+// {id} is replaced by the document ID, {collection} and {schema} by its collection and schema names,
+// {field.<path>} by the string or number found at the dotted path of its body.
+// Documents missing one of the fields get their document ID as _id.
+type IDTemplate string
+
+// defaultIDTemplate - documents keep the ID bulklog gave them, or the one their client supplied, on every try
+const defaultIDTemplate = "{id}"
+
+// Render - _id of the given document
+func (t IDTemplate) Render(d collection.Document) string {
+	if t == "" || t == defaultIDTemplate {
+		return d.ID.String()
+	}
+	var (
+		fields  map[string]json.RawMessage
+		missing bool
+	)
+	id := IndexTemplate(t).render(func(placeholder string) string {
+		switch {
+		case placeholder == "id":
+			return d.ID.String()
+		case placeholder == "collection":
+			return string(d.CollectionName)
+		case placeholder == "schema":
+			return string(d.SchemaName)
+		default:
+			if fields == nil && json.Unmarshal(d.Body, &fields) != nil {
+				missing = true
+				return ""
+			}
+			value, ok := fieldValue(fields, strings.TrimPrefix(placeholder, fieldPlaceholder))
+			if !ok {
+				missing = true
+			}
+			return value
+		}
+	})
+	if missing {
+		return d.ID.String()
+	}
+	return id
+}
+
+// Validate checks every placeholder is {id}, {collection}, {schema} or {field.<path>}
+func (t IDTemplate) Validate() error {
+	var err error
+	IndexTemplate(t).render(func(placeholder string) string {
+		switch {
+		case placeholder == "id", placeholder == "collection", placeholder == "schema":
+		case strings.HasPrefix(placeholder, fieldPlaceholder) && len(placeholder) > len(fieldPlaceholder):
+		default:
+			err = ErrUnknownIDPlaceholder
+		}
+		return ""
+	})
+	return err
+}
+
+// fieldValue - string or number at the dotted path of fields
+func fieldValue(fields map[string]json.RawMessage, path string) (string, bool) {
+	keys := strings.Split(path, ".")
+	for _, key := range keys[:len(keys)-1] {
+		raw, ok := fields[key]
+		if !ok {
+			return "", false
+		}
+		fields = nil
+		if json.Unmarshal(raw, &fields) != nil {
+			return "", false
+		}
+	}
+	raw, ok := fields[keys[len(keys)-1]]
+	if !ok {
+		return "", false
+	}
+	var value interface{}
+	if json.Unmarshal(raw, &value) != nil {
+		return "", false
+	}
+	switch v := value.(type) {
+	case string:
+		return v, v != ""
+	case float64:
+		return string(raw), true
+	default:
+		return "", false
+	}
+}
+
+// OpType - bulk action documents are sent with
+// ref: https://www.elastic.co/guide/en/elasticsearch/reference/current/docs-bulk.html
+type OpType string
+
+const (
+	// OpIndex - documents replace those with the same _id
+	OpIndex OpType = "index"
+	// OpCreate - documents with the _id of an existing one are left out, the one already indexed is kept
+	OpCreate OpType = "create"
+)
+
+// Validate reports unknown op types, and data streams indexing documents
+func (o OpType) Validate(dataStream bool) error {
+	switch o {
+	case "", OpCreate:
+		return nil
+	case OpIndex:
+		if dataStream {
+			return ErrDataStreamOpType
+		}
+		return nil
+	default:
+		return ErrUnknownOpType
+	}
+}
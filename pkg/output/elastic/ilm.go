@@ -0,0 +1,83 @@
+package elastic
+
+import (
+	"fmt"
+	"time"
+)
+
+const defaultPolicy = "bulklog"
+
+// Policy - index lifecycle policy
+// ref: https://www.elastic.co/guide/en/elasticsearch/reference/current/ilm-put-lifecycle.html
+type Policy struct {
+	Policy PolicyPhases `json:"policy"`
+}
+
+// PolicyPhases - lifecycle phases an index goes through
+type PolicyPhases struct {
+	Phases map[string]Phase  `json:"phases"`
+	Meta   map[string]string `json:"_meta,omitempty"`
+}
+
+// Phase - lifecycle phase, entered once the index is min_age old
+type Phase struct {
+	MinAge  string                 `json:"min_age,omitempty"`
+	Actions map[string]interface{} `json:"actions"`
+}
+
+// Rollover - rollover action conditions
+type Rollover struct {
+	MaxAge              string `json:"max_age,omitempty"`
+	MaxPrimaryShardSize string `json:"max_primary_shard_size,omitempty"`
+	MaxDocs             int64  `json:"max_docs,omitempty"`
+}
+
+// RenderPolicy - lifecycle policy rolling data streams over in a hot phase and deleting indices in a delete phase
+func RenderPolicy(cfg ILMConfig) (Policy, error) {
+	maxAge, err := cfg.Rollover.MaxAge()
+	if err != nil {
+		return Policy{}, fmt.Errorf("MaxAge.%s", err)
+	}
+	deleteAfter, err := cfg.DeleteAfter()
+	if err != nil {
+		return Policy{}, fmt.Errorf("DeleteAfter.%s", err)
+	}
+	phases := make(map[string]Phase, 2)
+	hot := Phase{
+		MinAge:  "0ms",
+		Actions: make(map[string]interface{}),
+	}
+	if cfg.Rollover.Enabled() {
+		rollover := Rollover{
+			MaxPrimaryShardSize: cfg.Rollover.MaxPrimaryShardSize,
+			MaxDocs:             cfg.Rollover.MaxDocs,
+		}
+		if maxAge > 0 {
+			rollover.MaxAge = timeUnit(maxAge)
+		}
+		hot.Actions["rollover"] = rollover
+	}
+	phases["hot"] = hot
+	if deleteAfter > 0 {
+		phases["delete"] = Phase{
+			MinAge: timeUnit(deleteAfter),
+			Actions: map[string]interface{}{
+				"delete": struct{}{},
+			},
+		}
+	}
+	return Policy{
+		Policy: PolicyPhases{
+			Phases: phases,
+			Meta:   managedBy,
+		},
+	}, nil
+}
+
+// timeUnit - elasticsearch time unit of the duration, such as 3600s
+func timeUnit(d time.Duration) string {
+	if d%time.Second == 0 {
+		return fmt.Sprintf("%ds", d/time.Second)
+	}
+	return fmt.Sprintf("%dms", d/time.Millisecond)
+}
@@ -3,11 +3,25 @@ package elastic
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"time"
 
 	"github.com/khezen/bulklog/pkg/collection"
 )
 
+// ErrConflictingMapping - composable templates map every schema at once, a field must have the same type in each
+var ErrConflictingMapping = errors.New("ErrConflictingMapping - fields must have the same type across schemas of a collection")
+
+// templatePriority - priority of composable templates, above the built-in logs-*-* and metrics-*-* ones
+const templatePriority = 200
+
+// timestampField - field data streams order documents by, set to the document posting time unless given
+const timestampField = "@timestamp"
+
+// managedBy - metadata of the templates and policies bulklog creates
+var managedBy = map[string]string{"managed_by": "bulklog"}
+
 // Index - elasticsearch index definition
 // ref: https://www.elastic.co/guide/en/elasticsearch/reference/current/indices-templates.html
 type Index struct {
@@ -18,7 +32,24 @@ type Index struct {
 
 // IndexSettings -
 type IndexSettings struct {
-	NumberOfShards int `json:"number_of_shards"`
+	NumberOfShards int    `json:"number_of_shards"`
+	LifecycleName  string `json:"index.lifecycle.name,omitempty"`
+}
+
+// ComposableIndex - composable index template definition
+// ref: https://www.elastic.co/guide/en/elasticsearch/reference/current/index-templates.html
+type ComposableIndex struct {
+	Patterns   []string          `json:"index_patterns"`
+	Priority   int               `json:"priority"`
+	DataStream *struct{}         `json:"data_stream,omitempty"`
+	Template   IndexBody         `json:"template"`
+	Meta       map[string]string `json:"_meta,omitempty"`
+}
+
+// IndexBody - settings and mappings of the indices matched by a composable template
+type IndexBody struct {
+	Settings IndexSettings `json:"settings"`
+	Mappings Mapping       `json:"mappings"`
 }
 
 // Mappings - document schema definitions
@@ -27,6 +58,7 @@ type Mappings map[collection.SchemaName]Mapping
 // Mapping - document schema definition
 // ref : // ref: https://www.elastic.co/guide/en/elasticsearch/reference/current/mapping.html
 type Mapping struct {
+	Dynamic    Dynamic          `json:"dynamic,omitempty"`
 	Properties map[string]Field `json:"properties"`
 }
 
@@ -37,14 +69,15 @@ type Field struct {
 }
 
 // RenderElasticIndex - render elasticsearch mapping
-func RenderElasticIndex(collect *collection.Collection, settings IndexSettings) Index {
+func RenderElasticIndex(collect *collection.Collection, settings IndexSettings, template IndexTemplate, dynamic Dynamic) Index {
 	index := Index{
-		Pattern:  fmt.Sprintf("%s-*", collect.Name),
+		Pattern:  template.Pattern(collect.Name),
 		Settings: settings,
 		Mappings: make(map[collection.SchemaName]Mapping),
 	}
 	for _, schema := range collect.Schemas {
 		mapping := Mapping{
+			Dynamic:    dynamic,
 			Properties: make(map[string]Field),
 		}
 		for key, field := range schema.Fields {
@@ -57,17 +90,56 @@ func RenderElasticIndex(collect *collection.Collection, settings IndexSettings)
 	return index
 }
 
+// RenderComposableIndex - render a composable template mapping the fields of every schema of the collection
+func RenderComposableIndex(collect *collection.Collection, settings IndexSettings, template IndexTemplate, dynamic Dynamic, dataStream bool) (ComposableIndex, error) {
+	mapping := Mapping{
+		Dynamic:    dynamic,
+		Properties: make(map[string]Field),
+	}
+	for _, schema := range collect.Schemas {
+		for key, field := range schema.Fields {
+			elasticField := Field{
+				Type: translateType(field),
+			}
+			if mapped, ok := mapping.Properties[key]; ok && mapped != elasticField {
+				return ComposableIndex{}, fmt.Errorf("%s: %s", key, ErrConflictingMapping)
+			}
+			mapping.Properties[key] = elasticField
+		}
+	}
+	index := ComposableIndex{
+		Patterns: []string{template.Pattern(collect.Name)},
+		Priority: templatePriority,
+		Template: IndexBody{
+			Settings: settings,
+			Mappings: mapping,
+		},
+		Meta: managedBy,
+	}
+	if dataStream {
+		index.DataStream = &struct{}{}
+		if _, ok := mapping.Properties[timestampField]; !ok {
+			mapping.Properties[timestampField] = Field{Type: "date"}
+		}
+	}
+	return index, nil
+}
+
 func translateType(field collection.Field) string {
 	switch field.Type {
 	case collection.Bool:
-		return "bool"
+		return "boolean"
 	case collection.UInt8, collection.UInt16, collection.UInt32, collection.UInt64,
 		collection.Int8, collection.Int16, collection.Int32, collection.Int64:
 		return "long"
 	case collection.Float32, collection.Float64:
 		return "double"
 	case collection.DateTime:
-		return "date"
+		// elasticsearch default date format parses RFC 3339 dates only
+		if field.DateFormat == time.RFC3339 || field.DateFormat == time.RFC3339Nano {
+			return "date"
+		}
+		return "keyword"
 	case collection.Object:
 		return "object"
 	case collection.String:
@@ -82,27 +154,56 @@ func translateType(field collection.Field) string {
 
 // RenderIndexName - logs: logs-2017.05.26
 func RenderIndexName(d collection.Document) string {
-	indexBuf := bytes.NewBufferString(string(d.CollectionName))
-	indexBuf.WriteString("-")
-	indexBuf.WriteString(d.PostedAt.Format("2006.01.02"))
-	return indexBuf.String()
+	return IndexTemplate(defaultIndexTemplate).Render(d)
 }
 
-// Digest returns the JSON request to be append to the bulk
-func Digest(d collection.Document) ([]byte, error) {
+// Digest returns the JSON request to be append to the bulk.
+// Documents are typed by schema for legacy templates, and given a @timestamp in data streams.
+func Digest(d collection.Document, template IndexTemplate, id IDTemplate, opType OpType, api TemplateAPI, dataStream bool) ([]byte, error) {
 	request := make(map[string]interface{})
 	//{ "index" : { "_index" : "logs-2017.05.28", "_type" : "log", "_id" : "1" } }
 	docDescription := make(map[string]interface{})
-	docDescription["_index"] = RenderIndexName(d)
-	docDescription["_type"] = d.SchemaName
-	docDescription["_id"] = d.ID
-	request["index"] = docDescription
+	docDescription["_index"] = template.Render(d)
+	if api != ComposableTemplate {
+		docDescription["_type"] = d.SchemaName
+	}
+	docDescription["_id"] = id.Render(d)
+	docBody := d.Body
+	if dataStream {
+		docBody = withTimestamp(d)
+	}
+	request[string(opType)] = docDescription
 	body, err := json.Marshal(request)
 	if err != nil {
 		return nil, fmt.Errorf("json.Marshal.%s", err)
 	}
 	body = append(body, '\n')
-	body = append(body, d.Body...)
+	body = append(body, docBody...)
 	body = append(body, '\n')
 	return body, nil
 }
+
+// withTimestamp - document body with the posting time as @timestamp, unless it has one.
+// Bodies which are not JSON objects are left as is for elasticsearch to reject them.
+func withTimestamp(d collection.Document) []byte {
+	body := bytes.TrimSpace(d.Body)
+	if len(body) < 2 || body[0] != '{' {
+		return d.Body
+	}
+	if bytes.Contains(body, []byte(`"`+timestampField+`"`)) {
+		var fields map[string]json.RawMessage
+		if json.Unmarshal(body, &fields) != nil {
+			return d.Body
+		}
+		if _, ok := fields[timestampField]; ok {
+			return d.Body
+		}
+	}
+	timestamp := fmt.Sprintf(`{"%s":"%s"`, timestampField, d.PostedAt.UTC().Format(time.RFC3339Nano))
+	withTimestamp := make([]byte, 0, len(body)+len(timestamp)+1)
+	withTimestamp = append(withTimestamp, timestamp...)
+	if rest := bytes.TrimSpace(body[1:]); len(rest) > 0 && rest[0] != '}' {
+		withTimestamp = append(withTimestamp, ',')
+	}
+	return append(withTimestamp, body[1:]...)
+}
@@ -0,0 +1,97 @@
+package elastic
+
+import (
+	"errors"
+	"strings"
+	"unicode"
+
+	"github.com/khezen/bulklog/pkg/collection"
+)
+
+// ErrUnknownPlaceholder - index placeholder is neither {collection}, {schema} nor a date pattern
+var ErrUnknownPlaceholder = errors.New("ErrUnknownPlaceholder - index placeholders are {collection}, {schema} or date patterns made of yyyy, yy, MM, dd, HH")
+
+const (
+	defaultIndexTemplate = "{collection}-{yyyy.MM.dd}"
+	// defaultDataStreamTemplate - data streams roll over on their lifecycle policy rather than on dates
+	defaultDataStreamTemplate = "{collection}"
+)
+
+var dateTokens = strings.NewReplacer(
+	"yyyy", "2006",
+	"yy", "06",
+	"MM", "01",
+	"dd", "02",
+	"HH", "15",
+)
+
+// IndexTemplate renders index names such as logs-{collection}-{yyyy.MM.dd}
+// {collection} and {schema} are replaced by document collection and schema names,
+// any other placeholder is a date pattern applied to the document PostedAt.
+type IndexTemplate string
+
+// Render - index name of the given document
+func (t IndexTemplate) Render(d collection.Document) string {
+	return t.render(func(placeholder string) string {
+		switch placeholder {
+		case "collection":
+			return string(d.CollectionName)
+		case "schema":
+			return string(d.SchemaName)
+		default:
+			return d.PostedAt.UTC().Format(dateTokens.Replace(placeholder))
+		}
+	})
+}
+
+// Pattern - index pattern matching every index of the collection
+func (t IndexTemplate) Pattern(collectionName collection.Name) string {
+	return t.render(func(placeholder string) string {
+		switch placeholder {
+		case "collection":
+			return string(collectionName)
+		default:
+			return "*"
+		}
+	})
+}
+
+// Validate checks every placeholder is {collection}, {schema} or a date pattern
+func (t IndexTemplate) Validate() error {
+	var err error
+	t.render(func(placeholder string) string {
+		switch placeholder {
+		case "collection", "schema":
+		default:
+			if strings.ContainsFunc(dateTokens.Replace(placeholder), unicode.IsLetter) {
+				err = ErrUnknownPlaceholder
+			}
+		}
+		return ""
+	})
+	return err
+}
+
+func (t IndexTemplate) render(replace func(placeholder string) string) string {
+	var (
+		str  = string(t)
+		buf  strings.Builder
+		i, j int
+	)
+	for {
+		i = strings.IndexByte(str, '{')
+		if i < 0 {
+			buf.WriteString(str)
+			break
+		}
+		j = strings.IndexByte(str[i:], '}')
+		if j < 0 {
+			buf.WriteString(str)
+			break
+		}
+		buf.WriteString(str[:i])
+		buf.WriteString(replace(str[i+1 : i+j]))
+		str = str[i+j+1:]
+	}
+	return strings.Replace(buf.String(), "**", "*", -1)
+}
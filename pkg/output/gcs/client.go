@@ -0,0 +1,142 @@
+package gcs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"time"
+
+	"github.com/khezen/bulklog/pkg/auth"
+	"github.com/khezen/bulklog/pkg/collection"
+	"github.com/khezen/bulklog/pkg/output/archive"
+	"github.com/khezen/bulklog/pkg/output/dryrun"
+	"github.com/khezen/bulklog/pkg/output/idempotency"
+)
+
+const (
+	baseURL   = "https://storage.googleapis.com/storage/v1"
+	uploadURL = "https://storage.googleapis.com/upload/storage/v1"
+	scope     = "https://www.googleapis.com/auth/devstorage.read_write"
+)
+
+// GCS archives documents as gzip compressed NDJSON objects
+type GCS struct {
+	signer       auth.Signer
+	bucket       string
+	prefix       string
+	storageClass StorageClass
+	httpcli      http.Client
+}
+
+// object - metadata of an uploaded object
+type object struct {
+	Name            string       `json:"name"`
+	ContentType     string       `json:"contentType"`
+	ContentEncoding string       `json:"contentEncoding"`
+	StorageClass    StorageClass `json:"storageClass,omitempty"`
+}
+
+// New returns google cloud storage as an output
+func New(cfg Config) (*GCS, error) {
+	signer, err := auth.NewGoogleSigner(cfg.GoogleAuth, scope)
+	if err != nil {
+		return nil, fmt.Errorf("auth.NewGoogleSigner.%s", err)
+	}
+	return &GCS{
+		signer,
+		cfg.Bucket,
+		cfg.Prefix,
+		cfg.StorageClass,
+		http.Client{
+			Transport: dryrun.Transport(&http.Transport{
+				MaxIdleConns:    10,
+				IdleConnTimeout: 30 * time.Second,
+			}),
+		},
+	}, nil
+}
+
+// Digest puts documents in google cloud storage
+func (c *GCS) Digest(ctx context.Context, documents []collection.Document) error {
+	objects, err := archive.Render(c.prefix, idempotency.Pipe(ctx), documents)
+	if err != nil {
+		return fmt.Errorf("archive.Render.%s", err)
+	}
+	for _, object := range objects {
+		err = c.put(ctx, object)
+		if err != nil {
+			return fmt.Errorf("put.%s", err)
+		}
+	}
+	return nil
+}
+
+// put uploads the object along with its metadata, in a multipart upload
+// ref: https://cloud.google.com/storage/docs/uploading-objects#uploading-an-object
+func (c *GCS) put(ctx context.Context, obj archive.Object) error {
+	metadata, err := json.Marshal(object{
+		Name:            obj.Key,
+		ContentType:     "application/x-ndjson",
+		ContentEncoding: "gzip",
+		StorageClass:    c.storageClass,
+	})
+	if err != nil {
+		return fmt.Errorf("json.Marshal.%s", err)
+	}
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	for _, part := range []struct {
+		contentType string
+		content     []byte
+	}{{"application/json; charset=UTF-8", metadata}, {"application/x-ndjson", obj.Body}} {
+		w, err := writer.CreatePart(textproto.MIMEHeader{"Content-Type": {part.contentType}})
+		if err != nil {
+			return fmt.Errorf("multipart.CreatePart.%s", err)
+		}
+		w.Write(part.content)
+	}
+	err = writer.Close()
+	if err != nil {
+		return fmt.Errorf("multipart.Close.%s", err)
+	}
+	endpoint := fmt.Sprintf("%s/b/%s/o?uploadType=multipart", uploadURL, url.PathEscape(c.bucket))
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewReader(body.Bytes()))
+	if err != nil {
+		return fmt.Errorf("http.NewRequest.%s", err)
+	}
+	req.Header.Set("Content-Type", fmt.Sprintf("multipart/related; boundary=%s", writer.Boundary()))
+	_, err = c.do(req, body.Bytes())
+	return err
+}
+
+// do signs and sends the request, it returns the response body
+func (c *GCS) do(req *http.Request, body []byte) ([]byte, error) {
+	err := c.signer.Sign(req, body)
+	if err != nil {
+		return nil, fmt.Errorf("Sign.%s", err)
+	}
+	res, err := c.httpcli.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("httpClient.Do.%s", err)
+	}
+	defer res.Body.Close()
+	resBody, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, fmt.Errorf("ioutil.ReadAll.%s", err)
+	}
+	if res.StatusCode >= 300 {
+		return nil, fmt.Errorf("gcs: %s : %s", res.Status, resBody)
+	}
+	return resBody, nil
+}
+
+// Ensure - bucket is expected to exist
+func (c *GCS) Ensure(ctx context.Context, collection *collection.Collection) error {
+	return nil
+}
@@ -0,0 +1,33 @@
+package gcs
+
+import (
+	"errors"
+
+	"github.com/khezen/bulklog/pkg/auth"
+)
+
+// ErrUnknownStorageClass -
+var ErrUnknownStorageClass = errors.New("ErrUnknownStorageClass - gcs storage class must be one of STANDARD|NEARLINE|COLDLINE|ARCHIVE")
+
+// Config -
+type Config struct {
+	Enabled bool   `yaml:"enabled"`
+	Bucket  string `yaml:"bucket"`
+	Prefix  string `yaml:"prefix"`
+	// StorageClass - storage class of objects, the default class of the bucket if empty
+	StorageClass StorageClass      `yaml:"storage_class"`
+	GoogleAuth   auth.GoogleConfig `yaml:"google_auth"`
+}
+
+// StorageClass - object storage class
+type StorageClass string
+
+// Validate reports unknown storage classes
+func (s StorageClass) Validate() error {
+	switch s {
+	case "", "STANDARD", "NEARLINE", "COLDLINE", "ARCHIVE":
+		return nil
+	default:
+		return ErrUnknownStorageClass
+	}
+}
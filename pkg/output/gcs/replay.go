@@ -0,0 +1,89 @@
+package gcs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/khezen/bulklog/pkg/collection"
+	"github.com/khezen/bulklog/pkg/output/archive"
+)
+
+// objects - page of an objects.list response
+type objects struct {
+	Items []struct {
+		Name string `json:"name"`
+	} `json:"items"`
+	NextPageToken string `json:"nextPageToken"`
+}
+
+// Archived lists the objects of a collection in the hourly partitions between from and to
+func (c *GCS) Archived(ctx context.Context, collectionName collection.Name, from, to time.Time) ([]string, error) {
+	keys := make([]string, 0)
+	for _, prefix := range archive.Partitions(c.prefix, collectionName, from, to) {
+		partition, err := c.list(ctx, prefix)
+		if err != nil {
+			return nil, fmt.Errorf("list(%s).%s", prefix, err)
+		}
+		keys = append(keys, partition...)
+	}
+	return keys, nil
+}
+
+// ArchivedDocuments gets an object and decodes its documents
+func (c *GCS) ArchivedDocuments(ctx context.Context, key string) ([]collection.Document, error) {
+	body, err := c.get(ctx, fmt.Sprintf("%s/b/%s/o/%s?alt=media", baseURL, url.PathEscape(c.bucket), url.PathEscape(key)))
+	if err != nil {
+		return nil, fmt.Errorf("get.%s", err)
+	}
+	documents, err := archive.Decode(body)
+	if err != nil {
+		return nil, fmt.Errorf("archive.Decode.%s", err)
+	}
+	return documents, nil
+}
+
+// list returns the names of objects starting with prefix, following page tokens
+func (c *GCS) list(ctx context.Context, prefix string) ([]string, error) {
+	var (
+		keys  = make([]string, 0)
+		token string
+	)
+	for {
+		query := url.Values{}
+		query.Set("prefix", prefix)
+		query.Set("fields", "items(name),nextPageToken")
+		if token != "" {
+			query.Set("pageToken", token)
+		}
+		body, err := c.get(ctx, fmt.Sprintf("%s/b/%s/o?%s", baseURL, url.PathEscape(c.bucket), query.Encode()))
+		if err != nil {
+			return nil, err
+		}
+		var page objects
+		err = json.Unmarshal(body, &page)
+		if err != nil {
+			return nil, fmt.Errorf("json.Unmarshal.%s", err)
+		}
+		for _, object := range page.Items {
+			keys = append(keys, object.Name)
+		}
+		if page.NextPageToken == "" {
+			return keys, nil
+		}
+		token = page.NextPageToken
+	}
+}
+
+func (c *GCS) get(ctx context.Context, objectURL string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", objectURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("http.NewRequest.%s", err)
+	}
+	// objects are read as stored rather than transcoded, the transport would otherwise decompress them
+	req.Header.Set("Accept-Encoding", "gzip")
+	return c.do(req, nil)
+}
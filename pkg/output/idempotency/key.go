@@ -0,0 +1,31 @@
+package idempotency
+
+import "context"
+
+type keyContext struct{}
+
+// WithKey returns a copy of ctx carrying the idempotency key of a delivery.
+// The key is the same for every try of a pipe to an output, outputs may forward it so that downstreams dedupe retried tries.
+func WithKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, keyContext{}, key)
+}
+
+// Key returns the idempotency key of the delivery ctx carries, "" if none
+func Key(ctx context.Context) string {
+	key, _ := ctx.Value(keyContext{}).(string)
+	return key
+}
+
+type pipeContext struct{}
+
+// WithPipe returns a copy of ctx carrying the ID of the pipe a delivery conveys, or of its sub-batch.
+// Outputs writing one object per delivery may key it by this ID, so that retried tries overwrite it.
+func WithPipe(ctx context.Context, pipeID string) context.Context {
+	return context.WithValue(ctx, pipeContext{}, pipeID)
+}
+
+// Pipe returns the pipe ID of the delivery ctx carries, "" if none
+func Pipe(ctx context.Context) string {
+	pipeID, _ := ctx.Value(pipeContext{}).(string)
+	return pipeID
+}
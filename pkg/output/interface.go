@@ -1,9 +1,28 @@
 package output
 
-import "github.com/khezen/bulklog/pkg/collection"
+import (
+	"context"
+	"time"
+
+	"github.com/khezen/bulklog/pkg/collection"
+)
 
 // Interface interface to send msg to recipents
 type Interface interface {
-	Digest(documents []collection.Document) error
-	Ensure(collection *collection.Collection) error
+	// Digest delivers documents, giving up once ctx is done
+	Digest(ctx context.Context, documents []collection.Document) error
+	Ensure(ctx context.Context, collection *collection.Collection) error
+}
+
+// Pinger is implemented by outputs which can check they are reachable
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// Archiver is implemented by outputs which can read back the documents they archived
+type Archiver interface {
+	// Archived lists the objects holding documents of a collection archived between from and to
+	Archived(ctx context.Context, collectionName collection.Name, from, to time.Time) ([]string, error)
+	// ArchivedDocuments reads the documents of an archived object
+	ArchivedDocuments(ctx context.Context, key string) ([]collection.Document, error)
 }
@@ -0,0 +1,108 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/khezen/bulklog/pkg/codec"
+	"github.com/khezen/bulklog/pkg/collection"
+	wire "github.com/khezen/bulklog/pkg/kafka"
+)
+
+var (
+	// ErrUnsupportedAcks -
+	ErrUnsupportedAcks = errors.New("ErrUnsupportedAcks - kafka acks must be one of all|1|0")
+)
+
+// Kafka publishes documents to a topic per collection
+type Kafka struct {
+	producer    *wire.Producer
+	topicPrefix string
+	keyField    string
+	// deliveries - values are converted to the delivery format of their collection
+	deliveries codec.Deliveries
+}
+
+// New returns kafka as an output
+func New(cfg Config) (*Kafka, error) {
+	var acks int16
+	switch cfg.Acks {
+	case "all", "-1", "":
+		acks = -1
+	case "1":
+		acks = 1
+	case "0":
+		acks = 0
+	default:
+		return nil, ErrUnsupportedAcks
+	}
+	return &Kafka{
+		wire.NewProducer(wire.ProducerConfig{
+			Brokers:     cfg.Brokers,
+			Acks:        acks,
+			Compression: cfg.Compression,
+		}),
+		cfg.TopicPrefix,
+		cfg.KeyField,
+		codec.Deliveries{},
+	}, nil
+}
+
+// Digest publishes documents to kafka
+func (c *Kafka) Digest(ctx context.Context, documents []collection.Document) error {
+	topics := make(map[collection.Name][]wire.Message)
+	for _, doc := range documents {
+		key, err := c.key(doc)
+		if err != nil {
+			return fmt.Errorf("key.%s", err)
+		}
+		value, err := c.deliveries.Deliver(doc)
+		if err != nil {
+			return fmt.Errorf("Deliver.%s", err)
+		}
+		topics[doc.CollectionName] = append(topics[doc.CollectionName], wire.Message{
+			Key:   key,
+			Value: value,
+			Time:  doc.PostedAt,
+		})
+	}
+	for collectionName, messages := range topics {
+		// the producer bounds each request with its own timeout, ctx is checked between topics
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		topic := fmt.Sprintf("%s%s", c.topicPrefix, collectionName)
+		err := c.producer.Produce(topic, messages)
+		if err != nil {
+			return fmt.Errorf("Produce.%s", err)
+		}
+	}
+	return nil
+}
+
+func (c *Kafka) key(doc collection.Document) ([]byte, error) {
+	if c.keyField == "" {
+		return nil, nil
+	}
+	var body map[string]interface{}
+	err := json.Unmarshal(doc.Body, &body)
+	if err != nil {
+		return nil, fmt.Errorf("json.Unmarshal.%s", err)
+	}
+	value, ok := body[c.keyField]
+	if !ok || value == nil {
+		return nil, nil
+	}
+	if str, ok := value.(string); ok {
+		return []byte(str), nil
+	}
+	return json.Marshal(value)
+}
+
+// Ensure - topics are expected to exist or to be auto created by brokers, the delivery format of the collection is recorded
+func (c *Kafka) Ensure(ctx context.Context, collection *collection.Collection) error {
+	c.deliveries.Ensure(collection)
+	return nil
+}
@@ -0,0 +1,13 @@
+package kafka
+
+import wire "github.com/khezen/bulklog/pkg/kafka"
+
+// Config -
+type Config struct {
+	Enabled     bool             `yaml:"enabled"`
+	Brokers     []string         `yaml:"brokers"`
+	TopicPrefix string           `yaml:"topic_prefix"`
+	KeyField    string           `yaml:"key_field"`
+	Acks        string           `yaml:"acks"`
+	Compression wire.Compression `yaml:"compression"`
+}
@@ -0,0 +1,119 @@
+package loki
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/khezen/bulklog/pkg/auth"
+	"github.com/khezen/bulklog/pkg/collection"
+	"github.com/khezen/bulklog/pkg/output/compression"
+	"github.com/khezen/bulklog/pkg/output/dryrun"
+	"github.com/khezen/bulklog/pkg/output/retry"
+)
+
+// Loki is a client for Loki push API
+type Loki struct {
+	signer        auth.Signer
+	pushEndpoint  string
+	tenantID      string
+	labels        []string
+	httpcli       http.Client
+	readyEndpoint string
+	compression   compression.Compression
+}
+
+// New returns loki as an output
+func New(cfg Config) *Loki {
+	if cfg.Scheme == "" {
+		cfg.Scheme = "http"
+	}
+	var signer auth.Signer
+	if cfg.BasicAuth != nil {
+		signer = auth.NewBasicSigner(*cfg.BasicAuth)
+	}
+	return &Loki{
+		signer,
+		fmt.Sprintf("%s://%s/loki/api/v1/push", cfg.Scheme, cfg.Endpoint),
+		cfg.TenantID,
+		cfg.Labels,
+		http.Client{
+			Transport: dryrun.Transport(&http.Transport{
+				MaxIdleConns:    10,
+				IdleConnTimeout: 30 * time.Second,
+			}),
+		},
+		fmt.Sprintf("%s://%s/ready", cfg.Scheme, cfg.Endpoint),
+		cfg.Compression,
+	}
+}
+
+// Ping requests Loki readiness
+func (c *Loki) Ping(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", c.readyEndpoint, nil)
+	if err != nil {
+		return fmt.Errorf("http.NewRequest.%s", err)
+	}
+	res, err := c.httpcli.Do(req)
+	if err != nil {
+		return fmt.Errorf("httpClient.Do.%s", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("loki: %s", res.Status)
+	}
+	return nil
+}
+
+// Digest pushes documents to Loki as streams
+func (c *Loki) Digest(ctx context.Context, documents []collection.Document) error {
+	pushRequest, err := RenderPushRequest(documents, c.labels)
+	if err != nil {
+		return fmt.Errorf("RenderPushRequest.%s", err)
+	}
+	body, err := json.Marshal(pushRequest)
+	if err != nil {
+		return fmt.Errorf("json.Marshal.%s", err)
+	}
+	body, err = c.compression.Encode(body)
+	if err != nil {
+		return fmt.Errorf("Encode.%s", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", c.pushEndpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("http.NewRequest.%s", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	c.compression.SetHeader(req)
+	if c.tenantID != "" {
+		req.Header.Set("X-Scope-OrgID", c.tenantID)
+	}
+	if c.signer != nil {
+		err = c.signer.Sign(req, body)
+		if err != nil {
+			return fmt.Errorf("Sign.%s", err)
+		}
+	}
+	res, err := c.httpcli.Do(req)
+	if err != nil {
+		return fmt.Errorf("httpClient.Do.%s", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode >= 300 {
+		resBody, err := ioutil.ReadAll(res.Body)
+		if err != nil {
+			return fmt.Errorf("ioutil.ReadAll.%s", err)
+		}
+		return retry.FromResponse(res, fmt.Errorf("loki: %s : %s", res.Status, resBody))
+	}
+	return nil
+}
+
+// Ensure - loki streams are created on the fly
+func (c *Loki) Ensure(ctx context.Context, collection *collection.Collection) error {
+	return nil
+}
@@ -0,0 +1,18 @@
+package loki
+
+import (
+	"github.com/khezen/bulklog/pkg/auth"
+	"github.com/khezen/bulklog/pkg/output/compression"
+)
+
+// Config -
+type Config struct {
+	Enabled   bool              `yaml:"enabled"`
+	Endpoint  string            `yaml:"endpoint"`
+	Scheme    string            `yaml:"scheme"`
+	TenantID  string            `yaml:"tenant_id"`
+	Labels    []string          `yaml:"labels"`
+	BasicAuth *auth.BasicConfig `yaml:"basic_auth,omitempty"`
+	// Compression - Content-Encoding of push requests, none by default
+	Compression compression.Compression `yaml:"compression"`
+}
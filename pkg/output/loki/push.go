@@ -0,0 +1,106 @@
+package loki
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/khezen/bulklog/pkg/collection"
+)
+
+// PushRequest - loki push API body
+// ref: https://grafana.com/docs/loki/latest/reference/loki-http-api/#ingest-logs
+type PushRequest struct {
+	Streams []Stream `json:"streams"`
+}
+
+// Stream - log lines sharing the same label set
+type Stream struct {
+	Labels map[string]string `json:"stream"`
+	Values [][2]string       `json:"values"`
+}
+
+// RenderPushRequest groups documents into streams by label set.
+// collection and schema labels are always set,
+// other labels are taken from document top level fields.
+func RenderPushRequest(documents []collection.Document, labelFields []string) (*PushRequest, error) {
+	var (
+		streams = make(map[string]*Stream)
+		keys    = make([]string, 0)
+	)
+	for _, doc := range documents {
+		labels, err := renderLabels(doc, labelFields)
+		if err != nil {
+			return nil, fmt.Errorf("renderLabels.%s", err)
+		}
+		key := labelsKey(labels)
+		stream, ok := streams[key]
+		if !ok {
+			stream = &Stream{
+				Labels: labels,
+				Values: make([][2]string, 0),
+			}
+			streams[key] = stream
+			keys = append(keys, key)
+		}
+		stream.Values = append(stream.Values, [2]string{
+			strconv.FormatInt(doc.PostedAt.UnixNano(), 10),
+			string(doc.Body),
+		})
+	}
+	request := &PushRequest{
+		Streams: make([]Stream, 0, len(keys)),
+	}
+	for _, key := range keys {
+		request.Streams = append(request.Streams, *streams[key])
+	}
+	return request, nil
+}
+
+func renderLabels(doc collection.Document, labelFields []string) (map[string]string, error) {
+	labels := map[string]string{
+		"collection": string(doc.CollectionName),
+		"schema":     string(doc.SchemaName),
+	}
+	if len(labelFields) == 0 {
+		return labels, nil
+	}
+	var body map[string]interface{}
+	err := json.Unmarshal(doc.Body, &body)
+	if err != nil {
+		return nil, fmt.Errorf("json.Unmarshal.%s", err)
+	}
+	for _, field := range labelFields {
+		value, ok := body[field]
+		if !ok || value == nil {
+			continue
+		}
+		switch v := value.(type) {
+		case string:
+			labels[field] = v
+		case map[string]interface{}, []interface{}:
+			continue
+		default:
+			labels[field] = fmt.Sprint(v)
+		}
+	}
+	return labels, nil
+}
+
+func labelsKey(labels map[string]string) string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var key strings.Builder
+	for _, name := range names {
+		key.WriteString(name)
+		key.WriteByte('=')
+		key.WriteString(labels[name])
+		key.WriteByte(',')
+	}
+	return key.String()
+}
@@ -0,0 +1,52 @@
+package opensearch
+
+import (
+	"github.com/khezen/bulklog/pkg/auth"
+	"github.com/khezen/bulklog/pkg/output/elastic"
+)
+
+const (
+	// domainService - SigV4 service of Amazon OpenSearch Service domains
+	domainService = "es"
+	// serverlessService - SigV4 service of Amazon OpenSearch Serverless collections
+	serverlessService = "aoss"
+)
+
+// OpenSearch is a client for OpenSearch API, which is the one of elasticsearch 7:
+// documents are not typed and indices are mapped by composable templates
+type OpenSearch struct {
+	*elastic.Elastic
+}
+
+// New returns a opensearch as a output
+func New(cfg Config) *OpenSearch {
+	if cfg.Scheme == "" {
+		cfg.Scheme = "https"
+	}
+	var signer auth.Signer
+	switch {
+	case cfg.AWSAuth != nil:
+		service := domainService
+		if cfg.Serverless {
+			service = serverlessService
+		}
+		signer = auth.NewAWSSigner(*cfg.AWSAuth, service)
+	case cfg.BasicAuth != nil:
+		signer = auth.NewBasicSigner(*cfg.BasicAuth)
+	}
+	return &OpenSearch{
+		elastic.NewSigned(elastic.Config{
+			Endpoint:    cfg.Endpoint,
+			Scheme:      cfg.Scheme,
+			Shards:      cfg.Shards,
+			Index:       cfg.Index,
+			Indices:     cfg.Indices,
+			Template:    elastic.ComposableTemplate,
+			Dynamic:     cfg.Dynamic,
+			DataStream:  cfg.DataStream,
+			Compression: cfg.Compression,
+			ID:          cfg.ID,
+			OpType:      cfg.OpType,
+		}, signer),
+	}
+}
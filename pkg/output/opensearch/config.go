@@ -0,0 +1,31 @@
+package opensearch
+
+import (
+	"github.com/khezen/bulklog/pkg/auth"
+	"github.com/khezen/bulklog/pkg/collection"
+	"github.com/khezen/bulklog/pkg/output/compression"
+	"github.com/khezen/bulklog/pkg/output/elastic"
+)
+
+// Config -
+type Config struct {
+	Enabled    bool                                      `yaml:"enabled"`
+	Endpoint   string                                    `yaml:"endpoint"`
+	Scheme     string                                    `yaml:"scheme"`
+	Shards     int                                       `yaml:"shards"`
+	Index      elastic.IndexTemplate                     `yaml:"index"`
+	Indices    map[collection.Name]elastic.IndexTemplate `yaml:"indices"`
+	Dynamic    elastic.Dynamic                           `yaml:"dynamic"`
+	DataStream bool                                      `yaml:"data_stream"`
+	// AWSAuth signs requests with SigV4 for Amazon OpenSearch Service, credentials are looked up in the environment unless given
+	AWSAuth   *auth.AWSConfig   `yaml:"aws_auth,omitempty"`
+	BasicAuth *auth.BasicConfig `yaml:"basic_auth,omitempty"`
+	// Serverless - requests are signed for Amazon OpenSearch Serverless collections rather than domains
+	Serverless bool `yaml:"serverless"`
+	// Compression - Content-Encoding of bulk requests, none by default
+	Compression compression.Compression `yaml:"compression"`
+	// ID - template of the _id of documents, {id} by default
+	ID elastic.IDTemplate `yaml:"id"`
+	// OpType - index|create, the bulk action of documents, index by default and create for data streams
+	OpType elastic.OpType `yaml:"op_type"`
+}
@@ -0,0 +1,138 @@
+package otlp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/khezen/bulklog/pkg/collection"
+	"github.com/khezen/bulklog/pkg/grpc"
+	"github.com/khezen/bulklog/pkg/output/compression"
+	"github.com/khezen/bulklog/pkg/output/dryrun"
+	"github.com/khezen/bulklog/pkg/output/retry"
+)
+
+const (
+	// ProtocolHTTPJSON - OTLP/HTTP with JSON encoding
+	ProtocolHTTPJSON = "http/json"
+	// ProtocolHTTPProtobuf - OTLP/HTTP with protobuf encoding
+	ProtocolHTTPProtobuf = "http/protobuf"
+	// ProtocolGRPC - OTLP/gRPC
+	ProtocolGRPC = "grpc"
+
+	logsExportMethod = "/opentelemetry.proto.collector.logs.v1.LogsService/Export"
+)
+
+var (
+	// ErrUnsupportedProtocol -
+	ErrUnsupportedProtocol = errors.New("ErrUnsupportedProtocol - otlp protocol must be one of http/protobuf|http/json|grpc")
+)
+
+// OTLP exports documents as OpenTelemetry log records to a collector
+type OTLP struct {
+	protocol      string
+	logsEndpoint  string
+	headers       map[string]string
+	severityField string
+	collections   map[collection.Name]CollectionConfig
+	httpcli       http.Client
+	grpccli       *grpc.Client
+	compression   compression.Compression
+}
+
+// New returns OTLP as an output
+func New(cfg Config) (*OTLP, error) {
+	if cfg.Protocol == "" {
+		cfg.Protocol = ProtocolHTTPProtobuf
+	}
+	o := &OTLP{
+		protocol:      cfg.Protocol,
+		headers:       cfg.Headers,
+		severityField: cfg.SeverityField,
+		collections:   cfg.Collections,
+		compression:   cfg.Compression,
+	}
+	switch cfg.Protocol {
+	case ProtocolHTTPJSON, ProtocolHTTPProtobuf:
+		scheme := "https"
+		if cfg.Insecure {
+			scheme = "http"
+		}
+		o.logsEndpoint = fmt.Sprintf("%s://%s/v1/logs", scheme, cfg.Endpoint)
+		o.httpcli = http.Client{
+			Timeout: time.Minute,
+			Transport: dryrun.Transport(&http.Transport{
+				MaxIdleConns:    10,
+				IdleConnTimeout: 30 * time.Second,
+			}),
+		}
+	case ProtocolGRPC:
+		o.grpccli = grpc.NewClient(cfg.Endpoint, cfg.Insecure, nil, cfg.Headers)
+	default:
+		return nil, ErrUnsupportedProtocol
+	}
+	return o, nil
+}
+
+// Digest exports documents grouped by collection resource
+func (o *OTLP) Digest(ctx context.Context, documents []collection.Document) error {
+	request, err := RenderRequest(documents, o.collections, o.severityField)
+	if err != nil {
+		return fmt.Errorf("RenderRequest.%s", err)
+	}
+	switch o.protocol {
+	case ProtocolGRPC:
+		_, err = o.grpccli.Invoke(ctx, logsExportMethod, request.MarshalProto())
+		if err != nil {
+			return fmt.Errorf("Invoke.%s", err)
+		}
+		return nil
+	case ProtocolHTTPJSON:
+		body, err := json.Marshal(request)
+		if err != nil {
+			return fmt.Errorf("json.Marshal.%s", err)
+		}
+		return o.post(ctx, body, "application/json")
+	default:
+		return o.post(ctx, request.MarshalProto(), "application/x-protobuf")
+	}
+}
+
+func (o *OTLP) post(ctx context.Context, body []byte, contentType string) error {
+	body, err := o.compression.Encode(body)
+	if err != nil {
+		return fmt.Errorf("Encode.%s", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", o.logsEndpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("http.NewRequest.%s", err)
+	}
+	req.Header.Set("Content-Type", contentType)
+	o.compression.SetHeader(req)
+	for key, value := range o.headers {
+		req.Header.Set(key, value)
+	}
+	res, err := o.httpcli.Do(req)
+	if err != nil {
+		return fmt.Errorf("httpClient.Do.%s", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode >= 300 {
+		resBody, err := ioutil.ReadAll(res.Body)
+		if err != nil {
+			return fmt.Errorf("ioutil.ReadAll.%s", err)
+		}
+		return retry.FromResponse(res, fmt.Errorf("otlp: %s : %s", res.Status, resBody))
+	}
+	return nil
+}
+
+// Ensure - collectors need no provisioning
+func (o *OTLP) Ensure(ctx context.Context, collection *collection.Collection) error {
+	return nil
+}
@@ -0,0 +1,24 @@
+package otlp
+
+import (
+	"github.com/khezen/bulklog/pkg/collection"
+	"github.com/khezen/bulklog/pkg/output/compression"
+)
+
+// Config -
+type Config struct {
+	Enabled       bool                                 `yaml:"enabled"`
+	Endpoint      string                               `yaml:"endpoint"`
+	Protocol      string                               `yaml:"protocol"`
+	Insecure      bool                                 `yaml:"insecure"`
+	Headers       map[string]string                    `yaml:"headers"`
+	SeverityField string                               `yaml:"severity_field"`
+	Collections   map[collection.Name]CollectionConfig `yaml:"collections"`
+	// Compression - Content-Encoding of http/json and http/protobuf requests, none by default
+	Compression compression.Compression `yaml:"compression"`
+}
+
+// CollectionConfig - OTLP resource of a collection
+type CollectionConfig struct {
+	ResourceAttributes map[string]string `yaml:"resource_attributes"`
+}
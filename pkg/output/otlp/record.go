@@ -0,0 +1,102 @@
+package otlp
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/khezen/bulklog/pkg/collection"
+	"github.com/khezen/bulklog/pkg/otlp"
+	"github.com/khezen/bulklog/pkg/trace"
+)
+
+const scopeName = "github.com/khezen/bulklog"
+
+// RenderRequest groups documents into one ResourceLogs per collection.
+// service.name defaults to the collection name.
+func RenderRequest(documents []collection.Document, collections map[collection.Name]CollectionConfig, severityField string) (*otlp.ExportLogsServiceRequest, error) {
+	var (
+		resources = make(map[collection.Name]*otlp.ResourceLogs)
+		names     = make([]collection.Name, 0)
+	)
+	for _, doc := range documents {
+		record, err := RenderLogRecord(doc, severityField)
+		if err != nil {
+			return nil, fmt.Errorf("RenderLogRecord.%s", err)
+		}
+		resource, ok := resources[doc.CollectionName]
+		if !ok {
+			resource = &otlp.ResourceLogs{
+				Resource: otlp.Resource{
+					Attributes: renderResourceAttributes(doc.CollectionName, collections[doc.CollectionName]),
+				},
+				ScopeLogs: []otlp.ScopeLogs{{
+					Scope:      otlp.Scope{Name: scopeName},
+					LogRecords: make([]otlp.LogRecord, 0),
+				}},
+			}
+			resources[doc.CollectionName] = resource
+			names = append(names, doc.CollectionName)
+		}
+		resource.ScopeLogs[0].LogRecords = append(resource.ScopeLogs[0].LogRecords, *record)
+	}
+	request := &otlp.ExportLogsServiceRequest{
+		ResourceLogs: make([]otlp.ResourceLogs, 0, len(names)),
+	}
+	for _, name := range names {
+		request.ResourceLogs = append(request.ResourceLogs, *resources[name])
+	}
+	return request, nil
+}
+
+// RenderLogRecord maps the document body to a kvlist body,
+// collection, schema and document ID are set as attributes.
+// Records of traced documents carry the trace and span IDs of their buffering.
+func RenderLogRecord(doc collection.Document, severityField string) (*otlp.LogRecord, error) {
+	var body map[string]interface{}
+	err := json.Unmarshal(doc.Body, &body)
+	if err != nil {
+		return nil, fmt.Errorf("json.Unmarshal.%s", err)
+	}
+	bodyValue := otlp.FromInterface(body)
+	record := &otlp.LogRecord{
+		TimeUnixNano:         uint64(doc.PostedAt.UnixNano()),
+		ObservedTimeUnixNano: uint64(doc.PostedAt.UnixNano()),
+		Body:                 &bodyValue,
+		Attributes: []otlp.KeyValue{
+			{Key: "bulklog.collection", Value: otlp.StringValue(string(doc.CollectionName))},
+			{Key: "bulklog.schema", Value: otlp.StringValue(string(doc.SchemaName))},
+			{Key: "bulklog.document.id", Value: otlp.StringValue(doc.ID.String())},
+		},
+	}
+	if sc := trace.Parse(doc.TraceParent); sc.IsValid() {
+		record.TraceID = append(otlp.HexBytes{}, sc.TraceID[:]...)
+		record.SpanID = append(otlp.HexBytes{}, sc.SpanID[:]...)
+	}
+	if severityField != "" {
+		if level, ok := body[severityField].(string); ok {
+			record.SeverityText = level
+			record.SeverityNumber = otlp.SeverityNumber(level)
+		}
+	}
+	return record, nil
+}
+
+func renderResourceAttributes(name collection.Name, cfg CollectionConfig) []otlp.KeyValue {
+	attributes := map[string]string{
+		"service.name": string(name),
+	}
+	for key, value := range cfg.ResourceAttributes {
+		attributes[key] = value
+	}
+	keys := make([]string, 0, len(attributes))
+	for key := range attributes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	kvs := make([]otlp.KeyValue, 0, len(keys))
+	for _, key := range keys {
+		kvs = append(kvs, otlp.KeyValue{Key: key, Value: otlp.StringValue(attributes[key])})
+	}
+	return kvs
+}
@@ -0,0 +1,27 @@
+package partial
+
+import "fmt"
+
+// Error is returned by outputs which digested part of the documents only, it reports the ones which failed.
+// Documents which are not reported were digested.
+type Error struct {
+	Failures []Failure
+	// Total - documents of the try
+	Total int
+}
+
+// Failure - document which an output failed to digest
+type Failure struct {
+	// Index - position of the document in the ones of the try
+	Index int
+	// Permanent - retrying the document fails again, e.g. it does not match the index mapping
+	Permanent bool
+	Reason    string
+}
+
+func (e *Error) Error() string {
+	if len(e.Failures) == 0 {
+		return fmt.Sprintf("0/%d documents failed", e.Total)
+	}
+	return fmt.Sprintf("%d/%d documents failed, first: %s", len(e.Failures), e.Total, e.Failures[0].Reason)
+}
@@ -0,0 +1,157 @@
+package output
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/khezen/bulklog/pkg/collection"
+)
+
+// Pauses - outputs, and collections, whose deliveries wait until they are resumed.
+// They outlive outputs, so that outputs rebuilt by a reload stay paused.
+type Pauses struct {
+	sync.Mutex
+	outputs     map[string]*pause
+	collections map[collection.Name]*pause
+}
+
+type pause struct {
+	since   time.Time
+	resumed chan struct{}
+}
+
+// NewPauses - nothing is paused
+func NewPauses() *Pauses {
+	return &Pauses{
+		outputs:     make(map[string]*pause),
+		collections: make(map[collection.Name]*pause),
+	}
+}
+
+// PauseOutput holds deliveries to an output, it returns when it was paused, earlier if it was paused already
+func (p *Pauses) PauseOutput(outputName string) time.Time {
+	p.Lock()
+	defer p.Unlock()
+	return pauseOf(p.outputs, outputName).since
+}
+
+// ResumeOutput lets deliveries held for an output go, it returns false if the output was not paused
+func (p *Pauses) ResumeOutput(outputName string) bool {
+	p.Lock()
+	defer p.Unlock()
+	return resume(p.outputs, outputName)
+}
+
+// PauseCollection holds deliveries of the documents of a collection to every output
+func (p *Pauses) PauseCollection(collectionName collection.Name) time.Time {
+	p.Lock()
+	defer p.Unlock()
+	return pauseOf(p.collections, collectionName).since
+}
+
+// ResumeCollection lets deliveries held for a collection go, it returns false if the collection was not paused
+func (p *Pauses) ResumeCollection(collectionName collection.Name) bool {
+	p.Lock()
+	defer p.Unlock()
+	return resume(p.collections, collectionName)
+}
+
+// PausedOutputs - when paused outputs were paused, by output name
+func (p *Pauses) PausedOutputs() map[string]time.Time {
+	p.Lock()
+	defer p.Unlock()
+	paused := make(map[string]time.Time, len(p.outputs))
+	for outputName, pause := range p.outputs {
+		paused[outputName] = pause.since
+	}
+	return paused
+}
+
+// Await returns once neither the output nor the collection is paused, or ctx error once it is done
+func (p *Pauses) Await(ctx context.Context, outputName string, collectionName collection.Name) error {
+	for {
+		p.Lock()
+		pause, ok := p.outputs[outputName]
+		if !ok {
+			pause, ok = p.collections[collectionName]
+		}
+		p.Unlock()
+		if !ok {
+			return nil
+		}
+		select {
+		case <-pause.resumed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func pauseOf[K comparable](pauses map[K]*pause, key K) *pause {
+	if paused, ok := pauses[key]; ok {
+		return paused
+	}
+	paused := &pause{
+		since:   time.Now().UTC(),
+		resumed: make(chan struct{}),
+	}
+	pauses[key] = paused
+	return paused
+}
+
+func resume[K comparable](pauses map[K]*pause, key K) bool {
+	paused, ok := pauses[key]
+	if !ok {
+		return false
+	}
+	close(paused.resumed)
+	delete(pauses, key)
+	return true
+}
+
+// Gate holds the tries of an output while it, or the collection of the documents tried, is paused.
+// Callers await it before a try starts, so that the time spent paused does not count in the try timeout.
+type Gate struct {
+	Interface
+	name   string
+	pauses *Pauses
+}
+
+// NewGate holds the tries of out, named outputName, as pauses tell
+func NewGate(out Interface, outputName string, pauses *Pauses) *Gate {
+	return &Gate{
+		Interface: out,
+		name:      outputName,
+		pauses:    pauses,
+	}
+}
+
+// NewGates gates every output
+func NewGates(outputs map[string]Interface, pauses *Pauses) map[string]Interface {
+	gated := make(map[string]Interface, len(outputs))
+	for outputName, out := range outputs {
+		gated[outputName] = NewGate(out, outputName, pauses)
+	}
+	return gated
+}
+
+// Await returns once the output can try documents of collectionName
+func (g *Gate) Await(ctx context.Context, collectionName collection.Name) error {
+	return g.pauses.Await(ctx, g.name, collectionName)
+}
+
+// PausedSince - when the output was paused, false if it is not
+func (g *Gate) PausedSince() (time.Time, bool) {
+	g.pauses.Lock()
+	defer g.pauses.Unlock()
+	paused, ok := g.pauses.outputs[g.name]
+	if !ok {
+		return time.Time{}, false
+	}
+	return paused.since, true
+}
+
+func (g *Gate) unwrap() Interface {
+	return g.Interface
+}
@@ -0,0 +1,127 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/khezen/bulklog/pkg/collection"
+	"github.com/khezen/bulklog/pkg/plugin"
+)
+
+// Plugin is an output delegating requests to a plugin process, one at a time.
+// The process is started on the first request and again on the next one once it exited,
+// collections ensured so far being ensured again first.
+type Plugin struct {
+	sync.Mutex
+	cfg     plugin.Config
+	process *plugin.Process
+	lastID  uint64
+	ensured map[collection.Name]*collectionInfo
+}
+
+// New returns the plugin as an output
+func New(cfg Config) (*Plugin, error) {
+	err := cfg.Validate()
+	if err != nil {
+		return nil, err
+	}
+	return &Plugin{
+		cfg:     cfg.Config,
+		ensured: make(map[collection.Name]*collectionInfo),
+	}, nil
+}
+
+// Digest sends documents to the plugin
+func (p *Plugin) Digest(ctx context.Context, documents []collection.Document) error {
+	docs, err := newDocuments(documents)
+	if err != nil {
+		return fmt.Errorf("newDocuments.%s", err)
+	}
+	return p.request(ctx, request{Method: methodDigest, Documents: docs})
+}
+
+// Ensure tells the plugin about the collection
+func (p *Plugin) Ensure(ctx context.Context, c *collection.Collection) error {
+	info := newCollection(c)
+	err := p.request(ctx, request{Method: methodEnsure, Collection: info})
+	if err != nil {
+		return err
+	}
+	p.Lock()
+	p.ensured[c.Name] = info
+	p.Unlock()
+	return nil
+}
+
+// Ping starts the plugin if needed and checks it answers
+func (p *Plugin) Ping(ctx context.Context) error {
+	return p.request(ctx, request{Method: methodPing})
+}
+
+func (p *Plugin) request(ctx context.Context, req request) error {
+	p.Lock()
+	defer p.Unlock()
+	if p.process != nil {
+		select {
+		case <-p.process.Exited():
+			p.process = nil
+		default:
+		}
+	}
+	if p.process == nil {
+		process, err := plugin.Start(p.cfg)
+		if err != nil {
+			return fmt.Errorf("plugin.Start.%s", err)
+		}
+		p.process = process
+		for _, info := range p.ensured {
+			err = p.roundTrip(ctx, request{Method: methodEnsure, Collection: info})
+			if err != nil {
+				// the process is started again by the next request
+				p.process.Kill()
+				p.process = nil
+				return fmt.Errorf("ensure(%s).%s", info.Name, err)
+			}
+		}
+	}
+	return p.roundTrip(ctx, req)
+}
+
+// roundTrip sends the request to the running process and waits for its response
+func (p *Plugin) roundTrip(ctx context.Context, req request) error {
+	p.lastID++
+	req.ID = p.lastID
+	line, err := json.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("json.Marshal.%s", err)
+	}
+	err = p.process.Write(line)
+	if err != nil {
+		return fmt.Errorf("Write.%s", err)
+	}
+	for {
+		select {
+		case line := <-p.process.Lines():
+			var res response
+			err = json.Unmarshal(line, &res)
+			if err != nil {
+				return fmt.Errorf("json.Unmarshal.%s", err)
+			}
+			// responses to requests given up on are discarded
+			if res.ID != req.ID {
+				continue
+			}
+			if res.Error != "" {
+				return errors.New(res.Error)
+			}
+			return nil
+		case <-p.process.Exited():
+			return p.process.Err()
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
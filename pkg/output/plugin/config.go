@@ -0,0 +1,8 @@
+package plugin
+
+import "github.com/khezen/bulklog/pkg/plugin"
+
+// Config -
+type Config struct {
+	plugin.Config `yaml:",inline"`
+}
@@ -0,0 +1,79 @@
+package plugin
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/khezen/bulklog/pkg/collection"
+)
+
+// methods of requests sent to plugins
+const (
+	methodEnsure = "ensure"
+	methodDigest = "digest"
+	methodPing   = "ping"
+)
+
+// request - line written to the plugin stdin
+type request struct {
+	ID         uint64          `json:"id"`
+	Method     string          `json:"method"`
+	Collection *collectionInfo `json:"collection,omitempty"`
+	Documents  []document      `json:"documents,omitempty"`
+}
+
+// response - line the plugin writes to stdout once done with the request of the same id
+type response struct {
+	ID    uint64 `json:"id"`
+	Error string `json:"error"`
+}
+
+type collectionInfo struct {
+	Name    collection.Name                            `json:"name"`
+	Schemas map[collection.SchemaName]map[string]field `json:"schemas"`
+}
+
+type field struct {
+	Type       collection.FieldType `json:"type"`
+	Length     int                  `json:"length,omitempty"`
+	MaxLength  int                  `json:"max_length,omitempty"`
+	DateFormat string               `json:"date_format,omitempty"`
+	Required   bool                 `json:"required,omitempty"`
+}
+
+type document struct {
+	ID         string                `json:"id"`
+	PostedAt   time.Time             `json:"posted_at"`
+	Collection collection.Name       `json:"collection"`
+	Schema     collection.SchemaName `json:"schema"`
+	Body       json.RawMessage       `json:"body"`
+}
+
+func newCollection(c *collection.Collection) *collectionInfo {
+	rendered := &collectionInfo{c.Name, make(map[collection.SchemaName]map[string]field, len(c.Schemas))}
+	for _, schema := range c.Schemas {
+		fields := make(map[string]field, len(schema.Fields))
+		for name, f := range schema.Fields {
+			fields[name] = field{f.Type, f.Length, f.MaxLength, f.DateFormat, f.Required}
+		}
+		rendered.Schemas[schema.Name] = fields
+	}
+	return rendered
+}
+
+func newDocuments(documents []collection.Document) ([]document, error) {
+	rendered := make([]document, 0, len(documents))
+	for _, doc := range documents {
+		body := json.RawMessage(doc.Body)
+		if !json.Valid(doc.Body) {
+			// bodies which are not JSON are sent as strings
+			var err error
+			body, err = json.Marshal(string(doc.Body))
+			if err != nil {
+				return nil, err
+			}
+		}
+		rendered = append(rendered, document{doc.ID.String(), doc.PostedAt, doc.CollectionName, doc.SchemaName, body})
+	}
+	return rendered, nil
+}
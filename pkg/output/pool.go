@@ -0,0 +1,188 @@
+package output
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/khezen/bulklog/pkg/collection"
+)
+
+var (
+	// ErrPoolFull - every worker of the output is busy and its queue is full
+	ErrPoolFull = errors.New("ErrPoolFull - output worker pool queue is full")
+	// ErrWrongPool - worker pool settings are invalid
+	ErrWrongPool = errors.New("ErrWrongPool - pool workers and queue must be >= 0")
+)
+
+// PoolConfig - worker pool of every output, disabled unless workers is set
+type PoolConfig struct {
+	Workers int `yaml:"workers"`
+	Queue   int `yaml:"queue"`
+}
+
+// Enabled - whether outputs digest through a worker pool
+func (c PoolConfig) Enabled() bool {
+	return c.Workers > 0
+}
+
+// Validate reports invalid worker pool settings
+func (c PoolConfig) Validate() error {
+	if c.Workers < 0 || c.Queue < 0 {
+		return ErrWrongPool
+	}
+	return nil
+}
+
+// PoolState - worker pool usage of an output
+type PoolState struct {
+	Workers int `json:"workers"`
+	Busy    int `json:"busy"`
+	Queued  int `json:"queued"`
+	// QueuedByPriority - tries waiting for a worker by collection priority
+	QueuedByPriority map[collection.Priority]int `json:"queued_by_priority,omitempty"`
+	// Rejected - tries which failed with ErrPoolFull since the pool was created
+	Rejected int64 `json:"rejected"`
+}
+
+// Pool bounds how many tries an output digests at once, tries of any collection and pipe wait in a queue for a worker.
+// Workers are handed to queued tries by a weighted round robin over the priority of their collection, FIFO within a priority.
+// The queue is unbounded unless maxQueued is set, tries beyond it fail with ErrPoolFull.
+type Pool struct {
+	Interface
+	sync.Mutex
+	workers   int
+	busy      int
+	maxQueued int
+	queued    int
+	queues    map[collection.Priority][]chan struct{}
+	// credits - smooth weighted round robin state, by priority
+	credits  map[collection.Priority]int
+	rejected int64
+}
+
+// NewPool bounds out to workers concurrent tries
+func NewPool(out Interface, workers, maxQueued int) *Pool {
+	return &Pool{
+		Interface: out,
+		workers:   workers,
+		maxQueued: maxQueued,
+		queues:    make(map[collection.Priority][]chan struct{}, len(collection.Priorities)),
+		credits:   make(map[collection.Priority]int, len(collection.Priorities)),
+	}
+}
+
+// Digest waits for a worker, as long as ctx allows, then digests documents with it.
+// Tries wait with the priority ctx carries.
+func (p *Pool) Digest(ctx context.Context, documents []collection.Document) error {
+	err := p.acquire(ctx, collection.PriorityFrom(ctx))
+	if err != nil {
+		return err
+	}
+	defer p.release()
+	return p.Interface.Digest(ctx, documents)
+}
+
+func (p *Pool) acquire(ctx context.Context, priority collection.Priority) error {
+	p.Lock()
+	if p.busy < p.workers && p.queued == 0 {
+		p.busy++
+		p.Unlock()
+		return nil
+	}
+	if p.maxQueued > 0 && p.queued >= p.maxQueued {
+		p.rejected++
+		p.Unlock()
+		return ErrPoolFull
+	}
+	ready := make(chan struct{})
+	p.queues[priority] = append(p.queues[priority], ready)
+	p.queued++
+	p.Unlock()
+	select {
+	case <-ready:
+		return nil
+	case <-ctx.Done():
+	}
+	p.Lock()
+	defer p.Unlock()
+	for i, waiting := range p.queues[priority] {
+		if waiting == ready {
+			p.queues[priority] = append(p.queues[priority][:i], p.queues[priority][i+1:]...)
+			p.queued--
+			return ctx.Err()
+		}
+	}
+	// handed a worker meanwhile, hand it over to the next try
+	p.handOver()
+	return ctx.Err()
+}
+
+func (p *Pool) release() {
+	p.Lock()
+	defer p.Unlock()
+	p.handOver()
+}
+
+// handOver hands the worker of a try which is done to the next queued try, if any
+func (p *Pool) handOver() {
+	priority, ok := p.next()
+	if !ok {
+		p.busy--
+		return
+	}
+	ready := p.queues[priority][0]
+	p.queues[priority] = p.queues[priority][1:]
+	p.queued--
+	close(ready)
+}
+
+// next picks the priority of the next try to hand a worker to, by smooth weighted round robin over the priorities which have queued tries
+func (p *Pool) next() (collection.Priority, bool) {
+	var (
+		picked collection.Priority
+		total  int
+		found  bool
+	)
+	for _, priority := range collection.Priorities {
+		if len(p.queues[priority]) == 0 {
+			continue
+		}
+		p.credits[priority] += priority.Weight()
+		total += priority.Weight()
+		if !found || p.credits[priority] > p.credits[picked] {
+			picked = priority
+			found = true
+		}
+	}
+	if found {
+		p.credits[picked] -= total
+	}
+	return picked, found
+}
+
+func (p *Pool) unwrap() Interface {
+	return p.Interface
+}
+
+// State reports the worker pool usage
+func (p *Pool) State() PoolState {
+	p.Lock()
+	defer p.Unlock()
+	state := PoolState{
+		Workers:  p.workers,
+		Busy:     p.busy,
+		Queued:   p.queued,
+		Rejected: p.rejected,
+	}
+	for priority, queue := range p.queues {
+		if len(queue) == 0 {
+			continue
+		}
+		if state.QueuedByPriority == nil {
+			state.QueuedByPriority = make(map[collection.Priority]int, len(p.queues))
+		}
+		state.QueuedByPriority[priority] = len(queue)
+	}
+	return state
+}
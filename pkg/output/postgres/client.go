@@ -0,0 +1,251 @@
+package postgres
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/khezen/bulklog/pkg/collection"
+	wire "github.com/khezen/bulklog/pkg/postgres"
+)
+
+const (
+	defaultMaxIdleConns = 2
+	// insertBatchSize bounds the rows of an INSERT statement
+	insertBatchSize = 1000
+)
+
+var (
+	// ErrUnknownCollection - Digest has been called before Ensure
+	ErrUnknownCollection = errors.New("ErrUnknownCollection - collection has not been ensured")
+	// ErrUnsupportedMode -
+	ErrUnsupportedMode = errors.New("ErrUnsupportedMode - postgres mode must be one of copy|insert")
+	// ErrInvalidCA -
+	ErrInvalidCA = errors.New("ErrInvalidCA - no certificate could be parsed from CA file")
+)
+
+// Postgres writes documents to a table per collection, through COPY or multi-row INSERT statements
+type Postgres struct {
+	sync.RWMutex
+	connCfg      wire.Config
+	schema       string
+	tableNames   map[collection.Name]string
+	indexes      map[collection.Name][]string
+	bodyColumn   string
+	createTables bool
+	hypertables  bool
+	copy         bool
+	idle         chan *wire.Conn
+	tables       map[collection.Name]*Table
+}
+
+// New returns postgres as an output
+func New(cfg Config) (*Postgres, error) {
+	if cfg.BodyColumn == "" {
+		cfg.BodyColumn = defaultBodyColumn
+	}
+	if cfg.MaxIdleConns <= 0 {
+		cfg.MaxIdleConns = defaultMaxIdleConns
+	}
+	var copyMode bool
+	switch cfg.Mode {
+	case "copy", "":
+		copyMode = true
+	case "insert":
+		copyMode = false
+	default:
+		return nil, ErrUnsupportedMode
+	}
+	connCfg := wire.Config{
+		Address:  cfg.Endpoint,
+		Database: cfg.Database,
+		Username: cfg.Username,
+		Password: cfg.Password,
+	}
+	if cfg.TLS != nil {
+		tlsConfig, err := newTLSConfig(*cfg.TLS, cfg.Endpoint)
+		if err != nil {
+			return nil, fmt.Errorf("newTLSConfig.%s", err)
+		}
+		connCfg.TLS = tlsConfig
+	}
+	return &Postgres{
+		connCfg:      connCfg,
+		schema:       cfg.Schema,
+		tableNames:   cfg.Tables,
+		indexes:      cfg.Indexes,
+		bodyColumn:   cfg.BodyColumn,
+		createTables: cfg.CreateTables,
+		hypertables:  cfg.Hypertables,
+		copy:         copyMode,
+		idle:         make(chan *wire.Conn, cfg.MaxIdleConns),
+		tables:       make(map[collection.Name]*Table),
+	}, nil
+}
+
+func newTLSConfig(cfg TLSConfig, endpoint string) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		ServerName:         cfg.ServerName,
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+	}
+	if tlsConfig.ServerName == "" {
+		host, _, err := net.SplitHostPort(endpoint)
+		if err != nil {
+			host = endpoint
+		}
+		tlsConfig.ServerName = host
+	}
+	if cfg.CAFile != "" {
+		caBytes, err := ioutil.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("ioutil.ReadFile.%s", err)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(caBytes) {
+			return nil, ErrInvalidCA
+		}
+	}
+	if cfg.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("tls.LoadX509KeyPair.%s", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+// Ping runs an empty query
+func (p *Postgres) Ping(ctx context.Context) error {
+	return p.exec(ctx, func(conn *wire.Conn) error {
+		return conn.Exec(ctx, "SELECT 1")
+	})
+}
+
+// Digest writes documents in a single transaction per collection
+func (p *Postgres) Digest(ctx context.Context, documents []collection.Document) error {
+	groups := make(map[collection.Name][]collection.Document)
+	for _, doc := range documents {
+		groups[doc.CollectionName] = append(groups[doc.CollectionName], doc)
+	}
+	for collectionName, group := range groups {
+		p.RLock()
+		table, ok := p.tables[collectionName]
+		p.RUnlock()
+		if !ok {
+			return ErrUnknownCollection
+		}
+		var err error
+		if p.copy {
+			err = p.copyDocuments(ctx, table, group)
+		} else {
+			err = p.insertDocuments(ctx, table, group)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *Postgres) copyDocuments(ctx context.Context, table *Table, documents []collection.Document) error {
+	rows, err := table.CopyRows(documents)
+	if err != nil {
+		return fmt.Errorf("CopyRows.%s", err)
+	}
+	begin, copyStmt, insert := table.CopyStatements()
+	return p.exec(ctx, func(conn *wire.Conn) error {
+		err := conn.Exec(ctx, begin)
+		if err != nil {
+			return fmt.Errorf("Exec(begin).%s", err)
+		}
+		err = conn.CopyIn(ctx, copyStmt, rows)
+		if err != nil {
+			return fmt.Errorf("CopyIn.%s", err)
+		}
+		err = conn.Exec(ctx, insert)
+		if err != nil {
+			return fmt.Errorf("Exec(insert).%s", err)
+		}
+		return nil
+	})
+}
+
+func (p *Postgres) insertDocuments(ctx context.Context, table *Table, documents []collection.Document) error {
+	stmts := make([]string, 0, len(documents)/insertBatchSize+1)
+	for i := 0; i < len(documents); i += insertBatchSize {
+		end := i + insertBatchSize
+		if end > len(documents) {
+			end = len(documents)
+		}
+		stmt, err := table.InsertStatement(documents[i:end])
+		if err != nil {
+			return fmt.Errorf("InsertStatement.%s", err)
+		}
+		stmts = append(stmts, stmt)
+	}
+	return p.exec(ctx, func(conn *wire.Conn) error {
+		// statements of a simple query run in a single transaction
+		err := conn.Exec(ctx, strings.Join(stmts, "; "))
+		if err != nil {
+			return fmt.Errorf("Exec.%s", err)
+		}
+		return nil
+	})
+}
+
+// Ensure maps collection schemas to table columns and optionally creates the table, its new columns and indexes
+func (p *Postgres) Ensure(ctx context.Context, collec *collection.Collection) error {
+	name, ok := p.tableNames[collec.Name]
+	if !ok {
+		name = string(collec.Name)
+	}
+	name = quoteIdentifier(name)
+	if p.schema != "" {
+		name = fmt.Sprintf("%s.%s", quoteIdentifier(p.schema), name)
+	}
+	table := NewTable(name, collec, p.bodyColumn, p.indexes[collec.Name])
+	if p.createTables {
+		err := p.exec(ctx, func(conn *wire.Conn) error {
+			return conn.Exec(ctx, strings.Join(table.CreateStatements(p.hypertables), "; "))
+		})
+		if err != nil {
+			return fmt.Errorf("exec.%s", err)
+		}
+	}
+	p.Lock()
+	p.tables[collec.Name] = table
+	p.Unlock()
+	return nil
+}
+
+// exec runs do on an idle connection, or a new one; connections are closed once do fails, whatever their state
+func (p *Postgres) exec(ctx context.Context, do func(conn *wire.Conn) error) error {
+	var conn *wire.Conn
+	select {
+	case conn = <-p.idle:
+	default:
+		var err error
+		conn, err = wire.Dial(ctx, p.connCfg)
+		if err != nil {
+			return fmt.Errorf("postgres.Dial.%s", err)
+		}
+	}
+	err := do(conn)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	select {
+	case p.idle <- conn:
+	default:
+		conn.Close()
+	}
+	return nil
+}
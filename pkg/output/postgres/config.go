@@ -0,0 +1,36 @@
+package postgres
+
+import "github.com/khezen/bulklog/pkg/collection"
+
+// Config -
+type Config struct {
+	Enabled  bool   `yaml:"enabled"`
+	Endpoint string `yaml:"endpoint"`
+	Database string `yaml:"database"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	// Schema - postgres schema of the tables, search_path unless set
+	Schema string                     `yaml:"schema"`
+	Tables map[collection.Name]string `yaml:"tables"`
+	// Indexes - fields indexed by collection, created along with tables
+	Indexes map[collection.Name][]string `yaml:"indexes"`
+	// BodyColumn - JSONB column holding the whole document, body by default
+	BodyColumn   string `yaml:"body_column"`
+	CreateTables bool   `yaml:"create_tables"`
+	// Hypertables - tables are TimescaleDB hypertables partitioned on posted_at
+	Hypertables bool `yaml:"hypertables"`
+	// Mode - copy|insert, copy by default
+	Mode string `yaml:"mode"`
+	// MaxIdleConns - connections kept open between digests, 2 by default
+	MaxIdleConns int        `yaml:"max_idle_conns"`
+	TLS          *TLSConfig `yaml:"tls,omitempty"`
+}
+
+// TLSConfig - connections are encrypted and the server certificate verified unless insecure_skip_verify
+type TLSConfig struct {
+	CAFile             string `yaml:"ca_file"`
+	CertFile           string `yaml:"cert_file"`
+	KeyFile            string `yaml:"key_file"`
+	ServerName         string `yaml:"server_name"`
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify"`
+}
@@ -0,0 +1,262 @@
+package postgres
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/khezen/bulklog/pkg/collection"
+)
+
+const (
+	idColumn          = "id"
+	postedAtColumn    = "posted_at"
+	schemaColumn      = "schema"
+	defaultBodyColumn = "body"
+	// copyTable - temporary table documents are copied to, before they are inserted skipping the ones already delivered
+	copyTable = "bulklog_copy"
+)
+
+// Table - postgres table of a collection: document metadata, the JSONB body, and a column per schema field
+type Table struct {
+	Name       string
+	Columns    map[string]collection.Field
+	BodyColumn string
+	Indexes    []string
+}
+
+// NewTable maps every schema field of the collection to a column, but the ones named as metadata columns
+func NewTable(name string, collec *collection.Collection, bodyColumn string, indexes []string) *Table {
+	columns := make(map[string]collection.Field)
+	for _, schema := range collec.Schemas {
+		for key, field := range schema.Fields {
+			switch key {
+			case idColumn, postedAtColumn, schemaColumn, bodyColumn:
+				continue
+			}
+			columns[key] = field
+		}
+	}
+	return &Table{name, columns, bodyColumn, indexes}
+}
+
+// CreateStatements render CREATE TABLE IF NOT EXISTS, columns added to schemas since, and indexes
+func (t *Table) CreateStatements(hypertable bool) []string {
+	var stmt strings.Builder
+	fmt.Fprintf(&stmt, "CREATE TABLE IF NOT EXISTS %s (%s uuid NOT NULL, %s timestamptz NOT NULL, %s text NOT NULL, %s jsonb NOT NULL",
+		t.Name, quoteIdentifier(idColumn), quoteIdentifier(postedAtColumn), quoteIdentifier(schemaColumn), quoteIdentifier(t.BodyColumn))
+	for _, key := range t.columnNames() {
+		fmt.Fprintf(&stmt, ", %s %s", quoteIdentifier(key), translateType(t.Columns[key]))
+	}
+	// hypertable unique indexes must hold the partitioning column
+	fmt.Fprintf(&stmt, ", PRIMARY KEY (%s, %s))", quoteIdentifier(idColumn), quoteIdentifier(postedAtColumn))
+	stmts := []string{stmt.String()}
+	for _, key := range t.columnNames() {
+		stmts = append(stmts, fmt.Sprintf("ALTER TABLE %s ADD COLUMN IF NOT EXISTS %s %s", t.Name, quoteIdentifier(key), translateType(t.Columns[key])))
+	}
+	if hypertable {
+		stmts = append(stmts, fmt.Sprintf("SELECT create_hypertable(%s, %s, if_not_exists => TRUE, migrate_data => TRUE)", quoteLiteral(t.Name), quoteLiteral(postedAtColumn)))
+	} else {
+		stmts = append(stmts, t.indexStatement(postedAtColumn))
+	}
+	for _, key := range t.Indexes {
+		stmts = append(stmts, t.indexStatement(key))
+	}
+	return stmts
+}
+
+func (t *Table) indexStatement(column string) string {
+	// index names are not qualified, they belong to the schema of the table
+	name := t.Name[strings.LastIndexByte(t.Name, '.')+1:]
+	name = strings.Trim(name, `"`)
+	return fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s ON %s (%s)", quoteIdentifier(fmt.Sprintf("%s_%s_idx", name, column)), t.Name, quoteIdentifier(column))
+}
+
+// CopyStatements render the statements which copy documents to a temporary table then insert them,
+// so documents delivered by a previous try are skipped rather than failing the copy
+func (t *Table) CopyStatements() (begin, copy, insert string) {
+	columns := t.columnList()
+	begin = fmt.Sprintf("BEGIN; CREATE TEMP TABLE %s (LIKE %s INCLUDING DEFAULTS) ON COMMIT DROP", quoteIdentifier(copyTable), t.Name)
+	copy = fmt.Sprintf("COPY %s (%s) FROM STDIN", quoteIdentifier(copyTable), columns)
+	insert = fmt.Sprintf("INSERT INTO %s (%s) SELECT %s FROM %s ON CONFLICT DO NOTHING; COMMIT", t.Name, columns, columns, quoteIdentifier(copyTable))
+	return begin, copy, insert
+}
+
+// CopyRows renders documents in COPY text format
+func (t *Table) CopyRows(documents []collection.Document) ([]byte, error) {
+	var buf bytes.Buffer
+	for _, doc := range documents {
+		values, err := t.values(doc)
+		if err != nil {
+			return nil, fmt.Errorf("values.%s", err)
+		}
+		for i, value := range values {
+			if i > 0 {
+				buf.WriteByte('\t')
+			}
+			if value == nil {
+				buf.WriteString(`\N`)
+				continue
+			}
+			copyEscaper.WriteString(&buf, *value)
+		}
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes(), nil
+}
+
+// InsertStatement renders a multi-row INSERT, skipping documents delivered by a previous try
+func (t *Table) InsertStatement(documents []collection.Document) (string, error) {
+	var stmt strings.Builder
+	fmt.Fprintf(&stmt, "INSERT INTO %s (%s) VALUES ", t.Name, t.columnList())
+	for i, doc := range documents {
+		values, err := t.values(doc)
+		if err != nil {
+			return "", fmt.Errorf("values.%s", err)
+		}
+		if i > 0 {
+			stmt.WriteByte(',')
+		}
+		stmt.WriteByte('(')
+		for j, value := range values {
+			if j > 0 {
+				stmt.WriteByte(',')
+			}
+			if value == nil {
+				stmt.WriteString("NULL")
+				continue
+			}
+			stmt.WriteString(quoteLiteral(*value))
+		}
+		stmt.WriteByte(')')
+	}
+	stmt.WriteString(" ON CONFLICT DO NOTHING")
+	return stmt.String(), nil
+}
+
+// values - text of each column, nil for NULL.
+// Field values which do not match their column type are NULL, they are kept in the body column.
+func (t *Table) values(doc collection.Document) ([]*string, error) {
+	var body map[string]json.RawMessage
+	err := json.Unmarshal(doc.Body, &body)
+	if err != nil {
+		return nil, fmt.Errorf("json.Unmarshal.%s", err)
+	}
+	var (
+		id       = doc.ID.String()
+		postedAt = doc.PostedAt.UTC().Format(time.RFC3339Nano)
+		schema   = string(doc.SchemaName)
+		raw      = string(doc.Body)
+		names    = t.columnNames()
+		values   = make([]*string, 0, 4+len(names))
+	)
+	values = append(values, &id, &postedAt, &schema, &raw)
+	for _, key := range names {
+		values = append(values, fieldValue(body[key], t.Columns[key]))
+	}
+	return values, nil
+}
+
+func fieldValue(raw json.RawMessage, field collection.Field) *string {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil
+	}
+	var text string
+	switch field.Type {
+	case collection.Bool:
+		var b bool
+		if json.Unmarshal(raw, &b) != nil {
+			return nil
+		}
+		text = strconv.FormatBool(b)
+	case collection.UInt8, collection.UInt16, collection.UInt32, collection.UInt64:
+		if _, err := strconv.ParseUint(string(raw), 10, 64); err != nil {
+			return nil
+		}
+		text = string(raw)
+	case collection.Int8, collection.Int16, collection.Int32, collection.Int64:
+		if _, err := strconv.ParseInt(string(raw), 10, 64); err != nil {
+			return nil
+		}
+		text = string(raw)
+	case collection.Float32, collection.Float64:
+		if _, err := strconv.ParseFloat(string(raw), 64); err != nil {
+			return nil
+		}
+		text = string(raw)
+	case collection.DateTime:
+		var str string
+		if json.Unmarshal(raw, &str) != nil {
+			return nil
+		}
+		date, err := time.Parse(field.DateFormat, str)
+		if err != nil {
+			return nil
+		}
+		text = date.UTC().Format(time.RFC3339Nano)
+	case collection.Object:
+		text = string(raw)
+	default:
+		if json.Unmarshal(raw, &text) != nil {
+			return nil
+		}
+	}
+	return &text
+}
+
+func (t *Table) columnList() string {
+	columns := []string{quoteIdentifier(idColumn), quoteIdentifier(postedAtColumn), quoteIdentifier(schemaColumn), quoteIdentifier(t.BodyColumn)}
+	for _, key := range t.columnNames() {
+		columns = append(columns, quoteIdentifier(key))
+	}
+	return strings.Join(columns, ", ")
+}
+
+func (t *Table) columnNames() []string {
+	names := make([]string, 0, len(t.Columns))
+	for key := range t.Columns {
+		names = append(names, key)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func translateType(field collection.Field) string {
+	switch field.Type {
+	case collection.Bool:
+		return "boolean"
+	case collection.UInt8, collection.Int8, collection.Int16:
+		return "smallint"
+	case collection.UInt16, collection.Int32:
+		return "integer"
+	case collection.UInt32, collection.Int64:
+		return "bigint"
+	case collection.UInt64:
+		return "numeric(20)"
+	case collection.Float32:
+		return "real"
+	case collection.Float64:
+		return "double precision"
+	case collection.DateTime:
+		return "timestamptz"
+	case collection.Object:
+		return "jsonb"
+	default:
+		return "text"
+	}
+}
+
+var copyEscaper = strings.NewReplacer(`\`, `\\`, "\t", `\t`, "\n", `\n`, "\r", `\r`)
+
+func quoteIdentifier(name string) string {
+	return `"` + strings.Replace(name, `"`, `""`, -1) + `"`
+}
+
+// quoteLiteral renders an escape string constant, which does not depend on standard_conforming_strings
+func quoteLiteral(value string) string {
+	return "E'" + strings.NewReplacer(`\`, `\\`, `'`, `''`).Replace(value) + "'"
+}
@@ -0,0 +1,320 @@
+package pubsub
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/khezen/bulklog/pkg/auth"
+	"github.com/khezen/bulklog/pkg/codec"
+	"github.com/khezen/bulklog/pkg/collection"
+	"github.com/khezen/bulklog/pkg/output/archive"
+	"github.com/khezen/bulklog/pkg/output/dryrun"
+)
+
+const (
+	defaultEndpoint = "pubsub.googleapis.com"
+	scope           = "https://www.googleapis.com/auth/pubsub"
+	// maxMessages - messages of a publish request
+	maxMessages = 1000
+	// maxRequestBytes bounds the data of a publish request, which must not exceed 10MB once base64 encoded
+	maxRequestBytes = 7 * 1024 * 1024
+)
+
+var (
+	// ErrUnsupportedMode -
+	ErrUnsupportedMode = errors.New("ErrUnsupportedMode - pubsub mode must be one of document|batch")
+	// ErrMessageTooLarge - a document alone exceeds the size of a publish request
+	ErrMessageTooLarge = errors.New("ErrMessageTooLarge - pubsub message exceeds 7MiB")
+)
+
+// PubSub publishes documents, one message each or in NDJSON batches, to a topic
+type PubSub struct {
+	signer           auth.Signer
+	baseURL          string
+	topic            string
+	topics           map[collection.Name]string
+	batch            bool
+	orderingKeyField string
+	httpcli          http.Client
+	// deliveries - bodies of messages are converted to the delivery format of their collection, batches stay NDJSON
+	deliveries codec.Deliveries
+}
+
+// Message - ref: https://cloud.google.com/pubsub/docs/reference/rest/v1/PubsubMessage
+type Message struct {
+	Data        []byte            `json:"data"`
+	Attributes  map[string]string `json:"attributes,omitempty"`
+	OrderingKey string            `json:"orderingKey,omitempty"`
+}
+
+// PublishRequest - ref: https://cloud.google.com/pubsub/docs/reference/rest/v1/projects.topics/publish
+type PublishRequest struct {
+	Messages []Message `json:"messages"`
+}
+
+// PublishResponse -
+type PublishResponse struct {
+	MessageIDs []string `json:"messageIds"`
+}
+
+// New returns pubsub as an output
+func New(cfg Config) (*PubSub, error) {
+	var batch bool
+	switch cfg.Mode {
+	case "document", "":
+		batch = false
+	case "batch":
+		batch = true
+	default:
+		return nil, ErrUnsupportedMode
+	}
+	signer, err := auth.NewGoogleSigner(cfg.GoogleAuth, scope)
+	if err != nil {
+		return nil, fmt.Errorf("auth.NewGoogleSigner.%s", err)
+	}
+	if cfg.Endpoint == "" {
+		cfg.Endpoint = defaultEndpoint
+	}
+	return &PubSub{
+		signer,
+		fmt.Sprintf("https://%s/v1/projects/%s/topics", cfg.Endpoint, cfg.Project),
+		cfg.Topic,
+		cfg.Topics,
+		batch,
+		cfg.OrderingKeyField,
+		http.Client{
+			Timeout:   time.Minute,
+			Transport: dryrun.Transport(nil),
+		},
+		codec.Deliveries{},
+	}, nil
+}
+
+// Digest publishes the documents of each collection to its topic
+func (c *PubSub) Digest(ctx context.Context, documents []collection.Document) error {
+	var (
+		groups = make(map[collection.Name][]collection.Document)
+		names  = make([]collection.Name, 0)
+	)
+	for _, doc := range documents {
+		if _, ok := groups[doc.CollectionName]; !ok {
+			names = append(names, doc.CollectionName)
+		}
+		groups[doc.CollectionName] = append(groups[doc.CollectionName], doc)
+	}
+	for _, name := range names {
+		var (
+			messages []Message
+			err      error
+		)
+		if c.batch {
+			messages, err = c.renderBatches(groups[name])
+		} else {
+			messages, err = c.renderDocuments(groups[name])
+		}
+		if err != nil {
+			return fmt.Errorf("render.%s", err)
+		}
+		err = c.publish(ctx, c.topicID(name), messages)
+		if err != nil {
+			return fmt.Errorf("publish.%s", err)
+		}
+	}
+	return nil
+}
+
+// renderDocuments - a message per document, its body being the data
+func (c *PubSub) renderDocuments(documents []collection.Document) ([]Message, error) {
+	messages := make([]Message, 0, len(documents))
+	for _, doc := range documents {
+		key, err := c.orderingKey(doc)
+		if err != nil {
+			return nil, fmt.Errorf("orderingKey.%s", err)
+		}
+		data, err := c.deliveries.Deliver(doc)
+		if err != nil {
+			return nil, fmt.Errorf("Deliver.%s", err)
+		}
+		messages = append(messages, Message{
+			Data: data,
+			Attributes: map[string]string{
+				"id":         doc.ID.String(),
+				"collection": string(doc.CollectionName),
+				"schema":     string(doc.SchemaName),
+				"posted_at":  doc.PostedAt.UTC().Format(time.RFC3339Nano),
+			},
+			OrderingKey: key,
+		})
+	}
+	return messages, nil
+}
+
+// renderBatches - NDJSON messages of archive lines, one batch per ordering key, split once they reach the size of a request
+func (c *PubSub) renderBatches(documents []collection.Document) ([]Message, error) {
+	var (
+		keys  = make([]string, 0)
+		byKey = make(map[string][]collection.Document)
+	)
+	for _, doc := range documents {
+		key, err := c.orderingKey(doc)
+		if err != nil {
+			return nil, fmt.Errorf("orderingKey.%s", err)
+		}
+		if _, ok := byKey[key]; !ok {
+			keys = append(keys, key)
+		}
+		byKey[key] = append(byKey[key], doc)
+	}
+	messages := make([]Message, 0, len(keys))
+	for _, key := range keys {
+		var (
+			buf     bytes.Buffer
+			count   int
+			encoder = json.NewEncoder(&buf)
+			flush   = func() {
+				messages = append(messages, Message{
+					Data: append([]byte(nil), buf.Bytes()...),
+					Attributes: map[string]string{
+						"collection":   string(documents[0].CollectionName),
+						"content_type": "application/x-ndjson",
+						"documents":    strconv.Itoa(count),
+					},
+					OrderingKey: key,
+				})
+				buf.Reset()
+				count = 0
+			}
+		)
+		for _, doc := range byKey[key] {
+			size := buf.Len()
+			err := encoder.Encode(archive.Line{
+				ID:             doc.ID,
+				PostedAt:       doc.PostedAt.UTC().Format(time.RFC3339Nano),
+				CollectionName: doc.CollectionName,
+				SchemaName:     doc.SchemaName,
+				Body:           json.RawMessage(doc.Body),
+			})
+			if err != nil {
+				return nil, fmt.Errorf("json.Encode.%s", err)
+			}
+			if buf.Len() > maxRequestBytes && count > 0 {
+				line := append([]byte(nil), buf.Bytes()[size:]...)
+				buf.Truncate(size)
+				flush()
+				buf.Write(line)
+			}
+			count++
+		}
+		flush()
+	}
+	return messages, nil
+}
+
+// publish sends messages in requests of at most 1000 messages and 7MiB of data
+func (c *PubSub) publish(ctx context.Context, topicID string, messages []Message) error {
+	var (
+		request = make([]Message, 0)
+		size    int
+	)
+	for _, msg := range messages {
+		if len(msg.Data) > maxRequestBytes {
+			return ErrMessageTooLarge
+		}
+		if len(request) == maxMessages || size+len(msg.Data) > maxRequestBytes {
+			err := c.post(ctx, topicID, request)
+			if err != nil {
+				return err
+			}
+			request, size = request[:0], 0
+		}
+		request = append(request, msg)
+		size += len(msg.Data)
+	}
+	if len(request) == 0 {
+		return nil
+	}
+	return c.post(ctx, topicID, request)
+}
+
+func (c *PubSub) post(ctx context.Context, topicID string, messages []Message) error {
+	body, err := json.Marshal(PublishRequest{messages})
+	if err != nil {
+		return fmt.Errorf("json.Marshal.%s", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", fmt.Sprintf("%s/%s:publish", c.baseURL, topicID), bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("http.NewRequest.%s", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	err = c.signer.Sign(req, body)
+	if err != nil {
+		return fmt.Errorf("Sign.%s", err)
+	}
+	res, err := c.httpcli.Do(req)
+	if err != nil {
+		return fmt.Errorf("httpClient.Do.%s", err)
+	}
+	defer res.Body.Close()
+	resBody, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return fmt.Errorf("ioutil.ReadAll.%s", err)
+	}
+	if res.StatusCode >= 300 {
+		return fmt.Errorf("pubsub: %s : %s", res.Status, resBody)
+	}
+	var published PublishResponse
+	err = json.Unmarshal(resBody, &published)
+	if err != nil {
+		return fmt.Errorf("json.Unmarshal.%s", err)
+	}
+	if len(published.MessageIDs) != len(messages) {
+		return fmt.Errorf("pubsub: %d/%d messages published", len(published.MessageIDs), len(messages))
+	}
+	return nil
+}
+
+func (c *PubSub) topicID(collectionName collection.Name) string {
+	if topic, ok := c.topics[collectionName]; ok {
+		return topic
+	}
+	if c.topic != "" {
+		return c.topic
+	}
+	return string(collectionName)
+}
+
+func (c *PubSub) orderingKey(doc collection.Document) (string, error) {
+	if c.orderingKeyField == "" {
+		return "", nil
+	}
+	var body map[string]interface{}
+	err := json.Unmarshal(doc.Body, &body)
+	if err != nil {
+		return "", fmt.Errorf("json.Unmarshal.%s", err)
+	}
+	value, ok := body[c.orderingKeyField]
+	if !ok || value == nil {
+		return "", nil
+	}
+	if str, ok := value.(string); ok {
+		return str, nil
+	}
+	key, err := json.Marshal(value)
+	if err != nil {
+		return "", fmt.Errorf("json.Marshal.%s", err)
+	}
+	return string(key), nil
+}
+
+// Ensure - topics are expected to exist, the delivery format of the collection is recorded
+func (c *PubSub) Ensure(ctx context.Context, collection *collection.Collection) error {
+	c.deliveries.Ensure(collection)
+	return nil
+}
@@ -0,0 +1,22 @@
+package pubsub
+
+import (
+	"github.com/khezen/bulklog/pkg/auth"
+	"github.com/khezen/bulklog/pkg/collection"
+)
+
+// Config -
+type Config struct {
+	Enabled bool   `yaml:"enabled"`
+	Project string `yaml:"project"`
+	// Topic - topic ID of every collection, the collection name by default
+	Topic  string                     `yaml:"topic"`
+	Topics map[collection.Name]string `yaml:"topics"`
+	// Mode - document|batch, document by default
+	Mode string `yaml:"mode"`
+	// OrderingKeyField - document field used as ordering key
+	OrderingKeyField string `yaml:"ordering_key_field"`
+	// Endpoint - pubsub host, such as the regional endpoint europe-west1-pubsub.googleapis.com, pubsub.googleapis.com by default
+	Endpoint   string            `yaml:"endpoint"`
+	GoogleAuth auth.GoogleConfig `yaml:"google_auth"`
+}
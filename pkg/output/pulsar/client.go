@@ -0,0 +1,169 @@
+package pulsar
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/khezen/bulklog/pkg/codec"
+	"github.com/khezen/bulklog/pkg/collection"
+	wire "github.com/khezen/bulklog/pkg/pulsar"
+)
+
+const (
+	defaultTenant    = "public"
+	defaultNamespace = "default"
+)
+
+var (
+	// ErrInvalidCA -
+	ErrInvalidCA = errors.New("ErrInvalidCA - no certificate could be parsed from CA file")
+)
+
+// Pulsar publishes documents to a topic per collection
+type Pulsar struct {
+	producer    *wire.Producer
+	namespace   string
+	topicPrefix string
+	topics      map[collection.Name]string
+	keyField    string
+	// deliveries - payloads are converted to the delivery format of their collection
+	deliveries codec.Deliveries
+}
+
+// New returns pulsar as an output
+func New(cfg Config) (*Pulsar, error) {
+	if cfg.Tenant == "" {
+		cfg.Tenant = defaultTenant
+	}
+	if cfg.Namespace == "" {
+		cfg.Namespace = defaultNamespace
+	}
+	tlsConfig, err := newTLSConfig(cfg.TLS)
+	if err != nil {
+		return nil, fmt.Errorf("newTLSConfig.%s", err)
+	}
+	producer, err := wire.NewProducer(wire.ProducerConfig{
+		URL:         cfg.URL,
+		Token:       cfg.Token,
+		TLS:         tlsConfig,
+		Compression: cfg.Compression,
+		Batch: wire.BatchConfig{
+			MaxMessages: cfg.Batching.MaxMessages,
+			MaxBytes:    cfg.Batching.MaxBytes,
+			KeyBased:    cfg.Batching.KeyBased,
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("NewProducer.%s", err)
+	}
+	return &Pulsar{
+		producer:    producer,
+		namespace:   fmt.Sprintf("persistent://%s/%s/", cfg.Tenant, cfg.Namespace),
+		topicPrefix: cfg.TopicPrefix,
+		topics:      cfg.Topics,
+		keyField:    cfg.KeyField,
+	}, nil
+}
+
+func newTLSConfig(cfg TLSConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+	}
+	if cfg.CAFile != "" {
+		caBytes, err := ioutil.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("ioutil.ReadFile.%s", err)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(caBytes) {
+			return nil, ErrInvalidCA
+		}
+	}
+	if cfg.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("tls.LoadX509KeyPair.%s", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+// Digest publishes documents to pulsar
+func (c *Pulsar) Digest(ctx context.Context, documents []collection.Document) error {
+	topics := make(map[collection.Name][]wire.Message)
+	for _, doc := range documents {
+		key, err := c.key(doc)
+		if err != nil {
+			return fmt.Errorf("key.%s", err)
+		}
+		payload, err := c.deliveries.Deliver(doc)
+		if err != nil {
+			return fmt.Errorf("Deliver.%s", err)
+		}
+		topics[doc.CollectionName] = append(topics[doc.CollectionName], wire.Message{
+			Key:       key,
+			Payload:   payload,
+			EventTime: doc.PostedAt,
+		})
+	}
+	for collectionName, messages := range topics {
+		err := c.producer.Produce(ctx, c.topic(collectionName), messages)
+		if err != nil {
+			return fmt.Errorf("Produce.%s", err)
+		}
+	}
+	return nil
+}
+
+// topic - fully qualified topic name of a collection
+func (c *Pulsar) topic(collectionName collection.Name) string {
+	name, ok := c.topics[collectionName]
+	if !ok {
+		name = fmt.Sprintf("%s%s", c.topicPrefix, collectionName)
+	}
+	if strings.Contains(name, "://") {
+		return name
+	}
+	return c.namespace + name
+}
+
+func (c *Pulsar) key(doc collection.Document) (string, error) {
+	if c.keyField == "" {
+		return "", nil
+	}
+	var body map[string]interface{}
+	err := json.Unmarshal(doc.Body, &body)
+	if err != nil {
+		return "", fmt.Errorf("json.Unmarshal.%s", err)
+	}
+	value, ok := body[c.keyField]
+	if !ok || value == nil {
+		return "", nil
+	}
+	if str, ok := value.(string); ok {
+		return str, nil
+	}
+	key, err := json.Marshal(value)
+	if err != nil {
+		return "", fmt.Errorf("json.Marshal.%s", err)
+	}
+	return string(key), nil
+}
+
+// Ping checks the service URL is reachable
+func (c *Pulsar) Ping(ctx context.Context) error {
+	return c.producer.Ping(ctx)
+}
+
+// Ensure - topics are expected to exist or to be auto created by brokers, the delivery format of the collection is recorded
+func (c *Pulsar) Ensure(ctx context.Context, collection *collection.Collection) error {
+	c.deliveries.Ensure(collection)
+	return nil
+}
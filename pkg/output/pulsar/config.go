@@ -0,0 +1,41 @@
+package pulsar
+
+import (
+	"github.com/khezen/bulklog/pkg/collection"
+	wire "github.com/khezen/bulklog/pkg/pulsar"
+)
+
+// Config -
+type Config struct {
+	Enabled bool `yaml:"enabled"`
+	// URL - service URL, pulsar://host:6650 or pulsar+ssl://host:6651
+	URL string `yaml:"url"`
+	// Tenant - public by default
+	Tenant string `yaml:"tenant"`
+	// Namespace - default by default
+	Namespace   string `yaml:"namespace"`
+	TopicPrefix string `yaml:"topic_prefix"`
+	// Topics - topic names by collection, overriding {topic_prefix}{collection}; fully qualified names are kept as is
+	Topics map[collection.Name]string `yaml:"topics"`
+	// KeyField - document field used as partition key
+	KeyField    string           `yaml:"key_field"`
+	Token       string           `yaml:"token"`
+	Compression wire.Compression `yaml:"compression"`
+	Batching    BatchingConfig   `yaml:"batching"`
+	TLS         TLSConfig        `yaml:"tls"`
+}
+
+// BatchingConfig bounds the documents sent together as a single batch message
+type BatchingConfig struct {
+	MaxMessages int  `yaml:"max_messages"`
+	MaxBytes    int  `yaml:"max_bytes"`
+	KeyBased    bool `yaml:"key_based"`
+}
+
+// TLSConfig - settings of pulsar+ssl connections
+type TLSConfig struct {
+	CAFile             string `yaml:"ca_file"`
+	CertFile           string `yaml:"cert_file"`
+	KeyFile            string `yaml:"key_file"`
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify"`
+}
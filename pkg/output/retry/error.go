@@ -0,0 +1,59 @@
+package retry
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Error is returned by outputs whose destination asked to be retried no sooner than At, such as with a Retry-After header
+type Error struct {
+	Err error
+	At  time.Time
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// At - time err asks the failed try to be retried at, zero if it does not
+func At(err error) time.Time {
+	var retryErr *Error
+	if errors.As(err, &retryErr) {
+		return retryErr.At
+	}
+	return time.Time{}
+}
+
+// FromResponse returns err along with the Retry-After header of res, err as is if res has none
+func FromResponse(res *http.Response, err error) error {
+	at := Parse(res.Header.Get("Retry-After"), time.Now())
+	if at.IsZero() {
+		return err
+	}
+	return &Error{Err: err, At: at}
+}
+
+// Parse reads a Retry-After header given in seconds or as an HTTP date, zero if it is neither
+func Parse(value string, now time.Time) time.Time {
+	if value == "" {
+		return time.Time{}
+	}
+	seconds, err := strconv.Atoi(value)
+	if err == nil {
+		if seconds < 0 {
+			return time.Time{}
+		}
+		return now.Add(time.Duration(seconds) * time.Second)
+	}
+	at, err := http.ParseTime(value)
+	if err == nil {
+		return at
+	}
+	return time.Time{}
+}
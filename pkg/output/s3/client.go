@@ -0,0 +1,108 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/khezen/bulklog/pkg/auth"
+	"github.com/khezen/bulklog/pkg/collection"
+	"github.com/khezen/bulklog/pkg/output/archive"
+	"github.com/khezen/bulklog/pkg/output/dryrun"
+	"github.com/khezen/bulklog/pkg/output/idempotency"
+)
+
+// S3 archives documents as gzip compressed NDJSON objects
+type S3 struct {
+	signer  auth.Signer
+	baseURL string
+	prefix  string
+	httpcli http.Client
+}
+
+// New returns S3 as an output.
+// If endpoint is set, objects are written with path style requests to this S3 compatible store.
+func New(cfg Config) *S3 {
+	if cfg.Scheme == "" {
+		cfg.Scheme = "https"
+	}
+	var (
+		signer  auth.Signer
+		baseURL string
+	)
+	if cfg.AWSAuth != nil {
+		signer = auth.NewAWSSigner(*cfg.AWSAuth, "s3")
+	}
+	switch {
+	case cfg.Endpoint != "":
+		baseURL = fmt.Sprintf("%s://%s/%s", cfg.Scheme, cfg.Endpoint, cfg.Bucket)
+		break
+	case cfg.AWSAuth != nil && cfg.AWSAuth.Region != "":
+		baseURL = fmt.Sprintf("%s://%s.s3.%s.amazonaws.com", cfg.Scheme, cfg.Bucket, cfg.AWSAuth.Region)
+		break
+	default:
+		baseURL = fmt.Sprintf("%s://%s.s3.amazonaws.com", cfg.Scheme, cfg.Bucket)
+	}
+	return &S3{
+		signer,
+		baseURL,
+		cfg.Prefix,
+		http.Client{
+			Transport: dryrun.Transport(&http.Transport{
+				MaxIdleConns:    10,
+				IdleConnTimeout: 30 * time.Second,
+			}),
+		},
+	}
+}
+
+// Digest puts documents in S3
+func (c *S3) Digest(ctx context.Context, documents []collection.Document) error {
+	objects, err := archive.Render(c.prefix, idempotency.Pipe(ctx), documents)
+	if err != nil {
+		return fmt.Errorf("archive.Render.%s", err)
+	}
+	for _, object := range objects {
+		err = c.put(ctx, object)
+		if err != nil {
+			return fmt.Errorf("put.%s", err)
+		}
+	}
+	return nil
+}
+
+func (c *S3) put(ctx context.Context, object archive.Object) error {
+	req, err := http.NewRequestWithContext(ctx, "PUT", fmt.Sprintf("%s/%s", c.baseURL, object.Key), bytes.NewReader(object.Body))
+	if err != nil {
+		return fmt.Errorf("http.NewRequest.%s", err)
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	req.Header.Set("Content-Encoding", "gzip")
+	if c.signer != nil {
+		err = c.signer.Sign(req, object.Body)
+		if err != nil {
+			return fmt.Errorf("Sign.%s", err)
+		}
+	}
+	res, err := c.httpcli.Do(req)
+	if err != nil {
+		return fmt.Errorf("httpClient.Do.%s", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode >= 300 {
+		resBody, err := ioutil.ReadAll(res.Body)
+		if err != nil {
+			return fmt.Errorf("ioutil.ReadAll.%s", err)
+		}
+		return fmt.Errorf("s3: %s : %s", res.Status, resBody)
+	}
+	return nil
+}
+
+// Ensure - bucket is expected to exist
+func (c *S3) Ensure(ctx context.Context, collection *collection.Collection) error {
+	return nil
+}
@@ -0,0 +1,13 @@
+package s3
+
+import "github.com/khezen/bulklog/pkg/auth"
+
+// Config -
+type Config struct {
+	Enabled  bool            `yaml:"enabled"`
+	Bucket   string          `yaml:"bucket"`
+	Prefix   string          `yaml:"prefix"`
+	Endpoint string          `yaml:"endpoint"`
+	Scheme   string          `yaml:"scheme"`
+	AWSAuth  *auth.AWSConfig `yaml:"aws_auth,omitempty"`
+}
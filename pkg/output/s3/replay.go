@@ -0,0 +1,109 @@
+package s3
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/khezen/bulklog/pkg/collection"
+	"github.com/khezen/bulklog/pkg/output/archive"
+)
+
+// listBucketResult - page of a ListObjectsV2 response
+type listBucketResult struct {
+	Contents []struct {
+		Key string `xml:"Key"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+// Archived lists the objects of a collection in the hourly partitions between from and to
+func (c *S3) Archived(ctx context.Context, collectionName collection.Name, from, to time.Time) ([]string, error) {
+	keys := make([]string, 0)
+	for _, prefix := range archive.Partitions(c.prefix, collectionName, from, to) {
+		partition, err := c.list(ctx, prefix)
+		if err != nil {
+			return nil, fmt.Errorf("list(%s).%s", prefix, err)
+		}
+		keys = append(keys, partition...)
+	}
+	return keys, nil
+}
+
+// ArchivedDocuments gets an object and decodes its documents
+func (c *S3) ArchivedDocuments(ctx context.Context, key string) ([]collection.Document, error) {
+	body, err := c.get(ctx, fmt.Sprintf("%s/%s", c.baseURL, key))
+	if err != nil {
+		return nil, fmt.Errorf("get.%s", err)
+	}
+	documents, err := archive.Decode(body)
+	if err != nil {
+		return nil, fmt.Errorf("archive.Decode.%s", err)
+	}
+	return documents, nil
+}
+
+// list returns the keys of objects starting with prefix, following continuation tokens
+func (c *S3) list(ctx context.Context, prefix string) ([]string, error) {
+	var (
+		keys  = make([]string, 0)
+		token string
+	)
+	for {
+		query := url.Values{}
+		query.Set("list-type", "2")
+		query.Set("prefix", prefix)
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		body, err := c.get(ctx, fmt.Sprintf("%s/?%s", c.baseURL, query.Encode()))
+		if err != nil {
+			return nil, err
+		}
+		var page listBucketResult
+		err = xml.Unmarshal(body, &page)
+		if err != nil {
+			return nil, fmt.Errorf("xml.Unmarshal.%s", err)
+		}
+		for _, object := range page.Contents {
+			keys = append(keys, object.Key)
+		}
+		if !page.IsTruncated || page.NextContinuationToken == "" {
+			return keys, nil
+		}
+		token = page.NextContinuationToken
+	}
+}
+
+func (c *S3) get(ctx context.Context, objectURL string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", objectURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("http.NewRequest.%s", err)
+	}
+	// objects are read as stored, the transport would otherwise decompress them
+	req.Header.Set("Accept-Encoding", "gzip")
+	if c.signer != nil {
+		err = c.signer.Sign(req, nil)
+		if err != nil {
+			return nil, fmt.Errorf("Sign.%s", err)
+		}
+	}
+	res, err := c.httpcli.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("httpClient.Do.%s", err)
+	}
+	defer res.Body.Close()
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, fmt.Errorf("ioutil.ReadAll.%s", err)
+	}
+	if res.StatusCode >= 300 {
+		return nil, fmt.Errorf("s3: %s : %s", res.Status, body)
+	}
+	return body, nil
+}
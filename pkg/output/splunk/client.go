@@ -0,0 +1,103 @@
+package splunk
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/khezen/bulklog/pkg/auth"
+	"github.com/khezen/bulklog/pkg/collection"
+	"github.com/khezen/bulklog/pkg/output/compression"
+	"github.com/khezen/bulklog/pkg/output/dryrun"
+	"github.com/khezen/bulklog/pkg/output/retry"
+)
+
+// Splunk is a client for Splunk HTTP Event Collector
+type Splunk struct {
+	signer         auth.Signer
+	eventEndpoint  string
+	collections    map[collection.Name]EventConfig
+	httpcli        http.Client
+	healthEndpoint string
+	compression    compression.Compression
+}
+
+// New returns splunk as an output
+func New(cfg Config) *Splunk {
+	if cfg.Scheme == "" {
+		cfg.Scheme = "https"
+	}
+	return &Splunk{
+		auth.NewTokenSigner("Splunk", cfg.Token),
+		fmt.Sprintf("%s://%s/services/collector/event", cfg.Scheme, cfg.Endpoint),
+		cfg.Collections,
+		http.Client{
+			Transport: dryrun.Transport(&http.Transport{
+				MaxIdleConns:    10,
+				IdleConnTimeout: 30 * time.Second,
+			}),
+		},
+		fmt.Sprintf("%s://%s/services/collector/health", cfg.Scheme, cfg.Endpoint),
+		cfg.Compression,
+	}
+}
+
+// Ping requests HEC health
+func (c *Splunk) Ping(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", c.healthEndpoint, nil)
+	if err != nil {
+		return fmt.Errorf("http.NewRequest.%s", err)
+	}
+	res, err := c.httpcli.Do(req)
+	if err != nil {
+		return fmt.Errorf("httpClient.Do.%s", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("splunk: %s", res.Status)
+	}
+	return nil
+}
+
+// Digest sends documents to HEC in a single batch
+func (c *Splunk) Digest(ctx context.Context, documents []collection.Document) error {
+	body, err := RenderEvents(documents, c.collections)
+	if err != nil {
+		return fmt.Errorf("RenderEvents.%s", err)
+	}
+	body, err = c.compression.Encode(body)
+	if err != nil {
+		return fmt.Errorf("Encode.%s", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", c.eventEndpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("http.NewRequest.%s", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	c.compression.SetHeader(req)
+	err = c.signer.Sign(req, body)
+	if err != nil {
+		return fmt.Errorf("Sign.%s", err)
+	}
+	res, err := c.httpcli.Do(req)
+	if err != nil {
+		return fmt.Errorf("httpClient.Do.%s", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode >= 300 {
+		resBody, err := ioutil.ReadAll(res.Body)
+		if err != nil {
+			return fmt.Errorf("ioutil.ReadAll.%s", err)
+		}
+		return retry.FromResponse(res, fmt.Errorf("splunk: %s : %s", res.Status, resBody))
+	}
+	return nil
+}
+
+// Ensure - splunk indexes are expected to exist
+func (c *Splunk) Ensure(ctx context.Context, collection *collection.Collection) error {
+	return nil
+}
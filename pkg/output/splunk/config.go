@@ -0,0 +1,24 @@
+package splunk
+
+import (
+	"github.com/khezen/bulklog/pkg/collection"
+	"github.com/khezen/bulklog/pkg/output/compression"
+)
+
+// Config -
+type Config struct {
+	Enabled     bool                            `yaml:"enabled"`
+	Endpoint    string                          `yaml:"endpoint"`
+	Scheme      string                          `yaml:"scheme"`
+	Token       string                          `yaml:"token"`
+	Collections map[collection.Name]EventConfig `yaml:"collections"`
+	// Compression - Content-Encoding of event batches, none by default
+	Compression compression.Compression `yaml:"compression"`
+}
+
+// EventConfig - HEC event metadata of a collection
+type EventConfig struct {
+	Source     string `yaml:"source"`
+	SourceType string `yaml:"sourcetype"`
+	Index      string `yaml:"index"`
+}
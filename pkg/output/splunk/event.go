@@ -0,0 +1,48 @@
+package splunk
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/khezen/bulklog/pkg/collection"
+)
+
+const defaultSourceType = "_json"
+
+// Event - HTTP Event Collector event
+// ref: https://docs.splunk.com/Documentation/Splunk/latest/Data/FormateventsforHTTPEventCollector
+type Event struct {
+	Time       float64         `json:"time"`
+	Source     string          `json:"source,omitempty"`
+	SourceType string          `json:"sourcetype,omitempty"`
+	Index      string          `json:"index,omitempty"`
+	Event      json.RawMessage `json:"event"`
+}
+
+// RenderEvents renders documents as concatenated HEC events
+func RenderEvents(documents []collection.Document, collections map[collection.Name]EventConfig) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	for _, doc := range documents {
+		eventCfg := collections[doc.CollectionName]
+		if eventCfg.Source == "" {
+			eventCfg.Source = string(doc.CollectionName)
+		}
+		if eventCfg.SourceType == "" {
+			eventCfg.SourceType = defaultSourceType
+		}
+		err := encoder.Encode(Event{
+			Time:       float64(doc.PostedAt.UnixNano()) / float64(time.Second),
+			Source:     eventCfg.Source,
+			SourceType: eventCfg.SourceType,
+			Index:      eventCfg.Index,
+			Event:      json.RawMessage(doc.Body),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("json.Encode.%s", err)
+		}
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,69 @@
+package output
+
+import (
+	"sort"
+	"time"
+)
+
+// State - circuit state and worker pool usage of an output, if it is guarded by a circuit breaker and digests through a pool, and what it would have sent in dry run
+type State struct {
+	Name           string        `json:"name"`
+	CircuitBreaker *BreakerState `json:"circuit_breaker,omitempty"`
+	Pool           *PoolState    `json:"pool,omitempty"`
+	DryRun         *DryRunState  `json:"dry_run,omitempty"`
+	// PausedSince - when deliveries to the output were paused, unset unless they are
+	PausedSince *time.Time `json:"paused_since,omitempty"`
+}
+
+// wrapper is implemented by outputs which guard another one
+type wrapper interface {
+	unwrap() Interface
+}
+
+// Unwrap returns the output which breakers, pools, dry runs and gates guard, out itself otherwise
+func Unwrap(out Interface) Interface {
+	for {
+		wrapped, ok := out.(wrapper)
+		if !ok {
+			return out
+		}
+		out = wrapped.unwrap()
+	}
+}
+
+// States reports the state of guarded outputs, by name
+func States(outputs map[string]Interface) []State {
+	states := make([]State, 0, len(outputs))
+	for name, out := range outputs {
+		state := State{Name: name}
+		for {
+			switch guard := out.(type) {
+			case *Breaker:
+				breakerState := guard.State()
+				state.CircuitBreaker = &breakerState
+			case *Pool:
+				poolState := guard.State()
+				state.Pool = &poolState
+			case *DryRun:
+				dryRunState := guard.State()
+				state.DryRun = &dryRunState
+			case *Gate:
+				if since, paused := guard.PausedSince(); paused {
+					state.PausedSince = &since
+				}
+			}
+			wrapped, ok := out.(wrapper)
+			if !ok {
+				break
+			}
+			out = wrapped.unwrap()
+		}
+		if state.CircuitBreaker != nil || state.Pool != nil || state.DryRun != nil || state.PausedSince != nil {
+			states = append(states, state)
+		}
+	}
+	sort.Slice(states, func(i, j int) bool {
+		return states[i].Name < states[j].Name
+	})
+	return states
+}
@@ -0,0 +1,149 @@
+package syslog
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/khezen/bulklog/pkg/collection"
+)
+
+const dialTimeout = 10 * time.Second
+
+var (
+	// ErrUnsupportedNetwork -
+	ErrUnsupportedNetwork = errors.New("ErrUnsupportedNetwork - syslog network must be one of tcp|tls|udp")
+	// ErrInvalidCA -
+	ErrInvalidCA = errors.New("ErrInvalidCA - no certificate could be parsed from CA file")
+)
+
+// Syslog forwards documents as RFC5424 messages
+type Syslog struct {
+	sync.Mutex
+	network       string
+	address       string
+	facility      int
+	hostname      string
+	messageField  string
+	severityField string
+	tlsConfig     *tls.Config
+	conn          net.Conn
+}
+
+// New returns syslog as an output
+func New(cfg Config) (*Syslog, error) {
+	if cfg.Network == "" {
+		cfg.Network = "tcp"
+	}
+	if cfg.Facility == 0 {
+		cfg.Facility = 1 // user-level messages
+	}
+	if cfg.Hostname == "" {
+		cfg.Hostname, _ = os.Hostname()
+	}
+	s := &Syslog{
+		network:       cfg.Network,
+		address:       cfg.Address,
+		facility:      cfg.Facility,
+		hostname:      cfg.Hostname,
+		messageField:  cfg.MessageField,
+		severityField: cfg.SeverityField,
+	}
+	switch cfg.Network {
+	case "tcp", "udp":
+		break
+	case "tls":
+		tlsConfig, err := newTLSConfig(cfg.TLS)
+		if err != nil {
+			return nil, fmt.Errorf("newTLSConfig.%s", err)
+		}
+		s.tlsConfig = tlsConfig
+	default:
+		return nil, ErrUnsupportedNetwork
+	}
+	return s, nil
+}
+
+func newTLSConfig(cfg TLSConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+	}
+	if cfg.CAFile != "" {
+		caBytes, err := ioutil.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("ioutil.ReadFile.%s", err)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(caBytes) {
+			return nil, ErrInvalidCA
+		}
+	}
+	if cfg.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("tls.LoadX509KeyPair.%s", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+// Digest sends one syslog message per document.
+// Stream transports use octet counting framing (RFC6587).
+func (c *Syslog) Digest(ctx context.Context, documents []collection.Document) error {
+	c.Lock()
+	defer c.Unlock()
+	if c.conn == nil {
+		err := c.dial(ctx)
+		if err != nil {
+			return fmt.Errorf("dial.%s", err)
+		}
+	}
+	for _, doc := range documents {
+		msg, err := RenderMessage(doc, c.facility, c.hostname, c.messageField, c.severityField)
+		if err != nil {
+			return fmt.Errorf("RenderMessage.%s", err)
+		}
+		if c.network != "udp" {
+			msg = fmt.Sprintf("%d %s", len(msg), msg)
+		}
+		deadline := time.Now().Add(dialTimeout)
+		if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+			deadline = ctxDeadline
+		}
+		err = c.conn.SetWriteDeadline(deadline)
+		if err == nil {
+			_, err = c.conn.Write([]byte(msg))
+		}
+		if err != nil {
+			c.conn.Close()
+			c.conn = nil
+			return fmt.Errorf("Write.%s", err)
+		}
+	}
+	return nil
+}
+
+func (c *Syslog) dial(ctx context.Context) (err error) {
+	dialer := &net.Dialer{Timeout: dialTimeout}
+	switch c.network {
+	case "tls":
+		tlsDialer := &tls.Dialer{NetDialer: dialer, Config: c.tlsConfig}
+		c.conn, err = tlsDialer.DialContext(ctx, "tcp", c.address)
+	default:
+		c.conn, err = dialer.DialContext(ctx, c.network, c.address)
+	}
+	return err
+}
+
+// Ensure - nothing to create
+func (c *Syslog) Ensure(ctx context.Context, collection *collection.Collection) error {
+	return nil
+}
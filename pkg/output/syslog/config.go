@@ -0,0 +1,21 @@
+package syslog
+
+// Config -
+type Config struct {
+	Enabled       bool      `yaml:"enabled"`
+	Network       string    `yaml:"network"`
+	Address       string    `yaml:"address"`
+	Facility      int       `yaml:"facility"`
+	Hostname      string    `yaml:"hostname"`
+	MessageField  string    `yaml:"message_field"`
+	SeverityField string    `yaml:"severity_field"`
+	TLS           TLSConfig `yaml:"tls"`
+}
+
+// TLSConfig -
+type TLSConfig struct {
+	CAFile             string `yaml:"ca_file"`
+	CertFile           string `yaml:"cert_file"`
+	KeyFile            string `yaml:"key_file"`
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify"`
+}
@@ -0,0 +1,93 @@
+package syslog
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/khezen/bulklog/pkg/collection"
+)
+
+const (
+	defaultSeverity = 6 // informational
+	nilValue        = "-"
+)
+
+var severities = map[string]int{
+	"emerg":         0,
+	"emergency":     0,
+	"panic":         0,
+	"alert":         1,
+	"crit":          2,
+	"critical":      2,
+	"fatal":         2,
+	"err":           3,
+	"error":         3,
+	"warn":          4,
+	"warning":       4,
+	"notice":        5,
+	"info":          6,
+	"informational": 6,
+	"debug":         7,
+	"trace":         7,
+}
+
+// RenderMessage renders the document as a RFC5424 message
+// ref: https://tools.ietf.org/html/rfc5424#section-6
+func RenderMessage(doc collection.Document, facility int, hostname, messageField, severityField string) (string, error) {
+	var (
+		severity = defaultSeverity
+		msg      = string(doc.Body)
+	)
+	if messageField != "" || severityField != "" {
+		var body map[string]interface{}
+		err := json.Unmarshal(doc.Body, &body)
+		if err != nil {
+			return "", fmt.Errorf("json.Unmarshal.%s", err)
+		}
+		if value, ok := body[severityField].(string); ok {
+			if s, ok := severities[strings.ToLower(value)]; ok {
+				severity = s
+			}
+		}
+		if value, ok := body[messageField]; ok {
+			if str, ok := value.(string); ok {
+				msg = str
+			} else {
+				valueBytes, err := json.Marshal(value)
+				if err != nil {
+					return "", fmt.Errorf("json.Marshal.%s", err)
+				}
+				msg = string(valueBytes)
+			}
+		}
+	}
+	return fmt.Sprintf("<%d>1 %s %s %s %s %s %s %s",
+		facility*8+severity,
+		doc.PostedAt.UTC().Format(time.RFC3339Nano),
+		header(hostname, 255),
+		header(string(doc.CollectionName), 48),
+		nilValue,
+		header(string(doc.SchemaName), 32),
+		nilValue,
+		msg,
+	), nil
+}
+
+// header fields are printable US-ASCII without spaces
+func header(value string, maxLength int) string {
+	if value == "" {
+		return nilValue
+	}
+	value = strings.Map(func(r rune) rune {
+		if r < 33 || r > 126 {
+			return '_'
+		}
+		return r
+	}, value)
+	if len(value) > maxLength {
+		value = value[:maxLength]
+	}
+	return value
+}
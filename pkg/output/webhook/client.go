@@ -0,0 +1,156 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"text/template"
+	"time"
+
+	"github.com/khezen/bulklog/pkg/auth"
+	"github.com/khezen/bulklog/pkg/collection"
+	"github.com/khezen/bulklog/pkg/output/compression"
+	"github.com/khezen/bulklog/pkg/output/dryrun"
+	"github.com/khezen/bulklog/pkg/output/idempotency"
+	"github.com/khezen/bulklog/pkg/output/retry"
+)
+
+var (
+	// ErrUnsupportedFormat -
+	ErrUnsupportedFormat = errors.New("ErrUnsupportedFormat - webhook format must be one of ndjson|template")
+)
+
+// Webhook sends documents in batches to an arbitrary HTTP endpoint
+type Webhook struct {
+	signer       auth.Signer
+	url          string
+	method       string
+	format       Format
+	template     *template.Template
+	contentType  string
+	headers      map[string]string
+	successCodes map[int]struct{}
+	httpcli      http.Client
+	compression  compression.Compression
+}
+
+// New returns a webhook as an output
+func New(cfg Config) (*Webhook, error) {
+	if cfg.Method == "" {
+		cfg.Method = "POST"
+	}
+	if cfg.Format == "" {
+		cfg.Format = NDJSON
+	}
+	var (
+		tmpl *template.Template
+		err  error
+	)
+	switch cfg.Format {
+	case NDJSON:
+		if cfg.ContentType == "" {
+			cfg.ContentType = "application/x-ndjson"
+		}
+	case Template:
+		tmpl, err = NewTemplate(cfg.Template)
+		if err != nil {
+			return nil, fmt.Errorf("NewTemplate.%s", err)
+		}
+		if cfg.ContentType == "" {
+			cfg.ContentType = "application/json"
+		}
+	default:
+		return nil, ErrUnsupportedFormat
+	}
+	var signer auth.Signer
+	switch {
+	case cfg.BearerToken != "":
+		signer = auth.NewTokenSigner("Bearer", cfg.BearerToken)
+	case cfg.BasicAuth != nil:
+		signer = auth.NewBasicSigner(*cfg.BasicAuth)
+	}
+	successCodes := make(map[int]struct{})
+	for _, code := range cfg.SuccessCodes {
+		successCodes[code] = struct{}{}
+	}
+	return &Webhook{
+		signer,
+		cfg.URL,
+		cfg.Method,
+		cfg.Format,
+		tmpl,
+		cfg.ContentType,
+		cfg.Headers,
+		successCodes,
+		http.Client{
+			Timeout:   time.Minute,
+			Transport: dryrun.Transport(nil),
+		},
+		cfg.Compression,
+	}, nil
+}
+
+// Digest sends documents in a single request
+func (c *Webhook) Digest(ctx context.Context, documents []collection.Document) (err error) {
+	var body []byte
+	switch c.format {
+	case Template:
+		body, err = RenderTemplate(c.template, documents)
+		if err != nil {
+			return fmt.Errorf("RenderTemplate.%s", err)
+		}
+	default:
+		body = RenderNDJSON(documents)
+	}
+	body, err = c.compression.Encode(body)
+	if err != nil {
+		return fmt.Errorf("Encode.%s", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, c.method, c.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("http.NewRequest.%s", err)
+	}
+	req.Header.Set("Content-Type", c.contentType)
+	c.compression.SetHeader(req)
+	if key := idempotency.Key(ctx); key != "" {
+		req.Header.Set("Idempotency-Key", key)
+	}
+	for key, value := range c.headers {
+		req.Header.Set(key, value)
+	}
+	if c.signer != nil {
+		err = c.signer.Sign(req, body)
+		if err != nil {
+			return fmt.Errorf("Sign.%s", err)
+		}
+	}
+	res, err := c.httpcli.Do(req)
+	if err != nil {
+		return fmt.Errorf("httpClient.Do.%s", err)
+	}
+	defer res.Body.Close()
+	if !c.success(res.StatusCode) {
+		resBody, err := ioutil.ReadAll(res.Body)
+		if err != nil {
+			return fmt.Errorf("ioutil.ReadAll.%s", err)
+		}
+		return retry.FromResponse(res, fmt.Errorf("webhook: %s : %s", res.Status, resBody))
+	}
+	return nil
+}
+
+func (c *Webhook) success(statusCode int) bool {
+	if len(c.successCodes) == 0 {
+		return statusCode >= 200 && statusCode < 300
+	}
+	_, ok := c.successCodes[statusCode]
+	return ok
+}
+
+// Ensure - nothing to create
+func (c *Webhook) Ensure(ctx context.Context, collection *collection.Collection) error {
+	return nil
+}
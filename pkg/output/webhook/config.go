@@ -0,0 +1,31 @@
+package webhook
+
+import (
+	"github.com/khezen/bulklog/pkg/auth"
+	"github.com/khezen/bulklog/pkg/output/compression"
+)
+
+// Config -
+type Config struct {
+	URL          string            `yaml:"url"`
+	Method       string            `yaml:"method"`
+	Format       Format            `yaml:"format"`
+	Template     string            `yaml:"template"`
+	ContentType  string            `yaml:"content_type"`
+	Headers      map[string]string `yaml:"headers"`
+	SuccessCodes []int             `yaml:"success_codes"`
+	BasicAuth    *auth.BasicConfig `yaml:"basic_auth,omitempty"`
+	BearerToken  string            `yaml:"bearer_token"`
+	// Compression - Content-Encoding of requests, none by default
+	Compression compression.Compression `yaml:"compression"`
+}
+
+// Format - payload format
+type Format string
+
+const (
+	// NDJSON - one document body per line
+	NDJSON Format = "ndjson"
+	// Template - go template rendered body
+	Template Format = "template"
+)
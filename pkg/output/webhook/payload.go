@@ -0,0 +1,68 @@
+package webhook
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"text/template"
+
+	"github.com/khezen/bulklog/pkg/collection"
+)
+
+// TemplateData - data available to payload templates
+type TemplateData struct {
+	Documents []TemplateDocument
+}
+
+// TemplateDocument -
+type TemplateDocument struct {
+	collection.Document
+	Fields map[string]interface{}
+}
+
+var templateFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+	"raw": func(b []byte) string {
+		return string(b)
+	},
+}
+
+// NewTemplate parses a payload template.
+// ex: [{{range $i, $d := .Documents}}{{if $i}},{{end}}{{raw $d.Body}}{{end}}]
+func NewTemplate(text string) (*template.Template, error) {
+	return template.New("payload").Funcs(templateFuncs).Parse(text)
+}
+
+// RenderNDJSON renders document bodies, one per line
+func RenderNDJSON(documents []collection.Document) []byte {
+	var buf bytes.Buffer
+	for _, doc := range documents {
+		buf.Write(doc.Body)
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes()
+}
+
+// RenderTemplate executes the payload template over documents
+func RenderTemplate(tmpl *template.Template, documents []collection.Document) ([]byte, error) {
+	data := TemplateData{
+		Documents: make([]TemplateDocument, 0, len(documents)),
+	}
+	for _, doc := range documents {
+		var fields map[string]interface{}
+		err := json.Unmarshal(doc.Body, &fields)
+		if err != nil {
+			return nil, fmt.Errorf("json.Unmarshal.%s", err)
+		}
+		data.Documents = append(data.Documents, TemplateDocument{doc, fields})
+	}
+	var buf bytes.Buffer
+	err := tmpl.Execute(&buf, data)
+	if err != nil {
+		return nil, fmt.Errorf("Execute.%s", err)
+	}
+	return buf.Bytes(), nil
+}
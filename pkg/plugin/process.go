@@ -0,0 +1,160 @@
+// Package plugin runs plugins as subprocesses exchanging newline delimited JSON over their stdin and stdout.
+// Plugins are programs of any language, their stderr is the one of bulklog.
+package plugin
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// maxLineSize bounds the lines plugins write
+const maxLineSize = 64 * 1024 * 1024
+
+var (
+	// ErrMissingCommand -
+	ErrMissingCommand = errors.New("ErrMissingCommand - plugin command is required")
+	// ErrExited - the plugin process exited
+	ErrExited = errors.New("ErrExited - plugin process exited")
+)
+
+// Config - command running the plugin
+type Config struct {
+	Command string   `yaml:"command"`
+	Args    []string `yaml:"args"`
+	// Env - variables added to the environment of bulklog
+	Env map[string]string `yaml:"env"`
+	Dir string            `yaml:"dir"`
+}
+
+// Validate reports missing commands
+func (c Config) Validate() error {
+	if c.Command == "" {
+		return ErrMissingCommand
+	}
+	return nil
+}
+
+// Process - running plugin, lines it writes to stdout are delivered to Lines until it exits
+type Process struct {
+	cmd       *exec.Cmd
+	stdin     io.WriteCloser
+	writeLock sync.Mutex
+	lines     chan []byte
+	exited    chan struct{}
+	err       error
+	kill      sync.Once
+	killed    chan struct{}
+}
+
+// Start runs the plugin
+func Start(cfg Config) (*Process, error) {
+	cmd := exec.Command(cfg.Command, cfg.Args...)
+	cmd.Dir = cfg.Dir
+	cmd.Env = os.Environ()
+	for name, value := range cfg.Env {
+		cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", name, value))
+	}
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("StdinPipe.%s", err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("StdoutPipe.%s", err)
+	}
+	err = cmd.Start()
+	if err != nil {
+		return nil, fmt.Errorf("Start.%s", err)
+	}
+	p := &Process{
+		cmd:    cmd,
+		stdin:  stdin,
+		lines:  make(chan []byte),
+		exited: make(chan struct{}),
+		killed: make(chan struct{}),
+	}
+	go p.read(stdout)
+	return p, nil
+}
+
+func (p *Process) read(stdout io.Reader) {
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLineSize)
+	for scanner.Scan() {
+		line := make([]byte, len(scanner.Bytes()))
+		copy(line, scanner.Bytes())
+		select {
+		case p.lines <- line:
+		case <-p.killed:
+		}
+	}
+	// stdout is closed once the process exits, or when it writes a line too long to scan
+	scanErr := scanner.Err()
+	p.cmd.Process.Kill()
+	waitErr := p.cmd.Wait()
+	switch {
+	case scanErr != nil:
+		p.err = fmt.Errorf("%s: %s", ErrExited, scanErr)
+	case waitErr != nil:
+		p.err = fmt.Errorf("%s: %s", ErrExited, waitErr)
+	default:
+		p.err = ErrExited
+	}
+	close(p.exited)
+}
+
+// Lines - lines written by the plugin to stdout
+func (p *Process) Lines() <-chan []byte {
+	return p.lines
+}
+
+// Exited is closed once the plugin exited
+func (p *Process) Exited() <-chan struct{} {
+	return p.exited
+}
+
+// Err - why the plugin exited, once Exited is closed
+func (p *Process) Err() error {
+	<-p.exited
+	return p.err
+}
+
+// Write sends a line to the plugin stdin
+func (p *Process) Write(line []byte) error {
+	p.writeLock.Lock()
+	defer p.writeLock.Unlock()
+	_, err := p.stdin.Write(append(line, '\n'))
+	if err != nil {
+		return fmt.Errorf("Write.%s", err)
+	}
+	return nil
+}
+
+// Kill terminates the plugin and waits for it to exit
+func (p *Process) Kill() {
+	p.kill.Do(func() {
+		close(p.killed)
+		p.cmd.Process.Kill()
+	})
+	<-p.exited
+}
+
+// Close closes the plugin stdin, so it may exit gracefully, and kills it if it did not within timeout
+func (p *Process) Close(timeout time.Duration) error {
+	p.stdin.Close()
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-p.exited:
+	case <-timer.C:
+		p.Kill()
+	}
+	return nil
+}
@@ -0,0 +1,389 @@
+package postgres
+
+import (
+	"bufio"
+	"context"
+	"crypto/md5"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+)
+
+const (
+	protocolVersion = 196608 // 3.0
+	sslRequestCode  = 80877103
+	dialTimeout     = 10 * time.Second
+	// copyChunkSize bounds CopyData messages
+	copyChunkSize = 64 * 1024
+)
+
+var (
+	// ErrUnsupportedAuth - the server asks for an authentication method which is not implemented
+	ErrUnsupportedAuth = errors.New("ErrUnsupportedAuth - postgres authentication must be trust, password, md5 or scram-sha-256")
+	// ErrTLSRefused - the server does not accept TLS connections
+	ErrTLSRefused = errors.New("ErrTLSRefused - postgres server refused TLS")
+	// ErrUnexpectedMessage - the server sent a message out of the protocol flow
+	ErrUnexpectedMessage = errors.New("ErrUnexpectedMessage - unexpected postgres message")
+)
+
+// Config - connection settings
+type Config struct {
+	Address  string
+	Database string
+	Username string
+	Password string
+	// TLS - connection is encrypted unless nil
+	TLS *tls.Config
+}
+
+// Error - ErrorResponse of the server
+// ref: https://www.postgresql.org/docs/current/protocol-error-fields.html
+type Error struct {
+	Severity string
+	Code     string
+	Message  string
+	Detail   string
+}
+
+func (e *Error) Error() string {
+	if e.Detail != "" {
+		return fmt.Sprintf("postgres: %s %s: %s: %s", e.Severity, e.Code, e.Message, e.Detail)
+	}
+	return fmt.Sprintf("postgres: %s %s: %s", e.Severity, e.Code, e.Message)
+}
+
+// Conn - connection speaking the frontend/backend protocol v3, through simple queries only
+// ref: https://www.postgresql.org/docs/current/protocol-flow.html
+type Conn struct {
+	net.Conn
+	reader *bufio.Reader
+	buf    []byte
+}
+
+// Dial opens and authenticates a connection
+func Dial(ctx context.Context, cfg Config) (*Conn, error) {
+	dialer := net.Dialer{Timeout: dialTimeout}
+	netConn, err := dialer.DialContext(ctx, "tcp", cfg.Address)
+	if err != nil {
+		return nil, fmt.Errorf("net.Dial.%s", err)
+	}
+	c := &Conn{Conn: netConn}
+	c.setDeadline(ctx)
+	if cfg.TLS != nil {
+		err = c.startTLS(cfg.TLS)
+		if err != nil {
+			netConn.Close()
+			return nil, fmt.Errorf("startTLS.%s", err)
+		}
+	}
+	c.reader = bufio.NewReader(c.Conn)
+	err = c.startup(cfg)
+	if err != nil {
+		c.Conn.Close()
+		return nil, fmt.Errorf("startup.%s", err)
+	}
+	c.Conn.SetDeadline(time.Time{})
+	return c, nil
+}
+
+func (c *Conn) startTLS(tlsConfig *tls.Config) error {
+	request := make([]byte, 8)
+	binary.BigEndian.PutUint32(request[0:4], 8)
+	binary.BigEndian.PutUint32(request[4:8], sslRequestCode)
+	_, err := c.Conn.Write(request)
+	if err != nil {
+		return fmt.Errorf("Write.%s", err)
+	}
+	response := make([]byte, 1)
+	_, err = io.ReadFull(c.Conn, response)
+	if err != nil {
+		return fmt.Errorf("Read.%s", err)
+	}
+	if response[0] != 'S' {
+		return ErrTLSRefused
+	}
+	tlsConn := tls.Client(c.Conn, tlsConfig)
+	err = tlsConn.Handshake()
+	if err != nil {
+		return fmt.Errorf("Handshake.%s", err)
+	}
+	c.Conn = tlsConn
+	return nil
+}
+
+func (c *Conn) startup(cfg Config) error {
+	var msg message
+	msg.int32(0) // size placeholder
+	msg.int32(protocolVersion)
+	msg.cstring("user")
+	msg.cstring(cfg.Username)
+	if cfg.Database != "" {
+		msg.cstring("database")
+		msg.cstring(cfg.Database)
+	}
+	msg.cstring("application_name")
+	msg.cstring("bulklog")
+	msg.byte(0)
+	binary.BigEndian.PutUint32(msg[0:4], uint32(len(msg)))
+	_, err := c.Conn.Write(msg)
+	if err != nil {
+		return fmt.Errorf("Write.%s", err)
+	}
+	var scram *scramClient
+	for {
+		typ, payload, err := c.receive()
+		if err != nil {
+			return err
+		}
+		switch typ {
+		case 'R':
+			if len(payload) < 4 {
+				return ErrUnexpectedMessage
+			}
+			code, data := binary.BigEndian.Uint32(payload[:4]), payload[4:]
+			switch code {
+			case 0: // AuthenticationOk
+			case 3: // AuthenticationCleartextPassword
+				err = c.sendPassword(cfg.Password)
+			case 5: // AuthenticationMD5Password
+				if len(data) < 4 {
+					return ErrUnexpectedMessage
+				}
+				err = c.sendPassword(md5Password(cfg.Username, cfg.Password, data[:4]))
+			case 10: // AuthenticationSASL
+				if !hasMechanism(data, scramMechanism) {
+					return ErrUnsupportedAuth
+				}
+				scram, err = newSCRAMClient(cfg.Password)
+				if err != nil {
+					return fmt.Errorf("newSCRAMClient.%s", err)
+				}
+				var initial message
+				initial.cstring(scramMechanism)
+				first := scram.clientFirst()
+				initial.int32(int32(len(first)))
+				initial = append(initial, first...)
+				err = c.send('p', initial)
+			case 11: // AuthenticationSASLContinue
+				if scram == nil {
+					return ErrUnexpectedMessage
+				}
+				var final []byte
+				final, err = scram.clientFinal(data)
+				if err != nil {
+					return fmt.Errorf("clientFinal.%s", err)
+				}
+				err = c.send('p', final)
+			case 12: // AuthenticationSASLFinal
+				if scram == nil {
+					return ErrUnexpectedMessage
+				}
+				err = scram.verify(data)
+				if err != nil {
+					return fmt.Errorf("verify.%s", err)
+				}
+			default:
+				return ErrUnsupportedAuth
+			}
+			if err != nil {
+				return err
+			}
+		case 'E':
+			return parseError(payload)
+		case 'Z':
+			return nil
+		}
+	}
+}
+
+func (c *Conn) sendPassword(password string) error {
+	var msg message
+	msg.cstring(password)
+	return c.send('p', msg)
+}
+
+func md5Password(username, password string, salt []byte) string {
+	inner := md5.Sum([]byte(password + username))
+	outer := md5.Sum(append([]byte(hex.EncodeToString(inner[:])), salt...))
+	return "md5" + hex.EncodeToString(outer[:])
+}
+
+func hasMechanism(data []byte, mechanism string) bool {
+	for len(data) > 0 {
+		i := indexZero(data)
+		if i <= 0 {
+			return false
+		}
+		if string(data[:i]) == mechanism {
+			return true
+		}
+		data = data[i+1:]
+	}
+	return false
+}
+
+// Exec runs statements through the simple query protocol, they run in a single transaction unless they begin or commit explicitly
+func (c *Conn) Exec(ctx context.Context, sql string) error {
+	c.setDeadline(ctx)
+	defer c.Conn.SetDeadline(time.Time{})
+	var msg message
+	msg.cstring(sql)
+	err := c.send('Q', msg)
+	if err != nil {
+		return err
+	}
+	return c.awaitReady(nil)
+}
+
+// CopyIn runs a COPY ... FROM STDIN statement, rows being the data in the format of the statement
+func (c *Conn) CopyIn(ctx context.Context, sql string, rows []byte) error {
+	c.setDeadline(ctx)
+	defer c.Conn.SetDeadline(time.Time{})
+	var msg message
+	msg.cstring(sql)
+	err := c.send('Q', msg)
+	if err != nil {
+		return err
+	}
+	return c.awaitReady(func() error {
+		for len(rows) > 0 {
+			chunk := rows
+			if len(chunk) > copyChunkSize {
+				chunk = chunk[:copyChunkSize]
+			}
+			rows = rows[len(chunk):]
+			err := c.send('d', chunk)
+			if err != nil {
+				return err
+			}
+		}
+		return c.send('c', nil)
+	})
+}
+
+// awaitReady reads responses until the server is ready for the next query, copyIn sends data when the server asks for it.
+// The first error reported by the server is returned once it is ready.
+func (c *Conn) awaitReady(copyIn func() error) error {
+	var queryErr error
+	for {
+		typ, payload, err := c.receive()
+		if err != nil {
+			return err
+		}
+		switch typ {
+		case 'E':
+			if queryErr == nil {
+				queryErr = parseError(payload)
+			}
+		case 'G': // CopyInResponse
+			if copyIn == nil {
+				err = c.send('f', []byte("unexpected COPY FROM STDIN\x00"))
+			} else {
+				err = copyIn()
+			}
+			if err != nil {
+				return err
+			}
+		case 'H': // CopyOutResponse, not expected either
+			return ErrUnexpectedMessage
+		case 'Z':
+			return queryErr
+		}
+	}
+}
+
+// Close terminates the session
+func (c *Conn) Close() error {
+	c.send('X', nil)
+	return c.Conn.Close()
+}
+
+func (c *Conn) setDeadline(ctx context.Context) {
+	if deadline, ok := ctx.Deadline(); ok {
+		c.Conn.SetDeadline(deadline)
+	}
+}
+
+func (c *Conn) send(typ byte, payload []byte) error {
+	c.buf = append(c.buf[:0], typ, 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(c.buf[1:5], uint32(len(payload)+4))
+	c.buf = append(c.buf, payload...)
+	_, err := c.Conn.Write(c.buf)
+	if err != nil {
+		return fmt.Errorf("Write.%s", err)
+	}
+	return nil
+}
+
+func (c *Conn) receive() (byte, []byte, error) {
+	header := make([]byte, 5)
+	_, err := io.ReadFull(c.reader, header)
+	if err != nil {
+		return 0, nil, fmt.Errorf("Read.%s", err)
+	}
+	size := int(binary.BigEndian.Uint32(header[1:5])) - 4
+	if size < 0 {
+		return 0, nil, ErrUnexpectedMessage
+	}
+	payload := make([]byte, size)
+	_, err = io.ReadFull(c.reader, payload)
+	if err != nil {
+		return 0, nil, fmt.Errorf("Read.%s", err)
+	}
+	return header[0], payload, nil
+}
+
+func parseError(payload []byte) error {
+	pgErr := &Error{}
+	for len(payload) > 1 {
+		field := payload[0]
+		payload = payload[1:]
+		i := indexZero(payload)
+		if i < 0 {
+			break
+		}
+		value := string(payload[:i])
+		payload = payload[i+1:]
+		switch field {
+		case 'S':
+			pgErr.Severity = value
+		case 'C':
+			pgErr.Code = value
+		case 'M':
+			pgErr.Message = value
+		case 'D':
+			pgErr.Detail = value
+		}
+	}
+	return pgErr
+}
+
+func indexZero(data []byte) int {
+	for i, b := range data {
+		if b == 0 {
+			return i
+		}
+	}
+	return -1
+}
+
+// message - payload of a frontend message
+type message []byte
+
+func (m *message) byte(b byte) {
+	*m = append(*m, b)
+}
+
+func (m *message) int32(i int32) {
+	*m = binary.BigEndian.AppendUint32(*m, uint32(i))
+}
+
+func (m *message) cstring(s string) {
+	*m = append(*m, s...)
+	*m = append(*m, 0)
+}
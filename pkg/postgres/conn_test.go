@@ -0,0 +1,222 @@
+package postgres
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// backend plays the server side of the protocol over a single connection
+type backend struct {
+	t    *testing.T
+	conn net.Conn
+}
+
+func (b *backend) read() (byte, []byte) {
+	b.t.Helper()
+	header := make([]byte, 5)
+	_, err := io.ReadFull(b.conn, header)
+	if err != nil {
+		b.t.Fatalf("backend read: %s", err)
+	}
+	payload := make([]byte, binary.BigEndian.Uint32(header[1:])-4)
+	_, err = io.ReadFull(b.conn, payload)
+	if err != nil {
+		b.t.Fatalf("backend read: %s", err)
+	}
+	return header[0], payload
+}
+
+func (b *backend) expect(typ byte, payload string) {
+	b.t.Helper()
+	gotTyp, gotPayload := b.read()
+	if gotTyp != typ || string(gotPayload) != payload {
+		b.t.Fatalf("backend received %q %q, want %q %q", gotTyp, gotPayload, typ, payload)
+	}
+}
+
+func (b *backend) write(typ byte, payload []byte) {
+	b.t.Helper()
+	msg := append([]byte{typ}, binary.BigEndian.AppendUint32(nil, uint32(len(payload)+4))...)
+	_, err := b.conn.Write(append(msg, payload...))
+	if err != nil {
+		b.t.Fatalf("backend write: %s", err)
+	}
+}
+
+func (b *backend) auth(code uint32, data []byte) {
+	b.write('R', append(binary.BigEndian.AppendUint32(nil, code), data...))
+}
+
+// serve accepts one connection, expects the startup message of user bulklog to database logs, then runs session
+func serve(t *testing.T, session func(b *backend)) (addr string, done chan struct{}) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	done = make(chan struct{})
+	go func() {
+		defer close(done)
+		defer listener.Close()
+		conn, err := listener.Accept()
+		if err != nil {
+			t.Errorf("Accept: %s", err)
+			return
+		}
+		defer conn.Close()
+		conn.SetDeadline(time.Now().Add(10 * time.Second))
+		startup := make([]byte, 61)
+		_, err = io.ReadFull(conn, startup)
+		if err != nil {
+			t.Errorf("startup read: %s", err)
+			return
+		}
+		want := "\x00\x00\x00\x3d\x00\x03\x00\x00user\x00bulklog\x00database\x00logs\x00application_name\x00bulklog\x00\x00"
+		if string(startup) != want {
+			t.Errorf("startup = %q, want %q", startup, want)
+			return
+		}
+		session(&backend{t: t, conn: conn})
+	}()
+	return listener.Addr().String(), done
+}
+
+func dial(t *testing.T, addr string) *Conn {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	c, err := Dial(ctx, Config{Address: addr, Database: "logs", Username: "bulklog", Password: "secret"})
+	if err != nil {
+		t.Fatalf("Dial: %s", err)
+	}
+	return c
+}
+
+func TestMD5Session(t *testing.T) {
+	rows := bytes.Repeat([]byte("{\"msg\":\"served\"}\n"), 5000)
+	addr, done := serve(t, func(b *backend) {
+		b.auth(5, []byte{1, 2, 3, 4})
+		// md5(md5(password + user) + salt)
+		b.expect('p', "md55489b6bae8f60995009ffd42a4f0e5f0\x00")
+		b.auth(0, nil)
+		b.write('S', []byte("server_version\x0016.2\x00"))
+		b.write('K', []byte{0, 0, 0, 1, 0, 0, 0, 2})
+		b.write('Z', []byte("I"))
+
+		b.expect('Q', "CREATE TABLE logs (document jsonb)\x00")
+		b.write('E', []byte("SERROR\x00C42P07\x00Mrelation \"logs\" already exists\x00\x00"))
+		b.write('Z', []byte("I"))
+
+		b.expect('Q', "COPY logs (document) FROM STDIN\x00")
+		b.write('G', []byte{0, 0, 1, 0, 0})
+		var received []byte
+		for {
+			typ, payload := b.read()
+			if typ == 'c' {
+				break
+			}
+			if typ != 'd' || len(payload) > copyChunkSize {
+				b.t.Errorf("backend received %q of %d bytes, want CopyData of up to %d bytes", typ, len(payload), copyChunkSize)
+				return
+			}
+			received = append(received, payload...)
+		}
+		if !bytes.Equal(received, rows) {
+			b.t.Errorf("backend received %d bytes of rows, want %d", len(received), len(rows))
+		}
+		b.write('C', []byte("COPY 5000\x00"))
+		b.write('Z', []byte("I"))
+
+		b.expect('X', "")
+	})
+	c := dial(t, addr)
+	err := c.Exec(context.Background(), "CREATE TABLE logs (document jsonb)")
+	pgErr, ok := err.(*Error)
+	if !ok || pgErr.Code != "42P07" || pgErr.Severity != "ERROR" || pgErr.Message != `relation "logs" already exists` {
+		t.Fatalf("Exec: got %v, want the 42P07 error of the server", err)
+	}
+	err = c.CopyIn(context.Background(), "COPY logs (document) FROM STDIN", rows)
+	if err != nil {
+		t.Fatalf("CopyIn: %s", err)
+	}
+	c.Close()
+	<-done
+}
+
+// TestSCRAMSession authenticates against a backend checking the client proof as RFC 5802 servers do
+func TestSCRAMSession(t *testing.T) {
+	addr, done := serve(t, func(b *backend) {
+		b.auth(10, []byte("SCRAM-SHA-256-PLUS\x00SCRAM-SHA-256\x00\x00"))
+		_, initial := b.read()
+		if !bytes.HasPrefix(initial, []byte("SCRAM-SHA-256\x00")) {
+			b.t.Errorf("SASLInitialResponse %q does not select SCRAM-SHA-256", initial)
+			return
+		}
+		clientFirst := string(initial[len("SCRAM-SHA-256\x00")+4:])
+		if !strings.HasPrefix(clientFirst, "n,,n=,r=") {
+			b.t.Errorf("client-first %q", clientFirst)
+			return
+		}
+		clientFirstBare := clientFirst[3:]
+		salt := []byte("bulklog salt")
+		serverFirst := "r=" + clientFirstBare[len("n=,r="):] + "server-nonce,s=" + base64.StdEncoding.EncodeToString(salt) + ",i=4096"
+		b.auth(11, []byte(serverFirst))
+		_, final := b.read()
+		i := bytes.LastIndex(final, []byte(",p="))
+		if i < 0 {
+			b.t.Errorf("client-final %q has no proof", final)
+			return
+		}
+		authMessage := clientFirstBare + "," + serverFirst + "," + string(final[:i])
+		proof, _ := base64.StdEncoding.DecodeString(string(final[i+3:]))
+		salted := pbkdf2SHA256([]byte("secret"), salt, 4096)
+		clientKey := hmacSHA256(salted, []byte("Client Key"))
+		storedKey := sha256.Sum256(clientKey)
+		signature := hmacSHA256(storedKey[:], []byte(authMessage))
+		for j := range proof {
+			proof[j] ^= signature[j]
+		}
+		recovered := sha256.Sum256(proof)
+		if recovered != storedKey {
+			b.t.Error("client proof does not match the stored key")
+			return
+		}
+		serverSignature := hmacSHA256(hmacSHA256(salted, []byte("Server Key")), []byte(authMessage))
+		b.auth(12, []byte("v="+base64.StdEncoding.EncodeToString(serverSignature)))
+		b.auth(0, nil)
+		b.write('Z', []byte("I"))
+		b.expect('X', "")
+	})
+	c := dial(t, addr)
+	c.Close()
+	<-done
+}
+
+func TestUnsupportedAuth(t *testing.T) {
+	addr, done := serve(t, func(b *backend) {
+		b.auth(10, []byte("SCRAM-SHA-256-PLUS\x00\x00"))
+	})
+	_, err := Dial(context.Background(), Config{Address: addr, Database: "logs", Username: "bulklog", Password: "secret"})
+	if err == nil || !strings.Contains(err.Error(), ErrUnsupportedAuth.Error()) {
+		t.Fatalf("Dial: got %v, want %v", err, ErrUnsupportedAuth)
+	}
+	<-done
+}
+
+// FuzzParseError checks arbitrary error responses of servers are parsed rather than panicking
+func FuzzParseError(f *testing.F) {
+	f.Add([]byte("SERROR\x00C28P01\x00Mpassword authentication failed\x00\x00"))
+	f.Add([]byte("M"))
+	f.Fuzz(func(t *testing.T, payload []byte) {
+		if parseError(payload) == nil {
+			t.Fatalf("parseError of %q: got no error", payload)
+		}
+	})
+}
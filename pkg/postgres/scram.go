@@ -0,0 +1,128 @@
+package postgres
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	scramMechanism = "SCRAM-SHA-256"
+	// maxSCRAMIterations bounds the key derivation a server may ask for, postgres defaults to 4096
+	maxSCRAMIterations = 1 << 20
+)
+
+// ErrSCRAM - the server SCRAM exchange is invalid, or the server could not prove it knows the password
+var ErrSCRAM = errors.New("ErrSCRAM - postgres SCRAM-SHA-256 exchange failed")
+
+// scramClient authenticates with SCRAM-SHA-256, without channel binding
+// ref: https://datatracker.ietf.org/doc/html/rfc7677
+type scramClient struct {
+	password        string
+	clientNonce     string
+	clientFirstBare string
+	authMessage     string
+	saltedPassword  []byte
+}
+
+func newSCRAMClient(password string) (*scramClient, error) {
+	nonce := make([]byte, 18)
+	_, err := rand.Read(nonce)
+	if err != nil {
+		return nil, fmt.Errorf("rand.Read.%s", err)
+	}
+	return newSCRAMClientWithNonce(password, base64.RawStdEncoding.EncodeToString(nonce)), nil
+}
+
+func newSCRAMClientWithNonce(password, nonce string) *scramClient {
+	return &scramClient{
+		password:    password,
+		clientNonce: nonce,
+		// the user name is the one of the startup message
+		clientFirstBare: "n=,r=" + nonce,
+	}
+}
+
+func (s *scramClient) clientFirst() []byte {
+	return []byte("n,," + s.clientFirstBare)
+}
+
+func (s *scramClient) clientFinal(serverFirst []byte) ([]byte, error) {
+	attrs := scramAttributes(string(serverFirst))
+	nonce, saltB64, iterStr := attrs["r"], attrs["s"], attrs["i"]
+	if !strings.HasPrefix(nonce, s.clientNonce) || len(nonce) == len(s.clientNonce) {
+		return nil, ErrSCRAM
+	}
+	salt, err := base64.StdEncoding.DecodeString(saltB64)
+	if err != nil {
+		return nil, ErrSCRAM
+	}
+	iterations, err := strconv.Atoi(iterStr)
+	if err != nil || iterations <= 0 || iterations > maxSCRAMIterations {
+		return nil, ErrSCRAM
+	}
+	s.saltedPassword = pbkdf2SHA256([]byte(s.password), salt, iterations)
+	clientFinalWithoutProof := "c=biws,r=" + nonce
+	s.authMessage = s.clientFirstBare + "," + string(serverFirst) + "," + clientFinalWithoutProof
+	clientKey := hmacSHA256(s.saltedPassword, []byte("Client Key"))
+	storedKey := sha256.Sum256(clientKey)
+	clientSignature := hmacSHA256(storedKey[:], []byte(s.authMessage))
+	proof := make([]byte, len(clientKey))
+	for i := range clientKey {
+		proof[i] = clientKey[i] ^ clientSignature[i]
+	}
+	return []byte(clientFinalWithoutProof + ",p=" + base64.StdEncoding.EncodeToString(proof)), nil
+}
+
+func (s *scramClient) verify(serverFinal []byte) error {
+	signature, err := base64.StdEncoding.DecodeString(scramAttributes(string(serverFinal))["v"])
+	if err != nil || s.saltedPassword == nil {
+		return ErrSCRAM
+	}
+	serverKey := hmacSHA256(s.saltedPassword, []byte("Server Key"))
+	if !hmac.Equal(signature, hmacSHA256(serverKey, []byte(s.authMessage))) {
+		return ErrSCRAM
+	}
+	return nil
+}
+
+func scramAttributes(msg string) map[string]string {
+	attrs := make(map[string]string)
+	for _, attr := range strings.Split(msg, ",") {
+		if len(attr) > 2 && attr[1] == '=' {
+			attrs[attr[:1]] = attr[2:]
+		}
+	}
+	return attrs
+}
+
+func hmacSHA256(key, data []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
+
+// pbkdf2SHA256 derives a single block key, SHA-256 output size being the SCRAM key size
+// ref: https://datatracker.ietf.org/doc/html/rfc8018#section-5.2
+func pbkdf2SHA256(password, salt []byte, iterations int) []byte {
+	mac := hmac.New(sha256.New, password)
+	mac.Write(salt)
+	mac.Write([]byte{0, 0, 0, 1})
+	u := mac.Sum(nil)
+	key := bytes.Clone(u)
+	for i := 1; i < iterations; i++ {
+		mac.Reset()
+		mac.Write(u)
+		u = mac.Sum(u[:0])
+		for j := range key {
+			key[j] ^= u[j]
+		}
+	}
+	return key
+}
@@ -0,0 +1,87 @@
+package postgres
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+// TestSCRAMVector replays the SCRAM-SHA-256 exchange of RFC 7677 section 3
+func TestSCRAMVector(t *testing.T) {
+	s := newSCRAMClientWithNonce("pencil", "rOprNGfwEbeRWgbNEkqO")
+	// the RFC exchange names its user, postgres takes the one of the startup message instead
+	s.clientFirstBare = "n=user,r=rOprNGfwEbeRWgbNEkqO"
+	if got, want := string(s.clientFirst()), "n,,n=user,r=rOprNGfwEbeRWgbNEkqO"; got != want {
+		t.Fatalf("client-first = %q, want %q", got, want)
+	}
+	final, err := s.clientFinal([]byte("r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096"))
+	if err != nil {
+		t.Fatalf("clientFinal: %s", err)
+	}
+	want := "c=biws,r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,p=dHzbZapWIk4jUhN+Ute9ytag9zjfMHgsqmmiz7AndVQ="
+	if string(final) != want {
+		t.Fatalf("client-final = %q, want %q", final, want)
+	}
+	err = s.verify([]byte("v=6rriTRBi23WpRR/wtup+mMhUZUn/dB5nLTJRsjl95G4="))
+	if err != nil {
+		t.Fatalf("verify: %s", err)
+	}
+	err = s.verify([]byte("v=AAAATRBi23WpRR/wtup+mMhUZUn/dB5nLTJRsjl95G4="))
+	if err != ErrSCRAM {
+		t.Fatalf("verify of a wrong server signature: got %v, want %v", err, ErrSCRAM)
+	}
+}
+
+func TestSCRAMInvalidServerFirst(t *testing.T) {
+	serverFirsts := map[string]string{
+		"nonce of another client": "r=AAAANGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096",
+		"nonce not extended":      "r=rOprNGfwEbeRWgbNEkqO,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096",
+		"invalid salt":            "r=rOprNGfwEbeRWgbNEkqO%hvYD,s=not base64,i=4096",
+		"no iterations":           "r=rOprNGfwEbeRWgbNEkqO%hvYD,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=0",
+		"too many iterations":     "r=rOprNGfwEbeRWgbNEkqO%hvYD,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=1000000000",
+	}
+	for name, serverFirst := range serverFirsts {
+		t.Run(name, func(t *testing.T) {
+			s := newSCRAMClientWithNonce("pencil", "rOprNGfwEbeRWgbNEkqO")
+			_, err := s.clientFinal([]byte(serverFirst))
+			if err != ErrSCRAM {
+				t.Fatalf("clientFinal: got %v, want %v", err, ErrSCRAM)
+			}
+		})
+	}
+	s := newSCRAMClientWithNonce("pencil", "rOprNGfwEbeRWgbNEkqO")
+	if err := s.verify([]byte("v=6rriTRBi23WpRR/wtup+mMhUZUn/dB5nLTJRsjl95G4=")); err != ErrSCRAM {
+		t.Fatalf("verify before client-final: got %v, want %v", err, ErrSCRAM)
+	}
+}
+
+// TestPBKDF2SHA256 checks the PBKDF2-HMAC-SHA256 vectors of RFC 7914 section 11, truncated to the SCRAM key size
+func TestPBKDF2SHA256(t *testing.T) {
+	vectors := []struct {
+		password, salt string
+		iterations     int
+		key            string
+	}{
+		{"passwd", "salt", 1, "55ac046e56e3089fec1691c22544b605f94185216dde0465e68b9d57c20dacbc"},
+		{"Password", "NaCl", 80000, "4ddcd8f60b98be21830cee5ef22701f9641a4418d04c0414aeff08876b34ab56"},
+	}
+	for _, vector := range vectors {
+		key := hex.EncodeToString(pbkdf2SHA256([]byte(vector.password), []byte(vector.salt), vector.iterations))
+		if key != vector.key {
+			t.Errorf("pbkdf2(%q, %q, %d) = %s, want %s", vector.password, vector.salt, vector.iterations, key, vector.key)
+		}
+	}
+}
+
+// FuzzSCRAMServer checks arbitrary server-first and server-final messages are answered or rejected rather than panicking
+func FuzzSCRAMServer(f *testing.F) {
+	f.Add([]byte("r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096"), []byte("v=6rriTRBi23WpRR/wtup+mMhUZUn/dB5nLTJRsjl95G4="))
+	f.Add([]byte("r=rOprNGfwEbeRWgbNEkqO%hvYD,s=,i=1"), []byte("e=invalid-proof"))
+	f.Fuzz(func(t *testing.T, serverFirst, serverFinal []byte) {
+		s := newSCRAMClientWithNonce("pencil", "rOprNGfwEbeRWgbNEkqO")
+		_, err := s.clientFinal(serverFirst)
+		if err != nil {
+			return
+		}
+		s.verify(serverFinal)
+	})
+}
@@ -0,0 +1,248 @@
+// Package proto implements the protocol buffers wire format primitives
+// needed to encode and decode bulklog messages without generated code.
+// ref: https://protobuf.dev/programming-guides/encoding/
+package proto
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+// WireType - protobuf wire type
+type WireType int
+
+const (
+	// Varint - int32, int64, uint32, uint64, sint32, sint64, bool, enum
+	Varint WireType = 0
+	// Fixed64 - fixed64, sfixed64, double
+	Fixed64 WireType = 1
+	// Bytes - string, bytes, embedded messages, packed repeated fields
+	Bytes WireType = 2
+	// Fixed32 - fixed32, sfixed32, float
+	Fixed32 WireType = 5
+)
+
+var (
+	// ErrTruncated - message ends in the middle of a field
+	ErrTruncated = errors.New("ErrTruncated - protobuf message is truncated")
+	// ErrWireType - unsupported wire type
+	ErrWireType = errors.New("ErrWireType - unsupported protobuf wire type")
+)
+
+// Encoder appends fields to a message
+type Encoder struct {
+	buf []byte
+}
+
+// Bytes returns the encoded message
+func (e *Encoder) Bytes() []byte {
+	return e.buf
+}
+
+func (e *Encoder) tag(field int, wireType WireType) {
+	e.varint(uint64(field)<<3 | uint64(wireType))
+}
+
+func (e *Encoder) varint(v uint64) {
+	e.buf = binary.AppendUvarint(e.buf, v)
+}
+
+// PutVarint encodes a varint field even if zero, as required by oneof and optional fields
+func (e *Encoder) PutVarint(field int, v uint64) {
+	e.tag(field, Varint)
+	e.varint(v)
+}
+
+// PutFixed64 encodes a fixed64 field even if zero
+func (e *Encoder) PutFixed64(field int, v uint64) {
+	e.tag(field, Fixed64)
+	e.buf = binary.LittleEndian.AppendUint64(e.buf, v)
+}
+
+// PutFixed32 encodes a fixed32 field even if zero
+func (e *Encoder) PutFixed32(field int, v uint32) {
+	e.tag(field, Fixed32)
+	e.buf = binary.LittleEndian.AppendUint32(e.buf, v)
+}
+
+// PutBytes encodes a length delimited field even if empty
+func (e *Encoder) PutBytes(field int, v []byte) {
+	e.tag(field, Bytes)
+	e.varint(uint64(len(v)))
+	e.buf = append(e.buf, v...)
+}
+
+// Uint64 encodes a varint field, zero values are omitted
+func (e *Encoder) Uint64(field int, v uint64) {
+	if v == 0 {
+		return
+	}
+	e.PutVarint(field, v)
+}
+
+// Int64 encodes an int64 field, zero values are omitted
+func (e *Encoder) Int64(field int, v int64) {
+	e.Uint64(field, uint64(v))
+}
+
+// Bool encodes a bool field, false is omitted
+func (e *Encoder) Bool(field int, v bool) {
+	if v {
+		e.Uint64(field, 1)
+	}
+}
+
+// Fixed64 encodes a fixed64 field, zero values are omitted
+func (e *Encoder) Fixed64(field int, v uint64) {
+	if v == 0 {
+		return
+	}
+	e.PutFixed64(field, v)
+}
+
+// Fixed32 encodes a fixed32 field, zero values are omitted
+func (e *Encoder) Fixed32(field int, v uint32) {
+	if v == 0 {
+		return
+	}
+	e.PutFixed32(field, v)
+}
+
+// Double encodes a double field, zero values are omitted
+func (e *Encoder) Double(field int, v float64) {
+	e.Fixed64(field, math.Float64bits(v))
+}
+
+// String encodes a string field, empty strings are omitted
+func (e *Encoder) String(field int, v string) {
+	if v == "" {
+		return
+	}
+	e.PutBytes(field, []byte(v))
+}
+
+// BytesField encodes a bytes field, empty values are omitted
+func (e *Encoder) BytesField(field int, v []byte) {
+	if len(v) == 0 {
+		return
+	}
+	e.PutBytes(field, v)
+}
+
+// Message encodes an embedded message, always present even if empty
+func (e *Encoder) Message(field int, encode func(*Encoder)) {
+	var inner Encoder
+	encode(&inner)
+	e.PutBytes(field, inner.buf)
+}
+
+// Decoder iterates over message fields
+type Decoder struct {
+	buf      []byte
+	field    int
+	wireType WireType
+	value    uint64
+	bytes    []byte
+	err      error
+}
+
+// NewDecoder -
+func NewDecoder(buf []byte) *Decoder {
+	return &Decoder{buf: buf}
+}
+
+// Next reads the next field, it returns false at the end of the message or on error
+func (d *Decoder) Next() bool {
+	if d.err != nil || len(d.buf) == 0 {
+		return false
+	}
+	tag, n := binary.Uvarint(d.buf)
+	if n <= 0 {
+		d.err = ErrTruncated
+		return false
+	}
+	d.buf = d.buf[n:]
+	d.field = int(tag >> 3)
+	d.wireType = WireType(tag & 7)
+	switch d.wireType {
+	case Varint:
+		d.value, n = binary.Uvarint(d.buf)
+		if n <= 0 {
+			d.err = ErrTruncated
+			return false
+		}
+		d.buf = d.buf[n:]
+	case Fixed64:
+		if len(d.buf) < 8 {
+			d.err = ErrTruncated
+			return false
+		}
+		d.value = binary.LittleEndian.Uint64(d.buf)
+		d.buf = d.buf[8:]
+	case Fixed32:
+		if len(d.buf) < 4 {
+			d.err = ErrTruncated
+			return false
+		}
+		d.value = uint64(binary.LittleEndian.Uint32(d.buf))
+		d.buf = d.buf[4:]
+	case Bytes:
+		length, n := binary.Uvarint(d.buf)
+		if n <= 0 || uint64(len(d.buf)-n) < length {
+			d.err = ErrTruncated
+			return false
+		}
+		d.bytes = d.buf[n : n+int(length)]
+		d.buf = d.buf[n+int(length):]
+	default:
+		d.err = ErrWireType
+		return false
+	}
+	return true
+}
+
+// Field - number of the current field
+func (d *Decoder) Field() int {
+	return d.field
+}
+
+// WireType - wire type of the current field
+func (d *Decoder) WireType() WireType {
+	return d.wireType
+}
+
+// Uint64 - value of the current varint or fixed field
+func (d *Decoder) Uint64() uint64 {
+	return d.value
+}
+
+// Int64 - value of the current varint field as int64
+func (d *Decoder) Int64() int64 {
+	return int64(d.value)
+}
+
+// Bool - value of the current varint field as bool
+func (d *Decoder) Bool() bool {
+	return d.value != 0
+}
+
+// Double - value of the current fixed64 field as double
+func (d *Decoder) Double() float64 {
+	return math.Float64frombits(d.value)
+}
+
+// Bytes - value of the current length delimited field
+func (d *Decoder) Bytes() []byte {
+	return d.bytes
+}
+
+// String - value of the current length delimited field as string
+func (d *Decoder) String() string {
+	return string(d.bytes)
+}
+
+// Err returns the error which stopped the iteration, if any
+func (d *Decoder) Err() error {
+	return d.err
+}
@@ -0,0 +1,52 @@
+package proto
+
+import (
+	"bytes"
+	"testing"
+)
+
+// reencode decodes the fields of buf and encodes them again, varints in their shortest form
+func reencode(buf []byte) ([]byte, error) {
+	var (
+		e Encoder
+		d = NewDecoder(buf)
+	)
+	for d.Next() {
+		switch d.WireType() {
+		case Varint:
+			e.PutVarint(d.Field(), d.Uint64())
+		case Fixed64:
+			e.PutFixed64(d.Field(), d.Uint64())
+		case Fixed32:
+			e.PutFixed32(d.Field(), uint32(d.Uint64()))
+		case Bytes:
+			e.PutBytes(d.Field(), d.Bytes())
+		}
+	}
+	return e.Bytes(), d.Err()
+}
+
+// FuzzDecoder checks arbitrary messages are decoded or rejected rather than panicking, and fields decoded encode back to themselves
+func FuzzDecoder(f *testing.F) {
+	var e Encoder
+	e.PutVarint(1, 150)
+	e.Double(2, 0.5)
+	e.Fixed32(3, 7)
+	e.String(4, "testing")
+	e.Message(5, func(e *Encoder) {
+		e.Bool(1, true)
+	})
+	f.Add(e.Bytes())
+	// the protobuf encoding example, a varint of a single field
+	f.Add([]byte{0x08, 0x96, 0x01})
+	f.Fuzz(func(t *testing.T, buf []byte) {
+		encoded, err := reencode(buf)
+		if err != nil {
+			return
+		}
+		again, err := reencode(encoded)
+		if err != nil || !bytes.Equal(again, encoded) {
+			t.Fatalf("fields of %x encode as %x, which encodes as %x, %v", buf, encoded, again, err)
+		}
+	})
+}
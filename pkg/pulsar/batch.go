@@ -0,0 +1,174 @@
+package pulsar
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/khezen/bulklog/pkg/proto"
+	"github.com/khezen/bulklog/pkg/snappy"
+)
+
+// Compression codec of batches
+type Compression string
+
+const (
+	// None - no compression
+	None Compression = "none"
+	// Zlib - zlib compression
+	Zlib Compression = "zlib"
+	// Snappy - snappy compression, cheaper than zlib
+	Snappy Compression = "snappy"
+)
+
+// CompressionType values of MessageMetadata
+const (
+	compressionNone   = 0
+	compressionZlib   = 2
+	compressionSnappy = 4
+)
+
+// ErrUnknownCompression -
+var ErrUnknownCompression = errors.New("ErrUnknownCompression - pulsar compression must be one of none|zlib|snappy")
+
+// Validate reports unknown compression codecs
+func (c Compression) Validate() error {
+	switch c {
+	case "", None, Zlib, Snappy:
+		return nil
+	default:
+		return ErrUnknownCompression
+	}
+}
+
+// Message - message to produce
+type Message struct {
+	// Key - partition key, routing messages of partitioned topics and Key_Shared subscriptions, none if empty
+	Key     string
+	Payload []byte
+	// EventTime - omitted if zero
+	EventTime time.Time
+}
+
+// BatchConfig bounds the messages sent together as a single batch message
+type BatchConfig struct {
+	// MaxMessages - 1000 by default
+	MaxMessages int
+	// MaxBytes - payload bytes, 128KiB by default; larger messages are sent in a batch of their own
+	MaxBytes int
+	// KeyBased - batches hold messages of a single key, as Key_Shared subscriptions expect
+	KeyBased bool
+}
+
+const (
+	defaultBatchMaxMessages = 1000
+	defaultBatchMaxBytes    = 128 * 1024
+)
+
+// batch - messages sent as a single batch message, bound to a partition
+type batch struct {
+	messages []Message
+	size     int
+}
+
+// key shared by every message of the batch, empty otherwise
+func (b *batch) key() string {
+	key := b.messages[0].Key
+	for _, msg := range b.messages[1:] {
+		if msg.Key != key {
+			return ""
+		}
+	}
+	return key
+}
+
+// split messages into batches, in order, grouping them by key first if batches are key based
+func split(messages []Message, cfg BatchConfig) []*batch {
+	if !cfg.KeyBased {
+		return chunk(messages, cfg)
+	}
+	var (
+		keys    []string
+		byKey   = make(map[string][]Message)
+		batches []*batch
+	)
+	for _, msg := range messages {
+		if _, ok := byKey[msg.Key]; !ok {
+			keys = append(keys, msg.Key)
+		}
+		byKey[msg.Key] = append(byKey[msg.Key], msg)
+	}
+	for _, key := range keys {
+		batches = append(batches, chunk(byKey[key], cfg)...)
+	}
+	return batches
+}
+
+func chunk(messages []Message, cfg BatchConfig) []*batch {
+	var (
+		batches []*batch
+		current *batch
+	)
+	for _, msg := range messages {
+		if current == nil || len(current.messages) >= cfg.MaxMessages || current.size+len(msg.Payload) > cfg.MaxBytes {
+			current = &batch{}
+			batches = append(batches, current)
+		}
+		current.messages = append(current.messages, msg)
+		current.size += len(msg.Payload)
+	}
+	return batches
+}
+
+// encode renders the batch as the metadata and payload of a message
+// ref: https://pulsar.apache.org/docs/next/developing-binary-protocol/#batch-messages
+func (b *batch) encode(producerName string, sequenceID uint64, compression Compression) (metadata, payload []byte, err error) {
+	var buf bytes.Buffer
+	for _, msg := range b.messages {
+		var single proto.Encoder
+		single.String(2, msg.Key)
+		single.PutVarint(3, uint64(len(msg.Payload)))
+		if !msg.EventTime.IsZero() {
+			single.Uint64(5, uint64(msg.EventTime.UnixNano()/int64(time.Millisecond)))
+		}
+		binary.Write(&buf, binary.BigEndian, uint32(len(single.Bytes())))
+		buf.Write(single.Bytes())
+		buf.Write(msg.Payload)
+	}
+	payload = buf.Bytes()
+	uncompressedSize := len(payload)
+	var codec uint64
+	switch compression {
+	case Zlib:
+		var compressed bytes.Buffer
+		w := zlib.NewWriter(&compressed)
+		_, err = w.Write(payload)
+		if err == nil {
+			err = w.Close()
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("zlib.Write.%s", err)
+		}
+		codec, payload = compressionZlib, compressed.Bytes()
+	case Snappy:
+		codec, payload = compressionSnappy, snappy.Encode(payload)
+	case "", None:
+		codec = compressionNone
+	default:
+		return nil, nil, ErrUnknownCompression
+	}
+	var e proto.Encoder
+	e.PutBytes(1, []byte(producerName))
+	e.PutVarint(2, sequenceID)
+	e.PutVarint(3, uint64(time.Now().UnixNano()/int64(time.Millisecond)))
+	e.String(6, b.key())
+	e.Uint64(8, codec)
+	if codec != compressionNone {
+		e.PutVarint(9, uint64(uncompressedSize))
+	}
+	e.PutVarint(11, uint64(len(b.messages)))
+	return e.Bytes(), payload, nil
+}
@@ -0,0 +1,151 @@
+package pulsar
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/hex"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/khezen/bulklog/pkg/proto"
+	"github.com/khezen/bulklog/pkg/snappy"
+)
+
+var eventTime = time.Unix(0, 1700000000000*int64(time.Millisecond))
+
+// goldenPayload - batch payload of testBatch, as SingleMessageMetadata sizes, SingleMessageMetadata and payloads
+// ref: https://pulsar.apache.org/docs/next/developing-binary-protocol/#batch-messages
+const goldenPayload = "0000000c" + "12016b" + "1802" + "2880d095ffbc31" + "6162" + // partition_key, payload_size, event_time, payload
+	"00000005" + "12016b" + "1801" + "63"
+
+var testBatch = batch{messages: []Message{
+	{Key: "k", Payload: []byte("ab"), EventTime: eventTime},
+	{Key: "k", Payload: []byte("c")},
+}}
+
+func TestBatchEncodeGolden(t *testing.T) {
+	for _, compression := range []Compression{None, Zlib, Snappy} {
+		t.Run(string(compression), func(t *testing.T) {
+			before := time.Now().UnixNano() / int64(time.Millisecond)
+			metadata, payload, err := testBatch.encode("p-1", 7, compression)
+			if err != nil {
+				t.Fatal(err)
+			}
+			fields := make(map[int]uint64)
+			var producerName, partitionKey string
+			d := proto.NewDecoder(metadata)
+			for d.Next() {
+				switch d.Field() {
+				case 1:
+					producerName = d.String()
+				case 6:
+					partitionKey = d.String()
+				default:
+					fields[d.Field()] = d.Uint64()
+				}
+			}
+			if d.Err() != nil {
+				t.Fatal(d.Err())
+			}
+			if producerName != "p-1" || partitionKey != "k" || fields[2] != 7 || fields[11] != 2 {
+				t.Fatalf("metadata: producer %q, key %q, fields %v", producerName, partitionKey, fields)
+			}
+			if publishTime := int64(fields[3]); publishTime < before || publishTime > time.Now().UnixNano()/int64(time.Millisecond) {
+				t.Fatalf("publish time %d is not the time of encoding", publishTime)
+			}
+			switch compression {
+			case Zlib:
+				r, err := zlib.NewReader(bytes.NewReader(payload))
+				if err != nil {
+					t.Fatal(err)
+				}
+				payload, err = io.ReadAll(r)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if fields[8] != compressionZlib {
+					t.Fatalf("compression = %d, want %d", fields[8], compressionZlib)
+				}
+			case Snappy:
+				payload, err = snappy.Decode(payload)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if fields[8] != compressionSnappy {
+					t.Fatalf("compression = %d, want %d", fields[8], compressionSnappy)
+				}
+			default:
+				if _, ok := fields[8]; ok {
+					t.Fatalf("compression of uncompressed batch = %d, want none", fields[8])
+				}
+			}
+			if compression != None && fields[9] != uint64(len(goldenPayload)/2) {
+				t.Fatalf("uncompressed size = %d, want %d", fields[9], len(goldenPayload)/2)
+			}
+			if got := hex.EncodeToString(payload); got != goldenPayload {
+				t.Fatalf("payload =\n%s\nwant\n%s", got, goldenPayload)
+			}
+		})
+	}
+	_, _, err := testBatch.encode("p-1", 7, "lz4")
+	if err != ErrUnknownCompression {
+		t.Fatalf("encode lz4: got %v, want %v", err, ErrUnknownCompression)
+	}
+}
+
+// TestBatchKey checks batches of mixed keys have no partition key, each message keeping its own
+func TestBatchKey(t *testing.T) {
+	b := batch{messages: []Message{{Key: "a"}, {Key: "b"}}}
+	if key := b.key(); key != "" {
+		t.Fatalf("key of mixed batch = %q", key)
+	}
+	if key := testBatch.key(); key != "k" {
+		t.Fatalf("key = %q, want k", key)
+	}
+}
+
+func TestSplit(t *testing.T) {
+	messages := []Message{
+		{Key: "a", Payload: []byte("1234")},
+		{Key: "b", Payload: []byte("1234")},
+		{Key: "a", Payload: []byte("12")},
+		{Key: "a", Payload: []byte(strings.Repeat("x", 20))},
+		{Key: "b", Payload: []byte("1")},
+	}
+	cfg := BatchConfig{MaxMessages: 2, MaxBytes: 10}
+	assertBatches(t, split(messages, cfg), [][]Message{
+		messages[0:2],
+		{messages[2]},
+		{messages[3]}, // larger than MaxBytes, in a batch of its own
+		{messages[4]},
+	})
+	cfg.KeyBased = true
+	assertBatches(t, split(messages, cfg), [][]Message{
+		{messages[0], messages[2]},
+		{messages[3]},
+		{messages[1], messages[4]},
+	})
+}
+
+func assertBatches(t *testing.T, batches []*batch, want [][]Message) {
+	t.Helper()
+	if len(batches) != len(want) {
+		t.Fatalf("split into %d batches, want %d", len(batches), len(want))
+	}
+	for i, b := range batches {
+		size := 0
+		for _, msg := range want[i] {
+			size += len(msg.Payload)
+		}
+		if len(b.messages) != len(want[i]) || b.size != size {
+			t.Fatalf("batch %d = %+v, want %+v", i, b.messages, want[i])
+		}
+		for j := range b.messages {
+			if b.messages[j].Key != want[i][j].Key || !bytes.Equal(b.messages[j].Payload, want[i][j].Payload) {
+				t.Fatalf("batch %d = %+v, want %+v", i, b.messages, want[i])
+			}
+		}
+	}
+}
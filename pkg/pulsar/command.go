@@ -0,0 +1,260 @@
+// Package pulsar implements the subset of the pulsar binary protocol needed to produce messages.
+// ref: https://pulsar.apache.org/docs/next/developing-binary-protocol/
+package pulsar
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+
+	"github.com/khezen/bulklog/pkg/proto"
+)
+
+// types of BaseCommand, which are also the field numbers of their command in BaseCommand
+// ref: https://github.com/apache/pulsar/blob/master/pulsar-common/src/main/proto/PulsarApi.proto
+const (
+	typeConnect                     = 2
+	typeConnected                   = 3
+	typeProducer                    = 5
+	typeSend                        = 6
+	typeSendReceipt                 = 7
+	typeSendError                   = 8
+	typeSuccess                     = 13
+	typeError                       = 14
+	typeCloseProducer               = 15
+	typeProducerSuccess             = 17
+	typePing                        = 18
+	typePong                        = 19
+	typePartitionedMetadata         = 21
+	typePartitionedMetadataResponse = 22
+	typeLookup                      = 23
+	typeLookupResponse              = 24
+	typeAuthChallenge               = 36
+	typeAuthResponse                = 37
+)
+
+const (
+	clientVersion   = "bulklog"
+	protocolVersion = 15
+	magicCRC32C     = 0x0e01
+	// maxFrameSize bounds frames read from brokers, which only send small commands to producers
+	maxFrameSize = 64 * 1024 * 1024
+)
+
+// lookup response types
+const (
+	lookupRedirect = 0
+	lookupConnect  = 1
+	lookupFailed   = 2
+)
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// Error - ServerError reported by the broker
+type Error struct {
+	Code    int
+	Message string
+}
+
+var serverErrors = []string{
+	"UnknownError", "MetadataError", "PersistenceError", "AuthenticationError", "AuthorizationError",
+	"ConsumerBusy", "ServiceNotReady", "ProducerBlockedQuotaExceededError", "ProducerBlockedQuotaExceededException",
+	"ChecksumError", "UnsupportedVersionError", "TopicNotFound", "SubscriptionNotFound", "ConsumerNotFound",
+	"TooManyRequests", "TopicTerminatedError", "ProducerBusy", "InvalidTopicName",
+}
+
+func (e *Error) Error() string {
+	name := fmt.Sprintf("ServerError(%d)", e.Code)
+	if e.Code >= 0 && e.Code < len(serverErrors) {
+		name = serverErrors[e.Code]
+	}
+	return fmt.Sprintf("pulsar: %s: %s", name, e.Message)
+}
+
+// encodeCommand renders a BaseCommand of the given type, encode renders its command
+func encodeCommand(typ int, encode func(e *proto.Encoder)) []byte {
+	var e proto.Encoder
+	e.PutVarint(1, uint64(typ))
+	e.Message(typ, encode)
+	return e.Bytes()
+}
+
+// simpleFrame - [totalSize][commandSize][command]
+func simpleFrame(command []byte) []byte {
+	frame := make([]byte, 8, 8+len(command))
+	binary.BigEndian.PutUint32(frame[0:4], uint32(4+len(command)))
+	binary.BigEndian.PutUint32(frame[4:8], uint32(len(command)))
+	return append(frame, command...)
+}
+
+// payloadFrame - [totalSize][commandSize][command][magic][checksum][metadataSize][metadata][payload],
+// the CRC32C checksum covers what follows it
+func payloadFrame(command, metadata, payload []byte) []byte {
+	size := 4 + len(command) + 2 + 4 + 4 + len(metadata) + len(payload)
+	frame := make([]byte, 0, 4+size)
+	frame = binary.BigEndian.AppendUint32(frame, uint32(size))
+	frame = binary.BigEndian.AppendUint32(frame, uint32(len(command)))
+	frame = append(frame, command...)
+	frame = binary.BigEndian.AppendUint16(frame, magicCRC32C)
+	checksumAt := len(frame)
+	frame = append(frame, 0, 0, 0, 0)
+	frame = binary.BigEndian.AppendUint32(frame, uint32(len(metadata)))
+	frame = append(frame, metadata...)
+	frame = append(frame, payload...)
+	binary.BigEndian.PutUint32(frame[checksumAt:], crc32.Checksum(frame[checksumAt+4:], castagnoli))
+	return frame
+}
+
+// response - fields of the broker commands a producer reads
+type response struct {
+	typ        int
+	requestID  uint64
+	producerID uint64
+	sequenceID uint64
+	// err - error reported by the broker, nil on success
+	err error
+	// CONNECTED
+	maxMessageSize int
+	// PRODUCER_SUCCESS
+	producerName   string
+	lastSequenceID int64
+	producerReady  bool
+	// PARTITIONED_METADATA_RESPONSE
+	partitions int
+	// LOOKUP_RESPONSE
+	lookupType     int
+	brokerURL      string
+	brokerURLTLS   string
+	authoritative  bool
+	proxyToService bool
+}
+
+// decodeResponse reads a BaseCommand, commands producers do not expect are returned with their type only
+func decodeResponse(buf []byte) (*response, error) {
+	var (
+		base    = proto.NewDecoder(buf)
+		typ     int
+		command = make(map[int][]byte)
+	)
+	for base.Next() {
+		if base.Field() == 1 {
+			typ = int(base.Uint64())
+		} else if base.WireType() == proto.Bytes {
+			command[base.Field()] = base.Bytes()
+		}
+	}
+	if base.Err() != nil {
+		return nil, fmt.Errorf("BaseCommand.%s", base.Err())
+	}
+	res := &response{
+		typ:            typ,
+		lastSequenceID: -1,
+		producerReady:  true,
+	}
+	var (
+		d       = proto.NewDecoder(command[typ])
+		code    = -1
+		message string
+	)
+	for d.Next() {
+		switch typ {
+		case typeConnected:
+			if d.Field() == 3 {
+				res.maxMessageSize = int(d.Int64())
+			}
+		case typeSuccess:
+			if d.Field() == 1 {
+				res.requestID = d.Uint64()
+			}
+		case typeError:
+			switch d.Field() {
+			case 1:
+				res.requestID = d.Uint64()
+			case 2:
+				code = int(d.Int64())
+			case 3:
+				message = d.String()
+			}
+		case typeProducerSuccess:
+			switch d.Field() {
+			case 1:
+				res.requestID = d.Uint64()
+			case 2:
+				res.producerName = d.String()
+			case 3:
+				res.lastSequenceID = d.Int64()
+			case 6:
+				res.producerReady = d.Bool()
+			}
+		case typeSendReceipt:
+			switch d.Field() {
+			case 1:
+				res.producerID = d.Uint64()
+			case 2:
+				res.sequenceID = d.Uint64()
+			}
+		case typeSendError:
+			switch d.Field() {
+			case 1:
+				res.producerID = d.Uint64()
+			case 2:
+				res.sequenceID = d.Uint64()
+			case 3:
+				code = int(d.Int64())
+			case 4:
+				message = d.String()
+			}
+		case typeCloseProducer:
+			switch d.Field() {
+			case 1:
+				res.producerID = d.Uint64()
+			case 2:
+				res.requestID = d.Uint64()
+			}
+		case typePartitionedMetadataResponse:
+			switch d.Field() {
+			case 1:
+				res.partitions = int(d.Uint64())
+			case 2:
+				res.requestID = d.Uint64()
+			case 3:
+				if d.Uint64() != 0 && code < 0 {
+					code = 0
+				}
+			case 4:
+				code = int(d.Int64())
+			case 5:
+				message = d.String()
+			}
+		case typeLookupResponse:
+			switch d.Field() {
+			case 1:
+				res.brokerURL = d.String()
+			case 2:
+				res.brokerURLTLS = d.String()
+			case 3:
+				res.lookupType = int(d.Uint64())
+			case 4:
+				res.requestID = d.Uint64()
+			case 5:
+				res.authoritative = d.Bool()
+			case 6:
+				code = int(d.Int64())
+			case 7:
+				message = d.String()
+			case 8:
+				res.proxyToService = d.Bool()
+			}
+		}
+	}
+	if d.Err() != nil {
+		return nil, fmt.Errorf("command(%d).%s", typ, d.Err())
+	}
+	if typ == typeLookupResponse && res.lookupType == lookupFailed && code < 0 {
+		code = 0
+	}
+	if code >= 0 {
+		res.err = &Error{Code: code, Message: message}
+	}
+	return res, nil
+}
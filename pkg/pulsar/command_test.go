@@ -0,0 +1,177 @@
+package pulsar
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"hash/crc32"
+	"strings"
+	"testing"
+
+	"github.com/khezen/bulklog/pkg/proto"
+)
+
+// TestSimpleFrameGolden checks commands are framed as PING commands of java clients are
+func TestSimpleFrameGolden(t *testing.T) {
+	frame := simpleFrame(encodeCommand(typePing, func(e *proto.Encoder) {}))
+	want := "00000009" + // total size
+		"00000005" + // command size
+		"0812" + // type PING
+		"920100" // empty CommandPing at field 18
+	if got := hex.EncodeToString(frame); got != want {
+		t.Fatalf("simpleFrame =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestPayloadFrameGolden(t *testing.T) {
+	command := encodeCommand(typeSend, func(e *proto.Encoder) {
+		e.PutVarint(1, 1)
+		e.PutVarint(2, 5)
+		e.PutVarint(3, 2)
+	})
+	frame := payloadFrame(command, []byte("m"), []byte("p"))
+	want := "0000001a" + // total size
+		"0000000a" + // command size
+		"0806" + "3206080110051802" + // type SEND, CommandSend{producer_id: 1, sequence_id: 5, num_messages: 2}
+		"0e01" + // magic
+		"c353a5ec" + // crc32c of the fields below
+		"00000001" + "6d" + // metadata
+		"70" // payload
+	if got := hex.EncodeToString(frame); got != want {
+		t.Fatalf("payloadFrame =\n%s\nwant\n%s", got, want)
+	}
+	if sum := crc32.Checksum(frame[24:], crc32.MakeTable(crc32.Castagnoli)); sum != 0xc353a5ec {
+		t.Fatalf("crc32c = %x, want c353a5ec", sum)
+	}
+}
+
+// TestDecodeResponseGolden decodes commands as brokers encode them
+func TestDecodeResponseGolden(t *testing.T) {
+	commands := map[string]struct {
+		command string
+		want    response
+		err     string
+	}{
+		"connected": {
+			command: "0803" + "1a0d" + "0a04322e3131" + "1013" + "188080c002",
+			want:    response{typ: typeConnected, maxMessageSize: 5 << 20},
+		},
+		"producer success": {
+			command: "0811" + "8a010b" + "0807" + "1203702d31" + "182a" + "3001",
+			want:    response{typ: typeProducerSuccess, requestID: 7, producerName: "p-1", lastSequenceID: 42, producerReady: true},
+		},
+		"producer waiting": {
+			command: "0811" + "8a0109" + "0807" + "1203702d31" + "3000",
+			want:    response{typ: typeProducerSuccess, requestID: 7, producerName: "p-1", lastSequenceID: -1},
+		},
+		"send receipt": {
+			command: "0807" + "3a0a" + "0803" + "1005" + "1a0408081003",
+			want:    response{typ: typeSendReceipt, producerID: 3, sequenceID: 5},
+		},
+		"send error": {
+			command: "0808" + "4210" + "0803" + "1005" + "1809" + "2208636865636b73756d",
+			want:    response{typ: typeSendError, producerID: 3, sequenceID: 5},
+			err:     "pulsar: ChecksumError: checksum",
+		},
+		"error": {
+			command: "080e" + "720e" + "0809" + "100b" + "1a086e6f20746f706963",
+			want:    response{typ: typeError, requestID: 9},
+			err:     "pulsar: TopicNotFound: no topic",
+		},
+		"partitioned metadata": {
+			command: "0816" + "b20104" + "0804" + "1002",
+			want:    response{typ: typePartitionedMetadataResponse, requestID: 2, partitions: 4},
+		},
+		"lookup connect through proxy": {
+			command: "0818" + "c20119" + "0a0f" + hex.EncodeToString([]byte("pulsar://b:6650")) + "1801" + "2004" + "2801" + "4001",
+			want:    response{typ: typeLookupResponse, requestID: 4, brokerURL: "pulsar://b:6650", lookupType: lookupConnect, authoritative: true, proxyToService: true},
+		},
+		"lookup failed without code": {
+			command: "0818" + "c20104" + "1802" + "2004",
+			want:    response{typ: typeLookupResponse, requestID: 4, lookupType: lookupFailed},
+			err:     "pulsar: UnknownError: ",
+		},
+		"unexpected command": {
+			command: "0863" + "9a0602" + "0801",
+			want:    response{typ: 99},
+		},
+	}
+	for name, command := range commands {
+		t.Run(name, func(t *testing.T) {
+			buf, err := hex.DecodeString(command.command)
+			if err != nil {
+				t.Fatal(err)
+			}
+			res, err := decodeResponse(buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if command.err == "" && res.err != nil || command.err != "" && (res.err == nil || res.err.Error() != command.err) {
+				t.Fatalf("error = %v, want %q", res.err, command.err)
+			}
+			res.err = nil
+			if command.want.typ != typeProducerSuccess {
+				command.want.lastSequenceID, command.want.producerReady = -1, true
+			}
+			if *res != command.want {
+				t.Fatalf("decodeResponse = %+v, want %+v", *res, command.want)
+			}
+		})
+	}
+}
+
+func TestDecodeResponseTruncated(t *testing.T) {
+	buf, _ := hex.DecodeString("0807" + "3a0a" + "0803")
+	_, err := decodeResponse(buf)
+	if err == nil {
+		t.Fatal("decodeResponse of a truncated command: got no error")
+	}
+}
+
+func TestErrorNames(t *testing.T) {
+	errs := map[Error]string{
+		{Code: 0, Message: "m"}:  "pulsar: UnknownError: m",
+		{Code: 17, Message: "m"}: "pulsar: InvalidTopicName: m",
+		{Code: 42, Message: "m"}: "pulsar: ServerError(42): m",
+	}
+	for err, want := range errs {
+		if got := err.Error(); got != want {
+			t.Errorf("Error() = %q, want %q", got, want)
+		}
+	}
+}
+
+// TestReadCommandInvalid checks frames whose sizes do not add up are rejected, including sizes overflowing once added
+func TestReadCommandInvalid(t *testing.T) {
+	for _, header := range []string{"0000000000000000", "0000000200000000", "00000009fffffffd", "0000000900000006", "0400000100000005"} {
+		b, _ := hex.DecodeString(header)
+		c := &conn{reader: bufio.NewReader(bytes.NewReader(b))}
+		_, err := c.readCommand()
+		if err == nil || !strings.HasPrefix(err.Error(), "pulsar: invalid frame") {
+			t.Fatalf("readCommand of frame header %s: got %v", header, err)
+		}
+	}
+}
+
+// FuzzReadCommand checks arbitrary frames of brokers are read or rejected rather than panicking
+func FuzzReadCommand(f *testing.F) {
+	for _, command := range []string{
+		"0803" + "1a0d" + "0a04322e3131" + "1013" + "188080c002",
+		"0811" + "8a010b" + "0807" + "1203702d31" + "182a" + "3001",
+		"0807" + "3a0a" + "0803" + "1005" + "1a0408081003",
+		"0808" + "4210" + "0803" + "1005" + "1809" + "2208636865636b73756d",
+	} {
+		b, _ := hex.DecodeString(command)
+		f.Add(simpleFrame(b))
+	}
+	f.Add(payloadFrame(encodeCommand(typeSend, func(e *proto.Encoder) { e.PutVarint(1, 1) }), []byte("m"), []byte("p")))
+	f.Fuzz(func(t *testing.T, frames []byte) {
+		c := &conn{reader: bufio.NewReader(bytes.NewReader(frames))}
+		for {
+			_, err := c.readCommand()
+			if err != nil {
+				return
+			}
+		}
+	})
+}
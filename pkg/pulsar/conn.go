@@ -0,0 +1,339 @@
+package pulsar
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/khezen/bulklog/pkg/proto"
+)
+
+const (
+	dialTimeout  = 10 * time.Second
+	writeTimeout = 30 * time.Second
+	// defaultMaxMessageSize - broker default, unless CONNECTED tells otherwise
+	defaultMaxMessageSize = 5 * 1024 * 1024
+)
+
+var (
+	// ErrConnClosed - the connection to the broker is broken
+	ErrConnClosed = errors.New("ErrConnClosed - pulsar connection closed")
+	// ErrProducerClosed - the broker closed the producer, such as when the topic is unloaded
+	ErrProducerClosed = errors.New("ErrProducerClosed - pulsar producer closed by broker")
+)
+
+// receipt identifies a message sent by a producer
+type receipt struct {
+	producerID uint64
+	sequenceID uint64
+}
+
+// conn - connection to a broker, possibly through a proxy.
+// Responses are read in the background and handed to the requests and sends waiting for them.
+type conn struct {
+	net.Conn
+	sync.Mutex
+	reader         *bufio.Reader
+	writeLock      sync.Mutex
+	token          string
+	maxMessageSize int
+	requests       map[uint64]chan *response
+	receipts       map[receipt]chan error
+	producers      map[uint64]*topicProducer
+	done           chan struct{}
+	err            error
+}
+
+// dial connects to addr, proxyTo being the broker URL the proxy at addr must forward to, if any
+func dial(ctx context.Context, addr, proxyTo, token string, tlsConfig *tls.Config) (*conn, error) {
+	dialer := net.Dialer{Timeout: dialTimeout}
+	netConn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("net.Dial.%s", err)
+	}
+	if tlsConfig != nil {
+		tlsConfig = tlsConfig.Clone()
+		if tlsConfig.ServerName == "" {
+			tlsConfig.ServerName, _, _ = net.SplitHostPort(addr)
+		}
+		tlsConn := tls.Client(netConn, tlsConfig)
+		err = tlsConn.HandshakeContext(ctx)
+		if err != nil {
+			netConn.Close()
+			return nil, fmt.Errorf("Handshake.%s", err)
+		}
+		netConn = tlsConn
+	}
+	c := &conn{
+		Conn:           netConn,
+		reader:         bufio.NewReader(netConn),
+		token:          token,
+		maxMessageSize: defaultMaxMessageSize,
+		requests:       make(map[uint64]chan *response),
+		receipts:       make(map[receipt]chan error),
+		producers:      make(map[uint64]*topicProducer),
+		done:           make(chan struct{}),
+	}
+	err = c.connect(ctx, proxyTo)
+	if err != nil {
+		netConn.Close()
+		return nil, fmt.Errorf("connect.%s", err)
+	}
+	go c.read()
+	return c, nil
+}
+
+func (c *conn) connect(ctx context.Context, proxyTo string) error {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(dialTimeout)
+	}
+	c.Conn.SetDeadline(deadline)
+	defer c.Conn.SetDeadline(time.Time{})
+	command := encodeCommand(typeConnect, func(e *proto.Encoder) {
+		e.String(1, clientVersion)
+		if c.token != "" {
+			e.String(5, "token")
+			e.PutBytes(3, []byte(c.token))
+		}
+		e.PutVarint(4, protocolVersion)
+		e.String(6, proxyTo)
+	})
+	_, err := c.Conn.Write(simpleFrame(command))
+	if err != nil {
+		return fmt.Errorf("Write.%s", err)
+	}
+	for {
+		res, err := c.readCommand()
+		if err != nil {
+			return err
+		}
+		switch res.typ {
+		case typeConnected:
+			if res.maxMessageSize > 0 {
+				c.maxMessageSize = res.maxMessageSize
+			}
+			return nil
+		case typeError:
+			return res.err
+		case typeAuthChallenge:
+			_, err = c.Conn.Write(c.authResponse())
+			if err != nil {
+				return fmt.Errorf("Write.%s", err)
+			}
+		}
+	}
+}
+
+// authResponse answers auth challenges with the token again, brokers send them to refresh expiring credentials
+func (c *conn) authResponse() []byte {
+	return simpleFrame(encodeCommand(typeAuthResponse, func(e *proto.Encoder) {
+		e.String(1, clientVersion)
+		e.Message(2, func(e *proto.Encoder) {
+			e.String(1, "token")
+			e.PutBytes(2, []byte(c.token))
+		})
+		e.PutVarint(3, protocolVersion)
+	}))
+}
+
+func (c *conn) readCommand() (*response, error) {
+	header := make([]byte, 8)
+	_, err := io.ReadFull(c.reader, header)
+	if err != nil {
+		return nil, fmt.Errorf("Read.%s", err)
+	}
+	totalSize, commandSize := binary.BigEndian.Uint32(header[0:4]), binary.BigEndian.Uint32(header[4:8])
+	if totalSize > maxFrameSize || totalSize < 4 || commandSize > totalSize-4 {
+		return nil, fmt.Errorf("pulsar: invalid frame of %d bytes", totalSize)
+	}
+	frame := make([]byte, totalSize-4)
+	_, err = io.ReadFull(c.reader, frame)
+	if err != nil {
+		return nil, fmt.Errorf("Read.%s", err)
+	}
+	// payloads follow commands of messages delivered to consumers only
+	return decodeResponse(frame[:commandSize])
+}
+
+func (c *conn) read() {
+	for {
+		res, err := c.readCommand()
+		if err != nil {
+			c.fail(err)
+			return
+		}
+		switch res.typ {
+		case typePing:
+			err = c.write(simpleFrame(encodeCommand(typePong, func(e *proto.Encoder) {})))
+		case typeAuthChallenge:
+			err = c.write(c.authResponse())
+		case typeSendReceipt, typeSendError:
+			c.receive(receipt{res.producerID, res.sequenceID}, res.err)
+		case typeCloseProducer:
+			c.closeProducer(res.producerID)
+		case typeProducerSuccess:
+			// producers waiting for exclusive access are told again once ready
+			if res.producerReady {
+				c.respond(res)
+			}
+		case typeSuccess, typeError, typeLookupResponse, typePartitionedMetadataResponse:
+			c.respond(res)
+		}
+		if err != nil {
+			c.fail(err)
+			return
+		}
+	}
+}
+
+func (c *conn) respond(res *response) {
+	c.Lock()
+	ch, ok := c.requests[res.requestID]
+	delete(c.requests, res.requestID)
+	c.Unlock()
+	if ok {
+		ch <- res
+	}
+}
+
+func (c *conn) receive(r receipt, err error) {
+	c.Lock()
+	ch, ok := c.receipts[r]
+	delete(c.receipts, r)
+	c.Unlock()
+	if ok {
+		ch <- err
+	}
+}
+
+func (c *conn) closeProducer(producerID uint64) {
+	c.Lock()
+	p, ok := c.producers[producerID]
+	delete(c.producers, producerID)
+	for r, ch := range c.receipts {
+		if r.producerID == producerID {
+			delete(c.receipts, r)
+			ch <- ErrProducerClosed
+		}
+	}
+	c.Unlock()
+	if ok {
+		p.close()
+	}
+}
+
+// fail breaks the connection, requests and sends waiting for a response fail with err
+func (c *conn) fail(err error) {
+	c.Lock()
+	defer c.Unlock()
+	if c.err != nil {
+		return
+	}
+	c.err = err
+	close(c.done)
+	c.Conn.Close()
+}
+
+// broken returns the error which broke the connection, if any
+func (c *conn) broken() error {
+	c.Lock()
+	defer c.Unlock()
+	return c.err
+}
+
+func (c *conn) write(frame []byte) error {
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+	c.Conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	_, err := c.Conn.Write(frame)
+	if err != nil {
+		return fmt.Errorf("Write.%s", err)
+	}
+	return nil
+}
+
+// request sends a command and waits for the response of the broker to requestID
+func (c *conn) request(ctx context.Context, requestID uint64, command []byte) (*response, error) {
+	ch := make(chan *response, 1)
+	c.Lock()
+	if c.err != nil {
+		c.Unlock()
+		return nil, ErrConnClosed
+	}
+	c.requests[requestID] = ch
+	c.Unlock()
+	defer func() {
+		c.Lock()
+		delete(c.requests, requestID)
+		c.Unlock()
+	}()
+	err := c.write(simpleFrame(command))
+	if err != nil {
+		c.fail(err)
+		return nil, err
+	}
+	select {
+	case res := <-ch:
+		return res, res.err
+	case <-c.done:
+		return nil, fmt.Errorf("%s: %s", ErrConnClosed, c.broken())
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// send writes a message frame, the broker receipt or error is delivered to the returned channel
+func (c *conn) send(r receipt, frame []byte) (<-chan error, error) {
+	ch := make(chan error, 1)
+	c.Lock()
+	if c.err != nil {
+		c.Unlock()
+		return nil, ErrConnClosed
+	}
+	c.receipts[r] = ch
+	c.Unlock()
+	err := c.write(frame)
+	if err != nil {
+		c.Lock()
+		delete(c.receipts, r)
+		c.Unlock()
+		c.fail(err)
+		return nil, err
+	}
+	return ch, nil
+}
+
+func (c *conn) register(p *topicProducer) {
+	c.Lock()
+	c.producers[p.id] = p
+	c.Unlock()
+}
+
+// unregister forgets the producer and its pending receipts, the broker closes it once told so
+func (c *conn) unregister(producerID, requestID uint64) {
+	c.Lock()
+	delete(c.producers, producerID)
+	for r := range c.receipts {
+		if r.producerID == producerID {
+			delete(c.receipts, r)
+		}
+	}
+	c.Unlock()
+	c.write(simpleFrame(encodeCommand(typeCloseProducer, func(e *proto.Encoder) {
+		e.PutVarint(1, producerID)
+		e.PutVarint(2, requestID)
+	})))
+}
+
+// close terminates the connection
+func (c *conn) close() {
+	c.fail(ErrConnClosed)
+}
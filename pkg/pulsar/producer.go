@@ -0,0 +1,429 @@
+package pulsar
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf16"
+
+	"github.com/khezen/bulklog/pkg/proto"
+)
+
+const (
+	// maxRedirects bounds lookups redirected from broker to broker
+	maxRedirects = 20
+	// partitionsTTL - partitions of topics are looked up again after that long, as they may be increased
+	partitionsTTL = time.Minute
+)
+
+var (
+	// ErrUnsupportedURL -
+	ErrUnsupportedURL = errors.New("ErrUnsupportedURL - pulsar url must be pulsar://host:port or pulsar+ssl://host:port")
+	// ErrTooManyRedirects - lookups kept on being redirected
+	ErrTooManyRedirects = errors.New("ErrTooManyRedirects - pulsar topic lookup redirected too many times")
+	// ErrMessageTooLarge - a batch exceeds the maximum message size of the broker
+	ErrMessageTooLarge = errors.New("ErrMessageTooLarge - pulsar batch exceeds broker max message size")
+)
+
+// ProducerConfig -
+type ProducerConfig struct {
+	// URL - service URL, pulsar://host:6650 or pulsar+ssl://host:6651
+	URL string
+	// Token - JWT of token authentication, none if empty
+	Token string
+	// TLS settings of pulsar+ssl connections
+	TLS         *tls.Config
+	Compression Compression
+	Batch       BatchConfig
+	// Timeout bounds lookups and producer creations, 30 seconds by default
+	Timeout time.Duration
+}
+
+// Producer publishes messages to pulsar brokers using the pulsar binary protocol.
+// A producer is created on the owner broker of each topic, or partition, the first time messages are sent to it.
+type Producer struct {
+	sync.Mutex
+	cfg         ProducerConfig
+	serviceAddr string
+	tls         bool
+	conns       map[string]*conn
+	producers   map[string]*topicProducer
+	partitions  map[string]partitions
+	ids         uint64
+	roundRobin  uint32
+}
+
+type partitions struct {
+	count     int
+	fetchedAt time.Time
+}
+
+// topicProducer - producer of a topic, or partition, on its owner broker
+type topicProducer struct {
+	sync.Mutex
+	id         uint64
+	name       string
+	conn       *conn
+	sequenceID uint64
+	closed     int32
+}
+
+func (p *topicProducer) close() {
+	atomic.StoreInt32(&p.closed, 1)
+}
+
+func (p *topicProducer) usable() bool {
+	return atomic.LoadInt32(&p.closed) == 0 && p.conn.broken() == nil
+}
+
+// NewProducer -
+func NewProducer(cfg ProducerConfig) (*Producer, error) {
+	addr, useTLS, err := parseURL(cfg.URL)
+	if err != nil {
+		return nil, err
+	}
+	if err = cfg.Compression.Validate(); err != nil {
+		return nil, err
+	}
+	if useTLS && cfg.TLS == nil {
+		cfg.TLS = &tls.Config{}
+	}
+	if !useTLS {
+		cfg.TLS = nil
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 30 * time.Second
+	}
+	if cfg.Batch.MaxMessages <= 0 {
+		cfg.Batch.MaxMessages = defaultBatchMaxMessages
+	}
+	if cfg.Batch.MaxBytes <= 0 {
+		cfg.Batch.MaxBytes = defaultBatchMaxBytes
+	}
+	return &Producer{
+		cfg:         cfg,
+		serviceAddr: addr,
+		tls:         useTLS,
+		conns:       make(map[string]*conn),
+		producers:   make(map[string]*topicProducer),
+		partitions:  make(map[string]partitions),
+	}, nil
+}
+
+// parseURL returns the address of a pulsar URL and whether it is encrypted
+func parseURL(rawURL string) (addr string, useTLS bool, err error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", false, fmt.Errorf("url.Parse.%s", err)
+	}
+	var port string
+	switch u.Scheme {
+	case "pulsar":
+		port = "6650"
+	case "pulsar+ssl":
+		port, useTLS = "6651", true
+	default:
+		return "", false, ErrUnsupportedURL
+	}
+	if u.Hostname() == "" {
+		return "", false, ErrUnsupportedURL
+	}
+	if u.Port() != "" {
+		port = u.Port()
+	}
+	return net.JoinHostPort(u.Hostname(), port), useTLS, nil
+}
+
+func (p *Producer) nextID() uint64 {
+	return atomic.AddUint64(&p.ids, 1)
+}
+
+// Produce publishes messages to the topic, in batches, and waits for brokers to persist them.
+// Messages of partitioned topics are routed by key as java clients do, batches of messages without key are spread round robin.
+func (p *Producer) Produce(ctx context.Context, topic string, messages []Message) error {
+	if len(messages) == 0 {
+		return nil
+	}
+	count, err := p.partitionCount(ctx, topic)
+	if err != nil {
+		return fmt.Errorf("partitionCount.%s", err)
+	}
+	byTopic := make(map[string][]*batch)
+	if count == 0 {
+		byTopic[topic] = split(messages, p.cfg.Batch)
+	} else {
+		var (
+			keyed   = make(map[int][]Message)
+			keyless []Message
+		)
+		for _, msg := range messages {
+			if msg.Key == "" {
+				keyless = append(keyless, msg)
+				continue
+			}
+			i := int(javaStringHash(msg.Key) % uint32(count))
+			keyed[i] = append(keyed[i], msg)
+		}
+		for i, msgs := range keyed {
+			name := partitionTopic(topic, i)
+			byTopic[name] = append(byTopic[name], split(msgs, p.cfg.Batch)...)
+		}
+		for _, b := range split(keyless, p.cfg.Batch) {
+			i := int(atomic.AddUint32(&p.roundRobin, 1) % uint32(count))
+			name := partitionTopic(topic, i)
+			byTopic[name] = append(byTopic[name], b)
+		}
+	}
+	for name, batches := range byTopic {
+		err = p.produce(ctx, name, batches)
+		if err != nil {
+			return fmt.Errorf("produce(%s).%s", name, err)
+		}
+	}
+	return nil
+}
+
+func partitionTopic(topic string, i int) string {
+	return fmt.Sprintf("%s-partition-%d", topic, i)
+}
+
+// javaStringHash - String.hashCode of java, the default hashing scheme of pulsar clients
+func javaStringHash(key string) uint32 {
+	var h int32
+	for _, c := range utf16.Encode([]rune(key)) {
+		h = 31*h + int32(c)
+	}
+	return uint32(h) & 0x7fffffff
+}
+
+// produce sends batches to the producer of a topic then waits for their receipts.
+// The producer is dropped on failure, so the next try looks the topic up again.
+func (p *Producer) produce(ctx context.Context, topic string, batches []*batch) (err error) {
+	tp, err := p.topicProducer(ctx, topic)
+	if err != nil {
+		return fmt.Errorf("topicProducer.%s", err)
+	}
+	defer func() {
+		if err != nil {
+			p.dropProducer(topic, tp)
+		}
+	}()
+	receipts := make([]<-chan error, 0, len(batches))
+	for _, b := range batches {
+		ch, err := tp.send(b, p.cfg.Compression)
+		if err != nil {
+			return fmt.Errorf("send.%s", err)
+		}
+		receipts = append(receipts, ch)
+	}
+	for _, ch := range receipts {
+		select {
+		case err = <-ch:
+			if err != nil {
+				return err
+			}
+		case <-tp.conn.done:
+			return fmt.Errorf("%s: %s", ErrConnClosed, tp.conn.broken())
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+func (tp *topicProducer) send(b *batch, compression Compression) (<-chan error, error) {
+	// sequence ids are sent in order, as brokers deduplicating messages expect
+	tp.Lock()
+	defer tp.Unlock()
+	metadata, payload, err := b.encode(tp.name, tp.sequenceID, compression)
+	if err != nil {
+		return nil, fmt.Errorf("encode.%s", err)
+	}
+	if len(metadata)+len(payload) > tp.conn.maxMessageSize {
+		return nil, ErrMessageTooLarge
+	}
+	command := encodeCommand(typeSend, func(e *proto.Encoder) {
+		e.PutVarint(1, tp.id)
+		e.PutVarint(2, tp.sequenceID)
+		e.PutVarint(3, uint64(len(b.messages)))
+	})
+	ch, err := tp.conn.send(receipt{tp.id, tp.sequenceID}, payloadFrame(command, metadata, payload))
+	if err != nil {
+		return nil, err
+	}
+	tp.sequenceID++
+	return ch, nil
+}
+
+// topicProducer returns the producer of a topic, created on its owner broker unless it still works
+func (p *Producer) topicProducer(ctx context.Context, topic string) (*topicProducer, error) {
+	p.Lock()
+	tp, ok := p.producers[topic]
+	p.Unlock()
+	if ok && tp.usable() {
+		return tp, nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, p.cfg.Timeout)
+	defer cancel()
+	logical, physical, err := p.lookup(ctx, topic)
+	if err != nil {
+		return nil, fmt.Errorf("lookup.%s", err)
+	}
+	c, err := p.conn(ctx, logical, physical)
+	if err != nil {
+		return nil, fmt.Errorf("conn.%s", err)
+	}
+	tp = &topicProducer{
+		id:   p.nextID(),
+		conn: c,
+	}
+	c.register(tp)
+	requestID := p.nextID()
+	res, err := c.request(ctx, requestID, encodeCommand(typeProducer, func(e *proto.Encoder) {
+		e.String(1, topic)
+		e.PutVarint(2, tp.id)
+		e.PutVarint(3, requestID)
+	}))
+	if err != nil {
+		c.unregister(tp.id, p.nextID())
+		return nil, fmt.Errorf("request(producer).%s", err)
+	}
+	tp.name = res.producerName
+	tp.sequenceID = uint64(res.lastSequenceID + 1)
+	p.Lock()
+	p.producers[topic] = tp
+	p.Unlock()
+	return tp, nil
+}
+
+func (p *Producer) dropProducer(topic string, tp *topicProducer) {
+	p.Lock()
+	if p.producers[topic] == tp {
+		delete(p.producers, topic)
+	}
+	p.Unlock()
+	tp.close()
+	if tp.conn.broken() == nil {
+		tp.conn.unregister(tp.id, p.nextID())
+	}
+}
+
+// lookup returns the broker URL owning the topic and the address to connect to it, the one of the proxy if brokers are proxied
+func (p *Producer) lookup(ctx context.Context, topic string) (logical, physical string, err error) {
+	var (
+		addr          = p.serviceAddr
+		proxyTo       string
+		authoritative bool
+	)
+	for i := 0; i < maxRedirects; i++ {
+		c, err := p.conn(ctx, proxyTo, addr)
+		if err != nil {
+			return "", "", fmt.Errorf("conn.%s", err)
+		}
+		requestID := p.nextID()
+		res, err := c.request(ctx, requestID, encodeCommand(typeLookup, func(e *proto.Encoder) {
+			e.String(1, topic)
+			e.PutVarint(2, requestID)
+			e.Bool(3, authoritative)
+		}))
+		if err != nil {
+			return "", "", fmt.Errorf("request(lookup).%s", err)
+		}
+		brokerURL := res.brokerURL
+		if p.tls {
+			brokerURL = res.brokerURLTLS
+		}
+		brokerAddr, _, err := parseURL(brokerURL)
+		if err != nil {
+			return "", "", fmt.Errorf("parseURL(%s).%s", brokerURL, err)
+		}
+		if res.proxyToService {
+			addr, proxyTo = p.serviceAddr, brokerURL
+		} else {
+			addr, proxyTo = brokerAddr, ""
+		}
+		if res.lookupType == lookupConnect {
+			return proxyTo, addr, nil
+		}
+		authoritative = res.authoritative
+	}
+	return "", "", ErrTooManyRedirects
+}
+
+// partitionCount - partitions of the topic, 0 if it is not partitioned
+func (p *Producer) partitionCount(ctx context.Context, topic string) (int, error) {
+	p.Lock()
+	cached, ok := p.partitions[topic]
+	p.Unlock()
+	if ok && time.Since(cached.fetchedAt) < partitionsTTL {
+		return cached.count, nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, p.cfg.Timeout)
+	defer cancel()
+	c, err := p.conn(ctx, "", p.serviceAddr)
+	if err != nil {
+		return 0, fmt.Errorf("conn.%s", err)
+	}
+	requestID := p.nextID()
+	res, err := c.request(ctx, requestID, encodeCommand(typePartitionedMetadata, func(e *proto.Encoder) {
+		e.String(1, topic)
+		e.PutVarint(2, requestID)
+	}))
+	if err != nil {
+		return 0, fmt.Errorf("request(partitionedMetadata).%s", err)
+	}
+	p.Lock()
+	p.partitions[topic] = partitions{res.partitions, time.Now()}
+	p.Unlock()
+	return res.partitions, nil
+}
+
+// conn returns a connection to addr, proxied to the broker at proxyTo if set, dialing it unless one still works
+func (p *Producer) conn(ctx context.Context, proxyTo, addr string) (*conn, error) {
+	key := addr
+	if proxyTo != "" {
+		key = fmt.Sprintf("%s>%s", addr, proxyTo)
+	}
+	p.Lock()
+	c, ok := p.conns[key]
+	p.Unlock()
+	if ok && c.broken() == nil {
+		return c, nil
+	}
+	c, err := dial(ctx, addr, proxyTo, p.cfg.Token, p.cfg.TLS)
+	if err != nil {
+		return nil, fmt.Errorf("dial(%s).%s", addr, err)
+	}
+	p.Lock()
+	if existing, ok := p.conns[key]; ok && existing.broken() == nil {
+		p.Unlock()
+		c.close()
+		return existing, nil
+	}
+	p.conns[key] = c
+	p.Unlock()
+	return c, nil
+}
+
+// Ping checks the service URL is reachable
+func (p *Producer) Ping(ctx context.Context) error {
+	_, err := p.conn(ctx, "", p.serviceAddr)
+	return err
+}
+
+// Close closes connections to brokers
+func (p *Producer) Close() {
+	p.Lock()
+	defer p.Unlock()
+	for key, c := range p.conns {
+		c.close()
+		delete(p.conns, key)
+	}
+	p.producers = make(map[string]*topicProducer)
+}
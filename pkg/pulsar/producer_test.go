@@ -0,0 +1,330 @@
+package pulsar
+
+import (
+	"context"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/khezen/bulklog/pkg/proto"
+)
+
+// fakeBroker answers the commands of producers for topic logs, partitioned twice, owning it itself
+type fakeBroker struct {
+	t        *testing.T
+	listener net.Listener
+	mu       sync.Mutex
+	// topics of producers by id
+	topics map[uint64]string
+	// produced - messages and sequence ids by topic
+	produced  map[string][]Message
+	sequences map[string][]uint64
+	// sendError - code of the SEND_ERROR answering sends, none if negative
+	sendError int
+}
+
+func newFakeBroker(t *testing.T) *fakeBroker {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &fakeBroker{
+		t:         t,
+		listener:  listener,
+		topics:    make(map[uint64]string),
+		produced:  make(map[string][]Message),
+		sequences: make(map[string][]uint64),
+		sendError: -1,
+	}
+	go b.serve()
+	t.Cleanup(func() { listener.Close() })
+	return b
+}
+
+func (b *fakeBroker) url() string {
+	return "pulsar://" + b.listener.Addr().String()
+}
+
+func (b *fakeBroker) serve() {
+	for {
+		conn, err := b.listener.Accept()
+		if err != nil {
+			return
+		}
+		go b.handle(conn)
+	}
+}
+
+// command - fields of a command received by the broker, varints and bytes by field
+type command struct {
+	typ     int
+	varints map[int]uint64
+	strings map[int]string
+}
+
+func decodeCommand(buf []byte) (*command, error) {
+	var (
+		base  = proto.NewDecoder(buf)
+		inner []byte
+		c     = &command{varints: make(map[int]uint64), strings: make(map[int]string)}
+	)
+	for base.Next() {
+		if base.Field() == 1 {
+			c.typ = int(base.Uint64())
+		} else {
+			inner = base.Bytes()
+		}
+	}
+	d := proto.NewDecoder(inner)
+	for d.Next() {
+		if d.WireType() == proto.Bytes {
+			c.strings[d.Field()] = d.String()
+		} else {
+			c.varints[d.Field()] = d.Uint64()
+		}
+	}
+	if base.Err() != nil {
+		return nil, base.Err()
+	}
+	return c, d.Err()
+}
+
+func (b *fakeBroker) handle(conn net.Conn) {
+	defer conn.Close()
+	for {
+		size := make([]byte, 4)
+		_, err := io.ReadFull(conn, size)
+		if err != nil {
+			return
+		}
+		frame := make([]byte, binary.BigEndian.Uint32(size))
+		_, err = io.ReadFull(conn, frame)
+		if err != nil {
+			return
+		}
+		commandSize := binary.BigEndian.Uint32(frame[:4])
+		c, err := decodeCommand(frame[4 : 4+commandSize])
+		if err != nil {
+			b.t.Errorf("decodeCommand: %s", err)
+			return
+		}
+		var res []byte
+		switch c.typ {
+		case typeConnect:
+			if c.strings[1] != clientVersion || c.varints[4] != protocolVersion || c.strings[5] != "token" || c.strings[3] != "secret" {
+				b.t.Errorf("connect command %+v", c)
+			}
+			res = encodeCommand(typeConnected, func(e *proto.Encoder) {
+				e.String(1, "fake")
+				e.PutVarint(2, protocolVersion)
+			})
+		case typePartitionedMetadata:
+			res = encodeCommand(typePartitionedMetadataResponse, func(e *proto.Encoder) {
+				e.PutVarint(1, 2)
+				e.PutVarint(2, c.varints[2])
+			})
+		case typeLookup:
+			res = encodeCommand(typeLookupResponse, func(e *proto.Encoder) {
+				e.String(1, b.url())
+				e.PutVarint(3, lookupConnect)
+				e.PutVarint(4, c.varints[2])
+			})
+		case typeProducer:
+			b.mu.Lock()
+			b.topics[c.varints[2]] = c.strings[1]
+			b.mu.Unlock()
+			res = encodeCommand(typeProducerSuccess, func(e *proto.Encoder) {
+				e.PutVarint(1, c.varints[3])
+				e.String(2, "fake-producer")
+				e.PutVarint(3, 9)
+			})
+		case typeSend:
+			res = b.send(c, frame[4+commandSize:])
+		case typeCloseProducer:
+			res = encodeCommand(typeSuccess, func(e *proto.Encoder) {
+				e.PutVarint(1, c.varints[2])
+			})
+		default:
+			b.t.Errorf("unexpected command %d", c.typ)
+			return
+		}
+		_, err = conn.Write(simpleFrame(res))
+		if err != nil {
+			return
+		}
+	}
+}
+
+// send stores the messages of a batch, once its checksum and metadata are checked
+func (b *fakeBroker) send(c *command, rest []byte) []byte {
+	producerID, sequenceID := c.varints[1], c.varints[2]
+	if len(rest) < 10 || binary.BigEndian.Uint16(rest[:2]) != magicCRC32C {
+		b.t.Errorf("send without checksum")
+	} else if crc32.Checksum(rest[6:], crc32.MakeTable(crc32.Castagnoli)) != binary.BigEndian.Uint32(rest[2:6]) {
+		b.t.Errorf("send of invalid checksum")
+	}
+	metadataSize := binary.BigEndian.Uint32(rest[6:10])
+	metadata, payload := rest[10:10+metadataSize], rest[10+metadataSize:]
+	var messages []Message
+	d := proto.NewDecoder(metadata)
+	for d.Next() {
+		if d.Field() == 8 && d.Uint64() != compressionNone {
+			b.t.Errorf("send of compressed messages")
+		}
+	}
+	for len(payload) > 0 {
+		singleSize := binary.BigEndian.Uint32(payload[:4])
+		var msg Message
+		var payloadSize uint64
+		d = proto.NewDecoder(payload[4 : 4+singleSize])
+		for d.Next() {
+			switch d.Field() {
+			case 2:
+				msg.Key = d.String()
+			case 3:
+				payloadSize = d.Uint64()
+			}
+		}
+		payload = payload[4+singleSize:]
+		msg.Payload, payload = payload[:payloadSize], payload[payloadSize:]
+		messages = append(messages, msg)
+	}
+	if uint64(len(messages)) != c.varints[3] {
+		b.t.Errorf("send of %d messages, %d in the batch", c.varints[3], len(messages))
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.sendError >= 0 {
+		return encodeCommand(typeSendError, func(e *proto.Encoder) {
+			e.PutVarint(1, producerID)
+			e.PutVarint(2, sequenceID)
+			e.PutVarint(3, uint64(b.sendError))
+			e.String(4, "rejected")
+		})
+	}
+	topic := b.topics[producerID]
+	b.produced[topic] = append(b.produced[topic], messages...)
+	b.sequences[topic] = append(b.sequences[topic], sequenceID)
+	return encodeCommand(typeSendReceipt, func(e *proto.Encoder) {
+		e.PutVarint(1, producerID)
+		e.PutVarint(2, sequenceID)
+	})
+}
+
+func (b *fakeBroker) messages(topic string) []Message {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.produced[topic]
+}
+
+func TestProduce(t *testing.T) {
+	broker := newFakeBroker(t)
+	producer, err := NewProducer(ProducerConfig{
+		URL:     broker.url(),
+		Token:   "secret",
+		Timeout: 5 * time.Second,
+		Batch:   BatchConfig{MaxMessages: 2},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer producer.Close()
+	// String.hashCode of "a" is 97, routing it to partition 1 of 2, the one of "b" is 98
+	err = producer.Produce(context.Background(), "logs", []Message{
+		{Key: "a", Payload: []byte("1")},
+		{Key: "b", Payload: []byte("2")},
+		{Key: "a", Payload: []byte("3")},
+		{Key: "a", Payload: []byte("4")},
+	})
+	if err != nil {
+		t.Fatalf("Produce: %s", err)
+	}
+	assertMessages(t, broker.messages("logs-partition-1"), []Message{{Key: "a", Payload: []byte("1")}, {Key: "a", Payload: []byte("3")}, {Key: "a", Payload: []byte("4")}})
+	assertMessages(t, broker.messages("logs-partition-0"), []Message{{Key: "b", Payload: []byte("2")}})
+	// sequence ids follow the last one the broker persisted
+	broker.mu.Lock()
+	sequences := broker.sequences["logs-partition-1"]
+	broker.mu.Unlock()
+	if len(sequences) != 2 || sequences[0] != 10 || sequences[1] != 11 {
+		t.Fatalf("sequence ids %v, want [10 11]", sequences)
+	}
+	// batches of unkeyed messages are spread round robin
+	err = producer.Produce(context.Background(), "logs", []Message{{Payload: []byte("5")}, {Payload: []byte("6")}, {Payload: []byte("7")}})
+	if err != nil {
+		t.Fatalf("Produce: %s", err)
+	}
+	if len(broker.messages("logs-partition-0")) == 1 || len(broker.messages("logs-partition-1")) == 3 {
+		t.Fatal("unkeyed batches were not spread over both partitions")
+	}
+}
+
+func TestProduceSendError(t *testing.T) {
+	broker := newFakeBroker(t)
+	broker.sendError = 9
+	producer, err := NewProducer(ProducerConfig{URL: broker.url(), Token: "secret", Timeout: 5 * time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer producer.Close()
+	err = producer.Produce(context.Background(), "logs", []Message{{Key: "a", Payload: []byte("1")}})
+	if want := "produce(logs-partition-1).pulsar: ChecksumError: rejected"; err == nil || err.Error() != want {
+		t.Fatalf("Produce: got %v, want %s", err, want)
+	}
+}
+
+// TestJavaStringHash checks keys hash as String.hashCode, so they land on the partitions java producers pick
+func TestJavaStringHash(t *testing.T) {
+	vectors := map[string]uint32{
+		"":      0,
+		"a":     97,
+		"hello": 99162322,
+		"Hello": 69609650,
+		"é":     233,
+		// surrogate pairs hash as two chars
+		"😀": 1772899,
+		// hashCode is math.MinInt32, masked positive
+		"polygenelubricants": 0,
+	}
+	for key, want := range vectors {
+		if got := javaStringHash(key); got != want {
+			t.Errorf("javaStringHash(%q) = %d, want %d", key, got, want)
+		}
+	}
+}
+
+func TestParseURL(t *testing.T) {
+	urls := map[string]struct {
+		addr   string
+		useTLS bool
+		err    error
+	}{
+		"pulsar://broker":            {"broker:6650", false, nil},
+		"pulsar+ssl://broker":        {"broker:6651", true, nil},
+		"pulsar://broker:7000":       {"broker:7000", false, nil},
+		"http://broker:8080":         {"", false, ErrUnsupportedURL},
+		"pulsar://":                  {"", false, ErrUnsupportedURL},
+		"pulsar+ssl://[::1]:6651/ns": {"[::1]:6651", true, nil},
+	}
+	for raw, want := range urls {
+		addr, useTLS, err := parseURL(raw)
+		if addr != want.addr || useTLS != want.useTLS || err != want.err {
+			t.Errorf("parseURL(%s) = %s, %v, %v, want %s, %v, %v", raw, addr, useTLS, err, want.addr, want.useTLS, want.err)
+		}
+	}
+}
+
+func assertMessages(t *testing.T, messages, want []Message) {
+	t.Helper()
+	if len(messages) != len(want) {
+		t.Fatalf("produced %d messages, want %d", len(messages), len(want))
+	}
+	for i := range messages {
+		if messages[i].Key != want[i].Key || string(messages[i].Payload) != string(want[i].Payload) {
+			t.Fatalf("message %d = %+v, want %+v", i, messages[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package ratelimit
+
+import "errors"
+
+var (
+	// ErrUnknownKey - limiter key is not supported
+	ErrUnknownKey = errors.New("ErrUnknownKey - rate_limit key must be one of ip|api_key")
+	// ErrNegativeLimit - rates and bursts cannot be negative
+	ErrNegativeLimit = errors.New("ErrNegativeLimit - rates and bursts must not be negative")
+)
+
+// Key - what clients are told apart by
+type Key string
+
+const (
+	// ByIP limits each source IP
+	ByIP Key = "ip"
+	// ByAPIKey limits each authenticated client, by the name of its key or the subject of its token.
+	// Requests which are not authenticated are limited by source IP.
+	ByAPIKey Key = "api_key"
+)
+
+// Config - per client limits of ingestion requests, disabled unless a rate is set
+type Config struct {
+	Key Key `yaml:"key"`
+	// rates of every client, unless overridden
+	RequestsPerSecond  float64 `yaml:"requests_per_second"`
+	RequestsBurst      int     `yaml:"requests_burst"`
+	DocumentsPerSecond float64 `yaml:"documents_per_second"`
+	DocumentsBurst     int     `yaml:"documents_burst"`
+	// Clients overrides limits per client, by IP or by client name
+	Clients map[string]Limits `yaml:"clients"`
+	// TrustForwardedFor reads source IPs from the X-Forwarded-For header appended by a reverse proxy
+	TrustForwardedFor bool `yaml:"trust_forwarded_for"`
+}
+
+// Enabled tells whether any rate is limited
+func (c Config) Enabled() bool {
+	if c.limits().enabled() {
+		return true
+	}
+	for _, limits := range c.Clients {
+		if limits.enabled() {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate checks the key and limits
+func (c Config) Validate() error {
+	switch c.Key {
+	case "", ByIP, ByAPIKey:
+	default:
+		return ErrUnknownKey
+	}
+	if !c.limits().valid() {
+		return ErrNegativeLimit
+	}
+	for _, limits := range c.Clients {
+		if !limits.valid() {
+			return ErrNegativeLimit
+		}
+	}
+	return nil
+}
+
+func (c Config) limits() Limits {
+	return Limits{c.RequestsPerSecond, c.RequestsBurst, c.DocumentsPerSecond, c.DocumentsBurst}
+}
+
+// Limits - rates a client is allowed, unlimited if zero.
+// Bursts default to one second of rate.
+type Limits struct {
+	RequestsPerSecond  float64 `yaml:"requests_per_second"`
+	RequestsBurst      int     `yaml:"requests_burst"`
+	DocumentsPerSecond float64 `yaml:"documents_per_second"`
+	DocumentsBurst     int     `yaml:"documents_burst"`
+}
+
+func (l Limits) enabled() bool {
+	return l.RequestsPerSecond > 0 || l.DocumentsPerSecond > 0
+}
+
+func (l Limits) valid() bool {
+	return l.RequestsPerSecond >= 0 && l.RequestsBurst >= 0 && l.DocumentsPerSecond >= 0 && l.DocumentsBurst >= 0
+}
@@ -0,0 +1,146 @@
+package ratelimit
+
+import (
+	"errors"
+	"math"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// idleTimeout after which the buckets of a client which sent nothing are dropped
+const idleTimeout = 10 * time.Minute
+
+// ErrRateLimited - client exceeded its rate
+var ErrRateLimited = errors.New("ErrRateLimited - too many requests or documents, retry later")
+
+// Limiter keeps a token bucket of requests and one of documents per client
+type Limiter struct {
+	sync.Mutex
+	cfg     Config
+	clients map[string]*client
+	sweptAt time.Time
+}
+
+type client struct {
+	requests  bucket
+	documents bucket
+	seenAt    time.Time
+}
+
+// New returns nil if no rate is limited
+func New(cfg Config) *Limiter {
+	if !cfg.Enabled() {
+		return nil
+	}
+	if cfg.Key == "" {
+		cfg.Key = ByIP
+	}
+	return &Limiter{
+		cfg:     cfg,
+		clients: make(map[string]*client),
+		sweptAt: time.Now(),
+	}
+}
+
+// Client returns the key the request is limited by, name is the authenticated client name if any
+func (l *Limiter) Client(r *http.Request, name string) string {
+	if l.cfg.Key == ByAPIKey && name != "" {
+		return name
+	}
+	if l.cfg.TrustForwardedFor {
+		if forwarded := r.Header.Values("X-Forwarded-For"); len(forwarded) > 0 {
+			// the last address is the one the proxy received the request from
+			hops := strings.Split(forwarded[len(forwarded)-1], ",")
+			if ip := strings.TrimSpace(hops[len(hops)-1]); ip != "" {
+				return ip
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// AllowRequest takes a request token, it returns how long the client should wait if it has none left
+func (l *Limiter) AllowRequest(key string) (time.Duration, bool) {
+	l.Lock()
+	defer l.Unlock()
+	c := l.client(key)
+	return c.requests.take(1, false, time.Now())
+}
+
+// AllowDocuments takes n document tokens. A batch larger than the burst is allowed once the bucket is full,
+// the client then waits until its debt is paid back.
+func (l *Limiter) AllowDocuments(key string, n int) (time.Duration, bool) {
+	l.Lock()
+	defer l.Unlock()
+	c := l.client(key)
+	return c.documents.take(float64(n), true, time.Now())
+}
+
+func (l *Limiter) client(key string) *client {
+	now := time.Now()
+	if now.Sub(l.sweptAt) > idleTimeout {
+		for k, c := range l.clients {
+			if now.Sub(c.seenAt) > idleTimeout {
+				delete(l.clients, k)
+			}
+		}
+		l.sweptAt = now
+	}
+	c, ok := l.clients[key]
+	if !ok {
+		limits, ok := l.cfg.Clients[key]
+		if !ok {
+			limits = l.cfg.limits()
+		}
+		c = &client{
+			requests:  newBucket(limits.RequestsPerSecond, limits.RequestsBurst, now),
+			documents: newBucket(limits.DocumentsPerSecond, limits.DocumentsBurst, now),
+		}
+		l.clients[key] = c
+	}
+	c.seenAt = now
+	return c
+}
+
+// bucket - token bucket, unlimited if its rate is zero
+type bucket struct {
+	rate      float64
+	burst     float64
+	tokens    float64
+	updatedAt time.Time
+}
+
+func newBucket(rate float64, burst int, now time.Time) bucket {
+	b := bucket{rate: rate, burst: float64(burst), updatedAt: now}
+	if b.burst <= 0 {
+		b.burst = math.Max(1, rate)
+	}
+	b.tokens = b.burst
+	return b
+}
+
+// take n tokens; with debt, n is taken as long as the bucket is not in debt already
+func (b *bucket) take(n float64, debt bool, now time.Time) (time.Duration, bool) {
+	if b.rate <= 0 {
+		return 0, true
+	}
+	b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.updatedAt).Seconds()*b.rate)
+	b.updatedAt = now
+	needed := n
+	if debt {
+		// enough tokens to take a batch larger than the burst
+		needed = math.Min(n, b.burst)
+	}
+	if b.tokens < needed {
+		return time.Duration((needed - b.tokens) / b.rate * float64(time.Second)), false
+	}
+	b.tokens -= n
+	return 0, true
+}
@@ -0,0 +1,93 @@
+package server
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/khezen/bulklog/pkg/auth"
+	"github.com/khezen/bulklog/pkg/collection"
+	"github.com/khezen/bulklog/pkg/tenant"
+)
+
+// verifier is swapped as a whole on reload, so keys can be rotated without restart
+type verifier struct {
+	auth.Verifier
+}
+
+// call - client of a gRPC call, authenticated and limited once per call
+type call struct {
+	principal *auth.Principal
+	client    string
+	tenant    string
+	err       error
+}
+
+type callKey struct{}
+
+// authenticate verifies the request credentials, the principal is nil if authentication is disabled
+func (s *Server) authenticate(header http.Header) (*auth.Principal, error) {
+	v := s.verifier.Load()
+	if v == nil || v.Verifier == nil {
+		return nil, nil
+	}
+	return v.Verify(header)
+}
+
+// authorize checks the client authenticated by the request may write to the collection
+func (s *Server) authorize(header http.Header, collectionName collection.Name) (*auth.Principal, error) {
+	principal, err := s.authenticate(header)
+	if err != nil {
+		return nil, err
+	}
+	return principal, canWrite(principal, collectionName)
+}
+
+// withCall authenticates a gRPC call, resolves its tenant and takes its request token, collections are authorized per request of the call
+func (s *Server) withCall(r *http.Request) context.Context {
+	principal, err := s.authenticate(r.Header)
+	c := call{principal: principal, err: err}
+	if err == nil {
+		c.tenant, c.err = s.tenantOf(r.Header, principal)
+	}
+	if c.err == nil {
+		c.client, _, c.err = s.limitRequest(r, principal)
+	}
+	ctx := context.WithValue(r.Context(), callKey{}, c)
+	if c.tenant != "" {
+		ctx = tenant.WithID(ctx, c.tenant)
+	}
+	return ctx
+}
+
+// authorizeCall checks the client of the gRPC call may write documents to the collection
+func (s *Server) authorizeCall(ctx context.Context, collectionName collection.Name, documents int) error {
+	c, _ := ctx.Value(callKey{}).(call)
+	if c.err != nil {
+		return c.err
+	}
+	err := canWrite(c.principal, collectionName)
+	if err != nil {
+		return err
+	}
+	_, err = s.limitDocuments(c.client, documents)
+	return err
+}
+
+// authorizeAdmin checks the client authenticated by the request may call the admin API
+func (s *Server) authorizeAdmin(header http.Header) error {
+	principal, err := s.authenticate(header)
+	if err != nil {
+		return err
+	}
+	if principal != nil && !principal.Admin {
+		return auth.ErrForbiddenAdmin
+	}
+	return nil
+}
+
+func canWrite(principal *auth.Principal, collectionName collection.Name) error {
+	if principal != nil && !principal.CanWrite(string(collectionName)) {
+		return auth.ErrForbidden
+	}
+	return nil
+}
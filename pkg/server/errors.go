@@ -5,9 +5,12 @@ import (
 	"io"
 	"net/http"
 
+	"github.com/khezen/bulklog/pkg/auth"
 	"github.com/khezen/bulklog/pkg/collection"
 	"github.com/khezen/bulklog/pkg/engine"
-	"github.com/khezen/bulklog/pkg/log"
+	"github.com/khezen/bulklog/pkg/grpc"
+	"github.com/khezen/bulklog/pkg/ratelimit"
+	"github.com/khezen/bulklog/pkg/tenant"
 )
 
 var (
@@ -15,26 +18,91 @@ var (
 	ErrPathNotFound = errors.New("ErrPathNotFound - The request path is not supported")
 	// ErrWrongMethod - 405
 	ErrWrongMethod = errors.New("ErrWrongMethod - The request http method does not match expectation")
+	// ErrUnparsableBody - 400
+	ErrUnparsableBody = errors.New("ErrUnparsableBody - request body does not match its Content-Encoding")
+	// ErrUnsupportedEncoding - 415
+	ErrUnsupportedEncoding = errors.New("ErrUnsupportedEncoding - Content-Encoding must be one of identity|gzip|deflate|zstd")
+	// ErrUnsupportedContentType - 415
+	ErrUnsupportedContentType = errors.New("ErrUnsupportedContentType - Content-Type must be one of application/json|application/x-ndjson")
+	// ErrBodyTooLarge - 413
+	ErrBodyTooLarge = errors.New("ErrBodyTooLarge - request body exceeds the max body size")
+	// ErrWrongLimit - 400
+	ErrWrongLimit = errors.New("ErrWrongLimit - limit must be an integer between 1 and 10000")
+	// ErrWrongOffset - 400
+	ErrWrongOffset = errors.New("ErrWrongOffset - offset must be a non negative integer")
 )
 
 // HTTPStatusCode -
 func HTTPStatusCode(err error) int {
 	switch err {
-	case ErrPathNotFound, engine.ErrNotFound:
+	case tenant.ErrNoTenant, tenant.ErrWrongTenant, ErrWrongLimit, ErrWrongOffset, ErrUnparsableBody, engine.ErrWrongReplay, engine.ErrWrongSnapshot, engine.ErrArchiveNotFound, collection.ErrUnsupportedAck, engine.ErrUnknownPauseMode:
+		return 400
+	case auth.ErrUnauthenticated:
+		return 401
+	case auth.ErrForbidden, auth.ErrForbiddenAdmin:
+		return 403
+	case ErrPathNotFound, engine.ErrNotFound, engine.ErrPipeNotFound:
 		return 404
 	case ErrWrongMethod:
 		return 405
-	case collection.ErrUnparsableJSON:
+	case ErrBodyTooLarge:
+		return 413
+	case ErrUnsupportedEncoding, ErrUnsupportedContentType:
+		return 415
+	case collection.ErrUnparsableJSON, collection.ErrWrongDocumentID:
 		return 422
+	case engine.ErrBufferOverflow, ratelimit.ErrRateLimited, tenant.ErrQuotaExceeded, tenant.ErrTooManyTenants:
+		return 429
+	case engine.ErrNotPaused:
+		return 409
+	case engine.ErrBufferFull, engine.ErrCollectionPaused:
+		return 503
+	case engine.ErrRedriveUnsupported, engine.ErrPipesUnsupported, engine.ErrTailUnsupported:
+		return 501
 	default:
+		if _, ok := err.(*collection.SchemaViolation); ok {
+			return 422
+		}
 		return 500
 	}
 }
 
+// GRPCStatus - status of a failed gRPC call
+func GRPCStatus(err error) *grpc.Status {
+	var code grpc.Code
+	switch err {
+	case auth.ErrUnauthenticated:
+		code = grpc.Unauthenticated
+	case auth.ErrForbidden:
+		code = grpc.PermissionDenied
+	case engine.ErrNotFound:
+		code = grpc.NotFound
+	case collection.ErrUnparsableJSON, collection.ErrWrongDocumentID, tenant.ErrNoTenant, tenant.ErrWrongTenant, collection.ErrUnsupportedAck:
+		code = grpc.InvalidArgument
+	case engine.ErrBufferOverflow, ratelimit.ErrRateLimited, tenant.ErrQuotaExceeded, tenant.ErrTooManyTenants:
+		code = grpc.ResourceExhausted
+	case engine.ErrBufferFull, engine.ErrCollectionPaused:
+		code = grpc.Unavailable
+	default:
+		if status, ok := err.(*grpc.Status); ok {
+			return status
+		}
+		if _, ok := err.(*collection.SchemaViolation); ok {
+			code = grpc.InvalidArgument
+			break
+		}
+		code = grpc.Internal
+	}
+	return &grpc.Status{Code: code, Message: err.Error()}
+}
+
 func (s *Server) serveError(w http.ResponseWriter, r *http.Request, err error) {
-	log.Err().Println(err)
+	s.logger.Error("request failed", "method", r.Method, "path", r.URL.Path, "error", err)
 	w.Header().Set("Connection", "close")
 	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if err == auth.ErrUnauthenticated {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+	}
 	statusCode := HTTPStatusCode(err)
 	w.WriteHeader(statusCode)
 	io.WriteString(w, err.Error())
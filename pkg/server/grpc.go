@@ -0,0 +1,127 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net/http"
+
+	"github.com/khezen/bulklog/pkg/collection"
+	"github.com/khezen/bulklog/pkg/grpc"
+	"github.com/khezen/bulklog/pkg/trace"
+)
+
+const (
+	defaultGRPCPort = 5018
+	appendMethod    = "/bulklog.v1.Ingestion/Append"
+	appendStream    = "/bulklog.v1.Ingestion/AppendStream"
+)
+
+// grpcHandler serves the bulklog.v1.Ingestion service, see ingestion.proto
+func (s *Server) grpcHandler() http.Handler {
+	mux := grpc.NewServeMux()
+	mux.HandleUnary(appendMethod, s.handleAppend)
+	mux.HandleStream(appendStream, s.handleAppendStream)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := s.withCall(r)
+		// validated by calls, so they fail with a status
+		ctx = collection.WithAck(ctx, collection.Ack(r.Header.Get("X-Bulklog-Ack")))
+		if s.propagate {
+			ctx = trace.ContextWith(ctx, trace.Extract(r.Header))
+		}
+		mux.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// listenAndServeGRPC - Blocks the current goroutine, opens the gRPC port and serves ingestion calls
+func (s *Server) listenAndServeGRPC() {
+	s.logger.Info("opening bulklog grpc", "addr", s.grpcServer.Addr, "tls", s.cert != nil)
+	var err error
+	if s.grpcServer.TLSConfig != nil {
+		err = s.grpcServer.ListenAndServeTLS("", "")
+	} else {
+		err = s.grpcServer.ListenAndServe()
+	}
+	if err != http.ErrServerClosed {
+		s.quit <- err
+	}
+}
+
+// rpc Append(AppendRequest) returns (AppendResponse)
+func (s *Server) handleAppend(ctx context.Context, request []byte) (response []byte, err error) {
+	ctx, span := s.startCallSpan(ctx, appendMethod)
+	defer func() {
+		span.SetError(err)
+		span.End()
+	}()
+	var res appendResponse
+	err = s.append(ctx, request, &res)
+	if err != nil {
+		return nil, err
+	}
+	return res.marshalProto(), nil
+}
+
+// rpc AppendStream(stream AppendRequest) returns (AppendResponse).
+// Documents are appended as requests are received, so those appended before a failure are kept.
+func (s *Server) handleAppendStream(ctx context.Context, recv func() ([]byte, error)) (response []byte, err error) {
+	ctx, span := s.startCallSpan(ctx, appendStream)
+	defer func() {
+		span.SetError(err)
+		span.End()
+	}()
+	var res appendResponse
+	for {
+		request, err := recv()
+		if err == io.EOF {
+			return res.marshalProto(), nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		err = s.append(ctx, request, &res)
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// append collects the documents of an AppendRequest and adds their outcome to res;
+// documents are indexed after those already in res.
+func (s *Server) append(ctx context.Context, request []byte, res *appendResponse) error {
+	var req appendRequest
+	err := req.unmarshalProto(request)
+	if err != nil {
+		return &grpc.Status{Code: grpc.InvalidArgument, Message: err.Error()}
+	}
+	err = s.authorizeCall(ctx, req.collection, len(req.documents))
+	if err != nil {
+		return GRPCStatus(err)
+	}
+	err = collection.AckFrom(ctx, "").Validate()
+	if err != nil {
+		return GRPCStatus(err)
+	}
+	errs, err := s.engine.CollectBulk(ctx, req.collection, req.schema, req.documents...)
+	if err != nil {
+		return GRPCStatus(err)
+	}
+	offset := res.appended + uint64(len(res.errors))
+	for i, docErr := range errs {
+		if docErr != nil {
+			res.errors = append(res.errors, documentError{offset + uint64(i), docErr.Error()})
+			continue
+		}
+		res.appended++
+	}
+	return nil
+}
+
+// startCallSpan starts the server span of a gRPC call,
+// child of the caller span carried by ctx
+func (s *Server) startCallSpan(ctx context.Context, fullMethod string) (context.Context, *trace.Span) {
+	return trace.StartFromContext(
+		ctx, fullMethod, trace.KindServer,
+		trace.String("rpc.system", "grpc"),
+		trace.String("rpc.method", fullMethod),
+	)
+}
@@ -1,32 +1,94 @@
 package server
 
 import (
+	"bufio"
 	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
 	"io/ioutil"
+	"mime"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/khezen/bulklog/pkg/collection"
+	"github.com/khezen/bulklog/pkg/engine"
+	"github.com/khezen/bulklog/pkg/output"
+	"github.com/khezen/bulklog/pkg/tenant"
+	"github.com/khezen/bulklog/pkg/zstd"
+)
+
+const (
+	// defaultMaxBodySize bounds request bodies unless configured otherwise
+	defaultMaxBodySize = 100 * 1024 * 1024
+	// readinessTimeout bounds dependency checks of a readiness request
+	readinessTimeout = 5 * time.Second
+	// defaultTailLimit and maxTailLimit bound the documents returned by a tail or pipe documents request
+	defaultTailLimit = 100
+	maxTailLimit     = 10000
+	// maxSnapshotSize bounds restored snapshots, as received or decompressed, whatever the max body size of documents is
+	maxSnapshotSize = 1 << 30
 )
 
 // POST /v1/{collection}/{schema}
 func (s *Server) handleCollect(w http.ResponseWriter, r *http.Request, collectionName collection.Name, schemaName collection.SchemaName) {
-	docBytes, err := ioutil.ReadAll(r.Body)
+	ctx, span := s.startRequestSpan(r, "POST /v1/{collection}/{schema}", collectionName, schemaName)
+	defer span.End()
+	ctx, err := withAck(ctx, r)
+	if err != nil {
+		span.SetError(err)
+		s.serveError(w, r, err)
+		return
+	}
+	ctx = collection.WithRequest(ctx, r, true)
+	docBytes, err := s.pushBody(ctx, w, r, collectionName, schemaName)
+	if err != nil {
+		span.SetError(err)
+		s.serveError(w, r, err)
+		return
+	}
+	err = s.limitBody(w, r, 1)
 	if err != nil {
+		span.SetError(err)
 		s.serveError(w, r, err)
 		return
 	}
-	err = s.engine.Collect(collectionName, schemaName, docBytes)
+	receipts := collection.NewReceipts(1)
+	err = s.engine.Collect(collection.WithReceipts(ctx, receipts), collectionName, schemaName, docBytes)
 	if err != nil {
+		span.SetError(err)
 		s.serveError(w, r, err)
 		return
 	}
+	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(receiptItem{receipts.Get(0)})
+}
+
+// receiptItem - receipt of a document, an empty object if it was not appended
+type receiptItem struct {
+	*collection.Receipt
 }
 
 // POST /v1/{collection}/{schemaName}/batch
 func (s *Server) handleCollectBatch(w http.ResponseWriter, r *http.Request, collectionName collection.Name, schemaName collection.SchemaName) {
-	docsBytes, err := ioutil.ReadAll(r.Body)
+	ctx, span := s.startRequestSpan(r, "POST /v1/{collection}/{schema}/batch", collectionName, schemaName)
+	defer span.End()
+	ctx, err := withAck(ctx, r)
+	if err != nil {
+		span.SetError(err)
+		s.serveError(w, r, err)
+		return
+	}
+	ctx = collection.WithRequest(ctx, r, false)
+	docsBytes, err := s.pushBody(ctx, w, r, collectionName, schemaName)
 	if err != nil {
+		span.SetError(err)
 		s.serveError(w, r, err)
 		return
 	}
@@ -43,12 +105,480 @@ func (s *Server) handleCollectBatch(w http.ResponseWriter, r *http.Request, coll
 			break
 		}
 	}
-	err = s.engine.CollectBatch(collectionName, schemaName, docBytesSlice...)
+	err = s.limitBody(w, r, len(docBytesSlice))
 	if err != nil {
+		span.SetError(err)
 		s.serveError(w, r, err)
 		return
 	}
+	receipts := collection.NewReceipts(len(docBytesSlice))
+	err = s.engine.CollectBatch(collection.WithReceipts(ctx, receipts), collectionName, schemaName, docBytesSlice...)
+	if err != nil {
+		span.SetError(err)
+		s.serveError(w, r, err)
+		return
+	}
+	items := make([]receiptItem, len(docBytesSlice))
+	for i := range items {
+		items[i].Receipt = receipts.Get(i)
+	}
+	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{"items": items})
+}
+
+// withAck returns ctx carrying the ack mode asked for with the ack query parameter or the X-Bulklog-Ack header, if any
+func withAck(ctx context.Context, r *http.Request) (context.Context, error) {
+	ack := collection.Ack(r.URL.Query().Get("ack"))
+	if ack == "" {
+		ack = collection.Ack(r.Header.Get("X-Bulklog-Ack"))
+	}
+	err := ack.Validate()
+	if err != nil {
+		return ctx, err
+	}
+	return collection.WithAck(ctx, ack), nil
+}
+
+// pushBody reads the body of a request pushing documents, bounded by the max body size of the collection.
+// If content types are enforced, it must be sent as JSON or NDJSON.
+func (s *Server) pushBody(ctx context.Context, w http.ResponseWriter, r *http.Request, collectionName collection.Name, schemaName collection.SchemaName) ([]byte, error) {
+	if s.body.Load().StrictContentType {
+		mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if err != nil {
+			return nil, ErrUnsupportedContentType
+		}
+		switch mediaType {
+		case "application/json", "application/x-ndjson", "application/ndjson":
+		default:
+			return nil, ErrUnsupportedContentType
+		}
+	}
+	maxSize := s.engine.MaxBodySize(ctx, collectionName, schemaName)
+	if maxSize == 0 {
+		maxSize = s.maxBodySize()
+	}
+	return readBody(w, r, maxSize)
+}
+
+// maxBodySize - bytes request bodies are bounded to, unless their collection tells otherwise
+func (s *Server) maxBodySize() int64 {
+	if maxSize := s.body.Load().MaxSize; maxSize > 0 {
+		return maxSize
+	}
+	return defaultMaxBodySize
+}
+
+// readBody reads the request body, decompressed if its Content-Encoding is gzip, deflate or zstd.
+// Bodies of more than maxSize bytes, as received or decompressed, fail with ErrBodyTooLarge.
+func readBody(w http.ResponseWriter, r *http.Request, maxSize int64) ([]byte, error) {
+	if r.ContentLength > maxSize {
+		return nil, ErrBodyTooLarge
+	}
+	reader := http.MaxBytesReader(w, r.Body, maxSize)
+	encoding := r.Header.Get("Content-Encoding")
+	if encoding == "" || encoding == "identity" {
+		body, err := ioutil.ReadAll(reader)
+		if err != nil {
+			return nil, bodyError(err, err)
+		}
+		return body, nil
+	}
+	decoded, err := decoder(encoding, reader)
+	if err != nil {
+		return nil, err
+	}
+	defer decoded.Close()
+	// one byte more than allowed tells the decompressed body is too large
+	body, err := ioutil.ReadAll(io.LimitReader(decoded, maxSize+1))
+	if err != nil {
+		return nil, bodyError(err, ErrUnparsableBody)
+	}
+	if int64(len(body)) > maxSize {
+		return nil, ErrBodyTooLarge
+	}
+	return body, nil
+}
+
+// decoder decompresses a body of the given Content-Encoding as it is read
+func decoder(encoding string, body io.Reader) (io.ReadCloser, error) {
+	switch encoding {
+	case "gzip", "x-gzip":
+		gz, err := gzip.NewReader(body)
+		if err != nil {
+			return nil, bodyError(err, ErrUnparsableBody)
+		}
+		return gz, nil
+	case "deflate":
+		// deflate stands for zlib streams, though some clients send raw deflate streams
+		buffered := bufio.NewReader(body)
+		header, _ := buffered.Peek(2)
+		if len(header) == 2 && header[0]&0x0f == 8 && (uint16(header[0])<<8|uint16(header[1]))%31 == 0 {
+			zr, err := zlib.NewReader(buffered)
+			if err != nil {
+				return nil, bodyError(err, ErrUnparsableBody)
+			}
+			return zr, nil
+		}
+		return flate.NewReader(buffered), nil
+	case "zstd":
+		return ioutil.NopCloser(zstd.NewReader(body)), nil
+	default:
+		return nil, ErrUnsupportedEncoding
+	}
+}
+
+// bodyError - ErrBodyTooLarge if reading the body failed since it exceeds the limit, otherwise
+func bodyError(err, otherwise error) error {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return ErrBodyTooLarge
+	}
+	return otherwise
+}
+
+// bulkItem - status of a document of a bulk request
+type bulkItem struct {
+	// Line of the document in a NDJSON body, omitted for JSON arrays where items follow the array order
+	Line   int    `json:"line,omitempty"`
+	Status int    `json:"status"`
+	Error  string `json:"error,omitempty"`
+	// Receipt - ID and posting time of the document, omitted unless it was appended
+	*collection.Receipt
+}
+
+// POST /v1/{collection}/{schemaName}/_bulk
+func (s *Server) handleCollectBulk(w http.ResponseWriter, r *http.Request, collectionName collection.Name, schemaName collection.SchemaName) {
+	ctx, span := s.startRequestSpan(r, "POST /v1/{collection}/{schema}/_bulk", collectionName, schemaName)
+	defer span.End()
+	ctx, err := withAck(ctx, r)
+	if err != nil {
+		span.SetError(err)
+		s.serveError(w, r, err)
+		return
+	}
+	ctx = collection.WithRequest(ctx, r, false)
+	body, err := s.pushBody(ctx, w, r, collectionName, schemaName)
+	if err != nil {
+		span.SetError(err)
+		s.serveError(w, r, err)
+		return
+	}
+	docBytesSlice, lines, err := splitBulk(body)
+	if err != nil {
+		span.SetError(err)
+		s.serveError(w, r, err)
+		return
+	}
+	err = s.limitBody(w, r, len(docBytesSlice))
+	if err != nil {
+		span.SetError(err)
+		s.serveError(w, r, err)
+		return
+	}
+	receipts := collection.NewReceipts(len(docBytesSlice))
+	errs, err := s.engine.CollectBulk(collection.WithReceipts(ctx, receipts), collectionName, schemaName, docBytesSlice...)
+	if err != nil {
+		span.SetError(err)
+		s.serveError(w, r, err)
+		return
+	}
+	var (
+		items  = make([]bulkItem, len(errs))
+		failed = false
+	)
+	for i, docErr := range errs {
+		items[i].Status = http.StatusAccepted
+		items[i].Receipt = receipts.Get(i)
+		if lines != nil {
+			items[i].Line = lines[i]
+		}
+		if docErr != nil {
+			failed = true
+			items[i].Status = HTTPStatusCode(docErr)
+			items[i].Error = docErr.Error()
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{"errors": failed, "items": items})
+}
+
+// splitBulk splits a JSON array into its elements, or NDJSON into its non blank lines.
+// Lines are numbered from 1 for NDJSON, they are nil for a JSON array.
+func splitBulk(body []byte) (docBytesSlice [][]byte, lines []int, err error) {
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) == 0 || trimmed[0] != '[' {
+		lines = make([]int, 0, bytes.Count(body, []byte("\n"))+1)
+		for i, line := range bytes.Split(body, []byte("\n")) {
+			if len(bytes.TrimSpace(line)) == 0 {
+				continue
+			}
+			docBytesSlice = append(docBytesSlice, line)
+			lines = append(lines, i+1)
+		}
+		return docBytesSlice, lines, nil
+	}
+	decoder := json.NewDecoder(bytes.NewReader(trimmed))
+	// an array which does not decode cannot be split into documents
+	_, err = decoder.Token()
+	if err != nil {
+		return nil, nil, collection.ErrUnparsableJSON
+	}
+	for decoder.More() {
+		var docBytes json.RawMessage
+		err = decoder.Decode(&docBytes)
+		if err != nil {
+			return nil, nil, collection.ErrUnparsableJSON
+		}
+		docBytesSlice = append(docBytesSlice, docBytes)
+	}
+	_, err = decoder.Token()
+	if err != nil {
+		return nil, nil, collection.ErrUnparsableJSON
+	}
+	return docBytesSlice, nil, nil
+}
+
+// POST /admin/deadletters/{collection}/redrive
+func (s *Server) handleRedrive(w http.ResponseWriter, r *http.Request, collectionName collection.Name) {
+	redriven, err := s.engine.Redrive(collectionName)
+	if err != nil {
+		s.serveError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]int{"redriven": redriven})
+}
+
+// POST /admin/replay/{collection}
+func (s *Server) handleReplay(w http.ResponseWriter, r *http.Request, collectionName collection.Name) {
+	body, err := readBody(w, r, s.maxBodySize())
+	if err != nil {
+		s.serveError(w, r, err)
+		return
+	}
+	var request engine.ReplayRequest
+	err = json.Unmarshal(body, &request)
+	if err != nil {
+		s.serveError(w, r, collection.ErrUnparsableJSON)
+		return
+	}
+	replay, err := s.engine.Replay(collectionName, request)
+	if err != nil {
+		s.serveError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(replay)
+}
+
+// GET /admin/pipes/{collection}
+func (s *Server) handleListPipes(w http.ResponseWriter, r *http.Request, collectionName collection.Name) {
+	pipes, err := s.engine.Pipes(collectionName)
+	if err != nil {
+		s.serveError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string][]engine.Pipe{"pipes": pipes})
+}
+
+// GET /admin/pipes/{collection}/{pipe}
+func (s *Server) handleGetPipe(w http.ResponseWriter, r *http.Request, collectionName collection.Name, pipeID string) {
+	pipes, err := s.engine.Pipes(collectionName)
+	if err != nil {
+		s.serveError(w, r, err)
+		return
+	}
+	for _, pipe := range pipes {
+		if pipe.ID != pipeID {
+			continue
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(pipe)
+		return
+	}
+	s.serveError(w, r, engine.ErrPipeNotFound)
+}
+
+// GET /admin/pipes/{collection}/{pipe}/documents?offset={n}&limit={n}
+func (s *Server) handlePipeDocuments(w http.ResponseWriter, r *http.Request, collectionName collection.Name, pipeID string) {
+	var (
+		query  = r.URL.Query()
+		offset = 0
+		limit  = defaultTailLimit
+		err    error
+	)
+	if offsetStr := query.Get("offset"); offsetStr != "" {
+		offset, err = strconv.Atoi(offsetStr)
+		if err != nil || offset < 0 {
+			s.serveError(w, r, ErrWrongOffset)
+			return
+		}
+	}
+	if limitStr := query.Get("limit"); limitStr != "" {
+		limit, err = strconv.Atoi(limitStr)
+		if err != nil || limit <= 0 || limit > maxTailLimit {
+			s.serveError(w, r, ErrWrongLimit)
+			return
+		}
+	}
+	page, err := s.engine.PipeDocuments(collectionName, pipeID, offset, limit)
+	if err != nil {
+		s.serveError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(page)
+}
+
+// GET /admin/snapshots/{collection}
+func (s *Server) handleSnapshot(w http.ResponseWriter, r *http.Request, collectionName collection.Name) {
+	snapshot, err := s.engine.Snapshot(collectionName)
+	if err != nil {
+		s.serveError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(snapshot)
+}
+
+// POST /admin/snapshots/{collection}
+func (s *Server) handleRestore(w http.ResponseWriter, r *http.Request, collectionName collection.Name) {
+	body, err := readBody(w, r, maxSnapshotSize)
+	if err != nil {
+		s.serveError(w, r, err)
+		return
+	}
+	var snapshot engine.Snapshot
+	err = json.Unmarshal(body, &snapshot)
+	if err != nil {
+		s.serveError(w, r, collection.ErrUnparsableJSON)
+		return
+	}
+	restored, err := s.engine.Restore(collectionName, snapshot)
+	if err != nil {
+		s.serveError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(restored)
+}
+
+// GET /admin/buffers/{collection}?limit={n}
+func (s *Server) handleTail(w http.ResponseWriter, r *http.Request, collectionName collection.Name) {
+	limit := defaultTailLimit
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		var err error
+		limit, err = strconv.Atoi(limitStr)
+		if err != nil || limit <= 0 || limit > maxTailLimit {
+			s.serveError(w, r, ErrWrongLimit)
+			return
+		}
+	}
+	documents, err := s.engine.Tail(collectionName, limit)
+	if err != nil {
+		s.serveError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string][]engine.BufferedDocument{"documents": documents})
+}
+
+// GET /admin/outputs
+func (s *Server) handleListOutputs(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string][]output.State{"outputs": s.engine.Outputs()})
+}
+
+// GET /admin/tenants
+func (s *Server) handleListTenants(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string][]tenant.Usage{"tenants": s.engine.Tenants()})
+}
+
+// GET /admin/integrity
+func (s *Server) handleIntegrity(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string][]engine.Integrity{"collections": s.engine.Integrity()})
+}
+
+// GET /admin/recovery
+func (s *Server) handleRecovery(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string][]engine.Recovery{"recoveries": s.engine.Recoveries()})
+}
+
+// POST /admin/collections/{collection}/pause?mode=reject|buffer
+// POST /admin/collections/{collection}/resume
+// POST /admin/outputs/{output}/pause
+// POST /admin/outputs/{output}/resume
+func (s *Server) handlePause(w http.ResponseWriter, r *http.Request, kind, name string, pause bool) {
+	var (
+		paused engine.Pause
+		err    error
+	)
+	switch {
+	case kind == "collections" && pause:
+		paused, err = s.engine.PauseCollection(collection.Name(name), engine.PauseMode(r.URL.Query().Get("mode")))
+	case kind == "collections":
+		err = s.engine.ResumeCollection(collection.Name(name))
+	case pause:
+		paused, err = s.engine.PauseOutput(name)
+	default:
+		err = s.engine.ResumeOutput(name)
+	}
+	if err != nil {
+		s.serveError(w, r, err)
+		return
+	}
+	if !pause {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(paused)
+}
+
+// GET /admin/pauses
+func (s *Server) handleListPauses(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string][]engine.Pause{"pauses": s.engine.Pauses()})
+}
+
+// POST /admin/pipes/{collection}/{pipe}/retry
+func (s *Server) handleRetryPipe(w http.ResponseWriter, r *http.Request, collectionName collection.Name, pipeID string) {
+	err := s.engine.RetryPipe(collectionName, pipeID)
+	if err != nil {
+		s.serveError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// DELETE /admin/pipes/{collection}/{pipe}
+func (s *Server) handleDiscardPipe(w http.ResponseWriter, r *http.Request, collectionName collection.Name, pipeID string) {
+	err := s.engine.DiscardPipe(collectionName, pipeID)
+	if err != nil {
+		s.serveError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
 }
 
 // GET /v1/liveness
@@ -60,3 +590,25 @@ func (s *Server) handleLiveness(w http.ResponseWriter, r *http.Request) {
 func (s *Server) handleReadiness(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 }
+
+// GET /healthz
+func (s *Server) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	serveChecks(w, s.engine.Liveness())
+}
+
+// GET /readyz
+func (s *Server) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+	defer cancel()
+	serveChecks(w, s.engine.Readiness(ctx))
+}
+
+func serveChecks(w http.ResponseWriter, checks []engine.Check) {
+	statusCode := http.StatusOK
+	if !engine.Healthy(checks) {
+		statusCode = http.StatusServiceUnavailable
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(map[string][]engine.Check{"checks": checks})
+}
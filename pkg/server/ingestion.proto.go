@@ -0,0 +1,69 @@
+package server
+
+import (
+	"strings"
+
+	"github.com/khezen/bulklog/pkg/collection"
+	"github.com/khezen/bulklog/pkg/proto"
+)
+
+// appendRequest - bulklog.v1.AppendRequest, see ingestion.proto
+type appendRequest struct {
+	collection collection.Name
+	schema     collection.SchemaName
+	documents  [][]byte
+}
+
+// appendResponse - bulklog.v1.AppendResponse
+type appendResponse struct {
+	appended uint64
+	errors   []documentError
+}
+
+// documentError - bulklog.v1.DocumentError
+type documentError struct {
+	index   uint64
+	message string
+}
+
+func (r *appendRequest) unmarshalProto(buf []byte) error {
+	d := proto.NewDecoder(buf)
+	for d.Next() {
+		if d.WireType() != proto.Bytes {
+			continue
+		}
+		switch d.Field() {
+		case 1:
+			// routes are case insensitive, as the HTTP ones
+			r.collection = collection.Name(strings.ToLower(d.String()))
+		case 2:
+			r.schema = collection.SchemaName(strings.ToLower(d.String()))
+		case 3:
+			var docBytes []byte
+			document := proto.NewDecoder(d.Bytes())
+			for document.Next() {
+				if document.Field() == 1 && document.WireType() == proto.Bytes {
+					docBytes = document.Bytes()
+				}
+			}
+			if document.Err() != nil {
+				return document.Err()
+			}
+			r.documents = append(r.documents, docBytes)
+		}
+	}
+	return d.Err()
+}
+
+func (r *appendResponse) marshalProto() []byte {
+	var e proto.Encoder
+	e.Uint64(1, r.appended)
+	for i := range r.errors {
+		docErr := &r.errors[i]
+		e.Message(2, func(e *proto.Encoder) {
+			e.Uint64(1, docErr.index)
+			e.String(2, docErr.message)
+		})
+	}
+	return e.Bytes()
+}
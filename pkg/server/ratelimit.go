@@ -0,0 +1,72 @@
+package server
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/khezen/bulklog/pkg/auth"
+	"github.com/khezen/bulklog/pkg/ratelimit"
+)
+
+type clientKey struct{}
+
+// limitRequest takes a request token of the client, it returns the client key and how long to wait if limited
+func (s *Server) limitRequest(r *http.Request, principal *auth.Principal) (string, time.Duration, error) {
+	limiter := s.limiter.Load()
+	if limiter == nil {
+		return "", 0, nil
+	}
+	var name string
+	if principal != nil {
+		name = principal.Name
+	}
+	client := limiter.Client(r, name)
+	if retryAfter, ok := limiter.AllowRequest(client); !ok {
+		return client, retryAfter, ratelimit.ErrRateLimited
+	}
+	return client, 0, nil
+}
+
+// limitDocuments takes document tokens of the client, it returns how long to wait if limited
+func (s *Server) limitDocuments(client string, documents int) (time.Duration, error) {
+	limiter := s.limiter.Load()
+	if limiter == nil {
+		return 0, nil
+	}
+	if retryAfter, ok := limiter.AllowDocuments(client, documents); !ok {
+		return retryAfter, ratelimit.ErrRateLimited
+	}
+	return 0, nil
+}
+
+// limit takes a request token of the client of an HTTP request, whose key is attached to the returned request.
+// Limited requests are given a Retry-After header.
+func (s *Server) limit(w http.ResponseWriter, r *http.Request, principal *auth.Principal) (*http.Request, error) {
+	client, retryAfter, err := s.limitRequest(r, principal)
+	if err != nil {
+		setRetryAfter(w, retryAfter)
+		return r, err
+	}
+	return r.WithContext(context.WithValue(r.Context(), clientKey{}, client)), nil
+}
+
+// limitBody takes document tokens of the client of an HTTP request
+func (s *Server) limitBody(w http.ResponseWriter, r *http.Request, documents int) error {
+	client, _ := r.Context().Value(clientKey{}).(string)
+	retryAfter, err := s.limitDocuments(client, documents)
+	if err != nil {
+		setRetryAfter(w, retryAfter)
+	}
+	return err
+}
+
+func setRetryAfter(w http.ResponseWriter, retryAfter time.Duration) {
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+}
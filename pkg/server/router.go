@@ -1,22 +1,55 @@
 package server
 
 import (
-	"fmt"
 	"net/http"
 	"strings"
 
 	"github.com/khezen/bulklog/pkg/collection"
-	"github.com/khezen/bulklog/pkg/log"
+	"github.com/khezen/bulklog/pkg/tenant"
 )
 
 // ListenAndServe - Blocks the current goroutine, opens an HTTP port and serves the web REST requests
 func (s *Server) ListenAndServe() {
 	http.HandleFunc("/liveness", s.handleLiveness)
 	http.HandleFunc("/readiness", s.handleReadiness)
+	http.HandleFunc("/healthz", s.handleHealthz)
+	http.HandleFunc("/readyz", s.handleReadyz)
 	http.HandleFunc("/v1/", s.handleCollection)
-	endpoint := fmt.Sprintf(":%d", s.port)
-	log.Out().Printf("opening bulklog at %v\n", endpoint)
-	s.quit <- http.ListenAndServe(endpoint, nil)
+	if s.adminServer != nil {
+		go s.listenAndServeAdmin()
+	} else {
+		http.HandleFunc("/admin/", s.handleAdmin)
+	}
+	if s.grpcServer != nil {
+		go s.listenAndServeGRPC()
+	}
+	for name, in := range s.inputs {
+		go s.serveInput(name, in)
+	}
+	s.logger.Info("opening bulklog", "addr", s.httpServer.Addr, "tls", s.cert != nil)
+	var err error
+	if s.httpServer.TLSConfig != nil {
+		err = s.httpServer.ListenAndServeTLS("", "")
+	} else {
+		err = s.httpServer.ListenAndServe()
+	}
+	if err != http.ErrServerClosed {
+		s.quit <- err
+	}
+}
+
+// listenAndServeAdmin serves the admin API on its own listener
+func (s *Server) listenAndServeAdmin() {
+	s.logger.Info("opening bulklog admin", "addr", s.adminServer.Addr, "tls", s.cert != nil)
+	var err error
+	if s.adminServer.TLSConfig != nil {
+		err = s.adminServer.ListenAndServeTLS("", "")
+	} else {
+		err = s.adminServer.ListenAndServe()
+	}
+	if err != http.ErrServerClosed {
+		s.quit <- err
+	}
 }
 
 func (s *Server) handleCollection(w http.ResponseWriter, r *http.Request) {
@@ -28,6 +61,24 @@ func (s *Server) handleCollection(w http.ResponseWriter, r *http.Request) {
 	}
 	collectionName := collection.Name(collection.Name(urlSplit[1]))
 	schemaName := collection.SchemaName(collection.SchemaName(urlSplit[2]))
+	principal, err := s.authorize(r.Header, collectionName)
+	if err != nil {
+		s.serveError(w, r, err)
+		return
+	}
+	tenantID, err := s.tenantOf(r.Header, principal)
+	if err != nil {
+		s.serveError(w, r, err)
+		return
+	}
+	if tenantID != "" {
+		r = r.WithContext(tenant.WithID(r.Context(), tenantID))
+	}
+	r, err = s.limit(w, r, principal)
+	if err != nil {
+		s.serveError(w, r, err)
+		return
+	}
 	switch urlSplitLen {
 	case 3:
 		switch r.Method {
@@ -39,12 +90,15 @@ func (s *Server) handleCollection(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 	case 4:
-		if urlSplit[3] != "batch" {
+		if urlSplit[3] != "batch" && urlSplit[3] != "_bulk" {
 			s.serveError(w, r, ErrPathNotFound)
 			return
 		}
-		switch r.Method {
-		case http.MethodPost:
+		switch {
+		case r.Method == http.MethodPost && urlSplit[3] == "_bulk":
+			s.handleCollectBulk(w, r, collectionName, schemaName)
+			return
+		case r.Method == http.MethodPost:
 			s.handleCollectBatch(w, r, collectionName, schemaName)
 			return
 		default:
@@ -56,3 +110,132 @@ func (s *Server) handleCollection(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 }
+
+func (s *Server) handleAdmin(w http.ResponseWriter, r *http.Request) {
+	err := s.authorizeAdmin(r.Header)
+	if err != nil {
+		s.serveError(w, r, err)
+		return
+	}
+	urlSplit := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(urlSplit) > 1 && urlSplit[1] == "pipes" {
+		s.handlePipes(w, r, urlSplit)
+		return
+	}
+	if len(urlSplit) == 2 && urlSplit[1] == "outputs" {
+		if r.Method != http.MethodGet {
+			s.serveError(w, r, ErrWrongMethod)
+			return
+		}
+		s.handleListOutputs(w, r)
+		return
+	}
+	if len(urlSplit) == 3 && urlSplit[1] == "buffers" {
+		if r.Method != http.MethodGet {
+			s.serveError(w, r, ErrWrongMethod)
+			return
+		}
+		s.handleTail(w, r, collection.Name(strings.ToLower(urlSplit[2])))
+		return
+	}
+	if len(urlSplit) == 3 && urlSplit[1] == "snapshots" {
+		switch r.Method {
+		case http.MethodGet:
+			s.handleSnapshot(w, r, collection.Name(strings.ToLower(urlSplit[2])))
+		case http.MethodPost:
+			s.handleRestore(w, r, collection.Name(strings.ToLower(urlSplit[2])))
+		default:
+			s.serveError(w, r, ErrWrongMethod)
+		}
+		return
+	}
+	if len(urlSplit) == 4 && (urlSplit[1] == "collections" || urlSplit[1] == "outputs") &&
+		(urlSplit[3] == "pause" || urlSplit[3] == "resume") {
+		if r.Method != http.MethodPost {
+			s.serveError(w, r, ErrWrongMethod)
+			return
+		}
+		name := urlSplit[2]
+		if urlSplit[1] == "collections" {
+			name = strings.ToLower(name)
+		}
+		s.handlePause(w, r, urlSplit[1], name, urlSplit[3] == "pause")
+		return
+	}
+	if len(urlSplit) == 2 && urlSplit[1] == "pauses" {
+		if r.Method != http.MethodGet {
+			s.serveError(w, r, ErrWrongMethod)
+			return
+		}
+		s.handleListPauses(w, r)
+		return
+	}
+	if len(urlSplit) == 2 && urlSplit[1] == "integrity" {
+		if r.Method != http.MethodGet {
+			s.serveError(w, r, ErrWrongMethod)
+			return
+		}
+		s.handleIntegrity(w, r)
+		return
+	}
+	if len(urlSplit) == 2 && urlSplit[1] == "recovery" {
+		if r.Method != http.MethodGet {
+			s.serveError(w, r, ErrWrongMethod)
+			return
+		}
+		s.handleRecovery(w, r)
+		return
+	}
+	if len(urlSplit) == 2 && urlSplit[1] == "tenants" {
+		if r.Method != http.MethodGet {
+			s.serveError(w, r, ErrWrongMethod)
+			return
+		}
+		s.handleListTenants(w, r)
+		return
+	}
+	if len(urlSplit) == 3 && urlSplit[1] == "replay" {
+		if r.Method != http.MethodPost {
+			s.serveError(w, r, ErrWrongMethod)
+			return
+		}
+		s.handleReplay(w, r, collection.Name(strings.ToLower(urlSplit[2])))
+		return
+	}
+	if len(urlSplit) != 4 || urlSplit[1] != "deadletters" || urlSplit[3] != "redrive" {
+		s.serveError(w, r, ErrPathNotFound)
+		return
+	}
+	switch r.Method {
+	case http.MethodPost:
+		s.handleRedrive(w, r, collection.Name(strings.ToLower(urlSplit[2])))
+		return
+	default:
+		s.serveError(w, r, ErrWrongMethod)
+		return
+	}
+}
+
+func (s *Server) handlePipes(w http.ResponseWriter, r *http.Request, urlSplit []string) {
+	if len(urlSplit) < 3 {
+		s.serveError(w, r, ErrPathNotFound)
+		return
+	}
+	collectionName := collection.Name(strings.ToLower(urlSplit[2]))
+	switch {
+	case len(urlSplit) == 3 && r.Method == http.MethodGet:
+		s.handleListPipes(w, r, collectionName)
+	case len(urlSplit) == 4 && r.Method == http.MethodGet:
+		s.handleGetPipe(w, r, collectionName, urlSplit[3])
+	case len(urlSplit) == 4 && r.Method == http.MethodDelete:
+		s.handleDiscardPipe(w, r, collectionName, urlSplit[3])
+	case len(urlSplit) == 5 && urlSplit[4] == "retry" && r.Method == http.MethodPost:
+		s.handleRetryPipe(w, r, collectionName, urlSplit[3])
+	case len(urlSplit) == 5 && urlSplit[4] == "documents" && r.Method == http.MethodGet:
+		s.handlePipeDocuments(w, r, collectionName, urlSplit[3])
+	case len(urlSplit) == 3, len(urlSplit) == 4, len(urlSplit) == 5 && (urlSplit[4] == "retry" || urlSplit[4] == "documents"):
+		s.serveError(w, r, ErrWrongMethod)
+	default:
+		s.serveError(w, r, ErrPathNotFound)
+	}
+}
@@ -1,22 +1,57 @@
 package server
 
 import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"reflect"
+	"sync/atomic"
+
+	"github.com/khezen/bulklog/pkg/auth"
+
 	"github.com/khezen/bulklog/pkg/config"
 	"github.com/khezen/bulklog/pkg/engine"
+	"github.com/khezen/bulklog/pkg/input"
+	"github.com/khezen/bulklog/pkg/ratelimit"
+	"github.com/khezen/bulklog/pkg/tenant"
 )
 
 const defaultPort = 5017
 
 // Server - Contains data required for serving web REST requests
 type Server struct {
-	port   int
-	engine engine.Engine
-	quit   chan error
+	port       int
+	engine     engine.Engine
+	quit       chan error
+	httpServer *http.Server
+	// grpcServer is nil unless the gRPC ingestion server is enabled
+	grpcServer *http.Server
+	// adminServer is nil unless the admin API has a listener of its own
+	adminServer *http.Server
+	adminCfg    config.Admin
+	inputs      map[string]input.Interface
+	inputsCfg   input.Config
+	// cert is nil unless servers are served over TLS
+	cert   *certificate
+	tlsCfg config.TLS
+	// verifier authenticates ingestion requests
+	verifier atomic.Pointer[verifier]
+	// limiter is nil unless ingestion requests are rate limited
+	limiter      atomic.Pointer[ratelimit.Limiter]
+	rateLimitCfg ratelimit.Config
+	// tenancy tells which tenant requests write as
+	tenancy atomic.Pointer[tenant.Config]
+	// body bounds request bodies
+	body   atomic.Pointer[config.Body]
+	logger *slog.Logger
+	// propagate extracts the trace context of incoming requests
+	propagate bool
 }
 
 // New - Create new service for serving web REST requests
-func New(cfg *config.Config, quit chan error) (*Server, error) {
-	e, err := engine.New(cfg)
+func New(cfg *config.Config, logger *slog.Logger, quit chan error) (*Server, error) {
+	e, err := engine.New(cfg, logger)
 	if err != nil {
 		return nil, err
 	}
@@ -28,6 +63,146 @@ func New(cfg *config.Config, quit chan error) (*Server, error) {
 		port,
 		e,
 		quit,
+		&http.Server{Addr: fmt.Sprintf(":%d", port)},
+		nil,
+		nil,
+		cfg.Admin,
+		nil,
+		cfg.Input,
+		nil,
+		cfg.TLS,
+		atomic.Pointer[verifier]{},
+		atomic.Pointer[ratelimit.Limiter]{},
+		cfg.RateLimit,
+		atomic.Pointer[tenant.Config]{},
+		atomic.Pointer[config.Body]{},
+		logger,
+		cfg.Tracing.Propagate,
+	}
+	tlsConfig, cert, err := newTLSConfig(cfg.TLS)
+	if err != nil {
+		e.Shutdown(context.Background())
+		return nil, fmt.Errorf("newTLSConfig.%s", err)
+	}
+	srv.httpServer.TLSConfig, srv.cert = tlsConfig, cert
+	authVerifier, err := auth.NewVerifier(cfg.Auth)
+	if err != nil {
+		e.Shutdown(context.Background())
+		return nil, fmt.Errorf("auth.NewVerifier.%s", err)
+	}
+	srv.verifier.Store(&verifier{authVerifier})
+	srv.limiter.Store(ratelimit.New(cfg.RateLimit))
+	srv.tenancy.Store(&cfg.Tenancy)
+	srv.body.Store(&cfg.Body)
+	srv.inputs, err = input.NewInputs(&cfg.Input, e, logger)
+	if err != nil {
+		e.Shutdown(context.Background())
+		return nil, fmt.Errorf("input.NewInputs.%s", err)
+	}
+	if cfg.GRPC.Enabled {
+		grpcPort := cfg.GRPC.Port
+		if grpcPort == 0 {
+			grpcPort = defaultGRPCPort
+		}
+		// gRPC clients dial cleartext HTTP/2 with prior knowledge, or HTTP/2 negotiated over TLS
+		var protocols http.Protocols
+		if tlsConfig != nil {
+			protocols.SetHTTP2(true)
+		} else {
+			protocols.SetUnencryptedHTTP2(true)
+		}
+		srv.grpcServer = &http.Server{
+			Addr:      fmt.Sprintf(":%d", grpcPort),
+			Handler:   srv.grpcHandler(),
+			Protocols: &protocols,
+			TLSConfig: tlsConfig,
+		}
+	}
+	if cfg.Admin.Listen != "" {
+		adminMux := http.NewServeMux()
+		adminMux.HandleFunc("/admin/", srv.handleAdmin)
+		srv.adminServer = &http.Server{
+			Addr:      cfg.Admin.Listen,
+			Handler:   adminMux,
+			TLSConfig: tlsConfig,
+		}
+	} else if !cfg.Auth.Enabled() {
+		logger.Warn("admin API is served to anyone reaching the ingestion port, set admin.listen or auth")
 	}
 	return &srv, nil
 }
+
+// Reload applies collections and outputs of cfg without restarting
+func (s *Server) Reload(cfg *config.Config) error {
+	authVerifier, err := auth.NewVerifier(cfg.Auth)
+	if err != nil {
+		return fmt.Errorf("auth.NewVerifier.%s", err)
+	}
+	err = s.engine.Reload(cfg)
+	if err != nil {
+		return fmt.Errorf("engine.Reload.%s", err)
+	}
+	if !reflect.DeepEqual(s.inputsCfg, cfg.Input) {
+		s.logger.Warn("input changes require a restart")
+	}
+	if s.tlsCfg.ClientCAFile != cfg.TLS.ClientCAFile || s.tlsCfg.ClientAuth != cfg.TLS.ClientAuth || s.tlsCfg.Enabled() != cfg.TLS.Enabled() {
+		s.logger.Warn("tls changes require a restart, except certificate renewal")
+	}
+	if s.adminCfg != cfg.Admin {
+		s.logger.Warn("admin changes require a restart")
+	}
+	if s.cert != nil && cfg.TLS.Enabled() {
+		err = s.cert.load(cfg.TLS)
+		if err != nil {
+			return fmt.Errorf("certificate.load.%s", err)
+		}
+	}
+	s.verifier.Store(&verifier{authVerifier})
+	s.tenancy.Store(&cfg.Tenancy)
+	s.body.Store(&cfg.Body)
+	if !reflect.DeepEqual(s.rateLimitCfg, cfg.RateLimit) {
+		// clients start over with full buckets
+		s.limiter.Store(ratelimit.New(cfg.RateLimit))
+		s.rateLimitCfg = cfg.RateLimit
+	}
+	return nil
+}
+
+// Shutdown stops accepting requests and inputs, then drains collection buffers until ctx is done
+func (s *Server) Shutdown(ctx context.Context) error {
+	for name, in := range s.inputs {
+		err := in.Close()
+		if err != nil {
+			s.logger.Warn("input close failed", "input", name, "error", err)
+		}
+	}
+	err := s.httpServer.Shutdown(ctx)
+	if err != nil {
+		return fmt.Errorf("httpServer.Shutdown.%s", err)
+	}
+	if s.grpcServer != nil {
+		err = s.grpcServer.Shutdown(ctx)
+		if err != nil {
+			return fmt.Errorf("grpcServer.Shutdown.%s", err)
+		}
+	}
+	if s.adminServer != nil {
+		err = s.adminServer.Shutdown(ctx)
+		if err != nil {
+			return fmt.Errorf("adminServer.Shutdown.%s", err)
+		}
+	}
+	err = s.engine.Shutdown(ctx)
+	if err != nil {
+		return fmt.Errorf("engine.Shutdown.%s", err)
+	}
+	return nil
+}
+
+// serveInput blocks until the input is closed
+func (s *Server) serveInput(name string, in input.Interface) {
+	err := in.Serve()
+	if err != nil {
+		s.quit <- fmt.Errorf("(input %s).%s", name, err)
+	}
+}
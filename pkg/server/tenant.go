@@ -0,0 +1,32 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/khezen/bulklog/pkg/auth"
+	"github.com/khezen/bulklog/pkg/tenant"
+)
+
+// tenantOf - tenant a request writes as, empty if tenancy is disabled.
+// It is the tenant of the request credentials, the one of the tenant header if they carry none;
+// a header naming another tenant than the credentials is forbidden.
+func (s *Server) tenantOf(header http.Header, principal *auth.Principal) (string, error) {
+	cfg := s.tenancy.Load()
+	if cfg == nil || !cfg.Enabled {
+		return "", nil
+	}
+	id := header.Get(cfg.Header())
+	if principal != nil && principal.Tenant != "" {
+		if id != "" && id != principal.Tenant {
+			return "", auth.ErrForbidden
+		}
+		id = principal.Tenant
+	}
+	if id == "" {
+		return "", tenant.ErrNoTenant
+	}
+	if !tenant.ValidID(id) {
+		return "", tenant.ErrWrongTenant
+	}
+	return id, nil
+}
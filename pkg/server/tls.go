@@ -0,0 +1,64 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"sync/atomic"
+
+	"github.com/khezen/bulklog/pkg/config"
+)
+
+// ErrInvalidClientCA - client CA file holds no PEM certificate
+var ErrInvalidClientCA = errors.New("ErrInvalidClientCA - client_ca_file holds no PEM encoded certificate")
+
+// certificate is served to clients, it is loaded again from its files on reload so it can be renewed without restart
+type certificate struct {
+	current atomic.Pointer[tls.Certificate]
+}
+
+func (c *certificate) load(tlsCfg config.TLS) error {
+	cert, err := tls.LoadX509KeyPair(tlsCfg.CertFile, tlsCfg.KeyFile)
+	if err != nil {
+		return fmt.Errorf("tls.LoadX509KeyPair.%s", err)
+	}
+	c.current.Store(&cert)
+	return nil
+}
+
+func (c *certificate) get(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return c.current.Load(), nil
+}
+
+// newTLSConfig returns the server TLS config, nil if TLS is disabled
+func newTLSConfig(tlsCfg config.TLS) (*tls.Config, *certificate, error) {
+	if !tlsCfg.Enabled() {
+		return nil, nil, nil
+	}
+	cert := &certificate{}
+	err := cert.load(tlsCfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	tlsConfig := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: cert.get,
+	}
+	if tlsCfg.ClientCAFile != "" {
+		caBytes, err := ioutil.ReadFile(tlsCfg.ClientCAFile)
+		if err != nil {
+			return nil, nil, fmt.Errorf("ioutil.ReadFile.%s", err)
+		}
+		tlsConfig.ClientCAs = x509.NewCertPool()
+		if !tlsConfig.ClientCAs.AppendCertsFromPEM(caBytes) {
+			return nil, nil, ErrInvalidClientCA
+		}
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+		if tlsCfg.ClientAuth == config.VerifyClientCertIfGiven {
+			tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+		}
+	}
+	return tlsConfig, cert, nil
+}
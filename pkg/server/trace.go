@@ -0,0 +1,25 @@
+package server
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/khezen/bulklog/pkg/collection"
+	"github.com/khezen/bulklog/pkg/trace"
+)
+
+// startRequestSpan starts the server span of an ingest request,
+// child of the caller span if trace context propagation is enabled
+func (s *Server) startRequestSpan(r *http.Request, route string, collectionName collection.Name, schemaName collection.SchemaName) (context.Context, *trace.Span) {
+	ctx := r.Context()
+	if s.propagate {
+		ctx = trace.ContextWith(ctx, trace.Extract(r.Header))
+	}
+	return trace.StartFromContext(
+		ctx, route, trace.KindServer,
+		trace.String("http.request.method", r.Method),
+		trace.String("url.path", r.URL.Path),
+		trace.String("bulklog.collection", string(collectionName)),
+		trace.String("bulklog.schema", string(schemaName)),
+	)
+}
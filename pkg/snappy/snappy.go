@@ -0,0 +1,199 @@
+// Package snappy implements the snappy block format needed to compress documents buffered in redis.
+// ref: https://github.com/google/snappy/blob/main/format_description.txt
+package snappy
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+var (
+	// ErrCorrupt - the input is not a valid snappy block
+	ErrCorrupt = errors.New("ErrCorrupt - snappy: corrupt input")
+	// ErrTooLarge - the decoded length does not fit in memory
+	ErrTooLarge = errors.New("ErrTooLarge - snappy: decoded block is too large")
+)
+
+const (
+	tagLiteral = 0x00
+	tagCopy1   = 0x01
+	tagCopy2   = 0x02
+	tagCopy4   = 0x03
+
+	// blockSize - the input is encoded in independent blocks, so copy offsets fit in 2 bytes
+	blockSize = 1 << 16
+	// minMatch - shorter matches are encoded as literals
+	minMatch = 4
+	hashBits = 14
+	// maxDecodedLen bounds allocations of corrupt inputs
+	maxDecodedLen = 1<<32 - 1
+)
+
+// Encode returns the snappy block encoding of src
+func Encode(src []byte) []byte {
+	dst := binary.AppendUvarint(make([]byte, 0, maxEncodedLen(len(src))), uint64(len(src)))
+	for len(src) > 0 {
+		block := src
+		if len(block) > blockSize {
+			block = block[:blockSize]
+		}
+		src = src[len(block):]
+		dst = encodeBlock(dst, block)
+	}
+	return dst
+}
+
+func maxEncodedLen(n int) int {
+	return 32 + n + n/6
+}
+
+// encodeBlock greedily replaces 4 bytes sequences seen earlier in the block by copies
+func encodeBlock(dst, src []byte) []byte {
+	if len(src) < minMatch+1 {
+		return appendLiteral(dst, src)
+	}
+	var table [1 << hashBits]int32
+	for i := range table {
+		table[i] = -1
+	}
+	var (
+		literalStart = 0
+		i            = 0
+	)
+	for i+minMatch <= len(src) {
+		h := hash(binary.LittleEndian.Uint32(src[i:]))
+		candidate := int(table[h])
+		table[h] = int32(i)
+		if candidate < 0 || binary.LittleEndian.Uint32(src[candidate:]) != binary.LittleEndian.Uint32(src[i:]) {
+			i++
+			continue
+		}
+		dst = appendLiteral(dst, src[literalStart:i])
+		length := minMatch
+		for i+length < len(src) && src[candidate+length] == src[i+length] {
+			length++
+		}
+		dst = appendCopy(dst, i-candidate, length)
+		i += length
+		literalStart = i
+	}
+	return appendLiteral(dst, src[literalStart:])
+}
+
+func hash(u uint32) uint32 {
+	return (u * 0x1e35a7bd) >> (32 - hashBits)
+}
+
+func appendLiteral(dst, literal []byte) []byte {
+	if len(literal) == 0 {
+		return dst
+	}
+	n := uint32(len(literal) - 1)
+	switch {
+	case n < 60:
+		dst = append(dst, byte(n)<<2|tagLiteral)
+	case n < 1<<8:
+		dst = append(dst, 60<<2|tagLiteral, byte(n))
+	case n < 1<<16:
+		dst = append(dst, 61<<2|tagLiteral, byte(n), byte(n>>8))
+	case n < 1<<24:
+		dst = append(dst, 62<<2|tagLiteral, byte(n), byte(n>>8), byte(n>>16))
+	default:
+		dst = append(dst, 63<<2|tagLiteral, byte(n), byte(n>>8), byte(n>>16), byte(n>>24))
+	}
+	return append(dst, literal...)
+}
+
+// appendCopy encodes a match as copies of at most 64 bytes, offset is lower than blockSize
+func appendCopy(dst []byte, offset, length int) []byte {
+	for length >= 68 {
+		dst = append(dst, 63<<2|tagCopy2, byte(offset), byte(offset>>8))
+		length -= 64
+	}
+	if length > 64 {
+		// leaves at least 4 bytes, so the remainder can use a 1 byte offset copy
+		dst = append(dst, 59<<2|tagCopy2, byte(offset), byte(offset>>8))
+		length -= 60
+	}
+	if length >= 4 && length < 12 && offset < 2048 {
+		return append(dst, byte(offset>>8)<<5|byte(length-4)<<2|tagCopy1, byte(offset))
+	}
+	return append(dst, byte(length-1)<<2|tagCopy2, byte(offset), byte(offset>>8))
+}
+
+// Decode returns the decoded form of the snappy block src
+func Decode(src []byte) ([]byte, error) {
+	n, header := binary.Uvarint(src)
+	if header <= 0 {
+		return nil, ErrCorrupt
+	}
+	if n > maxDecodedLen {
+		return nil, ErrTooLarge
+	}
+	// a tag byte encodes at most 64 bytes, so larger claims are corrupt before allocating
+	if n > uint64(len(src))*64 {
+		return nil, ErrCorrupt
+	}
+	dst := make([]byte, 0, n)
+	src = src[header:]
+	for len(src) > 0 {
+		var length, offset int
+		tag := src[0]
+		switch tag & 0x03 {
+		case tagLiteral:
+			length = int(tag >> 2)
+			src = src[1:]
+			if length >= 60 {
+				size := length - 59
+				if len(src) < size {
+					return nil, ErrCorrupt
+				}
+				length = 0
+				for i := size - 1; i >= 0; i-- {
+					length = length<<8 | int(src[i])
+				}
+				src = src[size:]
+			}
+			length++
+			if length <= 0 || length > len(src) || uint64(len(dst)+length) > n {
+				return nil, ErrCorrupt
+			}
+			dst = append(dst, src[:length]...)
+			src = src[length:]
+			continue
+		case tagCopy1:
+			if len(src) < 2 {
+				return nil, ErrCorrupt
+			}
+			length = 4 + int(tag>>2)&0x07
+			offset = int(tag>>5)<<8 | int(src[1])
+			src = src[2:]
+		case tagCopy2:
+			if len(src) < 3 {
+				return nil, ErrCorrupt
+			}
+			length = 1 + int(tag>>2)
+			offset = int(binary.LittleEndian.Uint16(src[1:]))
+			src = src[3:]
+		case tagCopy4:
+			if len(src) < 5 {
+				return nil, ErrCorrupt
+			}
+			length = 1 + int(tag>>2)
+			offset = int(binary.LittleEndian.Uint32(src[1:]))
+			src = src[5:]
+		}
+		if offset <= 0 || offset > len(dst) || uint64(len(dst)+length) > n {
+			return nil, ErrCorrupt
+		}
+		// byte by byte, copies may overlap the bytes they produce
+		start := len(dst) - offset
+		for i := 0; i < length; i++ {
+			dst = append(dst, dst[start+i])
+		}
+	}
+	if uint64(len(dst)) != n {
+		return nil, ErrCorrupt
+	}
+	return dst, nil
+}
@@ -0,0 +1,153 @@
+package snappy
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"testing"
+)
+
+// noise - incompressible bytes, encoded as literals
+func noise(size int) []byte {
+	buf := make([]byte, 0, size+sha256.Size)
+	for i := 0; len(buf) < size; i++ {
+		sum := sha256.Sum256([]byte(strconv.Itoa(i)))
+		buf = append(buf, sum[:]...)
+	}
+	return buf[:size]
+}
+
+func sampleLogs(lines int) []byte {
+	var buf bytes.Buffer
+	for i := 0; i < lines; i++ {
+		fmt.Fprintf(&buf, `{"id":%d,"msg":"request served in %dms","path":"/v1/logs/%d"}`+"\n", i, (i*7919)%900+1, i%17)
+	}
+	return buf.Bytes()
+}
+
+func mustHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestRoundTrip(t *testing.T) {
+	inputs := map[string][]byte{
+		"empty":   {},
+		"byte":    []byte("a"),
+		"short":   []byte("abcd"),
+		"repeats": bytes.Repeat([]byte("abcdefgh"), 1000),
+		"logs":    sampleLogs(5000),
+		"noise":   noise(200000),
+		"zeros":   make([]byte, 300000),
+		"block":   sampleLogs(5000)[:blockSize],
+		"block+1": sampleLogs(5000)[:blockSize+1],
+		"mixed":   append(append(sampleLogs(300), noise(70000)...), sampleLogs(300)...),
+	}
+	for name, input := range inputs {
+		t.Run(name, func(t *testing.T) {
+			encoded := Encode(input)
+			if len(encoded) > maxEncodedLen(len(input)) {
+				t.Fatalf("encoded %d bytes, more than the %d bound", len(encoded), maxEncodedLen(len(input)))
+			}
+			decoded, err := Decode(encoded)
+			if err != nil {
+				t.Fatalf("Decode: %s", err)
+			}
+			if !bytes.Equal(decoded, input) {
+				t.Fatalf("decoded %d bytes differ from the %d encoded", len(decoded), len(input))
+			}
+		})
+	}
+}
+
+// TestDecodeFormatVectors decodes every element kind of the format description:
+// literals with inline and extended lengths, and copies with 1, 2 and 4 bytes offsets, overlapping the bytes they produce.
+func TestDecodeFormatVectors(t *testing.T) {
+	long := noise(300)
+	vectors := []struct {
+		name    string
+		encoded []byte
+		decoded []byte
+	}{
+		{"empty", mustHex(t, "00"), []byte{}},
+		{"literal", mustHex(t, "0308ffffff"), []byte{0xff, 0xff, 0xff}},
+		{"literal 1 byte length", append(mustHex(t, "46f045"), long[:70]...), long[:70]},
+		{"literal 2 bytes length", append(mustHex(t, "ac02f42b01"), long...), long},
+		{"copy 1 byte offset", mustHex(t, "0c0c616263641104"), []byte("abcdabcdabcd")},
+		{"copy 1 byte offset, high bits", append(append(mustHex(t, "b002f42b01"), long...), 0x21, 0x2c), append(append([]byte{}, long...), long[:4]...)},
+		{"copy 2 bytes offset", mustHex(t, "0c0c616263641e0400"), []byte("abcdabcdabcd")},
+		{"copy 4 bytes offset", mustHex(t, "0c0c616263641f04000000"), []byte("abcdabcdabcd")},
+		{"run", mustHex(t, "400078fa0100"), bytes.Repeat([]byte("x"), 64)},
+	}
+	for _, vector := range vectors {
+		t.Run(vector.name, func(t *testing.T) {
+			decoded, err := Decode(vector.encoded)
+			if err != nil {
+				t.Fatalf("Decode: %s", err)
+			}
+			if !bytes.Equal(decoded, vector.decoded) {
+				t.Fatalf("decoded %x, want %x", decoded, vector.decoded)
+			}
+		})
+	}
+}
+
+// TestEncodeVectors checks the encoding of inputs the reference implementation encodes the same way
+func TestEncodeVectors(t *testing.T) {
+	vectors := map[string]string{
+		"":             "00",
+		"a":            "010061",
+		"abcdabcdabcd": "0c0c616263641104",
+	}
+	for input, want := range vectors {
+		if got := hex.EncodeToString(Encode([]byte(input))); got != want {
+			t.Errorf("Encode(%q) = %s, want %s", input, got, want)
+		}
+	}
+}
+
+func TestDecodeCorrupt(t *testing.T) {
+	vectors := map[string]string{
+		"no header":            "",
+		"truncated literal":    "0308ffff",
+		"longer than claimed":  "030cffffffff",
+		"shorter than claimed": "0408ffffff",
+		"offset zero":          "0c0c616263641100",
+		"offset before start":  "0c0c616263641105",
+		"truncated copy":       "0c0c6162636411",
+		"huge claim":           "ffffffff0f00",
+	}
+	for name, encoded := range vectors {
+		t.Run(name, func(t *testing.T) {
+			_, err := Decode(mustHex(t, encoded))
+			if err != ErrCorrupt && err != ErrTooLarge {
+				t.Fatalf("Decode: got %v, want %v", err, ErrCorrupt)
+			}
+		})
+	}
+}
+
+// FuzzDecode checks arbitrary blocks fail to decode rather than panic, and what decodes encodes back
+func FuzzDecode(f *testing.F) {
+	for _, encoded := range []string{"00", "0308ffffff", "0c0c616263641104", "0c0c616263641e0400", "0c0c616263641f04000000", "400078fa0100", "0c0c616263641105", "ffffffff0f00"} {
+		b, _ := hex.DecodeString(encoded)
+		f.Add(b)
+	}
+	f.Add(Encode(sampleLogs(100)))
+	f.Fuzz(func(t *testing.T, encoded []byte) {
+		decoded, err := Decode(encoded)
+		if err != nil {
+			return
+		}
+		redecoded, err := Decode(Encode(decoded))
+		if err != nil || !bytes.Equal(redecoded, decoded) {
+			t.Fatalf("round trip of %d decoded bytes: %d bytes, %v", len(decoded), len(redecoded), err)
+		}
+	})
+}
@@ -0,0 +1,87 @@
+package tenant
+
+import (
+	"errors"
+	"regexp"
+)
+
+const defaultHeader = "X-Tenant-ID"
+
+var (
+	// ErrWrongTenant - tenant ID is not allowed
+	ErrWrongTenant = errors.New("ErrWrongTenant - tenant IDs must match ^[a-z0-9][a-z0-9_-]{0,63}$")
+	// ErrNegativeQuota - quotas cannot be negative
+	ErrNegativeQuota = errors.New("ErrNegativeQuota - quotas and max_tenants must not be negative")
+	// ErrNoTenant - request carries no tenant
+	ErrNoTenant = errors.New("ErrNoTenant - request carries no tenant, set by its credentials or the tenant header")
+	// ErrQuotaExceeded - tenant used up a quota
+	ErrQuotaExceeded = errors.New("ErrQuotaExceeded - tenant documents per day or buffered bytes quota is exhausted")
+	// ErrTooManyTenants - max_tenants tenants have collections already
+	ErrTooManyTenants = errors.New("ErrTooManyTenants - max_tenants is reached, no collection is created for further tenants")
+)
+
+// validID - tenant IDs end up in redis keys, file paths and index names, which elasticsearch requires lowercase
+var validID = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,63}$`)
+
+// ValidID tells whether id can name a tenant
+func ValidID(id string) bool {
+	return validID.MatchString(id)
+}
+
+// Config - tenants sharing the instance, disabled unless enabled is set
+type Config struct {
+	Enabled bool `yaml:"enabled"`
+	// HeaderName carries the tenant of requests whose credentials do not, X-Tenant-ID by default
+	HeaderName string `yaml:"header"`
+	// quotas of every tenant, unless overridden
+	DocumentsPerDay int64 `yaml:"documents_per_day"`
+	BufferedBytes   int64 `yaml:"buffered_bytes"`
+	// MaxTenants bounds how many tenants have collections created, unbounded if 0
+	MaxTenants int `yaml:"max_tenants"`
+	// Tenants overrides quotas per tenant
+	Tenants map[string]Quotas `yaml:"tenants"`
+}
+
+// Header - name of the header carrying the tenant
+func (c Config) Header() string {
+	if c.HeaderName == "" {
+		return defaultHeader
+	}
+	return c.HeaderName
+}
+
+// Quotas of a tenant
+func (c Config) Quotas(id string) Quotas {
+	if quotas, ok := c.Tenants[id]; ok {
+		return quotas
+	}
+	return Quotas{c.DocumentsPerDay, c.BufferedBytes}
+}
+
+// Validate checks tenant IDs and quotas
+func (c Config) Validate() error {
+	if !c.Quotas("").valid() || c.MaxTenants < 0 {
+		return ErrNegativeQuota
+	}
+	for id, quotas := range c.Tenants {
+		if !ValidID(id) {
+			return ErrWrongTenant
+		}
+		if !quotas.valid() {
+			return ErrNegativeQuota
+		}
+	}
+	return nil
+}
+
+// Quotas - what a tenant is allowed, unlimited if zero
+type Quotas struct {
+	// DocumentsPerDay - documents accepted per UTC day
+	DocumentsPerDay int64 `yaml:"documents_per_day" json:"documents_per_day"`
+	// BufferedBytes - bytes held by the buffers of the tenant collections between two flushes
+	BufferedBytes int64 `yaml:"buffered_bytes" json:"buffered_bytes"`
+}
+
+func (q Quotas) valid() bool {
+	return q.DocumentsPerDay >= 0 && q.BufferedBytes >= 0
+}
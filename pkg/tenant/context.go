@@ -0,0 +1,16 @@
+package tenant
+
+import "context"
+
+type idKey struct{}
+
+// WithID returns a copy of ctx carrying the tenant of the documents collected with it
+func WithID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, idKey{}, id)
+}
+
+// ID - tenant carried by ctx, empty if none
+func ID(ctx context.Context) string {
+	id, _ := ctx.Value(idKey{}).(string)
+	return id
+}
@@ -0,0 +1,135 @@
+package tenant
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Tracker counts the documents of each tenant against its quotas.
+// Counts are kept by each instance, they start over on restart.
+type Tracker struct {
+	sync.Mutex
+	cfg     Config
+	tenants map[string]*usage
+}
+
+type usage struct {
+	day            string
+	documentsToday int64
+	documents      int64
+	bytes          int64
+	rejected       int64
+}
+
+// Usage - documents of a tenant since the instance started
+type Usage struct {
+	Tenant string `json:"tenant"`
+	// DocumentsToday - documents accepted since midnight UTC
+	DocumentsToday int64 `json:"documents_today"`
+	Documents      int64 `json:"documents"`
+	Bytes          int64 `json:"bytes"`
+	// Rejected - documents refused because a quota was exhausted
+	Rejected int64 `json:"rejected"`
+	// BufferedBytes - bytes currently held by the buffers of the tenant collections
+	BufferedBytes int64  `json:"buffered_bytes"`
+	Quotas        Quotas `json:"quotas"`
+}
+
+// NewTracker returns a tracker applying the quotas of cfg
+func NewTracker(cfg Config) *Tracker {
+	return &Tracker{
+		cfg:     cfg,
+		tenants: make(map[string]*usage),
+	}
+}
+
+// Reload applies the quotas of cfg, counts so far are kept
+func (t *Tracker) Reload(cfg Config) {
+	t.Lock()
+	defer t.Unlock()
+	t.cfg = cfg
+}
+
+// Quotas of a tenant
+func (t *Tracker) Quotas(id string) Quotas {
+	t.Lock()
+	defer t.Unlock()
+	return t.cfg.Quotas(id)
+}
+
+// Reserve counts documents of the tenant if they fit within its quotas, given the bytes its buffers hold,
+// ErrQuotaExceeded otherwise.
+func (t *Tracker) Reserve(id string, documents int, bytes, buffered int64) error {
+	t.Lock()
+	defer t.Unlock()
+	var (
+		quotas = t.cfg.Quotas(id)
+		u      = t.usage(id)
+	)
+	if (quotas.DocumentsPerDay > 0 && u.documentsToday+int64(documents) > quotas.DocumentsPerDay) ||
+		(quotas.BufferedBytes > 0 && buffered+bytes > quotas.BufferedBytes) {
+		u.rejected += int64(documents)
+		return ErrQuotaExceeded
+	}
+	u.documentsToday += int64(documents)
+	u.documents += int64(documents)
+	u.bytes += bytes
+	return nil
+}
+
+// Release uncounts reserved documents which could not be buffered
+func (t *Tracker) Release(id string, documents int, bytes int64) {
+	t.Lock()
+	defer t.Unlock()
+	u := t.usage(id)
+	u.documentsToday -= int64(documents)
+	if u.documentsToday < 0 {
+		// reserved before midnight
+		u.documentsToday = 0
+	}
+	u.documents -= int64(documents)
+	u.bytes -= bytes
+}
+
+// usage of a tenant, its daily count starts over at midnight UTC
+func (t *Tracker) usage(id string) *usage {
+	day := time.Now().UTC().Format("2006-01-02")
+	u, ok := t.tenants[id]
+	if !ok {
+		u = &usage{day: day}
+		t.tenants[id] = u
+	}
+	if u.day != day {
+		u.day = day
+		u.documentsToday = 0
+	}
+	return u
+}
+
+// Usage reports every configured tenant and every tenant which collected documents, sorted by ID.
+// BufferedBytes is left to the caller, which knows the buffers.
+func (t *Tracker) Usage() []Usage {
+	t.Lock()
+	defer t.Unlock()
+	// configured tenants are reported before they collect anything
+	for id := range t.cfg.Tenants {
+		t.usage(id)
+	}
+	usages := make([]Usage, 0, len(t.tenants))
+	for id := range t.tenants {
+		u := t.usage(id)
+		usages = append(usages, Usage{
+			Tenant:         id,
+			DocumentsToday: u.documentsToday,
+			Documents:      u.documents,
+			Bytes:          u.bytes,
+			Rejected:       u.rejected,
+			Quotas:         t.cfg.Quotas(id),
+		})
+	}
+	sort.Slice(usages, func(i, j int) bool {
+		return usages[i].Tenant < usages[j].Tenant
+	})
+	return usages
+}
@@ -0,0 +1,201 @@
+package trace
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/khezen/bulklog/pkg/grpc"
+	"github.com/khezen/bulklog/pkg/otlp"
+)
+
+const (
+	tracesExportMethod = "/opentelemetry.proto.collector.trace.v1.TraceService/Export"
+	exportPeriod       = 5 * time.Second
+	exportBatchSize    = 512
+	// maxQueuedSpans - spans ended while the queue is full are dropped
+	maxQueuedSpans = 4096
+)
+
+// exporter batches ended spans and exports them in the background
+type exporter struct {
+	sync.Mutex
+	protocol       string
+	tracesEndpoint string
+	headers        map[string]string
+	resource       otlp.Resource
+	httpcli        http.Client
+	grpccli        *grpc.Client
+	logger         *slog.Logger
+	queue          []otlp.Span
+	dropped        int
+	full           chan struct{}
+	close          chan struct{}
+	done           chan struct{}
+}
+
+func newExporter(cfg Config, logger *slog.Logger) (*exporter, error) {
+	if cfg.Protocol == "" {
+		cfg.Protocol = ProtocolHTTPProtobuf
+	}
+	e := &exporter{
+		protocol: cfg.Protocol,
+		headers:  cfg.Headers,
+		resource: otlp.Resource{
+			Attributes: []otlp.KeyValue{String("service.name", cfg.ServiceName)},
+		},
+		logger: logger,
+		queue:  make([]otlp.Span, 0, exportBatchSize),
+		full:   make(chan struct{}, 1),
+		close:  make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	switch cfg.Protocol {
+	case ProtocolHTTPJSON, ProtocolHTTPProtobuf:
+		scheme := "https"
+		if cfg.Insecure {
+			scheme = "http"
+		}
+		e.tracesEndpoint = fmt.Sprintf("%s://%s/v1/traces", scheme, cfg.Endpoint)
+		e.httpcli = http.Client{
+			Timeout: 30 * time.Second,
+			Transport: &http.Transport{
+				MaxIdleConns:    2,
+				IdleConnTimeout: 30 * time.Second,
+			},
+		}
+	case ProtocolGRPC:
+		e.grpccli = grpc.NewClient(cfg.Endpoint, cfg.Insecure, nil, cfg.Headers)
+	default:
+		return nil, ErrUnsupportedProtocol
+	}
+	go e.run()
+	return e, nil
+}
+
+func (e *exporter) enqueue(span otlp.Span) {
+	e.Lock()
+	if len(e.queue) >= maxQueuedSpans {
+		e.dropped++
+		e.Unlock()
+		return
+	}
+	e.queue = append(e.queue, span)
+	reached := len(e.queue) >= exportBatchSize
+	e.Unlock()
+	if reached {
+		select {
+		case e.full <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (e *exporter) run() {
+	defer close(e.done)
+	ticker := time.NewTicker(exportPeriod)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-e.close:
+			e.exportQueued()
+			return
+		case <-ticker.C:
+			e.exportQueued()
+		case <-e.full:
+			e.exportQueued()
+		}
+	}
+}
+
+func (e *exporter) exportQueued() {
+	for {
+		e.Lock()
+		spans := e.queue
+		if len(spans) > exportBatchSize {
+			spans = spans[:exportBatchSize]
+		}
+		e.queue = e.queue[len(spans):]
+		dropped := e.dropped
+		e.dropped = 0
+		e.Unlock()
+		if dropped > 0 {
+			e.logger.Warn("spans dropped, export queue full", "dropped", dropped)
+		}
+		if len(spans) == 0 {
+			return
+		}
+		err := e.export(spans)
+		if err != nil {
+			e.logger.Warn("spans export failed", "spans", len(spans), "error", err)
+		}
+	}
+}
+
+func (e *exporter) export(spans []otlp.Span) error {
+	request := &otlp.ExportTraceServiceRequest{
+		ResourceSpans: []otlp.ResourceSpans{{
+			Resource: e.resource,
+			ScopeSpans: []otlp.ScopeSpans{{
+				Scope: otlp.Scope{Name: scopeName},
+				Spans: spans,
+			}},
+		}},
+	}
+	switch e.protocol {
+	case ProtocolGRPC:
+		_, err := e.grpccli.Invoke(context.Background(), tracesExportMethod, request.MarshalProto())
+		if err != nil {
+			return fmt.Errorf("Invoke.%s", err)
+		}
+		return nil
+	case ProtocolHTTPJSON:
+		body, err := json.Marshal(request)
+		if err != nil {
+			return fmt.Errorf("json.Marshal.%s", err)
+		}
+		return e.post(body, "application/json")
+	default:
+		return e.post(request.MarshalProto(), "application/x-protobuf")
+	}
+}
+
+func (e *exporter) post(body []byte, contentType string) error {
+	req, err := http.NewRequest("POST", e.tracesEndpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("http.NewRequest.%s", err)
+	}
+	req.Header.Set("Content-Type", contentType)
+	for key, value := range e.headers {
+		req.Header.Set(key, value)
+	}
+	res, err := e.httpcli.Do(req)
+	if err != nil {
+		return fmt.Errorf("httpClient.Do.%s", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode >= 300 {
+		resBody, err := ioutil.ReadAll(res.Body)
+		if err != nil {
+			return fmt.Errorf("ioutil.ReadAll.%s", err)
+		}
+		return fmt.Errorf("otlp: %s : %s", res.Status, resBody)
+	}
+	return nil
+}
+
+func (e *exporter) shutdown(ctx context.Context) error {
+	close(e.close)
+	select {
+	case <-e.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,135 @@
+package trace
+
+import (
+	"sync"
+	"time"
+
+	"github.com/khezen/bulklog/pkg/otlp"
+)
+
+// Span kinds
+const (
+	KindInternal = otlp.SpanKindInternal
+	KindServer   = otlp.SpanKindServer
+	KindClient   = otlp.SpanKindClient
+	KindProducer = otlp.SpanKindProducer
+	KindConsumer = otlp.SpanKindConsumer
+)
+
+// maxLinks - links beyond the limit are counted as dropped
+const maxLinks = 128
+
+// Span - a timed operation. A nil span is valid and records nothing,
+// so instrumentation needs no check whether tracing is enabled.
+type Span struct {
+	sync.Mutex
+	tracer       *Tracer
+	context      SpanContext
+	parentSpanID [8]byte
+	name         string
+	kind         int
+	start        time.Time
+	attributes   []otlp.KeyValue
+	links        []otlp.Link
+	linked       map[SpanContext]struct{}
+	droppedLinks uint32
+	status       otlp.Status
+	ended        bool
+}
+
+// String attribute
+func String(key, value string) otlp.KeyValue {
+	return otlp.KeyValue{Key: key, Value: otlp.StringValue(value)}
+}
+
+// Int attribute
+func Int(key string, value int) otlp.KeyValue {
+	v := int64(value)
+	return otlp.KeyValue{Key: key, Value: otlp.AnyValue{IntValue: &v}}
+}
+
+// Context of the span, to be used as parent of child spans
+func (s *Span) Context() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.context
+}
+
+// SetAttributes -
+func (s *Span) SetAttributes(attributes ...otlp.KeyValue) {
+	if s == nil {
+		return
+	}
+	s.Lock()
+	defer s.Unlock()
+	s.attributes = append(s.attributes, attributes...)
+}
+
+// AddLink links the span to a span of another trace, e.g. the request which posted a flushed document
+func (s *Span) AddLink(sc SpanContext) {
+	if s == nil || !sc.IsValid() {
+		return
+	}
+	s.Lock()
+	defer s.Unlock()
+	if _, ok := s.linked[sc]; ok {
+		return
+	}
+	if len(s.links) >= maxLinks {
+		s.droppedLinks++
+		return
+	}
+	if s.linked == nil {
+		s.linked = make(map[SpanContext]struct{})
+	}
+	s.linked[sc] = struct{}{}
+	s.links = append(s.links, otlp.Link{
+		TraceID: append(otlp.HexBytes{}, sc.TraceID[:]...),
+		SpanID:  append(otlp.HexBytes{}, sc.SpanID[:]...),
+	})
+}
+
+// SetError marks the span as failed, nil errors are ignored
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.Lock()
+	defer s.Unlock()
+	s.status = otlp.Status{Code: otlp.StatusError, Message: err.Error()}
+}
+
+// End records the span; later calls are ignored
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.Lock()
+	if s.ended {
+		s.Unlock()
+		return
+	}
+	s.ended = true
+	s.Unlock()
+	if !s.context.Sampled {
+		return
+	}
+	span := otlp.Span{
+		TraceID:           append(otlp.HexBytes{}, s.context.TraceID[:]...),
+		SpanID:            append(otlp.HexBytes{}, s.context.SpanID[:]...),
+		Flags:             1,
+		Name:              s.name,
+		Kind:              s.kind,
+		StartTimeUnixNano: uint64(s.start.UnixNano()),
+		EndTimeUnixNano:   uint64(time.Now().UnixNano()),
+		Attributes:        s.attributes,
+		Links:             s.links,
+		DroppedLinksCount: s.droppedLinks,
+		Status:            s.status,
+	}
+	if s.parentSpanID != [8]byte{} {
+		span.ParentSpanID = append(otlp.HexBytes{}, s.parentSpanID[:]...)
+	}
+	s.tracer.exporter.enqueue(span)
+}
@@ -0,0 +1,142 @@
+// Package trace records OpenTelemetry spans of the document journey,
+// from ingestion to buffering, flush and delivery to each output,
+// and exports them to an OTLP collector.
+// ref: https://opentelemetry.io/docs/specs/otel/trace/api/
+package trace
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"log/slog"
+	"math"
+	"sync/atomic"
+	"time"
+
+	"github.com/khezen/bulklog/pkg/otlp"
+)
+
+const (
+	// ProtocolHTTPJSON - OTLP/HTTP with JSON encoding
+	ProtocolHTTPJSON = "http/json"
+	// ProtocolHTTPProtobuf - OTLP/HTTP with protobuf encoding
+	ProtocolHTTPProtobuf = "http/protobuf"
+	// ProtocolGRPC - OTLP/gRPC
+	ProtocolGRPC = "grpc"
+
+	defaultServiceName = "bulklog"
+	scopeName          = "github.com/khezen/bulklog"
+)
+
+var (
+	// ErrUnsupportedProtocol -
+	ErrUnsupportedProtocol = errors.New("ErrUnsupportedProtocol - tracing protocol must be one of http/protobuf|http/json|grpc")
+	// ErrWrongSampleRatio -
+	ErrWrongSampleRatio = errors.New("ErrWrongSampleRatio - tracing sample_ratio must be between 0 and 1")
+)
+
+// Config - tracing is disabled by default
+type Config struct {
+	Enabled     bool              `yaml:"enabled"`
+	Endpoint    string            `yaml:"endpoint"`
+	Protocol    string            `yaml:"protocol"`
+	Insecure    bool              `yaml:"insecure"`
+	Headers     map[string]string `yaml:"headers"`
+	ServiceName string            `yaml:"service_name"`
+	// SampleRatio of root traces, defaults to 1; propagated traces follow the caller decision
+	SampleRatio *float64 `yaml:"sample_ratio,omitempty"`
+	// Propagate extracts the trace context of incoming requests from the traceparent header
+	Propagate bool `yaml:"propagate"`
+}
+
+// Tracer starts spans and hands ended ones to its exporter
+type Tracer struct {
+	sampleRatio float64
+	exporter    *exporter
+}
+
+var global atomic.Pointer[Tracer]
+
+// Init enables tracing process wide
+func Init(cfg Config, logger *slog.Logger) error {
+	if !cfg.Enabled {
+		return nil
+	}
+	sampleRatio := 1.0
+	if cfg.SampleRatio != nil {
+		sampleRatio = *cfg.SampleRatio
+	}
+	if sampleRatio < 0 || sampleRatio > 1 {
+		return ErrWrongSampleRatio
+	}
+	if cfg.ServiceName == "" {
+		cfg.ServiceName = defaultServiceName
+	}
+	exporter, err := newExporter(cfg, logger)
+	if err != nil {
+		return err
+	}
+	global.Store(&Tracer{
+		sampleRatio: sampleRatio,
+		exporter:    exporter,
+	})
+	return nil
+}
+
+// Shutdown exports remaining spans until ctx is done
+func Shutdown(ctx context.Context) error {
+	tracer := global.Swap(nil)
+	if tracer == nil {
+		return nil
+	}
+	return tracer.exporter.shutdown(ctx)
+}
+
+// Start a span, child of parent if valid, root of a new trace otherwise.
+// It returns nil if tracing is disabled.
+func Start(parent SpanContext, name string, kind int, attributes ...otlp.KeyValue) *Span {
+	tracer := global.Load()
+	if tracer == nil {
+		return nil
+	}
+	span := &Span{
+		tracer:     tracer,
+		name:       name,
+		kind:       kind,
+		start:      time.Now(),
+		attributes: attributes,
+	}
+	if parent.IsValid() {
+		span.context.TraceID = parent.TraceID
+		span.context.Sampled = parent.Sampled
+		span.parentSpanID = parent.SpanID
+	} else {
+		rand.Read(span.context.TraceID[:])
+		span.context.Sampled = tracer.sample(span.context.TraceID)
+	}
+	rand.Read(span.context.SpanID[:])
+	return span
+}
+
+// StartFromContext starts a span whose parent is carried by ctx
+// and returns a copy of ctx carrying the new span.
+func StartFromContext(ctx context.Context, name string, kind int, attributes ...otlp.KeyValue) (context.Context, *Span) {
+	span := Start(FromContext(ctx), name, kind, attributes...)
+	if span == nil {
+		return ctx, nil
+	}
+	return ContextWith(ctx, span.Context()), span
+}
+
+// sample decides from the random low-order bytes of the trace ID,
+// ref: https://www.w3.org/TR/trace-context-2/#random-trace-id-flag
+func (t *Tracer) sample(traceID [16]byte) bool {
+	switch {
+	case t.sampleRatio >= 1:
+		return true
+	case t.sampleRatio <= 0:
+		return false
+	}
+	return binary.BigEndian.Uint64(traceID[8:]) < uint64(t.sampleRatio*math.MaxUint64)
+}
@@ -0,0 +1,116 @@
+package zstd
+
+import "math/bits"
+
+// backwardReader reads a bitstream from its end, as FSE and Huffman streams are written.
+// Bits past the beginning of the stream read as zeros and leave pos negative, which callers detect as overflows.
+type backwardReader struct {
+	in []byte
+	// pos - bits [0, pos) are left to read
+	pos int
+}
+
+// init skips the padding of the last byte up to, and including, its highest set bit
+func (b *backwardReader) init(in []byte) error {
+	if len(in) == 0 || in[len(in)-1] == 0 {
+		return ErrCorrupt
+	}
+	b.in = in
+	b.pos = (len(in)-1)*8 + bits.Len8(in[len(in)-1]) - 1
+	return nil
+}
+
+// read consumes n bits, the first read being the most significant
+func (b *backwardReader) read(n uint8) uint64 {
+	v := b.peek(n)
+	b.pos -= int(n)
+	return v
+}
+
+func (b *backwardReader) peek(n uint8) uint64 {
+	if n == 0 {
+		return 0
+	}
+	start, end := b.pos-int(n), b.pos
+	if end <= 0 {
+		return 0
+	}
+	shift := 0
+	if start < 0 {
+		shift, start = -start, 0
+	}
+	var v uint64
+	for i := (end - 1) >> 3; i >= start>>3; i-- {
+		v = v<<8 | uint64(b.in[i])
+	}
+	v >>= uint(start & 7)
+	v &= 1<<uint(end-start) - 1
+	return v << uint(shift)
+}
+
+// overflowed tells whether more bits were read than the stream holds
+func (b *backwardReader) overflowed() bool {
+	return b.pos < 0
+}
+
+// forwardReader reads a bitstream from its beginning, as FSE table descriptions are written
+type forwardReader struct {
+	in  []byte
+	pos int
+}
+
+func (f *forwardReader) read(n uint) (uint32, error) {
+	if f.pos+int(n) > len(f.in)*8 {
+		return 0, ErrCorrupt
+	}
+	var v uint32
+	for i := uint(0); i < n; i++ {
+		bit := f.in[(f.pos)>>3] >> uint(f.pos&7) & 1
+		v |= uint32(bit) << i
+		f.pos++
+	}
+	return v, nil
+}
+
+func (f *forwardReader) rewind(n int) {
+	f.pos -= n
+}
+
+// bytesRead - bytes consumed, the last one possibly partially
+func (f *forwardReader) bytesRead() int {
+	return (f.pos + 7) >> 3
+}
+
+// bitWriter writes a bitstream for backwardReader, which reads the last written bits first
+type bitWriter struct {
+	out []byte
+	acc uint64
+	// n - bits of acc not written to out yet, less than 8 between writes
+	n uint
+}
+
+// write appends the n lowest bits of v, v holding no other bit
+func (w *bitWriter) write(v uint64, n uint8) {
+	w.acc |= v << w.n
+	w.n += uint(n)
+	for w.n >= 8 {
+		w.out = append(w.out, byte(w.acc))
+		w.acc >>= 8
+		w.n -= 8
+	}
+}
+
+// close writes the padding backwardReader.init skips, and returns the stream
+func (w *bitWriter) close() []byte {
+	w.write(1, 1)
+	return w.flush()
+}
+
+// flush returns the stream, its last byte completed with zeros as forwardReader expects
+func (w *bitWriter) flush() []byte {
+	if w.n > 0 {
+		w.out = append(w.out, byte(w.acc))
+		w.acc, w.n = 0, 0
+	}
+	return w.out
+}
@@ -0,0 +1,325 @@
+package zstd
+
+import "encoding/binary"
+
+// block types
+const (
+	blockRaw        = 0
+	blockRLE        = 1
+	blockCompressed = 2
+)
+
+// literals block types
+const (
+	literalsRaw        = 0
+	literalsRLE        = 1
+	literalsCompressed = 2
+	literalsTreeless   = 3
+)
+
+// sequence table modes
+const (
+	modePredefined = 0
+	modeRLE        = 1
+	modeCompressed = 2
+	modeRepeat     = 3
+)
+
+const (
+	maxLiteralsLengthCode = 35
+	maxMatchLengthCode    = 52
+	maxOffsetCode         = 31
+)
+
+var (
+	literalsLengthBase = [maxLiteralsLengthCode + 1]uint32{
+		0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15,
+		16, 18, 20, 22, 24, 28, 32, 40, 48, 64, 0x80, 0x100, 0x200, 0x400, 0x800, 0x1000,
+		0x2000, 0x4000, 0x8000, 0x10000,
+	}
+	literalsLengthBits = [maxLiteralsLengthCode + 1]uint8{
+		0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+		1, 1, 1, 1, 2, 2, 3, 3, 4, 6, 7, 8, 9, 10, 11, 12,
+		13, 14, 15, 16,
+	}
+	matchLengthBase = [maxMatchLengthCode + 1]uint32{
+		3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18,
+		19, 20, 21, 22, 23, 24, 25, 26, 27, 28, 29, 30, 31, 32, 33, 34,
+		35, 37, 39, 41, 43, 47, 51, 59, 67, 83, 99, 0x83, 0x103, 0x203, 0x403, 0x803,
+		0x1003, 0x2003, 0x4003, 0x8003, 0x10003,
+	}
+	matchLengthBits = [maxMatchLengthCode + 1]uint8{
+		0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+		0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+		1, 1, 1, 1, 2, 2, 3, 3, 4, 4, 5, 7, 8, 9, 10, 11,
+		12, 13, 14, 15, 16,
+	}
+)
+
+// decodeCompressed appends the content of a compressed block to r.out
+func (r *Reader) decodeCompressed(in []byte) error {
+	literals, size, err := r.decodeLiterals(in)
+	if err != nil {
+		return err
+	}
+	return r.executeSequences(in[size:], literals)
+}
+
+// decodeLiterals returns the literals of a block and the bytes their section spans
+func (r *Reader) decodeLiterals(in []byte) ([]byte, int, error) {
+	if len(in) == 0 {
+		return nil, 0, ErrCorrupt
+	}
+	typ, sizeFormat := in[0]&3, in[0]>>2&3
+	switch typ {
+	case literalsRaw, literalsRLE:
+		var regenerated, header int
+		switch sizeFormat {
+		case 0, 2:
+			regenerated, header = int(in[0]>>3), 1
+		case 1:
+			if len(in) < 2 {
+				return nil, 0, ErrCorrupt
+			}
+			regenerated, header = int(in[0]>>4)|int(in[1])<<4, 2
+		default:
+			if len(in) < 3 {
+				return nil, 0, ErrCorrupt
+			}
+			regenerated, header = int(in[0]>>4)|int(in[1])<<4|int(in[2])<<12, 3
+		}
+		if regenerated > maxBlockSize {
+			return nil, 0, ErrCorrupt
+		}
+		if typ == literalsRaw {
+			if len(in) < header+regenerated {
+				return nil, 0, ErrCorrupt
+			}
+			return in[header : header+regenerated], header + regenerated, nil
+		}
+		if len(in) < header+1 {
+			return nil, 0, ErrCorrupt
+		}
+		literals := r.literals[:regenerated]
+		for i := range literals {
+			literals[i] = in[header]
+		}
+		return literals, header + 1, nil
+	default:
+		var (
+			regenerated, compressedSize, header int
+			streams                             = 4
+		)
+		switch sizeFormat {
+		case 0, 1:
+			if sizeFormat == 0 {
+				streams = 1
+			}
+			if len(in) < 3 {
+				return nil, 0, ErrCorrupt
+			}
+			v := uint32(in[0]) | uint32(in[1])<<8 | uint32(in[2])<<16
+			regenerated, compressedSize, header = int(v>>4&0x3ff), int(v>>14&0x3ff), 3
+		case 2:
+			if len(in) < 4 {
+				return nil, 0, ErrCorrupt
+			}
+			v := binary.LittleEndian.Uint32(in)
+			regenerated, compressedSize, header = int(v>>4&0x3fff), int(v>>18&0x3fff), 4
+		default:
+			if len(in) < 5 {
+				return nil, 0, ErrCorrupt
+			}
+			v := uint64(binary.LittleEndian.Uint32(in)) | uint64(in[4])<<32
+			regenerated, compressedSize, header = int(v>>4&0x3ffff), int(v>>22&0x3ffff), 5
+		}
+		if regenerated > maxBlockSize || len(in) < header+compressedSize {
+			return nil, 0, ErrCorrupt
+		}
+		data := in[header : header+compressedSize]
+		if typ == literalsCompressed {
+			table, size, err := readHuffmanTable(data)
+			if err != nil {
+				return nil, 0, err
+			}
+			r.huffman, data = table, data[size:]
+		} else if r.huffman == nil {
+			return nil, 0, ErrCorrupt
+		}
+		literals := r.literals[:regenerated]
+		if streams == 1 {
+			err := r.huffman.decodeStream(data, literals)
+			if err != nil {
+				return nil, 0, err
+			}
+			return literals, header + compressedSize, nil
+		}
+		// a jump table tells the sizes of the first 3 streams, each of which decodes a quarter of the literals
+		if len(data) < 6 {
+			return nil, 0, ErrCorrupt
+		}
+		var (
+			sizes   = [4]int{int(binary.LittleEndian.Uint16(data)), int(binary.LittleEndian.Uint16(data[2:])), int(binary.LittleEndian.Uint16(data[4:]))}
+			segment = (regenerated + 3) / 4
+		)
+		data = data[6:]
+		sizes[3] = len(data) - sizes[0] - sizes[1] - sizes[2]
+		if sizes[3] < 0 || 3*segment > regenerated {
+			return nil, 0, ErrCorrupt
+		}
+		for i, size := range sizes {
+			out := literals[i*segment:]
+			if i < 3 {
+				out = out[:segment]
+			}
+			err := r.huffman.decodeStream(data[:size], out)
+			if err != nil {
+				return nil, 0, err
+			}
+			data = data[size:]
+		}
+		return literals, header + compressedSize, nil
+	}
+}
+
+// executeSequences decodes the sequences section, then appends literals and the matches they interleave with
+func (r *Reader) executeSequences(in, literals []byte) error {
+	if len(in) == 0 {
+		return ErrCorrupt
+	}
+	var count int
+	switch b := int(in[0]); {
+	case b == 0:
+		r.out = append(r.out, literals...)
+		return nil
+	case b < 128:
+		count, in = b, in[1:]
+	case b < 255:
+		if len(in) < 2 {
+			return ErrCorrupt
+		}
+		count, in = (b-128)<<8+int(in[1]), in[2:]
+	default:
+		if len(in) < 3 {
+			return ErrCorrupt
+		}
+		count, in = int(in[1])+int(in[2])<<8+0x7f00, in[3:]
+	}
+	if len(in) == 0 || in[0]&3 != 0 {
+		return ErrCorrupt
+	}
+	modes := in[0]
+	in = in[1:]
+	var err error
+	r.literalsLengths, in, err = sequenceTable(modes>>6, in, r.literalsLengths, literalsLengthTable, maxLiteralsLengthCode, 9)
+	if err != nil {
+		return err
+	}
+	r.offsets, in, err = sequenceTable(modes>>4&3, in, r.offsets, offsetTable, maxOffsetCode, 8)
+	if err != nil {
+		return err
+	}
+	r.matchLengths, in, err = sequenceTable(modes>>2&3, in, r.matchLengths, matchLengthTable, maxMatchLengthCode, 9)
+	if err != nil {
+		return err
+	}
+	var (
+		br                                       backwardReader
+		literalsLength, offsetState, matchLength fseState
+	)
+	err = br.init(in)
+	if err != nil {
+		return err
+	}
+	literalsLength.init(r.literalsLengths, &br)
+	offsetState.init(r.offsets, &br)
+	matchLength.init(r.matchLengths, &br)
+	for i := 0; i < count; i++ {
+		llCode, ofCode, mlCode := literalsLength.symbol(), offsetState.symbol(), matchLength.symbol()
+		if llCode > maxLiteralsLengthCode || mlCode > maxMatchLengthCode || ofCode > maxOffsetCode {
+			return ErrCorrupt
+		}
+		offsetValue := int(1<<ofCode + br.read(ofCode))
+		ml := int(matchLengthBase[mlCode]) + int(br.read(matchLengthBits[mlCode]))
+		ll := int(literalsLengthBase[llCode]) + int(br.read(literalsLengthBits[llCode]))
+		if i < count-1 {
+			literalsLength.update(&br)
+			matchLength.update(&br)
+			offsetState.update(&br)
+		}
+		if br.overflowed() || ll > len(literals) {
+			return ErrCorrupt
+		}
+		r.out = append(r.out, literals[:ll]...)
+		literals = literals[ll:]
+		offset := r.offset(offsetValue, ll)
+		if offset <= 0 || offset > len(r.out) {
+			return ErrCorrupt
+		}
+		start := len(r.out) - offset
+		if offset >= ml {
+			r.out = append(r.out, r.out[start:start+ml]...)
+			continue
+		}
+		// overlapping matches repeat the bytes they copy
+		for j := 0; j < ml; j++ {
+			r.out = append(r.out, r.out[start+j])
+		}
+	}
+	if br.pos != 0 {
+		return ErrCorrupt
+	}
+	r.out = append(r.out, literals...)
+	return nil
+}
+
+// offset resolves an offset value, 1 to 3 standing for repeat offsets, and updates repeat offsets
+func (r *Reader) offset(offsetValue, literalsLength int) int {
+	if offsetValue > 3 {
+		offset := offsetValue - 3
+		r.repeats = [3]int{offset, r.repeats[0], r.repeats[1]}
+		return offset
+	}
+	if literalsLength == 0 {
+		offsetValue++
+	}
+	var offset int
+	switch offsetValue {
+	case 1:
+		return r.repeats[0]
+	case 2:
+		offset = r.repeats[1]
+		r.repeats = [3]int{offset, r.repeats[0], r.repeats[2]}
+	case 3:
+		offset = r.repeats[2]
+		r.repeats = [3]int{offset, r.repeats[0], r.repeats[1]}
+	default:
+		offset = r.repeats[0] - 1
+		r.repeats = [3]int{offset, r.repeats[0], r.repeats[1]}
+	}
+	return offset
+}
+
+// sequenceTable returns the table of a sequence code for mode, and what follows its description in in
+func sequenceTable(mode uint8, in []byte, previous, predefined *fseTable, maxSymbol int, maxAccuracyLog uint8) (*fseTable, []byte, error) {
+	switch mode {
+	case modePredefined:
+		return predefined, in, nil
+	case modeRLE:
+		if len(in) == 0 || int(in[0]) > maxSymbol {
+			return nil, nil, ErrCorrupt
+		}
+		return rleTable(in[0]), in[1:], nil
+	case modeCompressed:
+		table, size, err := readFSETable(in, maxSymbol, maxAccuracyLog)
+		if err != nil {
+			return nil, nil, err
+		}
+		return table, in[size:], nil
+	default:
+		if previous == nil {
+			return nil, nil, ErrCorrupt
+		}
+		return previous, in, nil
+	}
+}
@@ -0,0 +1,220 @@
+package zstd
+
+import (
+	"encoding/binary"
+	"math/bits"
+)
+
+const (
+	// encodeWindowLog - larger inputs are matched within a window of that size, which decoders allocate instead of the whole content
+	encodeWindowLog = 23
+	// minMatch - shorter matches are encoded as literals, as they cost more than huffman compressed literals do
+	minMatch    = 6
+	maxHashBits = 16
+	// maxChainBits - positions of a same hash are chained within the last 1 << maxChainBits bytes at most
+	maxChainBits = 16
+	// maxDepth - candidates of a chain compared, the longest match winning
+	maxDepth = 8
+)
+
+// sequence - literals copied as is, followed by a match of earlier bytes
+type sequence struct {
+	literals int
+	// offsetValue - 1 for the latest offset, offset + 3 otherwise
+	offsetValue int
+	match       int
+}
+
+// encoder greedily replaces byte sequences seen earlier in the window by the longest match of a few candidates, trying the latest offset first.
+// Literals are huffman compressed, sequences use the distributions of their block unless predefined ones are cheaper.
+type encoder struct {
+	src    []byte
+	window int
+	// table - latest position of every hash, plus one so that zero is empty
+	table    []int
+	hashBits uint
+	// chain - previous position of the same hash, plus one, of the last len(chain) positions
+	chain []int
+	// repeats - repeat offsets, as the decoder updates them
+	repeats  [3]int
+	literals []byte
+	seqs     []sequence
+}
+
+// Encode returns src compressed as a single zstd frame, with a checksum
+func Encode(src []byte) []byte {
+	dst := appendFrameHeader(make([]byte, 0, len(src)/2+32), len(src))
+	hashBits, chainBits := uint(bits.Len(uint(len(src)))), uint(bits.Len(uint(len(src))))
+	if hashBits > maxHashBits {
+		hashBits = maxHashBits
+	}
+	if chainBits > maxChainBits {
+		chainBits = maxChainBits
+	}
+	e := encoder{
+		src:      src,
+		window:   1 << encodeWindowLog,
+		table:    make([]int, 1<<hashBits),
+		chain:    make([]int, 1<<chainBits),
+		hashBits: hashBits,
+		repeats:  [3]int{1, 4, 8},
+	}
+	if len(src) <= e.window {
+		// the window spans the whole content
+		e.window = len(src)
+	}
+	if len(src) == 0 {
+		dst = append(dst, 1|blockRaw<<1, 0, 0)
+	}
+	for start := 0; start < len(src); start += maxBlockSize {
+		end := start + maxBlockSize
+		if end > len(src) {
+			end = len(src)
+		}
+		dst = e.appendBlock(dst, start, end, end == len(src))
+	}
+	var digest xxhash
+	digest.reset()
+	digest.write(src)
+	return binary.LittleEndian.AppendUint32(dst, uint32(digest.sum64()))
+}
+
+func appendFrameHeader(dst []byte, size int) []byte {
+	dst = binary.LittleEndian.AppendUint32(dst, frameMagic)
+	var (
+		singleSegment = size <= 1<<encodeWindowLog
+		descriptor    = byte(1 << 2) // checksum
+		contentSize   []byte
+	)
+	switch {
+	case size < 256 && singleSegment:
+		contentSize = []byte{byte(size)}
+	case size < 256+1<<16:
+		descriptor |= 1 << 6
+		contentSize = binary.LittleEndian.AppendUint16(nil, uint16(size-256))
+	case uint64(size) < 1<<32:
+		descriptor |= 2 << 6
+		contentSize = binary.LittleEndian.AppendUint32(nil, uint32(size))
+	default:
+		descriptor |= 3 << 6
+		contentSize = binary.LittleEndian.AppendUint64(nil, uint64(size))
+	}
+	if singleSegment {
+		dst = append(dst, descriptor|1<<5)
+	} else {
+		dst = append(dst, descriptor, (encodeWindowLog-minWindowLog)<<3)
+	}
+	return append(dst, contentSize...)
+}
+
+// appendBlock writes src[start:end] as a compressed block, or as a raw one if it does not get smaller
+func (e *encoder) appendBlock(dst []byte, start, end int, last bool) []byte {
+	e.findSequences(start, end)
+	var (
+		headerAt = len(dst)
+		lastBit  uint32
+	)
+	if last {
+		lastBit = 1
+	}
+	dst = append(dst, 0, 0, 0)
+	dst = appendSequences(appendLiterals(dst, e.literals), e.seqs)
+	size := len(dst) - headerAt - 3
+	if size < end-start {
+		header := lastBit | blockCompressed<<1 | uint32(size)<<3
+		dst[headerAt], dst[headerAt+1], dst[headerAt+2] = byte(header), byte(header>>8), byte(header>>16)
+		return dst
+	}
+	header := lastBit | blockRaw<<1 | uint32(end-start)<<3
+	dst = append(dst[:headerAt], byte(header), byte(header>>8), byte(header>>16))
+	return append(dst, e.src[start:end]...)
+}
+
+// findSequences fills e.seqs and e.literals with the matches of src[start:end], which may reference earlier blocks
+func (e *encoder) findSequences(start, end int) {
+	var (
+		src    = e.src
+		anchor = start
+		i      = start
+	)
+	e.seqs, e.literals = e.seqs[:0], e.literals[:0]
+	for i+8 <= end {
+		// the latest offset, again after some literals, costs no offset bits
+		if repeat := e.repeats[0]; i > anchor && repeat <= i && repeat < e.window &&
+			binary.LittleEndian.Uint32(src[i-repeat:]) == binary.LittleEndian.Uint32(src[i:]) {
+			length := 4
+			for i+length < end && src[i-repeat+length] == src[i+length] {
+				length++
+			}
+			e.seqs = append(e.seqs, sequence{literals: i - anchor, offsetValue: 1, match: length})
+			e.literals = append(e.literals, src[anchor:i]...)
+			i += length
+			anchor = i
+			continue
+		}
+		candidate, length := e.longestMatch(i, end)
+		if length == 0 {
+			// skips faster through incompressible data
+			i += 1 + (i-anchor)>>6
+			continue
+		}
+		offset := i - candidate
+		for i > anchor && candidate > 0 && src[i-1] == src[candidate-1] {
+			i--
+			candidate--
+			length++
+		}
+		e.seqs = append(e.seqs, sequence{literals: i - anchor, offsetValue: offset + 3, match: length})
+		e.repeats = [3]int{offset, e.repeats[0], e.repeats[1]}
+		e.literals = append(e.literals, src[anchor:i]...)
+		i += length
+		anchor = i
+		for j := i - length + 1; j < i && j+8 <= end; j++ {
+			e.insert(j)
+		}
+	}
+	e.literals = append(e.literals, src[anchor:end]...)
+}
+
+// insert chains position i to the previous one of its hash
+func (e *encoder) insert(i int) {
+	h := e.hash(binary.LittleEndian.Uint64(e.src[i:]))
+	e.chain[i&(len(e.chain)-1)] = e.table[h]
+	e.table[h] = i + 1
+}
+
+// longestMatch inserts position i, and returns the longest match of its chain, of zero length if none
+func (e *encoder) longestMatch(i, end int) (candidate, length int) {
+	h := e.hash(binary.LittleEndian.Uint64(e.src[i:]))
+	next := e.table[h] - 1
+	e.chain[i&(len(e.chain)-1)] = e.table[h]
+	e.table[h] = i + 1
+	for depth := 0; depth < maxDepth && next >= 0 && i-next < e.window; depth++ {
+		if e.matches(next, i) {
+			l := minMatch
+			for i+l < end && e.src[next+l] == e.src[i+l] {
+				l++
+			}
+			if l > length {
+				candidate, length = next, l
+			}
+		}
+		previous := e.chain[next&(len(e.chain)-1)] - 1
+		// chained positions are overwritten once they are len(e.chain) bytes away
+		if previous >= next || i-previous >= len(e.chain) {
+			break
+		}
+		next = previous
+	}
+	return candidate, length
+}
+
+// hash hashes the minMatch bytes u starts with
+func (e *encoder) hash(u uint64) uint64 {
+	return (u << (64 - 8*minMatch) * 0xcf1bbcdcb7a56463) >> (64 - e.hashBits)
+}
+
+// matches tells whether the minMatch bytes at candidate and i are the same
+func (e *encoder) matches(candidate, i int) bool {
+	return (binary.LittleEndian.Uint64(e.src[candidate:])^binary.LittleEndian.Uint64(e.src[i:]))<<(64-8*minMatch) == 0
+}
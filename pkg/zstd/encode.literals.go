@@ -0,0 +1,233 @@
+package zstd
+
+import "sort"
+
+const (
+	// maxDirectSymbol - weight descriptions are written directly, 4 bits each, which describes up to 128 weights
+	maxDirectSymbol = 128
+	// minHuffmanLiterals - fewer literals are not worth a tree description
+	minHuffmanLiterals = 64
+	// minLiteralsFor4Streams - fewer literals are huffman compressed in a single stream
+	minLiteralsFor4Streams = 1024
+)
+
+// huffmanCode - prefix code of a symbol, read first by the decoder
+type huffmanCode struct {
+	code   uint16
+	nbBits uint8
+}
+
+// appendLiterals writes the literals section of a block: huffman compressed when it is smaller, raw otherwise
+func appendLiterals(dst, literals []byte) []byte {
+	var (
+		counts    [256]int
+		maxSymbol int
+		distinct  int
+	)
+	for _, b := range literals {
+		if counts[b] == 0 {
+			distinct++
+		}
+		counts[b]++
+		if int(b) > maxSymbol {
+			maxSymbol = int(b)
+		}
+	}
+	if distinct == 1 && len(literals) > 1 {
+		return append(appendLiteralsHeader(dst, literalsRLE, len(literals)), literals[0])
+	}
+	if distinct > 1 && maxSymbol <= maxDirectSymbol && len(literals) >= minHuffmanLiterals {
+		start := len(dst)
+		dst = appendHuffmanLiterals(dst, literals, counts[:maxSymbol+1])
+		if len(dst)-start < len(literals) {
+			return dst
+		}
+		dst = dst[:start]
+	}
+	return append(appendLiteralsHeader(dst, literalsRaw, len(literals)), literals...)
+}
+
+// appendLiteralsHeader writes the header of raw and RLE literals
+func appendLiteralsHeader(dst []byte, typ byte, size int) []byte {
+	switch {
+	case size < 1<<5:
+		return append(dst, typ|byte(size)<<3)
+	case size < 1<<12:
+		return append(dst, typ|1<<2|byte(size&0xf)<<4, byte(size>>4))
+	default:
+		return append(dst, typ|3<<2|byte(size&0xf)<<4, byte(size>>4), byte(size>>12))
+	}
+}
+
+// appendHuffmanLiterals writes literals compressed with the huffman codes of their counts, in 4 streams unless they are few
+func appendHuffmanLiterals(dst, literals []byte, counts []int) []byte {
+	lengths := huffmanLengths(counts, maxHuffmanBits)
+	codes, weights := huffmanCodes(lengths)
+	var (
+		streams    = 4
+		sizeFormat = byte(2)
+		header     = 4
+	)
+	switch {
+	case len(literals) < minLiteralsFor4Streams:
+		streams, sizeFormat, header = 1, 0, 3
+	case len(literals) >= 1<<14:
+		sizeFormat, header = 3, 5
+	}
+	headerAt := len(dst)
+	dst = append(dst, make([]byte, header)...)
+	// weights of the last symbol are implied
+	dst = append(dst, byte(127+len(weights)-1))
+	for i := 0; i < len(weights)-1; i += 2 {
+		b := weights[i] << 4
+		if i+1 < len(weights)-1 {
+			b |= weights[i+1]
+		}
+		dst = append(dst, b)
+	}
+	if streams == 1 {
+		dst = appendHuffmanStream(dst, literals, codes)
+	} else {
+		jumpTableAt := len(dst)
+		dst = append(dst, 0, 0, 0, 0, 0, 0)
+		segment := (len(literals) + 3) / 4
+		for i := 0; i < 4; i++ {
+			streamAt := len(dst)
+			end := (i + 1) * segment
+			if i == 3 {
+				end = len(literals)
+			}
+			dst = appendHuffmanStream(dst, literals[i*segment:end], codes)
+			if i < 3 {
+				size := len(dst) - streamAt
+				dst[jumpTableAt+2*i], dst[jumpTableAt+2*i+1] = byte(size), byte(size>>8)
+			}
+		}
+	}
+	var (
+		regenerated = uint64(len(literals))
+		compressed  = uint64(len(dst) - headerAt - header)
+		v           = uint64(literalsCompressed) | uint64(sizeFormat)<<2 | regenerated<<4
+	)
+	switch sizeFormat {
+	case 0:
+		v |= compressed << 14
+	case 2:
+		v |= compressed << 18
+	default:
+		v |= compressed << 22
+	}
+	for i := 0; i < header; i++ {
+		dst[headerAt+i] = byte(v >> (8 * uint(i)))
+	}
+	return dst
+}
+
+// appendHuffmanStream writes symbols from the last one, so that they are decoded from the first one
+func appendHuffmanStream(dst, symbols []byte, codes []huffmanCode) []byte {
+	w := bitWriter{out: dst}
+	for i := len(symbols) - 1; i >= 0; i-- {
+		c := codes[symbols[i]]
+		w.write(uint64(c.code), c.nbBits)
+	}
+	return w.close()
+}
+
+// huffmanLengths returns the code lengths of a huffman tree of counts, at most maxBits.
+// Counts are halved until the tree is shallow enough.
+func huffmanLengths(counts []int, maxBits uint8) []uint8 {
+	counts = append([]int(nil), counts...)
+	for {
+		lengths := huffmanTree(counts)
+		deepest := uint8(0)
+		for _, l := range lengths {
+			if l > deepest {
+				deepest = l
+			}
+		}
+		if deepest <= maxBits {
+			return lengths
+		}
+		for i, c := range counts {
+			if c > 0 {
+				counts[i] = (c + 1) / 2
+			}
+		}
+	}
+}
+
+// huffmanTree merges the two lightest nodes until one is left, leaves sorted by count and merged nodes
+// being queued by increasing weight. It returns the depth of every symbol, zero for absent ones.
+func huffmanTree(counts []int) []uint8 {
+	var leaves []int
+	for symbol, c := range counts {
+		if c > 0 {
+			leaves = append(leaves, symbol)
+		}
+	}
+	sort.SliceStable(leaves, func(i, j int) bool { return counts[leaves[i]] < counts[leaves[j]] })
+	var (
+		n        = len(leaves)
+		weight   = make([]int, n, 2*n-1)
+		parent   = make([]int, 2*n-1)
+		leaf     = 0
+		merged   = n
+		lightest = func() int {
+			if leaf < n && (merged >= len(weight) || weight[leaf] <= weight[merged]) {
+				leaf++
+				return leaf - 1
+			}
+			merged++
+			return merged - 1
+		}
+	)
+	for i, symbol := range leaves {
+		weight[i] = counts[symbol]
+	}
+	for len(weight) < 2*n-1 {
+		a, b := lightest(), lightest()
+		parent[a], parent[b] = len(weight), len(weight)
+		weight = append(weight, weight[a]+weight[b])
+	}
+	// parents come after their children
+	depth := make([]uint8, 2*n-1)
+	for node := 2*n - 3; node >= 0; node-- {
+		depth[node] = depth[parent[node]] + 1
+	}
+	lengths := make([]uint8, len(counts))
+	for i, symbol := range leaves {
+		lengths[symbol] = depth[i]
+	}
+	return lengths
+}
+
+// huffmanCodes assigns prefix codes the way buildHuffmanTable reads them: from the lowest weight up,
+// symbols of a same weight in their natural order. It returns the codes and the weights of symbols.
+func huffmanCodes(lengths []uint8) ([]huffmanCode, []uint8) {
+	var maxBits uint8
+	for _, l := range lengths {
+		if l > maxBits {
+			maxBits = l
+		}
+	}
+	weights := make([]uint8, len(lengths))
+	for symbol, l := range lengths {
+		if l > 0 {
+			weights[symbol] = maxBits + 1 - l
+		}
+	}
+	var (
+		codes = make([]huffmanCode, 256)
+		pos   = 0
+	)
+	for w := uint8(1); w <= maxBits; w++ {
+		for symbol, weight := range weights {
+			if weight != w {
+				continue
+			}
+			codes[symbol] = huffmanCode{uint16(pos >> (w - 1)), maxBits + 1 - w}
+			pos += 1 << (w - 1)
+		}
+	}
+	return codes, weights
+}
@@ -0,0 +1,270 @@
+package zstd
+
+import (
+	"math"
+	"math/bits"
+	"sort"
+)
+
+// fseEncoder walks a decoding table backward: from the state a symbol leads to, it finds the state the symbol is decoded from
+type fseEncoder struct {
+	table *fseTable
+	// from - per symbol, the state whose update leads to each state
+	from [][]uint16
+	// cells - per symbol, the states decoding it
+	cells []int
+}
+
+func newFSEEncoder(table *fseTable, maxSymbol int) *fseEncoder {
+	var (
+		from  = make([][]uint16, maxSymbol+1)
+		cells = make([]int, maxSymbol+1)
+	)
+	for state, entry := range table.entries {
+		if from[entry.symbol] == nil {
+			from[entry.symbol] = make([]uint16, len(table.entries))
+		}
+		cells[entry.symbol]++
+		// the states of a symbol read ranges which partition the table
+		for next := int(entry.baseline); next < int(entry.baseline)+1<<entry.nbBits; next++ {
+			from[entry.symbol][next] = uint16(state)
+		}
+	}
+	return &fseEncoder{table, from, cells}
+}
+
+// transition writes the bits which lead the state decoding symbol to next, and returns that state
+func (e *fseEncoder) transition(w *bitWriter, symbol uint8, next uint16) uint16 {
+	state := e.from[symbol][next]
+	entry := e.table.entries[state]
+	w.write(uint64(next-entry.baseline), entry.nbBits)
+	return state
+}
+
+// cost - bits the symbols of counts take, about
+func (e *fseEncoder) cost(counts []int) float64 {
+	var (
+		size = float64(len(e.table.entries))
+		cost float64
+	)
+	for symbol, count := range counts {
+		if count == 0 {
+			continue
+		}
+		if symbol >= len(e.cells) || e.cells[symbol] == 0 {
+			return math.Inf(1)
+		}
+		cost += float64(count) * math.Log2(size/float64(e.cells[symbol]))
+	}
+	return cost
+}
+
+var (
+	literalsLengthEncoder = newFSEEncoder(literalsLengthTable, maxLiteralsLengthCode)
+	matchLengthEncoder    = newFSEEncoder(matchLengthTable, maxMatchLengthCode)
+	offsetEncoder         = newFSEEncoder(offsetTable, maxOffsetCode)
+)
+
+// sequenceCodes - codes of a sequence, and the extra bits each of them reads
+type sequenceCodes struct {
+	literalsLength, matchLength, offset                uint8
+	literalsLengthBits, matchLengthBits, offsetBits    uint8
+	literalsLengthExtra, matchLengthExtra, offsetExtra uint64
+}
+
+// appendSequences writes the sequences section of a block, each code with the cheapest of its predefined distribution,
+// a single symbol or the distribution of the block. Sequences are written from the last one, in the reverse order of executeSequences reads.
+func appendSequences(dst []byte, seqs []sequence) []byte {
+	switch count := len(seqs); {
+	case count == 0:
+		return append(dst, 0)
+	case count < 128:
+		dst = append(dst, byte(count))
+	case count < 0x7f00:
+		dst = append(dst, byte(count>>8+128), byte(count))
+	default:
+		count -= 0x7f00
+		dst = append(dst, 255, byte(count), byte(count>>8))
+	}
+	var (
+		codes                                  = make([]sequenceCodes, len(seqs))
+		literalsLengths, matchLengths, offsets [maxMatchLengthCode + 1]int
+	)
+	for i, seq := range seqs {
+		c := codesOf(seq)
+		codes[i] = c
+		literalsLengths[c.literalsLength]++
+		matchLengths[c.matchLength]++
+		offsets[c.offset]++
+	}
+	var (
+		modesAt                                         = len(dst)
+		literalsLengthMode, offsetMode, matchLengthMode uint8
+		llEncoder, ofEncoder, mlEncoder                 *fseEncoder
+	)
+	dst = append(dst, 0)
+	literalsLengthMode, llEncoder, dst = chooseTable(dst, literalsLengths[:maxLiteralsLengthCode+1], literalsLengthEncoder, 9)
+	offsetMode, ofEncoder, dst = chooseTable(dst, offsets[:maxOffsetCode+1], offsetEncoder, 8)
+	matchLengthMode, mlEncoder, dst = chooseTable(dst, matchLengths[:], matchLengthEncoder, 9)
+	dst[modesAt] = literalsLengthMode<<6 | offsetMode<<4 | matchLengthMode<<2
+	var (
+		w                                        = bitWriter{out: dst}
+		literalsLength, matchLength, offsetState uint16
+		last                                     = len(seqs) - 1
+	)
+	for i := last; i >= 0; i-- {
+		c := codes[i]
+		if i == last {
+			literalsLength = llEncoder.from[c.literalsLength][0]
+			matchLength = mlEncoder.from[c.matchLength][0]
+			offsetState = ofEncoder.from[c.offset][0]
+		} else {
+			offsetState = ofEncoder.transition(&w, c.offset, offsetState)
+			matchLength = mlEncoder.transition(&w, c.matchLength, matchLength)
+			literalsLength = llEncoder.transition(&w, c.literalsLength, literalsLength)
+		}
+		w.write(c.literalsLengthExtra, c.literalsLengthBits)
+		w.write(c.matchLengthExtra, c.matchLengthBits)
+		w.write(c.offsetExtra, c.offsetBits)
+	}
+	w.write(uint64(matchLength), mlEncoder.table.accuracyLog)
+	w.write(uint64(offsetState), ofEncoder.table.accuracyLog)
+	w.write(uint64(literalsLength), llEncoder.table.accuracyLog)
+	return w.close()
+}
+
+// chooseTable returns the cheapest mode for the symbols of counts, its encoder, and dst along with the description of its table
+func chooseTable(dst []byte, counts []int, predefined *fseEncoder, maxAccuracyLog uint8) (uint8, *fseEncoder, []byte) {
+	var total, distinct, maxSymbol int
+	for symbol, count := range counts {
+		if count > 0 {
+			total += count
+			distinct++
+			maxSymbol = symbol
+		}
+	}
+	if distinct == 1 {
+		return modeRLE, newFSEEncoder(rleTable(uint8(maxSymbol)), maxSymbol), append(dst, byte(maxSymbol))
+	}
+	// more states than symbols do not tell probabilities more precisely
+	accuracyLog := uint8(5)
+	for accuracyLog < maxAccuracyLog && (1<<accuracyLog < 2*distinct || 4<<accuracyLog < total) {
+		accuracyLog++
+	}
+	description := appendFSETable(nil, normalize(counts[:maxSymbol+1], total, accuracyLog), accuracyLog)
+	table, _, err := readFSETable(description, maxSymbol, accuracyLog)
+	if err != nil {
+		return modePredefined, predefined, dst
+	}
+	custom := newFSEEncoder(table, maxSymbol)
+	if float64(8*len(description))+custom.cost(counts) >= predefined.cost(counts) {
+		return modePredefined, predefined, dst
+	}
+	return modeCompressed, custom, append(dst, description...)
+}
+
+// normalize scales counts to probabilities summing to 1 << accuracyLog, every symbol present keeping at least 1
+func normalize(counts []int, total int, accuracyLog uint8) []int16 {
+	var (
+		size    = 1 << accuracyLog
+		probas  = make([]int16, len(counts))
+		sum     int
+		largest int
+	)
+	for symbol, count := range counts {
+		if count == 0 {
+			continue
+		}
+		proba := int((uint64(count)*uint64(size) + uint64(total)/2) / uint64(total))
+		if proba < 1 {
+			proba = 1
+		}
+		probas[symbol] = int16(proba)
+		sum += proba
+		if probas[symbol] > probas[largest] {
+			largest = symbol
+		}
+	}
+	// rounding errors are corrected on the largest probabilities, which they matter the least to
+	for sum < size {
+		probas[largest]++
+		sum++
+	}
+	for sum > size {
+		largest = 0
+		for symbol, proba := range probas {
+			if proba > probas[largest] {
+				largest = symbol
+			}
+		}
+		probas[largest]--
+		sum--
+	}
+	return probas
+}
+
+// appendFSETable writes the description readFSETable reads
+func appendFSETable(dst []byte, probas []int16, accuracyLog uint8) []byte {
+	var (
+		w         = bitWriter{out: dst}
+		remaining = 1 << accuracyLog
+	)
+	w.write(uint64(accuracyLog-5), 4)
+	for symbol := 0; remaining > 0 && symbol < len(probas); symbol++ {
+		var (
+			value  = uint32(probas[symbol] + 1)
+			nbBits = uint8(bits.Len(uint(remaining + 1)))
+			// values lower than threshold are written on a bit less
+			lowerMask = uint32(1)<<(nbBits-1) - 1
+			threshold = uint32(1)<<nbBits - 1 - uint32(remaining+1)
+		)
+		switch {
+		case value < threshold:
+			w.write(uint64(value), nbBits-1)
+		case value <= lowerMask:
+			w.write(uint64(value), nbBits)
+		default:
+			w.write(uint64(value+threshold), nbBits)
+		}
+		if probas[symbol] < 0 {
+			remaining--
+		} else {
+			remaining -= int(probas[symbol])
+		}
+		if probas[symbol] != 0 {
+			continue
+		}
+		// how many more zero probabilities follow, 2 bits at a time
+		zeros := 0
+		for symbol+1+zeros < len(probas) && probas[symbol+1+zeros] == 0 {
+			zeros++
+		}
+		symbol += zeros
+		for ; zeros >= 3; zeros -= 3 {
+			w.write(3, 2)
+		}
+		w.write(uint64(zeros), 2)
+	}
+	return w.flush()
+}
+
+// codesOf returns the codes of a sequence
+func codesOf(seq sequence) sequenceCodes {
+	var c sequenceCodes
+	c.literalsLength = lengthCode(literalsLengthBase[:], uint32(seq.literals))
+	c.literalsLengthBits = literalsLengthBits[c.literalsLength]
+	c.literalsLengthExtra = uint64(uint32(seq.literals) - literalsLengthBase[c.literalsLength])
+	c.matchLength = lengthCode(matchLengthBase[:], uint32(seq.match))
+	c.matchLengthBits = matchLengthBits[c.matchLength]
+	c.matchLengthExtra = uint64(uint32(seq.match) - matchLengthBase[c.matchLength])
+	offsetValue := uint64(seq.offsetValue)
+	c.offset = uint8(bits.Len64(offsetValue) - 1)
+	c.offsetBits = c.offset
+	c.offsetExtra = offsetValue - 1<<c.offset
+	return c
+}
+
+// lengthCode returns the highest code whose baseline is not over v
+func lengthCode(base []uint32, v uint32) uint8 {
+	return uint8(sort.Search(len(base), func(i int) bool { return base[i] > v }) - 1)
+}
@@ -0,0 +1,179 @@
+package zstd
+
+import "math/bits"
+
+// fseEntry - decoding table cell: the symbol of the state, and how the next state is read
+type fseEntry struct {
+	symbol   uint8
+	nbBits   uint8
+	baseline uint16
+}
+
+// fseTable - decoding table of 1 << accuracyLog states
+type fseTable struct {
+	accuracyLog uint8
+	entries     []fseEntry
+}
+
+// fseState walks a decoding table
+type fseState struct {
+	table *fseTable
+	state uint16
+}
+
+func (s *fseState) init(table *fseTable, br *backwardReader) {
+	s.table = table
+	s.state = uint16(br.read(table.accuracyLog))
+}
+
+func (s *fseState) symbol() uint8 {
+	return s.table.entries[s.state].symbol
+}
+
+func (s *fseState) update(br *backwardReader) {
+	entry := s.table.entries[s.state]
+	s.state = entry.baseline + uint16(br.read(entry.nbBits))
+}
+
+// rleTable - every state decodes symbol and reads no bits
+func rleTable(symbol uint8) *fseTable {
+	return &fseTable{0, []fseEntry{{symbol: symbol}}}
+}
+
+// readFSETable decodes a table description, returning the table and the bytes it spans
+func readFSETable(in []byte, maxSymbol int, maxAccuracyLog uint8) (*fseTable, int, error) {
+	f := forwardReader{in: in}
+	low, err := f.read(4)
+	if err != nil {
+		return nil, 0, err
+	}
+	accuracyLog := uint8(low) + 5
+	if accuracyLog > maxAccuracyLog {
+		return nil, 0, ErrCorrupt
+	}
+	var (
+		remaining = 1 << accuracyLog
+		probas    = make([]int16, 0, maxSymbol+1)
+	)
+	for remaining > 0 && len(probas) <= maxSymbol {
+		nbBits := uint(bits.Len(uint(remaining + 1)))
+		value, err := f.read(nbBits)
+		if err != nil {
+			return nil, 0, err
+		}
+		// values lower than threshold are written on a bit less
+		lowerMask := uint32(1)<<(nbBits-1) - 1
+		threshold := uint32(1)<<nbBits - 1 - uint32(remaining+1)
+		if value&lowerMask < threshold {
+			f.rewind(1)
+			value &= lowerMask
+		} else if value > lowerMask {
+			value -= threshold
+		}
+		proba := int16(value) - 1
+		if proba < 0 {
+			remaining--
+		} else {
+			remaining -= int(proba)
+		}
+		probas = append(probas, proba)
+		if proba == 0 {
+			// zero probabilities are followed by 2 bits telling how many more follow, repeated while they are 3
+			for {
+				repeat, err := f.read(2)
+				if err != nil {
+					return nil, 0, err
+				}
+				for i := uint32(0); i < repeat && len(probas) <= maxSymbol; i++ {
+					probas = append(probas, 0)
+				}
+				if repeat != 3 {
+					break
+				}
+			}
+		}
+	}
+	if remaining != 0 || len(probas) > maxSymbol+1 {
+		return nil, 0, ErrCorrupt
+	}
+	table, err := buildFSETable(probas, accuracyLog)
+	if err != nil {
+		return nil, 0, err
+	}
+	return table, f.bytesRead(), nil
+}
+
+// buildFSETable spreads symbols over states according to their probabilities, -1 meaning less than 1
+func buildFSETable(probas []int16, accuracyLog uint8) (*fseTable, error) {
+	var (
+		size          = 1 << accuracyLog
+		entries       = make([]fseEntry, size)
+		next          = make([]uint16, len(probas))
+		highThreshold = size
+	)
+	// symbols of probability less than 1 get a single cell, from the end of the table
+	for symbol, proba := range probas {
+		if proba == -1 {
+			highThreshold--
+			entries[highThreshold].symbol = uint8(symbol)
+			next[symbol] = 1
+		}
+	}
+	var (
+		step = size>>1 + size>>3 + 3
+		mask = size - 1
+		pos  = 0
+	)
+	for symbol, proba := range probas {
+		if proba <= 0 {
+			continue
+		}
+		next[symbol] = uint16(proba)
+		for i := 0; i < int(proba); i++ {
+			entries[pos].symbol = uint8(symbol)
+			pos = (pos + step) & mask
+			for pos >= highThreshold {
+				pos = (pos + step) & mask
+			}
+		}
+	}
+	if pos != 0 {
+		return nil, ErrCorrupt
+	}
+	for i := range entries {
+		state := next[entries[i].symbol]
+		next[entries[i].symbol]++
+		nbBits := accuracyLog - uint8(bits.Len16(state)-1)
+		entries[i].nbBits = nbBits
+		entries[i].baseline = state<<nbBits - uint16(size)
+	}
+	return &fseTable{accuracyLog, entries}, nil
+}
+
+// predefined distributions of sequence codes
+// ref: https://datatracker.ietf.org/doc/html/rfc8878#section-3.1.1.3.2.2
+var (
+	literalsLengthTable = mustBuildFSETable([]int16{
+		4, 3, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 1, 1, 1,
+		2, 2, 2, 2, 2, 2, 2, 2, 2, 3, 2, 1, 1, 1, 1, 1,
+		-1, -1, -1, -1,
+	}, 6)
+	matchLengthTable = mustBuildFSETable([]int16{
+		1, 4, 3, 2, 2, 2, 2, 2, 2, 1, 1, 1, 1, 1, 1, 1,
+		1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1,
+		1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, -1, -1,
+		-1, -1, -1, -1, -1,
+	}, 6)
+	offsetTable = mustBuildFSETable([]int16{
+		1, 1, 1, 1, 1, 1, 2, 2, 2, 1, 1, 1, 1, 1, 1, 1,
+		1, 1, 1, 1, 1, 1, 1, 1, -1, -1, -1, -1, -1,
+	}, 5)
+)
+
+func mustBuildFSETable(probas []int16, accuracyLog uint8) *fseTable {
+	table, err := buildFSETable(probas, accuracyLog)
+	if err != nil {
+		panic(err)
+	}
+	return table
+}
@@ -0,0 +1,159 @@
+package zstd
+
+import "math/bits"
+
+const maxHuffmanBits = 11
+
+// huffmanEntry - decoding table cell, indexed by the next maxBits bits of the stream
+type huffmanEntry struct {
+	symbol uint8
+	nbBits uint8
+}
+
+type huffmanTable struct {
+	maxBits uint8
+	entries []huffmanEntry
+}
+
+// readHuffmanTable decodes a tree description, returning the table and the bytes it spans
+func readHuffmanTable(in []byte) (*huffmanTable, int, error) {
+	if len(in) == 0 {
+		return nil, 0, ErrCorrupt
+	}
+	var (
+		header  = int(in[0])
+		weights []uint8
+		size    int
+	)
+	if header < 128 {
+		// weights are FSE compressed over header bytes
+		size = 1 + header
+		if len(in) < size {
+			return nil, 0, ErrCorrupt
+		}
+		var err error
+		weights, err = readHuffmanWeights(in[1:size])
+		if err != nil {
+			return nil, 0, err
+		}
+	} else {
+		// weights are written directly, on 4 bits each
+		count := header - 127
+		size = 1 + (count+1)/2
+		if len(in) < size {
+			return nil, 0, ErrCorrupt
+		}
+		weights = make([]uint8, count)
+		for i := range weights {
+			b := in[1+i/2]
+			if i%2 == 0 {
+				weights[i] = b >> 4
+			} else {
+				weights[i] = b & 0xf
+			}
+		}
+	}
+	table, err := buildHuffmanTable(weights)
+	if err != nil {
+		return nil, 0, err
+	}
+	return table, size, nil
+}
+
+// readHuffmanWeights decodes weights with two interleaved FSE states, until the stream overflows
+func readHuffmanWeights(in []byte) ([]uint8, error) {
+	table, size, err := readFSETable(in, 255, 6)
+	if err != nil {
+		return nil, err
+	}
+	var br backwardReader
+	err = br.init(in[size:])
+	if err != nil {
+		return nil, err
+	}
+	var (
+		state1, state2 fseState
+		weights        = make([]uint8, 0, 255)
+	)
+	state1.init(table, &br)
+	state2.init(table, &br)
+	for len(weights) < 255 {
+		weights = append(weights, state1.symbol())
+		state1.update(&br)
+		if br.overflowed() {
+			weights = append(weights, state2.symbol())
+			break
+		}
+		weights = append(weights, state2.symbol())
+		state2.update(&br)
+		if br.overflowed() {
+			weights = append(weights, state1.symbol())
+			break
+		}
+	}
+	if !br.overflowed() || len(weights) > 255 {
+		return nil, ErrCorrupt
+	}
+	return weights, nil
+}
+
+// buildHuffmanTable completes weights with the implicit weight of the last symbol, then assigns prefix codes
+// from the lowest weight up, symbols of a same weight in their natural order
+func buildHuffmanTable(weights []uint8) (*huffmanTable, error) {
+	var sum uint32
+	for _, w := range weights {
+		if w > maxHuffmanBits {
+			return nil, ErrCorrupt
+		}
+		if w > 0 {
+			sum += 1 << (w - 1)
+		}
+	}
+	if sum == 0 {
+		return nil, ErrCorrupt
+	}
+	maxBits := uint8(bits.Len32(sum))
+	if maxBits > maxHuffmanBits {
+		return nil, ErrCorrupt
+	}
+	rest := uint32(1)<<maxBits - sum
+	if rest&(rest-1) != 0 {
+		return nil, ErrCorrupt
+	}
+	weights = append(weights, uint8(bits.Len32(rest)))
+	var (
+		entries = make([]huffmanEntry, 1<<maxBits)
+		pos     = 0
+	)
+	for w := uint8(1); w <= maxBits; w++ {
+		for symbol, weight := range weights {
+			if weight != w {
+				continue
+			}
+			cells := 1 << (w - 1)
+			for i := 0; i < cells; i++ {
+				entries[pos+i] = huffmanEntry{uint8(symbol), maxBits + 1 - w}
+			}
+			pos += cells
+		}
+	}
+	return &huffmanTable{maxBits, entries}, nil
+}
+
+// decodeStream decodes len(out) symbols of a single stream, which must be consumed exactly
+func (t *huffmanTable) decodeStream(in, out []byte) error {
+	var br backwardReader
+	err := br.init(in)
+	if err != nil {
+		return err
+	}
+	for i := range out {
+		entry := t.entries[br.peek(t.maxBits)]
+		out[i] = entry.symbol
+		br.pos -= int(entry.nbBits)
+	}
+	if br.pos != 0 {
+		return ErrCorrupt
+	}
+	return nil
+}
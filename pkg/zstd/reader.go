@@ -0,0 +1,250 @@
+// Package zstd implements the zstandard compression needed to compress output requests, and the decompression needed to accept zstd encoded request bodies.
+// ref: https://datatracker.ietf.org/doc/html/rfc8878
+package zstd
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+)
+
+var (
+	// ErrCorrupt - the input is not a valid zstd frame
+	ErrCorrupt = errors.New("ErrCorrupt - zstd: corrupt input")
+	// ErrDictionary - the frame requires a dictionary
+	ErrDictionary = errors.New("ErrDictionary - zstd: dictionaries are not supported")
+	// ErrWindowTooLarge - matches could reference more bytes than the decoder keeps
+	ErrWindowTooLarge = errors.New("ErrWindowTooLarge - zstd: window size exceeds 128MiB")
+	// ErrChecksum - the checksum of the frame does not match its content
+	ErrChecksum = errors.New("ErrChecksum - zstd: checksum mismatch")
+)
+
+const (
+	frameMagic         = 0xfd2fb528
+	skippableMagic     = 0x184d2a50
+	skippableMagicMask = 0xfffffff0
+	maxBlockSize       = 128 * 1024
+	minWindowLog       = 10
+	// maxWindowSize - default window limit of the reference decoder
+	maxWindowSize = 1 << 27
+)
+
+// Reader decompresses the zstd frames read from the underlying reader, one block at a time
+type Reader struct {
+	in *bufio.Reader
+	// out - decoded bytes, the last window of which matches may reference
+	out []byte
+	// read - bytes of out returned by Read
+	read int
+	err  error
+	// state of the current frame
+	inFrame                                bool
+	window                                 int
+	checksum                               bool
+	digest                                 xxhash
+	repeats                                [3]int
+	huffman                                *huffmanTable
+	literalsLengths, offsets, matchLengths *fseTable
+	// buffers of the current block
+	block    []byte
+	literals []byte
+}
+
+// NewReader decompresses frames read from r
+func NewReader(r io.Reader) *Reader {
+	return &Reader{
+		in:       bufio.NewReader(r),
+		block:    make([]byte, maxBlockSize),
+		literals: make([]byte, maxBlockSize),
+	}
+}
+
+// Read reads decompressed bytes, io.EOF is returned once every frame is decompressed
+func (r *Reader) Read(p []byte) (int, error) {
+	for r.read == len(r.out) {
+		if r.err != nil {
+			return 0, r.err
+		}
+		if r.inFrame {
+			r.err = r.readBlock()
+		} else {
+			r.err = r.readFrameHeader()
+		}
+	}
+	n := copy(p, r.out[r.read:])
+	r.read += n
+	return n, nil
+}
+
+// readFull reads exactly len(p) bytes, which must be there in a frame
+func (r *Reader) readFull(p []byte) error {
+	_, err := io.ReadFull(r.in, p)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return ErrCorrupt
+	}
+	return err
+}
+
+func (r *Reader) readFrameHeader() error {
+	var buf [14]byte
+	_, err := io.ReadFull(r.in, buf[:4])
+	switch err {
+	case nil:
+	case io.ErrUnexpectedEOF:
+		return ErrCorrupt
+	default:
+		// io.EOF once every frame is read
+		return err
+	}
+	magic := binary.LittleEndian.Uint32(buf[:4])
+	if magic&skippableMagicMask == skippableMagic {
+		err = r.readFull(buf[:4])
+		if err != nil {
+			return err
+		}
+		_, err = io.CopyN(ioutil.Discard, r.in, int64(binary.LittleEndian.Uint32(buf[:4])))
+		if err == io.EOF {
+			return ErrCorrupt
+		}
+		return err
+	}
+	if magic != frameMagic {
+		return ErrCorrupt
+	}
+	err = r.readFull(buf[:1])
+	if err != nil {
+		return err
+	}
+	var (
+		descriptor     = buf[0]
+		singleSegment  = descriptor>>5&1 == 1
+		dictionarySize = [4]int{0, 1, 2, 4}[descriptor&3]
+		contentSize    = [4]int{0, 2, 4, 8}[descriptor>>6]
+	)
+	if descriptor>>3&1 == 1 {
+		return ErrCorrupt
+	}
+	if singleSegment && contentSize == 0 {
+		contentSize = 1
+	}
+	windowDescriptor := 0
+	if !singleSegment {
+		windowDescriptor = 1
+	}
+	header := buf[:windowDescriptor+dictionarySize+contentSize]
+	err = r.readFull(header)
+	if err != nil {
+		return err
+	}
+	if !singleSegment {
+		windowLog := minWindowLog + uint(header[0]>>3)
+		if windowLog > 30 {
+			return ErrWindowTooLarge
+		}
+		base := 1 << windowLog
+		r.window = base + base/8*int(header[0]&7)
+	}
+	if dictionarySize > 0 {
+		var dictionaryID uint32
+		for i, b := range header[windowDescriptor : windowDescriptor+dictionarySize] {
+			dictionaryID |= uint32(b) << (8 * uint(i))
+		}
+		if dictionaryID != 0 {
+			return ErrDictionary
+		}
+	}
+	if singleSegment {
+		// the window spans the whole content
+		var size uint64
+		for i, b := range header[windowDescriptor+dictionarySize:] {
+			size |= uint64(b) << (8 * uint(i))
+		}
+		if contentSize == 2 {
+			size += 256
+		}
+		if size > maxWindowSize {
+			return ErrWindowTooLarge
+		}
+		r.window = int(size)
+	}
+	if r.window > maxWindowSize {
+		return ErrWindowTooLarge
+	}
+	r.inFrame = true
+	r.checksum = descriptor>>2&1 == 1
+	r.digest.reset()
+	r.repeats = [3]int{1, 4, 8}
+	r.huffman, r.literalsLengths, r.offsets, r.matchLengths = nil, nil, nil, nil
+	// matches do not reference previous frames
+	r.out, r.read = r.out[:0], 0
+	return nil
+}
+
+func (r *Reader) readBlock() error {
+	// keep the last window only, once over twice its size so that it is not moved on every block
+	if len(r.out) > 2*r.window && len(r.out) > maxBlockSize {
+		r.out = append(r.out[:0], r.out[len(r.out)-r.window:]...)
+		r.read = len(r.out)
+	}
+	var header [4]byte
+	err := r.readFull(header[:3])
+	if err != nil {
+		return err
+	}
+	var (
+		v         = binary.LittleEndian.Uint32(header[:])
+		lastBlock = v&1 == 1
+		typ       = v >> 1 & 3
+		size      = int(v >> 3)
+		maxSize   = maxBlockSize
+		start     = len(r.out)
+	)
+	if r.window < maxSize {
+		maxSize = r.window
+	}
+	if size > maxSize {
+		return ErrCorrupt
+	}
+	switch typ {
+	case blockRaw:
+		r.out = append(r.out, make([]byte, size)...)
+		err = r.readFull(r.out[start:])
+	case blockRLE:
+		err = r.readFull(header[:1])
+		for i := 0; i < size && err == nil; i++ {
+			r.out = append(r.out, header[0])
+		}
+	case blockCompressed:
+		err = r.readFull(r.block[:size])
+		if err == nil {
+			err = r.decodeCompressed(r.block[:size])
+		}
+		if err == nil && len(r.out)-start > maxSize {
+			err = ErrCorrupt
+		}
+	default:
+		err = ErrCorrupt
+	}
+	if err != nil {
+		return err
+	}
+	if r.checksum {
+		r.digest.write(r.out[start:])
+	}
+	if !lastBlock {
+		return nil
+	}
+	r.inFrame = false
+	if r.checksum {
+		err = r.readFull(header[:])
+		if err != nil {
+			return err
+		}
+		if binary.LittleEndian.Uint32(header[:]) != uint32(r.digest.sum64()) {
+			return ErrChecksum
+		}
+	}
+	return nil
+}
@@ -0,0 +1,210 @@
+package zstd
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"testing"
+)
+
+// sampleLogs - NDJSON lines, testdata/sample.*.zst hold them as compressed by the reference zstd CLI
+func sampleLogs(lines int) []byte {
+	levels := []string{"info", "warn", "error"}
+	var buf bytes.Buffer
+	for i := 0; i < lines; i++ {
+		fmt.Fprintf(&buf, `{"id":%d,"level":"%s","msg":"request served in %dms","path":"/v1/logs/%d"}`+"\n", i, levels[i*7%3], (i*7919)%900+1, i%17)
+	}
+	return buf.Bytes()
+}
+
+// noise - incompressible bytes, encoded as raw blocks
+func noise(size int) []byte {
+	buf := make([]byte, 0, size+sha256.Size)
+	for i := 0; len(buf) < size; i++ {
+		sum := sha256.Sum256([]byte(strconv.Itoa(i)))
+		buf = append(buf, sum[:]...)
+	}
+	return buf[:size]
+}
+
+func decode(t *testing.T, frames []byte) ([]byte, error) {
+	t.Helper()
+	return io.ReadAll(NewReader(bytes.NewReader(frames)))
+}
+
+func TestEncodeRoundTrip(t *testing.T) {
+	inputs := map[string][]byte{
+		"empty":    {},
+		"byte":     []byte("a"),
+		"repeats":  bytes.Repeat([]byte("hello, bulklog! "), 3),
+		"logs":     sampleLogs(2000),
+		"noise":    noise(300000),
+		"zeros":    make([]byte, 500000),
+		"block":    sampleLogs(10000)[:maxBlockSize],
+		"block+1":  sampleLogs(10000)[:maxBlockSize+1],
+		"mixed":    append(append(sampleLogs(500), noise(70000)...), sampleLogs(500)...),
+		"ascii255": bytes.Repeat([]byte{'x'}, 255),
+		"ascii256": bytes.Repeat([]byte{'x'}, 256),
+	}
+	for name, input := range inputs {
+		t.Run(name, func(t *testing.T) {
+			decoded, err := decode(t, Encode(input))
+			if err != nil {
+				t.Fatalf("decode: %s", err)
+			}
+			if !bytes.Equal(decoded, input) {
+				t.Fatalf("decoded %d bytes differ from the %d encoded", len(decoded), len(input))
+			}
+		})
+	}
+}
+
+func TestDecodeReferenceVectors(t *testing.T) {
+	vectors := []struct {
+		name   string
+		frame  string
+		output string
+	}{
+		{"empty frame", "28b52ffd2000010000", ""},
+		{"sequences and checksum", "28b52ffd24189500006068656c6c6f20776f726c640a0100e14a11a9bb502b", "hello hello hello world\n"},
+		{"repeat offsets", "28b52ffd2030bd00008868656c6c6f2c2062756c6b6c6f6721200a0100a6994b", "hello, bulklog! hello, bulklog! hello, bulklog!\n"},
+	}
+	for _, vector := range vectors {
+		t.Run(vector.name, func(t *testing.T) {
+			frame, err := hex.DecodeString(vector.frame)
+			if err != nil {
+				t.Fatal(err)
+			}
+			decoded, err := decode(t, frame)
+			if err != nil {
+				t.Fatalf("decode: %s", err)
+			}
+			if string(decoded) != vector.output {
+				t.Fatalf("decoded %q, want %q", decoded, vector.output)
+			}
+		})
+	}
+}
+
+func TestDecodeReferenceFiles(t *testing.T) {
+	logs := sampleLogs(2000)
+	files := map[string][]byte{
+		// zstd -1 --check
+		"sample.1.zst": logs,
+		// zstd -19 --no-check
+		"sample.19.zst": logs,
+		// both frames above, separated by a skippable frame
+		"sample.frames.zst": append(append([]byte{}, logs...), logs...),
+	}
+	for name, want := range files {
+		t.Run(name, func(t *testing.T) {
+			frames, err := os.ReadFile("testdata/" + name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			decoded, err := decode(t, frames)
+			if err != nil {
+				t.Fatalf("decode: %s", err)
+			}
+			if !bytes.Equal(decoded, want) {
+				t.Fatalf("decoded %d bytes differ from the %d expected", len(decoded), len(want))
+			}
+		})
+	}
+}
+
+// TestEncodeReferenceDecoder checks the reference zstd CLI decodes what Encode produces, when it is installed
+func TestEncodeReferenceDecoder(t *testing.T) {
+	path, err := exec.LookPath("zstd")
+	if err != nil {
+		t.Skip("zstd CLI is not installed")
+	}
+	for name, input := range map[string][]byte{
+		"empty": {},
+		"logs":  sampleLogs(2000),
+		"noise": noise(300000),
+		"zeros": make([]byte, 500000),
+	} {
+		t.Run(name, func(t *testing.T) {
+			cmd := exec.Command(path, "-d", "-c", "-q")
+			cmd.Stdin = bytes.NewReader(Encode(input))
+			decoded, err := cmd.Output()
+			if err != nil {
+				t.Fatalf("zstd -d: %s", err)
+			}
+			if !bytes.Equal(decoded, input) {
+				t.Fatalf("decoded %d bytes differ from the %d encoded", len(decoded), len(input))
+			}
+		})
+	}
+}
+
+func TestDecodeCorrupt(t *testing.T) {
+	frame := Encode(sampleLogs(100))
+	mismatch := append([]byte{}, frame...)
+	mismatch[len(mismatch)-1] ^= 0xff
+	_, err := decode(t, mismatch)
+	if err != ErrChecksum {
+		t.Fatalf("checksum mismatch: got %v, want %v", err, ErrChecksum)
+	}
+	_, err = decode(t, frame[:len(frame)/2])
+	if err == nil {
+		t.Fatal("truncated frame: got no error")
+	}
+	_, err = decode(t, []byte("not a zstd frame"))
+	if err != ErrCorrupt {
+		t.Fatalf("bad magic: got %v, want %v", err, ErrCorrupt)
+	}
+}
+
+func TestXXHash64(t *testing.T) {
+	vectors := map[string]uint64{
+		"":    0xef46db3751d8e999,
+		"a":   0xd24ec4f1a98c6e5b,
+		"abc": 0x44bc2cf5ad770999,
+	}
+	for input, want := range vectors {
+		var digest xxhash
+		digest.reset()
+		digest.write([]byte(input))
+		if got := digest.sum64(); got != want {
+			t.Errorf("xxhash64(%q) = %x, want %x", input, got, want)
+		}
+	}
+}
+
+// FuzzReader checks arbitrary request bodies fail to decode rather than panic, and what decodes encodes back
+func FuzzReader(f *testing.F) {
+	for _, frame := range []string{
+		"28b52ffd2000010000",
+		"28b52ffd24189500006068656c6c6f20776f726c640a0100e14a11a9bb502b",
+		"28b52ffd2030bd00008868656c6c6f2c2062756c6b6c6f6721200a0100a6994b",
+	} {
+		b, _ := hex.DecodeString(frame)
+		f.Add(b)
+	}
+	for _, name := range []string{"sample.1.zst", "sample.19.zst", "sample.frames.zst"} {
+		frames, err := os.ReadFile("testdata/" + name)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(frames)
+	}
+	f.Add(Encode(sampleLogs(100)))
+	f.Fuzz(func(t *testing.T, frames []byte) {
+		// bounds the output of small frames of large RLE blocks
+		decoded, err := io.ReadAll(io.LimitReader(NewReader(bytes.NewReader(frames)), 1<<24))
+		if err != nil {
+			return
+		}
+		redecoded, err := decode(t, Encode(decoded))
+		if err != nil || !bytes.Equal(redecoded, decoded) {
+			t.Fatalf("round trip of %d decoded bytes: %d bytes, %v", len(decoded), len(redecoded), err)
+		}
+	})
+}